@@ -0,0 +1,173 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"regexp"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+)
+
+// envVarName matches settings in the config file which are env vars, like AZURE_VAULT_NORMAL_POLL_INTERVALS
+var envVarName = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// readConfigFile reads a YAML file of controller settings, keyed by flag name like 'sync-workers'
+// or env var name like 'AZURE_VAULT_NORMAL_POLL_INTERVALS'
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfig(data)
+}
+
+func parseConfig(data []byte) (map[string]string, error) {
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return nil, fmt.Errorf("config must be a map of settings, error: %+v", err)
+	}
+
+	settings := make(map[string]string, len(values))
+	for name, value := range values {
+		if !envVarName.MatchString(name) && flag.Lookup(name) == nil {
+			return nil, fmt.Errorf("unknown setting '%s', must be a flag name or an env var name", name)
+		}
+
+		switch value.(type) {
+		case string, bool, json.Number:
+			settings[name] = fmt.Sprint(value)
+		default:
+			return nil, fmt.Errorf("setting '%s' must be a string, number or boolean", name)
+		}
+	}
+	return settings, nil
+}
+
+// applyConfig sets the flags and env vars of the settings which are not already set on the command
+// line or in the environment. Must be called after flag.Parse, and before anything else reads them.
+func applyConfig(settings map[string]string) error {
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	for name, value := range settings {
+		if flag.Lookup(name) != nil {
+			if explicit[name] {
+				continue
+			}
+			if err := flag.Set(name, value); err != nil {
+				return fmt.Errorf("invalid value '%s' for setting '%s', error: %+v", value, name, err)
+			}
+			continue
+		}
+
+		if _, ok := os.LookupEnv(name); ok {
+			continue
+		}
+		if err := os.Setenv(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// watchConfigFile returns a channel closed when the content of the config file changes, checked
+// every interval, or when SIGHUP is received. A file which can no longer be read or parsed is
+// logged and ignored, so the controller keeps running with the settings it has.
+func watchConfigFile(path string, interval time.Duration, stopCh <-chan struct{}) <-chan struct{} {
+	reload := make(chan struct{})
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	hash := func() [sha256.Size]byte {
+		data, _ := ioutil.ReadFile(path)
+		return sha256.Sum256(data)
+	}
+	loaded := hash()
+
+	go func() {
+		defer signal.Stop(hangup)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-hangup:
+				log.Infof("Received SIGHUP, reloading config file %s", path)
+			case <-ticker.C:
+				if hash() == loaded {
+					continue
+				}
+				log.Infof("Config file %s changed, reloading", path)
+			}
+
+			if _, err := readConfigFile(path); err != nil {
+				log.Errorf("failed to reload config file %s, keeping current settings, error: %+v", path, err)
+				loaded = hash()
+				continue
+			}
+			close(reload)
+			return
+		}
+	}()
+	return reload
+}
+
+// mergeStop returns a channel closed when either channel is closed
+func mergeStop(a, b <-chan struct{}) <-chan struct{} {
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-a:
+		case <-b:
+		}
+		close(stop)
+	}()
+	return stop
+}
+
+// restart replaces the process with a new instance of the controller, started with the same
+// arguments and environment as this one, so every setting of the config file is read again
+func restart(environ []string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(executable, os.Args, environ)
+}
@@ -0,0 +1,121 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseConfig(t *testing.T) {
+	settings, err := parseConfig([]byte(`
+crd-label-selector: akv2k8s.io/tier=prod
+AZURE_VAULT_NORMAL_POLL_INTERVALS: 2m
+AZURE_VAULT_MAX_CONCURRENT_REQUESTS: 1000000
+AZURE_VAULT_POLL_JITTER: 0.5
+CUSTOM_AUTH: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"crd-label-selector":                  "akv2k8s.io/tier=prod",
+		"AZURE_VAULT_NORMAL_POLL_INTERVALS":   "2m",
+		"AZURE_VAULT_MAX_CONCURRENT_REQUESTS": "1000000",
+		"AZURE_VAULT_POLL_JITTER":             "0.5",
+		"CUSTOM_AUTH":                         "true",
+	}
+	for name, value := range expected {
+		if settings[name] != value {
+			t.Errorf("expected setting %s to be '%s', got '%s'", name, value, settings[name])
+		}
+	}
+
+	for _, invalid := range []string{"unknown-flag: true", "SOME_LIST: [a, b]", "- not a map"} {
+		if _, err := parseConfig([]byte(invalid)); err == nil {
+			t.Errorf("expected error for config '%s'", invalid)
+		}
+	}
+}
+
+func TestApplyConfig(t *testing.T) {
+	defer func() {
+		crdLabelSelector = ""
+		os.Unsetenv("AKV2K8S_TEST_FROM_CONFIG")
+		os.Unsetenv("AKV2K8S_TEST_FROM_ENV")
+	}()
+	os.Setenv("AKV2K8S_TEST_FROM_ENV", "env")
+
+	err := applyConfig(map[string]string{
+		"crd-label-selector":       "akv2k8s.io/tier=prod",
+		"AKV2K8S_TEST_FROM_CONFIG": "config",
+		"AKV2K8S_TEST_FROM_ENV":    "config",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if crdLabelSelector != "akv2k8s.io/tier=prod" {
+		t.Errorf("expected flag to be set from config, got '%s'", crdLabelSelector)
+	}
+	if value := os.Getenv("AKV2K8S_TEST_FROM_CONFIG"); value != "config" {
+		t.Errorf("expected env var to be set from config, got '%s'", value)
+	}
+	if value := os.Getenv("AKV2K8S_TEST_FROM_ENV"); value != "env" {
+		t.Errorf("expected env var already set to override config, got '%s'", value)
+	}
+}
+
+func TestWatchConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "akv2k8s-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(path, []byte("LOG_LEVEL: info\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	reload := watchConfigFile(path, 10*time.Millisecond, stopCh)
+
+	// An invalid config is ignored
+	if err := ioutil.WriteFile(path, []byte("- invalid\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-reload:
+		t.Fatal("expected invalid config not to be reloaded")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := ioutil.WriteFile(path, []byte("LOG_LEVEL: debug\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-reload:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected changed config to be reloaded")
+	}
+}
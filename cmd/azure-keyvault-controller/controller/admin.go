@@ -0,0 +1,250 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const adminAzureKeyVaultSecretsPath = "/api/v1/azurekeyvaultsecrets"
+
+const adminCredentialsPath = "/api/v1/credentials"
+
+// adminAzureKeyVaultSecret is the sync state of a AzureKeyVaultSecret as seen by this controller
+type adminAzureKeyVaultSecret struct {
+	Namespace       string                             `json:"namespace"`
+	Name            string                             `json:"name"`
+	Vault           string                             `json:"vault"`
+	ObjectType      akv.AzureKeyVaultObjectType        `json:"objectType"`
+	ObjectName      string                             `json:"objectName"`
+	State           string                             `json:"state"`
+	SecretName      string                             `json:"secretName,omitempty"`
+	ObjectVersion   string                             `json:"objectVersion,omitempty"`
+	LastAzureUpdate *metav1.Time                       `json:"lastAzureUpdate,omitempty"`
+	RetryCount      int                                `json:"retryCount,omitempty"`
+	NextRetryTime   *metav1.Time                       `json:"nextRetryTime,omitempty"`
+	Conditions      []akv.AzureKeyVaultSecretCondition `json:"conditions,omitempty"`
+	LastErrors      []adminSyncError                   `json:"lastErrors,omitempty"`
+	Queues          []queuePosition                    `json:"queues,omitempty"`
+}
+
+// adminSyncError is the last error syncing a AzureKeyVaultSecret in a queue
+type adminSyncError struct {
+	Queue string `json:"queue"`
+	trackedError
+}
+
+// AdminHandler returns a http.Handler for inspecting the sync state, last errors and queue
+// positions of the AzureKeyVaultSecrets handled by this controller, for forcing them to sync and for
+// the latest credential check of each credential set:
+//
+//	GET  /api/v1/azurekeyvaultsecrets
+//	GET  /api/v1/azurekeyvaultsecrets/<namespace>/<name>
+//	POST /api/v1/azurekeyvaultsecrets/<namespace>/<name>/sync
+//	POST /api/v1/azurekeyvaultsecrets/<namespace>/<name>/approve[?version=<pending version>]
+//	GET  /api/v1/credentials
+//
+// Requests must provide token as a bearer token in the Authorization header.
+func (c *Controller) AdminHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(adminAzureKeyVaultSecretsPath, c.listAdminAzureKeyVaultSecrets)
+	mux.HandleFunc(adminAzureKeyVaultSecretsPath+"/", c.handleAdminAzureKeyVaultSecret)
+	mux.HandleFunc(adminCredentialsPath, c.listAdminCredentials)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bearer := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			log.Warningf("Received admin request from %s with invalid token", r.RemoteAddr)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (c *Controller) listAdminAzureKeyVaultSecrets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	azureKeyVaultSecrets, err := c.azureKeyVaultSecretLister.List(labels.Everything())
+	if err != nil {
+		log.Errorf("failed to list AzureKeyVaultSecrets, error: %+v", err)
+		http.Error(w, "failed to list AzureKeyVaultSecrets", http.StatusInternalServerError)
+		return
+	}
+
+	states := []adminAzureKeyVaultSecret{}
+	for _, azureKeyVaultSecret := range azureKeyVaultSecrets {
+		if !c.isHandled(azureKeyVaultSecret.Namespace, azureKeyVaultSecret.Name) {
+			continue
+		}
+		if namespace := r.URL.Query().Get("namespace"); namespace != "" && namespace != azureKeyVaultSecret.Namespace {
+			continue
+		}
+		states = append(states, c.adminState(azureKeyVaultSecret))
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if states[i].Namespace != states[j].Namespace {
+			return states[i].Namespace < states[j].Namespace
+		}
+		return states[i].Name < states[j].Name
+	})
+
+	writeAdminJSON(w, http.StatusOK, states)
+}
+
+func (c *Controller) listAdminCredentials(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, c.credentialHealth.list())
+}
+
+func (c *Controller) handleAdminAzureKeyVaultSecret(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, adminAzureKeyVaultSecretsPath+"/"), "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" || (len(parts) == 3 && parts[2] != "sync" && parts[2] != "approve") {
+		http.NotFound(w, r)
+		return
+	}
+	namespace, name := parts[0], parts[1]
+	var action string
+	if len(parts) == 3 {
+		action = parts[2]
+	}
+
+	if (action != "" && r.Method != http.MethodPost) || (action == "" && r.Method != http.MethodGet) {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !c.isHandled(namespace, name) {
+		http.Error(w, "AzureKeyVaultSecret not handled by this controller", http.StatusNotFound)
+		return
+	}
+
+	azureKeyVaultSecret, err := c.azureKeyVaultSecretLister.AzureKeyVaultSecrets(namespace).Get(name)
+	if errors.IsNotFound(err) {
+		http.Error(w, "AzureKeyVaultSecret not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Errorf("failed to get AzureKeyVaultSecret %s/%s, error: %+v", namespace, name, err)
+		http.Error(w, "failed to get AzureKeyVaultSecret", http.StatusInternalServerError)
+		return
+	}
+
+	switch action {
+	case "":
+		writeAdminJSON(w, http.StatusOK, c.adminState(azureKeyVaultSecret))
+		return
+	case "approve":
+		c.handleAdminApprove(w, r, azureKeyVaultSecret)
+		return
+	}
+
+	if !c.akvsHasSecretOutput(azureKeyVaultSecret) {
+		http.Error(w, "AzureKeyVaultSecret has no Secret output to sync", http.StatusConflict)
+		return
+	}
+
+	newLogger(azureKeyVaultSecret).WithField("remoteAddr", r.RemoteAddr).Info("AzureKeyVaultSecret forced to sync through admin API. Polling Azure Key Vault now.")
+	key := namespace + "/" + name
+	c.vaultFailures.reset(key)
+	c.azureKeyVaultQueue.GetQueue().Add(key)
+
+	writeAdminJSON(w, http.StatusAccepted, c.adminState(azureKeyVaultSecret))
+}
+
+// handleAdminApprove approves the version of the AzureKeyVaultSecret pending approval. If a version is
+// given, it must be the pending version, so a newer version than the one reviewed is not approved.
+func (c *Controller) handleAdminApprove(w http.ResponseWriter, r *http.Request, azureKeyVaultSecret *akv.AzureKeyVaultSecret) {
+	pending := azureKeyVaultSecret.Status.PendingVersion
+	if pending == "" {
+		http.Error(w, "AzureKeyVaultSecret has no version pending approval", http.StatusConflict)
+		return
+	}
+	if version := r.URL.Query().Get("version"); version != "" && version != pending {
+		http.Error(w, fmt.Sprintf("version '%s' is not pending approval, the pending version is '%s'", version, pending), http.StatusConflict)
+		return
+	}
+
+	if err := c.approveRotation(azureKeyVaultSecret); err != nil {
+		log.Errorf("failed to approve version '%s' of AzureKeyVaultSecret %s/%s, error: %+v", pending, azureKeyVaultSecret.Namespace, azureKeyVaultSecret.Name, err)
+		http.Error(w, "failed to approve AzureKeyVaultSecret", http.StatusInternalServerError)
+		return
+	}
+	newLogger(azureKeyVaultSecret).WithFields(log.Fields{"remoteAddr": r.RemoteAddr, "pendingVersion": pending}).Info("New version approved through admin API")
+
+	writeAdminJSON(w, http.StatusAccepted, c.adminState(azureKeyVaultSecret))
+}
+
+// adminState returns the sync state of the AzureKeyVaultSecret, with the last sync errors and
+// queue positions of its key
+func (c *Controller) adminState(azureKeyVaultSecret *akv.AzureKeyVaultSecret) adminAzureKeyVaultSecret {
+	status := azureKeyVaultSecret.Status
+	state := adminAzureKeyVaultSecret{
+		Namespace:     azureKeyVaultSecret.Namespace,
+		Name:          azureKeyVaultSecret.Name,
+		Vault:         azureKeyVaultSecret.Spec.Vault.Name,
+		ObjectType:    azureKeyVaultSecret.Spec.Vault.Object.Type,
+		ObjectName:    azureKeyVaultSecret.Spec.Vault.Object.Name,
+		State:         SyncState(azureKeyVaultSecret),
+		SecretName:    status.SecretName,
+		ObjectVersion: status.ObjectVersion,
+		RetryCount:    status.RetryCount,
+		Conditions:    status.Conditions,
+	}
+	if !status.LastAzureUpdate.IsZero() {
+		state.LastAzureUpdate = &status.LastAzureUpdate
+	}
+	if !status.NextRetryTime.IsZero() {
+		state.NextRetryTime = &status.NextRetryTime
+	}
+
+	key := azureKeyVaultSecret.Namespace + "/" + azureKeyVaultSecret.Name
+	for _, q := range []*queueWorker{c.akvsCrdQueue, c.azureKeyVaultQueue} {
+		if lastError, ok := q.queue.lastError(key); ok {
+			state.LastErrors = append(state.LastErrors, adminSyncError{Queue: q.name, trackedError: lastError})
+		}
+		if position, ok := q.queue.position(q.name, key); ok {
+			state.Queues = append(state.Queues, position)
+		}
+	}
+	return state
+}
+
+func writeAdminJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Errorf("failed to write admin response, error: %+v", err)
+	}
+}
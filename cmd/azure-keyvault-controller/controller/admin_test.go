@@ -0,0 +1,128 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	listers "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/client/listers/keyvault/v2alpha1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func newAdminTestController(t *testing.T) *Controller {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+
+	akvs := secret()
+	akvs.Spec.Output.Secret.Name = "some-secret"
+	if err := indexer.Add(akvs); err != nil {
+		t.Fatal(err)
+	}
+
+	return &Controller{
+		azureKeyVaultSecretLister: listers.NewAzureKeyVaultSecretLister(indexer),
+		akvsCrdQueue:              newQueueWorker("AzureKeyVaultSecrets", workqueue.DefaultControllerRateLimiter(), 1, 1, func(key string) error { return nil }),
+		azureKeyVaultQueue:        newQueueWorker("AzureKeyVault", workqueue.DefaultControllerRateLimiter(), 1, 1, func(key string) error { return nil }),
+		vaultFailures:             newFailureCounter(),
+		options:                   &Options{},
+	}
+}
+
+func adminRequest(c *Controller, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	c.AdminHandler("admin-token").ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminInvalidToken(t *testing.T) {
+	c := newAdminTestController(t)
+
+	for _, token := range []string{"", "wrong"} {
+		if rec := adminRequest(c, http.MethodGet, "/api/v1/azurekeyvaultsecrets", token); rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected status 401 for token '%s', got %d", token, rec.Code)
+		}
+	}
+}
+
+func TestAdminListAzureKeyVaultSecrets(t *testing.T) {
+	c := newAdminTestController(t)
+	c.azureKeyVaultQueue.queue.recordError("default/test-name", errors.New("vault unavailable"))
+	c.azureKeyVaultQueue.GetQueue().Add("default/other")
+	c.azureKeyVaultQueue.GetQueue().Add("default/test-name")
+
+	rec := adminRequest(c, http.MethodGet, "/api/v1/azurekeyvaultsecrets", "admin-token")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+
+	var states []adminAzureKeyVaultSecret
+	if err := json.Unmarshal(rec.Body.Bytes(), &states); err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 1 {
+		t.Fatalf("expected 1 AzureKeyVaultSecret, got %d", len(states))
+	}
+
+	state := states[0]
+	if state.Name != "test-name" || state.State != "Pending" {
+		t.Errorf("expected pending AzureKeyVaultSecret test-name, got %+v", state)
+	}
+	if len(state.LastErrors) != 1 || state.LastErrors[0].Queue != "AzureKeyVault" || state.LastErrors[0].Error != "vault unavailable" {
+		t.Errorf("expected last error from AzureKeyVault queue, got %+v", state.LastErrors)
+	}
+	if len(state.Queues) != 1 || state.Queues[0].State != "waiting" || state.Queues[0].Position != 2 {
+		t.Errorf("expected to be waiting as number 2 in AzureKeyVault queue, got %+v", state.Queues)
+	}
+}
+
+func TestAdminGetAzureKeyVaultSecret(t *testing.T) {
+	c := newAdminTestController(t)
+
+	if rec := adminRequest(c, http.MethodGet, "/api/v1/azurekeyvaultsecrets/default/test-name", "admin-token"); rec.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", rec.Code)
+	}
+	if rec := adminRequest(c, http.MethodGet, "/api/v1/azurekeyvaultsecrets/default/missing", "admin-token"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", rec.Code)
+	}
+}
+
+func TestAdminSyncAzureKeyVaultSecret(t *testing.T) {
+	c := newAdminTestController(t)
+	c.vaultFailures.inc("default/test-name")
+
+	if rec := adminRequest(c, http.MethodGet, "/api/v1/azurekeyvaultsecrets/default/test-name/sync", "admin-token"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status 405, got %d", rec.Code)
+	}
+
+	if rec := adminRequest(c, http.MethodPost, "/api/v1/azurekeyvaultsecrets/default/test-name/sync", "admin-token"); rec.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d", rec.Code)
+	}
+	if c.azureKeyVaultQueue.GetQueue().Len() != 1 {
+		t.Errorf("expected 1 AzureKeyVaultSecret in queue, got %d", c.azureKeyVaultQueue.GetQueue().Len())
+	}
+	if failures := c.vaultFailures.get("default/test-name"); failures != 0 {
+		t.Errorf("expected failures to be reset, got %d", failures)
+	}
+}
@@ -0,0 +1,97 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ApproveRotationAnnotation approves applying a new version of the object in Azure Key Vault to the output Secret
+// of a AzureKeyVaultSecret with the rotation approval Manual, when set to the status.pendingVersion of it
+const ApproveRotationAnnotation = "keyvault.azure.spv.no/approve-rotation"
+
+// requiresApproval returns true if changes to the object in Azure Key Vault must be approved before being applied
+func requiresApproval(azureKeyVaultSecret *akv.AzureKeyVaultSecret) bool {
+	policy := azureKeyVaultSecret.Spec.RotationPolicy
+	return policy != nil && policy.Approval == akv.AzureKeyVaultRotationApprovalManual
+}
+
+// pendingVersionFor returns what a new version is approved by, which is the version of the object
+// in Azure Key Vault, or the hash of its value if the version is not known
+func pendingVersionFor(objectVersion *vault.ObjectVersion, secretHash string) string {
+	if objectVersion != nil && objectVersion.ID != "" {
+		return objectVersion.ID
+	}
+	return secretHash
+}
+
+// awaitApproval returns true if the new version of the object in Azure Key Vault has not been approved
+// using ApproveRotationAnnotation. The version is then set as pending in the status along with the
+// PendingApproval condition, and an event and notification are sent the first time it is found.
+func (c *Controller) awaitApproval(azureKeyVaultSecret *akv.AzureKeyVaultSecret, secretHash string, objectVersion *vault.ObjectVersion) (bool, error) {
+	if !requiresApproval(azureKeyVaultSecret) {
+		return false, nil
+	}
+
+	logger := newLogger(azureKeyVaultSecret)
+	pending := pendingVersionFor(objectVersion, secretHash)
+	if azureKeyVaultSecret.Annotations[ApproveRotationAnnotation] == pending {
+		logger.WithField("pendingVersion", pending).Info("New version in Azure Key Vault has been approved")
+		return false, nil
+	}
+
+	msg := fmt.Sprintf(MessageRotationPendingApproval, pending, azureKeyVaultSecret.Spec.Vault.Object.Name, ApproveRotationAnnotation, pending)
+	if azureKeyVaultSecret.Status.PendingVersion != pending {
+		logger.WithField("pendingVersion", pending).Info("Secret has changed in Azure Key Vault, waiting for approval to update Secret")
+		c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeNormal, RotationPendingApproval, msg)
+		c.notify(NotificationPendingApproval, azureKeyVaultSecret, pending, msg)
+	}
+
+	now := c.clock.Now()
+	return true, c.mutateAzureKeyVaultSecretStatus(azureKeyVaultSecret, func(status *akv.AzureKeyVaultSecretStatus) {
+		status.LastAzureUpdate = now
+		status.PendingVersion = pending
+		setCondition(status, akv.AzureKeyVaultSecretCondition{
+			Type:    akv.AzureKeyVaultSecretConditionPendingApproval,
+			Status:  corev1.ConditionTrue,
+			Reason:  "AwaitingApproval",
+			Message: msg,
+		}, now)
+	})
+}
+
+// approveRotation approves the pending version of the AzureKeyVaultSecret by setting ApproveRotationAnnotation,
+// which makes it be polled from Azure Key Vault and the version applied
+func (c *Controller) approveRotation(azureKeyVaultSecret *akv.AzureKeyVaultSecret) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{ApproveRotationAnnotation: azureKeyVaultSecret.Status.PendingVersion},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create patch for azurekeyvaultsecret '%s'/'%s', error: %w", azureKeyVaultSecret.Namespace, azureKeyVaultSecret.Name, err)
+	}
+
+	_, err = c.akvsClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(azureKeyVaultSecret.Namespace).Patch(azureKeyVaultSecret.Name, types.MergePatchType, patch)
+	return err
+}
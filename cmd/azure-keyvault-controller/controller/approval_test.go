@@ -0,0 +1,110 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"net/http"
+	"testing"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+)
+
+// newPendingApprovalFixture returns a fixture with a synced AzureKeyVaultSecret requiring approval,
+// and a new version of its object in Azure Key Vault pending approval
+func newPendingApprovalFixture(t *testing.T) (*fixture, *akv.AzureKeyVaultSecret, string) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "old-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Spec.RotationPolicy = &akv.AzureKeyVaultRotationPolicy{Approval: akv.AzureKeyVaultRotationApprovalManual}
+	f.addAzureKeyVaultSecret(akvs)
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+	f.drainEvents()
+
+	version := f.vault.SetSecret(testVaultName, "my-secret", "new-value")
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+	return f, akvs, version
+}
+
+func TestSyncAwaitsApproval(t *testing.T) {
+	f, akvs, version := newPendingApprovalFixture(t)
+
+	if value := string(f.getSecret(akvs.Namespace, "my-kubernetes-secret").Data["value"]); value != "old-value" {
+		t.Errorf("expected Secret to keep 'old-value' until approved, got '%s'", value)
+	}
+	f.expectEvent(RotationPendingApproval)
+	status := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status
+	if status.PendingVersion != version {
+		t.Errorf("expected pending version '%s', got '%s'", version, status.PendingVersion)
+	}
+	if !isConditionTrue(&status, akv.AzureKeyVaultSecretConditionPendingApproval) {
+		t.Error("expected PendingApproval condition to be true")
+	}
+
+	// Polling again does not send the event again for the same version
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.expectNoEvents()
+
+	approved := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name)
+	approved.Annotations = map[string]string{ApproveRotationAnnotation: version}
+	if _, err := f.akvsClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(akvs.Namespace).Update(approved); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+
+	if value := string(f.getSecret(akvs.Namespace, "my-kubernetes-secret").Data["value"]); value != "new-value" {
+		t.Errorf("expected Secret to be updated to 'new-value' when approved, got '%s'", value)
+	}
+	status = f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status
+	if status.PendingVersion != "" || isConditionTrue(&status, akv.AzureKeyVaultSecretConditionPendingApproval) {
+		t.Errorf("expected no version pending approval, got '%s'", status.PendingVersion)
+	}
+}
+
+func TestAdminApprove(t *testing.T) {
+	f, akvs, version := newPendingApprovalFixture(t)
+	path := "/api/v1/azurekeyvaultsecrets/" + akvs.Namespace + "/" + akvs.Name + "/approve"
+
+	if rec := adminRequest(f.controller, http.MethodPost, path+"?version=other-version", "admin-token"); rec.Code != http.StatusConflict {
+		t.Errorf("expected status 409 approving another version, got %d", rec.Code)
+	}
+	if rec := adminRequest(f.controller, http.MethodPost, path+"?version="+version, "admin-token"); rec.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if approved := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Annotations[ApproveRotationAnnotation]; approved != version {
+		t.Errorf("expected annotation %s to be '%s', got '%s'", ApproveRotationAnnotation, version, approved)
+	}
+}
+
+func TestAdminApproveWithoutPendingVersion(t *testing.T) {
+	c := newAdminTestController(t)
+
+	if rec := adminRequest(c, http.MethodPost, "/api/v1/azurekeyvaultsecrets/default/test-name/approve", "admin-token"); rec.Code != http.StatusConflict {
+		t.Errorf("expected status 409, got %d", rec.Code)
+	}
+}
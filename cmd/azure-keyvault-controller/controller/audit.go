@@ -0,0 +1,81 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"io"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	log "github.com/sirupsen/logrus"
+)
+
+// AuditAction is a change made to a Secret, as recorded in the audit log
+type AuditAction string
+
+const (
+	// AuditActionCreate is recorded when a Secret is created
+	AuditActionCreate AuditAction = "create"
+
+	// AuditActionUpdate is recorded when the data or metadata of a Secret is updated
+	AuditActionUpdate AuditAction = "update"
+
+	// AuditActionDelete is recorded when a Secret is deleted
+	AuditActionDelete AuditAction = "delete"
+
+	// AuditActionAdopt is recorded when an orphaned Secret is owned by its AzureKeyVaultSecret again
+	AuditActionAdopt AuditAction = "adopt"
+)
+
+// newAuditLogger returns a logger writing audit records as JSON lines to w, or nil if w is nil
+func newAuditLogger(w io.Writer) *log.Logger {
+	if w == nil {
+		return nil
+	}
+	return &log.Logger{
+		Out:       w,
+		Formatter: &log.JSONFormatter{},
+		Hooks:     make(log.LevelHooks),
+		Level:     log.InfoLevel,
+	}
+}
+
+// auditSecret records a change made to a Secret in the audit log. Only the names of changed keys are
+// recorded, never their values. azureKeyVaultSecret is nil when the Secret has no AzureKeyVaultSecret.
+func (c *Controller) auditSecret(action AuditAction, namespace, secretName string, azureKeyVaultSecret *akv.AzureKeyVaultSecret, objectVersion string, keys []string) {
+	if c.auditLog == nil {
+		return
+	}
+
+	fields := log.Fields{
+		"action":     action,
+		"namespace":  namespace,
+		"secret":     secretName,
+		"controller": c.options.Identity,
+	}
+	if azureKeyVaultSecret != nil {
+		fields["azureKeyVaultSecret"] = azureKeyVaultSecret.Name
+		fields["azureKeyVaultSecretUID"] = azureKeyVaultSecret.UID
+		fields["vault"] = azureKeyVaultSecret.Spec.Vault.Name
+		fields["object"] = azureKeyVaultSecret.Spec.Vault.Object.Name
+		fields["objectType"] = azureKeyVaultSecret.Spec.Vault.Object.Type
+		fields["objectVersion"] = objectVersion
+	}
+	if keys != nil {
+		fields["keys"] = keys
+	}
+	c.auditLog.WithFields(fields).Infof("Secret %s", action)
+}
@@ -20,14 +20,19 @@ limitations under the License.
 package controller
 
 import (
+	"context"
+	goerrors "errors"
 	"fmt"
 
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/akv2k8s/redact"
 	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/akv2k8s/transformers"
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
 	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
 	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
 	log "github.com/sirupsen/logrus"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
@@ -44,8 +49,12 @@ func (c *Controller) initAzureKeyVaultSecret() {
 				log.Errorf("failed to convert to azurekeyvaultsecret: %v", err)
 			}
 
+			if !c.isHandled(secret.Namespace, secret.Name) {
+				return
+			}
+
 			if c.akvsHasSecretOutput(secret) {
-				log.Debugf("AzureKeyVaultSecret %s/%s added. Adding to queue.", secret.Namespace, secret.Name)
+				newLogger(secret).Debug("AzureKeyVaultSecret added. Adding to queue.")
 				queue.Enqueue(c.akvsCrdQueue.GetQueue(), obj)
 				// queue.Enqueue(c.azureKeyVaultQueue.GetQueue(), obj)
 			}
@@ -61,17 +70,33 @@ func (c *Controller) initAzureKeyVaultSecret() {
 				log.Errorf("failed to convert to azurekeyvaultsecret: %v", err)
 			}
 
-			// If akvs has not changed and has secret output, add to akv queue to check if secret has changed in akv
-			if newSecret.ResourceVersion == oldSecret.ResourceVersion && c.akvsHasSecretOutput(newSecret) {
-				log.Debugf("AzureKeyVaultSecret %s/%s not changed. Adding to Azure Key Vault queue to check if secret has changed in Azure Key Vault.", newSecret.Namespace, newSecret.Name)
-				queue.Enqueue(c.azureKeyVaultQueue.GetQueue(), new)
+			if !c.isHandled(newSecret.Namespace, newSecret.Name) {
+				return
+			}
+
+			// Periodic resync will send update events for all known AzureKeyVaultSecrets. Polling
+			// Azure Key Vault for changes is scheduled by staleness in runAzurePolling instead.
+			if newSecret.ResourceVersion == oldSecret.ResourceVersion {
 				return
 			}
 
 			if c.akvsHasSecretOutput(newSecret) || c.akvsHasSecretOutput(oldSecret) {
-				log.Debugf("AzureKeyVaultSecret %s/%s changed. Adding to queue.", newSecret.Namespace, newSecret.Name)
+				newLogger(newSecret).Debug("AzureKeyVaultSecret changed. Adding to queue.")
 				queue.Enqueue(c.akvsCrdQueue.GetQueue(), new)
 			}
+
+			// Removing the keys from the bundle Secret the AzureKeyVaultSecret no longer contributes to
+			if isBundle(oldSecret) && (!isBundle(newSecret) || determineSecretName(oldSecret) != determineSecretName(newSecret)) {
+				c.akvsSecretQueue.GetQueue().Add(oldSecret.Namespace + "/" + determineSecretName(oldSecret))
+			}
+
+			if c.akvsHasSecretOutput(newSecret) && shouldResumePolling(oldSecret, newSecret) {
+				newLogger(newSecret).Info("AzureKeyVaultSecret changed or forced to sync. Polling Azure Key Vault now.")
+				if key, err := cache.MetaNamespaceKeyFunc(new); err == nil {
+					c.vaultFailures.reset(key)
+				}
+				queue.Enqueue(c.azureKeyVaultQueue.GetQueue(), new)
+			}
 		},
 		DeleteFunc: func(obj interface{}) {
 			secret, err := convertToAzureKeyVaultSecret(obj)
@@ -79,8 +104,12 @@ func (c *Controller) initAzureKeyVaultSecret() {
 				log.Errorf("failed to convert to azurekeyvaultsecret: %v", err)
 			}
 
+			if !c.isHandled(secret.Namespace, secret.Name) {
+				return
+			}
+
 			if c.akvsHasSecretOutput(secret) {
-				log.Debugf("AzureKeyVaultSecret %s/%s deleted. Adding to delete queue.", secret.Namespace, secret.Name)
+				newLogger(secret).Debug("AzureKeyVaultSecret deleted. Adding to delete queue.")
 				queue.Enqueue(c.akvsCrdQueue.GetQueue(), obj)
 
 				// Getting default key to remove from Azure work queue
@@ -90,7 +119,18 @@ func (c *Controller) initAzureKeyVaultSecret() {
 					return
 				}
 				c.azureKeyVaultQueue.GetQueue().Forget(key)
+				c.vaultFailures.reset(key)
+
+				// The bundle Secret is only garbage collected when all its AzureKeyVaultSecrets are deleted
+				if isBundle(secret) {
+					c.akvsSecretQueue.GetQueue().Add(secret.Namespace + "/" + determineSecretName(secret))
+				}
 			}
+			deleteRotationMetrics(secret.Namespace, secret.Name)
+			c.rotations.forget(secret.Namespace + "/" + secret.Name)
+			c.rollouts.forget(secret.Namespace + "/" + secret.Name)
+			c.publicCertificates.forget(secret.Namespace + "/" + secret.Name)
+			redact.Default.Delete(secret.Namespace + "/" + secret.Name)
 		},
 	})
 }
@@ -110,12 +150,15 @@ func convertToAzureKeyVaultSecret(obj interface{}) (*v2alpha1.AzureKeyVaultSecre
 	return secret, nil
 }
 
-func (c *Controller) syncAzureKeyVaultSecret(key string) error {
+func (c *Controller) syncAzureKeyVaultSecret(key string) (err error) {
 	var azureKeyVaultSecret *akv.AzureKeyVaultSecret
 	var secret *corev1.Secret
-	var err error
 
 	log.Debugf("Processing AzureKeyVaultSecret %s", key)
+	if deleting, err := c.finalizeAzureKeyVaultSecret(key); deleting {
+		return err
+	}
+
 	if azureKeyVaultSecret, err = c.getAzureKeyVaultSecret(key); err != nil {
 		if exit := handleKeyVaultError(err, key); exit {
 			return nil
@@ -123,19 +166,60 @@ func (c *Controller) syncAzureKeyVaultSecret(key string) error {
 		return err
 	}
 
+	_, span := startSpan(context.Background(), "syncAzureKeyVaultSecret", azureKeyVaultSecret)
+	defer func() { endSpan(span, err) }()
+
+	logger := newLogger(azureKeyVaultSecret)
 	if secret, err = c.getOrCreateKubernetesSecret(azureKeyVaultSecret); err != nil {
+		if forbidden, ok := vault.AsForbidden(err); ok {
+			return c.handleForbidden(azureKeyVaultSecret, forbidden, err)
+		}
+		if vault.IsNotExportable(err) {
+			return c.handleNotExportable(azureKeyVaultSecret, err)
+		}
+		var tooLarge *secretTooLargeError
+		if goerrors.As(err, &tooLarge) {
+			return c.handleSecretTooLarge(azureKeyVaultSecret, tooLarge)
+		}
+		if isObjectDeleted(azureKeyVaultSecret, err) {
+			// Already handled when polled from Azure Key Vault, like when the Secret is deleted by the policy
+			if isConditionTrue(&azureKeyVaultSecret.Status, akv.AzureKeyVaultSecretConditionObjectDeleted) {
+				logger.Debug("Object is deleted in Azure Key Vault, not creating Secret")
+				return nil
+			}
+			return c.handleDeletedObject(azureKeyVaultSecret, key, err)
+		}
 		return err
 	}
 
-	if !metav1.IsControlledBy(secret, azureKeyVaultSecret) { // checks if the object has a controllerRef set to the given owner
+	if !ownsSecret(azureKeyVaultSecret, secret) { // checks if the object has a controllerRef set to the given owner, or is its bundle
 		msg := fmt.Sprintf(MessageResourceExists, secret.Name)
-		log.Warning(msg)
+		logger.Warning(msg)
 		c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, ErrResourceExists, msg)
-		return fmt.Errorf(msg)
+		return newOutputConflictError(msg)
+	}
+
+	if err = c.syncPreviousSecret(azureKeyVaultSecret, key); err != nil {
+		return err
+	}
+
+	if err = c.updateConsumers(azureKeyVaultSecret); err != nil {
+		return err
+	}
+
+	if err = c.ensureCleanupFinalizer(azureKeyVaultSecret); err != nil {
+		return err
+	}
+
+	if err = c.syncTrustBundle(azureKeyVaultSecret, secret); err != nil {
+		return err
+	}
+
+	if err = c.syncRemoteClusters(azureKeyVaultSecret, secret); err != nil {
+		return err
 	}
 
-	log.Debugf("Successfully synced AzureKeyVaultSecret %s with Kubernetes Secret %s", key, fmt.Sprintf("%s/%s", secret.Namespace, secret.Name))
-	c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeNormal, SuccessSynced, MessageAzureKeyVaultSecretSynced)
+	logger.WithField("secret", secret.Name).Debug("Successfully synced AzureKeyVaultSecret with Kubernetes Secret")
 	return nil
 }
 
@@ -143,11 +227,9 @@ func (c *Controller) akvsHasSecretOutput(secret *v2alpha1.AzureKeyVaultSecret) b
 	return secret.Spec.Output.Secret.Name != ""
 }
 
-func (c *Controller) syncAzureKeyVault(key string) error {
+func (c *Controller) syncAzureKeyVault(key string) (err error) {
 	var azureKeyVaultSecret *akv.AzureKeyVaultSecret
 	var secret *corev1.Secret
-	var secretValue map[string][]byte
-	var err error
 
 	log.Debugf("Checking state for %s in Azure", key)
 	if azureKeyVaultSecret, err = c.getAzureKeyVaultSecret(key); err != nil {
@@ -157,38 +239,241 @@ func (c *Controller) syncAzureKeyVault(key string) error {
 		return err
 	}
 
-	log.Debugf("Getting secret value for %s in Azure", key)
-	if secretValue, err = c.getSecretFromKeyVault(azureKeyVaultSecret); err != nil {
-		msg := fmt.Sprintf(FailedAzureKeyVault, azureKeyVaultSecret.Name, azureKeyVaultSecret.Spec.Vault.Name)
-		log.Errorf("failed to get secret value for '%s' from Azure Key vault '%s' using object name '%s', error: %+v", key, azureKeyVaultSecret.Spec.Vault.Name, azureKeyVaultSecret.Spec.Vault.Object.Name, err)
-		c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, ErrAzureVault, msg)
+	ctx, span := startSpan(context.Background(), "syncAzureKeyVault", azureKeyVaultSecret)
+	defer func() { endSpan(span, err) }()
+
+	logger := newLogger(azureKeyVaultSecret)
+	vaultName := azureKeyVaultSecret.Spec.Vault.Name
+	secretValue, objectVersion, err := c.getSecretFromVault(ctx, key, azureKeyVaultSecret)
+	if err == nil {
+		if failures := c.vaultFailures.get(key); failures > 0 {
+			msg := fmt.Sprintf(MessageAzureKeyVaultRecovered, vaultName, failures)
+			logger.Info(msg)
+			c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeNormal, AzureVaultRecovered, msg)
+		}
+		c.vaultFailures.reset(key)
+	} else if c.shouldUseFallbackVault(key, azureKeyVaultSecret) {
+		vaultName = azureKeyVaultSecret.Spec.Vault.Fallback
+		logger.WithError(err).Warningf("Failed to get secret value too many times, trying fallback Azure Key Vault '%s'", vaultName)
+		logger = logger.WithField("vault", vaultName)
+		secretValue, objectVersion, err = c.getSecretFromVault(ctx, key, withVaultName(azureKeyVaultSecret, vaultName))
+	}
+
+	if err != nil {
+		if isObjectDeleted(azureKeyVaultSecret, err) {
+			return c.handleDeletedObject(azureKeyVaultSecret, key, err)
+		}
+
+		if vault.IsNotExportable(err) {
+			return c.handleNotExportable(azureKeyVaultSecret, err)
+		}
+
+		var circuitErr *circuitOpenError
+		if goerrors.As(err, &circuitErr) {
+			return c.handleDegradedVault(azureKeyVaultSecret, circuitErr)
+		}
+
+		requestID, clientRequestID := vault.RequestIDs(err)
+		reason, msg := ErrAzureVault, fmt.Sprintf(FailedAzureKeyVault, azureKeyVaultSecret.Name, vaultName)
+		forbidden, isForbidden := vault.AsForbidden(err)
+		if isForbidden {
+			reason, msg = ErrAzureVaultForbidden, forbiddenMessage(azureKeyVaultSecret, vaultName, forbidden)
+		}
+		msg += formatRequestIDs(requestID, clientRequestID)
+		logger.WithFields(log.Fields{
+			"requestId":       requestID,
+			"clientRequestId": clientRequestID,
+		}).WithError(err).Error("failed to get secret value from Azure Key Vault")
+
+		// Only the first failure in a row is recorded as an Event, to not flood the AzureKeyVaultSecret
+		failures := c.vaultFailures.get(key)
+		if failures <= 1 {
+			c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, reason, msg)
+		}
+
+		now := c.clock.Now()
+		conditions := func(status *akv.AzureKeyVaultSecretStatus) {
+			updateForbiddenCondition(status, forbidden, msg, now)
+		}
+		if c.isDegradedFailure(failures) {
+			return c.degradeAzureKeyVaultSecret(azureKeyVaultSecret, key, failures, msg, conditions)
+		}
+
+		retryAfter, hasRetryAfter := vault.RetryAfter(err, now.Time)
+		if statusErr := c.backOffAzureKeyVaultSecret(azureKeyVaultSecret, failures, retryAfter, conditions); statusErr != nil {
+			logger.WithError(statusErr).Error("failed to update status for AzureKeyVaultSecret")
+		}
+
+		// Retrying exactly when Azure Key Vault asked to instead of using the queue rate limiter,
+		// which would retry throttled requests too early
+		if hasRetryAfter {
+			logger.WithField("retryAfter", retryAfter).Info("Azure Key Vault asked to retry later, requeuing AzureKeyVaultSecret")
+			c.azureKeyVaultQueue.GetQueue().Forget(key)
+			c.azureKeyVaultQueue.GetQueue().AddAfter(key, retryAfter)
+			return nil
+		}
 		return fmt.Errorf(msg)
 	}
 
-	secretHash := getMD5Hash(secretValue)
+	if vaultName != azureKeyVaultSecret.Spec.Vault.Name && azureKeyVaultSecret.Status.VaultName != vaultName {
+		msg := fmt.Sprintf(MessageAzureKeyVaultFallback, vaultName, azureKeyVaultSecret.Spec.Vault.Name)
+		logger.Warning(msg)
+		c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, AzureVaultFallback, msg)
+	}
 
-	log.Debugf("Checking if secret value for %s has changed in Azure", key)
-	if azureKeyVaultSecret.Status.SecretHash != secretHash {
-		log.Infof("Secret has changed in Azure Key Vault for AzureKeyvVaultSecret %s. Updating Secret now.", azureKeyVaultSecret.Name)
+	// The Secret was deleted along with the object, so it is created again by the AzureKeyVaultSecret queue
+	if isSecretDeletedWithObject(azureKeyVaultSecret) {
+		logger.Info("Object exists in Azure Key Vault again, recreating Secret")
+		queue.Enqueue(c.akvsCrdQueue.GetQueue(), azureKeyVaultSecret)
+		return nil
+	}
 
-		if secret, err = c.kubeclientset.CoreV1().Secrets(azureKeyVaultSecret.Namespace).Update(createNewSecret(azureKeyVaultSecret, secretValue)); err != nil {
-			log.Warningf("Failed to create Secret, Error: %+v", err)
-			return err
+	detector, err := changeDetectorFor(azureKeyVaultSecret)
+	if err != nil {
+		return err
+	}
+
+	secretHash := azureKeyVaultSecret.Status.SecretHash
+	rolledOut := false
+	if secretValue != nil {
+		secretHash = getSecretHash(secretValue)
+		changed := hasValueChanged(azureKeyVaultSecret, secretHash)
+
+		// Only changes after the first sync wait for approval and the rotation window, as there is no value to keep until then
+		if changed && azureKeyVaultSecret.Status.SecretHash != "" {
+			if awaiting, err := c.awaitApproval(azureKeyVaultSecret, secretHash, objectVersion); awaiting || err != nil {
+				return err
+			}
+			if deferred, err := c.deferRotation(azureKeyVaultSecret, key); deferred || err != nil {
+				return err
+			}
 		}
 
-		log.Warningf("Secret value will now change for Secret '%s'. Any resources (like Pods) using this Secret must be restarted to pick up the new value. Details: https://github.com/kubernetes/kubernetes/issues/22368", secret.Name)
+		logger.Debug("Checking if secret value has changed in Azure")
+		if detector.shouldWrite(azureKeyVaultSecret, secretHash, objectVersion) {
+			if changed {
+				logger.Info("Secret has changed in Azure Key Vault. Updating Secret now.")
+			} else {
+				logger.WithField("changeDetection", azureKeyVaultSecret.Spec.ChangeDetection).Info("Writing Secret with unchanged value from Azure Key Vault")
+			}
+
+			_, updateSpan := startSpan(ctx, "UpdateSecret", azureKeyVaultSecret)
+			var version string
+			if objectVersion != nil {
+				version = objectVersion.ID
+			}
+			secret, err = c.patchSecret(azureKeyVaultSecret, secretValue, version)
+			endSpan(updateSpan, err)
+			if err != nil {
+				var tooLarge *secretTooLargeError
+				if goerrors.As(err, &tooLarge) {
+					return c.handleSecretTooLarge(azureKeyVaultSecret, tooLarge)
+				}
+				logger.WithError(err).Warning("Failed to update Secret")
+				return err
+			}
+			if err = c.updatePreviousSecret(azureKeyVaultSecret, secretValue, version); err != nil {
+				logger.WithError(err).Warning("Failed to update Secret of previous name")
+				return err
+			}
+
+			if changed && !c.options.DryRun {
+				logger.WithField("secret", secret.Name).Warning("Secret value will now change. Any resources (like Pods) using this Secret must be restarted to pick up the new value. Details: https://github.com/kubernetes/kubernetes/issues/22368")
+				c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeNormal, SuccessSynced, MessageAzureKeyVaultSecretSyncedWithAzureKeyVault)
+				c.recordSecretEvent(secret, corev1.EventTypeNormal, SecretRotated, fmt.Sprintf(MessageSecretRotatedFrom, azureKeyVaultSecret.Spec.Vault.Object.Name, vaultName, azureKeyVaultSecret.Name))
+				c.notify(NotificationRotated, azureKeyVaultSecret, version, fmt.Sprintf(MessageSecretRotated, secret.Name))
+
+				// Only rotations count, as the first version synced may have been created long before the AzureKeyVaultSecret
+				if isRotation(azureKeyVaultSecret, objectVersion) {
+					observeRotationPropagation(azureKeyVaultSecret.Namespace, azureKeyVaultSecret.Name, objectVersion.Created, c.clock.Now().Time)
+				}
+				if azureKeyVaultSecret.Status.SecretHash != "" {
+					c.checkRotationAnomaly(azureKeyVaultSecret, key)
+				}
+			}
+
+			// Before updating status, so failed rollouts are retried along with the Secret update
+			if err = c.rolloutConsumers(azureKeyVaultSecret, key, secret.Name, secretHash); err != nil {
+				return err
+			}
+			rolledOut = true
+		}
 	}
 
-	log.Debugf("Updating status for AzureKeyVaultSecret '%s'", azureKeyVaultSecret.Name)
-	if err = c.updateAzureKeyVaultSecretStatus(azureKeyVaultSecret, secretHash); err != nil {
+	if !rolledOut {
+		if err = c.continueRollout(azureKeyVaultSecret, key, secretHash); err != nil {
+			return err
+		}
+	}
+
+	logger.Debug("Updating status for AzureKeyVaultSecret")
+	_, statusSpan := startSpan(ctx, "UpdateStatus", azureKeyVaultSecret)
+	err = c.updateAzureKeyVaultSecretStatus(azureKeyVaultSecret, secretHash, objectVersion, vaultName)
+	endSpan(statusSpan, err)
+	if err != nil {
 		return err
 	}
 
-	log.Debugf("Successfully synced AzureKeyVaultSecret %s with Azure Key Vault", key)
-	c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeNormal, SuccessSynced, MessageAzureKeyVaultSecretSyncedWithAzureKeyVault)
+	logger.Debug("Successfully synced AzureKeyVaultSecret with Azure Key Vault")
 	return nil
 }
 
+// getSecretFromVault gets the secret from Azure Key Vault if its circuit is closed,
+// and registers the result with the circuit breaker
+func (c *Controller) getSecretFromVault(ctx context.Context, key string, azureKeyVaultSecret *akv.AzureKeyVaultSecret) (map[string][]byte, *vault.ObjectVersion, error) {
+	vaultName := azureKeyVaultSecret.Spec.Vault.Name
+	if err := c.vaultCircuits.allow(vaultName); err != nil {
+		return nil, nil, err
+	}
+
+	secretValue, objectVersion, err := c.getSecretFromKeyVaultIfChanged(ctx, key, azureKeyVaultSecret)
+	c.vaultCircuits.record(vaultName, err)
+	return secretValue, objectVersion, err
+}
+
+// getSecretFromKeyVaultIfChanged downloads the secret value from Azure Key Vault, unless the change detector
+// of the AzureKeyVaultSecret finds the current object version unchanged, in which case a nil value is returned
+func (c *Controller) getSecretFromKeyVaultIfChanged(ctx context.Context, key string, azureKeyVaultSecret *akv.AzureKeyVaultSecret) (map[string][]byte, *vault.ObjectVersion, error) {
+	logger := newLogger(azureKeyVaultSecret)
+	logger.Debug("Checking current version in Azure Key Vault")
+	_, versionSpan := startSpan(ctx, "GetObjectVersion", azureKeyVaultSecret)
+	objectVersion, err := c.vaultService.GetObjectVersion(&azureKeyVaultSecret.Spec.Vault)
+	endSpan(versionSpan, err)
+	if err != nil {
+		// Listing versions require more permissions in Azure Key Vault than getting the value,
+		// so fall back to downloading the value and compare the hash
+		logger.WithError(err).Debug("Failed to get current version in Azure, will download value to check for changes")
+		objectVersion = nil
+	}
+
+	detector, err := changeDetectorFor(azureKeyVaultSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+	if objectVersion != nil && !detector.shouldDownload(azureKeyVaultSecret, objectVersion) {
+		logger.WithField("version", objectVersion.ID).Debug("Version has not changed in Azure, skipping download of secret value")
+		return nil, objectVersion, nil
+	}
+
+	logger.Debug("Getting secret value from Azure Key Vault")
+	_, secretSpan := startSpan(ctx, "GetSecretValue", azureKeyVaultSecret)
+	secretValue, err := c.getSecretFromKeyVault(withObjectVersion(azureKeyVaultSecret, objectVersion))
+	endSpan(secretSpan, err)
+	if err != nil {
+		return nil, nil, err
+	}
+	return secretValue, objectVersion, nil
+}
+
+// formatRequestIDs formats the Azure request ids of a failed request for use in
+// messages, or returns an empty string if there are none
+func formatRequestIDs(requestID string, clientRequestID string) string {
+	if requestID == "" && clientRequestID == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (x-ms-request-id: '%s', x-ms-client-request-id: '%s')", requestID, clientRequestID)
+}
+
 func (c *Controller) getAzureKeyVaultSecretFromSecret(secret *corev1.Secret, owner *metav1.OwnerReference) (*akv.AzureKeyVaultSecret, error) {
 	return c.azureKeyVaultSecretLister.AzureKeyVaultSecrets(secret.Namespace).Get(owner.Name)
 }
@@ -196,6 +481,10 @@ func (c *Controller) getAzureKeyVaultSecretFromSecret(secret *corev1.Secret, own
 func (c *Controller) getSecretFromKeyVault(azureKeyVaultSecret *akv.AzureKeyVaultSecret) (map[string][]byte, error) {
 	var secretHandler KubernetesSecretHandler
 
+	if err := validateLayout(azureKeyVaultSecret); err != nil {
+		return nil, err
+	}
+
 	switch azureKeyVaultSecret.Spec.Vault.Object.Type {
 	case akv.AzureKeyVaultObjectTypeSecret:
 		transformator, err := transformers.CreateTransformator(&azureKeyVaultSecret.Spec.Output)
@@ -212,7 +501,28 @@ func (c *Controller) getSecretFromKeyVault(azureKeyVaultSecret *akv.AzureKeyVaul
 	default:
 		return nil, fmt.Errorf("azure key vault object type '%s' not currently supported", azureKeyVaultSecret.Spec.Vault.Object.Type)
 	}
-	return secretHandler.Handle()
+
+	values, err := secretHandler.Handle()
+	if err != nil && shouldBootstrap(azureKeyVaultSecret, err) {
+		if err = c.bootstrapSecret(azureKeyVaultSecret); err != nil {
+			return nil, err
+		}
+		values, err = secretHandler.Handle()
+	}
+	publicCertificateOnly := false
+	if err != nil && shouldFallBackToPublicCertificate(azureKeyVaultSecret, err) {
+		secretHandler = &AzureCertificateHandler{secretSpec: azureKeyVaultSecret, vaultService: c.vaultService, publicCertificateOnly: true}
+		values, err = secretHandler.Handle()
+		publicCertificateOnly = err == nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if azureKeyVaultSecret.Spec.Vault.Object.Type == akv.AzureKeyVaultObjectTypeCertificate {
+		c.publicCertificates.set(azureKeyVaultSecret.Namespace+"/"+azureKeyVaultSecret.Name, publicCertificateOnly)
+	}
+	redactValues(azureKeyVaultSecret, values)
+	return values, nil
 }
 
 func (c *Controller) getAzureKeyVaultSecret(key string) (*akv.AzureKeyVaultSecret, error) {
@@ -227,7 +537,13 @@ func (c *Controller) getAzureKeyVaultSecret(key string) (*akv.AzureKeyVaultSecre
 	if err != nil {
 		return nil, err
 	}
-	return azureKeyVaultSecret, err
+	if azureKeyVaultSecret, err = c.applyVaultDefaults(azureKeyVaultSecret); err != nil {
+		return nil, err
+	}
+	if err = c.checkVaultPolicies(azureKeyVaultSecret); err != nil {
+		return nil, err
+	}
+	return azureKeyVaultSecret, nil
 }
 
 func hasAzureKeyVaultSecretChanged(vaultSecret *akv.AzureKeyVaultSecret, secret *corev1.Secret) bool {
@@ -245,17 +561,106 @@ func hasAzureKeyVaultSecretChanged(vaultSecret *akv.AzureKeyVaultSecret, secret
 	return false
 }
 
-func (c *Controller) updateAzureKeyVaultSecretStatus(azureKeyVaultSecret *akv.AzureKeyVaultSecret, secretHash string) error {
+// hasObjectVersionChanged checks if the version of the Azure Key Vault object,
+// or its updated timestamp, differ from what was last synced
+func hasObjectVersionChanged(azureKeyVaultSecret *akv.AzureKeyVaultSecret, objectVersion *vault.ObjectVersion) bool {
+	status := azureKeyVaultSecret.Status
+	if status.SecretHash == "" {
+		return true
+	}
+	// A certificate is only considered changed if its thumbprint changes, avoiding
+	// rotations caused by the same certificate being exported differently
+	if status.CertificateThumbprint != "" && objectVersion.Thumbprint != "" {
+		return status.CertificateThumbprint != objectVersion.Thumbprint
+	}
+	if status.ObjectVersion == "" || objectVersion.ID == "" {
+		return true
+	}
+	// Versions are not the same across vaults
+	if status.VaultName != "" && status.VaultName != azureKeyVaultSecret.Spec.Vault.Name {
+		return true
+	}
+	if status.ObjectVersion != objectVersion.ID {
+		return true
+	}
+	return !status.ObjectUpdated.Time.Equal(objectVersion.Updated)
+}
+
+// withObjectVersion returns a copy of the AzureKeyVaultSecret pinned to the given object version,
+// making sure the value downloaded is the same version that was checked
+func withObjectVersion(azureKeyVaultSecret *akv.AzureKeyVaultSecret, objectVersion *vault.ObjectVersion) *akv.AzureKeyVaultSecret {
+	if objectVersion == nil || objectVersion.ID == "" || azureKeyVaultSecret.Spec.Vault.Object.Version != "" {
+		return azureKeyVaultSecret
+	}
+	azureKeyVaultSecretCopy := azureKeyVaultSecret.DeepCopy()
+	azureKeyVaultSecretCopy.Spec.Vault.Object.Version = objectVersion.ID
+	return azureKeyVaultSecretCopy
+}
+
+func (c *Controller) updateAzureKeyVaultSecretStatus(azureKeyVaultSecret *akv.AzureKeyVaultSecret, secretHash string, objectVersion *vault.ObjectVersion, vaultName string) error {
 	secretName := determineSecretName(azureKeyVaultSecret)
+	now := c.clock.Now()
+	c.recordObjectRestored(azureKeyVaultSecret, vaultName)
+	c.recordPublicCertificateOnly(azureKeyVaultSecret, secretName)
+
+	previousSecretDeleteTime := metav1.NewTime(now.Add(renameGracePeriod(azureKeyVaultSecret)))
+	if isRenamedWithGracePeriod(azureKeyVaultSecret, secretName) {
+		c.recordRenamedSecret(azureKeyVaultSecret, secretName, previousSecretDeleteTime)
+	}
+
+	return c.mutateAzureKeyVaultSecretStatus(azureKeyVaultSecret, func(status *akv.AzureKeyVaultSecretStatus) {
+		updatePreviousSecretStatus(status, azureKeyVaultSecret, secretName, previousSecretDeleteTime)
+		status.SecretHash = secretHash
+		status.LastAzureUpdate = now
+		status.SecretName = secretName
+		status.VaultName = vaultName
+		status.RetryCount = 0
+		status.NextRetryTime = metav1.Time{}
+
+		// Keep last known version if current version in Azure is unknown
+		if objectVersion != nil {
+			status.ObjectVersion = objectVersion.ID
+			status.ObjectUpdated = metav1.NewTime(objectVersion.Updated)
+			status.CertificateThumbprint = objectVersion.Thumbprint
+		}
+
+		clearCondition(status, akv.AzureKeyVaultSecretConditionSoftDeleted, "Recovered", "Object is available in Azure Key Vault", now)
+		clearCondition(status, akv.AzureKeyVaultSecretConditionObjectDeleted, "Restored", "Object is available in Azure Key Vault", now)
+		updateForbiddenCondition(status, nil, "", now)
+		clearCondition(status, akv.AzureKeyVaultSecretConditionDegraded, "Synced", "Azure Key Vault is available", now)
+		clearCondition(status, akv.AzureKeyVaultSecretConditionTooLarge, "WithinLimit", "Secret is within the size limit of Kubernetes", now)
+		clearCondition(status, akv.AzureKeyVaultSecretConditionPendingRotation, "Applied", "No change in Azure Key Vault is waiting for the rotation window", now)
+		status.PendingVersion = ""
+		clearCondition(status, akv.AzureKeyVaultSecretConditionPendingApproval, "Applied", "No version in Azure Key Vault is waiting for approval", now)
+		c.updateNotExportableCondition(azureKeyVaultSecret, status, secretName, now)
+	})
+}
 
+// mutateAzureKeyVaultSecretStatus applies mutate to the status of a copy of the
+// AzureKeyVaultSecret and persists it using the status subresource
+func (c *Controller) mutateAzureKeyVaultSecretStatus(azureKeyVaultSecret *akv.AzureKeyVaultSecret, mutate func(status *akv.AzureKeyVaultSecretStatus)) error {
 	// NEVER modify objects from the store. It's a read-only, local cache.
 	// You can use DeepCopy() to make a deep copy of original object and modify this copy
 	// Or create a copy manually for better performance
+	if c.options.DryRun {
+		newLogger(azureKeyVaultSecret).WithField("dryRun", true).Debug("Not updating status for AzureKeyVaultSecret in dry run mode")
+		return nil
+	}
 
 	azureKeyVaultSecretCopy := azureKeyVaultSecret.DeepCopy()
-	azureKeyVaultSecretCopy.Status.SecretHash = secretHash
-	azureKeyVaultSecretCopy.Status.LastAzureUpdate = c.clock.Now()
-	azureKeyVaultSecretCopy.Status.SecretName = secretName
+	mutate(&azureKeyVaultSecretCopy.Status)
+
+	// Skipping writes not changing anything, like setting a condition already set
+	if equality.Semantic.DeepEqual(azureKeyVaultSecret.Status, azureKeyVaultSecretCopy.Status) {
+		return nil
+	}
+
+	// Spreading status updates over time when many AzureKeyVaultSecrets change at once
+	if c.statusLimiter != nil {
+		if err := c.statusLimiter.Wait(context.Background()); err != nil {
+			return err
+		}
+	}
 
 	// If the CustomResourceSubresources feature gate is not enabled,
 	// we must use Update instead of UpdateStatus to update the Status block of the AzureKeyVaultSecret resource.
@@ -265,6 +670,35 @@ func (c *Controller) updateAzureKeyVaultSecretStatus(azureKeyVaultSecret *akv.Az
 	return err
 }
 
+// isRotation returns true if objectVersion is a new version, with a known creation time, of the
+// object the AzureKeyVaultSecret already synced a version of
+func isRotation(azureKeyVaultSecret *akv.AzureKeyVaultSecret, objectVersion *vault.ObjectVersion) bool {
+	previous := azureKeyVaultSecret.Status.ObjectVersion
+	return objectVersion != nil && !objectVersion.Created.IsZero() && previous != "" && previous != objectVersion.ID
+}
+
+// handleDegradedVault reports that the Azure Key Vault is failing for all
+// objects and will not be tried again until its circuit is probed
+func (c *Controller) handleDegradedVault(azureKeyVaultSecret *akv.AzureKeyVaultSecret, err *circuitOpenError) error {
+	now := c.clock.Now()
+	if !isConditionTrue(&azureKeyVaultSecret.Status, akv.AzureKeyVaultSecretConditionDegraded) {
+		c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, ErrAzureVaultUnavailable, err.Error())
+
+		statusErr := c.mutateAzureKeyVaultSecretStatus(azureKeyVaultSecret, func(status *akv.AzureKeyVaultSecretStatus) {
+			setCondition(status, akv.AzureKeyVaultSecretCondition{
+				Type:    akv.AzureKeyVaultSecretConditionDegraded,
+				Status:  corev1.ConditionTrue,
+				Reason:  ErrAzureVaultUnavailable,
+				Message: err.Error(),
+			}, now)
+		})
+		if statusErr != nil {
+			newLogger(azureKeyVaultSecret).WithError(statusErr).Error("failed to update status for AzureKeyVaultSecret")
+		}
+	}
+	return err
+}
+
 func handleKeyVaultError(err error, key string) bool {
 	log.Debugf("Handling error for '%s' in AzureKeyVaultSecret: %s", key, err.Error())
 	exit := false
@@ -18,8 +18,11 @@ package controller
 
 import (
 	"testing"
+	"time"
 
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
 	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func TestNullLookup(t *testing.T) {
@@ -36,3 +39,61 @@ func TestNullLookup(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestHasObjectVersionChanged(t *testing.T) {
+	updated := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	secret := secret()
+	secret.Status.SecretHash = "some-hash"
+	secret.Status.ObjectVersion = "version-1"
+	secret.Status.ObjectUpdated = metav1.NewTime(updated)
+
+	if hasObjectVersionChanged(secret, &vault.ObjectVersion{ID: "version-1", Updated: updated}) {
+		t.Error("expected object version to be unchanged")
+	}
+
+	if !hasObjectVersionChanged(secret, &vault.ObjectVersion{ID: "version-2", Updated: updated}) {
+		t.Error("expected new object version to be detected as changed")
+	}
+
+	if !hasObjectVersionChanged(secret, &vault.ObjectVersion{ID: "version-1", Updated: updated.Add(time.Minute)}) {
+		t.Error("expected updated timestamp to be detected as changed")
+	}
+
+	secret.Status.SecretHash = ""
+	if !hasObjectVersionChanged(secret, &vault.ObjectVersion{ID: "version-1", Updated: updated}) {
+		t.Error("expected object never synced to be detected as changed")
+	}
+}
+
+func TestHasObjectVersionChangedCertificate(t *testing.T) {
+	secret := secret()
+	secret.Spec.Vault.Object.Type = akv.AzureKeyVaultObjectTypeCertificate
+	secret.Status.SecretHash = "some-hash"
+	secret.Status.ObjectVersion = "version-1"
+	secret.Status.CertificateThumbprint = "thumbprint-1"
+
+	if hasObjectVersionChanged(secret, &vault.ObjectVersion{ID: "version-1", Updated: time.Now(), Thumbprint: "thumbprint-1"}) {
+		t.Error("expected certificate with same thumbprint to be unchanged")
+	}
+
+	if !hasObjectVersionChanged(secret, &vault.ObjectVersion{ID: "version-2", Thumbprint: "thumbprint-2"}) {
+		t.Error("expected certificate with new thumbprint to be detected as changed")
+	}
+}
+
+func TestWithObjectVersion(t *testing.T) {
+	secret := secret()
+
+	pinned := withObjectVersion(secret, &vault.ObjectVersion{ID: "version-1"})
+	if pinned.Spec.Vault.Object.Version != "version-1" {
+		t.Errorf("expected version to be 'version-1', got '%s'", pinned.Spec.Vault.Object.Version)
+	}
+	if secret.Spec.Vault.Object.Version != "" {
+		t.Error("original AzureKeyVaultSecret should not be modified")
+	}
+
+	if withObjectVersion(secret, nil) != secret {
+		t.Error("expected unchanged AzureKeyVaultSecret when version is unknown")
+	}
+}
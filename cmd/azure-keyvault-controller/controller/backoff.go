@@ -0,0 +1,68 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// retryDelay returns the time to wait before polling Azure Key Vault again after the given
+// number of failures in a row, doubling from the Normal poll frequency up to the Slow one
+func (f AzurePollFrequency) retryDelay(failures int) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+
+	delay := f.Normal
+	for i := 1; i < failures && delay < f.Slow; i++ {
+		delay *= 2
+	}
+	if f.Slow > 0 && delay > f.Slow {
+		delay = f.Slow
+	}
+	return delay
+}
+
+// backOffAzureKeyVaultSecret records the failures in a row for the AzureKeyVaultSecret in its
+// status, together with when it will be polled from Azure Key Vault again. A positive retryAfter,
+// as asked for by Azure Key Vault, is used instead of the delay derived from failures. The conditions
+// describing the failure are updated in the same status update.
+func (c *Controller) backOffAzureKeyVaultSecret(azureKeyVaultSecret *akv.AzureKeyVaultSecret, failures int, retryAfter time.Duration, conditions func(status *akv.AzureKeyVaultSecretStatus)) error {
+	delay := c.azureFrequency.retryDelay(failures)
+	if retryAfter > 0 {
+		delay = retryAfter
+	}
+	nextRetry := metav1.NewTime(c.clock.Now().Add(delay))
+
+	newLogger(azureKeyVaultSecret).WithField("retryCount", failures).Infof("Backing off polling Azure Key Vault until %s", nextRetry.Format(time.RFC3339))
+	return c.mutateAzureKeyVaultSecretStatus(azureKeyVaultSecret, func(status *akv.AzureKeyVaultSecretStatus) {
+		status.RetryCount = failures
+		status.NextRetryTime = nextRetry
+		conditions(status)
+	})
+}
+
+// isBackingOff returns true if the AzureKeyVaultSecret has failed and should not be
+// polled from Azure Key Vault again before its next retry time
+func (c *Controller) isBackingOff(azureKeyVaultSecret *akv.AzureKeyVaultSecret) bool {
+	status := azureKeyVaultSecret.Status
+	now := c.clock.Now()
+	return status.RetryCount > 0 && now.Before(&status.NextRetryTime)
+}
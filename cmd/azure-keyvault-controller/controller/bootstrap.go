@@ -0,0 +1,103 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// defaultGenerateLength is the length of generated secret values if not set
+const defaultGenerateLength = 32
+
+// maxGenerateLength keeps generated secret values well below the 25k limit of Azure Key Vault secrets
+const maxGenerateLength = 4096
+
+var generateCharsets = map[akv.AzureKeyVaultBootstrapCharset]string{
+	akv.AzureKeyVaultBootstrapCharsetAlphanumeric: "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789",
+	akv.AzureKeyVaultBootstrapCharsetSymbols:      "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789!#$%&()*+,-./:;<=>?@[]^_{|}~",
+	akv.AzureKeyVaultBootstrapCharsetHex:          "0123456789abcdef",
+}
+
+// shouldBootstrap returns true if the secret of the AzureKeyVaultSecret should be generated in
+// Azure Key Vault, because it has spec.bootstrap.generate and getting the secret failed with not found
+func shouldBootstrap(azureKeyVaultSecret *akv.AzureKeyVaultSecret, err error) bool {
+	bootstrap := azureKeyVaultSecret.Spec.Bootstrap
+	vaultSpec := azureKeyVaultSecret.Spec.Vault
+	return bootstrap != nil && bootstrap.Generate != nil &&
+		vaultSpec.Object.Type == akv.AzureKeyVaultObjectTypeSecret &&
+		vaultSpec.Object.Version == "" &&
+		vault.IsNotFound(err)
+}
+
+// bootstrapSecret generates a random value for the secret of the AzureKeyVaultSecret and writes it to Azure Key Vault
+func (c *Controller) bootstrapSecret(azureKeyVaultSecret *akv.AzureKeyVaultSecret) error {
+	vaultSpec := azureKeyVaultSecret.Spec.Vault
+	if c.options.DryRun {
+		c.recordDryRun(azureKeyVaultSecret, fmt.Sprintf(MessageDryRunBootstrapSecret, vaultSpec.Object.Name, vaultSpec.Name))
+		return fmt.Errorf("secret '%s' not generated in azure key vault '%s' in dry run mode", vaultSpec.Object.Name, vaultSpec.Name)
+	}
+
+	value, err := generateSecretValue(azureKeyVaultSecret.Spec.Bootstrap.Generate)
+	if err != nil {
+		return err
+	}
+	if err = c.vaultService.CreateSecret(&vaultSpec, value); err != nil {
+		return fmt.Errorf("failed to generate secret '%s' in azure key vault '%s', error: %w", vaultSpec.Object.Name, vaultSpec.Name, err)
+	}
+
+	msg := fmt.Sprintf(MessageSecretBootstrapped, vaultSpec.Object.Name, vaultSpec.Name)
+	newLogger(azureKeyVaultSecret).Info(msg)
+	c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeNormal, SecretBootstrapped, msg)
+	return nil
+}
+
+// generateSecretValue returns a random value of the length and charset of the policy
+func generateSecretValue(generate *akv.AzureKeyVaultBootstrapGenerate) (string, error) {
+	length := generate.Length
+	if length == 0 {
+		length = defaultGenerateLength
+	}
+	if length < 0 || length > maxGenerateLength {
+		return "", fmt.Errorf("length of generated secret must be between 1 and %d, got %d", maxGenerateLength, length)
+	}
+
+	charsetName := generate.Charset
+	if charsetName == "" {
+		charsetName = akv.AzureKeyVaultBootstrapCharsetAlphanumeric
+	}
+	charset, ok := generateCharsets[charsetName]
+	if !ok {
+		return "", fmt.Errorf("charset '%s' of generated secret not supported", charsetName)
+	}
+
+	max := big.NewInt(int64(len(charset)))
+	value := make([]byte, length)
+	for i := range value {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		value[i] = charset[n.Int64()]
+	}
+	return string(value), nil
+}
@@ -0,0 +1,106 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+)
+
+func azureKeyVaultSecretWithBootstrap(length int, charset akv.AzureKeyVaultBootstrapCharset) *akv.AzureKeyVaultSecret {
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Spec.Bootstrap = &akv.AzureKeyVaultBootstrap{
+		Generate: &akv.AzureKeyVaultBootstrapGenerate{Length: length, Charset: charset},
+	}
+	return akvs
+}
+
+func TestSyncBootstrapsMissingSecret(t *testing.T) {
+	f := newFixture(t)
+
+	akvs := azureKeyVaultSecretWithBootstrap(40, akv.AzureKeyVaultBootstrapCharsetHex)
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.expectEvent(SecretBootstrapped)
+
+	if calls := f.vault.Calls("CreateSecret"); calls != 1 {
+		t.Errorf("expected secret to be generated once in azure key vault, got %d calls", calls)
+	}
+	value := string(f.getSecret(akvs.Namespace, "my-kubernetes-secret").Data["value"])
+	if len(value) != 40 {
+		t.Errorf("expected generated secret of length 40, got %d", len(value))
+	}
+	if strings.Trim(value, "0123456789abcdef") != "" {
+		t.Errorf("expected generated secret of hex characters, got '%s'", value)
+	}
+}
+
+func TestSyncDoesNotBootstrapExistingSecret(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "existing-value")
+
+	akvs := azureKeyVaultSecretWithBootstrap(0, "")
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls := f.vault.Calls("CreateSecret"); calls != 0 {
+		t.Errorf("expected existing secret not to be generated, got %d calls", calls)
+	}
+	if value := string(f.getSecret(akvs.Namespace, "my-kubernetes-secret").Data["value"]); value != "existing-value" {
+		t.Errorf("expected secret value 'existing-value', got '%s'", value)
+	}
+}
+
+func TestSyncDoesNotBootstrapInDryRun(t *testing.T) {
+	f := newFixture(t)
+	f.controller.options.DryRun = true
+
+	akvs := azureKeyVaultSecretWithBootstrap(0, "")
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err == nil {
+		t.Fatal("expected error for missing secret in dry run")
+	}
+	if calls := f.vault.Calls("CreateSecret"); calls != 0 {
+		t.Errorf("expected no secret to be generated in dry run, got %d calls", calls)
+	}
+}
+
+func TestGenerateSecretValue(t *testing.T) {
+	value, err := generateSecretValue(&akv.AzureKeyVaultBootstrapGenerate{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(value) != defaultGenerateLength {
+		t.Errorf("expected generated secret of default length %d, got %d", defaultGenerateLength, len(value))
+	}
+
+	if _, err = generateSecretValue(&akv.AzureKeyVaultBootstrapGenerate{Charset: "emoji"}); err == nil {
+		t.Error("expected error for unsupported charset")
+	}
+	if _, err = generateSecretValue(&akv.AzureKeyVaultBootstrapGenerate{Length: -1}); err == nil {
+		t.Error("expected error for negative length")
+	}
+}
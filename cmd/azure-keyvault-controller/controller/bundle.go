@@ -0,0 +1,320 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"kmodules.xyz/client-go/tools/queue"
+)
+
+// BundleOwnersAnnotation is set on bundle Secrets, shared by AzureKeyVaultSecrets with
+// spec.output.secret.bundle, mapping each key of the Secret to the AzureKeyVaultSecret owning it
+const BundleOwnersAnnotation = "keyvault.azure.spv.no/bundle-owners"
+
+// isBundle returns true if the AzureKeyVaultSecret shares its output Secret with other AzureKeyVaultSecrets,
+// or merges its keys into a Secret with keys managed by others
+func isBundle(azureKeyVaultSecret *akv.AzureKeyVaultSecret) bool {
+	return azureKeyVaultSecret.Spec.Output.Secret.Bundle || isMergeKeys(azureKeyVaultSecret)
+}
+
+// isMergeKeys returns true if the AzureKeyVaultSecret merges its keys into its output Secret
+func isMergeKeys(azureKeyVaultSecret *akv.AzureKeyVaultSecret) bool {
+	return azureKeyVaultSecret.Spec.Output.Secret.MergeStrategy == akv.AzureKeyVaultOutputMergeStrategyMergeKeys
+}
+
+// isBundleSecret returns true if the Secret is a bundle Secret
+func isBundleSecret(secret *corev1.Secret) bool {
+	_, ok := secret.Annotations[BundleOwnersAnnotation]
+	return ok
+}
+
+// ownsSecret returns true if the AzureKeyVaultSecret controls the Secret, or contributes to it as a bundle
+func ownsSecret(azureKeyVaultSecret *akv.AzureKeyVaultSecret, secret *corev1.Secret) bool {
+	if isBundle(azureKeyVaultSecret) {
+		return isBundleSecret(secret) && metav1.GetControllerOf(secret) == nil
+	}
+	return metav1.IsControlledBy(secret, azureKeyVaultSecret)
+}
+
+// getBundleOwners returns the name of the AzureKeyVaultSecret owning each key of a bundle Secret
+func getBundleOwners(secret *corev1.Secret) (map[string]string, error) {
+	owners := map[string]string{}
+	if value := secret.Annotations[BundleOwnersAnnotation]; value != "" {
+		if err := json.Unmarshal([]byte(value), &owners); err != nil {
+			return nil, fmt.Errorf("invalid annotation %s on secret '%s'/'%s', error: %w", BundleOwnersAnnotation, secret.Namespace, secret.Name, err)
+		}
+	}
+	return owners, nil
+}
+
+// getBundleData returns the data of the keys of a bundle Secret owned by the named AzureKeyVaultSecret
+func getBundleData(secret *corev1.Secret, name string) map[string][]byte {
+	owners, err := getBundleOwners(secret)
+	if err != nil {
+		return nil
+	}
+
+	data := map[string][]byte{}
+	for key, owner := range owners {
+		if value, ok := secret.Data[key]; ok && owner == name {
+			data[key] = value
+		}
+	}
+	return data
+}
+
+// isInBundle returns true if the AzureKeyVaultSecret owns keys of the bundle Secret
+func isInBundle(azureKeyVaultSecret *akv.AzureKeyVaultSecret, secret *corev1.Secret) bool {
+	owners, err := getBundleOwners(secret)
+	if err != nil {
+		return false
+	}
+	for _, owner := range owners {
+		if owner == azureKeyVaultSecret.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// updateBundleSecret replaces the keys a AzureKeyVaultSecret owns in its bundle Secret with the
+// given values, creating the Secret if it does not exist. Keys owned by other AzureKeyVaultSecrets
+// are left alone, and taking over one of them fails. With MergeKeys the Secret may also be an existing
+// Secret not created by the controller, whose keys are left alone the same way. Updates use the resource version of the cached
+// Secret, so concurrent updates by other AzureKeyVaultSecrets fail with a conflict and are retried.
+func (c *Controller) updateBundleSecret(azureKeyVaultSecret *akv.AzureKeyVaultSecret, azureSecretValue map[string][]byte, objectVersion string) (*corev1.Secret, error) {
+	secretName := determineSecretName(azureKeyVaultSecret)
+	current, err := c.secretsLister.Secrets(azureKeyVaultSecret.Namespace).Get(secretName)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	var secret *corev1.Secret
+	if current == nil {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      secretName,
+				Namespace: azureKeyVaultSecret.Namespace,
+				Labels:    map[string]string{ManagedSecretLabel: "true"},
+			},
+			Type: determineSecretType(azureKeyVaultSecret),
+		}
+	} else {
+		if metav1.GetControllerOf(current) != nil || (!isBundleSecret(current) && !isMergeKeys(azureKeyVaultSecret)) {
+			msg := fmt.Sprintf(MessageResourceExists, secretName)
+			c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, ErrResourceExists, msg)
+			return nil, newOutputConflictError(msg)
+		}
+		if err = c.checkSecretController(azureKeyVaultSecret, current); err != nil {
+			return nil, err
+		}
+		secret = current.DeepCopy()
+	}
+
+	owners, err := getBundleOwners(secret)
+	if err != nil {
+		return nil, err
+	}
+	for key := range azureSecretValue {
+		owner, owned := owners[key]
+		if owned && owner != azureKeyVaultSecret.Name {
+			msg := fmt.Sprintf(MessageBundleKeyConflict, key, secretName, owner)
+			c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, ErrBundleKeyConflict, msg)
+			return nil, newOutputConflictError(msg)
+		}
+		if _, exists := secret.Data[key]; !owned && exists && isMergeKeys(azureKeyVaultSecret) {
+			msg := fmt.Sprintf(MessageMergeKeyConflict, key, secretName)
+			c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, ErrBundleKeyConflict, msg)
+			return nil, newOutputConflictError(msg)
+		}
+	}
+
+	var currentData map[string][]byte
+	if current != nil {
+		currentData = getBundleData(current, azureKeyVaultSecret.Name)
+	}
+	changedKeys := diffSecretData(currentData, azureSecretValue)
+	if current != nil && len(changedKeys) == 0 && (isMergeKeys(azureKeyVaultSecret) || hasBundleOwnerReference(current, azureKeyVaultSecret)) {
+		return current, nil
+	}
+
+	if c.options.DryRun {
+		if current == nil {
+			c.recordDryRun(azureKeyVaultSecret, fmt.Sprintf(MessageDryRunCreateSecret, secretName, formatKeys(sortValueKeys(azureSecretValue))))
+		} else {
+			c.recordDryRun(azureKeyVaultSecret, fmt.Sprintf(MessageDryRunUpdateSecret, secretName, formatKeys(changedKeys)))
+		}
+		return secret, nil
+	}
+
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	for key, owner := range owners {
+		if owner == azureKeyVaultSecret.Name {
+			delete(secret.Data, key)
+			delete(owners, key)
+		}
+	}
+	for key, value := range azureSecretValue {
+		secret.Data[key] = value
+		owners[key] = azureKeyVaultSecret.Name
+	}
+	if err = setBundleOwners(secret, owners); err != nil {
+		return nil, err
+	}
+	secret.Annotations = c.withControllerAnnotation(azureKeyVaultSecret, secret.Annotations)
+	// Secrets merged into are never owned, so they are not garbage collected with keys managed by others
+	if !isMergeKeys(azureKeyVaultSecret) && !hasBundleOwnerReference(secret, azureKeyVaultSecret) {
+		secret.OwnerReferences = append(secret.OwnerReferences, metav1.OwnerReference{
+			APIVersion: akv.SchemeGroupVersion.String(),
+			Kind:       "AzureKeyVaultSecret",
+			Name:       azureKeyVaultSecret.Name,
+			UID:        azureKeyVaultSecret.UID,
+		})
+	}
+
+	if current == nil {
+		if secret, err = c.kubeclientset.CoreV1().Secrets(secret.Namespace).Create(secret); err != nil {
+			return nil, err
+		}
+		c.auditSecret(AuditActionCreate, secret.Namespace, secret.Name, azureKeyVaultSecret, objectVersion, changedKeys)
+		return secret, nil
+	}
+
+	if secret, err = c.kubeclientset.CoreV1().Secrets(secret.Namespace).Update(secret); err != nil {
+		return nil, err
+	}
+	c.auditSecret(AuditActionUpdate, secret.Namespace, secret.Name, azureKeyVaultSecret, objectVersion, changedKeys)
+	return secret, nil
+}
+
+// pruneBundleSecret removes the keys and owner references of AzureKeyVaultSecrets handled by this
+// controller that no longer contribute to the bundle Secret, like when they are deleted
+func (c *Controller) pruneBundleSecret(secret *corev1.Secret) error {
+	owners, err := getBundleOwners(secret)
+	if err != nil {
+		return err
+	}
+
+	removed := map[string]bool{}
+	for _, owner := range owners {
+		if _, checked := removed[owner]; checked || !c.isHandled(secret.Namespace, owner) {
+			continue
+		}
+		azureKeyVaultSecret, err := c.azureKeyVaultSecretLister.AzureKeyVaultSecrets(secret.Namespace).Get(owner)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		removed[owner] = azureKeyVaultSecret == nil || azureKeyVaultSecret.DeletionTimestamp != nil ||
+			!isBundle(azureKeyVaultSecret) || determineSecretName(azureKeyVaultSecret) != secret.Name
+	}
+
+	var keys []string
+	for key, owner := range owners {
+		if removed[owner] {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Strings(keys)
+
+	logger := log.WithFields(log.Fields{"namespace": secret.Namespace, "secret": secret.Name})
+	if c.options.DryRun {
+		logger.WithField("dryRun", true).Infof("Dry run: would remove keys %s of AzureKeyVaultSecrets no longer in bundle Secret", formatKeys(keys))
+		return nil
+	}
+
+	secret = secret.DeepCopy()
+	for _, key := range keys {
+		delete(secret.Data, key)
+		delete(owners, key)
+	}
+	var ownerReferences []metav1.OwnerReference
+	for _, ownerRef := range secret.OwnerReferences {
+		if ownerRef.Kind != "AzureKeyVaultSecret" || !removed[ownerRef.Name] {
+			ownerReferences = append(ownerReferences, ownerRef)
+		}
+	}
+	secret.OwnerReferences = ownerReferences
+	if err = setBundleOwners(secret, owners); err != nil {
+		return err
+	}
+
+	logger.Infof("Removing keys %s of AzureKeyVaultSecrets no longer in bundle Secret", formatKeys(keys))
+	if _, err = c.kubeclientset.CoreV1().Secrets(secret.Namespace).Update(secret); err != nil {
+		return err
+	}
+	c.auditSecret(AuditActionUpdate, secret.Namespace, secret.Name, nil, "", keys)
+	return nil
+}
+
+// enqueueBundleOwners adds the AzureKeyVaultSecrets owning keys of a bundle Secret to the queue
+func (c *Controller) enqueueBundleOwners(secret *corev1.Secret) {
+	owners, err := getBundleOwners(secret)
+	if err != nil {
+		log.Errorf("failed to get owners of bundle Secret: %v", err)
+		return
+	}
+
+	enqueued := map[string]bool{}
+	for _, owner := range owners {
+		if enqueued[owner] || !c.isHandled(secret.Namespace, owner) {
+			continue
+		}
+		enqueued[owner] = true
+
+		azureKeyVaultSecret, err := c.azureKeyVaultSecretLister.AzureKeyVaultSecrets(secret.Namespace).Get(owner)
+		if err != nil {
+			continue
+		}
+		if isBundle(azureKeyVaultSecret) && c.akvsHasSecretOutput(azureKeyVaultSecret) {
+			queue.Enqueue(c.akvsCrdQueue.GetQueue(), azureKeyVaultSecret)
+		}
+	}
+}
+
+func setBundleOwners(secret *corev1.Secret, owners map[string]string) error {
+	value, err := json.Marshal(owners)
+	if err != nil {
+		return err
+	}
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[BundleOwnersAnnotation] = string(value)
+	return nil
+}
+
+func hasBundleOwnerReference(secret *corev1.Secret, azureKeyVaultSecret *akv.AzureKeyVaultSecret) bool {
+	for _, ownerRef := range secret.OwnerReferences {
+		if ownerRef.Kind == "AzureKeyVaultSecret" && ownerRef.Name == azureKeyVaultSecret.Name && ownerRef.UID == azureKeyVaultSecret.UID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,225 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func bundleAzureKeyVaultSecret(name, objectName, dataKey string) *akv.AzureKeyVaultSecret {
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Name = name
+	akvs.Spec.Vault.Object.Name = objectName
+	akvs.Spec.Output.Secret.Name = "bundle"
+	akvs.Spec.Output.Secret.DataKey = dataKey
+	akvs.Spec.Output.Secret.Bundle = true
+	return akvs
+}
+
+func TestBundleSecretSharedByAzureKeyVaultSecrets(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "db-password", "secret-1")
+	f.vault.SetSecret(testVaultName, "api-key", "secret-2")
+
+	db := bundleAzureKeyVaultSecret("db", "db-password", "DB_PASSWORD")
+	api := bundleAzureKeyVaultSecret("api", "api-key", "API_KEY")
+	f.addAzureKeyVaultSecret(db)
+	f.addAzureKeyVaultSecret(api)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(db)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(db)
+	if err := f.controller.syncAzureKeyVaultSecret(key(api)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(api)
+
+	secret := f.getSecret(db.Namespace, "bundle")
+	if string(secret.Data["DB_PASSWORD"]) != "secret-1" || string(secret.Data["API_KEY"]) != "secret-2" {
+		t.Fatalf("expected bundle to have keys of both AzureKeyVaultSecrets, got %v", secret.Data)
+	}
+	if metav1.GetControllerOf(secret) != nil || len(secret.OwnerReferences) != 2 {
+		t.Errorf("expected bundle to be owned by both AzureKeyVaultSecrets without a controller, got %v", secret.OwnerReferences)
+	}
+	owners, err := getBundleOwners(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owners["DB_PASSWORD"] != "db" || owners["API_KEY"] != "api" {
+		t.Errorf("expected key owners to be tracked, got %v", owners)
+	}
+
+	// Rotating one AzureKeyVaultSecret leaves the keys of the other alone
+	f.vault.SetSecret(testVaultName, "db-password", "secret-3")
+	if err := f.controller.syncAzureKeyVault(key(db)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(db)
+	secret = f.getSecret(db.Namespace, "bundle")
+	if string(secret.Data["DB_PASSWORD"]) != "secret-3" || string(secret.Data["API_KEY"]) != "secret-2" {
+		t.Errorf("expected only rotated key to change, got %v", secret.Data)
+	}
+	if HasSecretDrifted(f.getAzureKeyVaultSecret(db.Namespace, db.Name), secret) {
+		t.Error("expected keys of other AzureKeyVaultSecrets not to count as drift")
+	}
+}
+
+func TestBundleSecretKeyConflict(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "db-password", "secret-1")
+	f.vault.SetSecret(testVaultName, "other-password", "secret-2")
+
+	db := bundleAzureKeyVaultSecret("db", "db-password", "PASSWORD")
+	other := bundleAzureKeyVaultSecret("other", "other-password", "PASSWORD")
+	f.addAzureKeyVaultSecret(db)
+	f.addAzureKeyVaultSecret(other)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(db)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(db)
+	if err := f.controller.syncAzureKeyVaultSecret(key(other)); err == nil {
+		t.Fatal("expected error when key is owned by another AzureKeyVaultSecret")
+	}
+	f.expectEvent(ErrBundleKeyConflict)
+
+	if value := string(f.getSecret(db.Namespace, "bundle").Data["PASSWORD"]); value != "secret-1" {
+		t.Errorf("expected key to keep value of its owner, got '%s'", value)
+	}
+}
+
+func TestBundleSecretPrunedWhenAzureKeyVaultSecretDeleted(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "db-password", "secret-1")
+	f.vault.SetSecret(testVaultName, "api-key", "secret-2")
+
+	db := bundleAzureKeyVaultSecret("db", "db-password", "DB_PASSWORD")
+	api := bundleAzureKeyVaultSecret("api", "api-key", "API_KEY")
+	f.addAzureKeyVaultSecret(db)
+	f.addAzureKeyVaultSecret(api)
+
+	for _, akvs := range []*akv.AzureKeyVaultSecret{db, api} {
+		if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+			t.Fatal(err)
+		}
+		f.refresh(akvs)
+	}
+
+	if err := f.akvsInformerFactory.Keyvault().V2alpha1().AzureKeyVaultSecrets().Informer().GetIndexer().Delete(api); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.controller.syncSecret(db.Namespace + "/bundle"); err != nil {
+		t.Fatal(err)
+	}
+
+	secret := f.getSecret(db.Namespace, "bundle")
+	if _, ok := secret.Data["API_KEY"]; ok {
+		t.Error("expected key of deleted AzureKeyVaultSecret to be removed")
+	}
+	if string(secret.Data["DB_PASSWORD"]) != "secret-1" {
+		t.Errorf("expected key of remaining AzureKeyVaultSecret to be kept, got %v", secret.Data)
+	}
+	if len(secret.OwnerReferences) != 1 || secret.OwnerReferences[0].Name != "db" {
+		t.Errorf("expected owner reference of deleted AzureKeyVaultSecret to be removed, got %v", secret.OwnerReferences)
+	}
+}
+
+// addExistingSecret creates a Secret not managed by the controller, like one created by another tool
+func (f *fixture) addExistingSecret(name string, data map[string][]byte) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: metav1.NamespaceDefault},
+		// Defaulted by the API server, but not by the fake clientset
+		Type: corev1.SecretTypeOpaque,
+		Data: data,
+	}
+	created, err := f.kubeClient.CoreV1().Secrets(secret.Namespace).Create(secret)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	if err = f.kubeInformerFactory.Core().V1().Secrets().Informer().GetIndexer().Add(created); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+func mergeKeysAzureKeyVaultSecret(name, objectName, dataKey string) *akv.AzureKeyVaultSecret {
+	akvs := bundleAzureKeyVaultSecret(name, objectName, dataKey)
+	akvs.Spec.Output.Secret.Name = "app-config"
+	akvs.Spec.Output.Secret.Bundle = false
+	akvs.Spec.Output.Secret.MergeStrategy = akv.AzureKeyVaultOutputMergeStrategyMergeKeys
+	return akvs
+}
+
+func TestMergeKeysIntoExistingSecret(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "db-password", "secret-1")
+	f.addExistingSecret("app-config", map[string][]byte{"LOG_LEVEL": []byte("debug")})
+
+	db := mergeKeysAzureKeyVaultSecret("db", "db-password", "DB_PASSWORD")
+	f.addAzureKeyVaultSecret(db)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(db)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(db)
+
+	secret := f.getSecret(db.Namespace, "app-config")
+	if string(secret.Data["DB_PASSWORD"]) != "secret-1" || string(secret.Data["LOG_LEVEL"]) != "debug" {
+		t.Fatalf("expected key to be merged into existing keys, got %v", secret.Data)
+	}
+	if len(secret.OwnerReferences) != 0 {
+		t.Errorf("expected merged Secret not to be owned, got %v", secret.OwnerReferences)
+	}
+
+	// Syncing again with an unchanged value leaves the Secret alone
+	if err := f.controller.syncAzureKeyVaultSecret(key(db)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.akvsInformerFactory.Keyvault().V2alpha1().AzureKeyVaultSecrets().Informer().GetIndexer().Delete(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.controller.syncSecret(db.Namespace + "/app-config"); err != nil {
+		t.Fatal(err)
+	}
+	secret = f.getSecret(db.Namespace, "app-config")
+	if _, ok := secret.Data["DB_PASSWORD"]; ok || string(secret.Data["LOG_LEVEL"]) != "debug" {
+		t.Errorf("expected only key of deleted AzureKeyVaultSecret to be removed, got %v", secret.Data)
+	}
+}
+
+func TestMergeKeysDoesNotOverwriteUnmanagedKey(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "db-password", "secret-1")
+	f.addExistingSecret("app-config", map[string][]byte{"DB_PASSWORD": []byte("set-by-hand")})
+
+	db := mergeKeysAzureKeyVaultSecret("db", "db-password", "DB_PASSWORD")
+	f.addAzureKeyVaultSecret(db)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(db)); err == nil {
+		t.Fatal("expected error when key is not managed by AzureKeyVaultSecret")
+	}
+	f.expectEvent(ErrBundleKeyConflict)
+
+	if value := string(f.getSecret(db.Namespace, "app-config").Data["DB_PASSWORD"]); value != "set-by-hand" {
+		t.Errorf("expected unmanaged key to be unchanged, got '%s'", value)
+	}
+}
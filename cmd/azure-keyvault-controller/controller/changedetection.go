@@ -0,0 +1,121 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+)
+
+// changeDetector decides whether the object of a AzureKeyVaultSecret has changed in Azure Key Vault
+// since last synced, as selected by spec.changeDetection. A nil objectVersion means the current
+// version in Azure Key Vault is unknown, like when the controller is not allowed to list versions.
+type changeDetector interface {
+	// shouldDownload returns true if the value must be downloaded from Azure Key Vault to find out
+	shouldDownload(azureKeyVaultSecret *akv.AzureKeyVaultSecret, objectVersion *vault.ObjectVersion) bool
+
+	// shouldWrite returns true if the output Secret must be written with the downloaded value of secretHash
+	shouldWrite(azureKeyVaultSecret *akv.AzureKeyVaultSecret, secretHash string, objectVersion *vault.ObjectVersion) bool
+}
+
+// changeDetectors are the change detectors by spec.changeDetection, with the default as empty
+var changeDetectors = map[akv.AzureKeyVaultChangeDetection]changeDetector{
+	"": defaultChangeDetector{},
+	akv.AzureKeyVaultChangeDetectionValueHash:        valueHashChangeDetector{},
+	akv.AzureKeyVaultChangeDetectionVersionID:        versionIDChangeDetector{},
+	akv.AzureKeyVaultChangeDetectionUpdatedTimestamp: updatedTimestampChangeDetector{},
+	akv.AzureKeyVaultChangeDetectionAlwaysWrite:      alwaysWriteChangeDetector{},
+}
+
+// changeDetectorFor returns the change detector selected by the AzureKeyVaultSecret
+func changeDetectorFor(azureKeyVaultSecret *akv.AzureKeyVaultSecret) (changeDetector, error) {
+	detector, ok := changeDetectors[azureKeyVaultSecret.Spec.ChangeDetection]
+	if !ok {
+		return nil, fmt.Errorf("unknown change detection '%s' in spec.changeDetection", azureKeyVaultSecret.Spec.ChangeDetection)
+	}
+	return detector, nil
+}
+
+// isFirstSyncFromVault returns true if the AzureKeyVaultSecret has never been synced from its
+// current Azure Key Vault, as versions are not the same across vaults
+func isFirstSyncFromVault(azureKeyVaultSecret *akv.AzureKeyVaultSecret) bool {
+	status := azureKeyVaultSecret.Status
+	return status.SecretHash == "" || (status.VaultName != "" && status.VaultName != azureKeyVaultSecret.Spec.Vault.Name)
+}
+
+// hasValueChanged returns true if secretHash differs from the hash of the value last synced
+func hasValueChanged(azureKeyVaultSecret *akv.AzureKeyVaultSecret, secretHash string) bool {
+	return azureKeyVaultSecret.Status.SecretHash != secretHash
+}
+
+// defaultChangeDetector skips downloading when the version, certificate thumbprint and updated timestamp
+// are unchanged, and writes the Secret when the hash of the value changes
+type defaultChangeDetector struct{}
+
+func (defaultChangeDetector) shouldDownload(azureKeyVaultSecret *akv.AzureKeyVaultSecret, objectVersion *vault.ObjectVersion) bool {
+	return objectVersion == nil || hasObjectVersionChanged(azureKeyVaultSecret, objectVersion)
+}
+
+func (defaultChangeDetector) shouldWrite(azureKeyVaultSecret *akv.AzureKeyVaultSecret, secretHash string, objectVersion *vault.ObjectVersion) bool {
+	return hasValueChanged(azureKeyVaultSecret, secretHash)
+}
+
+// valueHashChangeDetector always downloads, and writes the Secret when the hash of the value changes
+type valueHashChangeDetector struct{}
+
+func (valueHashChangeDetector) shouldDownload(azureKeyVaultSecret *akv.AzureKeyVaultSecret, objectVersion *vault.ObjectVersion) bool {
+	return true
+}
+
+func (valueHashChangeDetector) shouldWrite(azureKeyVaultSecret *akv.AzureKeyVaultSecret, secretHash string, objectVersion *vault.ObjectVersion) bool {
+	return hasValueChanged(azureKeyVaultSecret, secretHash)
+}
+
+// versionIDChangeDetector downloads and writes the Secret when the version of the object changes
+type versionIDChangeDetector struct{}
+
+func (versionIDChangeDetector) shouldDownload(azureKeyVaultSecret *akv.AzureKeyVaultSecret, objectVersion *vault.ObjectVersion) bool {
+	return objectVersion == nil || isFirstSyncFromVault(azureKeyVaultSecret) || azureKeyVaultSecret.Status.ObjectVersion != objectVersion.ID
+}
+
+func (d versionIDChangeDetector) shouldWrite(azureKeyVaultSecret *akv.AzureKeyVaultSecret, secretHash string, objectVersion *vault.ObjectVersion) bool {
+	return hasValueChanged(azureKeyVaultSecret, secretHash) || (objectVersion != nil && d.shouldDownload(azureKeyVaultSecret, objectVersion))
+}
+
+// updatedTimestampChangeDetector downloads and writes the Secret when the updated timestamp of the object changes
+type updatedTimestampChangeDetector struct{}
+
+func (updatedTimestampChangeDetector) shouldDownload(azureKeyVaultSecret *akv.AzureKeyVaultSecret, objectVersion *vault.ObjectVersion) bool {
+	return objectVersion == nil || isFirstSyncFromVault(azureKeyVaultSecret) || !azureKeyVaultSecret.Status.ObjectUpdated.Time.Equal(objectVersion.Updated)
+}
+
+func (d updatedTimestampChangeDetector) shouldWrite(azureKeyVaultSecret *akv.AzureKeyVaultSecret, secretHash string, objectVersion *vault.ObjectVersion) bool {
+	return hasValueChanged(azureKeyVaultSecret, secretHash) || (objectVersion != nil && d.shouldDownload(azureKeyVaultSecret, objectVersion))
+}
+
+// alwaysWriteChangeDetector downloads and writes the Secret on every poll
+type alwaysWriteChangeDetector struct{}
+
+func (alwaysWriteChangeDetector) shouldDownload(azureKeyVaultSecret *akv.AzureKeyVaultSecret, objectVersion *vault.ObjectVersion) bool {
+	return true
+}
+
+func (alwaysWriteChangeDetector) shouldWrite(azureKeyVaultSecret *akv.AzureKeyVaultSecret, secretHash string, objectVersion *vault.ObjectVersion) bool {
+	return true
+}
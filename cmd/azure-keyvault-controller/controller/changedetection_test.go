@@ -0,0 +1,145 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// secretPatches returns the number of patches of Secrets made by the controller
+func (f *fixture) secretPatches() int {
+	patches := 0
+	for _, action := range f.kubeClient.Actions() {
+		if action.GetVerb() == "patch" && action.GetResource().Resource == "secrets" {
+			patches++
+		}
+	}
+	return patches
+}
+
+func TestChangeDetectors(t *testing.T) {
+	updated := time.Now().Truncate(time.Second)
+	synced := azureKeyVaultSecretWithOutput()
+	synced.Status.SecretHash = "hash-1"
+	synced.Status.VaultName = testVaultName
+	synced.Status.ObjectVersion = "version-1"
+	synced.Status.ObjectUpdated = metav1.NewTime(updated)
+
+	unchanged := &vault.ObjectVersion{ID: "version-1", Updated: updated}
+	newVersion := &vault.ObjectVersion{ID: "version-2", Updated: updated.Add(time.Minute)}
+	touched := &vault.ObjectVersion{ID: "version-1", Updated: updated.Add(time.Minute)}
+
+	tests := []struct {
+		changeDetection akv.AzureKeyVaultChangeDetection
+		objectVersion   *vault.ObjectVersion
+		secretHash      string
+		download        bool
+		write           bool
+	}{
+		{"", unchanged, "hash-1", false, false},
+		{"", touched, "hash-1", true, false},
+		{"", newVersion, "hash-2", true, true},
+		{akv.AzureKeyVaultChangeDetectionValueHash, unchanged, "hash-1", true, false},
+		{akv.AzureKeyVaultChangeDetectionValueHash, unchanged, "hash-2", true, true},
+		{akv.AzureKeyVaultChangeDetectionVersionID, unchanged, "hash-1", false, false},
+		{akv.AzureKeyVaultChangeDetectionVersionID, touched, "hash-1", false, false},
+		{akv.AzureKeyVaultChangeDetectionVersionID, newVersion, "hash-1", true, true},
+		{akv.AzureKeyVaultChangeDetectionVersionID, nil, "hash-1", true, false},
+		{akv.AzureKeyVaultChangeDetectionUpdatedTimestamp, unchanged, "hash-1", false, false},
+		{akv.AzureKeyVaultChangeDetectionUpdatedTimestamp, touched, "hash-1", true, true},
+		{akv.AzureKeyVaultChangeDetectionAlwaysWrite, unchanged, "hash-1", true, true},
+	}
+
+	for _, test := range tests {
+		akvs := synced.DeepCopy()
+		akvs.Spec.ChangeDetection = test.changeDetection
+		detector, err := changeDetectorFor(akvs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if download := detector.shouldDownload(akvs, test.objectVersion); download != test.download {
+			t.Errorf("expected change detection '%s' to download %t for version %+v, got %t", test.changeDetection, test.download, test.objectVersion, download)
+		}
+		if write := detector.shouldWrite(akvs, test.secretHash, test.objectVersion); write != test.write {
+			t.Errorf("expected change detection '%s' to write %t for version %+v and hash '%s', got %t", test.changeDetection, test.write, test.objectVersion, test.secretHash, write)
+		}
+	}
+}
+
+func TestUnknownChangeDetection(t *testing.T) {
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Spec.ChangeDetection = "Sometimes"
+	if _, err := changeDetectorFor(akvs); err == nil {
+		t.Error("expected error for unknown change detection")
+	}
+}
+
+func TestSyncWithVersionIDChangeDetectionWritesNewVersionWithSameValue(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "same-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Spec.ChangeDetection = akv.AzureKeyVaultChangeDetectionVersionID
+	f.addAzureKeyVaultSecret(akvs)
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+	f.drainEvents()
+	patches := f.secretPatches()
+
+	version := f.vault.SetSecret(testVaultName, "my-secret", "same-value")
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	if f.secretPatches() != patches+1 {
+		t.Errorf("expected Secret to be written for the new version, got %d new writes", f.secretPatches()-patches)
+	}
+	if status := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status; status.ObjectVersion != version {
+		t.Errorf("expected status object version '%s', got '%s'", version, status.ObjectVersion)
+	}
+	// The value did not change, so it is not a rotation
+	f.expectNoEvents()
+}
+
+func TestSyncWithAlwaysWriteChangeDetection(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "my-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Spec.ChangeDetection = akv.AzureKeyVaultChangeDetectionAlwaysWrite
+	f.addAzureKeyVaultSecret(akvs)
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+	patches := f.secretPatches()
+	downloads := f.vault.Calls("GetSecret")
+
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	if f.vault.Calls("GetSecret") != downloads+1 || f.secretPatches() != patches+1 {
+		t.Errorf("expected unchanged secret to be downloaded and written, got %d downloads and %d writes",
+			f.vault.Calls("GetSecret")-downloads, f.secretPatches()-patches)
+	}
+}
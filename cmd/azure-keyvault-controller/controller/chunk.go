@@ -0,0 +1,291 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// ChunkIndexKey is the key of a chunked Secret having the index of its chunks, which is a JSON
+	// object mapping each key of the Secret to the chunk Secrets and keys its value is split into
+	ChunkIndexKey = "akv2k8s-chunks"
+
+	// secretSizeLimit is the most data Kubernetes allows in a Secret
+	secretSizeLimit = 1024 * 1024
+
+	// secretChunkSize is the most data written to each chunk Secret, leaving room for the keys
+	secretChunkSize = secretSizeLimit - 64*1024
+)
+
+// secretChunk is where a part of the value of a key of a chunked Secret is stored
+type secretChunk struct {
+	Secret string `json:"secret"`
+	Key    string `json:"key"`
+}
+
+// secretTooLargeError is returned when writing a Secret with more data than Kubernetes allows
+type secretTooLargeError struct {
+	secretName string
+	size       int
+}
+
+func (e *secretTooLargeError) Error() string {
+	return fmt.Sprintf(MessageSecretTooLarge, e.secretName, e.size, secretSizeLimit)
+}
+
+// isChunked returns true if the AzureKeyVaultSecret spreads data exceeding the size limit of a
+// Secret over several Secrets. Only Opaque Secrets not shared with others can be chunked, as
+// other types must have their keys in the Secret itself.
+func isChunked(azureKeyVaultSecret *akv.AzureKeyVaultSecret) bool {
+	return azureKeyVaultSecret.Spec.Output.Secret.Chunked && !isBundle(azureKeyVaultSecret) && determineSecretType(azureKeyVaultSecret) == corev1.SecretTypeOpaque
+}
+
+// isChunkedSecret returns true if the Secret has an index of chunks instead of its data
+func isChunkedSecret(secret *corev1.Secret) bool {
+	_, ok := secret.Data[ChunkIndexKey]
+	return ok
+}
+
+func chunkSecretName(secretName string, chunk int) string {
+	return fmt.Sprintf("%s-chunk-%d", secretName, chunk)
+}
+
+func secretDataSize(values map[string][]byte) int {
+	size := 0
+	for _, value := range values {
+		size += len(value)
+	}
+	return size
+}
+
+// checkSecretSize returns a secretTooLargeError if the values exceed the size limit of a Secret,
+// and the AzureKeyVaultSecret is not chunked
+func checkSecretSize(azureKeyVaultSecret *akv.AzureKeyVaultSecret, values map[string][]byte) error {
+	if size := secretDataSize(values); size > secretSizeLimit && !isChunked(azureKeyVaultSecret) {
+		return &secretTooLargeError{secretName: determineSecretName(azureKeyVaultSecret), size: size}
+	}
+	return nil
+}
+
+// splitSecretData splits the values into the data of each chunk Secret of secretName, filling
+// each chunk before starting the next, and returns it along with the index of the chunks
+func splitSecretData(secretName string, values map[string][]byte) ([]map[string][]byte, map[string][]secretChunk) {
+	var chunks []map[string][]byte
+	index := make(map[string][]secretChunk, len(values))
+	current, size := map[string][]byte{}, 0
+
+	for _, key := range sortValueKeys(values) {
+		value := values[key]
+		for part := 0; part == 0 || len(value) > 0; part++ {
+			if size >= secretChunkSize {
+				chunks = append(chunks, current)
+				current, size = map[string][]byte{}, 0
+			}
+
+			n := len(value)
+			if n > secretChunkSize-size {
+				n = secretChunkSize - size
+			}
+			chunkKey := fmt.Sprintf("%s.%d", key, part)
+			current[chunkKey] = value[:n]
+			index[key] = append(index[key], secretChunk{Secret: chunkSecretName(secretName, len(chunks)), Key: chunkKey})
+			value = value[n:]
+			size += n
+		}
+	}
+	return append(chunks, current), index
+}
+
+// AssembleSecretChunks returns the data of a Secret, joining the values split into chunk Secrets
+// if the Secret is chunked. getChunk gets a chunk Secret by name from the namespace of the Secret.
+func AssembleSecretChunks(secret *corev1.Secret, getChunk func(name string) (*corev1.Secret, error)) (map[string][]byte, error) {
+	indexData, ok := secret.Data[ChunkIndexKey]
+	if !ok {
+		return secret.Data, nil
+	}
+
+	var index map[string][]secretChunk
+	if err := json.Unmarshal(indexData, &index); err != nil {
+		return nil, fmt.Errorf("invalid index of chunks in secret '%s'/'%s', error: %w", secret.Namespace, secret.Name, err)
+	}
+
+	chunks := make(map[string]*corev1.Secret)
+	values := make(map[string][]byte, len(index))
+	for key, parts := range index {
+		value := []byte{}
+		for _, part := range parts {
+			chunk, ok := chunks[part.Secret]
+			if !ok {
+				var err error
+				if chunk, err = getChunk(part.Secret); err != nil {
+					return nil, fmt.Errorf("failed to get chunk '%s' of secret '%s'/'%s', error: %w", part.Secret, secret.Namespace, secret.Name, err)
+				}
+				chunks[part.Secret] = chunk
+			}
+
+			data, ok := chunk.Data[part.Key]
+			if !ok {
+				return nil, fmt.Errorf("chunk '%s' of secret '%s'/'%s' is missing key '%s'", part.Secret, secret.Namespace, secret.Name, part.Key)
+			}
+			value = append(value, data...)
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// assembleSecretData returns the data of the Secret, with the values of its chunks if chunked
+func (c *Controller) assembleSecretData(secret *corev1.Secret) (map[string][]byte, error) {
+	return AssembleSecretChunks(secret, c.secretsLister.Secrets(secret.Namespace).Get)
+}
+
+// assembleChunkedSecret returns a copy of the chunked Secret of the AzureKeyVaultSecret with the data of
+// its chunks. The Secret is written again if the AzureKeyVaultSecret is no longer chunked, or from Azure
+// Key Vault if its chunks cannot be read.
+func (c *Controller) assembleChunkedSecret(azureKeyVaultSecret *akv.AzureKeyVaultSecret, secret *corev1.Secret) (*corev1.Secret, error) {
+	values, err := c.assembleSecretData(secret)
+	if err == nil && isChunked(azureKeyVaultSecret) {
+		assembled := secret.DeepCopy()
+		assembled.Data = values
+		return assembled, nil
+	}
+
+	logger := newLogger(azureKeyVaultSecret).WithField("secret", secret.Name)
+	if err != nil {
+		logger.WithError(err).Warning("Failed to read chunks of Secret. Restoring it from Azure Key Vault.")
+		if values, err = c.getSecretFromKeyVault(lastSyncedObject(azureKeyVaultSecret)); err != nil {
+			return nil, fmt.Errorf("failed to get secret from Azure Key Vault to restore secret '%s'/'%s'%s, error: %w", secret.Namespace, secret.Name, formatRequestIDs(vault.RequestIDs(err)), err)
+		}
+	} else {
+		logger.Info("AzureKeyVaultSecret is no longer chunked, writing data to Secret")
+	}
+	return c.patchSecret(azureKeyVaultSecret, values, azureKeyVaultSecret.Status.ObjectVersion)
+}
+
+// writeSecretChunks writes the values to chunk Secrets if they exceed the size limit of a Secret and the
+// AzureKeyVaultSecret is chunked, and returns the data to write to the Secret itself along with the
+// number of chunks written. Chunks no longer needed are deleted by deleteSecretChunks once the Secret
+// has been written.
+func (c *Controller) writeSecretChunks(azureKeyVaultSecret *akv.AzureKeyVaultSecret, values map[string][]byte) (map[string][]byte, int, error) {
+	if !isChunked(azureKeyVaultSecret) || secretDataSize(values) <= secretSizeLimit {
+		return values, 0, nil
+	}
+
+	secretName := determineSecretName(azureKeyVaultSecret)
+	chunks, index := splitSecretData(secretName, values)
+	for i, data := range chunks {
+		if err := c.applySecretChunk(azureKeyVaultSecret, chunkSecretName(secretName, i), data); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	indexData, err := json.Marshal(index)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create index of chunks for secret '%s'/'%s', error: %w", azureKeyVaultSecret.Namespace, secretName, err)
+	}
+	newLogger(azureKeyVaultSecret).WithField("secret", secretName).Debugf("Secret written in %d chunks", len(chunks))
+	return map[string][]byte{ChunkIndexKey: indexData}, len(chunks), nil
+}
+
+// applySecretChunk creates or updates a chunk Secret, owned by the AzureKeyVaultSecret like its Secret
+func (c *Controller) applySecretChunk(azureKeyVaultSecret *akv.AzureKeyVaultSecret, name string, data map[string][]byte) error {
+	chunkOwner := azureKeyVaultSecret.DeepCopy()
+	chunkOwner.Spec.Output.Secret.Name = name
+	newSecret := createNewSecret(chunkOwner, data)
+	newSecret.Annotations = c.withControllerAnnotation(azureKeyVaultSecret, newSecret.Annotations)
+
+	current, err := c.secretsLister.Secrets(newSecret.Namespace).Get(name)
+	if errors.IsNotFound(err) {
+		_, err = c.kubeclientset.CoreV1().Secrets(newSecret.Namespace).Create(newSecret)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(current, azureKeyVaultSecret) {
+		return newOutputConflictError(fmt.Sprintf(MessageResourceExists, name))
+	}
+	if err = c.checkSecretController(azureKeyVaultSecret, current); err != nil {
+		return err
+	}
+	if reflect.DeepEqual(current.Data, data) && reflect.DeepEqual(current.Annotations, newSecret.Annotations) {
+		return nil
+	}
+
+	updated := current.DeepCopy()
+	updated.Data = data
+	updated.Annotations = newSecret.Annotations
+	_, err = c.kubeclientset.CoreV1().Secrets(newSecret.Namespace).Update(updated)
+	return err
+}
+
+// deleteSecretChunks deletes the chunk Secrets of secretName owned by the AzureKeyVaultSecret, starting
+// with chunk number from
+func (c *Controller) deleteSecretChunks(azureKeyVaultSecret *akv.AzureKeyVaultSecret, secretName string, from int) error {
+	for chunk := from; ; chunk++ {
+		name := chunkSecretName(secretName, chunk)
+		secret, err := c.secretsLister.Secrets(azureKeyVaultSecret.Namespace).Get(name)
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !metav1.IsControlledBy(secret, azureKeyVaultSecret) {
+			return nil
+		}
+
+		newLogger(azureKeyVaultSecret).WithField("secret", name).Debug("Deleting chunk Secret no longer needed")
+		if err := c.kubeclientset.CoreV1().Secrets(azureKeyVaultSecret.Namespace).Delete(name, nil); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+}
+
+// handleSecretTooLarge reports that the value from Azure Key Vault exceeds the size limit of a Secret
+// using the TooLarge condition, instead of the error from Kubernetes
+func (c *Controller) handleSecretTooLarge(azureKeyVaultSecret *akv.AzureKeyVaultSecret, err *secretTooLargeError) error {
+	msg := err.Error()
+	logger := newLogger(azureKeyVaultSecret).WithField("secret", err.secretName)
+	logger.Error(msg)
+	if !isConditionTrue(&azureKeyVaultSecret.Status, akv.AzureKeyVaultSecretConditionTooLarge) {
+		c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, ErrSecretTooLarge, msg)
+	}
+
+	now := c.clock.Now()
+	statusErr := c.mutateAzureKeyVaultSecretStatus(azureKeyVaultSecret, func(status *akv.AzureKeyVaultSecretStatus) {
+		setCondition(status, akv.AzureKeyVaultSecretCondition{
+			Type:    akv.AzureKeyVaultSecretConditionTooLarge,
+			Status:  corev1.ConditionTrue,
+			Reason:  "SizeLimitExceeded",
+			Message: msg,
+		}, now)
+	})
+	if statusErr != nil {
+		logger.WithError(statusErr).Error("failed to update status for AzureKeyVaultSecret")
+	}
+	return err
+}
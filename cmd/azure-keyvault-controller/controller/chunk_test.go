@@ -0,0 +1,107 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSecretTooLarge(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", strings.Repeat("a", secretSizeLimit+1))
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err == nil {
+		t.Fatal("expected sync of Secret exceeding the size limit to fail")
+	}
+	f.expectEvent(ErrSecretTooLarge)
+
+	status := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status
+	if !isConditionTrue(&status, akv.AzureKeyVaultSecretConditionTooLarge) {
+		t.Errorf("expected TooLarge condition, got %+v", status.Conditions)
+	}
+	if _, err := f.kubeClient.CoreV1().Secrets(akvs.Namespace).Get("my-kubernetes-secret", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("expected Secret not to be created, got %v", err)
+	}
+
+	// Not recorded again while still too large
+	f.refresh(akvs)
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err == nil {
+		t.Fatal("expected sync of Secret exceeding the size limit to fail")
+	}
+	f.expectNoEvents()
+}
+
+func TestChunkedSecret(t *testing.T) {
+	f := newFixture(t)
+	value := strings.Repeat("a", 2*secretSizeLimit)
+	f.vault.SetSecret(testVaultName, "my-secret", value)
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Spec.Output.Secret.Chunked = true
+	f.addAzureKeyVaultSecret(akvs)
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+
+	secret := f.getSecret(akvs.Namespace, "my-kubernetes-secret")
+	if len(secret.Data) != 1 || !isChunkedSecret(secret) {
+		t.Fatalf("expected Secret to only have the index of its chunks, got keys %v", sortValueKeys(secret.Data))
+	}
+	for _, name := range []string{"my-kubernetes-secret-chunk-0", "my-kubernetes-secret-chunk-1", "my-kubernetes-secret-chunk-2"} {
+		if chunk := f.getSecret(akvs.Namespace, name); secretDataSize(chunk.Data) > secretSizeLimit {
+			t.Errorf("expected chunk '%s' to be within the size limit, got %d bytes", name, secretDataSize(chunk.Data))
+		}
+	}
+
+	data, err := AssembleSecretChunks(secret, func(name string) (*corev1.Secret, error) {
+		return f.kubeClient.CoreV1().Secrets(akvs.Namespace).Get(name, metav1.GetOptions{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data["value"]) != value {
+		t.Errorf("expected assembled value of %d bytes, got %d bytes", len(value), len(data["value"]))
+	}
+
+	// The assembled data matches what was synced
+	f.refresh(akvs)
+	f.drainEvents()
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.expectNoEvents()
+
+	// Written to the Secret itself when within the limit again, deleting the chunks
+	f.vault.SetSecret(testVaultName, "my-secret", "small-value")
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	if secret := f.getSecret(akvs.Namespace, "my-kubernetes-secret"); string(secret.Data["value"]) != "small-value" || isChunkedSecret(secret) {
+		t.Errorf("expected Secret to have value 'small-value', got keys %v", sortValueKeys(secret.Data))
+	}
+	if _, err := f.kubeClient.CoreV1().Secrets(akvs.Namespace).Get("my-kubernetes-secret-chunk-0", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("expected chunks to be deleted, got %v", err)
+	}
+}
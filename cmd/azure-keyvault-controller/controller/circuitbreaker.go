@@ -0,0 +1,137 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+	log "github.com/sirupsen/logrus"
+)
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitOpenError is returned when requests to a vault are not attempted because its circuit is open
+type circuitOpenError struct {
+	vaultName string
+	retryAt   time.Time
+}
+
+func (e *circuitOpenError) Error() string {
+	return fmt.Sprintf("azure key vault '%s' is failing and will not be tried again before %s", e.vaultName, e.retryAt.Format(time.RFC3339))
+}
+
+func (e *circuitOpenError) Is(target error) bool {
+	return target == ErrVaultUnreachable
+}
+
+type vaultCircuit struct {
+	state     circuitState
+	failures  int
+	changedAt time.Time
+}
+
+// circuitBreaker keeps one circuit per Azure Key Vault. After threshold consecutive failures
+// the circuit opens and requests fail fast, until probeInterval has passed and a single
+// request is let through to probe if the vault has recovered.
+type circuitBreaker struct {
+	threshold     int
+	probeInterval time.Duration
+	now           func() time.Time
+
+	mutex    sync.Mutex
+	circuits map[string]*vaultCircuit
+}
+
+// newCircuitBreaker creates a circuitBreaker. A threshold of zero or less disables the circuit breaker.
+func newCircuitBreaker(threshold int, probeInterval time.Duration, clock Clock) *circuitBreaker {
+	return &circuitBreaker{
+		threshold:     threshold,
+		probeInterval: probeInterval,
+		now:           func() time.Time { return clock.Now().Time },
+		circuits:      make(map[string]*vaultCircuit),
+	}
+}
+
+// allow returns nil if a request to vaultName can be made, or a circuitOpenError if not
+func (b *circuitBreaker) allow(vaultName string) error {
+	if b.threshold <= 0 {
+		return nil
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	circuit, found := b.circuits[vaultName]
+	if !found || circuit.state == circuitClosed {
+		return nil
+	}
+
+	// Wait for the ongoing probe, unless it has been running for too long
+	retryAt := circuit.changedAt.Add(b.probeInterval)
+	if b.now().Before(retryAt) {
+		return &circuitOpenError{vaultName: vaultName, retryAt: retryAt}
+	}
+
+	log.Infof("Probing if Azure Key Vault '%s' has recovered", vaultName)
+	circuit.state = circuitHalfOpen
+	circuit.changedAt = b.now()
+	return nil
+}
+
+// record registers the result of a request to vaultName. Errors not caused by the vault
+// itself being unavailable, like an object not found, counts as success.
+func (b *circuitBreaker) record(vaultName string, err error) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	circuit, found := b.circuits[vaultName]
+	if !found {
+		circuit = &vaultCircuit{}
+		b.circuits[vaultName] = circuit
+	}
+
+	if err == nil || !vault.IsVaultUnavailable(err) {
+		if circuit.state != circuitClosed {
+			log.Infof("Azure Key Vault '%s' has recovered, closing circuit", vaultName)
+		}
+		circuit.state = circuitClosed
+		circuit.failures = 0
+		return
+	}
+
+	circuit.failures++
+	if circuit.state == circuitHalfOpen || circuit.failures >= b.threshold {
+		if circuit.state != circuitOpen {
+			log.Warningf("Azure Key Vault '%s' failed %d times in a row, opening circuit for %s", vaultName, circuit.failures, b.probeInterval)
+		}
+		circuit.state = circuitOpen
+		circuit.changedAt = b.now()
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+)
+
+func TestCircuitBreakerOpensAndProbes(t *testing.T) {
+	now := time.Now()
+	breaker := newCircuitBreaker(2, time.Minute, &RealClock{})
+	breaker.now = func() time.Time { return now }
+
+	unavailable := fmt.Errorf("dial tcp: i/o timeout")
+
+	breaker.record("my-vault", unavailable)
+	if err := breaker.allow("my-vault"); err != nil {
+		t.Fatalf("expected circuit to be closed after first failure, got %+v", err)
+	}
+
+	breaker.record("my-vault", unavailable)
+	if err := breaker.allow("my-vault"); err == nil {
+		t.Fatal("expected circuit to be open after threshold is reached")
+	}
+	if err := breaker.allow("other-vault"); err != nil {
+		t.Errorf("expected circuits to be per vault, got %+v", err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if err := breaker.allow("my-vault"); err != nil {
+		t.Fatalf("expected probe to be allowed after probe interval, got %+v", err)
+	}
+	if err := breaker.allow("my-vault"); err == nil {
+		t.Fatal("expected only one probe at a time")
+	}
+
+	breaker.record("my-vault", unavailable)
+	if err := breaker.allow("my-vault"); err == nil {
+		t.Fatal("expected circuit to open again after failed probe")
+	}
+
+	now = now.Add(2 * time.Minute)
+	breaker.allow("my-vault")
+	breaker.record("my-vault", nil)
+	if err := breaker.allow("my-vault"); err != nil {
+		t.Errorf("expected circuit to close after successful probe, got %+v", err)
+	}
+}
+
+func TestCircuitBreakerIgnoresObjectErrors(t *testing.T) {
+	breaker := newCircuitBreaker(1, time.Minute, &RealClock{})
+
+	breaker.record("my-vault", autorest.DetailedError{StatusCode: http.StatusNotFound})
+	if err := breaker.allow("my-vault"); err != nil {
+		t.Errorf("expected not found errors not to open circuit, got %+v", err)
+	}
+}
+
+func TestSyncDegradedVault(t *testing.T) {
+	f := newFixture(t)
+	f.controller.vaultCircuits = newCircuitBreaker(1, time.Minute, &RealClock{})
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+
+	f.vault.SetError(testVaultName, "secret", "my-secret", fmt.Errorf("vault unavailable"))
+	f.controller.syncAzureKeyVault(key(akvs))
+	calls := f.vault.Calls("GetSecret")
+
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err == nil {
+		t.Error("expected sync to fail fast while circuit is open")
+	}
+	if f.vault.Calls("GetSecret") != calls {
+		t.Error("expected no requests to Azure Key Vault while circuit is open")
+	}
+	f.expectEvent(ErrAzureVaultUnavailable)
+
+	status := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status
+	if !isConditionTrue(&status, akv.AzureKeyVaultSecretConditionDegraded) {
+		t.Error("expected Degraded condition to be true")
+	}
+}
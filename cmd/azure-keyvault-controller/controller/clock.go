@@ -20,19 +20,49 @@ import (
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 )
 
-// Timer is a simple interface for time handling
-type Timer interface {
+// Clock tells the time and waits for time to pass. All polling, back off and rotation decisions
+// use it, so they can be tested deterministically with a fake clock.
+type Clock interface {
 	Now() metav1.Time
+	After(d time.Duration) <-chan time.Time
 }
 
-// Clock is a simple Time impl
-type Clock struct {
+// RealClock is the Clock of the system
+type RealClock struct {
 }
 
 // Now returns current time
-func (t *Clock) Now() metav1.Time {
+func (t *RealClock) Now() metav1.Time {
 	now := time.Now()
 	return metav1.Time{Time: now}
 }
+
+// After waits for d to pass and then sends the current time on the returned channel
+func (t *RealClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// runUntil runs f every period using clock until stopCh is closed, like wait.Until
+func runUntil(clock Clock, f func(), period time.Duration, stopCh <-chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+
+		func() {
+			defer utilruntime.HandleCrash()
+			f()
+		}()
+
+		select {
+		case <-stopCh:
+			return
+		case <-clock.After(period):
+		}
+	}
+}
@@ -0,0 +1,173 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeClock is a Clock where time only passes when stepped
+type fakeClock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	waiters []fakeClockWaiter
+}
+
+type fakeClockWaiter struct {
+	until time.Time
+	ch    chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() metav1.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return metav1.NewTime(c.now)
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, fakeClockWaiter{until: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Step moves the clock forward by d and fires the waiters due
+func (c *fakeClock) Step(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+
+	var waiting []fakeClockWaiter
+	for _, w := range c.waiters {
+		if w.until.After(c.now) {
+			waiting = append(waiting, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = waiting
+}
+
+// hasWaiters returns true if anyone is waiting for the clock
+func (c *fakeClock) hasWaiters() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.waiters) > 0
+}
+
+func TestRunUntil(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	stopCh := make(chan struct{})
+	runs := make(chan struct{}, 10)
+	done := make(chan struct{})
+
+	go func() {
+		runUntil(clock, func() { runs <- struct{}{} }, time.Minute, stopCh)
+		close(done)
+	}()
+
+	<-runs
+	for i := 0; i < 3; i++ {
+		for !clock.hasWaiters() {
+			time.Sleep(time.Millisecond)
+		}
+		clock.Step(30 * time.Second)
+		select {
+		case <-runs:
+			t.Fatal("expected no run before the period has passed")
+		case <-time.After(10 * time.Millisecond):
+		}
+		clock.Step(30 * time.Second)
+		<-runs
+	}
+
+	close(stopCh)
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected runUntil to stop when stopCh is closed")
+	}
+}
+
+func TestNewControllerUsesClockOption(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	f := newFixture(t)
+	c := NewController(f.kubeClient, f.akvsClient, f.akvsInformerFactory, f.kubeInformerFactory, f.recorder, f.vault,
+		"azure-key-vault-env-injection", AzurePollFrequency{}, &Options{Clock: clock})
+	if c.clock != clock {
+		t.Error("expected controller to use the clock from options")
+	}
+}
+
+func TestPollingAndBackOffWithFakeClock(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	f := newFixture(t)
+	f.controller.clock = clock
+	f.controller.azureFrequency = AzurePollFrequency{Normal: time.Minute, Slow: time.Hour, MaxFailuresBeforeSlowingDown: 3}
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Status.LastAzureUpdate = clock.Now()
+	f.addAzureKeyVaultSecret(akvs)
+	q := f.controller.azureKeyVaultQueue.GetQueue()
+
+	f.controller.enqueueStaleAzureKeyVaultSecrets()
+	if q.Len() != 0 {
+		t.Fatalf("expected AzureKeyVaultSecret not to be polled before the poll interval, got %d queued", q.Len())
+	}
+
+	clock.Step(time.Minute)
+	f.controller.enqueueStaleAzureKeyVaultSecrets()
+	if q.Len() != 1 {
+		t.Fatalf("expected AzureKeyVaultSecret to be polled after the poll interval, got %d queued", q.Len())
+	}
+	item, _ := q.Get()
+	q.Done(item)
+	q.Forget(item)
+
+	// Two failures in a row double the delay before the next poll
+	err := f.controller.backOffAzureKeyVaultSecret(akvs, 2, 0, func(status *akv.AzureKeyVaultSecretStatus) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+	backingOff := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name)
+	if expected := clock.Now().Add(2 * time.Minute); !backingOff.Status.NextRetryTime.Time.Equal(expected) {
+		t.Errorf("expected next retry at %s, got %s", expected, backingOff.Status.NextRetryTime)
+	}
+
+	clock.Step(2*time.Minute - time.Second)
+	f.controller.enqueueStaleAzureKeyVaultSecrets()
+	if q.Len() != 0 {
+		t.Fatalf("expected AzureKeyVaultSecret not to be polled while backing off, got %d queued", q.Len())
+	}
+
+	clock.Step(time.Second)
+	f.controller.enqueueStaleAzureKeyVaultSecrets()
+	if q.Len() != 1 {
+		t.Fatalf("expected AzureKeyVaultSecret to be polled after backing off, got %d queued", q.Len())
+	}
+}
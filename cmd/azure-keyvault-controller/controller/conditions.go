@@ -0,0 +1,92 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// getCondition returns the condition of the given type, or nil if not present
+func getCondition(status *akv.AzureKeyVaultSecretStatus, conditionType akv.AzureKeyVaultSecretConditionType) *akv.AzureKeyVaultSecretCondition {
+	for i := range status.Conditions {
+		if status.Conditions[i].Type == conditionType {
+			return &status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// SyncState summarizes the sync status of a AzureKeyVaultSecret as the first true condition of
+// Degraded, Forbidden, TooLarge, NotExportable, SoftDeleted, ObjectDeleted and Drifted, or as Pending if never synced and Synced otherwise
+func SyncState(azureKeyVaultSecret *akv.AzureKeyVaultSecret) string {
+	for _, conditionType := range []akv.AzureKeyVaultSecretConditionType{
+		akv.AzureKeyVaultSecretConditionDegraded,
+		akv.AzureKeyVaultSecretConditionForbidden,
+		akv.AzureKeyVaultSecretConditionTooLarge,
+		akv.AzureKeyVaultSecretConditionNotExportable,
+		akv.AzureKeyVaultSecretConditionSoftDeleted,
+		akv.AzureKeyVaultSecretConditionObjectDeleted,
+		akv.AzureKeyVaultSecretConditionDrifted,
+	} {
+		if isConditionTrue(&azureKeyVaultSecret.Status, conditionType) {
+			return string(conditionType)
+		}
+	}
+
+	if azureKeyVaultSecret.Status.SecretHash == "" && azureKeyVaultSecret.Status.ObjectVersion == "" {
+		return "Pending"
+	}
+	return "Synced"
+}
+
+func isConditionTrue(status *akv.AzureKeyVaultSecretStatus, conditionType akv.AzureKeyVaultSecretConditionType) bool {
+	condition := getCondition(status, conditionType)
+	return condition != nil && condition.Status == corev1.ConditionTrue
+}
+
+// setCondition adds or replaces the condition of the same type. LastTransitionTime
+// is only changed when the condition status change.
+func setCondition(status *akv.AzureKeyVaultSecretStatus, condition akv.AzureKeyVaultSecretCondition, now metav1.Time) {
+	existing := getCondition(status, condition.Type)
+	if existing == nil {
+		condition.LastTransitionTime = now
+		status.Conditions = append(status.Conditions, condition)
+		return
+	}
+
+	if existing.Status != condition.Status {
+		existing.LastTransitionTime = now
+	}
+	existing.Status = condition.Status
+	existing.Reason = condition.Reason
+	existing.Message = condition.Message
+}
+
+// clearCondition sets the condition of the given type to false, if currently true
+func clearCondition(status *akv.AzureKeyVaultSecretStatus, conditionType akv.AzureKeyVaultSecretConditionType, reason string, message string, now metav1.Time) {
+	if !isConditionTrue(status, conditionType) {
+		return
+	}
+	setCondition(status, akv.AzureKeyVaultSecretCondition{
+		Type:    conditionType,
+		Status:  corev1.ConditionFalse,
+		Reason:  reason,
+		Message: message,
+	}, now)
+}
@@ -0,0 +1,83 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetCondition(t *testing.T) {
+	status := &akv.AzureKeyVaultSecretStatus{}
+	first := metav1.NewTime(time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC))
+	second := metav1.NewTime(first.Add(time.Minute))
+
+	setCondition(status, akv.AzureKeyVaultSecretCondition{Type: akv.AzureKeyVaultSecretConditionSoftDeleted, Status: corev1.ConditionTrue, Reason: "first"}, first)
+	setCondition(status, akv.AzureKeyVaultSecretCondition{Type: akv.AzureKeyVaultSecretConditionSoftDeleted, Status: corev1.ConditionTrue, Reason: "second"}, second)
+
+	if len(status.Conditions) != 1 {
+		t.Fatalf("expected 1 condition, got %d", len(status.Conditions))
+	}
+	condition := status.Conditions[0]
+	if condition.Reason != "second" {
+		t.Errorf("expected reason 'second', got '%s'", condition.Reason)
+	}
+	if !condition.LastTransitionTime.Equal(&first) {
+		t.Error("expected transition time to be unchanged when status is unchanged")
+	}
+
+	setCondition(status, akv.AzureKeyVaultSecretCondition{Type: akv.AzureKeyVaultSecretConditionSoftDeleted, Status: corev1.ConditionFalse}, second)
+	if !status.Conditions[0].LastTransitionTime.Equal(&second) {
+		t.Error("expected transition time to change when status change")
+	}
+	if isConditionTrue(status, akv.AzureKeyVaultSecretConditionSoftDeleted) {
+		t.Error("expected condition to be false")
+	}
+}
+
+func TestSyncState(t *testing.T) {
+	tests := []struct {
+		status   akv.AzureKeyVaultSecretStatus
+		expected string
+	}{
+		{akv.AzureKeyVaultSecretStatus{}, "Pending"},
+		{akv.AzureKeyVaultSecretStatus{ObjectVersion: "abc123"}, "Synced"},
+		{akv.AzureKeyVaultSecretStatus{
+			ObjectVersion: "abc123",
+			Conditions: []akv.AzureKeyVaultSecretCondition{
+				{Type: akv.AzureKeyVaultSecretConditionDrifted, Status: corev1.ConditionTrue},
+				{Type: akv.AzureKeyVaultSecretConditionDegraded, Status: corev1.ConditionTrue},
+			},
+		}, "Degraded"},
+		{akv.AzureKeyVaultSecretStatus{
+			ObjectVersion: "abc123",
+			Conditions: []akv.AzureKeyVaultSecretCondition{
+				{Type: akv.AzureKeyVaultSecretConditionDrifted, Status: corev1.ConditionFalse},
+			},
+		}, "Synced"},
+	}
+
+	for _, test := range tests {
+		if state := SyncState(&akv.AzureKeyVaultSecret{Status: test.status}); state != test.expected {
+			t.Errorf("expected %s, got %s", test.expected, state)
+		}
+	}
+}
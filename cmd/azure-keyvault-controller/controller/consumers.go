@@ -0,0 +1,196 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	log "github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+	"kmodules.xyz/client-go/tools/queue"
+)
+
+// secretConsumerIndex indexes pods by the namespace and name of each Secret they use
+const secretConsumerIndex = "secret"
+
+// initConsumers indexes pods by the Secrets they use, and syncs the AzureKeyVaultSecrets of those Secrets
+// when pods are added or deleted, so their consumers are kept up to date in status
+func (c *Controller) initConsumers() {
+	informer := c.kubeInformerFactory.Core().V1().Pods().Informer()
+	utilruntime.Must(informer.AddIndexers(cache.Indexers{secretConsumerIndex: indexPodBySecret}))
+	c.podIndexer = informer.GetIndexer()
+
+	// Secrets used by a pod can not be changed after it is created, so updates are ignored
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueueConsumedAzureKeyVaultSecrets,
+		DeleteFunc: c.enqueueConsumedAzureKeyVaultSecrets,
+	})
+}
+
+func indexPodBySecret(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return nil, nil
+	}
+
+	var keys []string
+	for _, name := range podSecretNames(pod) {
+		keys = append(keys, pod.Namespace+"/"+name)
+	}
+	return keys, nil
+}
+
+// podSecretNames returns the names of all Secrets used by the pod, as volumes, environment
+// variables or image pull secrets
+func podSecretNames(pod *corev1.Pod) []string {
+	names := map[string]bool{}
+	for _, volume := range pod.Spec.Volumes {
+		if volume.Secret != nil {
+			names[volume.Secret.SecretName] = true
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.Secret != nil {
+					names[source.Secret.Name] = true
+				}
+			}
+		}
+	}
+
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, container := range containers {
+		for _, env := range container.Env {
+			if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil {
+				names[env.ValueFrom.SecretKeyRef.Name] = true
+			}
+		}
+		for _, envFrom := range container.EnvFrom {
+			if envFrom.SecretRef != nil {
+				names[envFrom.SecretRef.Name] = true
+			}
+		}
+	}
+
+	for _, pullSecret := range pod.Spec.ImagePullSecrets {
+		names[pullSecret.Name] = true
+	}
+
+	result := make([]string, 0, len(names))
+	for name := range names {
+		if name != "" {
+			result = append(result, name)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// podConsumer returns the workload the pod belongs to, resolving pods of a ReplicaSet to
+// their Deployment using the pod-template-hash the Deployment adds to the ReplicaSet name
+func podConsumer(pod *corev1.Pod) akv.AzureKeyVaultSecretConsumer {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return akv.AzureKeyVaultSecretConsumer{Kind: "Pod", Name: pod.Name}
+	}
+
+	if hash := pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]; ref.Kind == "ReplicaSet" && hash != "" && strings.HasSuffix(ref.Name, "-"+hash) {
+		return akv.AzureKeyVaultSecretConsumer{Kind: "Deployment", Name: strings.TrimSuffix(ref.Name, "-"+hash)}
+	}
+	return akv.AzureKeyVaultSecretConsumer{Kind: ref.Kind, Name: ref.Name}
+}
+
+// secretConsumers returns the workloads with pods using the Secret, sorted by kind and name
+func (c *Controller) secretConsumers(namespace, secretName string) ([]akv.AzureKeyVaultSecretConsumer, error) {
+	pods, err := c.podIndexer.ByIndex(secretConsumerIndex, namespace+"/"+secretName)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[akv.AzureKeyVaultSecretConsumer]bool{}
+	var consumers []akv.AzureKeyVaultSecretConsumer
+	for _, obj := range pods {
+		consumer := podConsumer(obj.(*corev1.Pod))
+		if !seen[consumer] {
+			seen[consumer] = true
+			consumers = append(consumers, consumer)
+		}
+	}
+
+	sort.Slice(consumers, func(i, j int) bool {
+		if consumers[i].Kind != consumers[j].Kind {
+			return consumers[i].Kind < consumers[j].Kind
+		}
+		return consumers[i].Name < consumers[j].Name
+	})
+	return consumers, nil
+}
+
+// updateConsumers sets the workloads using the output Secret of the AzureKeyVaultSecret in its status
+func (c *Controller) updateConsumers(azureKeyVaultSecret *akv.AzureKeyVaultSecret) error {
+	if c.podIndexer == nil {
+		return nil
+	}
+
+	consumers, err := c.secretConsumers(azureKeyVaultSecret.Namespace, determineSecretName(azureKeyVaultSecret))
+	if err != nil {
+		return fmt.Errorf("failed to find consumers of secret for '%s'/'%s', error: %w", azureKeyVaultSecret.Namespace, azureKeyVaultSecret.Name, err)
+	}
+
+	if equality.Semantic.DeepEqual(consumers, azureKeyVaultSecret.Status.Consumers) {
+		return nil
+	}
+
+	// Getting the latest AzureKeyVaultSecret, as status may have been updated earlier in the same sync
+	latest, err := c.akvsClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(azureKeyVaultSecret.Namespace).Get(azureKeyVaultSecret.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	return c.mutateAzureKeyVaultSecretStatus(latest, func(status *akv.AzureKeyVaultSecretStatus) {
+		status.Consumers = consumers
+	})
+}
+
+// enqueueConsumedAzureKeyVaultSecrets adds the AzureKeyVaultSecrets having a Secret used by the pod as output
+// to the AzureKeyVaultSecret queue
+func (c *Controller) enqueueConsumedAzureKeyVaultSecrets(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+
+	for _, secretName := range podSecretNames(pod) {
+		azureKeyVaultSecret, err := c.findSecretOutputOwner(pod.Namespace, secretName)
+		if err != nil {
+			log.Errorf("failed to find AzureKeyVaultSecret of secret '%s'/'%s' used by pod '%s', error: %v", pod.Namespace, secretName, pod.Name, err)
+			continue
+		}
+		if azureKeyVaultSecret != nil && c.isHandled(azureKeyVaultSecret.Namespace, azureKeyVaultSecret.Name) {
+			queue.Enqueue(c.akvsCrdQueue.GetQueue(), azureKeyVaultSecret)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func consumerPod(name string, owner *metav1.OwnerReference, labels map[string]string, secretName string) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: labels},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{
+				Name: "app",
+				EnvFrom: []corev1.EnvFromSource{{
+					SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: secretName}},
+				}},
+			}},
+		},
+	}
+	if owner != nil {
+		controller := true
+		owner.Controller = &controller
+		pod.OwnerReferences = []metav1.OwnerReference{*owner}
+	}
+	return pod
+}
+
+func TestPodSecretNames(t *testing.T) {
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			Volumes: []corev1.Volume{
+				{Name: "a", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "volume-secret"}}},
+				{Name: "b", VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{Sources: []corev1.VolumeProjection{
+					{Secret: &corev1.SecretProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "projected-secret"}}},
+				}}}},
+			},
+			InitContainers: []corev1.Container{{
+				Env: []corev1.EnvVar{{Name: "X", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "env-secret"}, Key: "x"}}}},
+			}},
+			ImagePullSecrets: []corev1.LocalObjectReference{{Name: "pull-secret"}, {Name: "volume-secret"}},
+		},
+	}
+
+	expected := []string{"env-secret", "projected-secret", "pull-secret", "volume-secret"}
+	if names := podSecretNames(pod); !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
+
+func TestPodConsumer(t *testing.T) {
+	tests := []struct {
+		name     string
+		pod      *corev1.Pod
+		expected akv.AzureKeyVaultSecretConsumer
+	}{
+		{"no owner", consumerPod("standalone", nil, nil, "s"), akv.AzureKeyVaultSecretConsumer{Kind: "Pod", Name: "standalone"}},
+		{"deployment", consumerPod("web-5d8f7-abcde", &metav1.OwnerReference{Kind: "ReplicaSet", Name: "web-5d8f7"}, map[string]string{"pod-template-hash": "5d8f7"}, "s"), akv.AzureKeyVaultSecretConsumer{Kind: "Deployment", Name: "web"}},
+		{"replicaset", consumerPod("rs-abcde", &metav1.OwnerReference{Kind: "ReplicaSet", Name: "rs"}, nil, "s"), akv.AzureKeyVaultSecretConsumer{Kind: "ReplicaSet", Name: "rs"}},
+		{"statefulset", consumerPod("db-0", &metav1.OwnerReference{Kind: "StatefulSet", Name: "db"}, nil, "s"), akv.AzureKeyVaultSecretConsumer{Kind: "StatefulSet", Name: "db"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if consumer := podConsumer(test.pod); consumer != test.expected {
+				t.Errorf("expected %+v, got %+v", test.expected, consumer)
+			}
+		})
+	}
+}
+
+func TestSyncTracksConsumers(t *testing.T) {
+	f := newFixture(t)
+	f.controller.initConsumers()
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	for _, pod := range []*corev1.Pod{
+		consumerPod("web-5d8f7-abcde", &metav1.OwnerReference{Kind: "ReplicaSet", Name: "web-5d8f7"}, map[string]string{"pod-template-hash": "5d8f7"}, "my-kubernetes-secret"),
+		consumerPod("web-5d8f7-fghij", &metav1.OwnerReference{Kind: "ReplicaSet", Name: "web-5d8f7"}, map[string]string{"pod-template-hash": "5d8f7"}, "my-kubernetes-secret"),
+		consumerPod("db-0", &metav1.OwnerReference{Kind: "StatefulSet", Name: "db"}, nil, "my-kubernetes-secret"),
+		consumerPod("other", nil, nil, "other-secret"),
+	} {
+		if err := f.kubeInformerFactory.Core().V1().Pods().Informer().GetIndexer().Add(pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+
+	status := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status
+	expected := []akv.AzureKeyVaultSecretConsumer{{Kind: "Deployment", Name: "web"}, {Kind: "StatefulSet", Name: "db"}}
+	if !reflect.DeepEqual(status.Consumers, expected) {
+		t.Errorf("expected consumers %v, got %v", expected, status.Consumers)
+	}
+	if status.SecretHash == "" {
+		t.Error("expected status secret hash to be kept when setting consumers")
+	}
+}
@@ -20,11 +20,14 @@ limitations under the License.
 package controller
 
 import (
+	"io"
+	"sync/atomic"
 	"time"
 
 	"github.com/appscode/go/runtime"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
 
 	corev1 "k8s.io/api/core/v1"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
@@ -32,8 +35,8 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
-	"kmodules.xyz/client-go/tools/queue"
 
 	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
 	akvcs "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/client/clientset/versioned"
@@ -50,10 +53,155 @@ const (
 	// to sync due to a Secret of the same name already existing.
 	ErrResourceExists = "ErrResourceExists"
 
+	// ErrBundleKeyConflict is used as part of the Event 'reason' when a AzureKeyVaultSecret fails to
+	// sync because a key of its bundle Secret is owned by another AzureKeyVaultSecret
+	ErrBundleKeyConflict = "ErrBundleKeyConflict"
+
 	// ErrAzureVault is used as part of the Event 'reason' when a AzureKeyVaultSecret fails
 	// to sync due to a Secret of the same name already existing.
 	ErrAzureVault = "ErrAzureVault"
 
+	// ErrAzureVaultSoftDeleted is used as part of the Event 'reason' when a AzureKeyVaultSecret fails
+	// to sync because the object is deleted in Azure Key Vault, but can still be recovered
+	ErrAzureVaultSoftDeleted = "ErrAzureVaultSoftDeleted"
+
+	// ErrAzureVaultObjectDeleted is used as part of the Event 'reason' when the object of a synced
+	// AzureKeyVaultSecret no longer exists in Azure Key Vault
+	ErrAzureVaultObjectDeleted = "ErrAzureVaultObjectDeleted"
+
+	// ErrAzureVaultForbidden is used as part of the Event 'reason' when a AzureKeyVaultSecret fails
+	// to sync because Azure Key Vault denies the controller getting the object
+	ErrAzureVaultForbidden = "ErrAzureVaultForbidden"
+
+	// ErrAzureVaultUnreachable is used as part of the Event 'reason' when the probe of the Azure Key Vault
+	// of a AzureKeyVaultSecret fails, because it cannot be reached or denies the controller
+	ErrAzureVaultUnreachable = "ErrAzureVaultUnreachable"
+
+	// ErrAzureCredentialsRejected is used as part of the Event 'reason' when Azure rejects the credentials
+	// used for the Azure Key Vault of a AzureKeyVaultSecret in the credential check
+	ErrAzureCredentialsRejected = "ErrAzureCredentialsRejected"
+
+	// ErrAzureVaultTagsForbidden is used as part of the Event 'reason' when Azure Key Vault denies the
+	// controller tagging the object of a AzureKeyVaultSecret with sync metadata
+	ErrAzureVaultTagsForbidden = "ErrAzureVaultTagsForbidden"
+
+	// AzureVaultQuotaNearLimit is used as part of the Event 'reason' when the requests to the Azure Key Vault
+	// of a AzureKeyVaultSecret approach the limit of the vault, before being throttled
+	AzureVaultQuotaNearLimit = "AzureVaultQuotaNearLimit"
+
+	// ErrAzureVaultUnavailable is used as part of the Event 'reason' when a AzureKeyVaultSecret fails
+	// to sync because the Azure Key Vault keeps failing and requests to it are paused
+	ErrAzureVaultUnavailable = "ErrAzureVaultUnavailable"
+
+	// ErrVaultDefaults is used as part of the Event 'reason' when a AzureKeyVaultSecret fails to
+	// sync because the Azure Key Vault can not be found from it and the AzureKeyVaultDefaults of its namespace
+	ErrVaultDefaults = "ErrVaultDefaults"
+
+	// ErrVaultPolicy is used as part of the Event 'reason' when a AzureKeyVaultSecret fails to
+	// sync because the AzureKeyVaultPolicies do not allow its namespace to use the Azure Key Vault
+	ErrVaultPolicy = "ErrVaultPolicy"
+
+	// ErrRemoteCluster is used as part of the Event 'reason' when the Secret of a AzureKeyVaultSecret
+	// fails to be written to another cluster
+	ErrRemoteCluster = "ErrRemoteCluster"
+
+	// ErrTrustBundle is used as part of the Event 'reason' when the trust bundle of a AzureKeyVaultSecret
+	// is not allowed or can not be written
+	ErrTrustBundle = "ErrTrustBundle"
+
+	// AzureVaultRecovered is used as part of the Event 'reason' when a AzureKeyVaultSecret
+	// is synced from Azure Key Vault again after failing
+	AzureVaultRecovered = "AzureVaultRecovered"
+
+	// AzureVaultFallback is used as part of the Event 'reason' when a AzureKeyVaultSecret
+	// is synced from its fallback Azure Key Vault
+	AzureVaultFallback = "AzureVaultFallback"
+
+	// AzureVaultObjectRestored is used as part of the Event 'reason' when the object of a AzureKeyVaultSecret
+	// exists in Azure Key Vault again after being deleted
+	AzureVaultObjectRestored = "AzureVaultObjectRestored"
+
+	// SecretBootstrapped is used as part of the Event 'reason' when the secret of a AzureKeyVaultSecret
+	// is generated in Azure Key Vault because it did not exist
+	SecretBootstrapped = "SecretBootstrapped"
+
+	// SecretDrifted is used as part of the Event 'reason' when the Secret of a AzureKeyVaultSecret
+	// has been changed outside of the controller
+	SecretDrifted = "SecretDrifted"
+
+	// SecretDriftRepaired is used as part of the Event 'reason' when the Secret of a AzureKeyVaultSecret
+	// has been restored after being changed outside of the controller
+	SecretDriftRepaired = "SecretDriftRepaired"
+
+	// SecretRotationAnomaly is used as part of the Event 'reason' when the secret of a AzureKeyVaultSecret
+	// rotates far more often than it has before
+	SecretRotationAnomaly = "SecretRotationAnomaly"
+
+	// SecretDeleted is used as part of the Event 'reason' when the Secret of a AzureKeyVaultSecret
+	// has been deleted outside of the controller
+	SecretDeleted = "SecretDeleted"
+
+	// AzureKeyVaultSecretDegraded is used as part of the Event 'reason' when a AzureKeyVaultSecret has
+	// failed to sync from Azure Key Vault too many times in a row, and is polled less often
+	AzureKeyVaultSecretDegraded = "AzureKeyVaultSecretDegraded"
+
+	// TimedOut is used as part of the Event 'reason' when a sync takes longer than the sync timeout
+	TimedOut = "TimedOut"
+
+	// SecretRenamed is used as part of the Event 'reason' when the output Secret of a AzureKeyVaultSecret
+	// is renamed, and the Secret of the previous name is kept up to date for a grace period
+	SecretRenamed = "SecretRenamed"
+
+	// PreviousSecretDeleted is used as part of the Event 'reason' when the Secret of the previous name
+	// of a renamed output Secret is deleted after its grace period
+	PreviousSecretDeleted = "PreviousSecretDeleted"
+
+	// ErrSecretTooLarge is used as part of the Event 'reason' when the value from Azure Key Vault
+	// exceeds the size limit of a Secret
+	ErrSecretTooLarge = "ErrSecretTooLarge"
+
+	// ErrSecretOwnedByOtherController is used as part of the Event 'reason' when the output Secret is
+	// stamped by another controller installation or shard
+	ErrSecretOwnedByOtherController = "ErrSecretOwnedByOtherController"
+
+	// ErrCertificateNotExportable is used as part of the Event 'reason' when the private key of the
+	// certificate cannot be exported from Azure Key Vault
+	ErrCertificateNotExportable = "ErrCertificateNotExportable"
+
+	// PublicCertificateOnly is used as part of the Event 'reason' when only the public certificate is
+	// written to the Secret, as the private key cannot be exported from Azure Key Vault
+	PublicCertificateOnly = "PublicCertificateOnly"
+
+	// SecretAdopted is used as part of the Event 'reason' when an orphaned Secret is owned by its
+	// AzureKeyVaultSecret again
+	SecretAdopted = "SecretAdopted"
+
+	// SecretRotated is used as part of the Event 'reason' on the output Secret when it is updated with a
+	// new value from Azure Key Vault
+	SecretRotated = "SecretRotated"
+
+	// RotationPending is used as part of the Event 'reason' when a change in Azure Key Vault waits for
+	// the rotation window of a AzureKeyVaultSecret to open
+	RotationPending = "RotationPending"
+
+	// RotationPendingApproval is used as part of the Event 'reason' when a new version in Azure Key Vault
+	// waits for approval before being applied to the Secret of a AzureKeyVaultSecret
+	RotationPendingApproval = "RotationPendingApproval"
+
+	// DeploymentRolledOut is used as part of the Event 'reason' when a Deployment using a rotated Secret is rolled out
+	DeploymentRolledOut = "DeploymentRolledOut"
+
+	// ErrAzureCredentials is used as part of the Event 'reason' when Azure rejects the credentials
+	// of the controller, and reloading them fails
+	ErrAzureCredentials = "ErrAzureCredentials"
+
+	// AzureCredentialsRecovered is used as part of the Event 'reason' when the controller has reloaded
+	// its credentials after Azure rejected them
+	AzureCredentialsRecovered = "AzureCredentialsRecovered"
+
+	// DryRun is used as part of the Event 'reason' when a change is not made because of dry run mode
+	DryRun = "DryRun"
+
 	// ErrConfigMap is used as part of the Event 'reason' when a Secret sync fails
 	ErrConfigMap = "ErrConfigMap"
 
@@ -61,10 +209,201 @@ const (
 	// fails to get secret from Azure Key Vault
 	FailedAzureKeyVault = "Failed to get secret for '%s' from Azure Key Vault '%s'"
 
+	// MessageAzureKeyVaultObjectSoftDeleted is the message used for Events when a resource
+	// fails to sync because the object is soft-deleted in Azure Key Vault
+	MessageAzureKeyVaultObjectSoftDeleted = "Object '%s' is deleted in Azure Key Vault '%s', but can still be recovered. Recover it using 'az keyvault %s recover --vault-name %s --name %s' or remove this AzureKeyVaultSecret"
+
+	// MessageAzureKeyVaultForbidden is the message used for Events when a resource fails to sync
+	// because Azure Key Vault denies getting the object, followed by what to change in Azure
+	MessageAzureKeyVaultForbidden = "Failed to get secret for '%s' from Azure Key Vault '%s', access denied: %s"
+
+	// MessageAzureKeyVaultUnreachable is the message used for Events when the probe of an Azure Key Vault fails
+	MessageAzureKeyVaultUnreachable = "Probe of Azure Key Vault '%s' failed: %s"
+
+	// MessageCredentialsHealthy is the message of the CredentialsHealthy condition when Azure accepts the credentials
+	MessageCredentialsHealthy = "Azure accepted the %s for Azure Key Vault '%s'"
+
+	// MessageCredentialsRejected is the message used for Events when Azure rejects the credentials in the credential check
+	MessageCredentialsRejected = "Azure rejected the %s for Azure Key Vault '%s': %s"
+
+	// MessageCredentialsUnverified is the message of the CredentialsHealthy condition when the credential check fails for other reasons
+	MessageCredentialsUnverified = "Could not check the %s for Azure Key Vault '%s': %s"
+
+	// MessageAzureKeyVaultTagsForbidden is the message used for Events when Azure Key Vault denies tagging the
+	// object with sync metadata, followed by what to change in Azure
+	MessageAzureKeyVaultTagsForbidden = "Failed to tag object '%s' in Azure Key Vault '%s' with sync metadata, access denied: %s"
+
+	// MessageAzureKeyVaultQuotaNearLimit is the message used for Events when the requests to an Azure Key Vault approach its limit
+	MessageAzureKeyVaultQuotaNearLimit = "Controller has made %d requests to Azure Key Vault '%s' in the last %s, %.0f%% of its limit of %d. Requests may soon be throttled"
+
+	// MessageAzureKeyVaultObjectDeleted is the message used for Events when the object of a synced
+	// resource no longer exists in Azure Key Vault, followed by the action of the OnObjectDeleted policy
+	MessageAzureKeyVaultObjectDeleted = "Object '%s' no longer exists in Azure Key Vault '%s', %s"
+
+	// MessageAzureKeyVaultObjectRestored is the message used for Events when the object of a
+	// resource exists in Azure Key Vault again after being deleted
+	MessageAzureKeyVaultObjectRestored = "Object '%s' exists in Azure Key Vault '%s' again after being deleted"
+
+	// MessageAzureKeyVaultRecovered is the message used for Events when a resource
+	// is synced from Azure Key Vault again after failing
+	MessageAzureKeyVaultRecovered = "Got secret from Azure Key Vault '%s' again after failing %d times in a row"
+
+	// MessageAzureKeyVaultFallback is the message used for Events when a resource
+	// is synced from its fallback Azure Key Vault
+	MessageAzureKeyVaultFallback = "Using fallback Azure Key Vault '%s' after repeated failures getting secret from Azure Key Vault '%s'"
+
+	// MessageSecretDrifted is the message used for Events when a Secret has been changed
+	// outside of the controller, and drift repair is disabled
+	MessageSecretDrifted = "Secret '%s' has been changed outside of AzureKeyVaultSecret and differs from Azure Key Vault"
+
+	// MessageSecretDriftRepaired is the message used for Events when a Secret changed
+	// outside of the controller has been restored
+	MessageSecretDriftRepaired = "Secret '%s' was changed outside of AzureKeyVaultSecret and has been restored from Azure Key Vault"
+
+	// MessageSecretDeleted is the message used for Events when a Secret has been deleted
+	// outside of the controller
+	MessageSecretDeleted = "Secret '%s' was deleted outside of AzureKeyVaultSecret and is being recreated"
+
+	// MessageAzureKeyVaultSecretDegraded is the message used for Events when a AzureKeyVaultSecret has
+	// failed to sync from Azure Key Vault too many times in a row
+	MessageAzureKeyVaultSecretDegraded = "Failed to get secret from Azure Key Vault %d times in a row, not trying again until %s unless spec or the force-sync annotation is changed: %s"
+
+	// MessageSyncTimedOut is the message used for Events when a sync takes longer than the sync timeout
+	MessageSyncTimedOut = "Sync did not finish within %s and will be retried"
+
+	// MessageSecretRenamed is the message used for Events when the output Secret is renamed with a grace period
+	MessageSecretRenamed = "Secret renamed from '%s' to '%s'. Secret '%s' is kept up to date until %s, and then deleted"
+
+	// MessagePreviousSecretDeleted is the message used for Events when the Secret of the previous name is deleted
+	MessagePreviousSecretDeleted = "Secret '%s' has been deleted, as its grace period after being renamed to '%s' has passed"
+
+	// MessageSecretOwnedByOtherController is the message used for Events when the output Secret is stamped by another controller
+	MessageSecretOwnedByOtherController = "Secret '%s' is owned by controller '%s', not '%s', and is not changed. Remove annotation %s from the Secret to hand it over"
+
+	// MessageSecretTooLarge is the message used for Events when the value from Azure Key Vault exceeds the size limit of a Secret
+	MessageSecretTooLarge = "Secret '%s' would be %d bytes, exceeding the limit of %d bytes of a Secret. Set spec.output.secret.chunked to spread it over several Secrets"
+
+	// MessageCertificateNotExportable is the message used for Events when the private key of the certificate cannot be exported
+	MessageCertificateNotExportable = "Private key of certificate '%s' in Azure Key Vault '%s' is not exportable, as the certificate policy has exportable set to false. Set spec.output.secret.publicCertificateFallback to only sync the public certificate"
+
+	// MessagePublicCertificateOnly is the message used for Events when only the public certificate is written to the Secret
+	MessagePublicCertificateOnly = "Private key of certificate '%s' in Azure Key Vault '%s' is not exportable, only the public certificate is written to Secret '%s'"
+
+	// MessageSecretAdopted is the message used for Events when an orphaned Secret is owned by its
+	// AzureKeyVaultSecret again
+	MessageSecretAdopted = "Secret '%s' had lost its owner reference and has been adopted by AzureKeyVaultSecret again"
+
+	// MessageSecretRotated is the message used for notifications when a Secret is updated with a new value from Azure Key Vault
+	MessageSecretRotated = "Secret '%s' has been updated with a new value from Azure Key Vault"
+
+	// MessageSecretRotatedFrom is the message used for Events on the output Secret when it is updated with a new value from Azure Key Vault
+	MessageSecretRotatedFrom = "Updated with a new value of object '%s' in Azure Key Vault '%s' by AzureKeyVaultSecret '%s'"
+
+	// MessageRotationPending is the message used for Events when a change in Azure Key Vault waits for the rotation window
+	MessageRotationPending = "New value of object '%s' in Azure Key Vault will be applied when the rotation window opens at %s"
+
+	// MessageRotationPendingApproval is the message used for Events and notifications when a new version in Azure Key Vault waits for approval
+	MessageRotationPendingApproval = "New version '%s' of object '%s' in Azure Key Vault waits for approval. Approve it by annotating the AzureKeyVaultSecret with %s=%s"
+
+	// MessageSecretAdoptedBy is the message used for Events on an orphaned Secret when it is owned by its AzureKeyVaultSecret again
+	MessageSecretAdoptedBy = "Had lost its owner reference and has been adopted by AzureKeyVaultSecret '%s' again"
+
+	// MessageSecretRotationAnomaly is the message used for Events when a secret rotates far more often than its baseline
+	MessageSecretRotationAnomaly = "Object '%s' in Azure Key Vault '%s' has rotated %d times in the last %s, more than %g times its baseline of %.2f rotations. This may be caused by a misconfiguration or an attack upstream."
+
+	// MessageDeploymentRolledOut is the message used for Events when a Deployment using a rotated Secret is rolled out
+	MessageDeploymentRolledOut = "Rolling out Deployment '%s' using rotated Secret '%s'"
+
+	// MessageAzureCredentialsFailed is the message used for Events when reloading credentials rejected by Azure fails
+	MessageAzureCredentialsFailed = "Azure rejected the credentials of the controller (%s), and reloading them failed: %s"
+
+	// MessageAzureCredentialsRecovered is the message used for Events when credentials rejected by Azure have been reloaded
+	MessageAzureCredentialsRecovered = "Azure rejected the credentials of the controller (%s), and they have been reloaded"
+
+	// MessageDryRunCreateSecret is the message used for Events when a Secret would be created in dry run mode
+	MessageDryRunCreateSecret = "Dry run: would create Secret '%s' with keys: %s"
+
+	// MessageDryRunUpdateSecret is the message used for Events when a Secret would be updated in dry run mode
+	MessageDryRunUpdateSecret = "Dry run: would update Secret '%s', changing keys: %s"
+
+	// MessageDryRunDeleteSecret is the message used for Events when a Secret would be deleted in dry run mode
+	MessageDryRunDeleteSecret = "Dry run: would delete Secret '%s'"
+
+	// MessageDryRunRolloutDeployment is the message used for Events when a Deployment would be rolled out in dry run mode
+	MessageDryRunRolloutDeployment = "Dry run: would roll out Deployment '%s' using rotated Secret '%s'"
+
+	// MessageDryRunAdoptSecret is the message used for Events when an orphaned Secret would be adopted in dry run mode
+	MessageDryRunAdoptSecret = "Dry run: would adopt orphaned Secret '%s'"
+
+	// MessageDryRunTrustBundleConfigMap is the message used for Events when a trust bundle ConfigMap would be written in dry run mode
+	MessageDryRunTrustBundleConfigMap = "Dry run: would write trust bundle ConfigMap '%s' in namespaces: %s"
+
+	// MessageDryRunClusterTrustBundle is the message used for Events when a ClusterTrustBundle would be written in dry run mode
+	MessageDryRunClusterTrustBundle = "Dry run: would write ClusterTrustBundle '%s'"
+
+	// MessageDryRunDeleteTrustBundleConfigMap is the message used for Events when trust bundle ConfigMaps would be deleted in dry run mode
+	MessageDryRunDeleteTrustBundleConfigMap = "Dry run: would delete trust bundle ConfigMap '%s' in namespaces: %s"
+
+	// MessageDryRunDeleteClusterTrustBundle is the message used for Events when a ClusterTrustBundle would be deleted in dry run mode
+	MessageDryRunDeleteClusterTrustBundle = "Dry run: would delete ClusterTrustBundle '%s'"
+
+	// MessageDryRunBootstrapSecret is the message used for Events when a secret would be generated in Azure Key Vault in dry run mode
+	MessageDryRunBootstrapSecret = "Dry run: would generate secret '%s' in Azure Key Vault '%s'"
+
+	// MessageDryRunRemoteClusterSecret is the message used for Events when a Secret would be written to another cluster in dry run mode
+	MessageDryRunRemoteClusterSecret = "Dry run: would write Secret '%s' to cluster of kubeconfig Secret '%s'"
+
+	// MessageDryRunDeleteRemoteClusterSecret is the message used for Events when a Secret would be deleted from another cluster in dry run mode
+	MessageDryRunDeleteRemoteClusterSecret = "Dry run: would delete Secret '%s' from cluster of kubeconfig Secret '%s'"
+
 	// MessageResourceExists is the message used for Events when a resource
 	// fails to sync due to a Deployment already existing
 	MessageResourceExists = "Resource '%s' already exists and is not managed by AzureKeyVaultSecret"
 
+	// MessageBundleKeyConflict is the message used for Events when a key of a bundle Secret
+	// is owned by another AzureKeyVaultSecret
+	MessageBundleKeyConflict = "Key '%s' of bundle Secret '%s' is owned by AzureKeyVaultSecret '%s'"
+
+	// MessageMergeKeyConflict is the message used for Events when a key of a Secret merged into
+	// is not owned by any AzureKeyVaultSecret
+	MessageMergeKeyConflict = "Key '%s' of Secret '%s' is not managed by AzureKeyVaultSecret and will not be overwritten"
+
+	// MessageMultipleVaultDefaults is the message used for Events when the namespace of a
+	// AzureKeyVaultSecret has more than one AzureKeyVaultDefault
+	MessageMultipleVaultDefaults = "Namespace '%s' has %d AzureKeyVaultDefaults, but only one is allowed"
+
+	// MessageNoVaultName is the message used for Events when neither the AzureKeyVaultSecret nor
+	// the AzureKeyVaultDefault of its namespace has the name of the Azure Key Vault
+	MessageNoVaultName = "No Azure Key Vault name in AzureKeyVaultSecret or AzureKeyVaultDefault of namespace '%s'"
+
+	// MessageVaultPolicyDenied is the message used for Events when the AzureKeyVaultPolicies
+	// do not allow a AzureKeyVaultSecret
+	MessageVaultPolicyDenied = "AzureKeyVaultSecret not allowed by AzureKeyVaultPolicies: %s"
+
+	// MessageSecretBootstrapped is the message used for Events when the secret of a AzureKeyVaultSecret
+	// is generated in Azure Key Vault
+	MessageSecretBootstrapped = "Generated secret '%s' in Azure Key Vault '%s', as it did not exist"
+
+	// MessageRemoteClusterFailed is the message used for Events when the Secret of a AzureKeyVaultSecret
+	// fails to be written to the cluster of a kubeconfig Secret
+	MessageRemoteClusterFailed = "Failed to write Secret to cluster of kubeconfig Secret '%s': %v"
+
+	// MessageRemoteClusterDeleteFailed is the message used for Events when a Secret written to another
+	// cluster by a AzureKeyVaultSecret fails to be deleted
+	MessageRemoteClusterDeleteFailed = "Failed to delete Secret '%s' from cluster of kubeconfig Secret '%s': %v"
+
+	// MessageTrustBundlesDisabled is the message used for Events when a AzureKeyVaultSecret has a trust
+	// bundle output, but trust bundles are not enabled in the controller
+	MessageTrustBundlesDisabled = "Trust bundle not written, as trust bundles are not enabled in the controller"
+
+	// MessageTrustBundleDenied is the message used for Events when the trust bundle of a AzureKeyVaultSecret
+	// is not allowed by any AzureKeyVaultPolicy
+	MessageTrustBundleDenied = "Trust bundle not written: %s"
+
+	// MessageClusterTrustBundlesNotServed is the message used for Events when a ClusterTrustBundle can not
+	// be written, as the cluster does not serve the ClusterTrustBundle API
+	MessageClusterTrustBundlesNotServed = "ClusterTrustBundle '%s' not written, as ClusterTrustBundles are not served by the cluster"
+
 	// MessageAzureKeyVaultSecretSynced is the message used for an Event fired when a AzureKeyVaultSecret
 	// is synced successfully
 	MessageAzureKeyVaultSecretSynced = "AzureKeyVaultSecret synced to Kubernetes Secret successfully"
@@ -85,38 +424,233 @@ type Controller struct {
 
 	// Secret
 	secretsLister   corelisters.SecretLister
-	akvsSecretQueue *queue.Worker
+	akvsSecretQueue *queueWorker
 
 	// AzureKeyVaultSecret
 	azureKeyVaultSecretLister listers.AzureKeyVaultSecretLister
 	akvsInformerFactory       akvInformers.SharedInformerFactory
-	akvsCrdQueue              *queue.Worker
-	azureKeyVaultQueue        *queue.Worker
+	akvsCrdQueue              *queueWorker
+	azureKeyVaultQueue        *queueWorker
+
+	// AzureKeyVaultDefault, nil unless Options.VaultDefaults is set
+	azureKeyVaultDefaultLister listers.AzureKeyVaultDefaultLister
+
+	// AzureKeyVaultPolicy, nil unless Options.VaultPolicies is set
+	azureKeyVaultPolicyLister listers.AzureKeyVaultPolicyLister
+
+	// AzureKeyVaultSecretReport, only set when reports are enabled
+	azureKeyVaultSecretReportLister listers.AzureKeyVaultSecretReportLister
 
 	// CA Bundle
-	caBundleSecretQueue         *queue.Worker
+	caBundleSecretQueue         *queueWorker
 	caBundleSecretName          string
 	caBundleSecretNamespaceName string
 	caBundleConfigMapName       string
 
 	// Namespace
 	namespaceLister corelisters.NamespaceLister
-	namespaceQueue  *queue.Worker
+	namespaceQueue  *queueWorker
+
+	// Pod indexed by the Secrets they use, only set when tracking consumers
+	podIndexer cache.Indexer
 
 	// ConfigMap
 	configMapLister corelisters.ConfigMapLister
-	configMapQueue  *queue.Worker
-
-	options *Options
-	clock   Timer
+	configMapQueue  *queueWorker
+
+	// ClusterTrustBundles written by trust bundle outputs
+	clusterTrustBundles clusterTrustBundleClient
+
+	// Clients for other clusters written to by cluster outputs
+	remoteClusters *remoteClusterClients
+
+	options        *Options
+	azureFrequency AzurePollFrequency
+	clock          Clock
+
+	vaultFailures *failureCounter
+	vaultCircuits *circuitBreaker
+	probedVaults  map[vaultProbe]bool
+	taggingDenied map[string]bool
+	timedOutSyncs *timedOutSyncs
+	rotations     *rotationTracker
+	rollouts      *rolloutTracker
+	statusLimiter *rate.Limiter
+	auditLog      *log.Logger
+
+	// Whether certificates were last synced without their private key, as it is not exportable
+	publicCertificates *publicCertificates
+
+	// Latest credential check of each credential set
+	credentialHealth *credentialHealthTracker
+
+	// inFlight is the number of syncs in progress, and workersRunning is 1 when workers
+	// have been started. Both are accessed atomically.
+	inFlight       int32
+	workersRunning int32
 }
 
 // Options contains options for the controller
 type Options struct {
-	NumThreads     int
+	// NumThreads is the number of workers for each of the Kubernetes queues
+	NumThreads int
+
+	// AzureNumThreads is the number of workers polling Azure Key Vault. If zero NumThreads is used
+	AzureNumThreads int
+
 	MaxNumRequeues int
 	ResyncPeriod   time.Duration
 	AkvsRef        corev1.ObjectReference
+
+	// RateLimiter controls retries of failed items in the Kubernetes queues
+	RateLimiter RateLimiterOptions
+
+	// AzureRateLimiter controls retries of failed items in the Azure Key Vault queue
+	AzureRateLimiter RateLimiterOptions
+
+	// CircuitBreakerThreshold is the number of consecutive failures against an Azure Key Vault before
+	// requests for all AzureKeyVaultSecrets using it fail fast. Zero disables the circuit breaker.
+	CircuitBreakerThreshold int
+
+	// CircuitBreakerProbeInterval is the time to wait before probing a failing Azure Key Vault again
+	CircuitBreakerProbeInterval time.Duration
+
+	// DegradedThreshold is the number of failures in a row getting a AzureKeyVaultSecret from Azure Key Vault
+	// before it is marked as Degraded and only polled every DegradedRetryInterval. Zero disables it.
+	DegradedThreshold int
+
+	// DegradedRetryInterval is the time between polls of Degraded AzureKeyVaultSecrets
+	DegradedRetryInterval time.Duration
+
+	// LeaderElection enables leader election when set, making only the elected replica process queues
+	LeaderElection *LeaderElectionOptions
+
+	// Namespaces limits the namespaces handled by the controller
+	Namespaces NamespaceFilter
+
+	// Shard limits the AzureKeyVaultSecrets handled by the controller to a subset, when running multiple active replicas
+	Shard ShardOptions
+
+	// StatusUpdateQPS is the maximum number of AzureKeyVaultSecret status updates per second, with
+	// bursts of up to StatusUpdateBurst. Zero disables the limit.
+	StatusUpdateQPS   float64
+	StatusUpdateBurst int
+
+	// SyncTimeout is the maximum time to wait for a single sync before retrying it. Zero disables it.
+	SyncTimeout time.Duration
+
+	// StartupReconcileParallelism is the number of AzureKeyVaultSecrets synced with their Secrets at a time
+	// by the reconciliation pass before the Kubernetes queues are started. Zero disables the pass.
+	StartupReconcileParallelism int
+
+	// ShutdownTimeout is the time to wait for queued and in progress syncs to finish on shutdown
+	ShutdownTimeout time.Duration
+
+	// DryRun only reports changes to Secrets and AzureKeyVaultSecret status as Events, without making them
+	DryRun bool
+
+	// RepairDrift restores Secrets changed outside of the controller. If false they are only
+	// reported using the Drifted condition
+	RepairDrift bool
+
+	// OrphanedSecretPolicy decides what to do with Secrets created by the controller whose
+	// AzureKeyVaultSecret no longer owns them. Empty disables looking for orphaned Secrets
+	OrphanedSecretPolicy OrphanedSecretPolicy
+
+	// OrphanedSecretInterval is how often to look for orphaned Secrets
+	OrphanedSecretInterval time.Duration
+
+	// ReportInterval is how often to update the AzureKeyVaultSecretReport of each namespace. Zero disables reports.
+	ReportInterval time.Duration
+
+	// RotationAnomaly warns about secrets rotating far more often than they have before
+	RotationAnomaly RotationAnomalyOptions
+
+	// VaultProbeInterval is how often to probe every Azure Key Vault referenced by AzureKeyVaultSecrets,
+	// setting their VaultReachable condition. Zero disables probing.
+	VaultProbeInterval time.Duration
+
+	// CredentialCheckInterval is how often to check that Azure accepts the credentials of every credential
+	// set used by AzureKeyVaultSecrets, setting their CredentialsHealthy condition. Zero disables the check.
+	CredentialCheckInterval time.Duration
+
+	// CredentialCheckEvents records an event on AzureKeyVaultSecrets when Azure starts rejecting their credentials
+	CredentialCheckEvents bool
+
+	// MetadataTagsInterval is how often to tag the Azure Key Vault object of every synced AzureKeyVaultSecret
+	// with the cluster, namespace and name of the AzureKeyVaultSecret and when it was last synced, letting
+	// vault owners see who consumes each object. Requires permission to update the objects. Zero disables tagging.
+	MetadataTagsInterval time.Duration
+
+	// ClusterName is the name of the cluster tagged on Azure Key Vault objects
+	ClusterName string
+
+	// VaultQuota counts the requests made to each Azure Key Vault, and is checked every window for vaults
+	// at QuotaWarningThreshold of their limit, setting the QuotaNearLimit condition. Nil disables it.
+	VaultQuota *vault.QuotaTracker
+
+	// QuotaWarningThreshold is the fraction of the request limit of a vault used before warning about it
+	QuotaWarningThreshold float64
+
+	// ReportExpiryWindow is how long before a certificate expires it is reported as expiring
+	ReportExpiryWindow time.Duration
+
+	// AuditLog receives a JSON line for every Secret created, updated or deleted by the controller.
+	// Nil disables the audit log.
+	AuditLog io.Writer
+
+	// Identity identifies this controller replica in the audit log, like the pod name
+	Identity string
+
+	// ControllerID identifies the controller installation, and is stamped on the Secrets it writes using
+	// ControllerAnnotation. Secrets stamped by another installation or shard are not changed. Empty disables it.
+	ControllerID string
+
+	// RolloutOnRotation annotates the pod template of Deployments referencing a Secret using
+	// ReloadSecretsAnnotation with a checksum of the Secret, rolling them out when it is rotated
+	RolloutOnRotation bool
+
+	// Rollout stages the rollout of Deployments when RolloutOnRotation is enabled
+	Rollout RolloutOptions
+
+	// TrackConsumers lists the workloads with pods using the output Secret in the status of each
+	// AzureKeyVaultSecret. Requires watching all pods.
+	TrackConsumers bool
+
+	// SecretEvents also records rotation and adoption Events on the output Secret, so teams only
+	// watching their Secret see what happened to it without knowing about AzureKeyVaultSecrets
+	SecretEvents bool
+
+	// VaultDefaults applies AzureKeyVaultDefaults to the AzureKeyVaultSecrets of their namespace. Only
+	// set when the AzureKeyVaultDefault CRD is installed, as its informer would never sync otherwise.
+	VaultDefaults bool
+
+	// VaultPolicies enforces AzureKeyVaultPolicies. Only set when the AzureKeyVaultPolicy CRD is installed,
+	// as its informer would never sync otherwise. Without it all Azure Key Vaults are allowed, like in the
+	// webhook, and no trust bundles.
+	VaultPolicies bool
+
+	// TrustBundles enables spec.output.trustBundle, writing certificates to every namespace and to
+	// ClusterTrustBundles, for AzureKeyVaultSecrets in namespaces allowed by a AzureKeyVaultPolicy
+	TrustBundles bool
+
+	// Notifiers are sent a Notification when a Secret is rotated or a AzureKeyVaultSecret is degraded
+	Notifiers []Notifier
+
+	// Clock is used for polling, back off, rotation tracking and other decisions depending on time.
+	// The system clock is used when nil.
+	Clock Clock
+}
+
+// newStatusLimiter returns a rate limiter for status updates, or nil if qps is zero or less
+func newStatusLimiter(qps float64, burst int) *rate.Limiter {
+	if qps <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(qps), burst)
 }
 
 // AzurePollFrequency controls time durations to wait between polls to Azure Key Vault for changes
@@ -129,15 +663,57 @@ type AzurePollFrequency struct {
 
 	// Slow is the time duration to wait between polls to Azure Key Vault for changes, after MaxFailuresBeforeSlowingDown is reached
 	Slow time.Duration
+
+	// Jitter is the maximum fraction of Normal added to the time between polls of each AzureKeyVaultSecret,
+	// spreading polls of AzureKeyVaultSecrets created at the same time
+	Jitter float64
 }
 
-// NewController returns a new AzureKeyVaultSecret controller
-func NewController(client kubernetes.Interface, akvsClient akvcs.Interface, akvInformerFactory akvInformers.SharedInformerFactory, kubeInformerFactory informers.SharedInformerFactory, recorder record.EventRecorder, vaultService vault.Service, namespaceAkvsLabel string, azureFrequency AzurePollFrequency, options *Options) *Controller {
+// Option changes how NewController sets up the controller, on top of the given Options
+type Option func(*Controller)
+
+// WithWorkers sets the number of workers for each of the Kubernetes queues, overriding Options.NumThreads
+func WithWorkers(workers int) Option {
+	return func(c *Controller) {
+		c.options.NumThreads = workers
+	}
+}
+
+// WithRecorder sets the recorder used for Events, instead of the one given to NewController
+func WithRecorder(recorder record.EventRecorder) Option {
+	return func(c *Controller) {
+		c.recorder = recorder
+	}
+}
+
+// WithVaultClient sets the service getting objects from Azure Key Vault, instead of the one given to NewController
+func WithVaultClient(vaultService vault.Service) Option {
+	return func(c *Controller) {
+		c.vaultService = vaultService
+	}
+}
+
+// WithClock sets the clock used for decisions depending on time, overriding Options.Clock
+func WithClock(clock Clock) Option {
+	return func(c *Controller) {
+		c.options.Clock = clock
+	}
+}
+
+// NewController returns a new AzureKeyVaultSecret controller. Options may be nil, using the zero Options,
+// and are copied before opts are applied, so the caller's Options are never changed.
+func NewController(client kubernetes.Interface, akvsClient akvcs.Interface, akvInformerFactory akvInformers.SharedInformerFactory, kubeInformerFactory informers.SharedInformerFactory, recorder record.EventRecorder, vaultService vault.Service, namespaceAkvsLabel string, azureFrequency AzurePollFrequency, options *Options, opts ...Option) *Controller {
 	// Create event broadcaster
 	// Add azure-keyvault-controller types to the default Kubernetes Scheme so Events can be
 	// logged for azure-keyvault-controller types.
 	utilruntime.Must(keyvaultScheme.AddToScheme(scheme.Scheme))
 
+	optionsCopy := Options{}
+	if options != nil {
+		optionsCopy = *options
+	}
+	options = &optionsCopy
+
 	controller := &Controller{
 		kubeclientset:      client,
 		akvsClient:         akvsClient,
@@ -152,20 +728,66 @@ func NewController(client kubernetes.Interface, akvsClient akvcs.Interface, akvI
 		azureKeyVaultSecretLister: akvInformerFactory.Keyvault().V2alpha1().AzureKeyVaultSecrets().Lister(),
 		configMapLister:           kubeInformerFactory.Core().V1().ConfigMaps().Lister(),
 		namespaceLister:           kubeInformerFactory.Core().V1().Namespaces().Lister(),
+		clusterTrustBundles:       &restClusterTrustBundleClient{discovery: client.Discovery()},
+		remoteClusters:            newRemoteClusterClients(),
+
+		options:        options,
+		azureFrequency: azureFrequency,
+
+		vaultFailures: newFailureCounter(),
+		timedOutSyncs: newTimedOutSyncs(),
+		rotations:     newRotationTracker(),
+		rollouts:      newRolloutTracker(),
+		statusLimiter: newStatusLimiter(options.StatusUpdateQPS, options.StatusUpdateBurst),
+		auditLog:      newAuditLogger(options.AuditLog),
+		probedVaults:  map[vaultProbe]bool{},
+		taggingDenied: map[string]bool{},
+
+		credentialHealth: newCredentialHealthTracker(),
 
-		options: options,
-		clock:   &Clock{},
+		publicCertificates: newPublicCertificates(),
 	}
 
-	controller.akvsCrdQueue = queue.New("AzureKeyVaultSecrets", options.MaxNumRequeues, options.NumThreads, controller.syncAzureKeyVaultSecret)
-	controller.akvsSecretQueue = queue.New("Secrets", options.MaxNumRequeues, options.NumThreads, controller.syncSecret)
-	controller.azureKeyVaultQueue = queue.New("AzureKeyVault", options.MaxNumRequeues, options.NumThreads, controller.syncAzureKeyVault)
-	controller.caBundleSecretQueue = queue.New("CABundleSecrets", options.MaxNumRequeues, options.NumThreads, controller.syncCABundleSecret)
-	controller.namespaceQueue = queue.New("Namespaces", options.MaxNumRequeues, options.NumThreads, controller.syncNamespace)
+	for _, opt := range opts {
+		opt(controller)
+	}
+
+	controller.clock = &RealClock{}
+	if options.Clock != nil {
+		controller.clock = options.Clock
+	}
+	controller.vaultCircuits = newCircuitBreaker(options.CircuitBreakerThreshold, options.CircuitBreakerProbeInterval, controller.clock)
+
+	controller.akvsCrdQueue = newQueueWorker("AzureKeyVaultSecrets", options.RateLimiter.newRateLimiter(), options.MaxNumRequeues, options.NumThreads, controller.trackInFlight(controller.withSyncTimeout("AzureKeyVaultSecrets", controller.azureKeyVaultSecretForKey, controller.syncAzureKeyVaultSecret)))
+	controller.akvsSecretQueue = newQueueWorker("Secrets", options.RateLimiter.newRateLimiter(), options.MaxNumRequeues, options.NumThreads, controller.trackInFlight(controller.withSyncTimeout("Secrets", nil, controller.syncSecret)))
+	azureNumThreads := options.AzureNumThreads
+	if azureNumThreads <= 0 {
+		azureNumThreads = options.NumThreads
+	}
+	controller.azureKeyVaultQueue = newQueueWorker("AzureKeyVault", options.AzureRateLimiter.newRateLimiter(), options.MaxNumRequeues, azureNumThreads, controller.trackInFlight(controller.withSyncTimeout("AzureKeyVault", controller.azureKeyVaultSecretForKey, controller.syncAzureKeyVault)))
+	controller.caBundleSecretQueue = newQueueWorker("CABundleSecrets", options.RateLimiter.newRateLimiter(), options.MaxNumRequeues, options.NumThreads, controller.trackInFlight(controller.withSyncTimeout("CABundleSecrets", nil, controller.syncCABundleSecret)))
+	controller.namespaceQueue = newQueueWorker("Namespaces", options.RateLimiter.newRateLimiter(), options.MaxNumRequeues, options.NumThreads, controller.trackInFlight(controller.withSyncTimeout("Namespaces", nil, controller.syncNamespace)))
 
 	log.Info("Setting up event handlers")
 	controller.initAzureKeyVaultSecret()
+	// Informers are only created for AzureKeyVaultDefaults and AzureKeyVaultPolicies when enabled, as
+	// waiting for the caches to sync in Run would block forever without their CRDs
+	if options.VaultDefaults {
+		controller.azureKeyVaultDefaultLister = akvInformerFactory.Keyvault().V2alpha1().AzureKeyVaultDefaults().Lister()
+		controller.initVaultDefaults()
+	}
+	if options.VaultPolicies {
+		controller.azureKeyVaultPolicyLister = akvInformerFactory.Keyvault().V2alpha1().AzureKeyVaultPolicies().Lister()
+		controller.initVaultPolicies()
+	}
 	controller.initSecret()
+	controller.initTrustBundle()
+	if options.TrackConsumers {
+		controller.initConsumers()
+	}
+	if options.ReportInterval > 0 {
+		controller.initReports()
+	}
 
 	return controller
 }
@@ -193,22 +815,60 @@ func (c *Controller) Run(stopCh <-chan struct{}) {
 		}
 	}
 
+	if c.options.LeaderElection != nil {
+		if c.options.LeaderElection.AzurePollingOnly {
+			log.Info("Reconciling Kubernetes resources on all replicas, polling Azure Key Vault only when leader")
+			c.runKubernetesWorkers(stopCh)
+		}
+		if err := c.runWithLeaderElection(stopCh); err != nil {
+			runtime.HandleError(errors.Wrap(err, "failed to run leader election"))
+		}
+	} else {
+		c.runWorkers(stopCh)
+		<-stopCh
+	}
+
+	log.Info("Shutting down workers")
+	c.drain(c.options.ShutdownTimeout)
+}
+
+// runWorkers starts processing items from the queues until stopCh is closed
+func (c *Controller) runWorkers(stopCh <-chan struct{}) {
+	c.runKubernetesWorkers(stopCh)
+	c.runAzureWorkers(stopCh)
+	log.Info("Started workers")
+}
+
+// runKubernetesWorkers reconciles every AzureKeyVaultSecret with its Secret once, and then starts
+// processing items from the queues reconciling Kubernetes resources until stopCh is closed
+func (c *Controller) runKubernetesWorkers(stopCh <-chan struct{}) {
+	atomic.StoreInt32(&c.workersRunning, 1)
+	c.reconcileAtStartup(stopCh)
+
 	log.Info("Starting Azure Key Vault Secret queue")
 	c.akvsCrdQueue.Run(stopCh)
 
 	log.Info("Starting Secret queue for Azure Key Vault Secrets")
 	c.akvsSecretQueue.Run(stopCh)
 
-	log.Info("Starting Azure Key Vault queue")
-	c.azureKeyVaultQueue.Run(stopCh)
-
 	log.Info("Starting Namespace queue")
 	c.namespaceQueue.Run(stopCh)
 
 	log.Info("Starting CA Bundle queue")
 	c.caBundleSecretQueue.Run(stopCh)
+}
 
-	log.Info("Started workers")
-	<-stopCh
-	log.Info("Shutting down workers")
+// runAzureWorkers starts polling, probing and tagging Azure Key Vault, checking credentials and its quota, looking for orphaned Secrets and updating reports until stopCh is closed
+func (c *Controller) runAzureWorkers(stopCh <-chan struct{}) {
+	atomic.StoreInt32(&c.workersRunning, 1)
+
+	log.Info("Starting Azure Key Vault queue")
+	c.azureKeyVaultQueue.Run(stopCh)
+	c.runAzurePolling(stopCh)
+	c.runOrphanedSecretSweeper(stopCh)
+	c.runReporter(stopCh)
+	c.runVaultProber(stopCh)
+	c.runCredentialCheck(stopCh)
+	c.runMetadataTagger(stopCh)
+	c.runQuotaCheck(stopCh)
 }
@@ -0,0 +1,1141 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	goerrors "errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client/fake"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	akvsfake "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/client/clientset/versioned/fake"
+	akvInformers "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/client/informers/externalversions"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+const testVaultName = "test-name-vault-name"
+
+type fixture struct {
+	t *testing.T
+
+	kubeClient *k8sfake.Clientset
+	akvsClient *akvsfake.Clientset
+	vault      *fake.Service
+	recorder   *record.FakeRecorder
+
+	kubeInformerFactory kubeinformers.SharedInformerFactory
+	akvsInformerFactory akvInformers.SharedInformerFactory
+
+	controller *Controller
+}
+
+func newFixture(t *testing.T) *fixture {
+	f := &fixture{
+		t:          t,
+		kubeClient: k8sfake.NewSimpleClientset(),
+		akvsClient: akvsfake.NewSimpleClientset(),
+		vault:      fake.NewService(),
+		recorder:   record.NewFakeRecorder(100),
+	}
+
+	f.kubeInformerFactory = kubeinformers.NewSharedInformerFactory(f.kubeClient, 0)
+	f.akvsInformerFactory = akvInformers.NewSharedInformerFactory(f.akvsClient, 0)
+
+	f.controller = NewController(
+		f.kubeClient,
+		f.akvsClient,
+		f.akvsInformerFactory,
+		f.kubeInformerFactory,
+		f.recorder,
+		f.vault,
+		"azure-key-vault-env-injection",
+		AzurePollFrequency{MaxFailuresBeforeSlowingDown: 3},
+		&Options{MaxNumRequeues: 1, NumThreads: 1, VaultDefaults: true, VaultPolicies: true})
+	return f
+}
+
+// addAzureKeyVaultSecret creates the AzureKeyVaultSecret in the fake clientset and informer cache
+func (f *fixture) addAzureKeyVaultSecret(azureKeyVaultSecret *akv.AzureKeyVaultSecret) {
+	created, err := f.akvsClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(azureKeyVaultSecret.Namespace).Create(azureKeyVaultSecret)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	if err = f.akvsInformerFactory.Keyvault().V2alpha1().AzureKeyVaultSecrets().Informer().GetIndexer().Add(created); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+// refresh updates the informer caches with the latest objects from the fake clientsets,
+// like the informers would when watching the cluster
+func (f *fixture) refresh(azureKeyVaultSecret *akv.AzureKeyVaultSecret) {
+	latest, err := f.akvsClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(azureKeyVaultSecret.Namespace).Get(azureKeyVaultSecret.Name, metav1.GetOptions{})
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	if err = f.akvsInformerFactory.Keyvault().V2alpha1().AzureKeyVaultSecrets().Informer().GetIndexer().Update(latest); err != nil {
+		f.t.Fatal(err)
+	}
+
+	secrets, err := f.kubeClient.CoreV1().Secrets(azureKeyVaultSecret.Namespace).List(metav1.ListOptions{})
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	indexer := f.kubeInformerFactory.Core().V1().Secrets().Informer().GetIndexer()
+	for i := range secrets.Items {
+		if err = indexer.Update(&secrets.Items[i]); err != nil {
+			f.t.Fatal(err)
+		}
+	}
+}
+
+func (f *fixture) getSecret(namespace, name string) *corev1.Secret {
+	secret, err := f.kubeClient.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return secret
+}
+
+func (f *fixture) getAzureKeyVaultSecret(namespace, name string) *akv.AzureKeyVaultSecret {
+	azureKeyVaultSecret, err := f.akvsClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return azureKeyVaultSecret
+}
+
+// expectEvent checks that an event with the given reason has been recorded
+func (f *fixture) expectEvent(reason string) {
+	for {
+		select {
+		case event := <-f.recorder.Events:
+			if strings.Contains(event, reason) {
+				return
+			}
+		case <-time.After(100 * time.Millisecond):
+			f.t.Errorf("expected event with reason '%s'", reason)
+			return
+		}
+	}
+}
+
+func azureKeyVaultSecretWithOutput() *akv.AzureKeyVaultSecret {
+	akvs := secret()
+	akvs.Spec.Vault.Object.Name = "my-secret"
+	akvs.Spec.Output.Secret.Name = "my-kubernetes-secret"
+	akvs.Spec.Output.Secret.DataKey = "value"
+	return akvs
+}
+
+func key(azureKeyVaultSecret *akv.AzureKeyVaultSecret) string {
+	return fmt.Sprintf("%s/%s", azureKeyVaultSecret.Namespace, azureKeyVaultSecret.Name)
+}
+
+func TestNewControllerWithOptions(t *testing.T) {
+	f := newFixture(t)
+	vaultService := fake.NewService()
+	vaultService.SetSecret(testVaultName, "my-secret", "option-value")
+	recorder := record.NewFakeRecorder(100)
+	clock := newFakeClock(time.Now())
+	options := &Options{MaxNumRequeues: 1, NumThreads: 1}
+
+	c := NewController(f.kubeClient, f.akvsClient, f.akvsInformerFactory, f.kubeInformerFactory, f.recorder, f.vault,
+		"azure-key-vault-env-injection", AzurePollFrequency{}, options,
+		WithWorkers(4), WithRecorder(recorder), WithVaultClient(vaultService), WithClock(clock))
+
+	if c.akvsCrdQueue.threadiness != 4 || c.azureKeyVaultQueue.threadiness != 4 {
+		t.Errorf("expected 4 workers per queue, got %d and %d", c.akvsCrdQueue.threadiness, c.azureKeyVaultQueue.threadiness)
+	}
+	if c.clock != clock {
+		t.Error("expected controller to use the clock from WithClock")
+	}
+	if options.NumThreads != 1 || options.Clock != nil {
+		t.Error("expected the given Options not to be changed")
+	}
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+	f.recorder = recorder
+	f.controller = c
+
+	if err := c.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	secret := f.getSecret(akvs.Namespace, "my-kubernetes-secret")
+	if string(secret.Data["value"]) != "option-value" {
+		t.Errorf("expected secret value from the WithVaultClient service 'option-value', got '%s'", string(secret.Data["value"]))
+	}
+	f.expectEvent(SuccessSynced)
+}
+
+func TestNewControllerWithoutOptions(t *testing.T) {
+	f := newFixture(t)
+	c := NewController(f.kubeClient, f.akvsClient, f.akvsInformerFactory, f.kubeInformerFactory, f.recorder, f.vault,
+		"azure-key-vault-env-injection", AzurePollFrequency{}, nil)
+	if c.options == nil {
+		t.Fatal("expected zero Options when none are given")
+	}
+	if _, ok := c.clock.(*RealClock); !ok {
+		t.Errorf("expected the system clock by default, got %T", c.clock)
+	}
+}
+
+func TestSyncCreatesSecret(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+
+	secret := f.getSecret(akvs.Namespace, "my-kubernetes-secret")
+	if string(secret.Data["value"]) != "first-value" {
+		t.Errorf("expected secret value 'first-value', got '%s'", string(secret.Data["value"]))
+	}
+	if !metav1.IsControlledBy(secret, f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name)) {
+		t.Error("expected secret to be controlled by AzureKeyVaultSecret")
+	}
+	f.expectEvent(SuccessSynced)
+}
+
+func TestSyncRotatesSecret(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+
+	// Unchanged version in Azure Key Vault should not download the value again
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+	downloads := f.vault.Calls("GetSecret")
+
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+	if f.vault.Calls("GetSecret") != downloads {
+		t.Errorf("expected no download of unchanged secret, got %d new downloads", f.vault.Calls("GetSecret")-downloads)
+	}
+
+	version := f.vault.SetSecret(testVaultName, "my-secret", "second-value")
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+
+	secret := f.getSecret(akvs.Namespace, "my-kubernetes-secret")
+	if string(secret.Data["value"]) != "second-value" {
+		t.Errorf("expected rotated secret value 'second-value', got '%s'", string(secret.Data["value"]))
+	}
+
+	status := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status
+	if status.ObjectVersion != version {
+		t.Errorf("expected status object version '%s', got '%s'", version, status.ObjectVersion)
+	}
+	if status.SecretHash != getMD5Hash(secret.Data) {
+		t.Error("expected status secret hash to match rotated secret")
+	}
+}
+
+func TestSyncHandlerPaths(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup prepares the fixture and returns the AzureKeyVaultSecret to sync
+		setup func(f *fixture) *akv.AzureKeyVaultSecret
+		// sync runs the handler under test
+		sync      func(f *fixture, key string) error
+		err       error
+		event     string
+		value     string
+		noSecrets bool
+	}{
+		{
+			name: "not found",
+			setup: func(f *fixture) *akv.AzureKeyVaultSecret {
+				// Deleted before the queued key was handled
+				return azureKeyVaultSecretWithOutput()
+			},
+			sync:      (*fixture).syncAzureKeyVaultSecret,
+			noSecrets: true,
+		},
+		{
+			name: "exists unowned",
+			setup: func(f *fixture) *akv.AzureKeyVaultSecret {
+				f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+				f.addExistingSecret("my-kubernetes-secret", map[string][]byte{"value": []byte("unowned-value")})
+				akvs := azureKeyVaultSecretWithOutput()
+				f.addAzureKeyVaultSecret(akvs)
+				return akvs
+			},
+			sync:  (*fixture).syncAzureKeyVaultSecret,
+			err:   ErrOutputConflict,
+			event: ErrResourceExists,
+			value: "unowned-value",
+		},
+		{
+			name: "create",
+			setup: func(f *fixture) *akv.AzureKeyVaultSecret {
+				f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+				akvs := azureKeyVaultSecretWithOutput()
+				f.addAzureKeyVaultSecret(akvs)
+				return akvs
+			},
+			sync:  (*fixture).syncAzureKeyVaultSecret,
+			event: SuccessSynced,
+			value: "first-value",
+		},
+		{
+			name: "rotate",
+			setup: func(f *fixture) *akv.AzureKeyVaultSecret {
+				f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+				akvs := azureKeyVaultSecretWithOutput()
+				f.addAzureKeyVaultSecret(akvs)
+				if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+					f.t.Fatal(err)
+				}
+				f.refresh(akvs)
+				f.drainEvents()
+				f.vault.SetSecret(testVaultName, "my-secret", "second-value")
+				return akvs
+			},
+			sync:  (*fixture).syncAzureKeyVault,
+			event: SuccessSynced,
+			value: "second-value",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newFixture(t)
+			akvs := test.setup(f)
+
+			err := test.sync(f, key(akvs))
+			if test.err == nil && err != nil {
+				t.Fatalf("expected no error, got '%v'", err)
+			}
+			if test.err != nil && !goerrors.Is(err, test.err) {
+				t.Fatalf("expected error '%v', got '%v'", test.err, err)
+			}
+
+			if test.event != "" {
+				f.expectEvent(test.event)
+			} else {
+				f.expectNoEvents()
+			}
+
+			secrets, err := f.kubeClient.CoreV1().Secrets(akvs.Namespace).List(metav1.ListOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.noSecrets {
+				if len(secrets.Items) != 0 {
+					t.Errorf("expected no Secrets, got %d", len(secrets.Items))
+				}
+				return
+			}
+			if secret := f.getSecret(akvs.Namespace, "my-kubernetes-secret"); string(secret.Data["value"]) != test.value {
+				t.Errorf("expected secret value '%s', got '%s'", test.value, string(secret.Data["value"]))
+			}
+		})
+	}
+}
+
+func (f *fixture) syncAzureKeyVaultSecret(key string) error {
+	return f.controller.syncAzureKeyVaultSecret(key)
+}
+
+func (f *fixture) syncAzureKeyVault(key string) error {
+	return f.controller.syncAzureKeyVault(key)
+}
+
+func TestSyncAzureKeyVaultFailure(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+
+	f.vault.SetError(testVaultName, "secret", "my-secret", fmt.Errorf("vault unavailable"))
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err == nil {
+		t.Error("expected error when Azure Key Vault fails")
+	}
+	f.expectEvent(ErrAzureVault)
+
+	secret := f.getSecret(akvs.Namespace, "my-kubernetes-secret")
+	if string(secret.Data["value"]) != "first-value" {
+		t.Errorf("expected secret value to be kept when Azure Key Vault fails, got '%s'", string(secret.Data["value"]))
+	}
+}
+
+func TestSyncAzureKeyVaultFailureIncludesRequestIDs(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+
+	resp := &http.Response{StatusCode: http.StatusInternalServerError, Header: http.Header{}}
+	resp.Header.Set("x-ms-request-id", "some-request-id")
+	f.vault.SetError(testVaultName, "secret", "my-secret", autorest.DetailedError{StatusCode: http.StatusInternalServerError, Response: resp})
+
+	err := f.controller.syncAzureKeyVault(key(akvs))
+	if err == nil || !strings.Contains(err.Error(), "some-request-id") {
+		t.Errorf("expected error to contain Azure request id, got %+v", err)
+	}
+	f.expectEvent("x-ms-request-id: 'some-request-id'")
+}
+
+func TestSyncSoftDeletedSecret(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+
+	f.vault.Delete(testVaultName, "secret", "my-secret")
+	// Backing off instead of failing, so it is not retried by the queue rate limiter
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Error(err)
+	}
+	f.expectEvent(ErrAzureVaultSoftDeleted)
+
+	status := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status
+	if !isConditionTrue(&status, akv.AzureKeyVaultSecretConditionSoftDeleted) {
+		t.Error("expected SoftDeleted condition to be true")
+	}
+}
+
+func TestSyncFallbackVault(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+	f.vault.SetSecret("fallback-vault", "my-secret", "fallback-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Spec.Vault.Fallback = "fallback-vault"
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+
+	f.vault.SetError(testVaultName, "secret", "my-secret", fmt.Errorf("vault unavailable"))
+	for i := 0; i < f.controller.azureFrequency.MaxFailuresBeforeSlowingDown-1; i++ {
+		if err := f.controller.syncAzureKeyVault(key(akvs)); err == nil {
+			t.Fatal("expected error before falling back")
+		}
+	}
+
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+
+	secret := f.getSecret(akvs.Namespace, "my-kubernetes-secret")
+	if string(secret.Data["value"]) != "fallback-value" {
+		t.Errorf("expected secret value from fallback vault, got '%s'", string(secret.Data["value"]))
+	}
+	if vaultName := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status.VaultName; vaultName != "fallback-vault" {
+		t.Errorf("expected status vault name 'fallback-vault', got '%s'", vaultName)
+	}
+	f.expectEvent(AzureVaultFallback)
+}
+
+func TestSyncSecretIgnoresUnknownOwner(t *testing.T) {
+	f := newFixture(t)
+
+	// The owning AzureKeyVaultSecret is not in the informer cache, like when excluded by --crd-label-selector
+	akvs := azureKeyVaultSecretWithOutput()
+	secret := createNewSecret(akvs, map[string][]byte{"value": []byte("first-value")})
+	if err := f.kubeInformerFactory.Core().V1().Secrets().Informer().GetIndexer().Add(secret); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.controller.syncSecret(fmt.Sprintf("%s/%s", secret.Namespace, secret.Name)); err != nil {
+		t.Errorf("expected Secret with unknown owner to be ignored, got error: %+v", err)
+	}
+}
+
+func TestSyncAzureKeyVaultFailureBacksOff(t *testing.T) {
+	f := newFixture(t)
+	f.controller.azureFrequency.Normal = time.Minute
+	f.controller.azureFrequency.Slow = 5 * time.Minute
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+
+	f.vault.SetError(testVaultName, "secret", "my-secret", fmt.Errorf("vault unavailable"))
+	for i := 0; i < 2; i++ {
+		if err := f.controller.syncAzureKeyVault(key(akvs)); err == nil {
+			t.Fatal("expected error when Azure Key Vault fails")
+		}
+		f.refresh(akvs)
+	}
+
+	failed := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name)
+	if failed.Status.RetryCount != 2 {
+		t.Errorf("expected status retry count 2, got %d", failed.Status.RetryCount)
+	}
+	if !f.controller.isBackingOff(failed) {
+		t.Error("expected AzureKeyVaultSecret to be backing off")
+	}
+	if delay := time.Until(failed.Status.NextRetryTime.Time); delay <= time.Minute || delay > 2*time.Minute {
+		t.Errorf("expected next retry in about 2 minutes, got %s", delay)
+	}
+
+	f.vault.SetError(testVaultName, "secret", "my-secret", nil)
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+
+	recovered := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name)
+	if recovered.Status.RetryCount != 0 || f.controller.isBackingOff(recovered) {
+		t.Error("expected retry count to be cleared after successful sync")
+	}
+}
+
+// editSecret changes the data of the Secret outside of the controller
+func (f *fixture) editSecret(namespace, name string, data map[string][]byte) {
+	secret := f.getSecret(namespace, name)
+	secret.Data = data
+	if _, err := f.kubeClient.CoreV1().Secrets(namespace).Update(secret); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+func TestSyncRepairsDriftedSecret(t *testing.T) {
+	f := newFixture(t)
+	f.controller.options.RepairDrift = true
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+
+	f.editSecret(akvs.Namespace, "my-kubernetes-secret", map[string][]byte{"value": []byte("edited-value")})
+	f.refresh(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+
+	secret := f.getSecret(akvs.Namespace, "my-kubernetes-secret")
+	if string(secret.Data["value"]) != "first-value" {
+		t.Errorf("expected drifted secret to be restored to 'first-value', got '%s'", string(secret.Data["value"]))
+	}
+	f.expectEvent(SecretDriftRepaired)
+}
+
+func TestSyncReportsDriftedSecret(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+
+	f.editSecret(akvs.Namespace, "my-kubernetes-secret", map[string][]byte{"value": []byte("edited-value")})
+	f.refresh(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.expectEvent(SecretDrifted)
+
+	secret := f.getSecret(akvs.Namespace, "my-kubernetes-secret")
+	if string(secret.Data["value"]) != "edited-value" {
+		t.Errorf("expected drifted secret to be kept when drift repair is disabled, got '%s'", string(secret.Data["value"]))
+	}
+	status := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status
+	if !isConditionTrue(&status, akv.AzureKeyVaultSecretConditionDrifted) {
+		t.Error("expected Drifted condition to be true")
+	}
+}
+
+func TestRecreateDeletedSecret(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+
+	secret := f.getSecret(akvs.Namespace, "my-kubernetes-secret")
+	if err := f.kubeClient.CoreV1().Secrets(akvs.Namespace).Delete(secret.Name, &metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.kubeInformerFactory.Core().V1().Secrets().Informer().GetIndexer().Delete(secret); err != nil {
+		t.Fatal(err)
+	}
+
+	f.controller.recreateDeletedSecret(secret)
+	f.expectEvent(SecretDeleted)
+	if length := f.controller.akvsCrdQueue.GetQueue().Len(); length != 1 {
+		t.Fatalf("expected AzureKeyVaultSecret to be queued, got queue length %d", length)
+	}
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	if recreated := f.getSecret(akvs.Namespace, "my-kubernetes-secret"); string(recreated.Data["value"]) != "first-value" {
+		t.Errorf("expected recreated secret value 'first-value', got '%s'", string(recreated.Data["value"]))
+	}
+}
+
+func TestSyncRotationKeepsForeignAnnotations(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+
+	secret := f.getSecret(akvs.Namespace, "my-kubernetes-secret")
+	secret.Annotations = map[string]string{"other-tool/checksum": "abc"}
+	if _, err := f.kubeClient.CoreV1().Secrets(akvs.Namespace).Update(secret); err != nil {
+		t.Fatal(err)
+	}
+
+	f.vault.SetSecret(testVaultName, "my-secret", "second-value")
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := f.getSecret(akvs.Namespace, "my-kubernetes-secret")
+	if string(rotated.Data["value"]) != "second-value" {
+		t.Errorf("expected rotated secret value 'second-value', got '%s'", string(rotated.Data["value"]))
+	}
+	if rotated.Annotations["other-tool/checksum"] != "abc" {
+		t.Error("expected annotation added by other tool to be kept after rotation")
+	}
+	if !metav1.IsControlledBy(rotated, f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name)) {
+		t.Error("expected secret to still be controlled by AzureKeyVaultSecret")
+	}
+}
+
+func TestSyncDryRun(t *testing.T) {
+	f := newFixture(t)
+	f.controller.options.DryRun = true
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.expectEvent("Dry run: would create Secret 'my-kubernetes-secret' with keys: value")
+
+	if _, err := f.kubeClient.CoreV1().Secrets(akvs.Namespace).Get("my-kubernetes-secret", metav1.GetOptions{}); err == nil {
+		t.Error("expected no secret to be created in dry run mode")
+	}
+	if status := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status; status.SecretHash != "" {
+		t.Error("expected status not to be updated in dry run mode")
+	}
+}
+
+func TestDiffSecretData(t *testing.T) {
+	current := map[string][]byte{"unchanged": []byte("a"), "changed": []byte("b"), "removed": []byte("c")}
+	desired := map[string][]byte{"unchanged": []byte("a"), "changed": []byte("B"), "added": []byte("d")}
+
+	if changed := formatKeys(diffSecretData(current, desired)); changed != "added, changed, removed" {
+		t.Errorf("expected changed keys 'added, changed, removed', got '%s'", changed)
+	}
+}
+
+// expectNoEvents checks that no events have been recorded since last checked
+func (f *fixture) expectNoEvents() {
+	select {
+	case event := <-f.recorder.Events:
+		f.t.Errorf("expected no events, got '%s'", event)
+	default:
+	}
+}
+
+// drainEvents discards all events recorded so far
+func (f *fixture) drainEvents() {
+	for {
+		select {
+		case <-f.recorder.Events:
+		default:
+			return
+		}
+	}
+}
+
+func TestSyncOnlyRecordsEventsOnTransitions(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+	f.expectEvent(SuccessSynced)
+	f.drainEvents()
+
+	// Nothing changed
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+	f.expectNoEvents()
+
+	// Failing repeatedly
+	f.vault.SetError(testVaultName, "secret", "my-secret", fmt.Errorf("vault unavailable"))
+	for i := 0; i < 2; i++ {
+		if err := f.controller.syncAzureKeyVault(key(akvs)); err == nil {
+			t.Fatal("expected error when Azure Key Vault fails")
+		}
+	}
+	f.expectEvent(ErrAzureVault)
+	f.expectNoEvents()
+
+	// Recovered
+	f.vault.SetError(testVaultName, "secret", "my-secret", nil)
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.expectEvent(AzureVaultRecovered)
+}
+
+// stripOwnerReferences removes the owner references of the Secret, like a restore from backup would
+func (f *fixture) stripOwnerReferences(namespace, name string) {
+	secret := f.getSecret(namespace, name)
+	secret.OwnerReferences = nil
+	updated, err := f.kubeClient.CoreV1().Secrets(namespace).Update(secret)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	if err = f.kubeInformerFactory.Core().V1().Secrets().Informer().GetIndexer().Update(updated); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+func TestSweepAdoptsOrphanedSecret(t *testing.T) {
+	f := newFixture(t)
+	f.controller.options.OrphanedSecretPolicy = OrphanedSecretPolicyAdopt
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.UID = "restored-uid"
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+	f.drainEvents()
+
+	if secret := f.getSecret(akvs.Namespace, "my-kubernetes-secret"); secret.Labels[ManagedSecretLabel] != "true" {
+		t.Fatalf("expected secret to be labeled '%s', got labels %v", ManagedSecretLabel, secret.Labels)
+	} else if secret.Annotations[OwnerAnnotation] != akvs.Name {
+		t.Fatalf("expected secret to be annotated with owner '%s', got annotations %v", akvs.Name, secret.Annotations)
+	}
+
+	f.stripOwnerReferences(akvs.Namespace, "my-kubernetes-secret")
+	f.controller.sweepOrphanedSecrets()
+
+	f.expectEvent(SecretAdopted)
+	if secret := f.getSecret(akvs.Namespace, "my-kubernetes-secret"); !metav1.IsControlledBy(secret, akvs) {
+		t.Errorf("expected secret to be controlled by AzureKeyVaultSecret again, got owners %v", secret.OwnerReferences)
+	}
+	if length := f.controller.akvsCrdQueue.GetQueue().Len(); length != 1 {
+		t.Errorf("expected AzureKeyVaultSecret to be queued, got queue length %d", length)
+	}
+}
+
+func TestSweepDeletesOrphanedSecret(t *testing.T) {
+	orphan := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "orphan",
+			Namespace: "default",
+			Labels:    map[string]string{ManagedSecretLabel: "true"},
+		},
+	}
+
+	for _, policy := range []OrphanedSecretPolicy{OrphanedSecretPolicyAdopt, OrphanedSecretPolicyDelete} {
+		t.Run(string(policy), func(t *testing.T) {
+			f := newFixture(t)
+			f.controller.options.OrphanedSecretPolicy = policy
+
+			created, err := f.kubeClient.CoreV1().Secrets(orphan.Namespace).Create(orphan.DeepCopy())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = f.kubeInformerFactory.Core().V1().Secrets().Informer().GetIndexer().Add(created); err != nil {
+				t.Fatal(err)
+			}
+
+			f.controller.sweepOrphanedSecrets()
+
+			_, err = f.kubeClient.CoreV1().Secrets(orphan.Namespace).Get(orphan.Name, metav1.GetOptions{})
+			if deleted := errors.IsNotFound(err); deleted != (policy == OrphanedSecretPolicyDelete) {
+				t.Errorf("expected orphaned secret deleted to be %t with policy '%s', got %t", policy == OrphanedSecretPolicyDelete, policy, deleted)
+			}
+		})
+	}
+}
+
+func TestSweepSkipsSecretWithMultipleOwners(t *testing.T) {
+	f := newFixture(t)
+	f.controller.options.OrphanedSecretPolicy = OrphanedSecretPolicyAdopt
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+	f.drainEvents()
+
+	other := azureKeyVaultSecretWithOutput()
+	other.Name = "other-akvs"
+	other.UID = "other-uid"
+	f.addAzureKeyVaultSecret(other)
+
+	f.stripOwnerReferences(akvs.Namespace, "my-kubernetes-secret")
+	f.controller.sweepOrphanedSecrets()
+
+	if secret := f.getSecret(akvs.Namespace, "my-kubernetes-secret"); len(secret.OwnerReferences) != 0 {
+		t.Errorf("expected secret with multiple AzureKeyVaultSecrets having it as output not to be adopted, got owners %v", secret.OwnerReferences)
+	}
+	if length := f.controller.akvsCrdQueue.GetQueue().Len(); length != 0 {
+		t.Errorf("expected no AzureKeyVaultSecret to be queued, got queue length %d", length)
+	}
+}
+
+func TestSweepDeletesOrphanedSecretOfOwnShard(t *testing.T) {
+	shard := ShardOptions{Count: 2}
+	if !shard.Owns("default", "owner-in-shard") {
+		shard.Ordinal = 1
+	}
+	// The owner of another shard decides, even if the Secret name alone would be in this shard
+	otherOwner := ""
+	for i := 0; otherOwner == ""; i++ {
+		if name := fmt.Sprintf("owner-%d", i); !shard.Owns("default", name) {
+			otherOwner = name
+		}
+	}
+
+	tests := []struct {
+		name          string
+		owner         string
+		expectDeleted bool
+	}{
+		{name: "owner in shard", owner: "owner-in-shard", expectDeleted: true},
+		{name: "owner in other shard", owner: otherOwner, expectDeleted: false},
+		{name: "no owner annotation", owner: "", expectDeleted: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newFixture(t)
+			f.controller.options.OrphanedSecretPolicy = OrphanedSecretPolicyDelete
+			f.controller.options.Shard = shard
+
+			orphan := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "orphan",
+					Namespace: "default",
+					Labels:    map[string]string{ManagedSecretLabel: "true"},
+				},
+			}
+			if test.owner != "" {
+				orphan.Annotations = map[string]string{OwnerAnnotation: test.owner}
+			}
+
+			created, err := f.kubeClient.CoreV1().Secrets(orphan.Namespace).Create(orphan)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = f.kubeInformerFactory.Core().V1().Secrets().Informer().GetIndexer().Add(created); err != nil {
+				t.Fatal(err)
+			}
+
+			f.controller.sweepOrphanedSecrets()
+
+			_, err = f.kubeClient.CoreV1().Secrets(orphan.Namespace).Get(orphan.Name, metav1.GetOptions{})
+			if deleted := errors.IsNotFound(err); deleted != test.expectDeleted {
+				t.Errorf("expected orphaned secret deleted to be %t, got %t", test.expectDeleted, deleted)
+			}
+		})
+	}
+}
+
+func TestSyncAzureKeyVaultHonorsRetryAfter(t *testing.T) {
+	f := newFixture(t)
+	f.controller.azureFrequency.Normal = time.Minute
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+	resp.Header.Set("Retry-After", "600")
+	f.vault.SetError(testVaultName, "secret", "my-secret", autorest.DetailedError{StatusCode: http.StatusTooManyRequests, Response: resp})
+
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatalf("expected throttled sync to be requeued without error, got %v", err)
+	}
+
+	throttled := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name)
+	if delay := time.Until(throttled.Status.NextRetryTime.Time); delay <= 9*time.Minute || delay > 10*time.Minute {
+		t.Errorf("expected next retry in 10 minutes as asked by Azure Key Vault, got %s", delay)
+	}
+	if length := f.controller.azureKeyVaultQueue.GetQueue().Len(); length != 0 {
+		t.Errorf("expected AzureKeyVaultSecret not to be requeued before Retry-After, got queue length %d", length)
+	}
+}
+
+func TestSyncAzureKeyVaultDegradesAfterThreshold(t *testing.T) {
+	f := newFixture(t)
+	f.controller.options.DegradedThreshold = 2
+	f.controller.options.DegradedRetryInterval = time.Hour
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+
+	f.vault.SetError(testVaultName, "secret", "my-secret", fmt.Errorf("vault unavailable"))
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err == nil {
+		t.Fatal("expected error when Azure Key Vault fails")
+	}
+	f.refresh(akvs)
+	f.drainEvents()
+
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatalf("expected degraded AzureKeyVaultSecret not to be retried by the queue, got %v", err)
+	}
+	f.expectEvent(AzureKeyVaultSecretDegraded)
+
+	degraded := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name)
+	if !isConditionTrue(&degraded.Status, akv.AzureKeyVaultSecretConditionDegraded) {
+		t.Error("expected Degraded condition to be true")
+	}
+	if delay := time.Until(degraded.Status.NextRetryTime.Time); delay <= 59*time.Minute || delay > time.Hour {
+		t.Errorf("expected next retry in an hour, got %s", delay)
+	}
+
+	forced := degraded.DeepCopy()
+	forced.Annotations = map[string]string{ForceSyncAnnotation: "now"}
+	if !shouldResumePolling(degraded, forced) {
+		t.Error("expected changing the force-sync annotation to resume polling")
+	}
+	if shouldResumePolling(degraded, degraded.DeepCopy()) {
+		t.Error("expected status updates not to resume polling")
+	}
+}
+
+func TestMutateStatusSkipsUnchangedStatus(t *testing.T) {
+	f := newFixture(t)
+	f.controller.statusLimiter = newStatusLimiter(1000, 1)
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	countUpdates := func() int {
+		updates := 0
+		for _, action := range f.akvsClient.Actions() {
+			if action.GetVerb() == "update" && action.GetSubresource() == "status" {
+				updates++
+			}
+		}
+		return updates
+	}
+
+	if err := f.controller.mutateAzureKeyVaultSecretStatus(akvs, func(status *akv.AzureKeyVaultSecretStatus) {}); err != nil {
+		t.Fatal(err)
+	}
+	if updates := countUpdates(); updates != 0 {
+		t.Errorf("expected unchanged status not to be written, got %d updates", updates)
+	}
+
+	if err := f.controller.mutateAzureKeyVaultSecretStatus(akvs, func(status *akv.AzureKeyVaultSecretStatus) {
+		status.RetryCount = 1
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if updates := countUpdates(); updates != 1 {
+		t.Errorf("expected changed status to be written, got %d updates", updates)
+	}
+}
+
+func TestSecretChangesAreAudited(t *testing.T) {
+	f := newFixture(t)
+	var audit bytes.Buffer
+	f.controller.auditLog = newAuditLogger(&audit)
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+
+	version := f.vault.SetSecret(testVaultName, "my-secret", "second-value")
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(audit.String(), "first-value") || strings.Contains(audit.String(), "second-value") {
+		t.Fatal("expected audit log to never contain secret values")
+	}
+
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(audit.String()), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("expected audit record to be JSON, got %q", line)
+		}
+		records = append(records, record)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("expected 2 audit records, got %d: %s", len(records), audit.String())
+	}
+	if records[0]["action"] != string(AuditActionCreate) || records[0]["secret"] != "my-kubernetes-secret" {
+		t.Errorf("expected first record to be creation of secret, got %v", records[0])
+	}
+	if records[1]["action"] != string(AuditActionUpdate) || records[1]["objectVersion"] != version {
+		t.Errorf("expected second record to be update to version '%s', got %v", version, records[1])
+	}
+}
+
+func TestSyncRollsOutDeploymentsUsingRotatedSecret(t *testing.T) {
+	f := newFixture(t)
+	f.controller.options.RolloutOnRotation = true
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	for _, deployment := range []*appsv1.Deployment{
+		{ObjectMeta: metav1.ObjectMeta{Name: "consumer", Namespace: akvs.Namespace, Annotations: map[string]string{ReloadSecretsAnnotation: "other-secret, my-kubernetes-secret"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "unrelated", Namespace: akvs.Namespace}},
+	} {
+		if _, err := f.kubeClient.AppsV1().Deployments(deployment.Namespace).Create(deployment); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+
+	f.vault.SetSecret(testVaultName, "my-secret", "second-value")
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+
+	secretHash := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status.SecretHash
+	consumer, err := f.kubeClient.AppsV1().Deployments(akvs.Namespace).Get("consumer", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checksum := consumer.Spec.Template.Annotations["checksum/akvs-my-kubernetes-secret"]; checksum != secretHash {
+		t.Errorf("expected pod template checksum '%s', got '%s'", secretHash, checksum)
+	}
+
+	unrelated, err := f.kubeClient.AppsV1().Deployments(akvs.Namespace).Get("unrelated", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unrelated.Spec.Template.Annotations) != 0 {
+		t.Errorf("expected deployment not referencing secret to be left alone, got %v", unrelated.Spec.Template.Annotations)
+	}
+	f.expectEvent(DeploymentRolledOut)
+}
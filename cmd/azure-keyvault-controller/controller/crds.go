@@ -0,0 +1,40 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/discovery"
+)
+
+// ServedResources returns the resources of the AzureKeyVault API served by the cluster, like
+// azurekeyvaultdefaults, as informers for resources whose CRD is not installed never sync
+func ServedResources(client discovery.DiscoveryInterface) (map[string]bool, error) {
+	served := map[string]bool{}
+	resources, err := client.ServerResourcesForGroupVersion(akv.SchemeGroupVersion.String())
+	if errors.IsNotFound(err) {
+		return served, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, resource := range resources.APIResources {
+		served[resource.Name] = true
+	}
+	return served, nil
+}
@@ -0,0 +1,40 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestServedResources(t *testing.T) {
+	client := k8sfake.NewSimpleClientset()
+	client.Resources = []*metav1.APIResourceList{
+		{GroupVersion: akv.SchemeGroupVersion.String(), APIResources: []metav1.APIResource{{Name: "azurekeyvaultsecrets"}, {Name: "azurekeyvaultdefaults"}}},
+	}
+
+	served, err := ServedResources(client.Discovery())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !served["azurekeyvaultdefaults"] || served["azurekeyvaultpolicies"] {
+		t.Errorf("expected only served resources, got %v", served)
+	}
+}
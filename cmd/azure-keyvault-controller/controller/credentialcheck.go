@@ -0,0 +1,195 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// credentialsAuthenticatedReason is the reason of the CredentialsHealthy condition when Azure accepts the credentials
+	credentialsAuthenticatedReason = "Authenticated"
+
+	// credentialsUnverifiedReason is the reason of the CredentialsHealthy condition when the check failed for
+	// other reasons than the credentials, like the vault not being reachable
+	credentialsUnverifiedReason = "Unverified"
+)
+
+// credentialHealth is the result of the latest check of the credentials of a credential set,
+// with the default credentials as credential set ""
+type credentialHealth struct {
+	CredentialSet string                 `json:"credentialSet"`
+	Vault         string                 `json:"vault"`
+	Status        corev1.ConditionStatus `json:"status"`
+	Reason        string                 `json:"reason"`
+	Message       string                 `json:"message"`
+	LastCheck     metav1.Time            `json:"lastCheck"`
+}
+
+// credentialHealthTracker keeps the latest check of each credential set, read by the admin API
+type credentialHealthTracker struct {
+	mutex   sync.Mutex
+	results map[string]credentialHealth
+}
+
+func newCredentialHealthTracker() *credentialHealthTracker {
+	return &credentialHealthTracker{results: map[string]credentialHealth{}}
+}
+
+// set replaces the results with the results of the latest checks
+func (t *credentialHealthTracker) set(results map[string]credentialHealth) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.results = results
+}
+
+// list returns the latest check of each credential set, ordered by credential set
+func (t *credentialHealthTracker) list() []credentialHealth {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	results := make([]credentialHealth, 0, len(t.results))
+	for _, result := range t.results {
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].CredentialSet < results[j].CredentialSet })
+	return results
+}
+
+// runCredentialCheck checks the credentials at once and then every CredentialCheckInterval until stopCh is closed
+func (c *Controller) runCredentialCheck(stopCh <-chan struct{}) {
+	if c.options.CredentialCheckInterval <= 0 {
+		return
+	}
+	go runUntil(c.clock, c.checkCredentials, c.options.CredentialCheckInterval, stopCh)
+}
+
+// checkCredentials checks the credentials of every credential set used by the AzureKeyVaultSecrets handled
+// by this replica, by getting a token and making a request to one of the vaults it is used with. The
+// CredentialsHealthy condition of each AzureKeyVaultSecret is set to the result, so credentials rejected
+// by Azure are found before the next rotation is missed.
+func (c *Controller) checkCredentials() {
+	azureKeyVaultSecrets, err := c.azureKeyVaultSecretLister.List(labels.Everything())
+	if err != nil {
+		log.Errorf("failed to list AzureKeyVaultSecrets for checking credentials: %v", err)
+		return
+	}
+
+	referencedBy := map[string][]*akv.AzureKeyVaultSecret{}
+	vaults := map[string]string{}
+	for _, azureKeyVaultSecret := range azureKeyVaultSecrets {
+		if !c.isHandled(azureKeyVaultSecret.Namespace, azureKeyVaultSecret.Name) {
+			continue
+		}
+		probe, ok := c.vaultProbeFor(azureKeyVaultSecret)
+		if !ok {
+			continue
+		}
+		referencedBy[probe.credentialSet] = append(referencedBy[probe.credentialSet], azureKeyVaultSecret)
+		// Always checking with the same vault, so results do not change with the order of the list
+		if vaultName, found := vaults[probe.credentialSet]; !found || probe.vaultName < vaultName {
+			vaults[probe.credentialSet] = probe.vaultName
+		}
+	}
+
+	now := c.clock.Now()
+	results := make(map[string]credentialHealth, len(referencedBy))
+	for credentialSet, referencing := range referencedBy {
+		vaultSpec := &akv.AzureKeyVault{
+			Name:          vaults[credentialSet],
+			CredentialSet: credentialSet,
+			Object:        akv.AzureKeyVaultObject{Type: akv.AzureKeyVaultObjectTypeSecret},
+		}
+		result := credentialCheckResult(vaultSpec, c.vaultService.Probe(vaultSpec))
+		result.LastCheck = now
+		results[credentialSet] = result
+		observeCredentialCheck(credentialSet, result.Status)
+		if result.Status != corev1.ConditionTrue {
+			log.WithFields(log.Fields{"credentialSet": credentialSet, "vault": vaultSpec.Name, "reason": result.Reason}).Warning(result.Message)
+		}
+
+		for _, azureKeyVaultSecret := range referencing {
+			c.updateCredentialsHealthyCondition(azureKeyVaultSecret, result)
+		}
+	}
+
+	for _, previous := range c.credentialHealth.list() {
+		if _, ok := results[previous.CredentialSet]; !ok {
+			deleteCredentialCheckMetrics(previous.CredentialSet)
+		}
+	}
+	c.credentialHealth.set(results)
+}
+
+// credentialCheckResult returns the result of checking the credentials of the credential set of vaultSpec.
+// Requests denied by Azure Key Vault were authenticated, so the credentials are accepted then.
+func credentialCheckResult(vaultSpec *akv.AzureKeyVault, err error) credentialHealth {
+	result := credentialHealth{CredentialSet: vaultSpec.CredentialSet, Vault: vaultSpec.Name}
+	_, forbidden := vault.AsForbidden(err)
+	switch {
+	case err == nil || forbidden:
+		result.Status, result.Reason = corev1.ConditionTrue, credentialsAuthenticatedReason
+		result.Message = fmt.Sprintf(MessageCredentialsHealthy, credentialSetName(vaultSpec.CredentialSet), vaultSpec.Name)
+	case vault.IsAuthenticationFailure(err):
+		result.Status, result.Reason = corev1.ConditionFalse, vaultAuthenticationFailedReason
+		result.Message = fmt.Sprintf(MessageCredentialsRejected, credentialSetName(vaultSpec.CredentialSet), vaultSpec.Name, err.Error())
+	default:
+		result.Status, result.Reason = corev1.ConditionUnknown, credentialsUnverifiedReason
+		result.Message = fmt.Sprintf(MessageCredentialsUnverified, credentialSetName(vaultSpec.CredentialSet), vaultSpec.Name, err.Error())
+	}
+	return result
+}
+
+// credentialSetName returns the name of the credential set for messages
+func credentialSetName(credentialSet string) string {
+	if credentialSet == "" {
+		return "default credentials"
+	}
+	return fmt.Sprintf("credential set '%s'", credentialSet)
+}
+
+// updateCredentialsHealthyCondition sets the CredentialsHealthy condition of the AzureKeyVaultSecret, recording
+// an event when the credentials become rejected if CredentialCheckEvents is set
+func (c *Controller) updateCredentialsHealthyCondition(azureKeyVaultSecret *akv.AzureKeyVaultSecret, result credentialHealth) {
+	if c.options.CredentialCheckEvents && result.Status == corev1.ConditionFalse {
+		previous := getCondition(&azureKeyVaultSecret.Status, akv.AzureKeyVaultSecretConditionCredentialsHealthy)
+		if previous == nil || previous.Status != corev1.ConditionFalse {
+			c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, ErrAzureCredentialsRejected, result.Message)
+		}
+	}
+
+	err := c.mutateAzureKeyVaultSecretStatus(azureKeyVaultSecret, func(status *akv.AzureKeyVaultSecretStatus) {
+		setCondition(status, akv.AzureKeyVaultSecretCondition{
+			Type:    akv.AzureKeyVaultSecretConditionCredentialsHealthy,
+			Status:  result.Status,
+			Reason:  result.Reason,
+			Message: result.Message,
+		}, result.LastCheck)
+	})
+	if err != nil {
+		newLogger(azureKeyVaultSecret).WithError(err).Error("failed to update CredentialsHealthy condition of AzureKeyVaultSecret")
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func (f *fixture) expectCredentialsHealthy(azureKeyVaultSecret *akv.AzureKeyVaultSecret, status corev1.ConditionStatus, reason string) {
+	akvsStatus := f.getAzureKeyVaultSecret(azureKeyVaultSecret.Namespace, azureKeyVaultSecret.Name).Status
+	condition := getCondition(&akvsStatus, akv.AzureKeyVaultSecretConditionCredentialsHealthy)
+	if condition == nil || condition.Status != status || condition.Reason != reason {
+		f.t.Errorf("expected CredentialsHealthy condition %s with reason %s for '%s', got %+v", status, reason, azureKeyVaultSecret.Name, condition)
+	}
+}
+
+func TestCheckCredentials(t *testing.T) {
+	f := newFixture(t)
+	f.controller.options.CredentialCheckEvents = true
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+	f.controller.checkCredentials()
+	f.expectCredentialsHealthy(akvs, corev1.ConditionTrue, credentialsAuthenticatedReason)
+	if value := testutil.ToFloat64(credentialsHealthy.WithLabelValues("")); value != 1 {
+		t.Errorf("expected credentials_healthy 1, got %v", value)
+	}
+
+	// Denied by the vault, but authenticated
+	f.refresh(akvs)
+	f.vault.SetProbeError(testVaultName, forbiddenError("ForbiddenByRbac", "Caller is not authorized to perform action on resource."))
+	f.controller.checkCredentials()
+	f.expectCredentialsHealthy(akvs, corev1.ConditionTrue, credentialsAuthenticatedReason)
+
+	f.refresh(akvs)
+	f.vault.SetProbeError(testVaultName, autorest.DetailedError{StatusCode: http.StatusUnauthorized})
+	f.controller.checkCredentials()
+	f.expectEvent(ErrAzureCredentialsRejected)
+	f.expectCredentialsHealthy(akvs, corev1.ConditionFalse, vaultAuthenticationFailedReason)
+	if value := testutil.ToFloat64(credentialsHealthy.WithLabelValues("")); value != 0 {
+		t.Errorf("expected credentials_healthy 0, got %v", value)
+	}
+
+	// Still rejected, so not recorded again
+	f.refresh(akvs)
+	f.controller.checkCredentials()
+	f.expectNoEvents()
+
+	f.refresh(akvs)
+	f.vault.SetProbeError(testVaultName, errors.New("dial tcp: lookup my-vault.vault.azure.net: no such host"))
+	f.controller.checkCredentials()
+	f.expectCredentialsHealthy(akvs, corev1.ConditionUnknown, credentialsUnverifiedReason)
+}
+
+func TestCheckCredentialsWithoutEvents(t *testing.T) {
+	f := newFixture(t)
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+	f.vault.SetProbeError(testVaultName, autorest.DetailedError{StatusCode: http.StatusUnauthorized})
+	f.controller.checkCredentials()
+	f.expectCredentialsHealthy(akvs, corev1.ConditionFalse, vaultAuthenticationFailedReason)
+	f.expectNoEvents()
+}
+
+func TestCheckCredentialsOncePerCredentialSet(t *testing.T) {
+	f := newFixture(t)
+
+	first := azureKeyVaultSecretWithOutput()
+	second := azureKeyVaultSecretWithOutput()
+	second.Name = "second"
+	second.Spec.Vault.Name = "other-vault"
+	f.addAzureKeyVaultSecret(first)
+	f.addAzureKeyVaultSecret(second)
+
+	f.controller.checkCredentials()
+	if calls := f.vault.Calls("Probe"); calls != 1 {
+		t.Errorf("expected default credentials to be checked once, got %d checks", calls)
+	}
+	f.expectCredentialsHealthy(second, corev1.ConditionTrue, credentialsAuthenticatedReason)
+
+	rec := adminRequest(f.controller, http.MethodGet, "/api/v1/credentials", "admin-token")
+	var results []credentialHealth
+	if err := json.NewDecoder(rec.Body).Decode(&results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Vault != "other-vault" || results[0].Status != corev1.ConditionTrue {
+		t.Errorf("expected default credentials checked with 'other-vault', got %+v", results)
+	}
+}
@@ -0,0 +1,208 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// trackedQueue keeps track of the keys waiting in and being processed from a queue, and the
+// last error syncing each key, so they can be inspected when investigating stuck workers
+type trackedQueue struct {
+	workqueue.RateLimitingInterface
+
+	mutex      sync.Mutex
+	waiting    map[interface{}]time.Time
+	processing map[interface{}]time.Time
+	lastErrors map[interface{}]trackedError
+}
+
+// trackedError is the last error syncing a key, and when it happened
+type trackedError struct {
+	Error string    `json:"error"`
+	Time  time.Time `json:"time"`
+}
+
+func newTrackedQueue(queue workqueue.RateLimitingInterface) *trackedQueue {
+	return &trackedQueue{
+		RateLimitingInterface: queue,
+		waiting:               make(map[interface{}]time.Time),
+		processing:            make(map[interface{}]time.Time),
+		lastErrors:            make(map[interface{}]trackedError),
+	}
+}
+
+func (q *trackedQueue) markWaiting(item interface{}) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if _, ok := q.waiting[item]; !ok {
+		q.waiting[item] = time.Now()
+	}
+}
+
+// Add adds the item to the queue
+func (q *trackedQueue) Add(item interface{}) {
+	q.markWaiting(item)
+	q.RateLimitingInterface.Add(item)
+}
+
+// AddAfter adds the item to the queue after the duration has passed
+func (q *trackedQueue) AddAfter(item interface{}, duration time.Duration) {
+	q.markWaiting(item)
+	q.RateLimitingInterface.AddAfter(item, duration)
+}
+
+// AddRateLimited adds the item to the queue when the rate limiter allows it
+func (q *trackedQueue) AddRateLimited(item interface{}) {
+	q.markWaiting(item)
+	q.RateLimitingInterface.AddRateLimited(item)
+}
+
+// Get blocks until an item can be processed
+func (q *trackedQueue) Get() (interface{}, bool) {
+	item, shutdown := q.RateLimitingInterface.Get()
+	if shutdown {
+		return item, shutdown
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	delete(q.waiting, item)
+	q.processing[item] = time.Now()
+	return item, shutdown
+}
+
+// Done marks the item as processed
+func (q *trackedQueue) Done(item interface{}) {
+	q.mutex.Lock()
+	delete(q.processing, item)
+	q.mutex.Unlock()
+
+	q.RateLimitingInterface.Done(item)
+}
+
+// recordError keeps the error of syncing the item, or clears it if the sync succeeded
+func (q *trackedQueue) recordError(item interface{}, err error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if err == nil {
+		delete(q.lastErrors, item)
+		return
+	}
+	q.lastErrors[item] = trackedError{Error: err.Error(), Time: time.Now()}
+}
+
+// lastError returns the last error syncing the item, if its last sync failed
+func (q *trackedQueue) lastError(item interface{}) (trackedError, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	lastError, ok := q.lastErrors[item]
+	return lastError, ok
+}
+
+// queuePosition is where a key is in a queue, where position 1 is the key waiting the longest
+type queuePosition struct {
+	Queue    string  `json:"queue"`
+	State    string  `json:"state"`
+	Position int     `json:"position,omitempty"`
+	Seconds  float64 `json:"seconds"`
+}
+
+// position returns where the item is in the queue, if waiting or being processed
+func (q *trackedQueue) position(name string, item interface{}) (queuePosition, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	now := time.Now()
+	if since, ok := q.processing[item]; ok {
+		return queuePosition{Queue: name, State: "processing", Seconds: now.Sub(since).Seconds()}, true
+	}
+
+	since, ok := q.waiting[item]
+	if !ok {
+		return queuePosition{}, false
+	}
+
+	position := 1
+	for other, otherSince := range q.waiting {
+		if other != item && !otherSince.After(since) {
+			position++
+		}
+	}
+	return queuePosition{Queue: name, State: "waiting", Position: position, Seconds: now.Sub(since).Seconds()}, true
+}
+
+// queueSnapshot is the keys of a queue at a point in time
+type queueSnapshot struct {
+	Name       string       `json:"name"`
+	Length     int          `json:"length"`
+	Waiting    []trackedKey `json:"waiting"`
+	Processing []trackedKey `json:"processing"`
+}
+
+// trackedKey is a key in a queue, and the number of seconds since it was added or started processing
+type trackedKey struct {
+	Key     string  `json:"key"`
+	Seconds float64 `json:"seconds"`
+}
+
+func (q *trackedQueue) snapshot(name string) queueSnapshot {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	now := time.Now()
+	return queueSnapshot{
+		Name:       name,
+		Length:     q.Len(),
+		Waiting:    trackedKeys(q.waiting, now),
+		Processing: trackedKeys(q.processing, now),
+	}
+}
+
+// trackedKeys returns the keys sorted by longest waiting or processing first
+func trackedKeys(items map[interface{}]time.Time, now time.Time) []trackedKey {
+	keys := []trackedKey{}
+	for item, since := range items {
+		keys = append(keys, trackedKey{Key: fmt.Sprintf("%v", item), Seconds: now.Sub(since).Seconds()})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Seconds > keys[j].Seconds
+	})
+	return keys
+}
+
+// QueuesHandler serves a JSON snapshot of the keys waiting in and being processed from each queue
+func (c *Controller) QueuesHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var snapshots []queueSnapshot
+		for _, q := range c.queues() {
+			snapshots = append(snapshots, q.queue.snapshot(q.name))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(snapshots); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
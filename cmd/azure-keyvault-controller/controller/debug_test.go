@@ -0,0 +1,55 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestQueuesHandler(t *testing.T) {
+	f := newFixture(t)
+
+	f.controller.azureKeyVaultQueue.GetQueue().Add("default/waiting")
+	f.controller.azureKeyVaultQueue.GetQueue().Add("default/processing")
+	if key, _ := f.controller.azureKeyVaultQueue.GetQueue().Get(); key != "default/waiting" {
+		t.Fatalf("expected to get first key added, got %v", key)
+	}
+
+	recorder := httptest.NewRecorder()
+	f.controller.QueuesHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/queues", nil))
+
+	var snapshots []queueSnapshot
+	if err := json.Unmarshal(recorder.Body.Bytes(), &snapshots); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, snapshot := range snapshots {
+		if snapshot.Name != "AzureKeyVault" {
+			continue
+		}
+		if len(snapshot.Waiting) != 1 || snapshot.Waiting[0].Key != "default/processing" {
+			t.Errorf("expected 'default/processing' to be waiting, got %v", snapshot.Waiting)
+		}
+		if len(snapshot.Processing) != 1 || snapshot.Processing[0].Key != "default/waiting" {
+			t.Errorf("expected 'default/waiting' to be processing, got %v", snapshot.Processing)
+		}
+		return
+	}
+	t.Error("expected snapshot of AzureKeyVault queue")
+}
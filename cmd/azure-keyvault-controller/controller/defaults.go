@@ -0,0 +1,98 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	"kmodules.xyz/client-go/tools/queue"
+)
+
+// initVaultDefaults syncs the AzureKeyVaultSecrets of a namespace again when its AzureKeyVaultDefault changes
+func (c *Controller) initVaultDefaults() {
+	c.akvsInformerFactory.Keyvault().V2alpha1().AzureKeyVaultDefaults().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.enqueueVaultDefaultsNamespace,
+		UpdateFunc: func(old, new interface{}) {
+			// Periodic resync will send update events for all known AzureKeyVaultDefaults
+			if old.(*akv.AzureKeyVaultDefault).ResourceVersion == new.(*akv.AzureKeyVaultDefault).ResourceVersion {
+				return
+			}
+			c.enqueueVaultDefaultsNamespace(new)
+		},
+		DeleteFunc: c.enqueueVaultDefaultsNamespace,
+	})
+}
+
+func (c *Controller) enqueueVaultDefaultsNamespace(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		log.Errorf("failed to get key of AzureKeyVaultDefault: %v", err)
+		return
+	}
+	namespace, _, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil || !c.options.Namespaces.Includes(namespace) {
+		return
+	}
+
+	azureKeyVaultSecrets, err := c.azureKeyVaultSecretLister.AzureKeyVaultSecrets(namespace).List(labels.Everything())
+	if err != nil {
+		log.Errorf("failed to list AzureKeyVaultSecrets in namespace %s: %v", namespace, err)
+		return
+	}
+
+	for _, azureKeyVaultSecret := range azureKeyVaultSecrets {
+		if c.akvsHasSecretOutput(azureKeyVaultSecret) && c.isHandled(azureKeyVaultSecret.Namespace, azureKeyVaultSecret.Name) {
+			newLogger(azureKeyVaultSecret).Debug("AzureKeyVaultDefault changed. Polling Azure Key Vault now.")
+			queue.Enqueue(c.akvsCrdQueue.GetQueue(), azureKeyVaultSecret)
+			queue.Enqueue(c.azureKeyVaultQueue.GetQueue(), azureKeyVaultSecret)
+		}
+	}
+}
+
+// applyVaultDefaults returns a copy of the AzureKeyVaultSecret with the Azure Key Vault settings
+// it does not set taken from the AzureKeyVaultDefault of its namespace, if any
+func (c *Controller) applyVaultDefaults(azureKeyVaultSecret *akv.AzureKeyVaultSecret) (*akv.AzureKeyVaultSecret, error) {
+	if c.azureKeyVaultDefaultLister == nil {
+		return azureKeyVaultSecret, nil
+	}
+	defaults, err := c.azureKeyVaultDefaultLister.AzureKeyVaultDefaults(azureKeyVaultSecret.Namespace).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	if len(defaults) > 1 {
+		msg := fmt.Sprintf(MessageMultipleVaultDefaults, azureKeyVaultSecret.Namespace, len(defaults))
+		c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, ErrVaultDefaults, msg)
+		return nil, fmt.Errorf(msg)
+	}
+
+	if len(defaults) == 1 {
+		azureKeyVaultSecret = azureKeyVaultSecret.DeepCopy()
+		defaults[0].Spec.Vault.ApplyTo(&azureKeyVaultSecret.Spec.Vault)
+	}
+
+	if azureKeyVaultSecret.Spec.Vault.Name == "" {
+		msg := fmt.Sprintf(MessageNoVaultName, azureKeyVaultSecret.Namespace)
+		c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, ErrVaultDefaults, msg)
+		return nil, fmt.Errorf(msg)
+	}
+	return azureKeyVaultSecret, nil
+}
@@ -0,0 +1,104 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func (f *fixture) addVaultDefault(name string, vault akv.AzureKeyVaultDefaultVault) {
+	vaultDefault := &akv.AzureKeyVaultDefault{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: metav1.NamespaceDefault},
+		Spec:       akv.AzureKeyVaultDefaultSpec{Vault: vault},
+	}
+	if err := f.akvsInformerFactory.Keyvault().V2alpha1().AzureKeyVaultDefaults().Informer().GetIndexer().Add(vaultDefault); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+func TestSyncUsesVaultDefaults(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "some-value")
+	f.addVaultDefault("defaults", akv.AzureKeyVaultDefaultVault{Name: testVaultName, CredentialSet: "team-a"})
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Spec.Vault.Name = ""
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	if value := string(f.getSecret(akvs.Namespace, "my-kubernetes-secret").Data["value"]); value != "some-value" {
+		t.Errorf("expected secret from default Azure Key Vault, got '%s'", value)
+	}
+
+	withDefaults, err := f.controller.getAzureKeyVaultSecret(key(akvs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if withDefaults.Spec.Vault.CredentialSet != "team-a" {
+		t.Errorf("expected default credential set, got '%s'", withDefaults.Spec.Vault.CredentialSet)
+	}
+	cached, err := f.controller.azureKeyVaultSecretLister.AzureKeyVaultSecrets(akvs.Namespace).Get(akvs.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached.Spec.Vault.Name != "" {
+		t.Errorf("expected defaults not to change the cached AzureKeyVaultSecret, got vault '%s'", cached.Spec.Vault.Name)
+	}
+}
+
+func TestVaultDefaultsDoNotOverrideAzureKeyVaultSecret(t *testing.T) {
+	vault := akv.AzureKeyVault{Name: "my-vault"}
+	defaults := akv.AzureKeyVaultDefaultVault{Name: "default-vault", Fallback: "default-fallback", CredentialSet: "team-a"}
+	defaults.ApplyTo(&vault)
+
+	if vault.Name != "my-vault" || vault.Fallback != "" || vault.CredentialSet != "team-a" {
+		t.Errorf("expected only credential set to be defaulted, got %+v", vault)
+	}
+}
+
+func TestSyncFailsWithMultipleVaultDefaults(t *testing.T) {
+	f := newFixture(t)
+	f.addVaultDefault("defaults", akv.AzureKeyVaultDefaultVault{Name: testVaultName})
+	f.addVaultDefault("more-defaults", akv.AzureKeyVaultDefaultVault{Name: "other-vault"})
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Spec.Vault.Name = ""
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err == nil {
+		t.Fatal("expected error with multiple AzureKeyVaultDefaults")
+	}
+	f.expectEvent(ErrVaultDefaults)
+}
+
+func TestSyncFailsWithoutVaultName(t *testing.T) {
+	f := newFixture(t)
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Spec.Vault.Name = ""
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err == nil {
+		t.Fatal("expected error without Azure Key Vault name")
+	}
+	f.expectEvent(ErrVaultDefaults)
+}
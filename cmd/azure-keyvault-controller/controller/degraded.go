@@ -0,0 +1,81 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ForceSyncAnnotation makes a degraded AzureKeyVaultSecret be polled from Azure Key Vault right
+// away when its value changes, like when set to the current time
+const ForceSyncAnnotation = "keyvault.azure.spv.no/force-sync"
+
+// isDegradedFailure returns true if the number of failures in a row for a AzureKeyVaultSecret has
+// reached the threshold for considering it degraded
+func (c *Controller) isDegradedFailure(failures int) bool {
+	return c.options.DegradedThreshold > 0 && failures >= c.options.DegradedThreshold
+}
+
+// degradeAzureKeyVaultSecret sets the Degraded condition on a AzureKeyVaultSecret failing too many
+// times in a row, and only polls it again after DegradedRetryInterval, unless its spec is changed
+// or it is forced to sync using ForceSyncAnnotation. This keeps failing AzureKeyVaultSecrets from
+// taking up the Azure Key Vault queue. The conditions describing the failure are updated along with Degraded.
+func (c *Controller) degradeAzureKeyVaultSecret(azureKeyVaultSecret *akv.AzureKeyVaultSecret, key string, failures int, msg string, conditions func(status *akv.AzureKeyVaultSecretStatus)) error {
+	now := c.clock.Now()
+	nextRetry := metav1.NewTime(now.Add(c.options.DegradedRetryInterval))
+	degradedMsg := fmt.Sprintf(MessageAzureKeyVaultSecretDegraded, failures, nextRetry.Format(time.RFC3339), msg)
+
+	logger := newLogger(azureKeyVaultSecret).WithField("retryCount", failures)
+	alreadyDegraded := isConditionTrue(&azureKeyVaultSecret.Status, akv.AzureKeyVaultSecretConditionDegraded)
+	if !alreadyDegraded {
+		logger.Warning(degradedMsg)
+		c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, AzureKeyVaultSecretDegraded, degradedMsg)
+		c.notify(NotificationDegraded, azureKeyVaultSecret, azureKeyVaultSecret.Status.ObjectVersion, degradedMsg)
+	}
+
+	// Not returning an error, so it is not retried by the queue rate limiter
+	c.azureKeyVaultQueue.GetQueue().Forget(key)
+	return c.mutateAzureKeyVaultSecretStatus(azureKeyVaultSecret, func(status *akv.AzureKeyVaultSecretStatus) {
+		status.RetryCount = failures
+		status.NextRetryTime = nextRetry
+		setCondition(status, akv.AzureKeyVaultSecretCondition{
+			Type:    akv.AzureKeyVaultSecretConditionDegraded,
+			Status:  corev1.ConditionTrue,
+			Reason:  AzureKeyVaultSecretDegraded,
+			Message: degradedMsg,
+		}, now)
+		conditions(status)
+	})
+}
+
+// shouldResumePolling returns true if a AzureKeyVaultSecret backing off after failures should be
+// polled from Azure Key Vault right away, because its spec changed or it was forced to sync. A
+// AzureKeyVaultSecret with a new version approved is polled right away too, to apply it.
+func shouldResumePolling(oldSecret, newSecret *akv.AzureKeyVaultSecret) bool {
+	if newSecret.Annotations[ForceSyncAnnotation] != oldSecret.Annotations[ForceSyncAnnotation] {
+		return true
+	}
+	if newSecret.Annotations[ApproveRotationAnnotation] != oldSecret.Annotations[ApproveRotationAnnotation] {
+		return true
+	}
+	return newSecret.Status.RetryCount > 0 && newSecret.Generation != oldSecret.Generation
+}
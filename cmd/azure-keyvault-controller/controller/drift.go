@@ -0,0 +1,114 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// HasSecretDrifted returns true if the data of the Secret no longer match the hash
+// of the value last synced from Azure Key Vault
+func HasSecretDrifted(azureKeyVaultSecret *akv.AzureKeyVaultSecret, secret *corev1.Secret) bool {
+	syncedHash := azureKeyVaultSecret.Status.SecretHash
+	if syncedHash == "" {
+		return false
+	}
+
+	// Only the keys owned by the AzureKeyVaultSecret are compared for bundle Secrets
+	data := secret.Data
+	if isBundle(azureKeyVaultSecret) {
+		data = getBundleData(secret, azureKeyVaultSecret.Name)
+	}
+
+	// Compare using the same hash as last synced, in case FIPS mode has been toggled since
+	if strings.HasPrefix(syncedHash, "sha256:") {
+		return getSHA256Hash(data) != syncedHash
+	}
+	return getMD5Hash(data) != syncedHash
+}
+
+// handleSecretDrift restores the Secret from Azure Key Vault if its data has been changed outside of
+// the controller, or reports it using the Drifted condition if drift repair is disabled
+func (c *Controller) handleSecretDrift(azureKeyVaultSecret *akv.AzureKeyVaultSecret, secret *corev1.Secret) error {
+	now := c.clock.Now()
+	logger := newLogger(azureKeyVaultSecret).WithField("secret", secret.Name)
+
+	if !HasSecretDrifted(azureKeyVaultSecret, secret) {
+		if !isConditionTrue(&azureKeyVaultSecret.Status, akv.AzureKeyVaultSecretConditionDrifted) {
+			return nil
+		}
+		return c.mutateAzureKeyVaultSecretStatus(azureKeyVaultSecret, func(status *akv.AzureKeyVaultSecretStatus) {
+			clearCondition(status, akv.AzureKeyVaultSecretConditionDrifted, "InSync", "Secret matches Azure Key Vault", now)
+		})
+	}
+
+	if !c.options.RepairDrift {
+		if isConditionTrue(&azureKeyVaultSecret.Status, akv.AzureKeyVaultSecretConditionDrifted) {
+			return nil
+		}
+
+		msg := fmt.Sprintf(MessageSecretDrifted, secret.Name)
+		logger.Warning(msg)
+		c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, SecretDrifted, msg)
+		return c.mutateAzureKeyVaultSecretStatus(azureKeyVaultSecret, func(status *akv.AzureKeyVaultSecretStatus) {
+			setCondition(status, akv.AzureKeyVaultSecretCondition{
+				Type:    akv.AzureKeyVaultSecretConditionDrifted,
+				Status:  corev1.ConditionTrue,
+				Reason:  SecretDrifted,
+				Message: msg,
+			}, now)
+		})
+	}
+
+	logger.Info("Secret has been changed outside of AzureKeyVaultSecret. Restoring it from Azure Key Vault.")
+	secretValue, err := c.getSecretFromKeyVault(lastSyncedObject(azureKeyVaultSecret))
+	if err != nil {
+		return fmt.Errorf("failed to get secret from Azure Key Vault to restore secret '%s'/'%s'%s, error: %w", secret.Namespace, secret.Name, formatRequestIDs(vault.RequestIDs(err)), err)
+	}
+
+	if _, err = c.patchSecret(azureKeyVaultSecret, secretValue, azureKeyVaultSecret.Status.ObjectVersion); err != nil {
+		return err
+	}
+
+	msg := fmt.Sprintf(MessageSecretDriftRepaired, secret.Name)
+	logger.Warning(msg)
+	c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, SecretDriftRepaired, msg)
+
+	secretHash := getSecretHash(secretValue)
+	return c.mutateAzureKeyVaultSecretStatus(azureKeyVaultSecret, func(status *akv.AzureKeyVaultSecretStatus) {
+		status.SecretHash = secretHash
+		clearCondition(status, akv.AzureKeyVaultSecretConditionDrifted, SecretDriftRepaired, msg, now)
+	})
+}
+
+// lastSyncedObject returns a copy of the AzureKeyVaultSecret pinned to the Azure Key Vault
+// and object version last synced, if known
+func lastSyncedObject(azureKeyVaultSecret *akv.AzureKeyVaultSecret) *akv.AzureKeyVaultSecret {
+	status := azureKeyVaultSecret.Status
+	if status.VaultName != "" && status.VaultName != azureKeyVaultSecret.Spec.Vault.Name {
+		azureKeyVaultSecret = withVaultName(azureKeyVaultSecret, status.VaultName)
+	}
+	if status.ObjectVersion == "" {
+		return azureKeyVaultSecret
+	}
+	return withObjectVersion(azureKeyVaultSecret, &vault.ObjectVersion{ID: status.ObjectVersion})
+}
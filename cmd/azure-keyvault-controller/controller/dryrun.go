@@ -0,0 +1,106 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// recordDryRun reports a change the controller would have made if not in dry run mode
+func (c *Controller) recordDryRun(azureKeyVaultSecret *akv.AzureKeyVaultSecret, msg string) {
+	newLogger(azureKeyVaultSecret).WithField("dryRun", true).Info(msg)
+	c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeNormal, DryRun, msg)
+}
+
+// createSecret creates the Secret of a AzureKeyVaultSecret, or reports it in dry run mode.
+// objectVersion is the version of the Azure Key Vault object the value is from, if known.
+func (c *Controller) createSecret(azureKeyVaultSecret *akv.AzureKeyVaultSecret, azureSecretValue map[string][]byte, objectVersion string) (*corev1.Secret, error) {
+	if isBundle(azureKeyVaultSecret) {
+		return c.updateBundleSecret(azureKeyVaultSecret, azureSecretValue, objectVersion)
+	}
+
+	if err := checkSecretSize(azureKeyVaultSecret, azureSecretValue); err != nil {
+		return nil, err
+	}
+
+	newSecret := createNewSecret(azureKeyVaultSecret, azureSecretValue)
+	newSecret.Annotations = c.withControllerAnnotation(azureKeyVaultSecret, newSecret.Annotations)
+	if c.options.DryRun {
+		c.recordDryRun(azureKeyVaultSecret, fmt.Sprintf(MessageDryRunCreateSecret, newSecret.Name, formatKeys(sortValueKeys(azureSecretValue))))
+		return newSecret, nil
+	}
+
+	data, chunks, err := c.writeSecretChunks(azureKeyVaultSecret, azureSecretValue)
+	if err != nil {
+		return nil, err
+	}
+	newSecret.Data = data
+
+	secret, err := c.kubeclientset.CoreV1().Secrets(newSecret.Namespace).Create(newSecret)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.deleteSecretChunks(azureKeyVaultSecret, secret.Name, chunks); err != nil {
+		return nil, err
+	}
+	c.auditSecret(AuditActionCreate, secret.Namespace, secret.Name, azureKeyVaultSecret, objectVersion, sortValueKeys(azureSecretValue))
+	secret.Data = azureSecretValue
+	return secret, nil
+}
+
+// deleteSecret deletes the Secret of a AzureKeyVaultSecret, or reports it in dry run mode
+func (c *Controller) deleteSecret(azureKeyVaultSecret *akv.AzureKeyVaultSecret, name string) error {
+	if c.options.DryRun {
+		c.recordDryRun(azureKeyVaultSecret, fmt.Sprintf(MessageDryRunDeleteSecret, name))
+		return nil
+	}
+	if err := c.kubeclientset.CoreV1().Secrets(azureKeyVaultSecret.Namespace).Delete(name, nil); err != nil {
+		return err
+	}
+	c.auditSecret(AuditActionDelete, azureKeyVaultSecret.Namespace, name, azureKeyVaultSecret, azureKeyVaultSecret.Status.ObjectVersion, nil)
+	return nil
+}
+
+// diffSecretData returns the keys added, changed or removed going from current to desired data
+func diffSecretData(current map[string][]byte, desired map[string][]byte) []string {
+	var changed []string
+	for key, value := range desired {
+		if currentValue, ok := current[key]; !ok || !bytes.Equal(currentValue, value) {
+			changed = append(changed, key)
+		}
+	}
+	for key := range current {
+		if _, ok := desired[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func formatKeys(keys []string) string {
+	if len(keys) == 0 {
+		return "none"
+	}
+	return strings.Join(keys, ", ")
+}
@@ -0,0 +1,106 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	akvtesting "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/akv2k8s/testing"
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client/fake"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	akvInformers "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/client/informers/externalversions"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/record"
+)
+
+// TestEndToEnd runs the controller against a local Kubernetes API server and a fake Azure Key Vault
+// served over HTTPS, covering a secret being created, rotated and soft-deleted in Azure Key Vault
+func TestEndToEnd(t *testing.T) {
+	env := akvtesting.StartEnvironment(t)
+	defer env.Stop(t)
+
+	service := fake.NewService()
+	server := fake.NewServer(service)
+	defer server.Close()
+
+	vaultService, err := server.NewVaultService()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(env.KubeClient, 0)
+	akvsInformerFactory := akvInformers.NewSharedInformerFactory(env.AzureKeyVaultSecretClient, 0)
+
+	controller := NewController(
+		env.KubeClient,
+		env.AzureKeyVaultSecretClient,
+		akvsInformerFactory,
+		kubeInformerFactory,
+		record.NewFakeRecorder(100),
+		vaultService,
+		"azure-key-vault-env-injection",
+		AzurePollFrequency{Normal: 200 * time.Millisecond, Slow: time.Second, MaxFailuresBeforeSlowingDown: 3},
+		&Options{MaxNumRequeues: 5, NumThreads: 1, VaultDefaults: true, VaultPolicies: true})
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go controller.Run(stopCh)
+
+	service.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs, err = env.AzureKeyVaultSecretClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(akvs.Namespace).Create(akvs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectSecretValue := func(expected string) {
+		err := wait.PollImmediate(100*time.Millisecond, 10*time.Second, func() (bool, error) {
+			secret, err := env.KubeClient.CoreV1().Secrets(akvs.Namespace).Get("my-kubernetes-secret", metav1.GetOptions{})
+			if err != nil {
+				return false, nil
+			}
+			return string(secret.Data["value"]) == expected, nil
+		})
+		if err != nil {
+			t.Fatalf("expected secret value '%s', error: %+v", expected, err)
+		}
+	}
+
+	expectSecretValue("first-value")
+
+	service.SetSecret(testVaultName, "my-secret", "second-value")
+	expectSecretValue("second-value")
+
+	service.Delete(testVaultName, "secret", "my-secret")
+	err = wait.PollImmediate(100*time.Millisecond, 10*time.Second, func() (bool, error) {
+		current, err := env.AzureKeyVaultSecretClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(akvs.Namespace).Get(akvs.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return isConditionTrue(&current.Status, akv.AzureKeyVaultSecretConditionSoftDeleted), nil
+	})
+	if err != nil {
+		t.Fatalf("expected SoftDeleted condition to be true, error: %+v", err)
+	}
+
+	// The Kubernetes secret keeps the last known value while the object is soft-deleted
+	expectSecretValue("second-value")
+}
@@ -0,0 +1,121 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+	akvcs "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/client/clientset/versioned"
+	akvInformers "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/client/informers/externalversions"
+)
+
+const (
+	// DefaultComponent is the source component of Events recorded by Run when no Recorder is given
+	DefaultComponent = "azurekeyvaultcontroller"
+
+	// DefaultNamespaceAkvsLabel is the label of namespaces using the env injector, used by Run when
+	// NamespaceAkvsLabel is empty
+	DefaultNamespaceAkvsLabel = "azure-key-vault-env-injection"
+)
+
+// RunOptions are the Options, clients and informer factories to run the controller with using Run
+type RunOptions struct {
+	Options
+
+	// KubeClient and AzureKeyVaultSecretClient are the Kubernetes clients of the controller. Required.
+	KubeClient                kubernetes.Interface
+	AzureKeyVaultSecretClient akvcs.Interface
+
+	// VaultService gets objects from Azure Key Vault. Required.
+	VaultService vault.Service
+
+	// KubeInformerFactory and AzureKeyVaultSecretInformerFactory are created from the clients, using
+	// ResyncPeriod and Namespaces, when nil. Set them to share informers with the embedding operator,
+	// which must then not start them before Run has registered its informers.
+	KubeInformerFactory                informers.SharedInformerFactory
+	AzureKeyVaultSecretInformerFactory akvInformers.SharedInformerFactory
+
+	// Recorder records Events on AzureKeyVaultSecrets. When nil Events are recorded using KubeClient.
+	Recorder record.EventRecorder
+
+	// AzurePollFrequency is how often Azure Key Vault is polled for changes
+	AzurePollFrequency AzurePollFrequency
+
+	// NamespaceAkvsLabel is the label of namespaces using the env injector. DefaultNamespaceAkvsLabel when empty.
+	NamespaceAkvsLabel string
+}
+
+// Run runs the controller until ctx is done, for embedding it in another operator. Unlike the
+// azure-keyvault-controller binary it serves no HTTP endpoints and registers no metrics, which
+// is left to the embedding operator. An error is returned if a required client is missing.
+func Run(ctx context.Context, options RunOptions) error {
+	if options.KubeClient == nil || options.AzureKeyVaultSecretClient == nil {
+		return errors.New("KubeClient and AzureKeyVaultSecretClient are required to run the controller")
+	}
+	if options.VaultService == nil {
+		return errors.New("VaultService is required to run the controller")
+	}
+
+	kubeInformerFactory := options.KubeInformerFactory
+	if kubeInformerFactory == nil {
+		kubeInformerFactory = informers.NewSharedInformerFactoryWithOptions(options.KubeClient, options.ResyncPeriod, options.Namespaces.KubeInformerOptions()...)
+	}
+	akvsInformerFactory := options.AzureKeyVaultSecretInformerFactory
+	if akvsInformerFactory == nil {
+		akvsInformerFactory = akvInformers.NewSharedInformerFactoryWithOptions(options.AzureKeyVaultSecretClient, options.ResyncPeriod, options.Namespaces.AkvsInformerOptions()...)
+	}
+
+	recorder := options.Recorder
+	if recorder == nil {
+		eventBroadcaster := record.NewBroadcaster()
+		eventBroadcaster.StartLogging(log.Tracef)
+		eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: options.KubeClient.CoreV1().Events("")})
+		defer eventBroadcaster.Shutdown()
+
+		recorder = eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: DefaultComponent})
+	}
+
+	namespaceAkvsLabel := options.NamespaceAkvsLabel
+	if namespaceAkvsLabel == "" {
+		namespaceAkvsLabel = DefaultNamespaceAkvsLabel
+	}
+
+	controllerOptions := options.Options
+	controller := NewController(
+		options.KubeClient,
+		options.AzureKeyVaultSecretClient,
+		akvsInformerFactory,
+		kubeInformerFactory,
+		recorder,
+		options.VaultService,
+		namespaceAkvsLabel,
+		options.AzurePollFrequency,
+		&controllerOptions)
+
+	controller.Run(ctx.Done())
+	return nil
+}
@@ -0,0 +1,100 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	akvtesting "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/akv2k8s/testing"
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client/fake"
+	akvsfake "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/client/clientset/versioned/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestRunRequiresClients(t *testing.T) {
+	if err := Run(context.Background(), RunOptions{KubeClient: k8sfake.NewSimpleClientset()}); err == nil {
+		t.Error("expected error when AzureKeyVaultSecretClient and VaultService are missing")
+	}
+}
+
+func TestRunStopsWhenContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := Run(ctx, RunOptions{
+		KubeClient:                k8sfake.NewSimpleClientset(),
+		AzureKeyVaultSecretClient: akvsfake.NewSimpleClientset(),
+		VaultService:              fake.NewService(),
+		Recorder:                  record.NewFakeRecorder(100),
+	})
+	if err != nil {
+		t.Errorf("expected Run to stop without error, got %v", err)
+	}
+}
+
+// TestRun embeds the controller against a local Kubernetes API server, like TestEndToEnd
+func TestRun(t *testing.T) {
+	env := akvtesting.StartEnvironment(t)
+	defer env.Stop(t)
+
+	vaultService := fake.NewService()
+	vaultService.SetSecret(testVaultName, "my-secret", "my-value")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- Run(ctx, RunOptions{
+			Options:                   Options{NumThreads: 1, MaxNumRequeues: 5},
+			KubeClient:                env.KubeClient,
+			AzureKeyVaultSecretClient: env.AzureKeyVaultSecretClient,
+			VaultService:              vaultService,
+			Recorder:                  record.NewFakeRecorder(100),
+			AzurePollFrequency:        AzurePollFrequency{Normal: 200 * time.Millisecond, Slow: time.Second, MaxFailuresBeforeSlowingDown: 3},
+		})
+	}()
+
+	akvs := azureKeyVaultSecretWithOutput()
+	if _, err := env.AzureKeyVaultSecretClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(akvs.Namespace).Create(akvs); err != nil {
+		t.Fatal(err)
+	}
+
+	err := wait.PollImmediate(100*time.Millisecond, 10*time.Second, func() (bool, error) {
+		secret, err := env.KubeClient.CoreV1().Secrets(akvs.Namespace).Get("my-kubernetes-secret", metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+		return string(secret.Data["value"]) == "my-value", nil
+	})
+	if err != nil {
+		t.Fatalf("expected Secret to be created by the embedded controller, error: %+v", err)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("expected Run to stop without error, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected Run to stop when the context is done")
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"errors"
+
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+)
+
+// Errors returned by the controller are classified as one of these when known, so embedders and tests
+// can check the class of an error using errors.Is instead of matching its message
+var (
+	// ErrVaultUnreachable means Azure Key Vault could not be reached, or is failing or throttling requests
+	ErrVaultUnreachable = errors.New("azure key vault unreachable")
+
+	// ErrForbidden means Azure Key Vault denied getting the object
+	ErrForbidden = errors.New("forbidden by azure key vault")
+
+	// ErrNotFound means the object does not exist in Azure Key Vault, or has been deleted
+	ErrNotFound = errors.New("object not found in azure key vault")
+
+	// ErrOutputConflict means the output of a AzureKeyVaultSecret is owned by others, like an existing
+	// Secret not created by the controller, or a key of a bundle Secret owned by another AzureKeyVaultSecret
+	ErrOutputConflict = errors.New("output owned by others")
+)
+
+// classifiedError is an error of one of the classes above, keeping the message of the error it wraps
+type classifiedError struct {
+	class error
+	err   error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() error {
+	return e.err
+}
+
+func (e *classifiedError) Is(target error) bool {
+	return target == e.class
+}
+
+// classifyVaultError classifies an error from Azure Key Vault as ErrForbidden, ErrNotFound or
+// ErrVaultUnreachable. Errors already classified are returned as is.
+func classifyVaultError(err error) error {
+	var classified *classifiedError
+	if err == nil || errors.As(err, &classified) {
+		return err
+	}
+
+	var class error
+	if _, ok := vault.AsForbidden(err); ok {
+		class = ErrForbidden
+	} else if vault.IsSoftDeleted(err) || vault.IsNotFound(err) {
+		class = ErrNotFound
+	} else if vault.IsVaultUnavailable(err) {
+		class = ErrVaultUnreachable
+	} else {
+		return err
+	}
+	return &classifiedError{class: class, err: err}
+}
+
+// newOutputConflictError returns an ErrOutputConflict with msg as message
+func newOutputConflictError(msg string) error {
+	return &classifiedError{class: ErrOutputConflict, err: errors.New(msg)}
+}
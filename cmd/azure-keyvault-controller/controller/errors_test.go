@@ -0,0 +1,81 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+)
+
+func TestClassifyVaultError(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		class error
+	}{
+		{name: "forbidden", err: forbiddenError("ForbiddenByRbac", "Caller is not authorized to perform action on resource."), class: ErrForbidden},
+		{name: "not found", err: autorest.DetailedError{StatusCode: http.StatusNotFound}, class: ErrNotFound},
+		{name: "soft deleted", err: &vault.SoftDeletedError{VaultName: testVaultName, ObjectType: "secret", ObjectName: "my-secret"}, class: ErrNotFound},
+		{name: "throttled", err: autorest.DetailedError{StatusCode: http.StatusTooManyRequests}, class: ErrVaultUnreachable},
+		{name: "network", err: errors.New("dial tcp: lookup my-vault.vault.azure.net: no such host"), class: ErrVaultUnreachable},
+		{name: "circuit open", err: &circuitOpenError{vaultName: testVaultName, retryAt: time.Now()}, class: ErrVaultUnreachable},
+	}
+
+	for _, test := range tests {
+		err := fmt.Errorf("failed to get secret, error: %w", classifyVaultError(test.err))
+		if !errors.Is(err, test.class) {
+			t.Errorf("expected %s error to be classified as '%v'", test.name, test.class)
+		}
+		if err.Error() != "failed to get secret, error: "+test.err.Error() {
+			t.Errorf("expected %s error to keep its message, got '%s'", test.name, err.Error())
+		}
+	}
+
+	if err := classifyVaultError(autorest.DetailedError{StatusCode: http.StatusBadRequest}); errors.Is(err, ErrVaultUnreachable) || errors.Is(err, ErrNotFound) {
+		t.Errorf("expected bad request not to be classified, got '%v'", err)
+	}
+}
+
+func TestSyncReturnsClassifiedErrors(t *testing.T) {
+	f := newFixture(t)
+
+	missing := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(missing)
+	if err := f.controller.syncAzureKeyVaultSecret(key(missing)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for object missing in Azure Key Vault, got '%v'", err)
+	}
+
+	f.vault.SetSecret(testVaultName, "db-password", "secret-1")
+	f.vault.SetSecret(testVaultName, "other-password", "secret-2")
+	db := bundleAzureKeyVaultSecret("db", "db-password", "PASSWORD")
+	other := bundleAzureKeyVaultSecret("other", "other-password", "PASSWORD")
+	f.addAzureKeyVaultSecret(db)
+	f.addAzureKeyVaultSecret(other)
+	if err := f.controller.syncAzureKeyVaultSecret(key(db)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(db)
+	if err := f.controller.syncAzureKeyVaultSecret(key(other)); !errors.Is(err, ErrOutputConflict) {
+		t.Errorf("expected ErrOutputConflict for key owned by another AzureKeyVaultSecret, got '%v'", err)
+	}
+}
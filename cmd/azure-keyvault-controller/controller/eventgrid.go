@@ -0,0 +1,175 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/labels"
+	"kmodules.xyz/client-go/tools/queue"
+)
+
+const (
+	eventGridSubscriptionValidationEvent = "Microsoft.EventGrid.SubscriptionValidationEvent"
+	eventGridSecretNewVersionCreated     = "Microsoft.KeyVault.SecretNewVersionCreated"
+	eventGridCertNewVersionCreated       = "Microsoft.KeyVault.CertificateNewVersionCreated"
+	eventGridKeyNewVersionCreated        = "Microsoft.KeyVault.KeyNewVersionCreated"
+
+	// eventGridMaxBodyBytes is the largest batch of events delivered by Azure Event Grid
+	eventGridMaxBodyBytes = 1024 * 1024
+)
+
+// eventGridEvent is an event delivered by Azure Event Grid using the Event Grid schema
+type eventGridEvent struct {
+	ID        string          `json:"id"`
+	EventType string          `json:"eventType"`
+	Subject   string          `json:"subject"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type eventGridValidationData struct {
+	ValidationCode string `json:"validationCode"`
+}
+
+type eventGridValidationResponse struct {
+	ValidationResponse string `json:"validationResponse"`
+}
+
+// eventGridKeyVaultData is the data part of Azure Key Vault events
+type eventGridKeyVaultData struct {
+	ID         string `json:"Id"`
+	VaultName  string `json:"VaultName"`
+	ObjectType string `json:"ObjectType"`
+	ObjectName string `json:"ObjectName"`
+	Version    string `json:"Version"`
+}
+
+// EventGridHandler returns a http.Handler receiving Azure Key Vault events from Azure Event Grid,
+// which will sync all AzureKeyVaultSecrets referencing the changed object immediately instead of
+// waiting for the next poll. Requests, including the subscription validation handshake, must provide key
+// in the query parameter 'key'. All requests are rejected if key is empty.
+func (c *Controller) EventGridHandler(key string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Checked before decoding, so subscriptions to other endpoints cannot be validated without the key
+		if key == "" || subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("key")), []byte(key)) != 1 {
+			log.Warningf("Received Event Grid request from %s with invalid key", r.RemoteAddr)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var events []eventGridEvent
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, eventGridMaxBodyBytes)).Decode(&events); err != nil {
+			log.Errorf("failed to decode Event Grid events, error: %+v", err)
+			http.Error(w, "invalid event payload", http.StatusBadRequest)
+			return
+		}
+
+		for _, event := range events {
+			switch event.EventType {
+			case eventGridSubscriptionValidationEvent:
+				var data eventGridValidationData
+				if err := json.Unmarshal(event.Data, &data); err != nil {
+					log.Errorf("failed to decode Event Grid subscription validation event, error: %+v", err)
+					http.Error(w, "invalid validation event", http.StatusBadRequest)
+					return
+				}
+
+				log.Info("Validating Event Grid subscription")
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(&eventGridValidationResponse{ValidationResponse: data.ValidationCode})
+				return
+
+			case eventGridSecretNewVersionCreated, eventGridCertNewVersionCreated, eventGridKeyNewVersionCreated:
+				var data eventGridKeyVaultData
+				if err := json.Unmarshal(event.Data, &data); err != nil {
+					log.Errorf("failed to decode Event Grid event '%s', error: %+v", event.ID, err)
+					continue
+				}
+
+				if err := c.enqueueAzureKeyVaultSecretsForObject(event.EventType, &data); err != nil {
+					log.Errorf("failed to handle Event Grid event '%s', error: %+v", event.ID, err)
+					http.Error(w, "failed to handle event", http.StatusInternalServerError)
+					return
+				}
+
+			default:
+				log.Debugf("Ignoring Event Grid event '%s' of type '%s'", event.ID, event.EventType)
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func (c *Controller) enqueueAzureKeyVaultSecretsForObject(eventType string, data *eventGridKeyVaultData) error {
+	azureKeyVaultSecrets, err := c.azureKeyVaultSecretLister.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list AzureKeyVaultSecrets, error: %+v", err)
+	}
+
+	for _, azureKeyVaultSecret := range azureKeyVaultSecrets {
+		if azureKeyVaultSecret, err = c.applyVaultDefaults(azureKeyVaultSecret); err != nil {
+			continue
+		}
+		if !c.isHandled(azureKeyVaultSecret.Namespace, azureKeyVaultSecret.Name) || !c.akvsHasSecretOutput(azureKeyVaultSecret) || !isEventForAzureKeyVaultSecret(eventType, data, azureKeyVaultSecret) {
+			continue
+		}
+
+		newLogger(azureKeyVaultSecret).WithField("version", data.Version).Infof("Object has new version in Azure Key Vault '%s'. Adding to Azure Key Vault queue.", data.VaultName)
+		queue.Enqueue(c.azureKeyVaultQueue.GetQueue(), azureKeyVaultSecret)
+	}
+	return nil
+}
+
+func isEventForAzureKeyVaultSecret(eventType string, data *eventGridKeyVaultData, azureKeyVaultSecret *akv.AzureKeyVaultSecret) bool {
+	vaultSpec := azureKeyVaultSecret.Spec.Vault
+
+	// Secrets pinned to a specific version will never change
+	if vaultSpec.Object.Version != "" {
+		return false
+	}
+
+	if !strings.EqualFold(vaultSpec.Name, data.VaultName) && !(vaultSpec.Fallback != "" && strings.EqualFold(vaultSpec.Fallback, data.VaultName)) {
+		return false
+	}
+
+	if !strings.EqualFold(vaultSpec.Object.Name, data.ObjectName) {
+		return false
+	}
+
+	switch eventType {
+	case eventGridSecretNewVersionCreated:
+		return vaultSpec.Object.Type == akv.AzureKeyVaultObjectTypeSecret || vaultSpec.Object.Type == akv.AzureKeyVaultObjectTypeMultiKeyValueSecret
+	case eventGridCertNewVersionCreated:
+		return vaultSpec.Object.Type == akv.AzureKeyVaultObjectTypeCertificate
+	case eventGridKeyNewVersionCreated:
+		return vaultSpec.Object.Type == akv.AzureKeyVaultObjectTypeKey
+	default:
+		return false
+	}
+}
@@ -0,0 +1,191 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+	listers "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/client/listers/keyvault/v2alpha1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func newEventGridTestController(t *testing.T) *Controller {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+
+	akvs := secret()
+	akvs.Spec.Output.Secret.Name = "some-secret"
+	if err := indexer.Add(akvs); err != nil {
+		t.Fatal(err)
+	}
+
+	return &Controller{
+		azureKeyVaultSecretLister:  listers.NewAzureKeyVaultSecretLister(indexer),
+		azureKeyVaultDefaultLister: listers.NewAzureKeyVaultDefaultLister(cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})),
+		azureKeyVaultQueue:         newQueueWorker("AzureKeyVault", workqueue.DefaultControllerRateLimiter(), 1, 1, func(key string) error { return nil }),
+		options:                    &Options{},
+	}
+}
+
+func TestEventGridSubscriptionValidation(t *testing.T) {
+	c := newEventGridTestController(t)
+
+	body := `[{"id":"1","eventType":"Microsoft.EventGrid.SubscriptionValidationEvent","data":{"validationCode":"some-code"}}]`
+	req := httptest.NewRequest(http.MethodPost, "/api/eventgrid?key=secret-key", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	c.EventGridHandler("secret-key").ServeHTTP(rec, req)
+
+	var response eventGridValidationResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.ValidationResponse != "some-code" {
+		t.Errorf("expected validation response 'some-code', got '%s'", response.ValidationResponse)
+	}
+}
+
+func TestEventGridSecretNewVersionCreated(t *testing.T) {
+	c := newEventGridTestController(t)
+
+	body := `[{"id":"1","eventType":"Microsoft.KeyVault.SecretNewVersionCreated","data":{"VaultName":"test-name-vault-name","ObjectType":"Secret","ObjectName":"some-secret","Version":"abc"}}]`
+	req := httptest.NewRequest(http.MethodPost, "/api/eventgrid?key=secret-key", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	c.EventGridHandler("secret-key").ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", rec.Code)
+	}
+	if c.azureKeyVaultQueue.GetQueue().Len() != 1 {
+		t.Errorf("expected 1 AzureKeyVaultSecret in queue, got %d", c.azureKeyVaultQueue.GetQueue().Len())
+	}
+}
+
+func TestEventGridIgnoresOtherObjects(t *testing.T) {
+	c := newEventGridTestController(t)
+
+	body := `[{"id":"1","eventType":"Microsoft.KeyVault.SecretNewVersionCreated","data":{"VaultName":"test-name-vault-name","ObjectType":"Secret","ObjectName":"other-secret","Version":"abc"}},
+	{"id":"2","eventType":"Microsoft.KeyVault.CertificateNewVersionCreated","data":{"VaultName":"test-name-vault-name","ObjectType":"Certificate","ObjectName":"some-secret","Version":"abc"}}]`
+	req := httptest.NewRequest(http.MethodPost, "/api/eventgrid?key=secret-key", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	c.EventGridHandler("secret-key").ServeHTTP(rec, req)
+
+	if c.azureKeyVaultQueue.GetQueue().Len() != 0 {
+		t.Errorf("expected no AzureKeyVaultSecrets in queue, got %d", c.azureKeyVaultQueue.GetQueue().Len())
+	}
+}
+
+func TestEventGridInvalidKey(t *testing.T) {
+	c := newEventGridTestController(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/eventgrid?key=wrong", strings.NewReader("[]"))
+	rec := httptest.NewRecorder()
+
+	c.EventGridHandler("secret-key").ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401, got %d", rec.Code)
+	}
+}
+
+func TestEventGridSubscriptionValidationInvalidKey(t *testing.T) {
+	body := `[{"id":"1","eventType":"Microsoft.EventGrid.SubscriptionValidationEvent","data":{"validationCode":"some-code"}}]`
+
+	tests := []struct {
+		name string
+		key  string
+		url  string
+	}{
+		{name: "wrong key", key: "secret-key", url: "/api/eventgrid?key=wrong"},
+		{name: "missing key", key: "secret-key", url: "/api/eventgrid"},
+		{name: "no key configured", key: "", url: "/api/eventgrid?key="},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newEventGridTestController(t)
+			req := httptest.NewRequest(http.MethodPost, test.url, strings.NewReader(body))
+			rec := httptest.NewRecorder()
+
+			c.EventGridHandler(test.key).ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("expected status 401, got %d", rec.Code)
+			}
+			if strings.Contains(rec.Body.String(), "some-code") {
+				t.Errorf("expected validation code not to be returned, got %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestEventGridRejectsLargeBody(t *testing.T) {
+	c := newEventGridTestController(t)
+
+	body := `[{"id":"1","eventType":"Microsoft.KeyVault.SecretNewVersionCreated","subject":"` + strings.Repeat("a", eventGridMaxBodyBytes) + `"}]`
+	req := httptest.NewRequest(http.MethodPost, "/api/eventgrid?key=secret-key", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	c.EventGridHandler("secret-key").ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", rec.Code)
+	}
+}
+
+func TestEventGridSyncsNewVersionWhileCached(t *testing.T) {
+	f := newFixture(t)
+	f.controller.vaultService = vault.NewCachedService(f.vault, time.Hour)
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+	// Polling caches the lookups of the current version
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+
+	f.vault.SetSecret(testVaultName, "my-secret", "second-value")
+	body := `[{"id":"1","eventType":"Microsoft.KeyVault.SecretNewVersionCreated","data":{"VaultName":"` + testVaultName + `","ObjectType":"Secret","ObjectName":"my-secret","Version":"abc"}}]`
+	req := httptest.NewRequest(http.MethodPost, "/api/eventgrid?key=secret-key", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	f.controller.EventGridHandler("secret-key").ServeHTTP(rec, req)
+	if length := f.controller.azureKeyVaultQueue.GetQueue().Len(); length != 1 {
+		t.Fatalf("expected AzureKeyVaultSecret to be queued by the event, got queue length %d", length)
+	}
+
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	if value := string(f.getSecret(akvs.Namespace, "my-kubernetes-secret").Data["value"]); value != "second-value" {
+		t.Errorf("expected new version to be synced at once, got '%s'", value)
+	}
+}
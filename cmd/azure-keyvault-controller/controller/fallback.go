@@ -0,0 +1,73 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sync"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+)
+
+// failureCounter counts consecutive failures per key
+type failureCounter struct {
+	mutex    sync.Mutex
+	failures map[string]int
+}
+
+func newFailureCounter() *failureCounter {
+	return &failureCounter{
+		failures: make(map[string]int),
+	}
+}
+
+// inc increments the failure count for key and returns the new count
+func (f *failureCounter) inc(key string) int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.failures[key]++
+	return f.failures[key]
+}
+
+// get returns the current failure count for key
+func (f *failureCounter) get(key string) int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.failures[key]
+}
+
+func (f *failureCounter) reset(key string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	delete(f.failures, key)
+}
+
+// shouldUseFallbackVault registers a failure against the primary Azure Key Vault and returns true
+// if the AzureKeyVaultSecret has a fallback and the primary has failed persistently
+func (c *Controller) shouldUseFallbackVault(key string, azureKeyVaultSecret *akv.AzureKeyVaultSecret) bool {
+	failures := c.vaultFailures.inc(key)
+	return azureKeyVaultSecret.Spec.Vault.Fallback != "" && failures >= c.azureFrequency.MaxFailuresBeforeSlowingDown
+}
+
+// withVaultName returns a copy of the AzureKeyVaultSecret using the given Azure Key Vault
+func withVaultName(azureKeyVaultSecret *akv.AzureKeyVaultSecret, vaultName string) *akv.AzureKeyVaultSecret {
+	azureKeyVaultSecretCopy := azureKeyVaultSecret.DeepCopy()
+	azureKeyVaultSecretCopy.Spec.Vault.Name = vaultName
+	return azureKeyVaultSecretCopy
+}
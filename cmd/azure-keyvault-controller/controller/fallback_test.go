@@ -0,0 +1,61 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+)
+
+func TestShouldUseFallbackVault(t *testing.T) {
+	c := &Controller{
+		azureFrequency: AzurePollFrequency{MaxFailuresBeforeSlowingDown: 2},
+		vaultFailures:  newFailureCounter(),
+	}
+
+	akvs := secret()
+	akvs.Spec.Vault.Fallback = "fallback-vault"
+
+	if c.shouldUseFallbackVault("default/test-name", akvs) {
+		t.Error("expected primary vault to be used after first failure")
+	}
+	if !c.shouldUseFallbackVault("default/test-name", akvs) {
+		t.Error("expected fallback vault to be used after repeated failures")
+	}
+
+	c.vaultFailures.reset("default/test-name")
+	if c.shouldUseFallbackVault("default/test-name", akvs) {
+		t.Error("expected primary vault to be used after failures are reset")
+	}
+
+	akvs.Spec.Vault.Fallback = ""
+	c.shouldUseFallbackVault("default/test-name", akvs)
+	if c.shouldUseFallbackVault("default/test-name", akvs) {
+		t.Error("expected no fallback when fallback vault is not set")
+	}
+}
+
+func TestWithVaultName(t *testing.T) {
+	akvs := secret()
+	fallback := withVaultName(akvs, "fallback-vault")
+
+	if fallback.Spec.Vault.Name != "fallback-vault" {
+		t.Errorf("expected vault name 'fallback-vault', got '%s'", fallback.Spec.Vault.Name)
+	}
+	if akvs.Spec.Vault.Name == "fallback-vault" {
+		t.Error("original AzureKeyVaultSecret should not be modified")
+	}
+}
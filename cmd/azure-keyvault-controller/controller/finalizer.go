@@ -0,0 +1,111 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// CleanupFinalizer is set on AzureKeyVaultSecrets with outputs not garbage collected by Kubernetes, like
+// trust bundles and Secrets written to other clusters, so they can be deleted before the AzureKeyVaultSecret is
+const CleanupFinalizer = "keyvault.azure.spv.no/cleanup"
+
+// needsCleanup returns true if the AzureKeyVaultSecret has, or may have had, outputs to delete with it
+func needsCleanup(azureKeyVaultSecret *akv.AzureKeyVaultSecret) bool {
+	return len(azureKeyVaultSecret.Spec.Output.Clusters) > 0 || len(azureKeyVaultSecret.Status.RemoteSecrets) > 0 ||
+		hasTrustBundleOutput(azureKeyVaultSecret) || azureKeyVaultSecret.Status.TrustBundle != nil
+}
+
+func hasCleanupFinalizer(azureKeyVaultSecret *akv.AzureKeyVaultSecret) bool {
+	for _, finalizer := range azureKeyVaultSecret.Finalizers {
+		if finalizer == CleanupFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureCleanupFinalizer adds the cleanup finalizer to the AzureKeyVaultSecret before outputs needing
+// cleanup are written
+func (c *Controller) ensureCleanupFinalizer(azureKeyVaultSecret *akv.AzureKeyVaultSecret) error {
+	if !needsCleanup(azureKeyVaultSecret) || hasCleanupFinalizer(azureKeyVaultSecret) || c.options.DryRun {
+		return nil
+	}
+
+	latest, err := c.akvsClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(azureKeyVaultSecret.Namespace).Get(azureKeyVaultSecret.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if hasCleanupFinalizer(latest) {
+		return nil
+	}
+	latest = latest.DeepCopy()
+	latest.Finalizers = append(latest.Finalizers, CleanupFinalizer)
+	_, err = c.akvsClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(latest.Namespace).Update(latest)
+	return err
+}
+
+// finalizeAzureKeyVaultSecret deletes the outputs of a AzureKeyVaultSecret being deleted, and removes the cleanup
+// finalizer so Kubernetes can delete it. Returns false if the AzureKeyVaultSecret is not being deleted.
+func (c *Controller) finalizeAzureKeyVaultSecret(key string) (bool, error) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return false, nil
+	}
+	azureKeyVaultSecret, err := c.azureKeyVaultSecretLister.AzureKeyVaultSecrets(namespace).Get(name)
+	if err != nil || azureKeyVaultSecret.DeletionTimestamp == nil {
+		return false, nil
+	}
+	if !hasCleanupFinalizer(azureKeyVaultSecret) {
+		return true, nil
+	}
+
+	logger := newLogger(azureKeyVaultSecret)
+	if err = c.deleteTrustBundles(azureKeyVaultSecret); err != nil {
+		return true, err
+	}
+	if err = c.deleteRemoteSecrets(azureKeyVaultSecret); err != nil {
+		return true, err
+	}
+	if c.options.DryRun {
+		return true, nil
+	}
+
+	latest, err := c.akvsClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(namespace).Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return true, err
+	}
+	latest = latest.DeepCopy()
+	finalizers := latest.Finalizers[:0]
+	for _, finalizer := range latest.Finalizers {
+		if finalizer != CleanupFinalizer {
+			finalizers = append(finalizers, finalizer)
+		}
+	}
+	latest.Finalizers = finalizers
+	if _, err = c.akvsClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(namespace).Update(latest); err != nil && !errors.IsNotFound(err) {
+		return true, err
+	}
+	logger.Info("Cleaned up outputs of deleted AzureKeyVaultSecret")
+	return true, nil
+}
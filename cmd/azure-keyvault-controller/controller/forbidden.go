@@ -0,0 +1,71 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// forbiddenMessage returns the message for Azure Key Vault vaultName denying the AzureKeyVaultSecret
+// getting its object, with what to change in Azure for it to be allowed
+func forbiddenMessage(azureKeyVaultSecret *akv.AzureKeyVaultSecret, vaultName string, forbidden *vault.Forbidden) string {
+	objectType := string(azureKeyVaultSecret.Spec.Vault.Object.Type.AzureObjectType())
+	return fmt.Sprintf(MessageAzureKeyVaultForbidden, azureKeyVaultSecret.Name, vaultName, forbidden.Remediation(vaultName, objectType))
+}
+
+// updateForbiddenCondition sets the Forbidden condition if Azure Key Vault denied getting the object,
+// and clears it if getting the object failed for another reason
+func updateForbiddenCondition(status *akv.AzureKeyVaultSecretStatus, forbidden *vault.Forbidden, msg string, now metav1.Time) {
+	if forbidden == nil {
+		clearCondition(status, akv.AzureKeyVaultSecretConditionForbidden, "Allowed", "Azure Key Vault allows getting the object", now)
+		return
+	}
+	setCondition(status, akv.AzureKeyVaultSecretCondition{
+		Type:    akv.AzureKeyVaultSecretConditionForbidden,
+		Status:  corev1.ConditionTrue,
+		Reason:  string(forbidden.Model),
+		Message: msg,
+	}, now)
+}
+
+// handleForbidden reports that Azure Key Vault denies the AzureKeyVaultSecret getting its object when
+// creating its Secret, with what to change in Azure for it to be allowed, instead of the generic failure
+func (c *Controller) handleForbidden(azureKeyVaultSecret *akv.AzureKeyVaultSecret, forbidden *vault.Forbidden, err error) error {
+	vaultName := azureKeyVaultSecret.Spec.Vault.Name
+	msg := forbiddenMessage(azureKeyVaultSecret, vaultName, forbidden) + formatRequestIDs(vault.RequestIDs(err))
+
+	logger := newLogger(azureKeyVaultSecret)
+	logger.WithFields(log.Fields{"permissionModel": forbidden.Model, "identity": forbidden.ObjectID}).WithError(err).Error(msg)
+	if !isConditionTrue(&azureKeyVaultSecret.Status, akv.AzureKeyVaultSecretConditionForbidden) {
+		c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, ErrAzureVaultForbidden, msg)
+	}
+
+	now := c.clock.Now()
+	statusErr := c.mutateAzureKeyVaultSecretStatus(azureKeyVaultSecret, func(status *akv.AzureKeyVaultSecretStatus) {
+		updateForbiddenCondition(status, forbidden, msg, now)
+	})
+	if statusErr != nil {
+		logger.WithError(statusErr).Error("failed to update status for AzureKeyVaultSecret")
+	}
+	return fmt.Errorf(msg)
+}
@@ -0,0 +1,106 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+)
+
+const testObjectID = "22222222-2222-2222-2222-222222222222"
+
+func forbiddenError(innerCode string, message string) error {
+	return autorest.DetailedError{
+		StatusCode: http.StatusForbidden,
+		Original: &azure.RequestError{
+			ServiceError: &azure.ServiceError{
+				Code:       "Forbidden",
+				Message:    message,
+				InnerError: map[string]interface{}{"code": innerCode},
+			},
+		},
+	}
+}
+
+func TestSyncForbiddenByRbac(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetError(testVaultName, "secret", "my-secret", forbiddenError("ForbiddenByRbac",
+		"Caller is not authorized to perform action on resource.\r\nCaller: appid=11111111-1111-1111-1111-111111111111;oid="+testObjectID+";iss=https://sts.windows.net/tenant/\r\n"+
+			"Action: 'Microsoft.KeyVault/vaults/secrets/getSecret/action'\r\n"))
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	err := f.controller.syncAzureKeyVaultSecret(key(akvs))
+	if err == nil {
+		t.Fatal("expected error when forbidden")
+	}
+	for _, expected := range []string{testObjectID, "'Key Vault Secrets User'", "az role assignment create"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected error to contain '%s', got '%s'", expected, err)
+		}
+	}
+	f.expectEvent(ErrAzureVaultForbidden)
+
+	status := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status
+	condition := getCondition(&status, akv.AzureKeyVaultSecretConditionForbidden)
+	if condition == nil || condition.Reason != "RBAC" || condition.Message != err.Error() {
+		t.Errorf("expected Forbidden condition with reason RBAC and the remediation, got %+v", condition)
+	}
+}
+
+func TestSyncForbiddenByAccessPolicyIsClearedWhenAllowed(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+	f.drainEvents()
+
+	f.vault.SetError(testVaultName, "secret", "my-secret", forbiddenError("AccessDenied",
+		"The user, group or application 'appid=11111111-1111-1111-1111-111111111111;oid="+testObjectID+";iss=https://sts.windows.net/tenant/' "+
+			"does not have secrets get permission on key vault 'my-vault;location=westeurope'."))
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err == nil || !strings.Contains(err.Error(), "--secret-permissions get") {
+		t.Fatalf("expected error with access policy remediation, got %v", err)
+	}
+	f.expectEvent(ErrAzureVaultForbidden)
+
+	status := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status
+	if condition := getCondition(&status, akv.AzureKeyVaultSecretConditionForbidden); condition == nil || condition.Reason != "AccessPolicy" {
+		t.Fatalf("expected Forbidden condition with reason AccessPolicy, got %+v", condition)
+	}
+
+	f.vault.SetError(testVaultName, "secret", "my-secret", nil)
+	f.vault.SetSecret(testVaultName, "my-secret", "second-value")
+	f.refresh(akvs)
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	status = f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status
+	if isConditionTrue(&status, akv.AzureKeyVaultSecretConditionForbidden) {
+		t.Error("expected Forbidden condition to be cleared")
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"path"
+
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// hasKeyFilters returns true if the AzureKeyVaultSecret only writes some of the keys of its multi-key-value-secret
+func hasKeyFilters(azureKeyVaultSecret *akv.AzureKeyVaultSecret) bool {
+	output := azureKeyVaultSecret.Spec.Output.Secret
+	return azureKeyVaultSecret.Spec.Vault.Object.Type == akv.AzureKeyVaultObjectTypeMultiKeyValueSecret &&
+		(len(output.IncludeKeys) > 0 || len(output.ExcludeKeys) > 0)
+}
+
+// matchesAnyKey returns true if key is one of the key names or glob patterns
+func matchesAnyKey(patterns []string, key string, field string) (bool, error) {
+	for _, pattern := range patterns {
+		matched, err := path.Match(pattern, key)
+		if err != nil {
+			return false, fmt.Errorf("invalid key pattern '%s' in spec.output.secret.%s, error: %w", pattern, field, err)
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// isKeyIncluded returns true if key is matched by spec.output.secret.includeKeys, or it is empty,
+// and key is not matched by spec.output.secret.excludeKeys
+func isKeyIncluded(output akv.AzureKeyVaultOutputSecret, key string) (bool, error) {
+	if len(output.IncludeKeys) > 0 {
+		included, err := matchesAnyKey(output.IncludeKeys, key, "includeKeys")
+		if err != nil || !included {
+			return false, err
+		}
+	}
+	excluded, err := matchesAnyKey(output.ExcludeKeys, key, "excludeKeys")
+	return !excluded, err
+}
+
+// filterKeys removes the keys of a multi-key-value-secret not to be written to the Secret
+func filterKeys(azureKeyVaultSecret *akv.AzureKeyVaultSecret, values map[string][]byte) (map[string][]byte, error) {
+	if !hasKeyFilters(azureKeyVaultSecret) {
+		return values, nil
+	}
+
+	filtered := make(map[string][]byte, len(values))
+	for key, value := range values {
+		included, err := isKeyIncluded(azureKeyVaultSecret.Spec.Output.Secret, key)
+		if err != nil {
+			return nil, err
+		}
+		if included {
+			filtered[key] = value
+		}
+	}
+	return filtered, nil
+}
+
+// hasFilteredKeys returns true if the Secret has keys no longer to be written to it, like after
+// a key is added to spec.output.secret.excludeKeys
+func hasFilteredKeys(azureKeyVaultSecret *akv.AzureKeyVaultSecret, secret *corev1.Secret) bool {
+	if !hasKeyFilters(azureKeyVaultSecret) {
+		return false
+	}
+	for key := range secret.Data {
+		// Invalid patterns fail getting the secret from Azure Key Vault instead
+		if included, err := isKeyIncluded(azureKeyVaultSecret.Spec.Output.Secret, key); err == nil && !included {
+			return true
+		}
+	}
+	return false
+}
+
+// removeFilteredKeys writes the Secret again from Azure Key Vault when it has keys no longer to be written
+// to it, so they are removed from the cluster right away instead of on the next change in Azure Key Vault
+func (c *Controller) removeFilteredKeys(azureKeyVaultSecret *akv.AzureKeyVaultSecret, secret *corev1.Secret) (*corev1.Secret, error) {
+	newLogger(azureKeyVaultSecret).WithField("secret", secret.Name).Info("Secret has keys no longer included by the key filters. Updating it from Azure Key Vault.")
+	secretValue, err := c.getSecretFromKeyVault(lastSyncedObject(azureKeyVaultSecret))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret from Azure Key Vault for secret '%s'/'%s'%s, error: %w", azureKeyVaultSecret.Namespace, azureKeyVaultSecret.Name, formatRequestIDs(vault.RequestIDs(err)), err)
+	}
+
+	if secret, err = c.patchSecret(azureKeyVaultSecret, secretValue, azureKeyVaultSecret.Status.ObjectVersion); err != nil {
+		return nil, err
+	}
+
+	secretHash := getSecretHash(secretValue)
+	if err = c.mutateAzureKeyVaultSecretStatus(azureKeyVaultSecret, func(status *akv.AzureKeyVaultSecretStatus) {
+		status.SecretHash = secretHash
+	}); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
@@ -0,0 +1,63 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+)
+
+func TestExcludedKeysAreRemovedFromSecret(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", `{"username": "app", "password": "secret", "admin_password": "admin"}`)
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Spec.Vault.Object.Type = akv.AzureKeyVaultObjectTypeMultiKeyValueSecret
+	akvs.Spec.Vault.Object.ContentType = akv.AzureKeyVaultObjectContentTypeJSON
+	akvs.Spec.Output.Secret.DataKey = ""
+	f.addAzureKeyVaultSecret(akvs)
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	if keys := sortValueKeys(f.getSecret(akvs.Namespace, "my-kubernetes-secret").Data); len(keys) != 3 {
+		t.Fatalf("expected all 3 keys in Secret, got %v", keys)
+	}
+
+	// Removed without waiting for the object to change in Azure Key Vault
+	f.refresh(akvs)
+	latest := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name)
+	latest.Spec.Output.Secret.ExcludeKeys = []string{"admin_*"}
+	if _, err := f.akvsClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(akvs.Namespace).Update(latest); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+	f.drainEvents()
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.expectNoEvents()
+
+	secret := f.getSecret(akvs.Namespace, "my-kubernetes-secret")
+	if _, ok := secret.Data["admin_password"]; ok || len(secret.Data) != 2 {
+		t.Errorf("expected excluded key to be removed from Secret, got %v", sortValueKeys(secret.Data))
+	}
+	latest = f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name)
+	if HasSecretDrifted(latest, secret) {
+		t.Error("expected Secret without excluded keys to match the synced hash")
+	}
+}
@@ -0,0 +1,92 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// LayoutCACertKey is the key of the CA certificates in the TLS and CA layouts
+	LayoutCACertKey = "ca.crt"
+
+	// LayoutTokenKey is the key of the secret in the ServiceAccountToken layout
+	LayoutTokenKey = "token"
+
+	// LayoutNamespaceKey is the key of the namespace in the ServiceAccountToken layout
+	LayoutNamespaceKey = "namespace"
+)
+
+// validateLayout returns an error if the layout of the AzureKeyVaultSecret is unknown,
+// or cannot be used with the type of its object in Azure Key Vault
+func validateLayout(azureKeyVaultSecret *akv.AzureKeyVaultSecret) error {
+	layout := azureKeyVaultSecret.Spec.Output.Secret.Layout
+	objectType := azureKeyVaultSecret.Spec.Vault.Object.Type
+
+	switch layout {
+	case "":
+		return nil
+	case akv.AzureKeyVaultOutputLayoutTLS, akv.AzureKeyVaultOutputLayoutCA:
+		if objectType == akv.AzureKeyVaultObjectTypeCertificate {
+			return nil
+		}
+	case akv.AzureKeyVaultOutputLayoutServiceAccountToken:
+		if objectType == akv.AzureKeyVaultObjectTypeSecret {
+			return nil
+		}
+	default:
+		return fmt.Errorf("unknown layout '%s' in spec.output.secret.layout", layout)
+	}
+	return fmt.Errorf("layout '%s' in spec.output.secret.layout cannot be used with azure key vault object type '%s'", layout, objectType)
+}
+
+// certificateLayoutValues returns the certificate using the keys of the layout. The tls.key of the
+// TLS layout is empty if the certificate has no private key, like when it is not exportable.
+func certificateLayoutValues(layout akv.AzureKeyVaultOutputLayout, cert *vault.Certificate) (map[string][]byte, error) {
+	publicKey, err := cert.ExportPublicKeyAsPem()
+	if err != nil {
+		return nil, err
+	}
+
+	if layout == akv.AzureKeyVaultOutputLayoutCA {
+		return map[string][]byte{LayoutCACertKey: publicKey}, nil
+	}
+
+	privateKey := []byte{}
+	if cert.HasPrivateKey {
+		if privateKey, err = cert.ExportPrivateKeyAsPem(); err != nil {
+			return nil, err
+		}
+	}
+	return map[string][]byte{
+		corev1.TLSCertKey:       publicKey,
+		corev1.TLSPrivateKeyKey: privateKey,
+		LayoutCACertKey:         cert.ExportCACertificatesAsPem(),
+	}, nil
+}
+
+// secretLayoutValues returns the secret using the keys of the ServiceAccountToken layout
+func secretLayoutValues(azureKeyVaultSecret *akv.AzureKeyVaultSecret, secret string) map[string][]byte {
+	return map[string][]byte{
+		LayoutTokenKey:     []byte(secret),
+		LayoutNamespaceKey: []byte(azureKeyVaultSecret.Namespace),
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/akv2k8s/transformers"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestValidateLayout(t *testing.T) {
+	tests := []struct {
+		layout     akv.AzureKeyVaultOutputLayout
+		objectType akv.AzureKeyVaultObjectType
+		valid      bool
+	}{
+		{"", akv.AzureKeyVaultObjectTypeKey, true},
+		{akv.AzureKeyVaultOutputLayoutTLS, akv.AzureKeyVaultObjectTypeCertificate, true},
+		{akv.AzureKeyVaultOutputLayoutCA, akv.AzureKeyVaultObjectTypeCertificate, true},
+		{akv.AzureKeyVaultOutputLayoutServiceAccountToken, akv.AzureKeyVaultObjectTypeSecret, true},
+		{akv.AzureKeyVaultOutputLayoutTLS, akv.AzureKeyVaultObjectTypeSecret, false},
+		{akv.AzureKeyVaultOutputLayoutServiceAccountToken, akv.AzureKeyVaultObjectTypeMultiKeyValueSecret, false},
+		{"Unknown", akv.AzureKeyVaultObjectTypeSecret, false},
+	}
+
+	for _, test := range tests {
+		akvs := secret()
+		akvs.Spec.Vault.Object.Type = test.objectType
+		akvs.Spec.Output.Secret.Layout = test.layout
+		if err := validateLayout(akvs); (err == nil) != test.valid {
+			t.Errorf("expected layout '%s' for object type '%s' to be valid: %t, got error %v", test.layout, test.objectType, test.valid, err)
+		}
+	}
+}
+
+func TestHandleCertificateWithTLSLayout(t *testing.T) {
+	fakeVault := &fakeVaultService{
+		fakeCertValue: pemCert,
+	}
+
+	secret := secret()
+	secret.Spec.Vault.Object.Type = akv.AzureKeyVaultObjectTypeCertificate
+	secret.Spec.Output.Secret.Layout = akv.AzureKeyVaultOutputLayoutTLS
+
+	values, err := NewAzureCertificateHandler(secret, fakeVault).Handle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 3 {
+		t.Errorf("expected keys %s, %s and %s, got %v", corev1.TLSCertKey, corev1.TLSPrivateKeyKey, LayoutCACertKey, sortValueKeys(values))
+	}
+	if string(values[corev1.TLSCertKey]) != pemCertPubOnly {
+		t.Errorf("expected public certificate in '%s', got '%s'", corev1.TLSCertKey, string(values[corev1.TLSCertKey]))
+	}
+	if len(values[corev1.TLSPrivateKeyKey]) == 0 {
+		t.Errorf("expected private key in '%s'", corev1.TLSPrivateKeyKey)
+	}
+	// The certificate is self-signed, so its chain has no CA certificates
+	if ca, found := values[LayoutCACertKey]; !found || len(ca) != 0 {
+		t.Errorf("expected empty '%s', got '%s'", LayoutCACertKey, string(ca))
+	}
+}
+
+func TestHandleCertificateWithCALayout(t *testing.T) {
+	fakeVault := &fakeVaultService{
+		fakeCertValue: pemCertPubOnly,
+	}
+
+	secret := secret()
+	secret.Spec.Vault.Object.Type = akv.AzureKeyVaultObjectTypeCertificate
+	secret.Spec.Output.Secret.Layout = akv.AzureKeyVaultOutputLayoutCA
+
+	values, err := NewAzureCertificateHandler(secret, fakeVault).Handle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 1 || string(values[LayoutCACertKey]) != pemCertPubOnly {
+		t.Errorf("expected only the certificate in '%s', got keys %v", LayoutCACertKey, sortValueKeys(values))
+	}
+}
+
+func TestHandleSecretWithServiceAccountTokenLayout(t *testing.T) {
+	fakeVault := &fakeVaultService{
+		fakeSecretValue: "my-token",
+	}
+
+	secret := secret()
+	secret.Spec.Output.Secret.Layout = akv.AzureKeyVaultOutputLayoutServiceAccountToken
+
+	transformator, err := transformers.CreateTransformator(&secret.Spec.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := NewAzureSecretHandler(secret, fakeVault, *transformator).Handle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 2 || string(values[LayoutTokenKey]) != "my-token" || string(values[LayoutNamespaceKey]) != secret.Namespace {
+		t.Errorf("expected '%s' and '%s', got %v", LayoutTokenKey, LayoutNamespaceKey, values)
+	}
+}
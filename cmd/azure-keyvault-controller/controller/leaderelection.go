@@ -0,0 +1,114 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// LeaderElectionOptions contains options for electing a leader among controller replicas
+type LeaderElectionOptions struct {
+	// LockNamespace and LockName is the namespace and name of the Lease used as lock
+	LockNamespace string
+	LockName      string
+
+	// Identity is the unique identity of this replica, like the pod name
+	Identity string
+
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+
+	// AzurePollingOnly makes only polling Azure Key Vault require leadership, while all replicas
+	// reconcile Kubernetes resources, like recreating deleted Secrets. This avoids duplicate requests
+	// to Azure Key Vault, while Secrets are repaired without waiting for a new leader.
+	AzurePollingOnly bool
+}
+
+// runWithLeaderElection blocks until this replica is elected leader and then runs workers requiring leadership
+// until stopCh is closed.
+// Standbys keep their informer caches in sync, so a new leader can start processing immediately.
+func (c *Controller) runWithLeaderElection(stopCh <-chan struct{}) error {
+	opts := c.options.LeaderElection
+
+	lock, err := resourcelock.New(
+		resourcelock.LeasesResourceLock,
+		opts.LockNamespace,
+		opts.LockName,
+		c.kubeclientset.CoreV1(),
+		c.kubeclientset.CoordinationV1(),
+		resourcelock.ResourceLockConfig{
+			Identity:      opts.Identity,
+			EventRecorder: c.recorder,
+		})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+
+	log.Infof("Waiting to become leader using lease %s/%s as '%s'", opts.LockNamespace, opts.LockName, opts.Identity)
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   opts.LeaseDuration,
+		RenewDeadline:   opts.RenewDeadline,
+		RetryPeriod:     opts.RetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            opts.LockName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				log.Infof("Elected leader as '%s'", opts.Identity)
+				c.runLeaderWorkers(ctx.Done())
+			},
+			OnStoppedLeading: func() {
+				select {
+				case <-stopCh:
+					log.Infof("Released leadership as '%s'", opts.Identity)
+				default:
+					// Workers can not be stopped without shutting down their queues, so the only
+					// safe way to avoid two replicas writing Secrets is to exit and start as standby
+					log.Fatalf("Lost leadership as '%s', exiting", opts.Identity)
+				}
+			},
+			OnNewLeader: func(identity string) {
+				if identity != opts.Identity {
+					log.Infof("Current leader is '%s'", identity)
+				}
+			},
+		},
+	})
+	return nil
+}
+
+// runLeaderWorkers starts the workers requiring leadership until stopCh is closed
+func (c *Controller) runLeaderWorkers(stopCh <-chan struct{}) {
+	if c.options.LeaderElection.AzurePollingOnly {
+		c.runAzureWorkers(stopCh)
+		return
+	}
+	c.runWorkers(stopCh)
+}
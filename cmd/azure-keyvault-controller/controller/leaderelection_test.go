@@ -0,0 +1,92 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRunWithLeaderElectionAcquiresLease(t *testing.T) {
+	f := newFixture(t)
+	f.controller.options.LeaderElection = &LeaderElectionOptions{
+		LockNamespace: "default",
+		LockName:      "azure-keyvault-controller",
+		Identity:      "replica-1",
+		LeaseDuration: time.Second,
+		RenewDeadline: 500 * time.Millisecond,
+		RetryPeriod:   100 * time.Millisecond,
+	}
+
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := f.controller.runWithLeaderElection(stopCh); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	var holder string
+	for i := 0; i < 50 && holder != "replica-1"; i++ {
+		time.Sleep(20 * time.Millisecond)
+		lease, err := f.kubeClient.CoordinationV1().Leases("default").Get("azure-keyvault-controller", metav1.GetOptions{})
+		if err == nil && lease.Spec.HolderIdentity != nil {
+			holder = *lease.Spec.HolderIdentity
+		}
+	}
+
+	close(stopCh)
+	<-done
+
+	if holder != "replica-1" {
+		t.Errorf("expected lease to be held by 'replica-1', got '%s'", holder)
+	}
+}
+
+func TestAzurePollingOnlyRunsKubernetesWorkersWithoutLeadership(t *testing.T) {
+	f := newFixture(t)
+	f.controller.options.LeaderElection = &LeaderElectionOptions{AzurePollingOnly: true}
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	stopCh := make(chan struct{})
+	f.controller.runKubernetesWorkers(stopCh)
+	f.controller.akvsCrdQueue.GetQueue().Add(key(akvs))
+	f.controller.azureKeyVaultQueue.GetQueue().Add(key(akvs))
+
+	var created bool
+	for i := 0; i < 50 && !created; i++ {
+		time.Sleep(20 * time.Millisecond)
+		_, err := f.kubeClient.CoreV1().Secrets(akvs.Namespace).Get("my-kubernetes-secret", metav1.GetOptions{})
+		created = err == nil
+	}
+
+	if !created {
+		t.Error("expected secret to be created without leadership")
+	}
+	if length := f.controller.azureKeyVaultQueue.GetQueue().Len(); length != 1 {
+		t.Errorf("expected Azure Key Vault queue to wait for leadership, got %d queued", length)
+	}
+
+	close(stopCh)
+	f.controller.drain(100 * time.Millisecond)
+}
@@ -0,0 +1,45 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/akv2k8s/redact"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	log "github.com/sirupsen/logrus"
+)
+
+// newLogger returns a logger always carrying the namespace, name, vault and object of the
+// AzureKeyVaultSecret as fields, so logs can be filtered by resource when using LOG_FORMAT=json
+func newLogger(azureKeyVaultSecret *akv.AzureKeyVaultSecret) *log.Entry {
+	return log.WithFields(log.Fields{
+		"namespace":  azureKeyVaultSecret.Namespace,
+		"name":       azureKeyVaultSecret.Name,
+		"vault":      azureKeyVaultSecret.Spec.Vault.Name,
+		"object":     azureKeyVaultSecret.Spec.Vault.Object.Name,
+		"objectType": azureKeyVaultSecret.Spec.Vault.Object.Type,
+	})
+}
+
+// redactValues registers the values of the AzureKeyVaultSecret to be removed from log entries,
+// replacing its previous values, in case a value ends up in an error message
+func redactValues(azureKeyVaultSecret *akv.AzureKeyVaultSecret, values map[string][]byte) {
+	list := make([][]byte, 0, len(values))
+	for _, value := range values {
+		list = append(list, value)
+	}
+	redact.Default.Set(azureKeyVaultSecret.Namespace+"/"+azureKeyVaultSecret.Name, list...)
+}
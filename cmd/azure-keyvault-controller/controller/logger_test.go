@@ -0,0 +1,100 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/akv2k8s/redact"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	log "github.com/sirupsen/logrus"
+)
+
+// captureLog writes all log entries at debug level through the redacting formatter to the
+// returned buffer, until the returned function is called
+func captureLog() (*bytes.Buffer, func()) {
+	logger := log.StandardLogger()
+	out, formatter, level := logger.Out, logger.Formatter, logger.GetLevel()
+
+	buf := &bytes.Buffer{}
+	log.SetOutput(buf)
+	log.SetFormatter(redact.NewFormatter(&log.TextFormatter{DisableColors: true}))
+	log.SetLevel(log.DebugLevel)
+	return buf, func() {
+		log.SetOutput(out)
+		log.SetFormatter(formatter)
+		log.SetLevel(level)
+	}
+}
+
+func TestLogsNeverContainSecretValues(t *testing.T) {
+	buf, restore := captureLog()
+	defer restore()
+
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "first-s3cret-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+
+	f.refresh(akvs)
+	f.vault.SetSecret(testVaultName, "my-secret", "second-s3cret-value")
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A value ending up in an error is redacted as well
+	newLogger(akvs).Errorf("failed to sync, error: %v", errors.New("invalid value 'second-s3cret-value'"))
+
+	for _, value := range []string{"first-s3cret-value", "second-s3cret-value"} {
+		if strings.Contains(buf.String(), value) {
+			t.Errorf("expected log not to contain secret value '%s', got:\n%s", value, buf.String())
+		}
+	}
+	if !strings.Contains(buf.String(), redact.Placeholder) {
+		t.Errorf("expected log to contain '%s', got:\n%s", redact.Placeholder, buf.String())
+	}
+}
+
+func TestLogsNeverContainInvalidMultiKeyValueSecret(t *testing.T) {
+	buf, restore := captureLog()
+	defer restore()
+
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "user: admin\npassword: [unclosed-s3cret")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Spec.Vault.Object.Type = akv.AzureKeyVaultObjectTypeMultiKeyValueSecret
+	akvs.Spec.Vault.Object.ContentType = akv.AzureKeyVaultObjectContentTypeYaml
+	f.addAzureKeyVaultSecret(akvs)
+
+	err := f.controller.syncAzureKeyVaultSecret(key(akvs))
+	if err == nil {
+		t.Fatal("expected error for invalid yaml")
+	}
+	log.Error(err)
+
+	if strings.Contains(buf.String(), "unclosed-s3cret") || strings.Contains(err.Error(), "unclosed-s3cret") {
+		t.Errorf("expected error and log not to contain secret content, got:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Tags set on Azure Key Vault objects synced by AzureKeyVaultSecrets when MetadataTagsInterval is set.
+// An object synced by several AzureKeyVaultSecrets is tagged with the last one tagging it.
+const (
+	// MetadataTagCluster is the name of the cluster, only set if Options.ClusterName is set
+	MetadataTagCluster = "akv2k8s-cluster"
+
+	// MetadataTagNamespace is the namespace of the AzureKeyVaultSecret
+	MetadataTagNamespace = "akv2k8s-namespace"
+
+	// MetadataTagName is the name of the AzureKeyVaultSecret
+	MetadataTagName = "akv2k8s-name"
+
+	// MetadataTagLastSynced is when the AzureKeyVaultSecret was last synced with Azure Key Vault, in RFC 3339 format
+	MetadataTagLastSynced = "akv2k8s-last-synced"
+)
+
+// runMetadataTagger tags the Azure Key Vault objects at once and then every MetadataTagsInterval until stopCh is closed
+func (c *Controller) runMetadataTagger(stopCh <-chan struct{}) {
+	if c.options.MetadataTagsInterval <= 0 {
+		return
+	}
+	if c.options.DryRun {
+		log.WithField("dryRun", true).Info("Dry run: not tagging Azure Key Vault objects with sync metadata")
+		return
+	}
+	go runUntil(c.clock, c.tagVaultObjects, c.options.MetadataTagsInterval, stopCh)
+}
+
+// tagVaultObjects tags the Azure Key Vault object version synced by every AzureKeyVaultSecret handled by
+// this replica with where and when it was synced
+func (c *Controller) tagVaultObjects() {
+	azureKeyVaultSecrets, err := c.azureKeyVaultSecretLister.List(labels.Everything())
+	if err != nil {
+		log.Errorf("failed to list AzureKeyVaultSecrets for tagging Azure Key Vault objects: %v", err)
+		return
+	}
+
+	tagged := map[string]bool{}
+	for _, azureKeyVaultSecret := range azureKeyVaultSecrets {
+		if !c.isHandled(azureKeyVaultSecret.Namespace, azureKeyVaultSecret.Name) {
+			continue
+		}
+		c.tagVaultObject(azureKeyVaultSecret)
+		tagged[azureKeyVaultSecret.Namespace+"/"+azureKeyVaultSecret.Name] = true
+	}
+
+	for key := range c.taggingDenied {
+		if !tagged[key] {
+			delete(c.taggingDenied, key)
+		}
+	}
+}
+
+// tagVaultObject tags the Azure Key Vault object version last synced by the AzureKeyVaultSecret, recording
+// an event the first time Azure Key Vault denies it
+func (c *Controller) tagVaultObject(azureKeyVaultSecret *akv.AzureKeyVaultSecret) {
+	status := azureKeyVaultSecret.Status
+	if status.ObjectVersion == "" || status.LastAzureUpdate.IsZero() || isConditionTrue(&status, akv.AzureKeyVaultSecretConditionObjectDeleted) {
+		return
+	}
+	vaultSpec, ok := c.vaultSpecFor(azureKeyVaultSecret)
+	if !ok {
+		return
+	}
+	// Tagging the vault the object was last synced from, which is the fallback vault if used
+	if status.VaultName != "" {
+		vaultSpec.Name = status.VaultName
+	}
+	vaultSpec.Object.Version = status.ObjectVersion
+
+	key := azureKeyVaultSecret.Namespace + "/" + azureKeyVaultSecret.Name
+	logger := newLogger(azureKeyVaultSecret).WithField("vault", vaultSpec.Name)
+	objectVersion, err := c.vaultService.SetTags(&vaultSpec, c.metadataTags(azureKeyVaultSecret))
+	if err != nil {
+		forbidden, isForbidden := vault.AsForbidden(err)
+		if !isForbidden {
+			logger.WithError(err).Warning("failed to tag Azure Key Vault object with sync metadata")
+			return
+		}
+		if c.taggingDenied[key] {
+			logger.WithError(err).Debug("Azure Key Vault still denies tagging object with sync metadata")
+			return
+		}
+		c.taggingDenied[key] = true
+
+		msg := fmt.Sprintf(MessageAzureKeyVaultTagsForbidden, vaultSpec.Object.Name, vaultSpec.Name, forbidden.Remediation(vaultSpec.Name, string(vaultSpec.Object.Type.AzureObjectType())))
+		logger.WithError(err).Warning(msg)
+		c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, ErrAzureVaultTagsForbidden, msg)
+		return
+	}
+	delete(c.taggingDenied, key)
+
+	// Setting tags changes the updated timestamp of the object, which must not be taken as a change of the object
+	if objectVersion.ID != status.ObjectVersion || status.ObjectUpdated.Time.Equal(objectVersion.Updated) {
+		return
+	}
+	err = c.mutateAzureKeyVaultSecretStatus(azureKeyVaultSecret, func(status *akv.AzureKeyVaultSecretStatus) {
+		if status.ObjectVersion == objectVersion.ID {
+			status.ObjectUpdated = metav1.NewTime(objectVersion.Updated)
+		}
+	})
+	if err != nil {
+		logger.WithError(err).Error("failed to update object updated timestamp of AzureKeyVaultSecret after tagging object")
+	}
+}
+
+// metadataTags returns the tags telling vault owners where and when the object was synced
+func (c *Controller) metadataTags(azureKeyVaultSecret *akv.AzureKeyVaultSecret) map[string]string {
+	tags := map[string]string{
+		MetadataTagNamespace:  azureKeyVaultSecret.Namespace,
+		MetadataTagName:       azureKeyVaultSecret.Name,
+		MetadataTagLastSynced: azureKeyVaultSecret.Status.LastAzureUpdate.UTC().Format(time.RFC3339),
+	}
+	if c.options.ClusterName != "" {
+		tags[MetadataTagCluster] = c.options.ClusterName
+	}
+	return tags
+}
@@ -0,0 +1,115 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+)
+
+func (f *fixture) syncedWithChangeDetection(changeDetection akv.AzureKeyVaultChangeDetection) *akv.AzureKeyVaultSecret {
+	// Every version and tag update gets a later updated timestamp
+	now := time.Now()
+	f.vault.Now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	f.vault.SetSecret(testVaultName, "my-secret", "my-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Spec.ChangeDetection = changeDetection
+	f.addAzureKeyVaultSecret(akvs)
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		f.t.Fatal(err)
+	}
+	f.refresh(akvs)
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		f.t.Fatal(err)
+	}
+	f.refresh(akvs)
+	f.drainEvents()
+	return akvs
+}
+
+func TestTagVaultObjects(t *testing.T) {
+	f := newFixture(t)
+	f.controller.options.ClusterName = "my-cluster"
+	akvs := f.syncedWithChangeDetection(akv.AzureKeyVaultChangeDetectionUpdatedTimestamp)
+	patches := f.secretPatches()
+
+	f.controller.tagVaultObjects()
+	status := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status
+	tags := f.vault.Tags(testVaultName, "secret", "my-secret")
+	expected := map[string]string{
+		MetadataTagCluster:    "my-cluster",
+		MetadataTagNamespace:  akvs.Namespace,
+		MetadataTagName:       akvs.Name,
+		MetadataTagLastSynced: status.LastAzureUpdate.UTC().Format(time.RFC3339),
+	}
+	for name, value := range expected {
+		if tags[name] != value {
+			t.Errorf("expected tag '%s' to be '%s', got '%s'", name, value, tags[name])
+		}
+	}
+
+	// Tagging changed the updated timestamp of the object, which must not be written as a change
+	f.refresh(akvs)
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	if f.secretPatches() != patches {
+		t.Errorf("expected tagging not to be taken as a change of the object, got %d new writes", f.secretPatches()-patches)
+	}
+	f.expectNoEvents()
+}
+
+func TestTagVaultObjectsForbidden(t *testing.T) {
+	f := newFixture(t)
+	akvs := f.syncedWithChangeDetection(akv.AzureKeyVaultChangeDetectionValueHash)
+
+	f.vault.SetTagsError(testVaultName, forbiddenError("ForbiddenByPolicy", "The user, group or application does not have secrets set permission on key vault 'my-vault'."))
+	f.controller.tagVaultObjects()
+	f.expectEvent(ErrAzureVaultTagsForbidden)
+
+	// Still denied, so not recorded again
+	f.controller.tagVaultObjects()
+	f.expectNoEvents()
+
+	f.vault.SetTagsError(testVaultName, nil)
+	f.controller.tagVaultObjects()
+	if tags := f.vault.Tags(testVaultName, "secret", "my-secret"); tags[MetadataTagName] != akvs.Name {
+		t.Errorf("expected object to be tagged once allowed, got tags %v", tags)
+	}
+	if _, denied := f.controller.taggingDenied[key(akvs)]; denied {
+		t.Error("expected AzureKeyVaultSecret no longer to be denied tagging")
+	}
+}
+
+func TestTagVaultObjectsSkipsUnsynced(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetTagsError(testVaultName, autorest.DetailedError{StatusCode: http.StatusInternalServerError})
+	f.addAzureKeyVaultSecret(azureKeyVaultSecretWithOutput())
+
+	f.controller.tagVaultObjects()
+	if calls := f.vault.Calls("SetTags"); calls != 0 {
+		t.Errorf("expected unsynced AzureKeyVaultSecret not to be tagged, got %d calls", calls)
+	}
+}
@@ -0,0 +1,309 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/akv2k8s"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const metricsNamespace = "akv2k8s_controller"
+
+// RegisterBuildInfoMetric registers the build_info metric, always 1 and labeled with the version
+// and build details of the controller, so the version running in each cluster can be found
+func RegisterBuildInfoMetric(registerer prometheus.Registerer) error {
+	info := akv2k8s.GetInfo()
+	buildInfo := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "build_info",
+		Help:      "Version and build details of the controller, always 1",
+		ConstLabels: prometheus.Labels{
+			"version":    info.Version,
+			"git_commit": info.GitCommit,
+			"build_date": info.BuildDate,
+			"go_version": info.GoVersion,
+		},
+	})
+	buildInfo.Set(1)
+	return registerer.Register(buildInfo)
+}
+
+var (
+	// rotationPropagation is the time from a new version being created in Azure Key Vault until
+	// the Kubernetes Secret is updated with it, over all AzureKeyVaultSecrets
+	rotationPropagation = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "rotation_propagation_seconds",
+		Help:      "Seconds from a new version being created in Azure Key Vault until the Kubernetes Secret is updated with it",
+		Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600},
+	})
+
+	// lastRotationPropagation is the rotationPropagation of the latest rotation of each AzureKeyVaultSecret
+	lastRotationPropagation = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "last_rotation_propagation_seconds",
+		Help:      "Seconds from a new version being created in Azure Key Vault until the Kubernetes Secret was updated with it, for the latest rotation of each AzureKeyVaultSecret",
+	}, []string{"namespace", "name"})
+
+	// rotationAnomalies counts the times each AzureKeyVaultSecret rotated far more often than its baseline
+	rotationAnomalies = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rotation_anomalies_total",
+		Help:      "Total number of times the AzureKeyVaultSecret rotated far more often than its baseline",
+	}, []string{"namespace", "name"})
+)
+
+// RegisterRotationMetrics registers metrics for how long rotated objects in Azure Key Vault take
+// to reach their Kubernetes Secrets, aggregated and for the latest rotation of each AzureKeyVaultSecret,
+// and for AzureKeyVaultSecrets rotating far more often than their baseline
+func RegisterRotationMetrics(registerer prometheus.Registerer) error {
+	for _, collector := range []prometheus.Collector{rotationPropagation, lastRotationPropagation, rotationAnomalies} {
+		if err := registerer.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// observeRotationPropagation records the time from a version being created until now
+func observeRotationPropagation(namespace, name string, created time.Time, now time.Time) {
+	seconds := now.Sub(created).Seconds()
+	if seconds < 0 {
+		// Clock skew between Azure and the controller
+		seconds = 0
+	}
+	rotationPropagation.Observe(seconds)
+	lastRotationPropagation.WithLabelValues(namespace, name).Set(seconds)
+}
+
+// deleteRotationMetrics removes the metrics of a deleted AzureKeyVaultSecret
+func deleteRotationMetrics(namespace, name string) {
+	lastRotationPropagation.DeleteLabelValues(namespace, name)
+	rotationAnomalies.DeleteLabelValues(namespace, name)
+}
+
+var (
+	// vaultReachable is the result of the latest probe of each Azure Key Vault
+	vaultReachable = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "vault_reachable",
+		Help:      "1 if the latest probe of the Azure Key Vault succeeded, 0 if it could not be reached or denied the controller",
+	}, []string{"vault", "credential_set", "object_type"})
+
+	// vaultProbeFailures counts failed probes of each Azure Key Vault by the reason of the failure
+	vaultProbeFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "vault_probe_failures_total",
+		Help:      "Total number of failed probes of the Azure Key Vault, by reason",
+	}, []string{"vault", "credential_set", "object_type", "reason"})
+)
+
+// RegisterVaultProbeMetrics registers metrics for the results of probing each Azure Key Vault
+// referenced by AzureKeyVaultSecrets
+func RegisterVaultProbeMetrics(registerer prometheus.Registerer) error {
+	for _, collector := range []prometheus.Collector{vaultReachable, vaultProbeFailures} {
+		if err := registerer.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// observeVaultProbe records the result of probing the vault, with reason empty if it succeeded
+func observeVaultProbe(probe vaultProbe, reason string) {
+	labels := []string{probe.vaultName, probe.credentialSet, string(probe.objectType)}
+	if reason == "" {
+		vaultReachable.WithLabelValues(labels...).Set(1)
+		return
+	}
+	vaultReachable.WithLabelValues(labels...).Set(0)
+	vaultProbeFailures.WithLabelValues(append(labels, reason)...).Inc()
+}
+
+// deleteVaultProbeMetrics removes the metrics of a vault no longer referenced by any AzureKeyVaultSecret
+func deleteVaultProbeMetrics(probe vaultProbe) {
+	vaultReachable.DeleteLabelValues(probe.vaultName, probe.credentialSet, string(probe.objectType))
+}
+
+var (
+	// credentialsHealthy is the result of the latest check of the credentials of each credential set
+	credentialsHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "credentials_healthy",
+		Help:      "1 if Azure accepted the credentials of the credential set in the latest check, 0 if rejected, -1 if the check failed for other reasons",
+	}, []string{"credential_set"})
+)
+
+// RegisterCredentialCheckMetrics registers metrics for the results of checking the credentials of each credential set
+func RegisterCredentialCheckMetrics(registerer prometheus.Registerer) error {
+	return registerer.Register(credentialsHealthy)
+}
+
+// observeCredentialCheck records the result of checking the credentials of the credential set
+func observeCredentialCheck(credentialSet string, status corev1.ConditionStatus) {
+	value := -1.0
+	switch status {
+	case corev1.ConditionTrue:
+		value = 1
+	case corev1.ConditionFalse:
+		value = 0
+	}
+	credentialsHealthy.WithLabelValues(credentialSet).Set(value)
+}
+
+// deleteCredentialCheckMetrics removes the metrics of a credential set no longer used by any AzureKeyVaultSecret
+func deleteCredentialCheckMetrics(credentialSet string) {
+	credentialsHealthy.DeleteLabelValues(credentialSet)
+}
+
+var (
+	// startupReconcileTotal is the number of AzureKeyVaultSecrets synced by the startup reconciliation pass
+	startupReconcileTotal = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "startup_reconcile_total",
+		Help:      "Number of AzureKeyVaultSecrets to reconcile with their Secrets when the controller starts",
+	})
+
+	// startupReconcileDone is the number of AzureKeyVaultSecrets synced so far by the startup reconciliation pass
+	startupReconcileDone = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "startup_reconcile_done",
+		Help:      "Number of AzureKeyVaultSecrets reconciled with their Secrets so far since the controller started, successfully or not",
+	})
+)
+
+// RegisterStartupReconcileMetrics registers metrics for the progress of reconciling every AzureKeyVaultSecret
+// with its Secret when the controller starts
+func RegisterStartupReconcileMetrics(registerer prometheus.Registerer) error {
+	for _, collector := range []prometheus.Collector{startupReconcileTotal, startupReconcileDone} {
+		if err := registerer.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queueMetricsProvider exports the metrics of the controller queues to Prometheus, labeled
+// with the name of each queue, so the queue slowing down syncs can be found
+type queueMetricsProvider struct {
+	depth                   *prometheus.GaugeVec
+	adds                    *prometheus.CounterVec
+	latency                 *prometheus.HistogramVec
+	workDuration            *prometheus.HistogramVec
+	unfinishedWork          *prometheus.GaugeVec
+	longestRunningProcessor *prometheus.GaugeVec
+	retries                 *prometheus.CounterVec
+}
+
+// RegisterQueueMetrics registers metrics for the depth, adds, latency, work duration and retries of
+// each controller queue. Must be called before NewController, as queue metrics are set up when created.
+func RegisterQueueMetrics(registerer prometheus.Registerer) error {
+	provider := newQueueMetricsProvider()
+	for _, collector := range provider.collectors() {
+		if err := registerer.Register(collector); err != nil {
+			return err
+		}
+	}
+	workqueue.SetProvider(provider)
+	return nil
+}
+
+func newQueueMetricsProvider() *queueMetricsProvider {
+	labels := []string{"name"}
+	return &queueMetricsProvider{
+		depth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "workqueue",
+			Name:      "depth",
+			Help:      "Current depth of workqueue",
+		}, labels),
+		adds: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "workqueue",
+			Name:      "adds_total",
+			Help:      "Total number of adds handled by workqueue",
+		}, labels),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "workqueue",
+			Name:      "queue_duration_seconds",
+			Help:      "How long in seconds an item stays in workqueue before being processed",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+		}, labels),
+		workDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "workqueue",
+			Name:      "work_duration_seconds",
+			Help:      "How long in seconds processing an item from workqueue takes",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+		}, labels),
+		unfinishedWork: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "workqueue",
+			Name:      "unfinished_work_seconds",
+			Help:      "Seconds of work in progress not yet observed by work_duration_seconds. Large values indicate stuck workers.",
+		}, labels),
+		longestRunningProcessor: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "workqueue",
+			Name:      "longest_running_processor_seconds",
+			Help:      "How many seconds the longest running processor of workqueue has been running",
+		}, labels),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "workqueue",
+			Name:      "retries_total",
+			Help:      "Total number of retries handled by workqueue",
+		}, labels),
+	}
+}
+
+func (p *queueMetricsProvider) collectors() []prometheus.Collector {
+	return []prometheus.Collector{p.depth, p.adds, p.latency, p.workDuration, p.unfinishedWork, p.longestRunningProcessor, p.retries}
+}
+
+func (p *queueMetricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return p.depth.WithLabelValues(name)
+}
+
+func (p *queueMetricsProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return p.adds.WithLabelValues(name)
+}
+
+func (p *queueMetricsProvider) NewLatencyMetric(name string) workqueue.HistogramMetric {
+	return p.latency.WithLabelValues(name)
+}
+
+func (p *queueMetricsProvider) NewWorkDurationMetric(name string) workqueue.HistogramMetric {
+	return p.workDuration.WithLabelValues(name)
+}
+
+func (p *queueMetricsProvider) NewUnfinishedWorkSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return p.unfinishedWork.WithLabelValues(name)
+}
+
+func (p *queueMetricsProvider) NewLongestRunningProcessorSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return p.longestRunningProcessor.WithLabelValues(name)
+}
+
+func (p *queueMetricsProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return p.retries.WithLabelValues(name)
+}
@@ -0,0 +1,141 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/akv2k8s"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestQueueMetricsProvider(t *testing.T) {
+	provider := newQueueMetricsProvider()
+	registry := prometheus.NewRegistry()
+	for _, collector := range provider.collectors() {
+		registry.MustRegister(collector)
+	}
+
+	provider.NewDepthMetric("AzureKeyVault").Inc()
+	provider.NewRetriesMetric("AzureKeyVault").Inc()
+	provider.NewAddsMetric("Secrets").Inc()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			name := family.GetName() + "/" + metric.Label[0].GetValue()
+			switch {
+			case metric.Gauge != nil:
+				values[name] = metric.Gauge.GetValue()
+			case metric.Counter != nil:
+				values[name] = metric.Counter.GetValue()
+			}
+		}
+	}
+
+	expected := map[string]float64{
+		"akv2k8s_controller_workqueue_depth/AzureKeyVault":         1,
+		"akv2k8s_controller_workqueue_retries_total/AzureKeyVault": 1,
+		"akv2k8s_controller_workqueue_adds_total/Secrets":          1,
+	}
+	for name, value := range expected {
+		if values[name] != value {
+			t.Errorf("expected metric %s to be %v, got %v", name, value, values[name])
+		}
+	}
+}
+
+// Ensures queueMetricsProvider keeps implementing all metrics of the workqueue
+var _ workqueue.MetricsProvider = &queueMetricsProvider{}
+
+func TestBuildInfoMetric(t *testing.T) {
+	defer func(version string) { akv2k8s.Version = version }(akv2k8s.Version)
+	akv2k8s.Version = "1.2.0"
+
+	registry := prometheus.NewRegistry()
+	if err := RegisterBuildInfoMetric(registry); err != nil {
+		t.Fatal(err)
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 1 || families[0].GetName() != "akv2k8s_controller_build_info" {
+		t.Fatalf("expected build_info metric, got %v", families)
+	}
+
+	metric := families[0].Metric[0]
+	if metric.Gauge.GetValue() != 1 {
+		t.Errorf("expected build_info to be 1, got %v", metric.Gauge.GetValue())
+	}
+	for _, label := range metric.Label {
+		if label.GetName() == "version" && label.GetValue() != "1.2.0" {
+			t.Errorf("expected version label '1.2.0', got '%s'", label.GetValue())
+		}
+	}
+}
+
+func TestRotationPropagationMetrics(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	// Other tests rotate AzureKeyVaultSecrets of the same name
+	deleteRotationMetrics(akvs.Namespace, akvs.Name)
+	defer deleteRotationMetrics(akvs.Namespace, akvs.Name)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+
+	// The first version synced is not a rotation
+	if count := testutil.CollectAndCount(lastRotationPropagation); count != 0 {
+		t.Fatalf("expected no rotation propagation metric before rotation, got %d", count)
+	}
+
+	f.vault.Now = func() time.Time { return time.Now().Add(-2 * time.Minute) }
+	f.vault.SetSecret(testVaultName, "my-secret", "second-value")
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+
+	seconds := testutil.ToFloat64(lastRotationPropagation.WithLabelValues(akvs.Namespace, akvs.Name))
+	if seconds < 120 || seconds > 180 {
+		t.Errorf("expected rotation propagation of about 120 seconds, got %v", seconds)
+	}
+
+	deleteRotationMetrics(akvs.Namespace, akvs.Name)
+	if count := testutil.CollectAndCount(lastRotationPropagation); count != 0 {
+		t.Errorf("expected rotation propagation metric to be removed, got %d", count)
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	kubeinformers "k8s.io/client-go/informers"
+
+	akvInformers "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/client/informers/externalversions"
+)
+
+// NamespaceFilter controls which namespaces a controller instance owns, allowing
+// multiple controllers in the same cluster to each handle separate namespaces
+type NamespaceFilter struct {
+	// Watch is the namespaces to handle. If empty all namespaces are handled
+	Watch []string
+
+	// Ignore is the namespaces never to handle
+	Ignore []string
+}
+
+// Includes returns true if resources in namespace should be handled
+func (f NamespaceFilter) Includes(namespace string) bool {
+	for _, ns := range f.Ignore {
+		if ns == namespace {
+			return false
+		}
+	}
+
+	if len(f.Watch) == 0 {
+		return true
+	}
+	for _, ns := range f.Watch {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// KubeInformerOptions returns options scoping a Kubernetes informer factory to the watched namespace,
+// if only one. Other namespaces, and ignored namespaces, are filtered by Includes when handling events,
+// as the factory also lists cluster scoped Namespaces that cannot be filtered by namespace server side.
+func (f NamespaceFilter) KubeInformerOptions() []kubeinformers.SharedInformerOption {
+	if len(f.Watch) != 1 {
+		return nil
+	}
+	return []kubeinformers.SharedInformerOption{kubeinformers.WithNamespace(f.Watch[0])}
+}
+
+// AkvsInformerOptions returns options scoping an AzureKeyVaultSecret informer factory to the watched namespace, if only one
+func (f NamespaceFilter) AkvsInformerOptions() []akvInformers.SharedInformerOption {
+	if len(f.Watch) != 1 {
+		return nil
+	}
+	return []akvInformers.SharedInformerOption{akvInformers.WithNamespace(f.Watch[0])}
+}
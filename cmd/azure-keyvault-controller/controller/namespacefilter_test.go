@@ -0,0 +1,54 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+)
+
+func TestNamespaceFilterIncludes(t *testing.T) {
+	tests := []struct {
+		name      string
+		filter    NamespaceFilter
+		namespace string
+		expected  bool
+	}{
+		{"no filter", NamespaceFilter{}, "default", true},
+		{"watched", NamespaceFilter{Watch: []string{"team-a", "team-b"}}, "team-b", true},
+		{"not watched", NamespaceFilter{Watch: []string{"team-a", "team-b"}}, "team-c", false},
+		{"ignored", NamespaceFilter{Ignore: []string{"kube-system"}}, "kube-system", false},
+		{"not ignored", NamespaceFilter{Ignore: []string{"kube-system"}}, "default", true},
+		{"watched and ignored", NamespaceFilter{Watch: []string{"team-a"}, Ignore: []string{"team-a"}}, "team-a", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if included := test.filter.Includes(test.namespace); included != test.expected {
+				t.Errorf("expected Includes('%s') to be %t, got %t", test.namespace, test.expected, included)
+			}
+		})
+	}
+}
+
+func TestNamespaceFilterInformerOptions(t *testing.T) {
+	if options := (NamespaceFilter{Watch: []string{"team-a"}}).AkvsInformerOptions(); len(options) != 1 {
+		t.Errorf("expected informers to be scoped to a single watched namespace, got %d options", len(options))
+	}
+	if options := (NamespaceFilter{Watch: []string{"team-a", "team-b"}}).KubeInformerOptions(); len(options) != 0 {
+		t.Errorf("expected informers to watch all namespaces when watching multiple namespaces, got %d options", len(options))
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sync"
+
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// publicCertificates keeps track of whether AzureKeyVaultSecrets of certificates were last synced with only the
+// public certificate, as the private key is not exportable, so the NotExportable condition is kept when their status
+// is updated. It is unknown until the certificate has been downloaded, like after a restart.
+type publicCertificates struct {
+	mutex sync.Mutex
+	keys  map[string]bool
+}
+
+func newPublicCertificates() *publicCertificates {
+	return &publicCertificates{keys: make(map[string]bool)}
+}
+
+func (p *publicCertificates) set(key string, publicOnly bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.keys[key] = publicOnly
+}
+
+// get returns whether only the public certificate was synced, and false as second value if unknown
+func (p *publicCertificates) get(key string) (bool, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	publicOnly, known := p.keys[key]
+	return publicOnly, known
+}
+
+func (p *publicCertificates) forget(key string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.keys, key)
+}
+
+// shouldFallBackToPublicCertificate returns true if the private key of the certificate is not
+// exportable, and the AzureKeyVaultSecret allows writing only the public certificate
+func shouldFallBackToPublicCertificate(azureKeyVaultSecret *akv.AzureKeyVaultSecret, err error) bool {
+	return azureKeyVaultSecret.Spec.Vault.Object.Type == akv.AzureKeyVaultObjectTypeCertificate &&
+		azureKeyVaultSecret.Spec.Output.Secret.PublicCertificateFallback &&
+		vault.IsNotExportable(err)
+}
+
+// isNotExportableWithReason returns true if the NotExportable condition is true with the given reason
+func isNotExportableWithReason(status *akv.AzureKeyVaultSecretStatus, reason string) bool {
+	condition := getCondition(status, akv.AzureKeyVaultSecretConditionNotExportable)
+	return condition != nil && condition.Status == corev1.ConditionTrue && condition.Reason == reason
+}
+
+// updateNotExportableCondition sets the NotExportable condition with reason PublicCertificateOnly if the
+// Secret was written with only the public certificate, and clears it if the private key was exported
+func (c *Controller) updateNotExportableCondition(azureKeyVaultSecret *akv.AzureKeyVaultSecret, status *akv.AzureKeyVaultSecretStatus, secretName string, now metav1.Time) {
+	publicOnly, known := c.publicCertificates.get(azureKeyVaultSecret.Namespace + "/" + azureKeyVaultSecret.Name)
+	if !known {
+		return
+	}
+	if !publicOnly {
+		clearCondition(status, akv.AzureKeyVaultSecretConditionNotExportable, "Exported", "Private key of the certificate is exported", now)
+		return
+	}
+
+	vaultSpec := azureKeyVaultSecret.Spec.Vault
+	setCondition(status, akv.AzureKeyVaultSecretCondition{
+		Type:    akv.AzureKeyVaultSecretConditionNotExportable,
+		Status:  corev1.ConditionTrue,
+		Reason:  PublicCertificateOnly,
+		Message: fmt.Sprintf(MessagePublicCertificateOnly, vaultSpec.Object.Name, vaultSpec.Name, secretName),
+	}, now)
+}
+
+// recordPublicCertificateOnly records an Event when the AzureKeyVaultSecret starts writing only the public certificate
+func (c *Controller) recordPublicCertificateOnly(azureKeyVaultSecret *akv.AzureKeyVaultSecret, secretName string) {
+	publicOnly, _ := c.publicCertificates.get(azureKeyVaultSecret.Namespace + "/" + azureKeyVaultSecret.Name)
+	if !publicOnly || isNotExportableWithReason(&azureKeyVaultSecret.Status, PublicCertificateOnly) {
+		return
+	}
+
+	vaultSpec := azureKeyVaultSecret.Spec.Vault
+	msg := fmt.Sprintf(MessagePublicCertificateOnly, vaultSpec.Object.Name, vaultSpec.Name, secretName)
+	newLogger(azureKeyVaultSecret).Warning(msg)
+	c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, PublicCertificateOnly, msg)
+}
+
+// handleNotExportable reports that the private key of the certificate cannot be exported from Azure Key Vault,
+// instead of the generic failure, as retrying will not help until the certificate policy is changed
+func (c *Controller) handleNotExportable(azureKeyVaultSecret *akv.AzureKeyVaultSecret, err error) error {
+	vaultSpec := azureKeyVaultSecret.Spec.Vault
+	msg := fmt.Sprintf(MessageCertificateNotExportable, vaultSpec.Object.Name, vaultSpec.Name)
+	logger := newLogger(azureKeyVaultSecret)
+	logger.WithError(err).Error(msg)
+	if !isNotExportableWithReason(&azureKeyVaultSecret.Status, ErrCertificateNotExportable) {
+		c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, ErrCertificateNotExportable, msg)
+	}
+
+	now := c.clock.Now()
+	statusErr := c.mutateAzureKeyVaultSecretStatus(azureKeyVaultSecret, func(status *akv.AzureKeyVaultSecretStatus) {
+		setCondition(status, akv.AzureKeyVaultSecretCondition{
+			Type:    akv.AzureKeyVaultSecretConditionNotExportable,
+			Status:  corev1.ConditionTrue,
+			Reason:  ErrCertificateNotExportable,
+			Message: msg,
+		}, now)
+	})
+	if statusErr != nil {
+		logger.WithError(statusErr).Error("failed to update status for AzureKeyVaultSecret")
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func tlsCertificateAzureKeyVaultSecret() *akv.AzureKeyVaultSecret {
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Spec.Vault.Object.Name = "my-cert"
+	akvs.Spec.Vault.Object.Type = akv.AzureKeyVaultObjectTypeCertificate
+	akvs.Spec.Output.Secret.Type = corev1.SecretTypeTLS
+	akvs.Spec.Output.Secret.DataKey = ""
+	return akvs
+}
+
+func TestCertificateNotExportable(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetCertificate(testVaultName, "my-cert", pemCert)
+	f.vault.SetNotExportable(testVaultName, "my-cert", true)
+
+	akvs := tlsCertificateAzureKeyVaultSecret()
+	f.addAzureKeyVaultSecret(akvs)
+	err := f.controller.syncAzureKeyVaultSecret(key(akvs))
+	if !vault.IsNotExportable(err) {
+		t.Fatalf("expected not exportable error, got %v", err)
+	}
+	f.expectEvent(ErrCertificateNotExportable)
+
+	status := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status
+	if !isNotExportableWithReason(&status, ErrCertificateNotExportable) {
+		t.Errorf("expected NotExportable condition, got %+v", status.Conditions)
+	}
+	if state := SyncState(f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name)); state != "NotExportable" {
+		t.Errorf("expected sync state 'NotExportable', got '%s'", state)
+	}
+}
+
+func TestCertificateNotExportableFallsBackToPublicCertificate(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetCertificate(testVaultName, "my-cert", pemCert)
+	f.vault.SetNotExportable(testVaultName, "my-cert", true)
+
+	akvs := tlsCertificateAzureKeyVaultSecret()
+	akvs.Spec.Output.Secret.PublicCertificateFallback = true
+	f.addAzureKeyVaultSecret(akvs)
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.expectEvent(PublicCertificateOnly)
+
+	secret := f.getSecret(akvs.Namespace, "my-kubernetes-secret")
+	if string(secret.Data[corev1.TLSCertKey]) != pemCertPubOnly {
+		t.Errorf("expected public certificate in %s, got '%s'", corev1.TLSCertKey, string(secret.Data[corev1.TLSCertKey]))
+	}
+	if key, found := secret.Data[corev1.TLSPrivateKeyKey]; !found || len(key) != 0 {
+		t.Errorf("expected empty %s, got '%s'", corev1.TLSPrivateKeyKey, string(key))
+	}
+
+	status := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status
+	if !isNotExportableWithReason(&status, PublicCertificateOnly) {
+		t.Errorf("expected NotExportable condition with reason %s, got %+v", PublicCertificateOnly, status.Conditions)
+	}
+
+	// Exporting the private key once the certificate policy allows it
+	f.refresh(akvs)
+	f.vault.SetNotExportable(testVaultName, "my-cert", false)
+	f.vault.SetCertificate(testVaultName, "my-cert", pemCert)
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	if secret := f.getSecret(akvs.Namespace, "my-kubernetes-secret"); len(secret.Data[corev1.TLSPrivateKeyKey]) == 0 {
+		t.Errorf("expected private key in %s", corev1.TLSPrivateKeyKey)
+	}
+	status = f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status
+	if isConditionTrue(&status, akv.AzureKeyVaultSecretConditionNotExportable) {
+		t.Errorf("expected NotExportable condition to be cleared, got %+v", status.Conditions)
+	}
+}
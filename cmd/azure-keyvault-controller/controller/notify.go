@@ -0,0 +1,154 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+)
+
+// notifyTimeout is the maximum time to wait for a notification to be delivered
+const notifyTimeout = 10 * time.Second
+
+// NotificationType is what happened to a AzureKeyVaultSecret to send a Notification
+type NotificationType string
+
+const (
+	// NotificationRotated is sent when a Secret is updated with a new value from Azure Key Vault
+	NotificationRotated NotificationType = "Rotated"
+
+	// NotificationDegraded is sent when a AzureKeyVaultSecret has failed too many times in a row,
+	// and is marked as Degraded
+	NotificationDegraded NotificationType = "Degraded"
+
+	// NotificationPendingApproval is sent when a new version in Azure Key Vault waits for approval,
+	// with the version to approve as object version
+	NotificationPendingApproval NotificationType = "PendingApproval"
+)
+
+// Notification is sent to all notifiers when a Secret is rotated or a AzureKeyVaultSecret is degraded.
+// It never contains secret values.
+type Notification struct {
+	Type          NotificationType `json:"type"`
+	Namespace     string           `json:"namespace"`
+	Name          string           `json:"name"`
+	Secret        string           `json:"secret"`
+	Vault         string           `json:"vault"`
+	Object        string           `json:"object"`
+	ObjectVersion string           `json:"objectVersion,omitempty"`
+	Message       string           `json:"message"`
+	Time          time.Time        `json:"time"`
+}
+
+// String returns the notification as a single line of text for chat services
+func (n Notification) String() string {
+	return fmt.Sprintf("AzureKeyVaultSecret '%s/%s' %s: %s", n.Namespace, n.Name, n.Type, n.Message)
+}
+
+// Notifier delivers notifications somewhere outside the cluster
+type Notifier interface {
+	Notify(notification Notification) error
+}
+
+type webhookNotifier struct {
+	url     string
+	client  *http.Client
+	payload func(notification Notification) interface{}
+}
+
+// NewWebhookNotifier returns a Notifier posting each Notification as JSON to url
+func NewWebhookNotifier(url string) Notifier {
+	return newWebhookNotifier(url, func(notification Notification) interface{} {
+		return notification
+	})
+}
+
+// NewSlackNotifier returns a Notifier posting to a Slack incoming webhook url
+func NewSlackNotifier(url string) Notifier {
+	return newWebhookNotifier(url, textPayload)
+}
+
+// NewTeamsNotifier returns a Notifier posting to a Microsoft Teams incoming webhook url
+func NewTeamsNotifier(url string) Notifier {
+	return newWebhookNotifier(url, textPayload)
+}
+
+func newWebhookNotifier(url string, payload func(notification Notification) interface{}) *webhookNotifier {
+	return &webhookNotifier{
+		url:     url,
+		client:  &http.Client{Timeout: notifyTimeout},
+		payload: payload,
+	}
+}
+
+// textPayload is the message format accepted by both Slack and Microsoft Teams incoming webhooks
+func textPayload(notification Notification) interface{} {
+	return map[string]string{"text": notification.String()}
+}
+
+// Notify posts the notification, failing if not answered with a 2xx status code
+func (n *webhookNotifier) Notify(notification Notification) error {
+	body, err := json.Marshal(n.payload(notification))
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.client.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("notification rejected with status %s", resp.Status)
+	}
+	return nil
+}
+
+// notify sends a notification about the AzureKeyVaultSecret to all notifiers. Notifications are
+// sent in the background, so a slow or failing notifier never holds up syncs.
+func (c *Controller) notify(notificationType NotificationType, azureKeyVaultSecret *akv.AzureKeyVaultSecret, objectVersion string, msg string) {
+	if len(c.options.Notifiers) == 0 {
+		return
+	}
+
+	notification := Notification{
+		Type:          notificationType,
+		Namespace:     azureKeyVaultSecret.Namespace,
+		Name:          azureKeyVaultSecret.Name,
+		Secret:        determineSecretName(azureKeyVaultSecret),
+		Vault:         azureKeyVaultSecret.Spec.Vault.Name,
+		Object:        azureKeyVaultSecret.Spec.Vault.Object.Name,
+		ObjectVersion: objectVersion,
+		Message:       msg,
+		Time:          c.clock.Now().Time,
+	}
+
+	logger := newLogger(azureKeyVaultSecret).WithField("notification", notificationType)
+	for _, notifier := range c.options.Notifiers {
+		go func(notifier Notifier) {
+			if err := notifier.Notify(notification); err != nil {
+				logger.WithError(err).Warning("failed to send notification")
+			}
+		}(notifier)
+	}
+}
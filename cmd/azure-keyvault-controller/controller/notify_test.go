@@ -0,0 +1,115 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type channelNotifier chan Notification
+
+func (n channelNotifier) Notify(notification Notification) error {
+	n <- notification
+	return nil
+}
+
+func (n channelNotifier) expect(t *testing.T, notificationType NotificationType) Notification {
+	t.Helper()
+	select {
+	case notification := <-n:
+		if notification.Type != notificationType {
+			t.Errorf("expected %s notification, got %s", notificationType, notification.Type)
+		}
+		return notification
+	case <-time.After(time.Second):
+		t.Fatalf("expected %s notification", notificationType)
+		return Notification{}
+	}
+}
+
+func TestWebhookNotifiers(t *testing.T) {
+	notification := Notification{Type: NotificationRotated, Namespace: "default", Name: "my-akvs", Message: "rotated"}
+
+	tests := []struct {
+		name     string
+		notifier func(url string) Notifier
+		expected string
+	}{
+		{"webhook", NewWebhookNotifier, "my-akvs"},
+		{"slack", NewSlackNotifier, "AzureKeyVaultSecret 'default/my-akvs' Rotated: rotated"},
+		{"teams", NewTeamsNotifier, "AzureKeyVaultSecret 'default/my-akvs' Rotated: rotated"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var body map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Error(err)
+				}
+			}))
+			defer server.Close()
+
+			if err := test.notifier(server.URL).Notify(notification); err != nil {
+				t.Fatal(err)
+			}
+			if body["name"] != test.expected && body["text"] != test.expected {
+				t.Errorf("expected payload with %q, got %v", test.expected, body)
+			}
+		})
+	}
+}
+
+func TestWebhookNotifierFailsOnErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	if err := NewWebhookNotifier(server.URL).Notify(Notification{}); err == nil {
+		t.Error("expected error when notification is rejected")
+	}
+}
+
+func TestSyncNotifiesOnRotation(t *testing.T) {
+	f := newFixture(t)
+	notifications := make(channelNotifier, 1)
+	f.controller.options.Notifiers = []Notifier{notifications}
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+
+	version := f.vault.SetSecret(testVaultName, "my-secret", "second-value")
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+
+	notification := notifications.expect(t, NotificationRotated)
+	if notification.Secret != "my-kubernetes-secret" || notification.ObjectVersion != version {
+		t.Errorf("expected notification for secret 'my-kubernetes-secret' at version '%s', got %+v", version, notification)
+	}
+}
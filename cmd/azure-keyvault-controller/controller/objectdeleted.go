@@ -0,0 +1,178 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// objectDeletedPolicy returns the OnObjectDeleted policy of the AzureKeyVaultSecret, defaulting to KeepLastKnown
+func objectDeletedPolicy(azureKeyVaultSecret *akv.AzureKeyVaultSecret) akv.AzureKeyVaultObjectDeletedPolicy {
+	if azureKeyVaultSecret.Spec.OnObjectDeleted == "" {
+		return akv.AzureKeyVaultObjectDeletedPolicyKeepLastKnown
+	}
+	return azureKeyVaultSecret.Spec.OnObjectDeleted
+}
+
+// isObjectDeleted returns true if err means the object of the AzureKeyVaultSecret has been deleted in
+// Azure Key Vault. An object not found that was never synced, like one with a misspelled name, is
+// a plain failure and not considered deleted.
+func isObjectDeleted(azureKeyVaultSecret *akv.AzureKeyVaultSecret, err error) bool {
+	if vault.IsSoftDeleted(err) {
+		return true
+	}
+	synced := azureKeyVaultSecret.Status.SecretHash != "" || azureKeyVaultSecret.Status.ObjectVersion != ""
+	return synced && vault.IsNotFound(err)
+}
+
+// isSecretDeletedWithObject returns true if the output Secret of the AzureKeyVaultSecret has been
+// deleted by the DeleteSecret policy, and must not be recreated before the object exists again
+func isSecretDeletedWithObject(azureKeyVaultSecret *akv.AzureKeyVaultSecret) bool {
+	return isConditionTrue(&azureKeyVaultSecret.Status, akv.AzureKeyVaultSecretConditionObjectDeleted) &&
+		objectDeletedPolicy(azureKeyVaultSecret) == akv.AzureKeyVaultObjectDeletedPolicyDeleteSecret
+}
+
+// handleDeletedObject moves a AzureKeyVaultSecret whose object is deleted in Azure Key Vault to the
+// ObjectDeleted state. The OnObjectDeleted policy is applied when entering the state, after which the
+// object is polled with exponential backoff instead of failing and being retried by the queue rate
+// limiter. The state is left in updateAzureKeyVaultSecretStatus, once the object is synced again.
+func (c *Controller) handleDeletedObject(azureKeyVaultSecret *akv.AzureKeyVaultSecret, key string, err error) error {
+	vaultSpec := azureKeyVaultSecret.Spec.Vault
+	policy := objectDeletedPolicy(azureKeyVaultSecret)
+	logger := newLogger(azureKeyVaultSecret).WithField("policy", policy)
+
+	softDeleted := vault.IsSoftDeleted(err)
+	reason, msg := ErrAzureVaultObjectDeleted, fmt.Sprintf(MessageAzureKeyVaultObjectDeleted, vaultSpec.Object.Name, vaultSpec.Name, objectDeletedAction(azureKeyVaultSecret, policy))
+	if softDeleted {
+		reason, msg = ErrAzureVaultSoftDeleted, softDeletedMessage(azureKeyVaultSecret)
+	}
+
+	if !isConditionTrue(&azureKeyVaultSecret.Status, akv.AzureKeyVaultSecretConditionObjectDeleted) {
+		logger.WithError(err).Warning(msg)
+		c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, reason, msg)
+
+		// Failing before entering the state, so deleting is retried by the queue
+		if policy == akv.AzureKeyVaultObjectDeletedPolicyDeleteSecret {
+			if err := c.deleteOutputSecret(azureKeyVaultSecret); err != nil {
+				return err
+			}
+		}
+	}
+
+	now := c.clock.Now()
+	failures := azureKeyVaultSecret.Status.RetryCount + 1
+	nextRetry := metav1.NewTime(now.Add(c.azureFrequency.retryDelay(failures)))
+	logger.WithField("retryCount", failures).Infof("Object is deleted in Azure Key Vault, polling it again at %s", nextRetry.Format(time.RFC3339))
+
+	// Not returning an error, so it is not retried by the queue rate limiter
+	c.azureKeyVaultQueue.GetQueue().Forget(key)
+	return c.mutateAzureKeyVaultSecretStatus(azureKeyVaultSecret, func(status *akv.AzureKeyVaultSecretStatus) {
+		status.RetryCount = failures
+		status.NextRetryTime = nextRetry
+		setCondition(status, akv.AzureKeyVaultSecretCondition{
+			Type:    akv.AzureKeyVaultSecretConditionObjectDeleted,
+			Status:  corev1.ConditionTrue,
+			Reason:  string(policy),
+			Message: msg,
+		}, now)
+
+		if softDeleted {
+			setCondition(status, akv.AzureKeyVaultSecretCondition{
+				Type:    akv.AzureKeyVaultSecretConditionSoftDeleted,
+				Status:  corev1.ConditionTrue,
+				Reason:  ErrAzureVaultSoftDeleted,
+				Message: err.Error(),
+			}, now)
+		} else {
+			clearCondition(status, akv.AzureKeyVaultSecretConditionSoftDeleted, "Purged", "Object is purged from Azure Key Vault", now)
+		}
+
+		if policy == akv.AzureKeyVaultObjectDeletedPolicyMarkDegraded {
+			setCondition(status, akv.AzureKeyVaultSecretCondition{
+				Type:    akv.AzureKeyVaultSecretConditionDegraded,
+				Status:  corev1.ConditionTrue,
+				Reason:  reason,
+				Message: msg,
+			}, now)
+		}
+	})
+}
+
+// recordObjectRestored reports that the object of a AzureKeyVaultSecret in the ObjectDeleted state
+// exists in Azure Key Vault again
+func (c *Controller) recordObjectRestored(azureKeyVaultSecret *akv.AzureKeyVaultSecret, vaultName string) {
+	if c.options.DryRun || !isConditionTrue(&azureKeyVaultSecret.Status, akv.AzureKeyVaultSecretConditionObjectDeleted) {
+		return
+	}
+	msg := fmt.Sprintf(MessageAzureKeyVaultObjectRestored, azureKeyVaultSecret.Spec.Vault.Object.Name, vaultName)
+	newLogger(azureKeyVaultSecret).Info(msg)
+	c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeNormal, AzureVaultObjectRestored, msg)
+}
+
+// deleteOutputSecret deletes the output Secret of the AzureKeyVaultSecret, or only removes its keys
+// if the Secret is a bundle or merged into
+func (c *Controller) deleteOutputSecret(azureKeyVaultSecret *akv.AzureKeyVaultSecret) error {
+	secretName := determineSecretName(azureKeyVaultSecret)
+	secret, err := c.secretsLister.Secrets(azureKeyVaultSecret.Namespace).Get(secretName)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if isBundle(azureKeyVaultSecret) {
+		if !isInBundle(azureKeyVaultSecret, secret) {
+			return nil
+		}
+		_, err = c.updateBundleSecret(azureKeyVaultSecret, map[string][]byte{}, azureKeyVaultSecret.Status.ObjectVersion)
+		return err
+	}
+	if !ownsSecret(azureKeyVaultSecret, secret) {
+		return nil
+	}
+	return c.deleteSecret(azureKeyVaultSecret, secretName)
+}
+
+// objectDeletedAction describes what the policy does to the output Secret, for use in messages
+func objectDeletedAction(azureKeyVaultSecret *akv.AzureKeyVaultSecret, policy akv.AzureKeyVaultObjectDeletedPolicy) string {
+	secretName := determineSecretName(azureKeyVaultSecret)
+	switch policy {
+	case akv.AzureKeyVaultObjectDeletedPolicyDeleteSecret:
+		if isBundle(azureKeyVaultSecret) {
+			return fmt.Sprintf("removing its keys from Secret '%s' until it exists again", secretName)
+		}
+		return fmt.Sprintf("deleting Secret '%s' until it exists again", secretName)
+	case akv.AzureKeyVaultObjectDeletedPolicyMarkDegraded:
+		return fmt.Sprintf("keeping last known value in Secret '%s' and marking AzureKeyVaultSecret as Degraded", secretName)
+	default:
+		return fmt.Sprintf("keeping last known value in Secret '%s'", secretName)
+	}
+}
+
+// softDeletedMessage suggests recovering the soft-deleted object of the AzureKeyVaultSecret
+func softDeletedMessage(azureKeyVaultSecret *akv.AzureKeyVaultSecret) string {
+	vaultSpec := azureKeyVaultSecret.Spec.Vault
+	return fmt.Sprintf(MessageAzureKeyVaultObjectSoftDeleted, vaultSpec.Object.Name, vaultSpec.Name, vaultSpec.Object.Type.AzureObjectType(), vaultSpec.Name, vaultSpec.Object.Name)
+}
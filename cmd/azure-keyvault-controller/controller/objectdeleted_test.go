@@ -0,0 +1,165 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// syncedAzureKeyVaultSecret creates a AzureKeyVaultSecret with the policy and syncs it
+// before its object is purged from Azure Key Vault
+func (f *fixture) syncedAzureKeyVaultSecret(policy akv.AzureKeyVaultObjectDeletedPolicy) *akv.AzureKeyVaultSecret {
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Spec.OnObjectDeleted = policy
+	f.addAzureKeyVaultSecret(akvs)
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		f.t.Fatal(err)
+	}
+	f.refresh(akvs)
+	f.drainEvents()
+
+	f.vault.Purge(testVaultName, "secret", "my-secret")
+	return akvs
+}
+
+func TestObjectDeletedKeepsLastKnownValueAndBacksOff(t *testing.T) {
+	f := newFixture(t)
+	f.controller.azureFrequency.Normal = time.Minute
+	f.controller.azureFrequency.Slow = time.Hour
+	akvs := f.syncedAzureKeyVaultSecret("")
+
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.expectEvent(ErrAzureVaultObjectDeleted)
+
+	first := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status
+	condition := getCondition(&first, akv.AzureKeyVaultSecretConditionObjectDeleted)
+	if condition == nil || condition.Reason != string(akv.AzureKeyVaultObjectDeletedPolicyKeepLastKnown) {
+		t.Fatalf("expected ObjectDeleted condition with reason KeepLastKnown, got %+v", condition)
+	}
+	if value := string(f.getSecret(akvs.Namespace, "my-kubernetes-secret").Data["value"]); value != "first-value" {
+		t.Errorf("expected last known value 'first-value', got '%s'", value)
+	}
+
+	// Still deleted, so polling backs off further without recording the deletion again
+	f.refresh(akvs)
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.expectNoEvents()
+	second := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status
+	if second.RetryCount != 2 || !first.NextRetryTime.Before(&second.NextRetryTime) {
+		t.Errorf("expected retry count 2 and later retry than %s, got %d and %s", first.NextRetryTime, second.RetryCount, second.NextRetryTime)
+	}
+
+	f.vault.SetSecret(testVaultName, "my-secret", "second-value")
+	f.refresh(akvs)
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.expectEvent(AzureVaultObjectRestored)
+
+	restored := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status
+	if isConditionTrue(&restored, akv.AzureKeyVaultSecretConditionObjectDeleted) || restored.RetryCount != 0 {
+		t.Errorf("expected ObjectDeleted condition cleared and no retries, got %+v", restored)
+	}
+	if value := string(f.getSecret(akvs.Namespace, "my-kubernetes-secret").Data["value"]); value != "second-value" {
+		t.Errorf("expected restored value 'second-value', got '%s'", value)
+	}
+}
+
+func TestObjectDeletedDeletesSecret(t *testing.T) {
+	f := newFixture(t)
+	akvs := f.syncedAzureKeyVaultSecret(akv.AzureKeyVaultObjectDeletedPolicyDeleteSecret)
+
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.expectEvent(ErrAzureVaultObjectDeleted)
+	if _, err := f.kubeClient.CoreV1().Secrets(akvs.Namespace).Get("my-kubernetes-secret", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Fatalf("expected Secret to be deleted, got %v", err)
+	}
+
+	// The Secret is not recreated while the object is deleted
+	f.refresh(akvs)
+	deleted := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "my-kubernetes-secret", Namespace: akvs.Namespace}}
+	if err := f.kubeInformerFactory.Core().V1().Secrets().Informer().GetIndexer().Delete(deleted); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.kubeClient.CoreV1().Secrets(akvs.Namespace).Get("my-kubernetes-secret", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Fatalf("expected Secret not to be recreated, got %v", err)
+	}
+
+	f.vault.SetSecret(testVaultName, "my-secret", "second-value")
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	if f.controller.akvsCrdQueue.GetQueue().Len() != 1 {
+		t.Fatal("expected AzureKeyVaultSecret to be queued for recreating its Secret")
+	}
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.expectEvent(AzureVaultObjectRestored)
+	if value := string(f.getSecret(akvs.Namespace, "my-kubernetes-secret").Data["value"]); value != "second-value" {
+		t.Errorf("expected recreated value 'second-value', got '%s'", value)
+	}
+}
+
+func TestObjectDeletedMarksDegraded(t *testing.T) {
+	f := newFixture(t)
+	akvs := f.syncedAzureKeyVaultSecret(akv.AzureKeyVaultObjectDeletedPolicyMarkDegraded)
+
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	status := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status
+	if !isConditionTrue(&status, akv.AzureKeyVaultSecretConditionDegraded) || !isConditionTrue(&status, akv.AzureKeyVaultSecretConditionObjectDeleted) {
+		t.Errorf("expected Degraded and ObjectDeleted conditions, got %+v", status.Conditions)
+	}
+	if value := string(f.getSecret(akvs.Namespace, "my-kubernetes-secret").Data["value"]); value != "first-value" {
+		t.Errorf("expected last known value 'first-value', got '%s'", value)
+	}
+}
+
+func TestObjectNeverSyncedIsNotDeleted(t *testing.T) {
+	f := newFixture(t)
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Spec.OnObjectDeleted = akv.AzureKeyVaultObjectDeletedPolicyDeleteSecret
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err == nil {
+		t.Fatal("expected error for object not found in azure key vault")
+	}
+	status := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status
+	if isConditionTrue(&status, akv.AzureKeyVaultSecretConditionObjectDeleted) {
+		t.Error("expected object never synced not to be considered deleted")
+	}
+}
@@ -0,0 +1,225 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"kmodules.xyz/client-go/tools/queue"
+)
+
+// ManagedSecretLabel is added to all Secrets created by the controller, so they can be found
+// even if their owner reference is lost, like when restored from a backup
+const ManagedSecretLabel = "keyvault.azure.spv.no/managed"
+
+// OwnerAnnotation is set on Secrets created by the controller to the name of their AzureKeyVaultSecret,
+// so the shard of an orphaned Secret is known even without an AzureKeyVaultSecret having it as output
+const OwnerAnnotation = "keyvault.azure.spv.no/owner"
+
+// OrphanedSecretPolicy decides what to do with Secrets created by the controller, but no longer owned by
+// their AzureKeyVaultSecret
+type OrphanedSecretPolicy string
+
+const (
+	// OrphanedSecretPolicyAdopt makes the AzureKeyVaultSecret with the Secret as output own it again.
+	// Secrets without such an AzureKeyVaultSecret are only logged.
+	OrphanedSecretPolicyAdopt OrphanedSecretPolicy = "adopt"
+
+	// OrphanedSecretPolicyDelete adopts Secrets like OrphanedSecretPolicyAdopt, and deletes Secrets
+	// without an AzureKeyVaultSecret having them as output
+	OrphanedSecretPolicyDelete OrphanedSecretPolicy = "delete"
+)
+
+// runOrphanedSecretSweeper looks for orphaned Secrets every OrphanedSecretInterval until stopCh is closed
+func (c *Controller) runOrphanedSecretSweeper(stopCh <-chan struct{}) {
+	if c.options.OrphanedSecretPolicy == "" || c.options.OrphanedSecretInterval <= 0 {
+		return
+	}
+	go runUntil(c.clock, c.sweepOrphanedSecrets, c.options.OrphanedSecretInterval, stopCh)
+}
+
+// sweepOrphanedSecrets adopts or deletes Secrets labeled as managed by the controller, but
+// not owned by an AzureKeyVaultSecret, according to OrphanedSecretPolicy
+func (c *Controller) sweepOrphanedSecrets() {
+	selector := labels.SelectorFromSet(labels.Set{ManagedSecretLabel: "true"})
+	secrets, err := c.secretsLister.List(selector)
+	if err != nil {
+		log.Errorf("failed to list Secrets to look for orphaned Secrets: %v", err)
+		return
+	}
+
+	for _, secret := range secrets {
+		if err := c.sweepOrphanedSecret(secret); err != nil {
+			log.Errorf("failed to handle orphaned Secret '%s'/'%s': %v", secret.Namespace, secret.Name, err)
+		}
+	}
+}
+
+func (c *Controller) sweepOrphanedSecret(secret *corev1.Secret) error {
+	ownerRef := metav1.GetControllerOf(secret)
+	if ownerRef != nil && ownerRef.Kind != "AzureKeyVaultSecret" {
+		// Controlled by someone else, so leave it alone
+		return nil
+	}
+	if isBundleSecret(secret) {
+		// Bundle Secrets are pruned when AzureKeyVaultSecrets no longer contribute to them
+		return nil
+	}
+
+	owner, err := c.findSecretOutputOwner(secret.Namespace, secret.Name)
+	if err != nil {
+		return err
+	}
+
+	if owner != nil {
+		if !c.isHandled(owner.Namespace, owner.Name) || owner.DeletionTimestamp != nil {
+			return nil
+		}
+		if ownerRef != nil && ownerRef.UID == owner.UID {
+			return nil
+		}
+		return c.adoptSecret(owner, secret)
+	}
+
+	// Secrets with an owner reference to a deleted AzureKeyVaultSecret are deleted by the garbage collector
+	if ownerRef != nil {
+		return nil
+	}
+
+	logger := log.WithFields(log.Fields{"namespace": secret.Namespace, "secret": secret.Name})
+	ownerName := secret.Annotations[OwnerAnnotation]
+	if ownerName == "" && c.options.Shard.Count > 1 {
+		// Without the name of its AzureKeyVaultSecret the shard of the Secret is unknown
+		logger.Debug("Orphaned Secret has no owner annotation, leaving it to avoid handling it in multiple shards")
+		return nil
+	}
+	if !c.isHandled(secret.Namespace, ownerName) {
+		return nil
+	}
+
+	if c.options.OrphanedSecretPolicy != OrphanedSecretPolicyDelete {
+		logger.Warning("Secret created by AzureKeyVaultSecret has no owner, and no AzureKeyVaultSecret has it as output")
+		return nil
+	}
+
+	if c.options.DryRun {
+		logger.WithField("dryRun", true).Info("Dry run: would delete orphaned Secret")
+		return nil
+	}
+
+	logger.Info("Deleting orphaned Secret, as no AzureKeyVaultSecret has it as output")
+	uid := secret.UID
+	err = c.kubeclientset.CoreV1().Secrets(secret.Namespace).Delete(secret.Name, &metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &uid},
+	})
+	if errors.IsNotFound(err) || errors.IsConflict(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.auditSecret(AuditActionDelete, secret.Namespace, secret.Name, nil, "", nil)
+	return nil
+}
+
+// findSecretOutputOwner returns the AzureKeyVaultSecret having the Secret as output, or nil if none.
+// An error is returned if multiple AzureKeyVaultSecrets have the Secret as output, as the owner is ambiguous.
+func (c *Controller) findSecretOutputOwner(namespace, secretName string) (*akv.AzureKeyVaultSecret, error) {
+	azureKeyVaultSecrets, err := c.azureKeyVaultSecretLister.AzureKeyVaultSecrets(namespace).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	var owners []*akv.AzureKeyVaultSecret
+	for _, azureKeyVaultSecret := range azureKeyVaultSecrets {
+		if c.akvsHasSecretOutput(azureKeyVaultSecret) && determineSecretName(azureKeyVaultSecret) == secretName {
+			owners = append(owners, azureKeyVaultSecret)
+		}
+	}
+
+	switch len(owners) {
+	case 0:
+		return nil, nil
+	case 1:
+		return owners[0], nil
+	}
+
+	names := make([]string, len(owners))
+	for i, owner := range owners {
+		names[i] = owner.Name
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("secret '%s'/'%s' is output of multiple azurekeyvaultsecrets (%s), skipping it", namespace, secretName, strings.Join(names, ", "))
+}
+
+// adoptSecret makes the AzureKeyVaultSecret the controller of the Secret again, replacing any
+// owner reference to an earlier AzureKeyVaultSecret with the same name, and syncs it
+func (c *Controller) adoptSecret(azureKeyVaultSecret *akv.AzureKeyVaultSecret, secret *corev1.Secret) error {
+	if c.options.DryRun {
+		c.recordDryRun(azureKeyVaultSecret, fmt.Sprintf(MessageDryRunAdoptSecret, secret.Name))
+		return nil
+	}
+
+	ownerRefs := []metav1.OwnerReference{
+		*metav1.NewControllerRef(azureKeyVaultSecret, schema.GroupVersionKind{
+			Group:   akv.SchemeGroupVersion.Group,
+			Version: akv.SchemeGroupVersion.Version,
+			Kind:    "AzureKeyVaultSecret",
+		}),
+	}
+	for _, ref := range secret.OwnerReferences {
+		if ref.Controller == nil || !*ref.Controller {
+			ownerRefs = append(ownerRefs, ref)
+		}
+	}
+
+	// Using a merge patch replacing all owner references, as a strategic merge patch would keep
+	// a stale controller reference and be rejected for having two controllers
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"ownerReferences": ownerRefs,
+			"resourceVersion": secret.ResourceVersion,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create patch for secret '%s'/'%s', error: %w", secret.Namespace, secret.Name, err)
+	}
+
+	if _, err = c.kubeclientset.CoreV1().Secrets(secret.Namespace).Patch(secret.Name, types.MergePatchType, patch); err != nil {
+		return err
+	}
+	c.auditSecret(AuditActionAdopt, secret.Namespace, secret.Name, azureKeyVaultSecret, azureKeyVaultSecret.Status.ObjectVersion, nil)
+
+	msg := fmt.Sprintf(MessageSecretAdopted, secret.Name)
+	newLogger(azureKeyVaultSecret).WithField("secret", secret.Name).Info(msg)
+	c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeNormal, SecretAdopted, msg)
+	c.recordSecretEvent(secret, corev1.EventTypeNormal, SecretAdopted, fmt.Sprintf(MessageSecretAdoptedBy, azureKeyVaultSecret.Name))
+
+	queue.Enqueue(c.akvsCrdQueue.GetQueue(), azureKeyVaultSecret)
+	return nil
+}
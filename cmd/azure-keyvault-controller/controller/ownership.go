@@ -0,0 +1,104 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ControllerAnnotation is set on Secrets written by the controller to the ControllerID of the
+// installation, followed by its shard when sharded, like 'akv2k8s/shard-1-of-3'
+const ControllerAnnotation = "keyvault.azure.spv.no/controller"
+
+// controllerStamp returns the value of ControllerAnnotation for Secrets of the AzureKeyVaultSecret
+// written by this controller. Bundle Secrets are shared by AzureKeyVaultSecrets of every shard,
+// so they only have the ControllerID.
+func (c *Controller) controllerStamp(azureKeyVaultSecret *akv.AzureKeyVaultSecret) string {
+	if isBundle(azureKeyVaultSecret) || c.options.Shard.Count <= 1 {
+		return c.options.ControllerID
+	}
+	return fmt.Sprintf("%s/shard-%d-of-%d", c.options.ControllerID, c.options.Shard.Ordinal, c.options.Shard.Count)
+}
+
+// withControllerAnnotation returns a copy of annotations with ControllerAnnotation set for the AzureKeyVaultSecret,
+// or annotations as is if ControllerID is not set
+func (c *Controller) withControllerAnnotation(azureKeyVaultSecret *akv.AzureKeyVaultSecret, annotations map[string]string) map[string]string {
+	if c.options.ControllerID == "" {
+		return annotations
+	}
+
+	stamped := make(map[string]string, len(annotations)+1)
+	for key, value := range annotations {
+		stamped[key] = value
+	}
+	stamped[ControllerAnnotation] = c.controllerStamp(azureKeyVaultSecret)
+	return stamped
+}
+
+// isOwnedByOtherController returns true if the stamp of a Secret is from another installation, or
+// from another shard of this installation with the same number of shards. When the number of shards
+// changes, AzureKeyVaultSecrets move between shards and their Secrets are taken over.
+func isOwnedByOtherController(stamp string, own string) bool {
+	if stamp == "" || stamp == own {
+		return false
+	}
+
+	stampID, stampShard := splitControllerStamp(stamp)
+	ownID, ownShard := splitControllerStamp(own)
+	if stampID != ownID {
+		return true
+	}
+	if stampShard == "" || ownShard == "" {
+		return false
+	}
+	return shardCount(stampShard) == shardCount(ownShard)
+}
+
+func splitControllerStamp(stamp string) (string, string) {
+	if i := strings.LastIndex(stamp, "/shard-"); i >= 0 {
+		return stamp[:i], stamp[i+1:]
+	}
+	return stamp, ""
+}
+
+// shardCount returns the number of shards of a shard like 'shard-1-of-3'
+func shardCount(shard string) string {
+	return shard[strings.LastIndex(shard, "-of-")+1:]
+}
+
+// checkSecretController returns an error, and records an Event, if the Secret is stamped by another
+// controller installation or shard, so overlapping installations do not overwrite each other's Secrets.
+// Secrets without the annotation, like after it is removed to hand the Secret over, are taken over.
+func (c *Controller) checkSecretController(azureKeyVaultSecret *akv.AzureKeyVaultSecret, secret *corev1.Secret) error {
+	if c.options.ControllerID == "" || secret == nil {
+		return nil
+	}
+
+	stamp := secret.Annotations[ControllerAnnotation]
+	if !isOwnedByOtherController(stamp, c.controllerStamp(azureKeyVaultSecret)) {
+		return nil
+	}
+
+	msg := fmt.Sprintf(MessageSecretOwnedByOtherController, secret.Name, stamp, c.controllerStamp(azureKeyVaultSecret), ControllerAnnotation)
+	newLogger(azureKeyVaultSecret).WithField("secret", secret.Name).Warning(msg)
+	c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, ErrSecretOwnedByOtherController, msg)
+	return newOutputConflictError(msg)
+}
@@ -0,0 +1,87 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+)
+
+func TestIsOwnedByOtherController(t *testing.T) {
+	tests := []struct {
+		stamp string
+		own   string
+		other bool
+	}{
+		{stamp: "", own: "akv2k8s", other: false},
+		{stamp: "akv2k8s", own: "akv2k8s", other: false},
+		{stamp: "akv2k8s-staging", own: "akv2k8s", other: true},
+		{stamp: "akv2k8s/shard-1-of-3", own: "akv2k8s/shard-1-of-3", other: false},
+		{stamp: "akv2k8s/shard-1-of-3", own: "akv2k8s/shard-2-of-3", other: true},
+		{stamp: "akv2k8s/shard-1-of-3", own: "akv2k8s/shard-2-of-4", other: false},
+		{stamp: "akv2k8s", own: "akv2k8s/shard-0-of-2", other: false},
+		{stamp: "akv2k8s-staging/shard-0-of-2", own: "akv2k8s/shard-0-of-2", other: true},
+	}
+
+	for _, test := range tests {
+		if other := isOwnedByOtherController(test.stamp, test.own); other != test.other {
+			t.Errorf("expected stamp '%s' owned by other controller than '%s' to be %t", test.stamp, test.own, test.other)
+		}
+	}
+}
+
+func TestSecretOwnedByOtherControllerIsNotChanged(t *testing.T) {
+	f := newFixture(t)
+	f.controller.options.ControllerID = "akv2k8s-staging"
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	if stamp := f.getSecret(akvs.Namespace, "my-kubernetes-secret").Annotations[ControllerAnnotation]; stamp != "akv2k8s-staging" {
+		t.Fatalf("expected Secret stamped by 'akv2k8s-staging', got '%s'", stamp)
+	}
+
+	// Another installation handling the same AzureKeyVaultSecret
+	f.refresh(akvs)
+	f.drainEvents()
+	f.controller.options.ControllerID = "akv2k8s"
+	f.vault.SetSecret(testVaultName, "my-secret", "second-value")
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err == nil {
+		t.Fatal("expected updating Secret owned by other controller to fail")
+	}
+	f.expectEvent(ErrSecretOwnedByOtherController)
+	if value := string(f.getSecret(akvs.Namespace, "my-kubernetes-secret").Data["value"]); value != "first-value" {
+		t.Errorf("expected Secret owned by other controller to keep 'first-value', got '%s'", value)
+	}
+
+	// Handed over by removing the annotation
+	secret := f.getSecret(akvs.Namespace, "my-kubernetes-secret")
+	delete(secret.Annotations, ControllerAnnotation)
+	if _, err := f.kubeClient.CoreV1().Secrets(akvs.Namespace).Update(secret); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	secret = f.getSecret(akvs.Namespace, "my-kubernetes-secret")
+	if string(secret.Data["value"]) != "second-value" || secret.Annotations[ControllerAnnotation] != "akv2k8s" {
+		t.Errorf("expected Secret taken over by 'akv2k8s' with 'second-value', got '%s' by '%s'", secret.Data["value"], secret.Annotations[ControllerAnnotation])
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	"kmodules.xyz/client-go/tools/queue"
+)
+
+// initVaultPolicies syncs all AzureKeyVaultSecrets again when a AzureKeyVaultPolicy changes
+func (c *Controller) initVaultPolicies() {
+	c.akvsInformerFactory.Keyvault().V2alpha1().AzureKeyVaultPolicies().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.enqueueVaultPolicyAzureKeyVaultSecrets,
+		UpdateFunc: func(old, new interface{}) {
+			// Periodic resync will send update events for all known AzureKeyVaultPolicies
+			if old.(*akv.AzureKeyVaultPolicy).ResourceVersion == new.(*akv.AzureKeyVaultPolicy).ResourceVersion {
+				return
+			}
+			c.enqueueVaultPolicyAzureKeyVaultSecrets(new)
+		},
+		DeleteFunc: c.enqueueVaultPolicyAzureKeyVaultSecrets,
+	})
+}
+
+func (c *Controller) enqueueVaultPolicyAzureKeyVaultSecrets(obj interface{}) {
+	azureKeyVaultSecrets, err := c.azureKeyVaultSecretLister.List(labels.Everything())
+	if err != nil {
+		log.Errorf("failed to list AzureKeyVaultSecrets: %v", err)
+		return
+	}
+
+	for _, azureKeyVaultSecret := range azureKeyVaultSecrets {
+		if c.akvsHasSecretOutput(azureKeyVaultSecret) && c.isHandled(azureKeyVaultSecret.Namespace, azureKeyVaultSecret.Name) {
+			newLogger(azureKeyVaultSecret).Debug("AzureKeyVaultPolicy changed. Syncing AzureKeyVaultSecret now.")
+			queue.Enqueue(c.akvsCrdQueue.GetQueue(), azureKeyVaultSecret)
+		}
+	}
+}
+
+// checkVaultPolicies returns an error if the AzureKeyVaultPolicies do not allow the namespace of the
+// AzureKeyVaultSecret to use its Azure Key Vault, credential set or identity. Like in the webhook,
+// everything is allowed without the AzureKeyVaultPolicy CRD.
+func (c *Controller) checkVaultPolicies(azureKeyVaultSecret *akv.AzureKeyVaultSecret) error {
+	if c.azureKeyVaultPolicyLister == nil {
+		return nil
+	}
+	policies, err := c.azureKeyVaultPolicyLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+	if len(policies) == 0 {
+		return nil
+	}
+
+	namespace, err := c.namespaceLister.Get(azureKeyVaultSecret.Namespace)
+	if err != nil {
+		return err
+	}
+
+	if err = akv.CheckPolicies(policies, namespace.Name, namespace.Labels, &azureKeyVaultSecret.Spec.Vault); err != nil {
+		msg := fmt.Sprintf(MessageVaultPolicyDenied, err.Error())
+		c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, ErrVaultPolicy, msg)
+		return fmt.Errorf(msg)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client/fake"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	akvsfake "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/client/clientset/versioned/fake"
+	akvInformers "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/client/informers/externalversions"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeinformers "k8s.io/client-go/informers"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func (f *fixture) addVaultPolicy(name string, spec akv.AzureKeyVaultPolicySpec) {
+	policy := &akv.AzureKeyVaultPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       spec,
+	}
+	if err := f.akvsInformerFactory.Keyvault().V2alpha1().AzureKeyVaultPolicies().Informer().GetIndexer().Add(policy); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+func (f *fixture) addLabeledNamespace(name string, labels map[string]string) {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	if err := f.kubeInformerFactory.Core().V1().Namespaces().Informer().GetIndexer().Add(ns); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+func TestSyncAllowedByVaultPolicy(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "some-value")
+	f.addLabeledNamespace(metav1.NamespaceDefault, map[string]string{"team": "a"})
+	f.addVaultPolicy("team-a", akv.AzureKeyVaultPolicySpec{
+		NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+		Vaults:            []string{testVaultName},
+	})
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	if value := string(f.getSecret(akvs.Namespace, "my-kubernetes-secret").Data["value"]); value != "some-value" {
+		t.Errorf("expected secret from allowed Azure Key Vault, got '%s'", value)
+	}
+}
+
+func TestSyncDeniedByVaultPolicy(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "some-value")
+	f.addLabeledNamespace(metav1.NamespaceDefault, nil)
+	f.addVaultPolicy("team-a", akv.AzureKeyVaultPolicySpec{
+		Namespaces: []string{metav1.NamespaceDefault},
+		Vaults:     []string{"team-a-vault"},
+	})
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err == nil {
+		t.Fatal("expected error with Azure Key Vault not allowed by AzureKeyVaultPolicy")
+	}
+	f.expectEvent(ErrVaultPolicy)
+
+	if _, err := f.kubeClient.CoreV1().Secrets(akvs.Namespace).Get("my-kubernetes-secret", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("expected no secret from denied Azure Key Vault, got error %v", err)
+	}
+}
+
+func TestSyncWithoutVaultPolicyCRD(t *testing.T) {
+	f := newFixture(t)
+	f.controller.options.VaultPolicies = false
+	f.controller.azureKeyVaultPolicyLister = nil
+	f.vault.SetSecret(testVaultName, "my-secret", "some-value")
+	f.addLabeledNamespace(metav1.NamespaceDefault, nil)
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	if value := string(f.getSecret(akvs.Namespace, "my-kubernetes-secret").Data["value"]); value != "some-value" {
+		t.Errorf("expected secret allowed without AzureKeyVaultPolicy CRD, got '%s'", value)
+	}
+}
+
+func TestNewControllerOnlyWatchesEnabledCRDs(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  Options
+		expected []reflect.Type
+	}{
+		{name: "disabled"},
+		{
+			name:     "enabled",
+			options:  Options{VaultDefaults: true, VaultPolicies: true},
+			expected: []reflect.Type{reflect.TypeOf(&akv.AzureKeyVaultDefault{}), reflect.TypeOf(&akv.AzureKeyVaultPolicy{})},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kubeClient := k8sfake.NewSimpleClientset()
+			akvsClient := akvsfake.NewSimpleClientset()
+			akvsInformerFactory := akvInformers.NewSharedInformerFactory(akvsClient, 0)
+			kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClient, 0)
+			options := test.options
+			NewController(kubeClient, akvsClient, akvsInformerFactory, kubeInformerFactory, record.NewFakeRecorder(10), fake.NewService(),
+				"azure-key-vault-env-injection", AzurePollFrequency{}, &options)
+
+			// Waiting on stopped informers returns at once, listing all informers created
+			stopCh := make(chan struct{})
+			akvsInformerFactory.Start(stopCh)
+			close(stopCh)
+			synced := akvsInformerFactory.WaitForCacheSync(stopCh)
+			for _, informerType := range []reflect.Type{reflect.TypeOf(&akv.AzureKeyVaultDefault{}), reflect.TypeOf(&akv.AzureKeyVaultPolicy{})} {
+				_, watched := synced[informerType]
+				if expected := containsType(test.expected, informerType); watched != expected {
+					t.Errorf("expected informer for %s: %t, got %t", informerType, expected, watched)
+				}
+			}
+		})
+	}
+}
+
+func containsType(types []reflect.Type, t reflect.Type) bool {
+	for _, candidate := range types {
+		if candidate == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"hash/fnv"
+	"math"
+	"sort"
+	"time"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/labels"
+	"kmodules.xyz/client-go/tools/queue"
+)
+
+// azurePollCheckInterval is how often AzureKeyVaultSecrets are checked for being due for polling
+const azurePollCheckInterval = 10 * time.Second
+
+// pollInterval returns the time between polls of the AzureKeyVaultSecret, which is Normal plus a jitter
+// derived from its namespace and name. The jitter is the same every time, so polls are spread evenly.
+func (f AzurePollFrequency) pollInterval(azureKeyVaultSecret *akv.AzureKeyVaultSecret) time.Duration {
+	if f.Jitter <= 0 {
+		return f.Normal
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(azureKeyVaultSecret.Namespace + "/" + azureKeyVaultSecret.Name))
+	fraction := float64(hash.Sum32()) / float64(math.MaxUint32)
+	return f.Normal + time.Duration(fraction*f.Jitter*float64(f.Normal))
+}
+
+// runAzurePolling adds AzureKeyVaultSecrets due for polling to the Azure Key Vault queue until stopCh is closed
+func (c *Controller) runAzurePolling(stopCh <-chan struct{}) {
+	go runUntil(c.clock, c.enqueueStaleAzureKeyVaultSecrets, azurePollCheckInterval, stopCh)
+}
+
+// enqueueStaleAzureKeyVaultSecrets adds AzureKeyVaultSecrets not polled from Azure Key Vault within
+// their poll interval to the Azure Key Vault queue, least recently synced first. AzureKeyVaultSecrets
+// never synced are added before all others.
+func (c *Controller) enqueueStaleAzureKeyVaultSecrets() {
+	azureKeyVaultSecrets, err := c.azureKeyVaultSecretLister.List(labels.Everything())
+	if err != nil {
+		log.Errorf("failed to list AzureKeyVaultSecrets to poll from Azure Key Vault: %v", err)
+		return
+	}
+
+	now := c.clock.Now()
+	var stale []*akv.AzureKeyVaultSecret
+	for _, azureKeyVaultSecret := range azureKeyVaultSecrets {
+		if !c.isHandled(azureKeyVaultSecret.Namespace, azureKeyVaultSecret.Name) || !c.akvsHasSecretOutput(azureKeyVaultSecret) {
+			continue
+		}
+		if c.isBackingOff(azureKeyVaultSecret) {
+			continue
+		}
+		if now.Sub(azureKeyVaultSecret.Status.LastAzureUpdate.Time) < c.azureFrequency.pollInterval(azureKeyVaultSecret) {
+			continue
+		}
+		stale = append(stale, azureKeyVaultSecret)
+	}
+
+	sort.SliceStable(stale, func(i, j int) bool {
+		return stale[i].Status.LastAzureUpdate.Before(&stale[j].Status.LastAzureUpdate)
+	})
+
+	if len(stale) > 0 {
+		log.Debugf("Adding %d AzureKeyVaultSecrets due for polling to Azure Key Vault queue", len(stale))
+	}
+	for _, azureKeyVaultSecret := range stale {
+		queue.Enqueue(c.azureKeyVaultQueue.GetQueue(), azureKeyVaultSecret)
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEnqueueStaleAzureKeyVaultSecrets(t *testing.T) {
+	f := newFixture(t)
+	f.controller.azureFrequency.Normal = time.Minute
+	now := time.Now()
+
+	lastSynced := map[string]time.Time{
+		"stale":       now.Add(-5 * time.Minute),
+		"fresh":       now.Add(-10 * time.Second),
+		"never":       {},
+		"most-stale":  now.Add(-time.Hour),
+		"backing-off": now.Add(-time.Hour),
+	}
+	for name, synced := range lastSynced {
+		akvs := azureKeyVaultSecretWithOutput()
+		akvs.Name = name
+		akvs.Status.LastAzureUpdate = metav1.NewTime(synced)
+		if name == "backing-off" {
+			akvs.Status.RetryCount = 1
+			akvs.Status.NextRetryTime = metav1.NewTime(now.Add(time.Minute))
+		}
+		f.addAzureKeyVaultSecret(akvs)
+	}
+
+	f.controller.enqueueStaleAzureKeyVaultSecrets()
+
+	q := f.controller.azureKeyVaultQueue.GetQueue()
+	expected := []string{"default/never", "default/most-stale", "default/stale"}
+	if q.Len() != len(expected) {
+		t.Fatalf("expected %d AzureKeyVaultSecrets to be queued, got %d", len(expected), q.Len())
+	}
+	for _, key := range expected {
+		item, _ := q.Get()
+		if item != key {
+			t.Errorf("expected '%s' to be polled next, got '%v'", key, item)
+		}
+		q.Done(item)
+	}
+}
+
+func TestPollIntervalJitter(t *testing.T) {
+	frequency := AzurePollFrequency{Normal: time.Minute, Jitter: 0.5}
+
+	intervals := map[time.Duration]bool{}
+	for _, name := range []string{"first", "second", "third", "fourth"} {
+		akvs := azureKeyVaultSecretWithOutput()
+		akvs.Name = name
+
+		interval := frequency.pollInterval(akvs)
+		if interval < time.Minute || interval > 90*time.Second {
+			t.Errorf("expected poll interval for '%s' between 1m and 1m30s, got %s", name, interval)
+		}
+		if frequency.pollInterval(akvs) != interval {
+			t.Errorf("expected the same poll interval every time for '%s'", name)
+		}
+		intervals[interval] = true
+	}
+
+	if len(intervals) < 2 {
+		t.Error("expected poll intervals to be spread by jitter")
+	}
+}
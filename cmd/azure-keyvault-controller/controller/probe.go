@@ -0,0 +1,179 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// vaultReachableReason is the reason of the VaultReachable condition when the probe succeeds
+	vaultReachableReason = "Reachable"
+
+	// vaultUnreachableReason is the reason of the VaultReachable condition when the vault cannot be reached
+	vaultUnreachableReason = "Unreachable"
+
+	// vaultAuthenticationFailedReason is the reason of the VaultReachable condition when the
+	// controller fails to authenticate with Azure AD
+	vaultAuthenticationFailedReason = "AuthenticationFailed"
+)
+
+// vaultProbe identifies a probe of an Azure Key Vault. Vaults are probed per credential set and
+// object type, as each may be allowed or denied separately.
+type vaultProbe struct {
+	vaultName     string
+	credentialSet string
+	objectType    akv.AzureKeyVaultObjectType
+}
+
+// spec returns the Azure Key Vault spec to probe
+func (p vaultProbe) spec() *akv.AzureKeyVault {
+	return &akv.AzureKeyVault{
+		Name:          p.vaultName,
+		CredentialSet: p.credentialSet,
+		Object:        akv.AzureKeyVaultObject{Type: p.objectType},
+	}
+}
+
+// runVaultProber probes the Azure Key Vaults at once and then every VaultProbeInterval until stopCh is closed
+func (c *Controller) runVaultProber(stopCh <-chan struct{}) {
+	if c.options.VaultProbeInterval <= 0 {
+		return
+	}
+	go runUntil(c.clock, c.probeVaults, c.options.VaultProbeInterval, stopCh)
+}
+
+// probeVaults probes every Azure Key Vault referenced by the AzureKeyVaultSecrets handled by this
+// replica, and sets the VaultReachable condition of each AzureKeyVaultSecret to the result. Network,
+// firewall and permission problems are then found even when no object is due to be synced.
+func (c *Controller) probeVaults() {
+	azureKeyVaultSecrets, err := c.azureKeyVaultSecretLister.List(labels.Everything())
+	if err != nil {
+		log.Errorf("failed to list AzureKeyVaultSecrets for probing Azure Key Vault: %v", err)
+		return
+	}
+
+	referencedBy := map[vaultProbe][]*akv.AzureKeyVaultSecret{}
+	for _, azureKeyVaultSecret := range azureKeyVaultSecrets {
+		if !c.isHandled(azureKeyVaultSecret.Namespace, azureKeyVaultSecret.Name) {
+			continue
+		}
+		probe, ok := c.vaultProbeFor(azureKeyVaultSecret)
+		if !ok {
+			continue
+		}
+		referencedBy[probe] = append(referencedBy[probe], azureKeyVaultSecret)
+	}
+
+	for probe, referencing := range referencedBy {
+		err := c.vaultService.Probe(probe.spec())
+		reason, msg := probeResult(probe, err)
+		observeVaultProbe(probe, reason)
+		if err != nil {
+			log.WithFields(log.Fields{"vault": probe.vaultName, "credentialSet": probe.credentialSet, "reason": reason}).WithError(err).Warning(msg)
+		}
+
+		for _, azureKeyVaultSecret := range referencing {
+			c.updateVaultReachableCondition(azureKeyVaultSecret, reason, msg)
+		}
+	}
+
+	for probe := range c.probedVaults {
+		if _, ok := referencedBy[probe]; !ok {
+			deleteVaultProbeMetrics(probe)
+			delete(c.probedVaults, probe)
+		}
+	}
+	for probe := range referencedBy {
+		c.probedVaults[probe] = true
+	}
+}
+
+// vaultProbeFor returns the probe of the Azure Key Vault of the AzureKeyVaultSecret, with the vault
+// taken from the AzureKeyVaultDefault of its namespace if not set. False if the vault is not known.
+func (c *Controller) vaultProbeFor(azureKeyVaultSecret *akv.AzureKeyVaultSecret) (vaultProbe, bool) {
+	vaultSpec, ok := c.vaultSpecFor(azureKeyVaultSecret)
+	if !ok {
+		return vaultProbe{}, false
+	}
+
+	return vaultProbe{vaultName: vaultSpec.Name, credentialSet: vaultSpec.CredentialSet, objectType: vaultSpec.Object.Type.AzureObjectType()}, true
+}
+
+// vaultSpecFor returns the Azure Key Vault of the AzureKeyVaultSecret with the AzureKeyVaultDefault of its
+// namespace applied, like applyVaultDefaults but without recording events. False if the vault is not known.
+func (c *Controller) vaultSpecFor(azureKeyVaultSecret *akv.AzureKeyVaultSecret) (akv.AzureKeyVault, bool) {
+	vaultSpec := *azureKeyVaultSecret.Spec.Vault.DeepCopy()
+	if c.azureKeyVaultDefaultLister == nil {
+		return vaultSpec, vaultSpec.Name != ""
+	}
+	defaults, err := c.azureKeyVaultDefaultLister.AzureKeyVaultDefaults(azureKeyVaultSecret.Namespace).List(labels.Everything())
+	if err == nil && len(defaults) == 1 {
+		defaults[0].Spec.Vault.ApplyTo(&vaultSpec)
+	}
+	return vaultSpec, vaultSpec.Name != ""
+}
+
+// probeResult returns the reason and message of the VaultReachable condition for the result of the probe,
+// with an empty reason if it succeeded
+func probeResult(probe vaultProbe, err error) (string, string) {
+	if err == nil {
+		return "", fmt.Sprintf("Azure Key Vault '%s' is reachable", probe.vaultName)
+	}
+	if forbidden, ok := vault.AsForbidden(err); ok {
+		return string(forbidden.Model), fmt.Sprintf(MessageAzureKeyVaultUnreachable, probe.vaultName, forbidden.Remediation(probe.vaultName, string(probe.objectType)))
+	}
+	reason := vaultUnreachableReason
+	if vault.IsAuthenticationFailure(err) {
+		reason = vaultAuthenticationFailedReason
+	}
+	return reason, fmt.Sprintf(MessageAzureKeyVaultUnreachable, probe.vaultName, err.Error())
+}
+
+// updateVaultReachableCondition sets the VaultReachable condition of the AzureKeyVaultSecret,
+// recording an event when the vault becomes unreachable
+func (c *Controller) updateVaultReachableCondition(azureKeyVaultSecret *akv.AzureKeyVaultSecret, reason string, msg string) {
+	condition := akv.AzureKeyVaultSecretCondition{
+		Type:    akv.AzureKeyVaultSecretConditionVaultReachable,
+		Status:  corev1.ConditionTrue,
+		Reason:  vaultReachableReason,
+		Message: msg,
+	}
+	if reason != "" {
+		condition.Status = corev1.ConditionFalse
+		condition.Reason = reason
+
+		previous := getCondition(&azureKeyVaultSecret.Status, akv.AzureKeyVaultSecretConditionVaultReachable)
+		if previous == nil || previous.Status != corev1.ConditionFalse || previous.Reason != reason {
+			c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, ErrAzureVaultUnreachable, msg)
+		}
+	}
+
+	now := c.clock.Now()
+	err := c.mutateAzureKeyVaultSecretStatus(azureKeyVaultSecret, func(status *akv.AzureKeyVaultSecretStatus) {
+		setCondition(status, condition, now)
+	})
+	if err != nil {
+		newLogger(azureKeyVaultSecret).WithError(err).Error("failed to update VaultReachable condition of AzureKeyVaultSecret")
+	}
+}
@@ -0,0 +1,91 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"errors"
+	"testing"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func (f *fixture) expectVaultReachable(azureKeyVaultSecret *akv.AzureKeyVaultSecret, status corev1.ConditionStatus, reason string) {
+	akvsStatus := f.getAzureKeyVaultSecret(azureKeyVaultSecret.Namespace, azureKeyVaultSecret.Name).Status
+	condition := getCondition(&akvsStatus, akv.AzureKeyVaultSecretConditionVaultReachable)
+	if condition == nil || condition.Status != status || condition.Reason != reason {
+		f.t.Errorf("expected VaultReachable condition %s with reason %s for '%s', got %+v", status, reason, azureKeyVaultSecret.Name, condition)
+	}
+}
+
+func TestProbeVaultsOncePerVault(t *testing.T) {
+	f := newFixture(t)
+
+	first := azureKeyVaultSecretWithOutput()
+	second := azureKeyVaultSecretWithOutput()
+	second.Name = "second"
+	f.addAzureKeyVaultSecret(first)
+	f.addAzureKeyVaultSecret(second)
+
+	f.controller.probeVaults()
+	if calls := f.vault.Calls("Probe"); calls != 1 {
+		t.Errorf("expected vault referenced twice to be probed once, got %d probes", calls)
+	}
+	f.expectVaultReachable(first, corev1.ConditionTrue, vaultReachableReason)
+	f.expectVaultReachable(second, corev1.ConditionTrue, vaultReachableReason)
+	f.expectNoEvents()
+
+	probe := vaultProbe{vaultName: testVaultName, objectType: akv.AzureKeyVaultObjectTypeSecret}
+	if value := testutil.ToFloat64(vaultReachable.WithLabelValues(probe.vaultName, "", string(probe.objectType))); value != 1 {
+		t.Errorf("expected vault_reachable 1, got %v", value)
+	}
+}
+
+func TestProbeVaultsReportsUnreachableVault(t *testing.T) {
+	f := newFixture(t)
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+	f.controller.probeVaults()
+	f.refresh(akvs)
+
+	f.vault.SetProbeError(testVaultName, errors.New("dial tcp: lookup my-vault.vault.azure.net: no such host"))
+	f.controller.probeVaults()
+	f.expectEvent(ErrAzureVaultUnreachable)
+	f.expectVaultReachable(akvs, corev1.ConditionFalse, vaultUnreachableReason)
+	if value := testutil.ToFloat64(vaultReachable.WithLabelValues(testVaultName, "", string(akv.AzureKeyVaultObjectTypeSecret))); value != 0 {
+		t.Errorf("expected vault_reachable 0, got %v", value)
+	}
+
+	// Still unreachable, so not recorded again
+	f.refresh(akvs)
+	f.controller.probeVaults()
+	f.expectNoEvents()
+
+	// Reachable through the firewall, but denied
+	f.refresh(akvs)
+	f.vault.SetProbeError(testVaultName, forbiddenError("ForbiddenByFirewall", "Client address is not authorized and caller is not a trusted service."))
+	f.controller.probeVaults()
+	f.expectEvent(ErrAzureVaultUnreachable)
+	f.expectVaultReachable(akvs, corev1.ConditionFalse, "Network")
+
+	f.refresh(akvs)
+	f.vault.SetProbeError(testVaultName, nil)
+	f.controller.probeVaults()
+	f.expectVaultReachable(akvs, corev1.ConditionTrue, vaultReachableReason)
+}
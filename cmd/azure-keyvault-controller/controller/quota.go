@@ -0,0 +1,109 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// quotaNearLimitReason is the reason of the QuotaNearLimit condition when the vault is close to its limit
+	quotaNearLimitReason = "NearLimit"
+
+	// quotaBelowLimitReason is the reason of the QuotaNearLimit condition when the vault is no longer close to its limit
+	quotaBelowLimitReason = "BelowLimit"
+)
+
+// runQuotaCheck checks the request quota of the Azure Key Vaults every quota window until stopCh is closed
+func (c *Controller) runQuotaCheck(stopCh <-chan struct{}) {
+	if c.options.VaultQuota == nil || c.options.QuotaWarningThreshold <= 0 {
+		return
+	}
+	go runUntil(c.clock, c.checkVaultQuotas, c.options.VaultQuota.Window(), stopCh)
+}
+
+// checkVaultQuotas sets the QuotaNearLimit condition of the AzureKeyVaultSecrets handled by this replica
+// to whether the controller has made enough requests to their Azure Key Vault within the quota window
+// to be close to its limit, so syncs being throttled can be foreseen
+func (c *Controller) checkVaultQuotas() {
+	azureKeyVaultSecrets, err := c.azureKeyVaultSecretLister.List(labels.Everything())
+	if err != nil {
+		log.Errorf("failed to list AzureKeyVaultSecrets for checking Azure Key Vault quota: %v", err)
+		return
+	}
+
+	referencedBy := map[string][]*akv.AzureKeyVaultSecret{}
+	for _, azureKeyVaultSecret := range azureKeyVaultSecrets {
+		if !c.isHandled(azureKeyVaultSecret.Namespace, azureKeyVaultSecret.Name) {
+			continue
+		}
+		probe, ok := c.vaultProbeFor(azureKeyVaultSecret)
+		if !ok {
+			continue
+		}
+		referencedBy[probe.vaultName] = append(referencedBy[probe.vaultName], azureKeyVaultSecret)
+	}
+
+	quota := c.options.VaultQuota
+	for vaultName, referencing := range referencedBy {
+		requests, usage := quota.Usage(vaultName)
+		nearLimit := usage >= c.options.QuotaWarningThreshold
+		msg := fmt.Sprintf(MessageAzureKeyVaultQuotaNearLimit, requests, vaultName, quota.Window(), usage*100, quota.Limit())
+		if nearLimit {
+			log.WithFields(log.Fields{"vault": vaultName, "requests": requests, "limit": quota.Limit()}).Warning(msg)
+		}
+
+		for _, azureKeyVaultSecret := range referencing {
+			c.updateQuotaNearLimitCondition(azureKeyVaultSecret, nearLimit, msg)
+		}
+	}
+}
+
+// updateQuotaNearLimitCondition sets the QuotaNearLimit condition of the AzureKeyVaultSecret when its vault
+// becomes close to its limit, recording an event, and clears it when no longer close. The condition is
+// only changed when the vault crosses the threshold, not for every change in the number of requests.
+func (c *Controller) updateQuotaNearLimitCondition(azureKeyVaultSecret *akv.AzureKeyVaultSecret, nearLimit bool, msg string) {
+	wasNearLimit := isConditionTrue(&azureKeyVaultSecret.Status, akv.AzureKeyVaultSecretConditionQuotaNearLimit)
+	if nearLimit == wasNearLimit {
+		return
+	}
+	if nearLimit {
+		c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, AzureVaultQuotaNearLimit, msg)
+	}
+
+	now := c.clock.Now()
+	err := c.mutateAzureKeyVaultSecretStatus(azureKeyVaultSecret, func(status *akv.AzureKeyVaultSecretStatus) {
+		if !nearLimit {
+			clearCondition(status, akv.AzureKeyVaultSecretConditionQuotaNearLimit, quotaBelowLimitReason, msg, now)
+			return
+		}
+		setCondition(status, akv.AzureKeyVaultSecretCondition{
+			Type:    akv.AzureKeyVaultSecretConditionQuotaNearLimit,
+			Status:  corev1.ConditionTrue,
+			Reason:  quotaNearLimitReason,
+			Message: msg,
+		}, now)
+	})
+	if err != nil {
+		newLogger(azureKeyVaultSecret).WithError(err).Error("failed to update QuotaNearLimit condition of AzureKeyVaultSecret")
+	}
+}
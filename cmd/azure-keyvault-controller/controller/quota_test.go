@@ -0,0 +1,82 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestCheckVaultQuotasWarnsNearLimit(t *testing.T) {
+	f := newFixture(t)
+	quota := vault.NewQuotaTracker(time.Hour, 10)
+	f.controller.options.VaultQuota = quota
+	f.controller.options.QuotaWarningThreshold = 0.8
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+	for i := 0; i < 7; i++ {
+		quota.Record(testVaultName)
+	}
+
+	f.controller.checkVaultQuotas()
+	f.expectNoEvents()
+	if status := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status; getCondition(&status, akv.AzureKeyVaultSecretConditionQuotaNearLimit) != nil {
+		t.Errorf("expected no QuotaNearLimit condition below the threshold, got %+v", status.Conditions)
+	}
+
+	quota.Record(testVaultName)
+	f.controller.checkVaultQuotas()
+	f.expectEvent(AzureVaultQuotaNearLimit)
+	status := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status
+	condition := getCondition(&status, akv.AzureKeyVaultSecretConditionQuotaNearLimit)
+	if condition == nil || condition.Status != corev1.ConditionTrue || condition.Reason != quotaNearLimitReason {
+		t.Fatalf("expected QuotaNearLimit condition true, got %+v", condition)
+	}
+
+	// Still near the limit, so not recorded again
+	f.refresh(akvs)
+	quota.Record(testVaultName)
+	f.controller.checkVaultQuotas()
+	f.expectNoEvents()
+}
+
+func TestCheckVaultQuotasClearsConditionBelowLimit(t *testing.T) {
+	f := newFixture(t)
+	f.controller.options.VaultQuota = vault.NewQuotaTracker(time.Hour, 10)
+	f.controller.options.QuotaWarningThreshold = 0.8
+
+	akvs := azureKeyVaultSecretWithOutput()
+	setCondition(&akvs.Status, akv.AzureKeyVaultSecretCondition{
+		Type:   akv.AzureKeyVaultSecretConditionQuotaNearLimit,
+		Status: corev1.ConditionTrue,
+		Reason: quotaNearLimitReason,
+	}, f.controller.clock.Now())
+	f.addAzureKeyVaultSecret(akvs)
+
+	f.controller.checkVaultQuotas()
+	f.expectNoEvents()
+	status := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status
+	condition := getCondition(&status, akv.AzureKeyVaultSecretConditionQuotaNearLimit)
+	if condition == nil || condition.Status != corev1.ConditionFalse || condition.Reason != quotaBelowLimitReason {
+		t.Errorf("expected QuotaNearLimit condition false, got %+v", condition)
+	}
+}
@@ -0,0 +1,355 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"sync"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// RemoteClusterOwnerAnnotation is the namespace/name of the AzureKeyVaultSecret writing a Secret
+	// to another cluster, as Secrets in other clusters can not have it as owner
+	RemoteClusterOwnerAnnotation = "keyvault.azure.spv.no/remote-cluster-owner"
+
+	// defaultKubeConfigKey is the key of the kubeconfig in a kubeconfig Secret if not set
+	defaultKubeConfigKey = "kubeconfig"
+)
+
+// remoteClusterClients creates Kubernetes clients for other clusters from kubeconfig Secrets,
+// reusing the client of a kubeconfig Secret as long as its kubeconfig is unchanged
+type remoteClusterClients struct {
+	mu        sync.Mutex
+	clients   map[string]remoteClusterClient
+	newClient func(kubeConfig []byte) (kubernetes.Interface, error)
+}
+
+// remoteClusterClient is the client created from the kubeconfig in a key of a kubeconfig Secret
+type remoteClusterClient struct {
+	secret string
+	hash   [sha256.Size]byte
+	client kubernetes.Interface
+}
+
+func newRemoteClusterClients() *remoteClusterClients {
+	return &remoteClusterClients{
+		clients:   map[string]remoteClusterClient{},
+		newClient: newKubeConfigClient,
+	}
+}
+
+// newKubeConfigClient creates a client from a kubeconfig taken from a Secret any tenant can write. Only
+// the server, inline CA data and an inline token or client certificate are used, and kubeconfigs running
+// commands or reading files in the controller pod, like the token of its service account, are rejected.
+func newKubeConfigClient(kubeConfig []byte) (kubernetes.Interface, error) {
+	config, err := restConfigFromKubeConfig(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(config)
+}
+
+func restConfigFromKubeConfig(kubeConfig []byte) (*rest.Config, error) {
+	apiConfig, err := clientcmd.Load(kubeConfig)
+	if err != nil {
+		return nil, err
+	}
+	context, ok := apiConfig.Contexts[apiConfig.CurrentContext]
+	if !ok {
+		return nil, fmt.Errorf("current context '%s' not found", apiConfig.CurrentContext)
+	}
+	cluster, ok := apiConfig.Clusters[context.Cluster]
+	if !ok {
+		return nil, fmt.Errorf("cluster '%s' not found", context.Cluster)
+	}
+	authInfo, ok := apiConfig.AuthInfos[context.AuthInfo]
+	if !ok {
+		return nil, fmt.Errorf("user '%s' not found", context.AuthInfo)
+	}
+
+	switch {
+	case authInfo.Exec != nil:
+		return nil, fmt.Errorf("exec credentials are not allowed")
+	case authInfo.AuthProvider != nil:
+		return nil, fmt.Errorf("auth-provider credentials are not allowed")
+	case authInfo.TokenFile != "" || authInfo.ClientCertificate != "" || authInfo.ClientKey != "" || cluster.CertificateAuthority != "":
+		return nil, fmt.Errorf("file paths are not allowed, use tokens, certificates and keys inline")
+	case authInfo.Username != "" || authInfo.Password != "" || authInfo.Impersonate != "" || len(authInfo.ImpersonateGroups) > 0:
+		return nil, fmt.Errorf("only token and client certificate credentials are allowed")
+	case cluster.Server == "":
+		return nil, fmt.Errorf("no server for cluster '%s'", context.Cluster)
+	case authInfo.Token == "" && (len(authInfo.ClientCertificateData) == 0 || len(authInfo.ClientKeyData) == 0):
+		return nil, fmt.Errorf("no token or client certificate and key for user '%s'", context.AuthInfo)
+	}
+
+	return &rest.Config{
+		Host:        cluster.Server,
+		BearerToken: authInfo.Token,
+		TLSClientConfig: rest.TLSClientConfig{
+			CAData:   cluster.CertificateAuthorityData,
+			CertData: authInfo.ClientCertificateData,
+			KeyData:  authInfo.ClientKeyData,
+		},
+	}, nil
+}
+
+// get returns the client for the cluster of the kubeconfig in the key of the kubeconfig Secret,
+// replacing the client if the kubeconfig has changed
+func (r *remoteClusterClients) get(kubeConfigSecret *corev1.Secret, key string) (kubernetes.Interface, error) {
+	kubeConfig, ok := kubeConfigSecret.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("no key '%s' in kubeconfig Secret", key)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	secret := kubeConfigSecret.Namespace + "/" + kubeConfigSecret.Name
+	hash := sha256.Sum256(kubeConfig)
+	if current, ok := r.clients[secret+"/"+key]; ok && current.hash == hash {
+		return current.client, nil
+	}
+
+	client, err := r.newClient(kubeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig, error: %w", err)
+	}
+	r.clients[secret+"/"+key] = remoteClusterClient{secret: secret, hash: hash, client: client}
+	return client, nil
+}
+
+// evict removes the clients of the kubeconfig Secret, like when it is changed or deleted
+func (r *remoteClusterClients) evict(namespace, name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, client := range r.clients {
+		if client.secret == namespace+"/"+name {
+			delete(r.clients, key)
+		}
+	}
+}
+
+// syncRemoteClusters writes the Secret of a AzureKeyVaultSecret to the other clusters in spec.output.clusters,
+// and deletes the Secrets it wrote earlier to clusters no longer in spec.output.clusters
+func (c *Controller) syncRemoteClusters(azureKeyVaultSecret *akv.AzureKeyVaultSecret, secret *corev1.Secret) error {
+	data := secret.Data
+	if isBundle(azureKeyVaultSecret) {
+		data = getBundleData(secret, azureKeyVaultSecret.Name)
+	}
+
+	var lastErr error
+	var remoteSecrets []akv.AzureKeyVaultOutputCluster
+	for _, cluster := range azureKeyVaultSecret.Spec.Output.Clusters {
+		target := remoteSecretFor(azureKeyVaultSecret, cluster)
+		if err := c.syncRemoteCluster(azureKeyVaultSecret, target, secret.Type, data); err != nil {
+			msg := fmt.Sprintf(MessageRemoteClusterFailed, cluster.KubeConfigSecret, err)
+			c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, ErrRemoteCluster, msg)
+			lastErr = fmt.Errorf(msg)
+			if !containsRemoteSecret(azureKeyVaultSecret.Status.RemoteSecrets, target) {
+				continue
+			}
+		}
+		remoteSecrets = append(remoteSecrets, target)
+	}
+
+	for _, previous := range azureKeyVaultSecret.Status.RemoteSecrets {
+		if containsRemoteSecret(remoteSecrets, previous) {
+			continue
+		}
+		if err := c.deleteRemoteSecret(azureKeyVaultSecret, previous); err != nil {
+			msg := fmt.Sprintf(MessageRemoteClusterDeleteFailed, previous.Namespace+"/"+previous.Name, previous.KubeConfigSecret, err)
+			c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, ErrRemoteCluster, msg)
+			lastErr = fmt.Errorf(msg)
+			remoteSecrets = append(remoteSecrets, previous)
+		}
+	}
+
+	if err := c.updateRemoteSecretsStatus(azureKeyVaultSecret, remoteSecrets); err != nil {
+		return err
+	}
+	return lastErr
+}
+
+// remoteSecretFor returns the output cluster with the defaults of the AzureKeyVaultSecret resolved
+func remoteSecretFor(azureKeyVaultSecret *akv.AzureKeyVaultSecret, cluster akv.AzureKeyVaultOutputCluster) akv.AzureKeyVaultOutputCluster {
+	if cluster.Key == "" {
+		cluster.Key = defaultKubeConfigKey
+	}
+	if cluster.Namespace == "" {
+		cluster.Namespace = azureKeyVaultSecret.Namespace
+	}
+	if cluster.Name == "" {
+		cluster.Name = azureKeyVaultSecret.Spec.Output.Secret.Name
+	}
+	return cluster
+}
+
+func containsRemoteSecret(remoteSecrets []akv.AzureKeyVaultOutputCluster, remoteSecret akv.AzureKeyVaultOutputCluster) bool {
+	for _, existing := range remoteSecrets {
+		if existing == remoteSecret {
+			return true
+		}
+	}
+	return false
+}
+
+// updateRemoteSecretsStatus sets the Secrets written to other clusters in the status of the AzureKeyVaultSecret
+func (c *Controller) updateRemoteSecretsStatus(azureKeyVaultSecret *akv.AzureKeyVaultSecret, remoteSecrets []akv.AzureKeyVaultOutputCluster) error {
+	if equality.Semantic.DeepEqual(remoteSecrets, azureKeyVaultSecret.Status.RemoteSecrets) {
+		return nil
+	}
+
+	// Getting the latest AzureKeyVaultSecret, as status may have been updated earlier in the same sync
+	latest, err := c.akvsClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(azureKeyVaultSecret.Namespace).Get(azureKeyVaultSecret.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	return c.mutateAzureKeyVaultSecretStatus(latest, func(status *akv.AzureKeyVaultSecretStatus) {
+		status.RemoteSecrets = remoteSecrets
+	})
+}
+
+// remoteClusterClient returns the client for the cluster of the kubeconfig Secret of the remote Secret
+func (c *Controller) remoteClusterClient(azureKeyVaultSecret *akv.AzureKeyVaultSecret, remoteSecret akv.AzureKeyVaultOutputCluster) (kubernetes.Interface, error) {
+	kubeConfigSecret, err := c.secretsLister.Secrets(azureKeyVaultSecret.Namespace).Get(remoteSecret.KubeConfigSecret)
+	if err != nil {
+		return nil, err
+	}
+	return c.remoteClusters.get(kubeConfigSecret, remoteSecret.Key)
+}
+
+// syncRemoteCluster writes the Secret data to the cluster of the kubeconfig Secret, unless already written
+func (c *Controller) syncRemoteCluster(azureKeyVaultSecret *akv.AzureKeyVaultSecret, remoteSecret akv.AzureKeyVaultOutputCluster, secretType corev1.SecretType, data map[string][]byte) error {
+	owner := azureKeyVaultSecret.Namespace + "/" + azureKeyVaultSecret.Name
+	namespace, name := remoteSecret.Namespace, remoteSecret.Name
+
+	client, err := c.remoteClusterClient(azureKeyVaultSecret, remoteSecret)
+	if err != nil {
+		return err
+	}
+
+	current, err := client.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+	if exists && current.Annotations[RemoteClusterOwnerAnnotation] != owner {
+		return newOutputConflictError(fmt.Sprintf(MessageResourceExists, namespace+"/"+name))
+	}
+	if exists && current.Type == secretType && reflect.DeepEqual(current.Data, data) {
+		return nil
+	}
+
+	if c.options.DryRun {
+		c.recordDryRun(azureKeyVaultSecret, fmt.Sprintf(MessageDryRunRemoteClusterSecret, namespace+"/"+name, remoteSecret.KubeConfigSecret))
+		return nil
+	}
+
+	newSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   namespace,
+			Annotations: map[string]string{RemoteClusterOwnerAnnotation: owner},
+		},
+		Type: secretType,
+		Data: data,
+	}
+	if exists && current.Type != secretType {
+		// The type of a Secret can not be changed
+		if err = client.CoreV1().Secrets(namespace).Delete(name, &metav1.DeleteOptions{}); err != nil {
+			return err
+		}
+		exists = false
+	}
+	if exists {
+		newSecret.ResourceVersion = current.ResourceVersion
+		_, err = client.CoreV1().Secrets(namespace).Update(newSecret)
+	} else {
+		_, err = client.CoreV1().Secrets(namespace).Create(newSecret)
+	}
+	if err != nil {
+		return err
+	}
+
+	newLogger(azureKeyVaultSecret).Infof("Wrote Secret %s/%s to cluster of kubeconfig Secret %s", namespace, name, remoteSecret.KubeConfigSecret)
+	return nil
+}
+
+// deleteRemoteSecret deletes a Secret written to another cluster, unless it is no longer owned by the
+// AzureKeyVaultSecret. Secrets in clusters whose kubeconfig Secret is gone or invalid are left.
+func (c *Controller) deleteRemoteSecret(azureKeyVaultSecret *akv.AzureKeyVaultSecret, remoteSecret akv.AzureKeyVaultOutputCluster) error {
+	logger := newLogger(azureKeyVaultSecret).WithField("kubeConfigSecret", remoteSecret.KubeConfigSecret)
+	client, err := c.remoteClusterClient(azureKeyVaultSecret, remoteSecret)
+	if err != nil {
+		// Retrying will not help until the kubeconfig Secret is fixed, which would block deleting the AzureKeyVaultSecret
+		msg := fmt.Sprintf(MessageRemoteClusterDeleteFailed, remoteSecret.Namespace+"/"+remoteSecret.Name, remoteSecret.KubeConfigSecret, err)
+		logger.Warning(msg)
+		c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, ErrRemoteCluster, msg)
+		return nil
+	}
+
+	current, err := client.CoreV1().Secrets(remoteSecret.Namespace).Get(remoteSecret.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if current.Annotations[RemoteClusterOwnerAnnotation] != azureKeyVaultSecret.Namespace+"/"+azureKeyVaultSecret.Name {
+		return nil
+	}
+
+	if c.options.DryRun {
+		c.recordDryRun(azureKeyVaultSecret, fmt.Sprintf(MessageDryRunDeleteRemoteClusterSecret, remoteSecret.Namespace+"/"+remoteSecret.Name, remoteSecret.KubeConfigSecret))
+		return nil
+	}
+
+	uid := current.UID
+	err = client.CoreV1().Secrets(remoteSecret.Namespace).Delete(remoteSecret.Name, &metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &uid},
+	})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	logger.Infof("Deleted Secret %s/%s from cluster of kubeconfig Secret", remoteSecret.Namespace, remoteSecret.Name)
+	return nil
+}
+
+// deleteRemoteSecrets deletes all Secrets the AzureKeyVaultSecret has written to other clusters
+func (c *Controller) deleteRemoteSecrets(azureKeyVaultSecret *akv.AzureKeyVaultSecret) error {
+	var lastErr error
+	for _, remoteSecret := range azureKeyVaultSecret.Status.RemoteSecrets {
+		if err := c.deleteRemoteSecret(azureKeyVaultSecret, remoteSecret); err != nil {
+			msg := fmt.Sprintf(MessageRemoteClusterDeleteFailed, remoteSecret.Namespace+"/"+remoteSecret.Name, remoteSecret.KubeConfigSecret, err)
+			c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, ErrRemoteCluster, msg)
+			lastErr = fmt.Errorf(msg)
+		}
+	}
+	return lastErr
+}
@@ -0,0 +1,293 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+// addRemoteCluster adds a kubeconfig Secret for a fake remote cluster with the objects
+func (f *fixture) addRemoteCluster(kubeConfigSecret string, objects ...runtime.Object) *k8sfake.Clientset {
+	remote := k8sfake.NewSimpleClientset(objects...)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: kubeConfigSecret, Namespace: metav1.NamespaceDefault},
+		Data:       map[string][]byte{defaultKubeConfigKey: []byte(kubeConfigSecret)},
+	}
+	if err := f.kubeInformerFactory.Core().V1().Secrets().Informer().GetIndexer().Add(secret); err != nil {
+		f.t.Fatal(err)
+	}
+
+	newClient := f.controller.remoteClusters.newClient
+	f.controller.remoteClusters.newClient = func(kubeConfig []byte) (kubernetes.Interface, error) {
+		if string(kubeConfig) == kubeConfigSecret {
+			return remote, nil
+		}
+		return newClient(kubeConfig)
+	}
+	return remote
+}
+
+func TestSyncWritesSecretToRemoteCluster(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "some-value")
+	remote := f.addRemoteCluster("spoke-kubeconfig")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Spec.Output.Clusters = []akv.AzureKeyVaultOutputCluster{{KubeConfigSecret: "spoke-kubeconfig", Namespace: "apps"}}
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+
+	secret, err := remote.CoreV1().Secrets("apps").Get("my-kubernetes-secret", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := string(secret.Data["value"]); value != "some-value" {
+		t.Errorf("expected remote secret value 'some-value', got '%s'", value)
+	}
+	if owner := secret.Annotations[RemoteClusterOwnerAnnotation]; owner != akvs.Namespace+"/"+akvs.Name {
+		t.Errorf("expected remote secret owned by AzureKeyVaultSecret, got '%s'", owner)
+	}
+
+	f.vault.SetSecret(testVaultName, "my-secret", "new-value")
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	if secret, err = remote.CoreV1().Secrets("apps").Get("my-kubernetes-secret", metav1.GetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if value := string(secret.Data["value"]); value != "new-value" {
+		t.Errorf("expected updated remote secret value 'new-value', got '%s'", value)
+	}
+}
+
+func TestSyncDoesNotOverwriteUnownedRemoteSecret(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "some-value")
+	remote := f.addRemoteCluster("spoke-kubeconfig", &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-kubernetes-secret", Namespace: metav1.NamespaceDefault},
+		Data:       map[string][]byte{"value": []byte("not-ours")},
+	})
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Spec.Output.Clusters = []akv.AzureKeyVaultOutputCluster{{KubeConfigSecret: "spoke-kubeconfig"}}
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err == nil {
+		t.Fatal("expected error writing over Secret not owned by AzureKeyVaultSecret in remote cluster")
+	}
+	f.expectEvent(ErrRemoteCluster)
+
+	secret, err := remote.CoreV1().Secrets(metav1.NamespaceDefault).Get("my-kubernetes-secret", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := string(secret.Data["value"]); value != "not-ours" {
+		t.Errorf("expected unowned remote secret to be unchanged, got '%s'", value)
+	}
+}
+
+func TestSyncFailsWithoutKubeConfigSecret(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "some-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Spec.Output.Clusters = []akv.AzureKeyVaultOutputCluster{{KubeConfigSecret: "missing-kubeconfig"}}
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err == nil {
+		t.Fatal("expected error without kubeconfig Secret")
+	}
+	f.expectEvent(ErrRemoteCluster)
+}
+
+func TestSyncDeletesRemoteSecretRemovedFromClusters(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "some-value")
+	remote := f.addRemoteCluster("spoke-kubeconfig")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Spec.Output.Clusters = []akv.AzureKeyVaultOutputCluster{{KubeConfigSecret: "spoke-kubeconfig", Namespace: "apps"}}
+	f.addAzureKeyVaultSecret(akvs)
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+
+	latest := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name)
+	if !hasCleanupFinalizer(latest) {
+		t.Error("expected cleanup finalizer on AzureKeyVaultSecret writing to other clusters")
+	}
+	if len(latest.Status.RemoteSecrets) != 1 || latest.Status.RemoteSecrets[0].Name != "my-kubernetes-secret" {
+		t.Fatalf("expected remote secret in status, got %v", latest.Status.RemoteSecrets)
+	}
+
+	latest.Spec.Output.Clusters = []akv.AzureKeyVaultOutputCluster{{KubeConfigSecret: "spoke-kubeconfig", Namespace: "other"}}
+	if _, err := f.akvsClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(akvs.Namespace).Update(latest); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := remote.CoreV1().Secrets("apps").Get("my-kubernetes-secret", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("expected remote secret no longer in clusters to be deleted, got %v", err)
+	}
+	if _, err := remote.CoreV1().Secrets("other").Get("my-kubernetes-secret", metav1.GetOptions{}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSyncDeletesRemoteSecretsOfDeletedAzureKeyVaultSecret(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "some-value")
+	remote := f.addRemoteCluster("spoke-kubeconfig", &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "not-ours", Namespace: "apps"},
+	})
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Spec.Output.Clusters = []akv.AzureKeyVaultOutputCluster{{KubeConfigSecret: "spoke-kubeconfig", Namespace: "apps"}}
+	f.addAzureKeyVaultSecret(akvs)
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name)
+	now := metav1.Now()
+	deleted.DeletionTimestamp = &now
+	if _, err := f.akvsClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(akvs.Namespace).Update(deleted); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := remote.CoreV1().Secrets("apps").Get("my-kubernetes-secret", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("expected remote secret to be deleted with AzureKeyVaultSecret, got %v", err)
+	}
+	if _, err := remote.CoreV1().Secrets("apps").Get("not-ours", metav1.GetOptions{}); err != nil {
+		t.Errorf("expected other remote secrets to be left, got %v", err)
+	}
+	if hasCleanupFinalizer(f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name)) {
+		t.Error("expected cleanup finalizer to be removed")
+	}
+}
+
+func TestRemoteClusterClientIsEvictedWhenKubeConfigSecretChanges(t *testing.T) {
+	clients := newRemoteClusterClients()
+	created := 0
+	clients.newClient = func(kubeConfig []byte) (kubernetes.Interface, error) {
+		created++
+		return k8sfake.NewSimpleClientset(), nil
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "spoke-kubeconfig", Namespace: metav1.NamespaceDefault},
+		Data:       map[string][]byte{defaultKubeConfigKey: []byte("first")},
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := clients.get(secret, defaultKubeConfigKey); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if created != 1 {
+		t.Fatalf("expected client to be reused, created %d", created)
+	}
+
+	secret.Data[defaultKubeConfigKey] = []byte("second")
+	if _, err := clients.get(secret, defaultKubeConfigKey); err != nil {
+		t.Fatal(err)
+	}
+	if created != 2 || len(clients.clients) != 1 {
+		t.Errorf("expected client to be replaced for changed kubeconfig, created %d, cached %d", created, len(clients.clients))
+	}
+
+	clients.evict(secret.Namespace, secret.Name)
+	if len(clients.clients) != 0 {
+		t.Errorf("expected client to be evicted, cached %d", len(clients.clients))
+	}
+}
+
+func TestRestConfigFromKubeConfig(t *testing.T) {
+	kubeConfig := func(cluster, user string) []byte {
+		return []byte(`apiVersion: v1
+kind: Config
+current-context: spoke
+contexts:
+- name: spoke
+  context:
+    cluster: spoke
+    user: spoke
+clusters:
+- name: spoke
+  cluster:
+    server: https://spoke.example.com
+` + cluster + `
+users:
+- name: spoke
+  user:
+` + user)
+	}
+
+	tests := []struct {
+		name    string
+		cluster string
+		user    string
+		valid   bool
+	}{
+		{name: "inline token", cluster: "    certificate-authority-data: Y2E=", user: "    token: some-token", valid: true},
+		{name: "inline certificate", user: "    client-certificate-data: Y2VydA==\n    client-key-data: a2V5", valid: true},
+		{name: "exec", user: "    exec:\n      apiVersion: client.authentication.k8s.io/v1beta1\n      command: sh"},
+		{name: "auth provider", user: "    auth-provider:\n      name: gcp"},
+		{name: "token file", user: "    tokenFile: /var/run/secrets/kubernetes.io/serviceaccount/token"},
+		{name: "certificate files", user: "    client-certificate: /etc/cert\n    client-key: /etc/key"},
+		{name: "certificate authority file", cluster: "    certificate-authority: /etc/ca", user: "    token: some-token"},
+		{name: "basic auth", user: "    username: admin\n    password: secret"},
+		{name: "no credentials", user: "    as: admin"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := restConfigFromKubeConfig(kubeConfig(test.cluster, test.user))
+			if test.valid && err != nil {
+				t.Fatal(err)
+			}
+			if !test.valid && err == nil {
+				t.Fatal("expected kubeconfig to be rejected")
+			}
+			if test.valid && config.Host != "https://spoke.example.com" {
+				t.Errorf("expected host of cluster, got '%s'", config.Host)
+			}
+		})
+	}
+}
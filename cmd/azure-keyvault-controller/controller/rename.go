@@ -0,0 +1,152 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// previousSecretRecheckInterval is how often to check if pods still use the previous Secret once its
+// grace period has passed, when tracking consumers
+const previousSecretRecheckInterval = time.Minute
+
+// renameGracePeriod returns how long the Secret of the previous name is kept up to date after the
+// output Secret is renamed. Bundle Secrets are shared, so they are never kept.
+func renameGracePeriod(azureKeyVaultSecret *akv.AzureKeyVaultSecret) time.Duration {
+	if isBundle(azureKeyVaultSecret) {
+		return 0
+	}
+	return time.Duration(azureKeyVaultSecret.Spec.Output.Secret.RenameGracePeriodSeconds) * time.Second
+}
+
+// isRenamedWithGracePeriod returns true if the output Secret last synced to has another name than
+// secretName, and the Secret of that name is to be kept for a grace period
+func isRenamedWithGracePeriod(azureKeyVaultSecret *akv.AzureKeyVaultSecret, secretName string) bool {
+	previous := azureKeyVaultSecret.Status.SecretName
+	return previous != "" && previous != secretName && renameGracePeriod(azureKeyVaultSecret) > 0
+}
+
+// recordRenamedSecret reports that the output Secret has been renamed, and the Secret of the previous
+// name is kept up to date until deleteTime
+func (c *Controller) recordRenamedSecret(azureKeyVaultSecret *akv.AzureKeyVaultSecret, secretName string, deleteTime metav1.Time) {
+	if c.options.DryRun {
+		return
+	}
+	previous := azureKeyVaultSecret.Status.SecretName
+	msg := fmt.Sprintf(MessageSecretRenamed, previous, secretName, previous, deleteTime.Format(time.RFC3339))
+	newLogger(azureKeyVaultSecret).WithField("secret", secretName).Info(msg)
+	c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeNormal, SecretRenamed, msg)
+}
+
+// updatePreviousSecretStatus remembers the Secret of the previous name when the output Secret is renamed
+// to secretName, so it is kept up to date until deleteTime
+func updatePreviousSecretStatus(status *akv.AzureKeyVaultSecretStatus, azureKeyVaultSecret *akv.AzureKeyVaultSecret, secretName string, deleteTime metav1.Time) {
+	// Renamed back to the previous name before it was deleted
+	if status.PreviousSecretName == secretName {
+		status.PreviousSecretName = ""
+		status.PreviousSecretDeleteTime = metav1.Time{}
+	}
+	if isRenamedWithGracePeriod(azureKeyVaultSecret, secretName) {
+		status.PreviousSecretName = status.SecretName
+		status.PreviousSecretDeleteTime = deleteTime
+	}
+}
+
+// updatePreviousSecret writes the new value from Azure Key Vault to the Secret of the previous name
+// as well, while within its grace period
+func (c *Controller) updatePreviousSecret(azureKeyVaultSecret *akv.AzureKeyVaultSecret, values map[string][]byte, objectVersion string) error {
+	previousName := azureKeyVaultSecret.Status.PreviousSecretName
+	if previousName == "" || !c.clock.Now().Time.Before(azureKeyVaultSecret.Status.PreviousSecretDeleteTime.Time) {
+		return nil
+	}
+
+	secret, err := c.secretsLister.Secrets(azureKeyVaultSecret.Namespace).Get(previousName)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(secret, azureKeyVaultSecret) {
+		return nil
+	}
+
+	previous := azureKeyVaultSecret.DeepCopy()
+	previous.Spec.Output.Secret.Name = previousName
+	newLogger(azureKeyVaultSecret).WithField("secret", previousName).Info("Updating Secret of previous name within its grace period")
+	_, err = c.patchSecret(previous, values, objectVersion)
+	return err
+}
+
+// syncPreviousSecret deletes the Secret of the previous name once its grace period has passed, or
+// schedules syncing the AzureKeyVaultSecret again when it does. When tracking consumers, the Secret
+// is kept until no pods use it.
+func (c *Controller) syncPreviousSecret(azureKeyVaultSecret *akv.AzureKeyVaultSecret, key string) error {
+	previousName := azureKeyVaultSecret.Status.PreviousSecretName
+	if previousName == "" {
+		return nil
+	}
+
+	logger := newLogger(azureKeyVaultSecret).WithField("secret", previousName)
+	if remaining := azureKeyVaultSecret.Status.PreviousSecretDeleteTime.Sub(c.clock.Now().Time); remaining > 0 {
+		c.akvsCrdQueue.GetQueue().AddAfter(key, remaining)
+		return nil
+	}
+
+	if c.podIndexer != nil {
+		pods, err := c.podIndexer.ByIndex(secretConsumerIndex, azureKeyVaultSecret.Namespace+"/"+previousName)
+		if err != nil {
+			return err
+		}
+		if len(pods) > 0 {
+			logger.WithField("pods", len(pods)).Info("Grace period of Secret of previous name has passed, but it is still used by pods")
+			c.akvsCrdQueue.GetQueue().AddAfter(key, previousSecretRecheckInterval)
+			return nil
+		}
+	}
+
+	secret, err := c.secretsLister.Secrets(azureKeyVaultSecret.Namespace).Get(previousName)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if err == nil && metav1.IsControlledBy(secret, azureKeyVaultSecret) {
+		if err := c.deleteSecret(azureKeyVaultSecret, previousName); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		if !c.options.DryRun {
+			if err := c.deleteSecretChunks(azureKeyVaultSecret, previousName, 0); err != nil {
+				return err
+			}
+		}
+		if !c.options.DryRun {
+			msg := fmt.Sprintf(MessagePreviousSecretDeleted, previousName, determineSecretName(azureKeyVaultSecret))
+			logger.Info(msg)
+			c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeNormal, PreviousSecretDeleted, msg)
+		}
+	}
+
+	return c.mutateAzureKeyVaultSecretStatus(azureKeyVaultSecret, func(status *akv.AzureKeyVaultSecretStatus) {
+		status.PreviousSecretName = ""
+		status.PreviousSecretDeleteTime = metav1.Time{}
+	})
+}
@@ -0,0 +1,106 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// renameOutputSecret changes spec.output.secret.name of the AzureKeyVaultSecret and syncs it
+func (f *fixture) renameOutputSecret(azureKeyVaultSecret *akv.AzureKeyVaultSecret, name string) {
+	latest := f.getAzureKeyVaultSecret(azureKeyVaultSecret.Namespace, azureKeyVaultSecret.Name)
+	latest.Spec.Output.Secret.Name = name
+	if _, err := f.akvsClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(latest.Namespace).Update(latest); err != nil {
+		f.t.Fatal(err)
+	}
+	f.refresh(latest)
+	if err := f.controller.syncAzureKeyVaultSecret(key(latest)); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+func TestRenamedSecretIsKeptForGracePeriod(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Spec.Output.Secret.RenameGracePeriodSeconds = 3600
+	f.addAzureKeyVaultSecret(akvs)
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.drainEvents()
+
+	f.renameOutputSecret(akvs, "my-renamed-secret")
+	f.expectEvent(SecretRenamed)
+	status := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status
+	if status.SecretName != "my-renamed-secret" || status.PreviousSecretName != "my-kubernetes-secret" {
+		t.Fatalf("expected Secret renamed from 'my-kubernetes-secret' to 'my-renamed-secret', got %+v", status)
+	}
+
+	// Both Secrets get the rotated value within the grace period
+	f.refresh(akvs)
+	f.vault.SetSecret(testVaultName, "my-secret", "second-value")
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"my-renamed-secret", "my-kubernetes-secret"} {
+		if value := string(f.getSecret(akvs.Namespace, name).Data["value"]); value != "second-value" {
+			t.Errorf("expected Secret '%s' to have value 'second-value', got '%s'", name, value)
+		}
+	}
+
+	// Deleted once the grace period has passed
+	latest := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name)
+	latest.Status.PreviousSecretDeleteTime = metav1.NewTime(time.Now().Add(-time.Second))
+	if _, err := f.akvsClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(akvs.Namespace).UpdateStatus(latest); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+	f.drainEvents()
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.expectEvent(PreviousSecretDeleted)
+	if _, err := f.kubeClient.CoreV1().Secrets(akvs.Namespace).Get("my-kubernetes-secret", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("expected Secret of previous name to be deleted, got %v", err)
+	}
+	if status := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status; status.PreviousSecretName != "" {
+		t.Errorf("expected previous Secret to be cleared from status, got '%s'", status.PreviousSecretName)
+	}
+}
+
+func TestRenamedSecretWithoutGracePeriod(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+
+	f.renameOutputSecret(akvs, "my-renamed-secret")
+	if status := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status; status.PreviousSecretName != "" {
+		t.Errorf("expected no previous Secret without grace period, got '%s'", status.PreviousSecretName)
+	}
+}
@@ -0,0 +1,180 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"reflect"
+	"sort"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// AzureKeyVaultSecretReportName is the name of the AzureKeyVaultSecretReport maintained in each namespace
+const AzureKeyVaultSecretReportName = "akv2k8s"
+
+// initReports registers the AzureKeyVaultSecretReport informer, so existing reports are known
+func (c *Controller) initReports() {
+	informer := c.akvsInformerFactory.Keyvault().V2alpha1().AzureKeyVaultSecretReports()
+	informer.Informer()
+	c.azureKeyVaultSecretReportLister = informer.Lister()
+}
+
+// runReporter updates the AzureKeyVaultSecretReports every ReportInterval until stopCh is closed
+func (c *Controller) runReporter(stopCh <-chan struct{}) {
+	if c.options.ReportInterval <= 0 {
+		return
+	}
+	go runUntil(c.clock, c.updateReports, c.options.ReportInterval, stopCh)
+}
+
+// updateReports writes a AzureKeyVaultSecretReport to every namespace with AzureKeyVaultSecrets,
+// and to namespaces with an existing report, so it is reset when all AzureKeyVaultSecrets are deleted
+func (c *Controller) updateReports() {
+	azureKeyVaultSecrets, err := c.azureKeyVaultSecretLister.List(labels.Everything())
+	if err != nil {
+		log.Errorf("failed to list AzureKeyVaultSecrets for reports: %v", err)
+		return
+	}
+	reports, err := c.azureKeyVaultSecretReportLister.List(labels.Everything())
+	if err != nil {
+		log.Errorf("failed to list AzureKeyVaultSecretReports: %v", err)
+		return
+	}
+
+	statuses := map[string]*akv.AzureKeyVaultSecretReportStatus{}
+	for _, report := range reports {
+		if report.Name == AzureKeyVaultSecretReportName {
+			statuses[report.Namespace] = &akv.AzureKeyVaultSecretReportStatus{}
+		}
+	}
+	for _, azureKeyVaultSecret := range azureKeyVaultSecrets {
+		status, ok := statuses[azureKeyVaultSecret.Namespace]
+		if !ok {
+			status = &akv.AzureKeyVaultSecretReportStatus{}
+			statuses[azureKeyVaultSecret.Namespace] = status
+		}
+		c.addToReport(status, azureKeyVaultSecret)
+	}
+
+	for namespace, status := range statuses {
+		// With sharding only one replica writes the report of each namespace
+		if !c.isHandled(namespace, AzureKeyVaultSecretReportName) {
+			continue
+		}
+		sort.Strings(status.FailedSecrets)
+		sort.Strings(status.ExpiringSecrets)
+		if err := c.writeReport(namespace, status); err != nil {
+			log.Errorf("failed to write AzureKeyVaultSecretReport in namespace '%s': %v", namespace, err)
+		}
+	}
+}
+
+// addToReport counts the AzureKeyVaultSecret in the report status
+func (c *Controller) addToReport(status *akv.AzureKeyVaultSecretReportStatus, azureKeyVaultSecret *akv.AzureKeyVaultSecret) {
+	status.Total++
+
+	akvsStatus := &azureKeyVaultSecret.Status
+	if akvsStatus.RetryCount > 0 ||
+		isConditionTrue(akvsStatus, akv.AzureKeyVaultSecretConditionDegraded) ||
+		isConditionTrue(akvsStatus, akv.AzureKeyVaultSecretConditionSoftDeleted) {
+		status.Failed++
+		status.FailedSecrets = append(status.FailedSecrets, azureKeyVaultSecret.Name)
+	} else if akvsStatus.SecretHash != "" {
+		status.Synced++
+	}
+
+	if c.isExpiring(azureKeyVaultSecret) {
+		status.Expiring++
+		status.ExpiringSecrets = append(status.ExpiringSecrets, azureKeyVaultSecret.Name)
+	}
+}
+
+// isExpiring returns true if a certificate in the output Secret of the AzureKeyVaultSecret
+// expires within ReportExpiryWindow
+func (c *Controller) isExpiring(azureKeyVaultSecret *akv.AzureKeyVaultSecret) bool {
+	if azureKeyVaultSecret.Spec.Vault.Object.Type != akv.AzureKeyVaultObjectTypeCertificate || azureKeyVaultSecret.Spec.Output.Secret.Name == "" {
+		return false
+	}
+	secret, err := c.secretsLister.Secrets(azureKeyVaultSecret.Namespace).Get(azureKeyVaultSecret.Spec.Output.Secret.Name)
+	if err != nil {
+		return false
+	}
+
+	deadline := c.clock.Now().Add(c.options.ReportExpiryWindow)
+	for _, value := range secret.Data {
+		for rest := value; ; {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err == nil && cert.NotAfter.Before(deadline) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeReport creates or updates the AzureKeyVaultSecretReport in the namespace, unless unchanged
+func (c *Controller) writeReport(namespace string, status *akv.AzureKeyVaultSecretReportStatus) error {
+	current, err := c.azureKeyVaultSecretReportLister.AzureKeyVaultSecretReports(namespace).Get(AzureKeyVaultSecretReportName)
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	exists := err == nil
+	if exists && reportStatusEqual(&current.Status, status) {
+		return nil
+	}
+
+	if c.options.DryRun {
+		log.WithFields(log.Fields{"namespace": namespace, "dryRun": true}).Info("Dry run: would update AzureKeyVaultSecretReport")
+		return nil
+	}
+
+	status.LastUpdate = c.clock.Now()
+	if exists {
+		report := current.DeepCopy()
+		report.Status = *status
+		_, err = c.akvsClient.KeyvaultV2alpha1().AzureKeyVaultSecretReports(namespace).Update(report)
+		return err
+	}
+
+	report := &akv.AzureKeyVaultSecretReport{
+		ObjectMeta: metav1.ObjectMeta{Name: AzureKeyVaultSecretReportName, Namespace: namespace},
+		Status:     *status,
+	}
+	_, err = c.akvsClient.KeyvaultV2alpha1().AzureKeyVaultSecretReports(namespace).Create(report)
+	return err
+}
+
+// reportStatusEqual compares the counts and names of two report statuses, ignoring LastUpdate
+func reportStatusEqual(a, b *akv.AzureKeyVaultSecretReportStatus) bool {
+	a, b = a.DeepCopy(), b.DeepCopy()
+	a.LastUpdate, b.LastUpdate = metav1.Time{}, metav1.Time{}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,138 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newReportFixture(t *testing.T) *fixture {
+	f := newFixture(t)
+	f.controller.options.ReportInterval = time.Minute
+	f.controller.options.ReportExpiryWindow = 30 * 24 * time.Hour
+	f.controller.initReports()
+	return f
+}
+
+// getReport returns the AzureKeyVaultSecretReport of the namespace from the fake clientset
+func (f *fixture) getReport(namespace string) *akv.AzureKeyVaultSecretReport {
+	report, err := f.akvsClient.KeyvaultV2alpha1().AzureKeyVaultSecretReports(namespace).Get(AzureKeyVaultSecretReportName, metav1.GetOptions{})
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return report
+}
+
+func reportSecret(name string, mutate func(*akv.AzureKeyVaultSecret)) *akv.AzureKeyVaultSecret {
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Name = name
+	akvs.Spec.Output.Secret.Name = name
+	mutate(akvs)
+	return akvs
+}
+
+func TestUpdateReportsCountsAzureKeyVaultSecrets(t *testing.T) {
+	f := newReportFixture(t)
+	f.addAzureKeyVaultSecret(reportSecret("synced", func(akvs *akv.AzureKeyVaultSecret) {
+		akvs.Status.SecretHash = "hash"
+	}))
+	f.addAzureKeyVaultSecret(reportSecret("failed", func(akvs *akv.AzureKeyVaultSecret) {
+		akvs.Status.SecretHash = "hash"
+		akvs.Status.RetryCount = 2
+	}))
+	f.addAzureKeyVaultSecret(reportSecret("pending", func(akvs *akv.AzureKeyVaultSecret) {}))
+	f.addAzureKeyVaultSecret(reportSecret("expiring", func(akvs *akv.AzureKeyVaultSecret) {
+		akvs.Spec.Vault.Object.Type = akv.AzureKeyVaultObjectTypeCertificate
+		akvs.Status.SecretHash = "hash"
+	}))
+	expiredSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "expiring", Namespace: metav1.NamespaceDefault},
+		Data:       map[string][]byte{corev1.TLSCertKey: []byte(pemCertPubOnly)},
+	}
+	if err := f.kubeInformerFactory.Core().V1().Secrets().Informer().GetIndexer().Add(expiredSecret); err != nil {
+		t.Fatal(err)
+	}
+
+	f.controller.updateReports()
+
+	report := f.getReport(metav1.NamespaceDefault)
+	expected := akv.AzureKeyVaultSecretReportStatus{
+		Total:           4,
+		Synced:          2,
+		Failed:          1,
+		Expiring:        1,
+		FailedSecrets:   []string{"failed"},
+		ExpiringSecrets: []string{"expiring"},
+	}
+	if !reportStatusEqual(&report.Status, &expected) {
+		t.Errorf("expected report %+v, got %+v", expected, report.Status)
+	}
+	if report.Status.LastUpdate.IsZero() {
+		t.Error("expected report to have last update time")
+	}
+}
+
+func TestUpdateReportsResetsReportWithoutAzureKeyVaultSecrets(t *testing.T) {
+	f := newReportFixture(t)
+	existing := &akv.AzureKeyVaultSecretReport{
+		ObjectMeta: metav1.ObjectMeta{Name: AzureKeyVaultSecretReportName, Namespace: "team-a"},
+		Status:     akv.AzureKeyVaultSecretReportStatus{Total: 1, Failed: 1, FailedSecrets: []string{"deleted"}},
+	}
+	created, err := f.akvsClient.KeyvaultV2alpha1().AzureKeyVaultSecretReports("team-a").Create(existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = f.akvsInformerFactory.Keyvault().V2alpha1().AzureKeyVaultSecretReports().Informer().GetIndexer().Add(created); err != nil {
+		t.Fatal(err)
+	}
+
+	f.controller.updateReports()
+
+	if status := f.getReport("team-a").Status; !reportStatusEqual(&status, &akv.AzureKeyVaultSecretReportStatus{}) {
+		t.Errorf("expected empty report, got %+v", status)
+	}
+}
+
+func TestUpdateReportsSkipsUnchangedReport(t *testing.T) {
+	f := newReportFixture(t)
+	f.addAzureKeyVaultSecret(reportSecret("synced", func(akvs *akv.AzureKeyVaultSecret) {
+		akvs.Status.SecretHash = "hash"
+	}))
+
+	f.controller.updateReports()
+	report := f.getReport(metav1.NamespaceDefault)
+	if err := f.akvsInformerFactory.Keyvault().V2alpha1().AzureKeyVaultSecretReports().Informer().GetIndexer().Add(report); err != nil {
+		t.Fatal(err)
+	}
+
+	f.akvsClient.ClearActions()
+	f.controller.updateReports()
+	for _, action := range f.akvsClient.Actions() {
+		if action.GetVerb() == "update" || action.GetVerb() == "create" {
+			t.Errorf("expected unchanged report not to be written, got %s", action.GetVerb())
+		}
+	}
+	if !reflect.DeepEqual(f.getReport(metav1.NamespaceDefault), report) {
+		t.Error("expected unchanged report")
+	}
+}
@@ -0,0 +1,273 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ReloadSecretsAnnotation is set on Deployments to a comma separated list of Secrets synced by
+// AzureKeyVaultSecrets that the Deployment uses. When RolloutOnRotation is enabled, the pod template
+// of the Deployment is annotated with a checksum of each Secret, so rotations roll out new pods.
+const ReloadSecretsAnnotation = "keyvault.azure.spv.no/reload-secrets"
+
+// checksumAnnotationPrefix is the prefix of the pod template annotation holding the checksum of a Secret
+const checksumAnnotationPrefix = "checksum/akvs-"
+
+// referencesSecret returns true if the value of ReloadSecretsAnnotation contains secretName
+func referencesSecret(annotations map[string]string, secretName string) bool {
+	for _, name := range strings.Split(annotations[ReloadSecretsAnnotation], ",") {
+		if strings.TrimSpace(name) == secretName {
+			return true
+		}
+	}
+	return false
+}
+
+// rolloutRecheckInterval is how often a staged rollout checks if Deployments being rolled out are done
+const rolloutRecheckInterval = 10 * time.Second
+
+// RolloutOptions stage the rollout of Deployments using a rotated Secret, so rotating a Secret used
+// by many Deployments does not restart all of them at once. The zero value rolls out all at once.
+type RolloutOptions struct {
+	// MaxUnavailable is the number of Deployments using the Secret that may be rolling out at the
+	// same time. Zero does not limit it.
+	MaxUnavailable int
+
+	// OrderLabel is a label on Deployments ordering their rollout by its value, numerically when
+	// all values are numbers. Deployments without the label are rolled out last, ordered by name.
+	OrderLabel string
+
+	// Delay is the time to wait between starting the rollout of one Deployment and the next
+	Delay time.Duration
+}
+
+// staged returns true if Deployments are not all rolled out at once
+func (o RolloutOptions) staged() bool {
+	return o.MaxUnavailable > 0 || o.Delay > 0
+}
+
+// stagedRollout is the rollout of a Secret in progress
+type stagedRollout struct {
+	secretName  string
+	secretHash  string
+	lastStarted time.Time
+}
+
+// rolloutTracker remembers staged rollouts in progress, keyed by namespace/name of the AzureKeyVaultSecret.
+// It is only kept in memory, so rollouts in progress are not continued when the controller restarts.
+type rolloutTracker struct {
+	mutex    sync.Mutex
+	rollouts map[string]stagedRollout
+}
+
+func newRolloutTracker() *rolloutTracker {
+	return &rolloutTracker{
+		rollouts: make(map[string]stagedRollout),
+	}
+}
+
+// get returns the rollout in progress for key, if any
+func (t *rolloutTracker) get(key string) (stagedRollout, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	rollout, ok := t.rollouts[key]
+	return rollout, ok
+}
+
+func (t *rolloutTracker) set(key string, rollout stagedRollout) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.rollouts[key] = rollout
+}
+
+func (t *rolloutTracker) forget(key string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.rollouts, key)
+}
+
+// isRolledOut returns true if all pods of the Deployment run its latest pod template, like
+// kubectl rollout status
+func isRolledOut(deployment *appsv1.Deployment) bool {
+	status := deployment.Status
+	if status.ObservedGeneration < deployment.Generation {
+		return false
+	}
+	if deployment.Spec.Replicas != nil && status.UpdatedReplicas < *deployment.Spec.Replicas {
+		return false
+	}
+	return status.Replicas <= status.UpdatedReplicas && status.AvailableReplicas >= status.UpdatedReplicas
+}
+
+// sortForRollout orders the Deployments by the value of label, numerically when both values are
+// numbers, with Deployments without the label last. Ties are ordered by name.
+func sortForRollout(deployments []appsv1.Deployment, label string) {
+	sort.SliceStable(deployments, func(i, j int) bool {
+		left, leftOk := deployments[i].Labels[label]
+		right, rightOk := deployments[j].Labels[label]
+		if label == "" || (!leftOk && !rightOk) || (leftOk && rightOk && left == right) {
+			return deployments[i].Name < deployments[j].Name
+		}
+		if leftOk != rightOk {
+			return leftOk
+		}
+		leftNumber, leftErr := strconv.Atoi(left)
+		rightNumber, rightErr := strconv.Atoi(right)
+		if leftErr == nil && rightErr == nil {
+			return leftNumber < rightNumber
+		}
+		return left < right
+	})
+}
+
+// rolloutConsumers sets the checksum annotation of the Secret on the pod template of all Deployments
+// referencing it using ReloadSecretsAnnotation, making Kubernetes roll out pods using the new value
+// following the update strategy of each Deployment. When the rollout is staged, only the Deployments
+// allowed by Options.Rollout are rolled out, and the AzureKeyVaultSecret is synced again to continue.
+func (c *Controller) rolloutConsumers(azureKeyVaultSecret *akv.AzureKeyVaultSecret, key string, secretName string, secretHash string) error {
+	if !c.options.RolloutOnRotation {
+		return nil
+	}
+
+	// Listing only on rotation instead of caching all Deployments in the cluster
+	deployments, err := c.kubeclientset.AppsV1().Deployments(azureKeyVaultSecret.Namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list deployments using secret '%s'/'%s', error: %w", azureKeyVaultSecret.Namespace, secretName, err)
+	}
+
+	annotation := checksumAnnotationPrefix + secretName
+	var pending []appsv1.Deployment
+	rollingOut := 0
+	for _, deployment := range deployments.Items {
+		if !referencesSecret(deployment.Annotations, secretName) {
+			continue
+		}
+		if deployment.Spec.Template.Annotations[annotation] != secretHash {
+			pending = append(pending, deployment)
+		} else if !isRolledOut(&deployment) {
+			rollingOut++
+		}
+	}
+	options := c.options.Rollout
+	sortForRollout(pending, options.OrderLabel)
+
+	if c.options.DryRun {
+		for _, deployment := range pending {
+			c.recordDryRun(azureKeyVaultSecret, fmt.Sprintf(MessageDryRunRolloutDeployment, deployment.Name, secretName))
+		}
+		return nil
+	}
+
+	now := c.clock.Now().Time
+	rollout, inProgress := c.rollouts.get(key)
+	if !inProgress || rollout.secretHash != secretHash {
+		rollout = stagedRollout{secretName: secretName, secretHash: secretHash}
+	}
+
+	allowed := len(pending)
+	if options.MaxUnavailable > 0 && options.MaxUnavailable-rollingOut < allowed {
+		allowed = options.MaxUnavailable - rollingOut
+	}
+	if options.Delay > 0 {
+		if rollout.lastStarted.Add(options.Delay).After(now) {
+			allowed = 0
+		} else if allowed > 1 {
+			allowed = 1
+		}
+	}
+
+	logger := newLogger(azureKeyVaultSecret).WithField("secret", secretName)
+	started := 0
+	for _, deployment := range pending {
+		if started >= allowed {
+			break
+		}
+		if err = c.rolloutDeployment(&deployment, annotation, secretHash); err != nil {
+			return fmt.Errorf("failed to roll out deployment '%s'/'%s' using secret '%s', error: %w", deployment.Namespace, deployment.Name, secretName, err)
+		}
+		started++
+		rollout.lastStarted = now
+
+		msg := fmt.Sprintf(MessageDeploymentRolledOut, deployment.Name, secretName)
+		logger.WithField("deployment", deployment.Name).Info(msg)
+		c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeNormal, DeploymentRolledOut, msg)
+	}
+
+	if !options.staged() || started == len(pending) {
+		c.rollouts.forget(key)
+		return nil
+	}
+
+	// Checking Deployments rolling out regularly, but not before the next one may start
+	recheck := rolloutRecheckInterval
+	if wait := rollout.lastStarted.Add(options.Delay).Sub(now); wait > recheck {
+		recheck = wait
+	}
+	logger.WithField("deployments", len(pending)-started).Info("Continuing staged rollout of Deployments using Secret later")
+	c.rollouts.set(key, rollout)
+	c.azureKeyVaultQueue.GetQueue().AddAfter(key, recheck)
+	return nil
+}
+
+// continueRollout continues the staged rollout of Deployments using the Secret of the AzureKeyVaultSecret
+// if one is in progress for secretHash
+func (c *Controller) continueRollout(azureKeyVaultSecret *akv.AzureKeyVaultSecret, key string, secretHash string) error {
+	rollout, ok := c.rollouts.get(key)
+	if !ok {
+		return nil
+	}
+	if rollout.secretHash != secretHash {
+		c.rollouts.forget(key)
+		return nil
+	}
+	return c.rolloutConsumers(azureKeyVaultSecret, key, rollout.secretName, secretHash)
+}
+
+// rolloutDeployment sets the annotation with the checksum of the Secret on the pod template of the Deployment
+func (c *Controller) rolloutDeployment(deployment *appsv1.Deployment, annotation string, secretHash string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]string{annotation: secretHash},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.kubeclientset.AppsV1().Deployments(deployment.Namespace).Patch(deployment.Name, types.StrategicMergePatchType, patch)
+	return err
+}
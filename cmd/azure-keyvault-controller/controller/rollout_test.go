@@ -0,0 +1,240 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func deploymentUsingSecret(name string, labels map[string]string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "default",
+			Labels:      labels,
+			Annotations: map[string]string{ReloadSecretsAnnotation: "my-kubernetes-secret"},
+		},
+	}
+}
+
+func TestSortForRollout(t *testing.T) {
+	tests := []struct {
+		name     string
+		label    string
+		labels   map[string]map[string]string
+		expected []string
+	}{
+		{
+			name:     "by name without label",
+			expected: []string{"a", "b", "c"},
+		},
+		{
+			name:     "numeric values",
+			label:    "order",
+			labels:   map[string]map[string]string{"a": {"order": "10"}, "b": {"order": "2"}, "c": {"order": "1"}},
+			expected: []string{"c", "b", "a"},
+		},
+		{
+			name:     "text values",
+			label:    "order",
+			labels:   map[string]map[string]string{"a": {"order": "web"}, "b": {"order": "api"}, "c": {"order": "api"}},
+			expected: []string{"b", "c", "a"},
+		},
+		{
+			name:     "unlabeled last",
+			label:    "order",
+			labels:   map[string]map[string]string{"b": {"order": "2"}},
+			expected: []string{"b", "a", "c"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			deployments := []appsv1.Deployment{}
+			for _, name := range []string{"c", "a", "b"} {
+				deployments = append(deployments, *deploymentUsingSecret(name, test.labels[name]))
+			}
+			sortForRollout(deployments, test.label)
+			for i, deployment := range deployments {
+				if deployment.Name != test.expected[i] {
+					t.Errorf("expected deployment '%s' at %d, got '%s'", test.expected[i], i, deployment.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestIsRolledOut(t *testing.T) {
+	replicas := int32(2)
+	tests := []struct {
+		name     string
+		status   appsv1.DeploymentStatus
+		expected bool
+	}{
+		{"done", appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2}, true},
+		{"not observed", appsv1.DeploymentStatus{ObservedGeneration: 1, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2}, false},
+		{"not updated", appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 1, AvailableReplicas: 2}, false},
+		{"old pods terminating", appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 3, UpdatedReplicas: 2, AvailableReplicas: 2}, false},
+		{"not available", appsv1.DeploymentStatus{ObservedGeneration: 2, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 1}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			deployment := deploymentUsingSecret("consumer", nil)
+			deployment.Generation = 2
+			deployment.Spec.Replicas = &replicas
+			deployment.Status = test.status
+			if rolledOut := isRolledOut(deployment); rolledOut != test.expected {
+				t.Errorf("expected rolled out %t, got %t", test.expected, rolledOut)
+			}
+		})
+	}
+}
+
+// rotate creates the Deployments and rotates the Secret of the AzureKeyVaultSecret once
+func (f *fixture) rotate(rollout RolloutOptions, deployments ...*appsv1.Deployment) {
+	t := f.t
+	f.controller.options.RolloutOnRotation = true
+	f.controller.options.Rollout = rollout
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+	for _, deployment := range deployments {
+		if _, err := f.kubeClient.AppsV1().Deployments(deployment.Namespace).Create(deployment); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+	f.vault.SetSecret(testVaultName, "my-secret", "second-value")
+	f.pollAndRefresh()
+}
+
+// pollAndRefresh syncs the AzureKeyVaultSecret with Azure Key Vault and refreshes the informer caches
+func (f *fixture) pollAndRefresh() {
+	akvs := azureKeyVaultSecretWithOutput()
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		f.t.Fatal(err)
+	}
+	f.refresh(akvs)
+}
+
+// rolledOut returns the names of the Deployments rolled out with the current value of the Secret
+func (f *fixture) rolledOut() []string {
+	akvs := azureKeyVaultSecretWithOutput()
+	secretHash := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status.SecretHash
+	deployments, err := f.kubeClient.AppsV1().Deployments(akvs.Namespace).List(metav1.ListOptions{})
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	var names []string
+	for _, deployment := range deployments.Items {
+		if deployment.Spec.Template.Annotations["checksum/akvs-my-kubernetes-secret"] == secretHash {
+			names = append(names, deployment.Name)
+		}
+	}
+	return names
+}
+
+// setRollingOut sets the status of the Deployment to still be rolling out, or done
+func (f *fixture) setRollingOut(name string, rollingOut bool) {
+	deployment, err := f.kubeClient.AppsV1().Deployments("default").Get(name, metav1.GetOptions{})
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	deployment.Generation = 2
+	deployment.Status.ObservedGeneration = 2
+	if rollingOut {
+		deployment.Status.ObservedGeneration = 1
+	}
+	if _, err = f.kubeClient.AppsV1().Deployments("default").Update(deployment); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+func expectRolledOut(t *testing.T, f *fixture, expected ...string) {
+	t.Helper()
+	rolledOut := f.rolledOut()
+	if len(rolledOut) != len(expected) {
+		t.Fatalf("expected deployments %v to be rolled out, got %v", expected, rolledOut)
+	}
+	for i := range expected {
+		if rolledOut[i] != expected[i] {
+			t.Fatalf("expected deployments %v to be rolled out, got %v", expected, rolledOut)
+		}
+	}
+}
+
+func TestRolloutMaxUnavailableInOrder(t *testing.T) {
+	f := newFixture(t)
+	f.rotate(RolloutOptions{MaxUnavailable: 1, OrderLabel: "rollout-order"},
+		deploymentUsingSecret("api", map[string]string{"rollout-order": "2"}),
+		deploymentUsingSecret("database", map[string]string{"rollout-order": "1"}),
+		deploymentUsingSecret("web", nil))
+	expectRolledOut(t, f, "database")
+
+	f.setRollingOut("database", true)
+	f.pollAndRefresh()
+	expectRolledOut(t, f, "database")
+
+	f.setRollingOut("database", false)
+	f.pollAndRefresh()
+	expectRolledOut(t, f, "api", "database")
+
+	f.pollAndRefresh()
+	expectRolledOut(t, f, "api", "database", "web")
+	if _, ok := f.controller.rollouts.get(key(azureKeyVaultSecretWithOutput())); ok {
+		t.Error("expected rollout to be done when all deployments are rolled out")
+	}
+}
+
+func TestRolloutDelay(t *testing.T) {
+	clock := newFakeClock(time.Now())
+	f := newFixture(t)
+	f.controller.clock = clock
+	f.rotate(RolloutOptions{Delay: time.Minute},
+		deploymentUsingSecret("api", nil),
+		deploymentUsingSecret("web", nil))
+	expectRolledOut(t, f, "api")
+
+	clock.Step(30 * time.Second)
+	f.pollAndRefresh()
+	expectRolledOut(t, f, "api")
+
+	clock.Step(30 * time.Second)
+	f.pollAndRefresh()
+	expectRolledOut(t, f, "api", "web")
+}
+
+func TestRolloutNotStagedRollsOutAll(t *testing.T) {
+	f := newFixture(t)
+	f.rotate(RolloutOptions{OrderLabel: "rollout-order"},
+		deploymentUsingSecret("api", nil),
+		deploymentUsingSecret("web", nil))
+	expectRolledOut(t, f, "api", "web")
+	if _, ok := f.controller.rollouts.get(key(azureKeyVaultSecretWithOutput())); ok {
+		t.Error("expected no rollout in progress when not staged")
+	}
+}
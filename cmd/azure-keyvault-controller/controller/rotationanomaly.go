@@ -0,0 +1,148 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// maxRotationHistory is the most rotations remembered for each AzureKeyVaultSecret
+const maxRotationHistory = 1000
+
+// RotationAnomalyOptions decides when a secret rotating more often than its baseline is reported.
+// The baseline is the rotation rate of the secret before the window, as seen by the controller.
+type RotationAnomalyOptions struct {
+	// Window is the period rotations are counted over and compared to the baseline. Zero disables it.
+	Window time.Duration
+
+	// Baseline is how far back rotations are remembered for the baseline rate
+	Baseline time.Duration
+
+	// Factor is how many times more rotations than the baseline within Window is an anomaly
+	Factor float64
+
+	// MinRotations is the fewest rotations within Window that is an anomaly, so secrets without
+	// a baseline, like after the controller starts, are not reported for rotating a few times
+	MinRotations int
+}
+
+// rotationHistory has the rotations of a AzureKeyVaultSecret seen by the controller
+type rotationHistory struct {
+	since     time.Time
+	rotations []time.Time
+	warned    time.Time
+}
+
+// rotationTracker remembers the rotations of each AzureKeyVaultSecret, keyed by namespace/name.
+// It is only kept in memory, so the baseline starts over when the controller restarts.
+type rotationTracker struct {
+	mutex   sync.Mutex
+	history map[string]*rotationHistory
+}
+
+func newRotationTracker() *rotationTracker {
+	return &rotationTracker{
+		history: make(map[string]*rotationHistory),
+	}
+}
+
+// record adds a rotation of key at now, and returns the number of rotations within the window, the
+// number expected from the baseline, and whether to report it as an anomaly. An anomaly is only
+// reported once per window.
+func (t *rotationTracker) record(key string, now time.Time, options RotationAnomalyOptions) (int, float64, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	history, ok := t.history[key]
+	if !ok {
+		history = &rotationHistory{since: now}
+		t.history[key] = history
+	}
+
+	baselineStart := now.Add(-options.Baseline)
+	if history.since.After(baselineStart) {
+		baselineStart = history.since
+	}
+	windowStart := now.Add(-options.Window)
+
+	kept := history.rotations[:0]
+	for _, rotation := range history.rotations {
+		if !rotation.Before(baselineStart) {
+			kept = append(kept, rotation)
+		}
+	}
+	history.rotations = append(kept, now)
+	if len(history.rotations) > maxRotationHistory {
+		history.rotations = history.rotations[len(history.rotations)-maxRotationHistory:]
+	}
+
+	recent, before := 0, 0
+	for _, rotation := range history.rotations {
+		if rotation.After(windowStart) {
+			recent++
+		} else {
+			before++
+		}
+	}
+
+	var expected float64
+	if period := windowStart.Sub(baselineStart); period > 0 {
+		expected = float64(before) * float64(options.Window) / float64(period)
+	}
+
+	anomaly := recent >= options.MinRotations && float64(recent) > options.Factor*expected
+	if !anomaly || (!history.warned.IsZero() && now.Sub(history.warned) < options.Window) {
+		return recent, expected, false
+	}
+	history.warned = now
+	return recent, expected, true
+}
+
+// forget removes the rotations of a deleted AzureKeyVaultSecret
+func (t *rotationTracker) forget(key string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.history, key)
+}
+
+// checkRotationAnomaly records a rotation of the AzureKeyVaultSecret, and reports it with an event and
+// metric if the secret now rotates far more often than its baseline, which may be caused by a
+// misconfiguration or an attack upstream
+func (c *Controller) checkRotationAnomaly(azureKeyVaultSecret *akv.AzureKeyVaultSecret, key string) {
+	options := c.options.RotationAnomaly
+	if options.Window <= 0 {
+		return
+	}
+
+	recent, expected, anomaly := c.rotations.record(key, c.clock.Now().Time, options)
+	if !anomaly {
+		return
+	}
+
+	vaultSpec := azureKeyVaultSecret.Spec.Vault
+	msg := fmt.Sprintf(MessageSecretRotationAnomaly, vaultSpec.Object.Name, vaultSpec.Name, recent, options.Window, options.Factor, expected)
+	newLogger(azureKeyVaultSecret).WithFields(log.Fields{"rotations": recent, "baseline": expected}).Warning(msg)
+	c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, SecretRotationAnomaly, msg)
+	rotationAnomalies.WithLabelValues(azureKeyVaultSecret.Namespace, azureKeyVaultSecret.Name).Inc()
+}
@@ -0,0 +1,93 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRotationTrackerComparesWithBaseline(t *testing.T) {
+	options := RotationAnomalyOptions{Window: time.Hour, Baseline: 24 * time.Hour, Factor: 5, MinRotations: 3}
+	tracker := newRotationTracker()
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Rotating every hour for a day is the baseline
+	for hour := 0; hour < 24; hour++ {
+		if _, _, anomaly := tracker.record("default/my-secret", start.Add(time.Duration(hour)*time.Hour), options); anomaly {
+			t.Fatalf("expected hourly rotation not to be an anomaly at hour %d", hour)
+		}
+	}
+
+	// Five rotations within the hour is not more than five times the baseline
+	now := start.Add(24 * time.Hour)
+	for i := 0; i < 5; i++ {
+		now = now.Add(time.Minute)
+		if _, _, anomaly := tracker.record("default/my-secret", now, options); anomaly {
+			t.Fatalf("expected rotation %d not to be an anomaly", i)
+		}
+	}
+
+	now = now.Add(time.Minute)
+	recent, expected, anomaly := tracker.record("default/my-secret", now, options)
+	if !anomaly {
+		t.Fatalf("expected %d rotations within the hour with baseline %.2f to be an anomaly", recent, expected)
+	}
+	if recent != 6 || expected < 0.9 || expected > 1.1 {
+		t.Errorf("expected 6 rotations and a baseline of about 1, got %d and %.2f", recent, expected)
+	}
+
+	// Only reported once per window
+	if _, _, anomaly := tracker.record("default/my-secret", now.Add(time.Minute), options); anomaly {
+		t.Error("expected anomaly to be reported once per window")
+	}
+	if _, _, anomaly := tracker.record("default/other-secret", now, options); anomaly {
+		t.Error("expected rotations to be tracked per AzureKeyVaultSecret")
+	}
+}
+
+func TestSyncReportsRotationAnomaly(t *testing.T) {
+	f := newFixture(t)
+	f.controller.options.RotationAnomaly = RotationAnomalyOptions{Window: time.Hour, Baseline: 24 * time.Hour, Factor: 10, MinRotations: 3}
+	f.vault.SetSecret(testVaultName, "my-secret", "value-0")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+	deleteRotationMetrics(akvs.Namespace, akvs.Name)
+	defer deleteRotationMetrics(akvs.Namespace, akvs.Name)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		f.refresh(akvs)
+		f.drainEvents()
+		f.vault.SetSecret(testVaultName, "my-secret", fmt.Sprintf("value-%d", i))
+		if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.expectEvent(SecretRotationAnomaly)
+
+	if count := testutil.ToFloat64(rotationAnomalies.WithLabelValues(akvs.Namespace, akvs.Name)); count != 1 {
+		t.Errorf("expected 1 rotation anomaly, got %v", count)
+	}
+}
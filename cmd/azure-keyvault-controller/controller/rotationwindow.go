@@ -0,0 +1,163 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// rotationWindowDays are the days of a rotation window, as written in the AzureKeyVaultSecret
+var rotationWindowDays = map[string]time.Weekday{
+	"Sun": time.Sunday,
+	"Mon": time.Monday,
+	"Tue": time.Tuesday,
+	"Wed": time.Wednesday,
+	"Thu": time.Thursday,
+	"Fri": time.Friday,
+	"Sat": time.Saturday,
+}
+
+// rotationWindow is a parsed AzureKeyVaultRotationWindow, with start and end as the time since midnight
+type rotationWindow struct {
+	days     map[time.Weekday]bool
+	start    time.Duration
+	end      time.Duration
+	location *time.Location
+}
+
+// rotationWindowFor returns the rotation window of the AzureKeyVaultSecret, or nil if changes are applied at once
+func rotationWindowFor(azureKeyVaultSecret *akv.AzureKeyVaultSecret) (*rotationWindow, error) {
+	policy := azureKeyVaultSecret.Spec.RotationPolicy
+	if policy == nil || policy.Window == nil {
+		return nil, nil
+	}
+	return parseRotationWindow(policy.Window)
+}
+
+func parseRotationWindow(spec *akv.AzureKeyVaultRotationWindow) (*rotationWindow, error) {
+	window := &rotationWindow{days: map[time.Weekday]bool{}, location: time.UTC}
+	for _, day := range spec.Days {
+		weekday, ok := rotationWindowDays[day]
+		if !ok {
+			return nil, fmt.Errorf("unknown day '%s' in spec.rotationPolicy.window.days", day)
+		}
+		window.days[weekday] = true
+	}
+
+	var err error
+	if window.start, err = parseTimeOfDay(spec.Start); err != nil {
+		return nil, fmt.Errorf("invalid spec.rotationPolicy.window.start: %w", err)
+	}
+	if window.end, err = parseTimeOfDay(spec.End); err != nil {
+		return nil, fmt.Errorf("invalid spec.rotationPolicy.window.end: %w", err)
+	}
+	if window.start == window.end {
+		return nil, fmt.Errorf("spec.rotationPolicy.window.start and end must differ")
+	}
+
+	if spec.TimeZone != "" {
+		if window.location, err = time.LoadLocation(spec.TimeZone); err != nil {
+			return nil, fmt.Errorf("invalid spec.rotationPolicy.window.timeZone: %w", err)
+		}
+	}
+	return window, nil
+}
+
+// parseTimeOfDay returns the time since midnight of a time of day like 02:00
+func parseTimeOfDay(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not a time of day like 02:00", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// opensOn returns true if the window opens on the day
+func (w *rotationWindow) opensOn(day time.Weekday) bool {
+	return len(w.days) == 0 || w.days[day]
+}
+
+// isOpen returns true if t is within the window. Windows ending before they start close the day after opening.
+func (w *rotationWindow) isOpen(t time.Time) bool {
+	t = t.In(w.location)
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, w.location)
+	sinceMidnight := t.Sub(midnight)
+
+	if w.start < w.end {
+		return w.opensOn(t.Weekday()) && sinceMidnight >= w.start && sinceMidnight < w.end
+	}
+	if w.opensOn(t.Weekday()) && sinceMidnight >= w.start {
+		return true
+	}
+	yesterday := midnight.AddDate(0, 0, -1).Weekday()
+	return w.opensOn(yesterday) && sinceMidnight < w.end
+}
+
+// nextOpen returns when the window opens next after t, or t if it is open
+func (w *rotationWindow) nextOpen(t time.Time) time.Time {
+	if w.isOpen(t) {
+		return t
+	}
+	local := t.In(w.location)
+	for i := 0; i <= 7; i++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()+i, 0, 0, 0, 0, w.location)
+		opens := time.Date(day.Year(), day.Month(), day.Day(), int(w.start/time.Hour), int(w.start%time.Hour/time.Minute), 0, 0, w.location)
+		if opens.After(t) && w.opensOn(day.Weekday()) {
+			return opens
+		}
+	}
+	return t
+}
+
+// deferRotation returns true if the change to the object in Azure Key Vault must wait for the rotation window
+// of the AzureKeyVaultSecret. The PendingRotation condition is then set, and the AzureKeyVaultSecret is polled
+// again when the window opens. The status keeps the last applied version, so the change is found again then.
+func (c *Controller) deferRotation(azureKeyVaultSecret *akv.AzureKeyVaultSecret, key string) (bool, error) {
+	window, err := rotationWindowFor(azureKeyVaultSecret)
+	if err != nil || window == nil {
+		return false, err
+	}
+
+	now := c.clock.Now()
+	if window.isOpen(now.Time) {
+		return false, nil
+	}
+
+	opens := window.nextOpen(now.Time)
+	msg := fmt.Sprintf(MessageRotationPending, azureKeyVaultSecret.Spec.Vault.Object.Name, opens.Format(time.RFC3339))
+	if !isConditionTrue(&azureKeyVaultSecret.Status, akv.AzureKeyVaultSecretConditionPendingRotation) {
+		newLogger(azureKeyVaultSecret).WithField("opens", opens).Info("Secret has changed in Azure Key Vault, waiting for rotation window to update Secret")
+		c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeNormal, RotationPending, msg)
+	}
+
+	err = c.mutateAzureKeyVaultSecretStatus(azureKeyVaultSecret, func(status *akv.AzureKeyVaultSecretStatus) {
+		status.LastAzureUpdate = now
+		setCondition(status, akv.AzureKeyVaultSecretCondition{
+			Type:    akv.AzureKeyVaultSecretConditionPendingRotation,
+			Status:  corev1.ConditionTrue,
+			Reason:  "OutsideWindow",
+			Message: msg,
+		}, now)
+	})
+
+	c.azureKeyVaultQueue.GetQueue().AddAfter(key, opens.Sub(now.Time))
+	return true, err
+}
@@ -0,0 +1,126 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+	"time"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+)
+
+func TestRotationWindowIsOpen(t *testing.T) {
+	// Wednesday 3 June 2020
+	wednesday := func(hour, minute int) time.Time { return time.Date(2020, 6, 3, hour, minute, 0, 0, time.UTC) }
+
+	tests := []struct {
+		window akv.AzureKeyVaultRotationWindow
+		time   time.Time
+		open   bool
+	}{
+		{akv.AzureKeyVaultRotationWindow{Start: "02:00", End: "04:00"}, wednesday(2, 0), true},
+		{akv.AzureKeyVaultRotationWindow{Start: "02:00", End: "04:00"}, wednesday(4, 0), false},
+		{akv.AzureKeyVaultRotationWindow{Start: "02:00", End: "04:00"}, wednesday(1, 59), false},
+		{akv.AzureKeyVaultRotationWindow{Days: []string{"Wed"}, Start: "02:00", End: "04:00"}, wednesday(3, 0), true},
+		{akv.AzureKeyVaultRotationWindow{Days: []string{"Sat", "Sun"}, Start: "02:00", End: "04:00"}, wednesday(3, 0), false},
+		{akv.AzureKeyVaultRotationWindow{Days: []string{"Tue"}, Start: "22:00", End: "02:00"}, wednesday(1, 0), true},
+		{akv.AzureKeyVaultRotationWindow{Days: []string{"Wed"}, Start: "22:00", End: "02:00"}, wednesday(1, 0), false},
+		{akv.AzureKeyVaultRotationWindow{Days: []string{"Wed"}, Start: "22:00", End: "02:00"}, wednesday(23, 0), true},
+		{akv.AzureKeyVaultRotationWindow{Start: "02:00", End: "04:00", TimeZone: "Europe/Oslo"}, wednesday(1, 0), true},
+	}
+
+	for _, test := range tests {
+		window, err := parseRotationWindow(&test.window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if open := window.isOpen(test.time); open != test.open {
+			t.Errorf("expected window %+v to be open %t at %s, got %t", test.window, test.open, test.time, open)
+		}
+	}
+}
+
+func TestRotationWindowNextOpen(t *testing.T) {
+	window, err := parseRotationWindow(&akv.AzureKeyVaultRotationWindow{Days: []string{"Sat"}, Start: "02:00", End: "04:00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wednesday := time.Date(2020, 6, 3, 12, 0, 0, 0, time.UTC)
+	if opens, expected := window.nextOpen(wednesday), time.Date(2020, 6, 6, 2, 0, 0, 0, time.UTC); !opens.Equal(expected) {
+		t.Errorf("expected window to open at %s, got %s", expected, opens)
+	}
+	saturday := time.Date(2020, 6, 6, 3, 0, 0, 0, time.UTC)
+	if opens := window.nextOpen(saturday); !opens.Equal(saturday) {
+		t.Errorf("expected open window to be open at once, got %s", opens)
+	}
+}
+
+func TestInvalidRotationWindow(t *testing.T) {
+	for _, window := range []akv.AzureKeyVaultRotationWindow{
+		{Start: "2am", End: "04:00"},
+		{Start: "02:00", End: "02:00"},
+		{Days: []string{"Someday"}, Start: "02:00", End: "04:00"},
+		{Start: "02:00", End: "04:00", TimeZone: "Nowhere/Town"},
+	} {
+		if _, err := parseRotationWindow(&window); err == nil {
+			t.Errorf("expected error for window %+v", window)
+		}
+	}
+}
+
+func TestSyncDefersRotationUntilWindowOpens(t *testing.T) {
+	f := newFixture(t)
+	clock := newFakeClock(time.Date(2020, 6, 3, 12, 0, 0, 0, time.UTC))
+	f.controller.clock = clock
+	f.vault.SetSecret(testVaultName, "my-secret", "old-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Spec.RotationPolicy = &akv.AzureKeyVaultRotationPolicy{
+		Window: &akv.AzureKeyVaultRotationWindow{Start: "02:00", End: "04:00"},
+	}
+	f.addAzureKeyVaultSecret(akvs)
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+	f.drainEvents()
+
+	f.vault.SetSecret(testVaultName, "my-secret", "new-value")
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	if value := string(f.getSecret(akvs.Namespace, "my-kubernetes-secret").Data["value"]); value != "old-value" {
+		t.Errorf("expected Secret to keep 'old-value' outside the rotation window, got '%s'", value)
+	}
+	f.expectEvent(RotationPending)
+	f.refresh(akvs)
+	if !isConditionTrue(&f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status, akv.AzureKeyVaultSecretConditionPendingRotation) {
+		t.Error("expected PendingRotation condition to be true")
+	}
+
+	clock.Step(14 * time.Hour)
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	if value := string(f.getSecret(akvs.Namespace, "my-kubernetes-secret").Data["value"]); value != "new-value" {
+		t.Errorf("expected Secret to be updated to 'new-value' in the rotation window, got '%s'", value)
+	}
+	if isConditionTrue(&f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name).Status, akv.AzureKeyVaultSecretConditionPendingRotation) {
+		t.Error("expected PendingRotation condition to be cleared")
+	}
+}
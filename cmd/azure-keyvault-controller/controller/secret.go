@@ -22,10 +22,15 @@ package controller
 import (
 	"bytes"
 	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"sort"
 
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/akv2k8s"
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
 	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
 	log "github.com/sirupsen/logrus"
 	"kmodules.xyz/client-go/tools/queue"
@@ -34,6 +39,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/tools/cache"
 )
@@ -51,7 +57,7 @@ func (c *Controller) initSecret() {
 				return
 			}
 
-			if c.isOwnedByAzureKeyVaultSecret(secret) {
+			if (c.isOwnedByAzureKeyVaultSecret(secret) && c.isHandled(secret.Namespace, metav1.GetControllerOf(secret).Name)) || isBundleSecret(secret) {
 				log.Debugf("Secret %s/%s controlled by AzureKeyVaultSecret added. Adding to queue.", secret.Namespace, secret.Name)
 				queue.Enqueue(c.akvsSecretQueue.GetQueue(), secret)
 			}
@@ -73,12 +79,15 @@ func (c *Controller) initSecret() {
 				return
 			}
 
+			// Clients of other clusters are created again from the changed kubeconfig Secret when next used
+			c.remoteClusters.evict(newSecret.Namespace, newSecret.Name)
+
 			if c.isCABundleSecret(newSecret) {
 				queue.Enqueue(c.caBundleSecretQueue.GetQueue(), newSecret)
 				return
 			}
 
-			if c.isOwnedByAzureKeyVaultSecret(newSecret) {
+			if (c.isOwnedByAzureKeyVaultSecret(newSecret) && c.isHandled(newSecret.Namespace, metav1.GetControllerOf(newSecret).Name)) || isBundleSecret(newSecret) {
 				log.Debugf("Secret %s/%s controlled by AzureKeyVaultSecret changed. Handling.", newSecret.Namespace, newSecret.Name)
 				queue.Enqueue(c.akvsSecretQueue.GetQueue(), newSecret)
 			}
@@ -89,14 +98,19 @@ func (c *Controller) initSecret() {
 				log.Errorf("failed to convert to secret: %v", err)
 			}
 
+			c.remoteClusters.evict(secret.Namespace, secret.Name)
+
 			if c.isCABundleSecret(secret) {
 				queue.Enqueue(c.caBundleSecretQueue.GetQueue(), secret)
 				return
 			}
 
-			if c.isOwnedByAzureKeyVaultSecret(secret) {
+			if c.isOwnedByAzureKeyVaultSecret(secret) && c.isHandled(secret.Namespace, metav1.GetControllerOf(secret).Name) {
 				log.Debugf("Secret %s/%s controlled by AzureKeyVaultSecret deleted. Handling.", secret.Namespace, secret.Name)
-				queue.Enqueue(c.akvsSecretQueue.GetQueue(), secret)
+				c.recreateDeletedSecret(secret)
+			} else if isBundleSecret(secret) {
+				log.Debugf("Bundle Secret %s/%s deleted. Recreating it.", secret.Namespace, secret.Name)
+				c.enqueueBundleOwners(secret)
 			}
 		},
 	})
@@ -123,9 +137,22 @@ func (c *Controller) syncSecret(key string) error {
 		return err
 	}
 
+	if isBundleSecret(secret) && metav1.GetControllerOf(secret) == nil {
+		if err := c.pruneBundleSecret(secret); err != nil {
+			return err
+		}
+		c.enqueueBundleOwners(secret)
+		return nil
+	}
+
 	if ownerRef := metav1.GetControllerOf(secret); ownerRef != nil {
 		azureKeyVaultSecret, err := c.getAzureKeyVaultSecretFromSecret(secret, ownerRef)
 		if err != nil {
+			// The owner is deleted, or not handled by this controller because of --crd-label-selector
+			if errors.IsNotFound(err) {
+				log.Debugf("AzureKeyVaultSecret owning Secret %s not found, ignoring", key)
+				return nil
+			}
 			return err
 		}
 
@@ -136,6 +163,33 @@ func (c *Controller) syncSecret(key string) error {
 	return nil
 }
 
+// recreateDeletedSecret enqueues the AzureKeyVaultSecret owning a deleted Secret, so the
+// Secret is recreated right away instead of on the next resync
+func (c *Controller) recreateDeletedSecret(secret *corev1.Secret) {
+	azureKeyVaultSecret, err := c.getAzureKeyVaultSecretFromSecret(secret, metav1.GetControllerOf(secret))
+	if err != nil {
+		// The Secret is garbage collected because the AzureKeyVaultSecret is deleted
+		if !errors.IsNotFound(err) {
+			log.Errorf("failed to get AzureKeyVaultSecret owning deleted Secret %s/%s: %v", secret.Namespace, secret.Name, err)
+		}
+		return
+	}
+
+	if azureKeyVaultSecret.DeletionTimestamp != nil || !c.akvsHasSecretOutput(azureKeyVaultSecret) || isSecretDeletedWithObject(azureKeyVaultSecret) {
+		return
+	}
+
+	// Like the Secret of the previous name of a renamed output Secret
+	if secret.Name != determineSecretName(azureKeyVaultSecret) {
+		return
+	}
+
+	msg := fmt.Sprintf(MessageSecretDeleted, secret.Name)
+	newLogger(azureKeyVaultSecret).WithField("secret", secret.Name).Warning(msg)
+	c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, SecretDeleted, msg)
+	queue.Enqueue(c.akvsCrdQueue.GetQueue(), azureKeyVaultSecret)
+}
+
 func (c *Controller) isCABundleSecret(secret *corev1.Secret) bool {
 	return secret.Namespace == c.caBundleSecretNamespaceName && secret.Name == c.caBundleSecretName
 }
@@ -174,49 +228,80 @@ func (c *Controller) getOrCreateKubernetesSecret(azureKeyVaultSecret *akv.AzureK
 		return nil, fmt.Errorf("output secret name must be specified using spec.output.secret.name")
 	}
 
-	log.Debugf("Get or create secret %s in namespace %s", secretName, azureKeyVaultSecret.Namespace)
-	if secret, err = c.secretsLister.Secrets(azureKeyVaultSecret.Namespace).Get(secretName); err != nil {
+	logger := newLogger(azureKeyVaultSecret).WithField("secret", secretName)
+	logger.Debug("Get or create secret")
+	secret, err = c.secretsLister.Secrets(azureKeyVaultSecret.Namespace).Get(secretName)
+	// A bundle Secret may exist before the AzureKeyVaultSecret has contributed to it
+	if err == nil && isBundle(azureKeyVaultSecret) && !isInBundle(azureKeyVaultSecret, secret) {
+		err = errors.NewNotFound(corev1.Resource("secrets"), secretName)
+	}
+	if err != nil {
 		if errors.IsNotFound(err) {
 			secretValues, err = c.getSecretFromKeyVault(azureKeyVaultSecret)
 			if err != nil {
-				return nil, fmt.Errorf("failed to get secret from Azure Key Vault for secret '%s'/'%s', error: %+v", azureKeyVaultSecret.Namespace, azureKeyVaultSecret.Name, err)
+				return nil, fmt.Errorf("failed to get secret from Azure Key Vault for secret '%s'/'%s'%s, error: %w", azureKeyVaultSecret.Namespace, azureKeyVaultSecret.Name, formatRequestIDs(vault.RequestIDs(err)), err)
 			}
 
-			if secret, err = c.kubeclientset.CoreV1().Secrets(azureKeyVaultSecret.Namespace).Create(createNewSecret(azureKeyVaultSecret, secretValues)); err != nil {
+			if secret, err = c.createSecret(azureKeyVaultSecret, secretValues, azureKeyVaultSecret.Spec.Vault.Object.Version); err != nil {
 				return nil, err
 			}
 
-			log.Infof("Updating status for AzureKeyVaultSecret '%s'", azureKeyVaultSecret.Name)
-			if err = c.updateAzureKeyVaultSecretStatus(azureKeyVaultSecret, getMD5Hash(secretValues)); err != nil {
+			logger.Info("Updating status for AzureKeyVaultSecret")
+			if err = c.updateAzureKeyVaultSecretStatus(azureKeyVaultSecret, getSecretHash(secretValues), nil, azureKeyVaultSecret.Spec.Vault.Name); err != nil {
 				return nil, err
 			}
 
+			if !c.options.DryRun {
+				c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeNormal, SuccessSynced, MessageAzureKeyVaultSecretSynced)
+			}
+
 			return secret, nil
 		}
 	}
 
+	// The data of chunked Secrets are in its chunks, so values and drift are compared with those
+	if !isBundle(azureKeyVaultSecret) && isChunkedSecret(secret) && metav1.IsControlledBy(secret, azureKeyVaultSecret) {
+		if secret, err = c.assembleChunkedSecret(azureKeyVaultSecret, secret); err != nil {
+			return nil, err
+		}
+	}
+
 	if secretName != secret.Name {
 		// Name of secret has changed in AzureKeyVaultSecret, so we need to delete current Secret and recreate
 		// under new name
 
 		// Delete secret
-		if err = c.kubeclientset.CoreV1().Secrets(azureKeyVaultSecret.Namespace).Delete(secret.Name, nil); err != nil {
+		if err = c.deleteSecret(azureKeyVaultSecret, secret.Name); err != nil {
 			return nil, err
 		}
 
 		// Recreate secret under new Name
-		if secret, err = c.kubeclientset.CoreV1().Secrets(azureKeyVaultSecret.Namespace).Create(createNewSecret(azureKeyVaultSecret, secretValues)); err != nil {
+		if secret, err = c.createSecret(azureKeyVaultSecret, secretValues, azureKeyVaultSecret.Status.ObjectVersion); err != nil {
 			return nil, err
 		}
 		return secret, nil
 	}
 
-	if hasAzureKeyVaultSecretChanged(azureKeyVaultSecret, secret) {
-		log.Infof("AzureKeyVaultSecret %s/%s output.secret values has changed and requires update to Secret %s", azureKeyVaultSecret.Namespace, azureKeyVaultSecret.Name, secretName)
-		secret, err = c.kubeclientset.CoreV1().Secrets(azureKeyVaultSecret.Namespace).Update(createNewSecret(azureKeyVaultSecret, secret.Data))
+	// Written from Azure Key Vault, so there is no drift to check for
+	if !isBundle(azureKeyVaultSecret) && ownsSecret(azureKeyVaultSecret, secret) && hasFilteredKeys(azureKeyVaultSecret, secret) {
+		return c.removeFilteredKeys(azureKeyVaultSecret, secret)
 	}
 
-	return secret, err
+	// Changes to bundle keys are found by drift detection, as the bundle has keys of other AzureKeyVaultSecrets
+	if !isBundle(azureKeyVaultSecret) && hasAzureKeyVaultSecretChanged(azureKeyVaultSecret, secret) {
+		logger.Info("AzureKeyVaultSecret output.secret values has changed and requires update to Secret")
+		secret, err = c.patchSecret(azureKeyVaultSecret, secret.Data, azureKeyVaultSecret.Status.ObjectVersion)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if ownsSecret(azureKeyVaultSecret, secret) {
+		if err = c.handleSecretDrift(azureKeyVaultSecret, secret); err != nil {
+			return nil, err
+		}
+	}
+	return secret, nil
 }
 
 // newSecret creates a new Secret for a AzureKeyVaultSecret resource. It also sets
@@ -226,12 +311,25 @@ func createNewSecret(azureKeyVaultSecret *akv.AzureKeyVaultSecret, azureSecretVa
 	secretName := determineSecretName(azureKeyVaultSecret)
 	secretType := determineSecretType(azureKeyVaultSecret)
 
+	// Copying labels and annotations, so the managed label and owner annotation are not added to the AzureKeyVaultSecret in the cache
+	secretLabels := make(map[string]string, len(azureKeyVaultSecret.Labels)+1)
+	for key, value := range azureKeyVaultSecret.Labels {
+		secretLabels[key] = value
+	}
+	secretLabels[ManagedSecretLabel] = "true"
+
+	secretAnnotations := make(map[string]string, len(azureKeyVaultSecret.Annotations)+1)
+	for key, value := range azureKeyVaultSecret.Annotations {
+		secretAnnotations[key] = value
+	}
+	secretAnnotations[OwnerAnnotation] = azureKeyVaultSecret.Name
+
 	return &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        secretName,
 			Namespace:   azureKeyVaultSecret.Namespace,
-			Labels:      azureKeyVaultSecret.Labels,
-			Annotations: azureKeyVaultSecret.Annotations,
+			Labels:      secretLabels,
+			Annotations: secretAnnotations,
 			OwnerReferences: []metav1.OwnerReference{
 				*metav1.NewControllerRef(azureKeyVaultSecret, schema.GroupVersionKind{
 					Group:   akv.SchemeGroupVersion.Group,
@@ -245,6 +343,81 @@ func createNewSecret(azureKeyVaultSecret *akv.AzureKeyVaultSecret, azureSecretVa
 	}
 }
 
+// patchSecret updates the Secret of a AzureKeyVaultSecret using a strategic merge patch, so labels,
+// annotations and owners added by others are kept, while data is replaced by the given values.
+// In dry run mode the keys that would change are reported instead. objectVersion is the version of
+// the Azure Key Vault object the value is from, if known.
+func (c *Controller) patchSecret(azureKeyVaultSecret *akv.AzureKeyVaultSecret, azureSecretValue map[string][]byte, objectVersion string) (*corev1.Secret, error) {
+	if isBundle(azureKeyVaultSecret) {
+		return c.updateBundleSecret(azureKeyVaultSecret, azureSecretValue, objectVersion)
+	}
+
+	if err := checkSecretSize(azureKeyVaultSecret, azureSecretValue); err != nil {
+		return nil, err
+	}
+
+	newSecret := createNewSecret(azureKeyVaultSecret, azureSecretValue)
+	newSecret.Annotations = c.withControllerAnnotation(azureKeyVaultSecret, newSecret.Annotations)
+	var currentData map[string][]byte
+	if current, err := c.secretsLister.Secrets(newSecret.Namespace).Get(newSecret.Name); err == nil {
+		if err = c.checkSecretController(azureKeyVaultSecret, current); err != nil {
+			return nil, err
+		}
+		currentData = current.Data
+		if assembled, err := c.assembleSecretData(current); err == nil {
+			currentData = assembled
+		}
+	}
+	if c.options.DryRun {
+		c.recordDryRun(azureKeyVaultSecret, fmt.Sprintf(MessageDryRunUpdateSecret, newSecret.Name, formatKeys(diffSecretData(currentData, azureSecretValue))))
+		return newSecret, nil
+	}
+
+	chunkedData, chunks, err := c.writeSecretChunks(azureKeyVaultSecret, azureSecretValue)
+	if err != nil {
+		return nil, err
+	}
+	newSecret.Data = chunkedData
+
+	data := map[string]interface{}{
+		"$patch": "replace",
+	}
+	for key, value := range newSecret.Data {
+		data[key] = base64.StdEncoding.EncodeToString(value)
+	}
+
+	// Leaving out labels and annotations when empty, as null would remove all of them
+	metadata := map[string]interface{}{
+		"ownerReferences": newSecret.OwnerReferences,
+	}
+	if len(newSecret.Labels) > 0 {
+		metadata["labels"] = newSecret.Labels
+	}
+	if len(newSecret.Annotations) > 0 {
+		metadata["annotations"] = newSecret.Annotations
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": metadata,
+		"type":     newSecret.Type,
+		"data":     data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create patch for secret '%s'/'%s', error: %w", newSecret.Namespace, newSecret.Name, err)
+	}
+
+	secret, err := c.kubeclientset.CoreV1().Secrets(newSecret.Namespace).Patch(newSecret.Name, types.StrategicMergePatchType, patch)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.deleteSecretChunks(azureKeyVaultSecret, secret.Name, chunks); err != nil {
+		return nil, err
+	}
+	c.auditSecret(AuditActionUpdate, secret.Namespace, secret.Name, azureKeyVaultSecret, objectVersion, diffSecretData(currentData, azureSecretValue))
+	secret.Data = azureSecretValue
+	return secret, nil
+}
+
 func determineSecretName(azureKeyVaultSecret *akv.AzureKeyVaultSecret) string {
 	name := azureKeyVaultSecret.Spec.Output.Secret.Name
 	if name == "" {
@@ -261,7 +434,27 @@ func determineSecretType(azureKeyVaultSecret *akv.AzureKeyVaultSecret) corev1.Se
 	return azureKeyVaultSecret.Spec.Output.Secret.Type
 }
 
+// getSecretHash returns the hash used to detect changes to secret values, which
+// is sha256 prefixed with 'sha256:' in FIPS mode and md5 otherwise
+func getSecretHash(values map[string][]byte) string {
+	if akv2k8s.FIPS {
+		return getSHA256Hash(values)
+	}
+	return getMD5Hash(values)
+}
+
 func getMD5Hash(values map[string][]byte) string {
+	hasher := md5.New()
+	hasher.Write(mergeValues(values))
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+func getSHA256Hash(values map[string][]byte) string {
+	hash := sha256.Sum256(mergeValues(values))
+	return "sha256:" + hex.EncodeToString(hash[:])
+}
+
+func mergeValues(values map[string][]byte) []byte {
 	var mergedValues bytes.Buffer
 
 	keys := sortValueKeys(values)
@@ -269,10 +462,7 @@ func getMD5Hash(values map[string][]byte) string {
 	for _, k := range keys {
 		mergedValues.WriteString(k + string(values[k]))
 	}
-
-	hasher := md5.New()
-	hasher.Write([]byte(mergedValues.String()))
-	return hex.EncodeToString(hasher.Sum(nil))
+	return mergedValues.Bytes()
 }
 
 func sortValueKeys(values map[string][]byte) []string {
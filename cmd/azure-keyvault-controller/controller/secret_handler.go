@@ -45,6 +45,9 @@ type AzureSecretHandler struct {
 type AzureCertificateHandler struct {
 	secretSpec   *akv.AzureKeyVaultSecret
 	vaultService vault.Service
+
+	// publicCertificateOnly gets the certificate without its private key, as it is not exportable
+	publicCertificateOnly bool
 }
 
 // AzureKeyHandler handles getting and formatting Azure Key Vault Key from Azure Key Vault to Kubernetes
@@ -102,7 +105,7 @@ func (h *AzureSecretHandler) Handle() (map[string][]byte, error) {
 
 	secret, err := h.vaultService.GetSecret(&h.secretSpec.Spec.Vault)
 	if err != nil {
-		return nil, err
+		return nil, classifyVaultError(err)
 	}
 
 	secret, err = h.transformator.Transform(secret)
@@ -110,6 +113,10 @@ func (h *AzureSecretHandler) Handle() (map[string][]byte, error) {
 		return nil, err
 	}
 
+	if h.secretSpec.Spec.Output.Secret.Layout != "" {
+		return secretLayoutValues(h.secretSpec, secret), nil
+	}
+
 	switch h.secretSpec.Spec.Output.Secret.Type {
 	case corev1.SecretTypeBasicAuth:
 		creds := strings.Split(secret, ":")
@@ -143,12 +150,17 @@ func (h *AzureSecretHandler) Handle() (map[string][]byte, error) {
 func (h *AzureCertificateHandler) Handle() (map[string][]byte, error) {
 	values := make(map[string][]byte)
 	var err error
+	layout := h.secretSpec.Spec.Output.Secret.Layout
+	exportPrivateKey := h.secretSpec.Spec.Output.Secret.Type == corev1.SecretTypeTLS || h.secretSpec.Spec.Output.Secret.Type == corev1.SecretTypeOpaque
+	if layout != "" {
+		exportPrivateKey = layout == akv.AzureKeyVaultOutputLayoutTLS
+	}
 	options := vault.CertificateOptions{
-		ExportPrivateKey:  h.secretSpec.Spec.Output.Secret.Type == corev1.SecretTypeTLS || h.secretSpec.Spec.Output.Secret.Type == corev1.SecretTypeOpaque,
+		ExportPrivateKey:  exportPrivateKey && !h.publicCertificateOnly,
 		EnsureServerFirst: h.secretSpec.Spec.Output.Secret.ChainOrder == "ensureserverfirst",
 	}
 
-	if !options.ExportPrivateKey && h.secretSpec.Spec.Output.Secret.DataKey == "" {
+	if !exportPrivateKey && layout == "" && h.secretSpec.Spec.Output.Secret.DataKey == "" {
 		return nil, fmt.Errorf("no datakey specified for output secret")
 	}
 
@@ -156,7 +168,14 @@ func (h *AzureCertificateHandler) Handle() (map[string][]byte, error) {
 
 	cert, err := h.vaultService.GetCertificate(&h.secretSpec.Spec.Vault, &options)
 	if err != nil {
-		return nil, err
+		return nil, classifyVaultError(err)
+	}
+
+	if layout != "" {
+		return certificateLayoutValues(layout, cert)
+	}
+	if h.publicCertificateOnly && exportPrivateKey {
+		return h.publicCertificateValues(cert)
 	}
 
 	if h.secretSpec.Spec.Output.Secret.Type == corev1.SecretTypeOpaque {
@@ -178,11 +197,24 @@ func (h *AzureCertificateHandler) Handle() (map[string][]byte, error) {
 	return values, nil
 }
 
+// publicCertificateValues returns the public certificate for a Secret meant to have the private key too.
+// The tls.key of kubernetes.io/tls Secrets is required, so it is left empty.
+func (h *AzureCertificateHandler) publicCertificateValues(cert *vault.Certificate) (map[string][]byte, error) {
+	publicKey, err := cert.ExportPublicKeyAsPem()
+	if err != nil {
+		return nil, err
+	}
+	if h.secretSpec.Spec.Output.Secret.Type == corev1.SecretTypeTLS {
+		return map[string][]byte{corev1.TLSCertKey: publicKey, corev1.TLSPrivateKeyKey: {}}, nil
+	}
+	return map[string][]byte{h.secretSpec.Spec.Output.Secret.DataKey: publicKey}, nil
+}
+
 // Handle getting and formating Azure Key Vault Key from Azure Key Vault to Kubernetes
 func (h *AzureKeyHandler) Handle() (map[string][]byte, error) {
 	key, err := h.vaultService.GetKey(&h.secretSpec.Spec.Vault)
 	if err != nil {
-		return nil, err
+		return nil, classifyVaultError(err)
 	}
 
 	values := make(map[string][]byte)
@@ -200,7 +232,7 @@ func (h *AzureMultiValueSecretHandler) Handle() (map[string][]byte, error) {
 
 	secret, err := h.vaultService.GetSecret(&h.secretSpec.Spec.Vault)
 	if err != nil {
-		return nil, err
+		return nil, classifyVaultError(err)
 	}
 
 	var dat map[string]string
@@ -208,11 +240,13 @@ func (h *AzureMultiValueSecretHandler) Handle() (map[string][]byte, error) {
 	switch h.secretSpec.Spec.Vault.Object.ContentType {
 	case akv.AzureKeyVaultObjectContentTypeJSON:
 		if err := json.Unmarshal([]byte(secret), &dat); err != nil {
-			return nil, err
+			// The parser error can quote the secret, so it is left out
+			return nil, fmt.Errorf("secret '%s' is not a valid JSON map of key values", h.secretSpec.Spec.Vault.Object.Name)
 		}
 	case akv.AzureKeyVaultObjectContentTypeYaml:
 		if err := yaml.Unmarshal([]byte(secret), &dat); err != nil {
-			return nil, err
+			// The parser error can quote the secret, so it is left out
+			return nil, fmt.Errorf("secret '%s' is not a valid YAML map of key values", h.secretSpec.Spec.Vault.Object.Name)
 		}
 	default:
 		return nil, fmt.Errorf("content type '%s' not supported", h.secretSpec.Spec.Vault.Object.ContentType)
@@ -222,5 +256,5 @@ func (h *AzureMultiValueSecretHandler) Handle() (map[string][]byte, error) {
 		values[k] = []byte(v)
 	}
 
-	return values, nil
+	return filterKeys(h.secretSpec, values)
 }
@@ -35,6 +35,7 @@ var (
 type fakeVaultService struct {
 	fakeSecretValue string
 	fakeCertValue   string
+	fakeVersion     string
 }
 
 func (f *fakeVaultService) GetSecret(secret *akv.AzureKeyVault) (string, error) {
@@ -53,6 +54,22 @@ func (f *fakeVaultService) GetCertificate(secret *akv.AzureKeyVault, options *va
 	return nil, nil
 }
 
+func (f *fakeVaultService) GetObjectVersion(secret *akv.AzureKeyVault) (*vault.ObjectVersion, error) {
+	return &vault.ObjectVersion{ID: f.fakeVersion}, nil
+}
+
+func (f *fakeVaultService) CreateSecret(secret *akv.AzureKeyVault, value string) error {
+	return nil
+}
+
+func (f *fakeVaultService) Probe(secret *akv.AzureKeyVault) error {
+	return nil
+}
+
+func (f *fakeVaultService) SetTags(secret *akv.AzureKeyVault, tags map[string]string) (*vault.ObjectVersion, error) {
+	return &vault.ObjectVersion{ID: f.fakeVersion}, nil
+}
+
 func secret() *akv.AzureKeyVaultSecret {
 	return &akv.AzureKeyVaultSecret{
 		TypeMeta: metav1.TypeMeta{APIVersion: akv.SchemeGroupVersion.String()},
@@ -92,6 +109,32 @@ secondValue: some second value data`,
 	}
 }
 
+func TestHandleMultiValueSecretWithKeyFilters(t *testing.T) {
+	fakeVault := &fakeVaultService{
+		fakeSecretValue: `{"db_user": "app", "db_password": "secret", "db_admin_password": "admin", "api_key": "key"}`,
+	}
+
+	secret := secret()
+	secret.Spec.Vault.Object.Type = akv.AzureKeyVaultObjectTypeMultiKeyValueSecret
+	secret.Spec.Vault.Object.ContentType = akv.AzureKeyVaultObjectContentTypeJSON
+	secret.Spec.Output.Secret.IncludeKeys = []string{"db_*"}
+	secret.Spec.Output.Secret.ExcludeKeys = []string{"db_admin_password"}
+
+	handler := NewAzureMultiKeySecretHandler(secret, fakeVault)
+	values, err := handler.Handle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := sortValueKeys(values); len(keys) != 2 || keys[0] != "db_password" || keys[1] != "db_user" {
+		t.Errorf("expected keys db_password and db_user, got %v", keys)
+	}
+
+	secret.Spec.Output.Secret.IncludeKeys = []string{"db_["}
+	if _, err := handler.Handle(); err == nil {
+		t.Error("expected invalid key pattern to fail")
+	}
+}
+
 func TestHandleSecretWithNoDataKey(t *testing.T) {
 	fakeVault := &fakeVaultService{
 		fakeSecretValue: "Some very secret data",
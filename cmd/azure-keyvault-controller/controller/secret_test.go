@@ -0,0 +1,43 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/akv2k8s"
+)
+
+func TestGetSecretHash(t *testing.T) {
+	values := map[string][]byte{"a": []byte("first"), "b": []byte("second")}
+
+	if getSecretHash(values) != getMD5Hash(values) {
+		t.Error("expected md5 hash when not in FIPS mode")
+	}
+
+	akv2k8s.EnableFIPS(true)
+	defer akv2k8s.EnableFIPS(false)
+
+	hash := getSecretHash(values)
+	if !strings.HasPrefix(hash, "sha256:") || len(hash) != len("sha256:")+64 {
+		t.Errorf("expected sha256 hash in FIPS mode, got '%s'", hash)
+	}
+	if hash != getSecretHash(map[string][]byte{"b": []byte("second"), "a": []byte("first")}) {
+		t.Error("expected hash to be independent of key order")
+	}
+}
@@ -0,0 +1,30 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+// recordSecretEvent records an Event on the output Secret when SecretEvents is enabled, in addition to
+// the Event recorded on the AzureKeyVaultSecret
+func (c *Controller) recordSecretEvent(secret *corev1.Secret, eventType, reason, msg string) {
+	if !c.options.SecretEvents || secret == nil {
+		return
+	}
+	c.recorder.Event(secret, eventType, reason, msg)
+}
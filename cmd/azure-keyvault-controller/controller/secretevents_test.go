@@ -0,0 +1,70 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+)
+
+func TestSecretEventsOnRotation(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		f := newFixture(t)
+		f.controller.options.SecretEvents = enabled
+		f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+		akvs := azureKeyVaultSecretWithOutput()
+		f.addAzureKeyVaultSecret(akvs)
+		if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+			t.Fatal(err)
+		}
+		f.refresh(akvs)
+		f.drainEvents()
+
+		f.vault.SetSecret(testVaultName, "my-secret", "second-value")
+		if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+			t.Fatal(err)
+		}
+		f.expectEvent(SuccessSynced)
+		if enabled {
+			f.expectEvent(SecretRotated)
+		} else {
+			f.expectNoEvents()
+		}
+	}
+}
+
+func TestSecretEventsOnAdoption(t *testing.T) {
+	f := newFixture(t)
+	f.controller.options.OrphanedSecretPolicy = OrphanedSecretPolicyAdopt
+	f.controller.options.SecretEvents = true
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.UID = "restored-uid"
+	f.addAzureKeyVaultSecret(akvs)
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+	f.drainEvents()
+
+	f.stripOwnerReferences(akvs.Namespace, "my-kubernetes-secret")
+	f.controller.sweepOrphanedSecrets()
+	f.expectEvent(SecretAdopted)
+	f.expectEvent(SecretAdopted)
+	f.expectNoEvents()
+}
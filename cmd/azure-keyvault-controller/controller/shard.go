@@ -0,0 +1,60 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"hash/fnv"
+)
+
+// ShardOptions splits AzureKeyVaultSecrets between multiple active controller replicas,
+// each owning a disjoint subset
+type ShardOptions struct {
+	// Count is the total number of shards. Zero or one disables sharding
+	Count int
+
+	// Ordinal is the shard owned by this replica, from 0 to Count-1
+	Ordinal int
+}
+
+// Owns returns true if the AzureKeyVaultSecret with the given namespace and name belongs to this shard
+func (s ShardOptions) Owns(namespace, name string) bool {
+	if s.Count <= 1 {
+		return true
+	}
+
+	hash := fnv.New64a()
+	hash.Write([]byte(namespace + "/" + name))
+	return jumpHash(hash.Sum64(), s.Count) == s.Ordinal
+}
+
+// jumpHash is the consistent hash by Lamping and Veach, mapping key to one of the buckets so only
+// 1/buckets of all keys move when the number of buckets change. See https://arxiv.org/abs/1406.2294
+func jumpHash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+// isHandled returns true if the AzureKeyVaultSecret with the given namespace and name is handled by
+// this controller, being in a watched namespace and belonging to its shard
+func (c *Controller) isHandled(namespace, name string) bool {
+	return c.options.Namespaces.Includes(namespace) && c.options.Shard.Owns(namespace, name)
+}
@@ -0,0 +1,68 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestShardOwnsDisjointSubsets(t *testing.T) {
+	const count = 4
+	owned := make([]int, count)
+
+	for i := 0; i < 1000; i++ {
+		name := fmt.Sprintf("akvs-%d", i)
+		owners := 0
+		for ordinal := 0; ordinal < count; ordinal++ {
+			if (ShardOptions{Count: count, Ordinal: ordinal}).Owns("default", name) {
+				owners++
+				owned[ordinal]++
+			}
+		}
+		if owners != 1 {
+			t.Fatalf("expected %s to be owned by exactly one shard, got %d", name, owners)
+		}
+	}
+
+	for ordinal, n := range owned {
+		if n < 150 {
+			t.Errorf("expected shard %d to own a fair share of 1000 AzureKeyVaultSecrets, got %d", ordinal, n)
+		}
+	}
+}
+
+func TestShardDisabledOwnsEverything(t *testing.T) {
+	for _, shard := range []ShardOptions{{}, {Count: 1}} {
+		if !shard.Owns("default", "akvs") {
+			t.Errorf("expected %+v to own all AzureKeyVaultSecrets", shard)
+		}
+	}
+}
+
+func TestJumpHashMovesFewKeysWhenGrowing(t *testing.T) {
+	moved := 0
+	for key := uint64(0); key < 1000; key++ {
+		if jumpHash(key*0x9E3779B97F4A7C15, 4) != jumpHash(key*0x9E3779B97F4A7C15, 5) {
+			moved++
+		}
+	}
+	// Ideally 1/5 of the keys move to the new shard
+	if moved > 300 {
+		t.Errorf("expected about 200 of 1000 keys to move going from 4 to 5 shards, got %d", moved)
+	}
+}
@@ -0,0 +1,78 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// drainPollInterval is how often queues are checked for being drained on shutdown
+const drainPollInterval = 100 * time.Millisecond
+
+// trackInFlight wraps a sync handler, counting syncs in progress so they can be awaited on shutdown
+func (c *Controller) trackInFlight(sync func(key string) error) func(key string) error {
+	return func(key string) error {
+		atomic.AddInt32(&c.inFlight, 1)
+		defer atomic.AddInt32(&c.inFlight, -1)
+		return sync(key)
+	}
+}
+
+// queues returns all queues of the controller
+func (c *Controller) queues() []*queueWorker {
+	return []*queueWorker{
+		c.akvsCrdQueue,
+		c.akvsSecretQueue,
+		c.azureKeyVaultQueue,
+		c.caBundleSecretQueue,
+		c.namespaceQueue,
+	}
+}
+
+// drain stops the queues from accepting new items, and waits for queued items and syncs in
+// progress to finish, so Secrets are not left updated without their AzureKeyVaultSecret status.
+// Returns false if not drained within timeout.
+func (c *Controller) drain(timeout time.Duration) bool {
+	for _, q := range c.queues() {
+		q.GetQueue().ShutDown()
+	}
+
+	if atomic.LoadInt32(&c.workersRunning) == 0 {
+		return true
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		remaining := int(atomic.LoadInt32(&c.inFlight))
+		for _, q := range c.queues() {
+			remaining += q.GetQueue().Len()
+		}
+		if remaining == 0 {
+			log.Info("All queues drained")
+			return true
+		}
+
+		if time.Now().After(deadline) {
+			log.Warningf("Timed out after %s waiting for %d queued or in progress syncs to finish", timeout, remaining)
+			return false
+		}
+		time.Sleep(drainPollInterval)
+	}
+}
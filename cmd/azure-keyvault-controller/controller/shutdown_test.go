@@ -0,0 +1,69 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDrainWaitsForInFlightSyncs(t *testing.T) {
+	f := newFixture(t)
+	atomic.StoreInt32(&f.controller.workersRunning, 1)
+
+	release := make(chan struct{})
+	finished := make(chan struct{})
+	sync := f.controller.trackInFlight(func(key string) error {
+		<-release
+		close(finished)
+		return nil
+	})
+
+	started := make(chan struct{})
+	go func() {
+		close(started)
+		sync("default/test-name")
+	}()
+	<-started
+	for atomic.LoadInt32(&f.controller.inFlight) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if f.controller.drain(200 * time.Millisecond) {
+		t.Fatal("expected drain to time out while sync is in progress")
+	}
+
+	close(release)
+	if !f.controller.drain(time.Second) {
+		t.Fatal("expected drain to finish when sync is done")
+	}
+	<-finished
+}
+
+func TestDrainStopsAcceptingItems(t *testing.T) {
+	f := newFixture(t)
+
+	if !f.controller.drain(time.Second) {
+		t.Fatal("expected drain to finish immediately when workers are not running")
+	}
+
+	f.controller.azureKeyVaultQueue.GetQueue().Add("default/test-name")
+	if length := f.controller.azureKeyVaultQueue.GetQueue().Len(); length != 0 {
+		t.Errorf("expected no items to be accepted after drain, got queue length %d", length)
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// reconcileAtStartup syncs every AzureKeyVaultSecret handled by this replica with its Secret once, before
+// the Kubernetes queues are started, so missing and drifted Secrets are repaired right away instead of
+// whenever the informer events are replayed. At most StartupReconcileParallelism are synced at a time.
+// Failed AzureKeyVaultSecrets are retried by the AzureKeyVaultSecret queue. Returns early if stopCh is closed.
+func (c *Controller) reconcileAtStartup(stopCh <-chan struct{}) {
+	parallelism := c.options.StartupReconcileParallelism
+	if parallelism <= 0 {
+		return
+	}
+
+	azureKeyVaultSecrets, err := c.azureKeyVaultSecretLister.List(labels.Everything())
+	if err != nil {
+		log.Errorf("failed to list AzureKeyVaultSecrets for startup reconciliation: %v", err)
+		return
+	}
+
+	var keys []string
+	for _, azureKeyVaultSecret := range azureKeyVaultSecrets {
+		if !c.isHandled(azureKeyVaultSecret.Namespace, azureKeyVaultSecret.Name) || !c.akvsHasSecretOutput(azureKeyVaultSecret) {
+			continue
+		}
+		key, err := cache.MetaNamespaceKeyFunc(azureKeyVaultSecret)
+		if err != nil {
+			log.Errorf("failed to get key of AzureKeyVaultSecret for startup reconciliation: %v", err)
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	start := c.clock.Now()
+	log.Infof("Reconciling %d AzureKeyVaultSecrets with their Secrets, %d at a time", len(keys), parallelism)
+	startupReconcileTotal.Set(float64(len(keys)))
+	startupReconcileDone.Set(0)
+
+	pending := make(chan string)
+	var failed int32
+	var wg sync.WaitGroup
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range pending {
+				if err := c.akvsCrdQueue.sync(key); err != nil {
+					log.WithField("key", key).WithError(err).Warning("failed to reconcile AzureKeyVaultSecret at startup, retrying it from the queue")
+					c.akvsCrdQueue.GetQueue().AddRateLimited(key)
+					atomic.AddInt32(&failed, 1)
+				}
+				startupReconcileDone.Inc()
+			}
+		}()
+	}
+
+	stopped := false
+feed:
+	for _, key := range keys {
+		select {
+		case pending <- key:
+		case <-stopCh:
+			stopped = true
+			break feed
+		}
+	}
+	close(pending)
+	wg.Wait()
+
+	if stopped {
+		log.Info("Stopped startup reconciliation of AzureKeyVaultSecrets")
+		return
+	}
+	log.Infof("Reconciled %d AzureKeyVaultSecrets with their Secrets in %s, %d failed", len(keys), c.clock.Now().Sub(start.Time).Round(time.Millisecond), failed)
+}
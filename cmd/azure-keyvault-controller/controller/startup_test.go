@@ -0,0 +1,77 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReconcileAtStartupCreatesMissingSecrets(t *testing.T) {
+	f := newFixture(t)
+	f.controller.options.StartupReconcileParallelism = 2
+
+	for i := 0; i < 3; i++ {
+		akvs := azureKeyVaultSecretWithOutput()
+		akvs.Name = fmt.Sprintf("akvs-%d", i)
+		akvs.Spec.Vault.Object.Name = akvs.Name
+		akvs.Spec.Output.Secret.Name = fmt.Sprintf("secret-%d", i)
+		f.vault.SetSecret(testVaultName, akvs.Name, fmt.Sprintf("value-%d", i))
+		f.addAzureKeyVaultSecret(akvs)
+	}
+
+	f.controller.reconcileAtStartup(make(chan struct{}))
+
+	for i := 0; i < 3; i++ {
+		secret := f.getSecret("default", fmt.Sprintf("secret-%d", i))
+		if expected := fmt.Sprintf("value-%d", i); string(secret.Data["value"]) != expected {
+			t.Errorf("expected secret value '%s', got '%s'", expected, string(secret.Data["value"]))
+		}
+	}
+	if total, done := testutil.ToFloat64(startupReconcileTotal), testutil.ToFloat64(startupReconcileDone); total != 3 || done != 3 {
+		t.Errorf("expected 3 of 3 AzureKeyVaultSecrets reconciled, got %v of %v", done, total)
+	}
+}
+
+func TestReconcileAtStartupRetriesFailuresFromQueue(t *testing.T) {
+	f := newFixture(t)
+	f.controller.options.StartupReconcileParallelism = 1
+
+	// The object does not exist in Azure Key Vault
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	f.controller.reconcileAtStartup(make(chan struct{}))
+	if requeues := f.controller.akvsCrdQueue.GetQueue().NumRequeues(key(akvs)); requeues != 1 {
+		t.Errorf("expected failed AzureKeyVaultSecret to be retried from the queue, got %d requeues", requeues)
+	}
+}
+
+func TestReconcileAtStartupDisabled(t *testing.T) {
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "my-value")
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	f.controller.reconcileAtStartup(make(chan struct{}))
+	if _, err := f.kubeClient.CoreV1().Secrets(akvs.Namespace).Get("my-kubernetes-secret", metav1.GetOptions{}); err == nil {
+		t.Error("expected no Secret to be created when startup reconciliation is disabled")
+	}
+}
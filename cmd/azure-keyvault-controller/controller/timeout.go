@@ -0,0 +1,111 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// timedOutSyncs keeps track of syncs that have timed out but are still running, since
+// syncs cannot be aborted, so the same key is not synced again until they finish
+type timedOutSyncs struct {
+	mutex sync.Mutex
+	keys  map[string]bool
+}
+
+func newTimedOutSyncs() *timedOutSyncs {
+	return &timedOutSyncs{keys: make(map[string]bool)}
+}
+
+func (t *timedOutSyncs) add(key string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.keys[key] = true
+}
+
+func (t *timedOutSyncs) remove(key string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.keys, key)
+}
+
+func (t *timedOutSyncs) contains(key string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.keys[key]
+}
+
+// withSyncTimeout wraps a sync handler, giving up waiting for it after SyncTimeout so a single
+// unresponsive Azure Key Vault or API server cannot keep a worker busy. A timed out sync returns an
+// error, making the key be retried once the sync still running in the background has finished.
+// If eventObject is set, a TimedOut Event is recorded on the object it returns for the key.
+func (c *Controller) withSyncTimeout(queueName string, eventObject func(key string) runtime.Object, sync func(key string) error) func(key string) error {
+	return func(key string) error {
+		timeout := c.options.SyncTimeout
+		if timeout <= 0 {
+			return sync(key)
+		}
+
+		if c.timedOutSyncs.contains(key) {
+			return fmt.Errorf("earlier sync of '%s' in %s queue timed out and is still running", key, queueName)
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			done <- sync(key)
+		}()
+
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case err := <-done:
+			return err
+		case <-timer.C:
+		}
+
+		c.timedOutSyncs.add(key)
+		go func() {
+			<-done
+			c.timedOutSyncs.remove(key)
+		}()
+
+		msg := fmt.Sprintf(MessageSyncTimedOut, timeout)
+		log.WithFields(log.Fields{"key": key, "queue": queueName}).Warning(msg)
+		if eventObject != nil {
+			if obj := eventObject(key); obj != nil {
+				c.recorder.Event(obj, corev1.EventTypeWarning, TimedOut, msg)
+			}
+		}
+		return fmt.Errorf("sync of '%s' in %s queue timed out after %s", key, queueName, timeout)
+	}
+}
+
+// azureKeyVaultSecretForKey returns the AzureKeyVaultSecret with the key from the cache, or nil if not found
+func (c *Controller) azureKeyVaultSecretForKey(key string) runtime.Object {
+	azureKeyVaultSecret, err := c.getAzureKeyVaultSecret(key)
+	if err != nil {
+		return nil
+	}
+	return azureKeyVaultSecret
+}
@@ -0,0 +1,72 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestSyncTimeout(t *testing.T) {
+	f := newFixture(t)
+	f.controller.options.SyncTimeout = 10 * time.Millisecond
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	release := make(chan struct{})
+	var syncs int32
+	sync := f.controller.withSyncTimeout("Test", f.controller.azureKeyVaultSecretForKey, func(key string) error {
+		atomic.AddInt32(&syncs, 1)
+		<-release
+		return nil
+	})
+
+	if err := sync(key(akvs)); err == nil {
+		t.Fatal("expected error when sync times out")
+	}
+	f.expectEvent(TimedOut)
+
+	if err := sync(key(akvs)); err == nil {
+		t.Fatal("expected error while timed out sync is still running")
+	}
+	if count := atomic.LoadInt32(&syncs); count != 1 {
+		t.Errorf("expected key not to be synced again while timed out sync is running, got %d syncs", count)
+	}
+
+	close(release)
+	for i := 0; i < 100 && f.controller.timedOutSyncs.contains(key(akvs)); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if err := sync(key(akvs)); err != nil {
+		t.Errorf("expected sync to succeed once timed out sync finished, got %v", err)
+	}
+}
+
+func TestSyncTimeoutDisabled(t *testing.T) {
+	f := newFixture(t)
+	sync := f.controller.withSyncTimeout("Test", func(key string) runtime.Object { return nil }, func(key string) error {
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	})
+	if err := sync("default/akvs"); err != nil {
+		t.Errorf("expected no timeout when disabled, got %v", err)
+	}
+}
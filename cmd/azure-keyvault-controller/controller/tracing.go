@@ -0,0 +1,50 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	"go.opencensus.io/trace"
+)
+
+// startSpan starts a span for an operation on the AzureKeyVaultSecret, carrying its key and vault as attributes
+func startSpan(ctx context.Context, name string, azureKeyVaultSecret *akv.AzureKeyVaultSecret) (context.Context, *trace.Span) {
+	ctx, span := trace.StartSpan(ctx, name)
+	span.AddAttributes(
+		trace.StringAttribute("akvs.key", azureKeyVaultSecret.Namespace+"/"+azureKeyVaultSecret.Name),
+		trace.StringAttribute("akvs.vault", azureKeyVaultSecret.Spec.Vault.Name),
+		trace.StringAttribute("akvs.object", azureKeyVaultSecret.Spec.Vault.Object.Name),
+	)
+	return ctx, span
+}
+
+// endSpan records err and the Azure request ids it carries, if any, on the span and ends it
+func endSpan(span *trace.Span, err error) {
+	if err != nil {
+		if requestID, clientRequestID := vault.RequestIDs(err); requestID != "" || clientRequestID != "" {
+			span.AddAttributes(
+				trace.StringAttribute("azure.request_id", requestID),
+				trace.StringAttribute("azure.client_request_id", clientRequestID),
+			)
+		}
+		span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
+	}
+	span.End()
+}
@@ -0,0 +1,89 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"sync"
+	"testing"
+
+	"go.opencensus.io/trace"
+)
+
+type spanRecorder struct {
+	mutex sync.Mutex
+	spans []*trace.SpanData
+}
+
+func (r *spanRecorder) ExportSpan(span *trace.SpanData) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.spans = append(r.spans, span)
+}
+
+func (r *spanRecorder) span(name string) *trace.SpanData {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, span := range r.spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	return nil
+}
+
+func TestSyncAzureKeyVaultTracing(t *testing.T) {
+	recorder := &spanRecorder{}
+	trace.RegisterExporter(recorder)
+	defer trace.UnregisterExporter(recorder)
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
+	defer trace.ApplyConfig(trace.Config{DefaultSampler: trace.ProbabilitySampler(1e-4)})
+
+	f := newFixture(t)
+	f.vault.SetSecret(testVaultName, "my-secret", "first-value")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+
+	f.vault.SetSecret(testVaultName, "my-secret", "second-value")
+	if err := f.controller.syncAzureKeyVault(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+
+	root := recorder.span("syncAzureKeyVault")
+	if root == nil {
+		t.Fatal("expected span for syncAzureKeyVault")
+	}
+	if root.Attributes["akvs.vault"] != testVaultName {
+		t.Errorf("expected vault attribute '%s', got '%v'", testVaultName, root.Attributes["akvs.vault"])
+	}
+
+	for _, name := range []string{"GetObjectVersion", "GetSecretValue", "UpdateSecret", "UpdateStatus"} {
+		span := recorder.span(name)
+		if span == nil {
+			t.Errorf("expected span for %s", name)
+			continue
+		}
+		if span.ParentSpanID != root.SpanID {
+			t.Errorf("expected span %s to be a child of syncAzureKeyVault", name)
+		}
+	}
+}
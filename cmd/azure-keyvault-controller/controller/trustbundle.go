@@ -0,0 +1,553 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	goerrors "errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/tools/cache"
+	"kmodules.xyz/client-go/tools/queue"
+)
+
+const (
+	// TrustBundleLabel is added to ConfigMaps written by trust bundle outputs
+	TrustBundleLabel = "keyvault.azure.spv.no/trust-bundle"
+
+	// TrustBundleOwnerAnnotation is the namespace/name of the AzureKeyVaultSecret writing a trust bundle ConfigMap,
+	// as ConfigMaps in other namespaces can not have it as owner
+	TrustBundleOwnerAnnotation = "keyvault.azure.spv.no/trust-bundle-owner"
+
+	// defaultTrustBundleKey is the ConfigMap key trust bundles are written to if not set
+	defaultTrustBundleKey = "ca.crt"
+)
+
+// initTrustBundle writes trust bundle ConfigMaps to namespaces when they are added
+func (c *Controller) initTrustBundle() {
+	c.kubeInformerFactory.Core().V1().Namespaces().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			c.enqueueTrustBundleConfigMaps()
+		},
+	})
+}
+
+// hasTrustBundleOutput returns true if the AzureKeyVaultSecret writes its certificates to a trust bundle
+func hasTrustBundleOutput(azureKeyVaultSecret *akv.AzureKeyVaultSecret) bool {
+	trustBundle := azureKeyVaultSecret.Spec.Output.TrustBundle
+	return trustBundle != nil && (trustBundle.ConfigMap != "" || trustBundle.ClusterTrustBundle != "")
+}
+
+// syncTrustBundle writes the certificates of the Secret of a AzureKeyVaultSecret, without any private
+// keys, to a ConfigMap in every namespace and/or a ClusterTrustBundle, as set in spec.output.trustBundle,
+// and deletes the trust bundles written earlier no longer in spec.output.trustBundle
+func (c *Controller) syncTrustBundle(azureKeyVaultSecret *akv.AzureKeyVaultSecret, secret *corev1.Secret) error {
+	var trustBundle *akv.AzureKeyVaultOutputTrustBundle
+	if hasTrustBundleOutput(azureKeyVaultSecret) && c.allowsTrustBundle(azureKeyVaultSecret) {
+		trustBundle = azureKeyVaultSecret.Spec.Output.TrustBundle
+	}
+
+	var lastErr error
+	if trustBundle != nil {
+		lastErr = c.writeTrustBundle(azureKeyVaultSecret, secret)
+	}
+
+	if previous := azureKeyVaultSecret.Status.TrustBundle; previous != nil {
+		if previous.ConfigMap != "" && (trustBundle == nil || trustBundle.ConfigMap != previous.ConfigMap) {
+			if err := c.deleteTrustBundleConfigMaps(azureKeyVaultSecret, previous.ConfigMap); err != nil {
+				return err
+			}
+		}
+		if previous.ClusterTrustBundle != "" && (trustBundle == nil || trustBundle.ClusterTrustBundle != previous.ClusterTrustBundle) {
+			if err := c.deleteClusterTrustBundle(azureKeyVaultSecret, previous.ClusterTrustBundle); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := c.updateTrustBundleStatus(azureKeyVaultSecret, trustBundle); err != nil {
+		return err
+	}
+	return lastErr
+}
+
+// allowsTrustBundle returns true if trust bundles are enabled in the controller and allowed for the
+// namespace of the AzureKeyVaultSecret by a AzureKeyVaultPolicy, as they are written to every namespace
+func (c *Controller) allowsTrustBundle(azureKeyVaultSecret *akv.AzureKeyVaultSecret) bool {
+	if !c.options.TrustBundles {
+		c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, ErrTrustBundle, MessageTrustBundlesDisabled)
+		return false
+	}
+
+	if c.azureKeyVaultPolicyLister == nil {
+		c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, ErrTrustBundle, fmt.Sprintf(MessageTrustBundleDenied, "AzureKeyVaultPolicies are not enabled in the controller"))
+		return false
+	}
+
+	policies, err := c.azureKeyVaultPolicyLister.List(labels.Everything())
+	if err == nil {
+		var namespace *corev1.Namespace
+		if namespace, err = c.namespaceLister.Get(azureKeyVaultSecret.Namespace); err == nil {
+			err = akv.CheckTrustBundlePolicies(policies, namespace.Name, namespace.Labels)
+		}
+	}
+	if err != nil {
+		c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, ErrTrustBundle, fmt.Sprintf(MessageTrustBundleDenied, err.Error()))
+		return false
+	}
+	return true
+}
+
+// writeTrustBundle writes the certificates of the Secret to the trust bundles in spec.output.trustBundle
+func (c *Controller) writeTrustBundle(azureKeyVaultSecret *akv.AzureKeyVaultSecret, secret *corev1.Secret) error {
+	data := secret.Data
+	if isBundle(azureKeyVaultSecret) {
+		data = getBundleData(secret, azureKeyVaultSecret.Name)
+	}
+	certificates, err := extractCertificates(data)
+	if err != nil {
+		return fmt.Errorf("failed to get certificates for trust bundle of AzureKeyVaultSecret '%s'/'%s', error: %w", azureKeyVaultSecret.Namespace, azureKeyVaultSecret.Name, err)
+	}
+
+	trustBundle := azureKeyVaultSecret.Spec.Output.TrustBundle
+	if trustBundle.ConfigMap != "" {
+		if err = c.syncTrustBundleConfigMaps(azureKeyVaultSecret, string(certificates)); err != nil {
+			return err
+		}
+	}
+	if trustBundle.ClusterTrustBundle != "" {
+		if err = c.syncClusterTrustBundle(azureKeyVaultSecret, string(certificates)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateTrustBundleStatus sets the trust bundle written in the status of the AzureKeyVaultSecret
+func (c *Controller) updateTrustBundleStatus(azureKeyVaultSecret *akv.AzureKeyVaultSecret, trustBundle *akv.AzureKeyVaultOutputTrustBundle) error {
+	if equality.Semantic.DeepEqual(trustBundle, azureKeyVaultSecret.Status.TrustBundle) {
+		return nil
+	}
+
+	// Getting the latest AzureKeyVaultSecret, as status may have been updated earlier in the same sync
+	latest, err := c.akvsClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(azureKeyVaultSecret.Namespace).Get(azureKeyVaultSecret.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	return c.mutateAzureKeyVaultSecretStatus(latest, func(status *akv.AzureKeyVaultSecretStatus) {
+		status.TrustBundle = trustBundle.DeepCopy()
+	})
+}
+
+// syncTrustBundleConfigMaps writes the trust bundle ConfigMap to every namespace handled by the controller
+func (c *Controller) syncTrustBundleConfigMaps(azureKeyVaultSecret *akv.AzureKeyVaultSecret, certificates string) error {
+	trustBundle := azureKeyVaultSecret.Spec.Output.TrustBundle
+	owner := azureKeyVaultSecret.Namespace + "/" + azureKeyVaultSecret.Name
+	key := trustBundle.Key
+	if key == "" {
+		key = defaultTrustBundleKey
+	}
+
+	namespaces, err := c.namespaceLister.List(labels.Everything())
+	if err != nil {
+		return err
+	}
+
+	var changed []string
+	var lastErr error
+	for _, ns := range namespaces {
+		if !c.options.Namespaces.Includes(ns.Name) || ns.Status.Phase == corev1.NamespaceTerminating {
+			continue
+		}
+
+		configMap, err := c.configMapLister.ConfigMaps(ns.Name).Get(trustBundle.ConfigMap)
+		if err != nil && !errors.IsNotFound(err) {
+			lastErr = err
+			continue
+		}
+		if configMap != nil && configMap.Annotations[TrustBundleOwnerAnnotation] != owner {
+			msg := fmt.Sprintf(MessageResourceExists, ns.Name+"/"+trustBundle.ConfigMap)
+			c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, ErrResourceExists, msg)
+			lastErr = newOutputConflictError(msg)
+			continue
+		}
+		if configMap != nil && configMap.Data[key] == certificates && len(configMap.Data) == 1 {
+			continue
+		}
+
+		changed = append(changed, ns.Name)
+		if c.options.DryRun {
+			continue
+		}
+
+		newConfigMap := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        trustBundle.ConfigMap,
+				Namespace:   ns.Name,
+				Labels:      map[string]string{TrustBundleLabel: "true"},
+				Annotations: map[string]string{TrustBundleOwnerAnnotation: owner},
+			},
+			Data: map[string]string{key: certificates},
+		}
+		if configMap == nil {
+			_, err = c.kubeclientset.CoreV1().ConfigMaps(ns.Name).Create(newConfigMap)
+		} else {
+			newConfigMap.ResourceVersion = configMap.ResourceVersion
+			_, err = c.kubeclientset.CoreV1().ConfigMaps(ns.Name).Update(newConfigMap)
+		}
+		if err != nil {
+			log.Errorf("failed to write trust bundle ConfigMap %s in namespace %s, error: %+v", trustBundle.ConfigMap, ns.Name, err)
+			lastErr = err
+		}
+	}
+
+	if len(changed) > 0 {
+		if c.options.DryRun {
+			c.recordDryRun(azureKeyVaultSecret, fmt.Sprintf(MessageDryRunTrustBundleConfigMap, trustBundle.ConfigMap, strings.Join(changed, ", ")))
+		} else {
+			newLogger(azureKeyVaultSecret).Infof("Wrote trust bundle ConfigMap %s in namespaces %s", trustBundle.ConfigMap, strings.Join(changed, ", "))
+		}
+	}
+	return lastErr
+}
+
+// syncClusterTrustBundle writes the trust bundle to a ClusterTrustBundle
+func (c *Controller) syncClusterTrustBundle(azureKeyVaultSecret *akv.AzureKeyVaultSecret, certificates string) error {
+	trustBundle := azureKeyVaultSecret.Spec.Output.TrustBundle
+	owner := azureKeyVaultSecret.Namespace + "/" + azureKeyVaultSecret.Name
+
+	current, err := c.clusterTrustBundles.Get(trustBundle.ClusterTrustBundle)
+	if goerrors.Is(err, errClusterTrustBundlesNotServed) {
+		c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, ErrTrustBundle, fmt.Sprintf(MessageClusterTrustBundlesNotServed, trustBundle.ClusterTrustBundle))
+		return nil
+	}
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	if current != nil && current.Metadata.Annotations[TrustBundleOwnerAnnotation] != owner {
+		msg := fmt.Sprintf(MessageResourceExists, trustBundle.ClusterTrustBundle)
+		c.recorder.Event(azureKeyVaultSecret, corev1.EventTypeWarning, ErrResourceExists, msg)
+		return newOutputConflictError(msg)
+	}
+	if current != nil && current.Spec.TrustBundle == certificates && current.Spec.SignerName == trustBundle.SignerName {
+		return nil
+	}
+
+	if c.options.DryRun {
+		c.recordDryRun(azureKeyVaultSecret, fmt.Sprintf(MessageDryRunClusterTrustBundle, trustBundle.ClusterTrustBundle))
+		return nil
+	}
+
+	bundle := &clusterTrustBundle{
+		Kind: "ClusterTrustBundle",
+		Metadata: metav1.ObjectMeta{
+			Name:        trustBundle.ClusterTrustBundle,
+			Labels:      map[string]string{TrustBundleLabel: "true"},
+			Annotations: map[string]string{TrustBundleOwnerAnnotation: owner},
+		},
+		Spec: clusterTrustBundleSpec{
+			SignerName:  trustBundle.SignerName,
+			TrustBundle: certificates,
+		},
+	}
+	if current == nil {
+		err = c.clusterTrustBundles.Create(bundle)
+	} else {
+		bundle.Metadata.ResourceVersion = current.Metadata.ResourceVersion
+		err = c.clusterTrustBundles.Update(bundle)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write ClusterTrustBundle '%s', error: %w", trustBundle.ClusterTrustBundle, err)
+	}
+	newLogger(azureKeyVaultSecret).Infof("Wrote trust bundle ClusterTrustBundle %s", trustBundle.ClusterTrustBundle)
+	return nil
+}
+
+// deleteTrustBundleConfigMaps deletes the trust bundle ConfigMaps with the name written by the AzureKeyVaultSecret
+func (c *Controller) deleteTrustBundleConfigMaps(azureKeyVaultSecret *akv.AzureKeyVaultSecret, name string) error {
+	owner := azureKeyVaultSecret.Namespace + "/" + azureKeyVaultSecret.Name
+	configMaps, err := c.configMapLister.List(labels.SelectorFromSet(labels.Set{TrustBundleLabel: "true"}))
+	if err != nil {
+		return err
+	}
+
+	var deleted []string
+	var lastErr error
+	for _, configMap := range configMaps {
+		if configMap.Name != name || configMap.Annotations[TrustBundleOwnerAnnotation] != owner {
+			continue
+		}
+
+		deleted = append(deleted, configMap.Namespace)
+		if c.options.DryRun {
+			continue
+		}
+		err = c.kubeclientset.CoreV1().ConfigMaps(configMap.Namespace).Delete(name, &metav1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			log.Errorf("failed to delete trust bundle ConfigMap %s in namespace %s, error: %+v", name, configMap.Namespace, err)
+			lastErr = err
+		}
+	}
+
+	if len(deleted) > 0 {
+		if c.options.DryRun {
+			c.recordDryRun(azureKeyVaultSecret, fmt.Sprintf(MessageDryRunDeleteTrustBundleConfigMap, name, strings.Join(deleted, ", ")))
+		} else {
+			newLogger(azureKeyVaultSecret).Infof("Deleted trust bundle ConfigMap %s in namespaces %s", name, strings.Join(deleted, ", "))
+		}
+	}
+	return lastErr
+}
+
+// deleteClusterTrustBundle deletes the ClusterTrustBundle, unless not written by the AzureKeyVaultSecret
+func (c *Controller) deleteClusterTrustBundle(azureKeyVaultSecret *akv.AzureKeyVaultSecret, name string) error {
+	current, err := c.clusterTrustBundles.Get(name)
+	if errors.IsNotFound(err) || goerrors.Is(err, errClusterTrustBundlesNotServed) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if current.Metadata.Annotations[TrustBundleOwnerAnnotation] != azureKeyVaultSecret.Namespace+"/"+azureKeyVaultSecret.Name {
+		return nil
+	}
+
+	if c.options.DryRun {
+		c.recordDryRun(azureKeyVaultSecret, fmt.Sprintf(MessageDryRunDeleteClusterTrustBundle, name))
+		return nil
+	}
+	if err = c.clusterTrustBundles.Delete(name); err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete ClusterTrustBundle '%s', error: %w", name, err)
+	}
+	newLogger(azureKeyVaultSecret).Infof("Deleted trust bundle ClusterTrustBundle %s", name)
+	return nil
+}
+
+// deleteTrustBundles deletes the trust bundles written by the AzureKeyVaultSecret, both those in
+// spec.output.trustBundle and those last written according to its status
+func (c *Controller) deleteTrustBundles(azureKeyVaultSecret *akv.AzureKeyVaultSecret) error {
+	for _, trustBundle := range []*akv.AzureKeyVaultOutputTrustBundle{azureKeyVaultSecret.Spec.Output.TrustBundle, azureKeyVaultSecret.Status.TrustBundle} {
+		if trustBundle == nil {
+			continue
+		}
+		if trustBundle.ConfigMap != "" {
+			if err := c.deleteTrustBundleConfigMaps(azureKeyVaultSecret, trustBundle.ConfigMap); err != nil {
+				return err
+			}
+		}
+		if trustBundle.ClusterTrustBundle != "" {
+			if err := c.deleteClusterTrustBundle(azureKeyVaultSecret, trustBundle.ClusterTrustBundle); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// enqueueTrustBundleConfigMaps adds AzureKeyVaultSecrets with trust bundle ConfigMaps to the queue,
+// so the ConfigMap is written to new namespaces
+func (c *Controller) enqueueTrustBundleConfigMaps() {
+	if !c.options.TrustBundles {
+		return
+	}
+
+	azureKeyVaultSecrets, err := c.azureKeyVaultSecretLister.List(labels.Everything())
+	if err != nil {
+		log.Errorf("failed to list AzureKeyVaultSecrets with trust bundles: %v", err)
+		return
+	}
+
+	for _, azureKeyVaultSecret := range azureKeyVaultSecrets {
+		trustBundle := azureKeyVaultSecret.Spec.Output.TrustBundle
+		if trustBundle != nil && trustBundle.ConfigMap != "" && c.akvsHasSecretOutput(azureKeyVaultSecret) && c.isHandled(azureKeyVaultSecret.Namespace, azureKeyVaultSecret.Name) {
+			queue.Enqueue(c.akvsCrdQueue.GetQueue(), azureKeyVaultSecret)
+		}
+	}
+}
+
+// extractCertificates returns the PEM encoded certificates found in the values, leaving out private keys
+func extractCertificates(values map[string][]byte) ([]byte, error) {
+	var certificates bytes.Buffer
+	seen := map[string]bool{}
+	for _, key := range sortValueKeys(values) {
+		rest := values[key]
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" || seen[string(block.Bytes)] {
+				continue
+			}
+			seen[string(block.Bytes)] = true
+			if err := pem.Encode(&certificates, &pem.Block{Type: block.Type, Bytes: block.Bytes}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if certificates.Len() == 0 {
+		return nil, fmt.Errorf("no pem encoded certificates found")
+	}
+	return certificates.Bytes(), nil
+}
+
+// clusterTrustBundle is a certificates.k8s.io ClusterTrustBundle, which has no typed client in this version of client-go
+type clusterTrustBundle struct {
+	APIVersion string                 `json:"apiVersion"`
+	Kind       string                 `json:"kind"`
+	Metadata   metav1.ObjectMeta      `json:"metadata"`
+	Spec       clusterTrustBundleSpec `json:"spec"`
+}
+
+type clusterTrustBundleSpec struct {
+	SignerName  string `json:"signerName,omitempty"`
+	TrustBundle string `json:"trustBundle"`
+}
+
+// errClusterTrustBundlesNotServed is returned by a clusterTrustBundleClient when the cluster does not serve ClusterTrustBundles
+var errClusterTrustBundlesNotServed = goerrors.New("ClusterTrustBundles are not served by the cluster")
+
+// clusterTrustBundleClient reads and writes ClusterTrustBundles
+type clusterTrustBundleClient interface {
+	Get(name string) (*clusterTrustBundle, error)
+	Create(bundle *clusterTrustBundle) error
+	Update(bundle *clusterTrustBundle) error
+	Delete(name string) error
+}
+
+// clusterTrustBundleVersions are the versions of ClusterTrustBundles supported, in order of preference
+var clusterTrustBundleVersions = []string{"certificates.k8s.io/v1beta1", "certificates.k8s.io/v1alpha1"}
+
+// restClusterTrustBundleClient is a clusterTrustBundleClient using the REST API of Kubernetes, with the
+// version of ClusterTrustBundles found through discovery
+type restClusterTrustBundleClient struct {
+	discovery discovery.DiscoveryInterface
+
+	mu         sync.Mutex
+	apiVersion string
+}
+
+// served returns the version of ClusterTrustBundles served by the cluster. Until found discovery is done
+// on every call, so ClusterTrustBundles enabled in the cluster later are picked up.
+func (r *restClusterTrustBundleClient) served() (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.apiVersion != "" {
+		return r.apiVersion, nil
+	}
+
+	groups, err := r.discovery.ServerGroups()
+	if err != nil {
+		return "", err
+	}
+	servedVersions := map[string]bool{}
+	for _, group := range groups.Groups {
+		for _, version := range group.Versions {
+			servedVersions[version.GroupVersion] = true
+		}
+	}
+
+	for _, version := range clusterTrustBundleVersions {
+		if !servedVersions[version] {
+			continue
+		}
+		resources, err := r.discovery.ServerResourcesForGroupVersion(version)
+		if err != nil {
+			return "", err
+		}
+		for _, resource := range resources.APIResources {
+			if resource.Name == "clustertrustbundles" {
+				r.apiVersion = version
+				return version, nil
+			}
+		}
+	}
+	return "", errClusterTrustBundlesNotServed
+}
+
+// path returns the path of ClusterTrustBundles, or of the named ClusterTrustBundle, in the served version
+func (r *restClusterTrustBundleClient) path(name ...string) (string, string, error) {
+	version, err := r.served()
+	if err != nil {
+		return "", "", err
+	}
+	return version, "/apis/" + version + "/" + strings.Join(append([]string{"clustertrustbundles"}, name...), "/"), nil
+}
+
+func (r *restClusterTrustBundleClient) Get(name string) (*clusterTrustBundle, error) {
+	_, path, err := r.path(name)
+	if err != nil {
+		return nil, err
+	}
+	body, err := r.discovery.RESTClient().Get().AbsPath(path).Do().Raw()
+	if err != nil {
+		return nil, err
+	}
+	bundle := &clusterTrustBundle{}
+	if err = json.Unmarshal(body, bundle); err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+func (r *restClusterTrustBundleClient) Create(bundle *clusterTrustBundle) error {
+	version, path, err := r.path()
+	if err != nil {
+		return err
+	}
+	bundle.APIVersion = version
+	body, err := json.Marshal(bundle)
+	if err != nil {
+		return err
+	}
+	return r.discovery.RESTClient().Post().AbsPath(path).SetHeader("Content-Type", "application/json").Body(body).Do().Error()
+}
+
+func (r *restClusterTrustBundleClient) Update(bundle *clusterTrustBundle) error {
+	version, path, err := r.path(bundle.Metadata.Name)
+	if err != nil {
+		return err
+	}
+	bundle.APIVersion = version
+	body, err := json.Marshal(bundle)
+	if err != nil {
+		return err
+	}
+	return r.discovery.RESTClient().Put().AbsPath(path).SetHeader("Content-Type", "application/json").Body(body).Do().Error()
+}
+
+func (r *restClusterTrustBundleClient) Delete(name string) error {
+	_, path, err := r.path(name)
+	if err != nil {
+		return err
+	}
+	return r.discovery.RESTClient().Delete().AbsPath(path).Do().Error()
+}
@@ -0,0 +1,347 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	goerrors "errors"
+	"fmt"
+	"testing"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+type fakeClusterTrustBundles struct {
+	bundles map[string]*clusterTrustBundle
+}
+
+func (f *fakeClusterTrustBundles) Get(name string) (*clusterTrustBundle, error) {
+	if bundle, ok := f.bundles[name]; ok {
+		return bundle, nil
+	}
+	return nil, errors.NewNotFound(schema.GroupResource{Group: "certificates.k8s.io", Resource: "clustertrustbundles"}, name)
+}
+
+func (f *fakeClusterTrustBundles) Create(bundle *clusterTrustBundle) error {
+	f.bundles[bundle.Metadata.Name] = bundle
+	return nil
+}
+
+func (f *fakeClusterTrustBundles) Update(bundle *clusterTrustBundle) error {
+	f.bundles[bundle.Metadata.Name] = bundle
+	return nil
+}
+
+func (f *fakeClusterTrustBundles) Delete(name string) error {
+	delete(f.bundles, name)
+	return nil
+}
+
+func (f *fixture) addNamespace(name string) {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if err := f.kubeInformerFactory.Core().V1().Namespaces().Informer().GetIndexer().Add(ns); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+// allowTrustBundles enables trust bundles in the controller and allows them for the default namespace
+func (f *fixture) allowTrustBundles() {
+	f.controller.options.TrustBundles = true
+	f.addNamespace(metav1.NamespaceDefault)
+	f.addVaultPolicy("trust-bundles", akv.AzureKeyVaultPolicySpec{Namespaces: []string{metav1.NamespaceDefault}, TrustBundles: true})
+}
+
+// refreshConfigMaps updates the ConfigMap informer cache with the ConfigMaps in the fake clientset
+func (f *fixture) refreshConfigMaps() {
+	configMaps, err := f.kubeClient.CoreV1().ConfigMaps(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	indexer := f.kubeInformerFactory.Core().V1().ConfigMaps().Informer().GetIndexer()
+	for _, obj := range indexer.List() {
+		if err = indexer.Delete(obj); err != nil {
+			f.t.Fatal(err)
+		}
+	}
+	for i := range configMaps.Items {
+		if err = indexer.Add(&configMaps.Items[i]); err != nil {
+			f.t.Fatal(err)
+		}
+	}
+}
+
+func (f *fixture) getConfigMap(namespace, name string) *corev1.ConfigMap {
+	configMap, err := f.kubeClient.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return configMap
+}
+
+func TestExtractCertificates(t *testing.T) {
+	certificates, err := extractCertificates(map[string][]byte{
+		"tls.key": []byte(pemCert),
+		"ca.crt":  []byte(pemCertPubOnly),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(certificates) != pemCertPubOnly {
+		t.Errorf("expected private key to be left out and duplicate certificates removed, got %s", certificates)
+	}
+
+	if _, err = extractCertificates(map[string][]byte{"value": []byte("not a certificate")}); err == nil {
+		t.Error("expected error without certificates")
+	}
+}
+
+func TestSyncTrustBundleConfigMaps(t *testing.T) {
+	f := newFixture(t)
+	f.allowTrustBundles()
+	f.vault.SetSecret(testVaultName, "my-secret", pemCert)
+	f.addNamespace("default")
+	f.addNamespace("team-a")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Spec.Output.TrustBundle = &akv.AzureKeyVaultOutputTrustBundle{ConfigMap: "my-ca"}
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ns := range []string{"default", "team-a"} {
+		configMap := f.getConfigMap(ns, "my-ca")
+		if configMap.Data[defaultTrustBundleKey] != pemCertPubOnly || len(configMap.Data) != 1 {
+			t.Errorf("expected trust bundle with only the certificate in namespace %s, got %v", ns, configMap.Data)
+		}
+		if configMap.Annotations[TrustBundleOwnerAnnotation] != "default/"+akvs.Name {
+			t.Errorf("expected trust bundle owner annotation in namespace %s, got %v", ns, configMap.Annotations)
+		}
+	}
+}
+
+func TestSyncTrustBundleConfigMapNotOwned(t *testing.T) {
+	f := newFixture(t)
+	f.allowTrustBundles()
+	f.vault.SetSecret(testVaultName, "my-secret", pemCert)
+	f.addNamespace("default")
+
+	existing := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "my-ca", Namespace: "default"}, Data: map[string]string{"ca.crt": "other"}}
+	if err := f.kubeInformerFactory.Core().V1().ConfigMaps().Informer().GetIndexer().Add(existing); err != nil {
+		t.Fatal(err)
+	}
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Spec.Output.TrustBundle = &akv.AzureKeyVaultOutputTrustBundle{ConfigMap: "my-ca"}
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err == nil {
+		t.Fatal("expected error for ConfigMap not managed by AzureKeyVaultSecret")
+	}
+	f.expectEvent(ErrResourceExists)
+}
+
+func TestSyncClusterTrustBundle(t *testing.T) {
+	f := newFixture(t)
+	f.allowTrustBundles()
+	bundles := &fakeClusterTrustBundles{bundles: map[string]*clusterTrustBundle{}}
+	f.controller.clusterTrustBundles = bundles
+	f.vault.SetSecret(testVaultName, "my-secret", pemCert)
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Spec.Output.TrustBundle = &akv.AzureKeyVaultOutputTrustBundle{ClusterTrustBundle: "example.com:my-ca:1", SignerName: "example.com/my-ca"}
+	f.addAzureKeyVaultSecret(akvs)
+
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := bundles.bundles["example.com:my-ca:1"]
+	if bundle == nil || bundle.Spec.TrustBundle != pemCertPubOnly || bundle.Spec.SignerName != "example.com/my-ca" {
+		t.Fatalf("expected ClusterTrustBundle with the certificate, got %+v", bundle)
+	}
+}
+
+func TestSyncTrustBundleNotAllowed(t *testing.T) {
+	tests := []struct {
+		name     string
+		enabled  bool
+		policies []akv.AzureKeyVaultPolicySpec
+	}{
+		{name: "disabled in controller", policies: []akv.AzureKeyVaultPolicySpec{{TrustBundles: true}}},
+		{name: "without policy", enabled: true},
+		{name: "not allowed by policy", enabled: true, policies: []akv.AzureKeyVaultPolicySpec{{}}},
+		{name: "other namespace allowed by policy", enabled: true, policies: []akv.AzureKeyVaultPolicySpec{{}, {Namespaces: []string{"other"}, TrustBundles: true}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newFixture(t)
+			f.controller.options.TrustBundles = test.enabled
+			for i, policy := range test.policies {
+				f.addVaultPolicy(fmt.Sprintf("policy-%d", i), policy)
+			}
+			f.vault.SetSecret(testVaultName, "my-secret", pemCert)
+			f.addNamespace("default")
+
+			akvs := azureKeyVaultSecretWithOutput()
+			akvs.Spec.Output.TrustBundle = &akv.AzureKeyVaultOutputTrustBundle{ConfigMap: "my-ca"}
+			f.addAzureKeyVaultSecret(akvs)
+
+			if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+				t.Fatal(err)
+			}
+			f.expectEvent(ErrTrustBundle)
+			if _, err := f.kubeClient.CoreV1().ConfigMaps("default").Get("my-ca", metav1.GetOptions{}); !errors.IsNotFound(err) {
+				t.Errorf("expected no trust bundle ConfigMap, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSyncTrustBundleDeletesRemovedOutputs(t *testing.T) {
+	f := newFixture(t)
+	f.allowTrustBundles()
+	bundles := &fakeClusterTrustBundles{bundles: map[string]*clusterTrustBundle{}}
+	f.controller.clusterTrustBundles = bundles
+	f.vault.SetSecret(testVaultName, "my-secret", pemCert)
+	f.addNamespace("team-a")
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Spec.Output.TrustBundle = &akv.AzureKeyVaultOutputTrustBundle{ConfigMap: "my-ca", ClusterTrustBundle: "my-ca"}
+	f.addAzureKeyVaultSecret(akvs)
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+	f.refreshConfigMaps()
+
+	latest := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name)
+	if !hasCleanupFinalizer(latest) || latest.Status.TrustBundle == nil {
+		t.Fatalf("expected cleanup finalizer and trust bundle in status, got %v and %+v", latest.Finalizers, latest.Status.TrustBundle)
+	}
+
+	latest.Spec.Output.TrustBundle = &akv.AzureKeyVaultOutputTrustBundle{ConfigMap: "new-ca"}
+	if _, err := f.akvsClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(akvs.Namespace).Update(latest); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ns := range []string{"default", "team-a"} {
+		if _, err := f.kubeClient.CoreV1().ConfigMaps(ns).Get("my-ca", metav1.GetOptions{}); !errors.IsNotFound(err) {
+			t.Errorf("expected removed trust bundle ConfigMap to be deleted in namespace %s, got %v", ns, err)
+		}
+		f.getConfigMap(ns, "new-ca")
+	}
+	if _, ok := bundles.bundles["my-ca"]; ok {
+		t.Error("expected removed ClusterTrustBundle to be deleted")
+	}
+}
+
+func TestSyncTrustBundleDeletedWithAzureKeyVaultSecret(t *testing.T) {
+	f := newFixture(t)
+	f.allowTrustBundles()
+	f.vault.SetSecret(testVaultName, "my-secret", pemCert)
+
+	akvs := azureKeyVaultSecretWithOutput()
+	akvs.Spec.Output.TrustBundle = &akv.AzureKeyVaultOutputTrustBundle{ConfigMap: "my-ca"}
+	f.addAzureKeyVaultSecret(akvs)
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+	f.refreshConfigMaps()
+
+	deleted := f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name)
+	now := metav1.Now()
+	deleted.DeletionTimestamp = &now
+	if _, err := f.akvsClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(akvs.Namespace).Update(deleted); err != nil {
+		t.Fatal(err)
+	}
+	f.refresh(akvs)
+	if err := f.controller.syncAzureKeyVaultSecret(key(akvs)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.kubeClient.CoreV1().ConfigMaps("default").Get("my-ca", metav1.GetOptions{}); !errors.IsNotFound(err) {
+		t.Errorf("expected trust bundle ConfigMap to be deleted with AzureKeyVaultSecret, got %v", err)
+	}
+	if hasCleanupFinalizer(f.getAzureKeyVaultSecret(akvs.Namespace, akvs.Name)) {
+		t.Error("expected cleanup finalizer to be removed")
+	}
+}
+
+func TestClusterTrustBundleVersionFromDiscovery(t *testing.T) {
+	tests := []struct {
+		name      string
+		resources []*metav1.APIResourceList
+		expected  string
+	}{
+		{
+			name: "beta",
+			resources: []*metav1.APIResourceList{
+				{GroupVersion: "certificates.k8s.io/v1", APIResources: []metav1.APIResource{{Name: "certificatesigningrequests"}}},
+				{GroupVersion: "certificates.k8s.io/v1beta1", APIResources: []metav1.APIResource{{Name: "clustertrustbundles"}}},
+				{GroupVersion: "certificates.k8s.io/v1alpha1", APIResources: []metav1.APIResource{{Name: "clustertrustbundles"}}},
+			},
+			expected: "certificates.k8s.io/v1beta1",
+		},
+		{
+			name: "alpha",
+			resources: []*metav1.APIResourceList{
+				{GroupVersion: "certificates.k8s.io/v1alpha1", APIResources: []metav1.APIResource{{Name: "clustertrustbundles"}}},
+			},
+			expected: "certificates.k8s.io/v1alpha1",
+		},
+		{
+			name: "not served",
+			resources: []*metav1.APIResourceList{
+				{GroupVersion: "certificates.k8s.io/v1", APIResources: []metav1.APIResource{{Name: "certificatesigningrequests"}}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := k8sfake.NewSimpleClientset()
+			client.Resources = test.resources
+			bundles := &restClusterTrustBundleClient{discovery: client.Discovery()}
+
+			version, err := bundles.served()
+			if test.expected == "" {
+				if !goerrors.Is(err, errClusterTrustBundlesNotServed) {
+					t.Fatalf("expected ClusterTrustBundles not to be served, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version != test.expected {
+				t.Errorf("expected version %s, got %s", test.expected, version)
+			}
+		})
+	}
+}
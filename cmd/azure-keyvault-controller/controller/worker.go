@@ -0,0 +1,139 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// RateLimiterOptions controls how fast items failing to sync are retried in a queue.
+// Zero values use the defaults of client-go controllers.
+type RateLimiterOptions struct {
+	// BaseDelay is the delay before the first retry of an item, doubling for every retry
+	BaseDelay time.Duration
+
+	// MaxDelay is the maximum delay before retrying an item
+	MaxDelay time.Duration
+
+	// QPS is the overall number of retries per second for all items in the queue
+	QPS float64
+
+	// Burst is the number of retries allowed above QPS in bursts
+	Burst int
+}
+
+// newRateLimiter returns a rate limiter using the slowest of a per-item exponential backoff
+// and an overall token bucket, like workqueue.DefaultControllerRateLimiter
+func (o RateLimiterOptions) newRateLimiter() workqueue.RateLimiter {
+	baseDelay, maxDelay, qps, burst := o.BaseDelay, o.MaxDelay, o.QPS, o.Burst
+	if baseDelay <= 0 {
+		baseDelay = 5 * time.Millisecond
+	}
+	if maxDelay <= 0 {
+		maxDelay = 1000 * time.Second
+	}
+	if qps <= 0 {
+		qps = 10
+	}
+	if burst <= 0 {
+		burst = 100
+	}
+
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(baseDelay, maxDelay),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(qps), burst)},
+	)
+}
+
+// queueWorker continuously runs a sync func against the items of a queue, retrying failed
+// items using the rate limiter of the queue up to maxRetries times
+type queueWorker struct {
+	name        string
+	queue       *trackedQueue
+	maxRetries  int
+	threadiness int
+	sync        func(key string) error
+}
+
+func newQueueWorker(name string, rateLimiter workqueue.RateLimiter, maxRetries, threadiness int, sync func(key string) error) *queueWorker {
+	return &queueWorker{
+		name:        name,
+		queue:       newTrackedQueue(workqueue.NewNamedRateLimitingQueue(rateLimiter, name)),
+		maxRetries:  maxRetries,
+		threadiness: threadiness,
+		sync:        sync,
+	}
+}
+
+// GetQueue returns the queue of the worker
+func (w *queueWorker) GetQueue() workqueue.RateLimitingInterface {
+	return w.queue
+}
+
+// Run starts the workers processing the queue until shutdown is closed
+func (w *queueWorker) Run(shutdown <-chan struct{}) {
+	defer runtime.HandleCrash()
+
+	for i := 0; i < w.threadiness; i++ {
+		go wait.Until(w.processQueue, time.Second, shutdown)
+	}
+
+	go func() {
+		<-shutdown
+		log.Debugf("Shutting down %s queue", w.name)
+		w.queue.ShutDown()
+	}()
+}
+
+func (w *queueWorker) processQueue() {
+	for w.processNextItem() {
+	}
+}
+
+func (w *queueWorker) processNextItem() bool {
+	key, quit := w.queue.Get()
+	if quit {
+		return false
+	}
+	// Unblocks the key for other workers, so the same key is never synced in parallel
+	defer w.queue.Done(key)
+
+	err := w.sync(key.(string))
+	w.queue.recordError(key, err)
+	if err == nil {
+		// Forgetting earlier failures, so future syncs of the key are not delayed by them
+		w.queue.Forget(key)
+		return true
+	}
+
+	if w.queue.NumRequeues(key) < w.maxRetries {
+		log.Infof("Error syncing key %v in %s queue, retrying: %v", key, w.name, err)
+		w.queue.AddRateLimited(key)
+		return true
+	}
+
+	w.queue.Forget(key)
+	runtime.HandleError(err)
+	log.Infof("Dropping key %q out of %s queue after %d retries: %v", key, w.name, w.maxRetries, err)
+	return true
+}
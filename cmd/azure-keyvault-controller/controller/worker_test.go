@@ -0,0 +1,73 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterOptions(t *testing.T) {
+	limiter := RateLimiterOptions{BaseDelay: time.Second, MaxDelay: 4 * time.Second}.newRateLimiter()
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second}
+	for i, delay := range expected {
+		if actual := limiter.When("key"); actual != delay {
+			t.Errorf("expected retry %d after %s, got %s", i+1, delay, actual)
+		}
+	}
+
+	limiter.Forget("key")
+	if actual := limiter.When("key"); actual != time.Second {
+		t.Errorf("expected retry after base delay once forgotten, got %s", actual)
+	}
+}
+
+func TestRateLimiterOptionsDefaults(t *testing.T) {
+	limiter := RateLimiterOptions{}.newRateLimiter()
+	if actual := limiter.When("key"); actual != 5*time.Millisecond {
+		t.Errorf("expected default base delay of 5ms, got %s", actual)
+	}
+}
+
+func TestQueueWorkerRetriesFailedItems(t *testing.T) {
+	syncs := 0
+	worker := newQueueWorker("Test", RateLimiterOptions{BaseDelay: time.Millisecond}.newRateLimiter(), 2, 1, func(key string) error {
+		syncs++
+		return fmt.Errorf("failed")
+	})
+
+	worker.GetQueue().Add("key")
+	for i := 0; i < 3; i++ {
+		if !worker.processNextItem() {
+			t.Fatal("expected queue not to be shut down")
+		}
+	}
+
+	if syncs != 3 {
+		t.Errorf("expected the first sync and 2 retries, got %d syncs", syncs)
+	}
+	if worker.GetQueue().NumRequeues("key") != 0 {
+		t.Error("expected key to be forgotten after max retries")
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if length := worker.GetQueue().Len(); length != 0 {
+		t.Errorf("expected key to be dropped after max retries, got queue length %d", length)
+	}
+}
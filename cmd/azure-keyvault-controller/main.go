@@ -21,13 +21,24 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/pprof"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
+	"go.opencensus.io/trace"
+	"go.opencensus.io/zpages"
 
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	kubeinformers "k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -37,6 +48,8 @@ import (
 
 	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/cmd/azure-keyvault-controller/controller"
 	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/akv2k8s"
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/akv2k8s/redact"
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/akv2k8s/transformers"
 	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/credentialprovider"
 	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
 	clientset "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/client/clientset/versioned"
@@ -50,18 +63,120 @@ var (
 	cloudconfig string
 	logLevel    string
 	version     string
+	configPath  string
+
+	profileName  string
+	syncWorkers  int
+	azureWorkers int
+
+	syncRateLimiter  controller.RateLimiterOptions
+	azureRateLimiter controller.RateLimiterOptions
+
+	watchNamespaces  string
+	ignoreNamespaces string
+	crdLabelSelector string
+	dryRun           bool
+	resyncPeriod     time.Duration
+	secretResync     bool
+
+	transformHooks       string
+	transformHookTimeout time.Duration
 
 	azureVaultFastRate        time.Duration
 	azureVaultSlowRate        time.Duration
 	azureVaultMaxFastAttempts int
-	customAuth                bool
+	azureVaultPollJitter      float64
+	azureVaultCacheTTL        time.Duration
+	azureVaultMaxConcurrent   int
+	azureVaultQuotaLimit      int
+	azureVaultQuotaWindow     time.Duration
+	azureVaultQuotaWarning    float64
+	shutdownTimeout           time.Duration
+	startupReconcileParallel  int
+	syncTimeout               time.Duration
+	statusUpdateQPS           float64
+	statusUpdateBurst         int
+	shardCount                int
+	orphanedSecretPolicy      string
+	orphanedSecretInterval    time.Duration
+	reportInterval            time.Duration
+	reportExpiryWindow        time.Duration
+	vaultProbeInterval        time.Duration
+	credentialCheckInterval   time.Duration
+	credentialCheckEvents     bool
+	metadataTagsInterval      time.Duration
+	clusterName               string
+	rotationAnomaly           controller.RotationAnomalyOptions
+	shardOrdinal              int
+	controllerID              string
+
+	azureVaultCircuitBreakerThreshold int
+	azureVaultDegradedThreshold       int
+	azureVaultDegradedRetryInterval   time.Duration
+	customAuth                        bool
+	repairDrift                       bool
+	rolloutOnRotation                 bool
+	rollout                           controller.RolloutOptions
+	trackConsumers                    bool
+	secretEvents                      bool
+	trustBundles                      bool
+
+	azureHTTPSProxy   string
+	azureCABundleFile string
+
+	credentialSetsConfig string
+
+	notifyWebhookURL string
+	notifySlackURL   string
+	notifyTeamsURL   string
+
+	tracingAddress           string
+	metricsAddress           string
+	debugAddress             string
+	healthAddress            string
+	auditLogPath             string
+	tracingSampleProbability float64
+
+	leaderElection              bool
+	leaderElectionNamespace     string
+	podName                     string
+	leaderElectionName          string
+	leaderElectionLeaseDuration time.Duration
+	leaderElectionAzureOnly     bool
+
+	eventGridAddress     string
+	eventGridKey         string
+	eventGridTLSCertFile string
+	eventGridTLSKeyFile  string
+
+	adminAddress     string
+	adminToken       string
+	adminTLSCertFile string
+	adminTLSKeyFile  string
+
+	chaos vault.ChaosOptions
 )
 
 const controllerAgentName = "azurekeyvaultcontroller"
 
 func main() {
 	flag.Parse()
-	akv2k8s.Version = version
+	// The version set on the command line overrides the one embedded when built
+	if version != "" {
+		akv2k8s.Version = version
+	}
+
+	// The environment without the config file applied, so a restart reads the config file again
+	environ := os.Environ()
+	if configPath != "" {
+		settings, err := readConfigFile(configPath)
+		if err != nil {
+			log.Fatalf("Error reading --config %s: %s", configPath, err.Error())
+		}
+		if err := applyConfig(settings); err != nil {
+			log.Fatalf("Error applying --config %s: %s", configPath, err.Error())
+		}
+	}
 
 	logFormat := "fmt"
 	logFormat, _ = os.LookupEnv("LOG_FORMAT")
@@ -73,27 +188,298 @@ func main() {
 	stopCh := signals.SetupSignalHandler()
 	setLogLevel()
 
+	if err := applyProfile(profileName); err != nil {
+		log.Fatalf("Error parsing --profile: %s", err.Error())
+	}
+	log.Infof("Using '%s' profile", profileName)
+
+	if dryRun {
+		log.Warn("Running in dry run mode, no Secrets or AzureKeyVaultSecrets will be changed")
+	}
+
+	if transformHooks != "" {
+		if err := transformers.RegisterExecHooks(transformHooks, transformHookTimeout); err != nil {
+			log.Fatalf("Error parsing --transform-hooks: %s", err.Error())
+		}
+		log.Infof("Registered transform hooks %s", transformHooks)
+	}
+
+	if syncWorkers < 1 || azureWorkers < 1 {
+		log.Fatalf("--sync-workers and --azure-workers must be at least 1")
+	}
+
 	var err error
-	azureVaultFastRate, err = getEnvDuration("AZURE_VAULT_NORMAL_POLL_INTERVALS", time.Minute*1)
+	azureVaultFastRate, err = getEnvDuration("AZURE_VAULT_NORMAL_POLL_INTERVALS", defaults.pollInterval)
 	if err != nil {
 		log.Fatalf("Error parsing env var AZURE_VAULT_NORMAL_POLL_INTERVALS: %s", err.Error())
 	}
 
-	azureVaultSlowRate, err = getEnvDuration("AZURE_VAULT_EXCEPTION_POLL_INTERVALS", time.Minute*5)
+	azureVaultSlowRate, err = getEnvDuration("AZURE_VAULT_EXCEPTION_POLL_INTERVALS", defaults.slowPollInterval)
 	if err != nil {
 		log.Fatalf("Error parsing env var AZURE_VAULT_EXCEPTION_POLL_INTERVALS: %s", err.Error())
 	}
 
+	azureVaultPollJitter, err = getEnvFloat("AZURE_VAULT_POLL_JITTER", 0.1)
+	if err != nil {
+		log.Fatalf("Error parsing env var AZURE_VAULT_POLL_JITTER: %s", err.Error())
+	}
+
 	azureVaultMaxFastAttempts, err = getEnvInt("AZURE_VAULT_MAX_FAILURE_ATTEMPTS", 5)
 	if err != nil {
 		log.Fatalf("Error parsing env var AZURE_VAULT_MAX_FAILURE_ATTEMPTS: %s", err.Error())
 	}
 
+	azureVaultCacheTTL, err = getEnvDuration("AZURE_VAULT_CACHE_TTL", defaults.cacheTTL)
+	if err != nil {
+		log.Fatalf("Error parsing env var AZURE_VAULT_CACHE_TTL: %s", err.Error())
+	}
+
+	azureVaultMaxConcurrent, err = getEnvInt("AZURE_VAULT_MAX_CONCURRENT_REQUESTS", defaults.maxConcurrentRequests)
+	if err != nil {
+		log.Fatalf("Error parsing env var AZURE_VAULT_MAX_CONCURRENT_REQUESTS: %s", err.Error())
+	}
+
+	azureVaultQuotaLimit, err = getEnvInt("AZURE_VAULT_QUOTA_LIMIT", vault.DefaultQuotaLimit)
+	if err != nil {
+		log.Fatalf("Error parsing env var AZURE_VAULT_QUOTA_LIMIT: %s", err.Error())
+	}
+
+	azureVaultQuotaWindow, err = getEnvDuration("AZURE_VAULT_QUOTA_WINDOW", vault.DefaultQuotaWindow)
+	if err != nil {
+		log.Fatalf("Error parsing env var AZURE_VAULT_QUOTA_WINDOW: %s", err.Error())
+	}
+
+	azureVaultQuotaWarning, err = getEnvFloat("AZURE_VAULT_QUOTA_WARNING_THRESHOLD", 0.8)
+	if err != nil {
+		log.Fatalf("Error parsing env var AZURE_VAULT_QUOTA_WARNING_THRESHOLD: %s", err.Error())
+	}
+
+	azureVaultCircuitBreakerThreshold, err = getEnvInt("AZURE_VAULT_CIRCUIT_BREAKER_THRESHOLD", 10)
+	if err != nil {
+		log.Fatalf("Error parsing env var AZURE_VAULT_CIRCUIT_BREAKER_THRESHOLD: %s", err.Error())
+	}
+
+	azureVaultDegradedThreshold, err = getEnvInt("AZURE_VAULT_DEGRADED_THRESHOLD", 20)
+	if err != nil {
+		log.Fatalf("Error parsing env var AZURE_VAULT_DEGRADED_THRESHOLD: %s", err.Error())
+	}
+
+	azureVaultDegradedRetryInterval, err = getEnvDuration("AZURE_VAULT_DEGRADED_RETRY_INTERVAL", time.Hour)
+	if err != nil {
+		log.Fatalf("Error parsing env var AZURE_VAULT_DEGRADED_RETRY_INTERVAL: %s", err.Error())
+	}
+
 	customAuth, err = getEnvBool("CUSTOM_AUTH", false)
 	if err != nil {
 		log.Fatalf("Error parsing env var CUSTOM_AUTH: %s", err.Error())
 	}
 
+	fipsMode, err := getEnvBool("FIPS_MODE", false)
+	if err != nil {
+		log.Fatalf("Error parsing env var FIPS_MODE: %s", err.Error())
+	}
+	akv2k8s.EnableFIPS(fipsMode)
+	if akv2k8s.FIPS {
+		log.Info("Running in FIPS mode")
+	}
+
+	repairDrift, err = getEnvBool("SECRET_DRIFT_REPAIR", true)
+	if err != nil {
+		log.Fatalf("Error parsing env var SECRET_DRIFT_REPAIR: %s", err.Error())
+	}
+
+	rolloutOnRotation, err = getEnvBool("ROLLOUT_ON_ROTATION", false)
+	if err != nil {
+		log.Fatalf("Error parsing env var ROLLOUT_ON_ROTATION: %s", err.Error())
+	}
+
+	rollout.MaxUnavailable, err = getEnvInt("ROLLOUT_MAX_UNAVAILABLE", 0)
+	if err != nil {
+		log.Fatalf("Error parsing env var ROLLOUT_MAX_UNAVAILABLE: %s", err.Error())
+	}
+
+	rollout.Delay, err = getEnvDuration("ROLLOUT_DELAY", 0)
+	if err != nil {
+		log.Fatalf("Error parsing env var ROLLOUT_DELAY: %s", err.Error())
+	}
+
+	rollout.OrderLabel, _ = getEnvStr("ROLLOUT_ORDER_LABEL", "")
+
+	trackConsumers, err = getEnvBool("TRACK_SECRET_CONSUMERS", false)
+	if err != nil {
+		log.Fatalf("Error parsing env var TRACK_SECRET_CONSUMERS: %s", err.Error())
+	}
+
+	secretEvents, err = getEnvBool("SECRET_EVENTS", false)
+	if err != nil {
+		log.Fatalf("Error parsing env var SECRET_EVENTS: %s", err.Error())
+	}
+
+	trustBundles, err = getEnvBool("TRUST_BUNDLES", false)
+	if err != nil {
+		log.Fatalf("Error parsing env var TRUST_BUNDLES: %s", err.Error())
+	}
+
+	shutdownTimeout, err = getEnvDuration("SHUTDOWN_TIMEOUT", time.Second*25)
+	if err != nil {
+		log.Fatalf("Error parsing env var SHUTDOWN_TIMEOUT: %s", err.Error())
+	}
+
+	startupReconcileParallel, err = getEnvInt("STARTUP_RECONCILE_PARALLELISM", 4)
+	if err != nil {
+		log.Fatalf("Error parsing env var STARTUP_RECONCILE_PARALLELISM: %s", err.Error())
+	}
+
+	syncTimeout, err = getEnvDuration("SYNC_TIMEOUT", time.Minute*2)
+	if err != nil {
+		log.Fatalf("Error parsing env var SYNC_TIMEOUT: %s", err.Error())
+	}
+
+	statusUpdateQPS, err = getEnvFloat("STATUS_UPDATE_QPS", defaults.statusUpdateQPS)
+	if err != nil {
+		log.Fatalf("Error parsing env var STATUS_UPDATE_QPS: %s", err.Error())
+	}
+
+	statusUpdateBurst, err = getEnvInt("STATUS_UPDATE_BURST", defaults.statusUpdateBurst)
+	if err != nil {
+		log.Fatalf("Error parsing env var STATUS_UPDATE_BURST: %s", err.Error())
+	}
+
+	azureHTTPSProxy, _ = getEnvStr("AZURE_HTTPS_PROXY", "")
+	azureCABundleFile, _ = getEnvStr("AZURE_CA_BUNDLE_FILE", "")
+	credentialSetsConfig, _ = getEnvStr("AZURE_CREDENTIAL_SETS_CONFIG", "")
+
+	leaderElection, err = getEnvBool("LEADER_ELECTION", false)
+	if err != nil {
+		log.Fatalf("Error parsing env var LEADER_ELECTION: %s", err.Error())
+	}
+
+	leaderElectionAzureOnly, err = getEnvBool("LEADER_ELECTION_AZURE_POLLING_ONLY", false)
+	if err != nil {
+		log.Fatalf("Error parsing env var LEADER_ELECTION_AZURE_POLLING_ONLY: %s", err.Error())
+	}
+
+	leaderElectionLeaseDuration, err = getEnvDuration("LEADER_ELECTION_LEASE_DURATION", time.Second*15)
+	if err != nil {
+		log.Fatalf("Error parsing env var LEADER_ELECTION_LEASE_DURATION: %s", err.Error())
+	}
+
+	leaderElectionNamespace, _ = getEnvStr("POD_NAMESPACE", "default")
+	leaderElectionName, _ = getEnvStr("LEADER_ELECTION_NAME", controllerAgentName)
+
+	orphanedSecretPolicy, _ = getEnvStr("ORPHANED_SECRET_POLICY", "")
+	switch controller.OrphanedSecretPolicy(orphanedSecretPolicy) {
+	case "", controller.OrphanedSecretPolicyAdopt, controller.OrphanedSecretPolicyDelete:
+	default:
+		log.Fatalf("Error parsing env var ORPHANED_SECRET_POLICY: must be '%s', '%s' or empty, got '%s'", controller.OrphanedSecretPolicyAdopt, controller.OrphanedSecretPolicyDelete, orphanedSecretPolicy)
+	}
+
+	orphanedSecretInterval, err = getEnvDuration("ORPHANED_SECRET_INTERVAL", time.Minute*10)
+	if err != nil {
+		log.Fatalf("Error parsing env var ORPHANED_SECRET_INTERVAL: %s", err.Error())
+	}
+
+	reportInterval, err = getEnvDuration("REPORT_INTERVAL", 0)
+	if err != nil {
+		log.Fatalf("Error parsing env var REPORT_INTERVAL: %s", err.Error())
+	}
+
+	reportExpiryWindow, err = getEnvDuration("REPORT_EXPIRY_WINDOW", time.Hour*24*30)
+	if err != nil {
+		log.Fatalf("Error parsing env var REPORT_EXPIRY_WINDOW: %s", err.Error())
+	}
+
+	vaultProbeInterval, err = getEnvDuration("VAULT_PROBE_INTERVAL", 0)
+	if err != nil {
+		log.Fatalf("Error parsing env var VAULT_PROBE_INTERVAL: %s", err.Error())
+	}
+
+	credentialCheckInterval, err = getEnvDuration("CREDENTIAL_CHECK_INTERVAL", 0)
+	if err != nil {
+		log.Fatalf("Error parsing env var CREDENTIAL_CHECK_INTERVAL: %s", err.Error())
+	}
+
+	credentialCheckEvents, err = getEnvBool("CREDENTIAL_CHECK_EVENTS", false)
+	if err != nil {
+		log.Fatalf("Error parsing env var CREDENTIAL_CHECK_EVENTS: %s", err.Error())
+	}
+
+	metadataTagsInterval, err = getEnvDuration("VAULT_METADATA_TAGS_INTERVAL", 0)
+	if err != nil {
+		log.Fatalf("Error parsing env var VAULT_METADATA_TAGS_INTERVAL: %s", err.Error())
+	}
+	clusterName, _ = getEnvStr("CLUSTER_NAME", "")
+
+	rotationAnomaly.Window, err = getEnvDuration("ROTATION_ANOMALY_WINDOW", 0)
+	if err != nil {
+		log.Fatalf("Error parsing env var ROTATION_ANOMALY_WINDOW: %s", err.Error())
+	}
+
+	rotationAnomaly.Baseline, err = getEnvDuration("ROTATION_ANOMALY_BASELINE", time.Hour*24*7)
+	if err != nil {
+		log.Fatalf("Error parsing env var ROTATION_ANOMALY_BASELINE: %s", err.Error())
+	}
+
+	rotationAnomaly.Factor, err = getEnvFloat("ROTATION_ANOMALY_FACTOR", 10)
+	if err != nil {
+		log.Fatalf("Error parsing env var ROTATION_ANOMALY_FACTOR: %s", err.Error())
+	}
+
+	rotationAnomaly.MinRotations, err = getEnvInt("ROTATION_ANOMALY_MIN_ROTATIONS", 3)
+	if err != nil {
+		log.Fatalf("Error parsing env var ROTATION_ANOMALY_MIN_ROTATIONS: %s", err.Error())
+	}
+
+	controllerID, _ = getEnvStr("CONTROLLER_ID", "")
+
+	shardCount, err = getEnvInt("SHARD_COUNT", 1)
+	if err != nil {
+		log.Fatalf("Error parsing env var SHARD_COUNT: %s", err.Error())
+	}
+
+	if shardCount > 1 {
+		shardOrdinal, err = getShardOrdinal()
+		if err != nil {
+			log.Fatalf("Error getting shard ordinal: %s", err.Error())
+		}
+		if shardOrdinal < 0 || shardOrdinal >= shardCount {
+			log.Fatalf("Shard ordinal %d must be between 0 and SHARD_COUNT-1 (%d)", shardOrdinal, shardCount-1)
+		}
+
+		// Each shard elects its own leader, so a standby replica can take over the shard
+		leaderElectionName = fmt.Sprintf("%s-shard-%d", leaderElectionName, shardOrdinal)
+	}
+
+	tracingAddress, _ = getEnvStr("TRACING_ADDRESS", "")
+	metricsAddress, _ = getEnvStr("METRICS_ADDRESS", "")
+	debugAddress, _ = getEnvStr("DEBUG_ADDRESS", "")
+	healthAddress, _ = getEnvStr("HEALTH_ADDRESS", "")
+	auditLogPath, _ = getEnvStr("AUDIT_LOG", "")
+	notifyWebhookURL, _ = getEnvStr("NOTIFY_WEBHOOK_URL", "")
+	notifySlackURL, _ = getEnvStr("NOTIFY_SLACK_WEBHOOK_URL", "")
+	notifyTeamsURL, _ = getEnvStr("NOTIFY_TEAMS_WEBHOOK_URL", "")
+	podName, _ = getEnvStr("POD_NAME", "")
+	tracingSampleProbability, err = getEnvFloat("TRACING_SAMPLE_PROBABILITY", 1)
+	if err != nil {
+		log.Fatalf("Error parsing env var TRACING_SAMPLE_PROBABILITY: %s", err.Error())
+	}
+
+	eventGridAddress, _ = getEnvStr("AZURE_EVENT_GRID_ADDRESS", "")
+	eventGridKey, _ = getEnvStr("AZURE_EVENT_GRID_KEY", "")
+	eventGridTLSCertFile, _ = getEnvStr("AZURE_EVENT_GRID_TLS_CERT_FILE", "")
+	eventGridTLSKeyFile, _ = getEnvStr("AZURE_EVENT_GRID_TLS_KEY_FILE", "")
+	if eventGridAddress != "" && eventGridKey == "" {
+		log.Fatal("AZURE_EVENT_GRID_KEY must be set when AZURE_EVENT_GRID_ADDRESS is set")
+	}
+
+	adminAddress, _ = getEnvStr("ADMIN_ADDRESS", "")
+	adminToken, _ = getEnvStr("ADMIN_TOKEN", "")
+	adminTLSCertFile, _ = getEnvStr("ADMIN_TLS_CERT_FILE", "")
+	adminTLSKeyFile, _ = getEnvStr("ADMIN_TLS_KEY_FILE", "")
+	if adminAddress != "" && adminToken == "" {
+		log.Fatal("ADMIN_TOKEN must be set when ADMIN_ADDRESS is set")
+	}
+
 	cfg, err := clientcmd.BuildConfigFromFlags(masterURL, kubeconfig)
 	if err != nil {
 		log.Fatalf("Error building kubeconfig: %s", err.Error())
@@ -109,13 +495,59 @@ func main() {
 		log.Fatalf("Error building azureKeyVaultSecret clientset: %s", err.Error())
 	}
 
-	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClient, time.Second*30)
-	azureKeyVaultSecretInformerFactory := informers.NewSharedInformerFactory(azureKeyVaultSecretClient, time.Second*30)
+	// AzureKeyVaultDefaults and AzureKeyVaultPolicies are only watched when their CRDs are installed
+	servedResources, err := controller.ServedResources(azureKeyVaultSecretClient.Discovery())
+	if err != nil {
+		log.Fatalf("Error discovering AzureKeyVault resources: %s", err.Error())
+	}
+	if !servedResources["azurekeyvaultdefaults"] {
+		log.Warning("AzureKeyVaultDefault CRD not installed, AzureKeyVaultDefaults are not applied until the controller is restarted")
+	}
+	if !servedResources["azurekeyvaultpolicies"] {
+		log.Warning("AzureKeyVaultPolicy CRD not installed, all Azure Key Vaults are allowed until the controller is restarted")
+	}
+
+	namespaces := controller.NamespaceFilter{
+		Watch:  splitNamespaces(watchNamespaces),
+		Ignore: splitNamespaces(ignoreNamespaces),
+	}
+	if len(namespaces.Watch) > 0 {
+		log.Infof("Watching namespaces %s", strings.Join(namespaces.Watch, ", "))
+	}
+	if len(namespaces.Ignore) > 0 {
+		log.Infof("Ignoring namespaces %s", strings.Join(namespaces.Ignore, ", "))
+	}
+
+	akvsInformerOptions := namespaces.AkvsInformerOptions()
+	if crdLabelSelector != "" {
+		if _, err := labels.Parse(crdLabelSelector); err != nil {
+			log.Fatalf("Error parsing --crd-label-selector '%s': %s", crdLabelSelector, err.Error())
+		}
+
+		log.Infof("Only handling AzureKeyVaultSecrets matching label selector '%s'", crdLabelSelector)
+		akvsInformerOptions = append(akvsInformerOptions, informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = crdLabelSelector
+		}))
+	}
+
+	kubeInformerOptions := namespaces.KubeInformerOptions()
+	if !secretResync {
+		// Secret update handlers ignore resyncs, so a full resync of all Secrets only costs CPU at scale.
+		// Secrets are checked for changes in Azure Key Vault by the Azure Key Vault poll queue instead.
+		log.Info("Disabling periodic resync of Secrets")
+		kubeInformerOptions = append(kubeInformerOptions, kubeinformers.WithCustomResyncConfig(map[metav1.Object]time.Duration{
+			&corev1.Secret{}: 0,
+		}))
+	}
+
+	kubeInformerFactory := kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, resyncPeriod, kubeInformerOptions...)
+	azureKeyVaultSecretInformerFactory := informers.NewSharedInformerFactoryWithOptions(azureKeyVaultSecretClient, resyncPeriod, akvsInformerOptions...)
 
 	azurePollFrequency := controller.AzurePollFrequency{
 		Normal:                       azureVaultFastRate,
 		Slow:                         azureVaultSlowRate,
 		MaxFailuresBeforeSlowingDown: azureVaultMaxFastAttempts,
+		Jitter:                       azureVaultPollJitter,
 	}
 
 	log.Info("Creating event broadcaster")
@@ -123,40 +555,139 @@ func main() {
 	eventBroadcaster.StartLogging(log.Tracef)
 	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
 
-	var vaultAuth *credentialprovider.AzureKeyVaultCredentials
-	if customAuth {
-		provider, err := credentialprovider.NewFromEnvironment()
-		if err != nil {
-			log.Fatalf("failed to create azure credentials provider, error: %+v", err.Error())
-		}
+	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
 
-		if vaultAuth, err = provider.GetAzureKeyVaultCredentials(); err != nil {
-			log.Fatalf("failed to get azure key vault credentials, error: %+v", err.Error())
-		}
-	} else {
-		f, err := os.Open(cloudconfig)
+	// Credentials are reloaded when Azure rejects them, like after the client secret has been rotated
+	recoveringService, err := vault.NewRecoveringService(func() (vault.Service, error) {
+		vaultAuth, err := getVaultCredentials()
 		if err != nil {
-			log.Fatalf("Failed reading azure config from %s, error: %+v", cloudconfig, err)
+			return nil, err
 		}
-		defer f.Close()
+		return newVaultService(vaultAuth), nil
+	}, func(authErr, recoveryErr error) {
+		recordCredentialsRecovery(recorder, authErr, recoveryErr)
+	})
+	if err != nil {
+		log.Fatalf("failed to get azure key vault credentials, error: %+v", err)
+	}
+	vaultService := vault.Service(recoveringService)
 
-		cloudCnfProvider, err := credentialprovider.NewFromCloudConfig(f)
+	if credentialSetsConfig != "" {
+		credentialSets, err := newCredentialSetServices(credentialSetsConfig)
 		if err != nil {
-			log.Fatalf("Failed reading azure config from %s, error: %+v", cloudconfig, err)
+			log.Fatalf("failed to create azure key vault credential sets from %s, error: %+v", credentialSetsConfig, err)
 		}
-
-		if vaultAuth, err = cloudCnfProvider.GetAzureKeyVaultCredentials(); err != nil {
-			log.Fatalf("failed to create azure key vault credentials, error: %+v", err.Error())
+		vaultService = vault.NewCredentialSetService(vaultService, credentialSets)
+	}
+	if chaos.Enabled() {
+		log.Warnf("Chaos mode enabled, injecting failures into requests to Azure Key Vault - for testing only")
+		vaultService = vault.NewChaosService(vaultService, chaos)
+	}
+	if metricsAddress != "" {
+		// Measuring below the limiter, so latency is only the time spent waiting for Azure Key Vault
+		if vaultService, err = vault.NewMetricsService(vaultService, prometheus.DefaultRegisterer); err != nil {
+			log.Fatalf("failed to register azure key vault metrics, error: %+v", err)
+		}
+	}
+	// Counting below the cache, so only requests reaching Azure Key Vault use its quota
+	vaultQuota := vault.NewQuotaTracker(azureVaultQuotaWindow, azureVaultQuotaLimit)
+	vaultService = vault.NewQuotaService(vaultService, vaultQuota)
+	if metricsAddress != "" {
+		if err = prometheus.DefaultRegisterer.Register(vaultQuota); err != nil {
+			log.Fatalf("failed to register azure key vault quota metrics, error: %+v", err)
 		}
 	}
+	// Limiting below the cache, so cached lookups never wait for requests to Azure Key Vault
+	vaultService = vault.NewLimitedService(vaultService, azureVaultMaxConcurrent)
+	vaultService = vault.NewCachedService(vaultService, azureVaultCacheTTL)
 
-	vaultService := vault.NewService(vaultAuth)
-	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: controllerAgentName})
-	// handler := controller.NewHandler(kubeClient, azureKeyVaultSecretClient, kubeInformerFactory.Core().V1().Secrets().Lister(), azureKeyVaultSecretInformerFactory.Azurekeyvault().V2alpha1().AzureKeyVaultSecrets().Lister(), recorder, vaultService, azurePollFrequency)
+	identity, err := os.Hostname()
+	if err != nil {
+		log.Fatalf("failed to get hostname for controller identity, error: %+v", err)
+	}
+
+	auditLog, err := openAuditLog(auditLogPath)
+	if err != nil {
+		log.Fatalf("failed to open audit log %s, error: %+v", auditLogPath, err)
+	}
 
 	options := &controller.Options{
-		MaxNumRequeues: 5,
-		NumThreads:     1,
+		MaxNumRequeues:              5,
+		ResyncPeriod:                resyncPeriod,
+		NumThreads:                  syncWorkers,
+		AzureNumThreads:             azureWorkers,
+		RateLimiter:                 syncRateLimiter,
+		AzureRateLimiter:            azureRateLimiter,
+		CircuitBreakerThreshold:     azureVaultCircuitBreakerThreshold,
+		CircuitBreakerProbeInterval: azureVaultSlowRate,
+		DegradedThreshold:           azureVaultDegradedThreshold,
+		DegradedRetryInterval:       azureVaultDegradedRetryInterval,
+		Namespaces:                  namespaces,
+		Shard:                       controller.ShardOptions{Count: shardCount, Ordinal: shardOrdinal},
+		RepairDrift:                 repairDrift,
+		RolloutOnRotation:           rolloutOnRotation,
+		Rollout:                     rollout,
+		TrackConsumers:              trackConsumers,
+		SecretEvents:                secretEvents,
+		VaultDefaults:               servedResources["azurekeyvaultdefaults"],
+		VaultPolicies:               servedResources["azurekeyvaultpolicies"],
+		TrustBundles:                trustBundles,
+		OrphanedSecretPolicy:        controller.OrphanedSecretPolicy(orphanedSecretPolicy),
+		OrphanedSecretInterval:      orphanedSecretInterval,
+		ReportInterval:              reportInterval,
+		ReportExpiryWindow:          reportExpiryWindow,
+		VaultProbeInterval:          vaultProbeInterval,
+		CredentialCheckInterval:     credentialCheckInterval,
+		CredentialCheckEvents:       credentialCheckEvents,
+		MetadataTagsInterval:        metadataTagsInterval,
+		ClusterName:                 clusterName,
+		VaultQuota:                  vaultQuota,
+		QuotaWarningThreshold:       azureVaultQuotaWarning,
+		RotationAnomaly:             rotationAnomaly,
+		SyncTimeout:                 syncTimeout,
+		StatusUpdateQPS:             statusUpdateQPS,
+		StatusUpdateBurst:           statusUpdateBurst,
+		ShutdownTimeout:             shutdownTimeout,
+		StartupReconcileParallelism: startupReconcileParallel,
+		DryRun:                      dryRun,
+		AuditLog:                    auditLog,
+		Identity:                    identity,
+		ControllerID:                controllerID,
+		Notifiers:                   newNotifiers(),
+	}
+
+	if leaderElection {
+		options.LeaderElection = &controller.LeaderElectionOptions{
+			LockNamespace:    leaderElectionNamespace,
+			LockName:         leaderElectionName,
+			Identity:         identity,
+			LeaseDuration:    leaderElectionLeaseDuration,
+			RenewDeadline:    leaderElectionLeaseDuration * 2 / 3,
+			RetryPeriod:      leaderElectionLeaseDuration / 5,
+			AzurePollingOnly: leaderElectionAzureOnly,
+		}
+	}
+
+	if metricsAddress != "" {
+		if err := controller.RegisterQueueMetrics(prometheus.DefaultRegisterer); err != nil {
+			log.Fatalf("failed to register queue metrics, error: %+v", err)
+		}
+		if err := controller.RegisterBuildInfoMetric(prometheus.DefaultRegisterer); err != nil {
+			log.Fatalf("failed to register build info metric, error: %+v", err)
+		}
+		if err := controller.RegisterRotationMetrics(prometheus.DefaultRegisterer); err != nil {
+			log.Fatalf("failed to register rotation metrics, error: %+v", err)
+		}
+		if err := controller.RegisterVaultProbeMetrics(prometheus.DefaultRegisterer); err != nil {
+			log.Fatalf("failed to register vault probe metrics, error: %+v", err)
+		}
+		if err := controller.RegisterCredentialCheckMetrics(prometheus.DefaultRegisterer); err != nil {
+			log.Fatalf("failed to register credential check metrics, error: %+v", err)
+		}
+		if err := controller.RegisterStartupReconcileMetrics(prometheus.DefaultRegisterer); err != nil {
+			log.Fatalf("failed to register startup reconciliation metrics, error: %+v", err)
+		}
+		go serveMetrics()
 	}
 
 	controller := controller.NewController(
@@ -166,33 +697,341 @@ func main() {
 		kubeInformerFactory,
 		recorder,
 		vaultService,
-		"azure-key-vault-env-injection",
+		controller.DefaultNamespaceAkvsLabel,
 		azurePollFrequency,
 		options)
 
-	controller.Run(stopCh)
+	if tracingAddress != "" {
+		go serveTracing()
+	}
+
+	if healthAddress != "" {
+		go serveHealth(recoveringService.Healthy)
+	}
+
+	if debugAddress != "" {
+		go serveDebug(controller.QueuesHandler())
+	}
+
+	if eventGridAddress != "" {
+		go serveEventGrid(controller.EventGridHandler(eventGridKey))
+	}
+
+	if adminAddress != "" {
+		go serveAdmin(controller.AdminHandler(adminToken))
+	}
+
+	var reloadCh <-chan struct{}
+	runCh := stopCh
+	if configPath != "" {
+		configReloadInterval, err := getEnvDuration("CONFIG_RELOAD_INTERVAL", time.Second*10)
+		if err != nil {
+			log.Fatalf("Error parsing env var CONFIG_RELOAD_INTERVAL: %s", err.Error())
+		}
+		reloadCh = watchConfigFile(configPath, configReloadInterval, stopCh)
+		runCh = mergeStop(stopCh, reloadCh)
+	}
+
+	controller.Run(runCh)
+	eventBroadcaster.Shutdown()
+
+	// Settings are spread across clients, queues and caches, so the whole controller is restarted
+	// in place to apply a changed config file, after draining the queues like on shutdown
+	select {
+	case <-reloadCh:
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+		log.Infof("Restarting to apply config file %s", configPath)
+		if err := restart(environ); err != nil {
+			log.Fatalf("failed to restart with reloaded config file, error: %+v", err)
+		}
+	default:
+	}
+}
+
+// serveTracing samples spans of sync operations, which can be inspected on /debug/tracez
+func serveTracing() {
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.ProbabilitySampler(tracingSampleProbability)})
+
+	mux := http.NewServeMux()
+	zpages.Handle(mux, "/debug")
+
+	log.Infof("Serving traces on http://%s/debug/tracez", tracingAddress)
+	log.Fatalf("error serving tracing endpoint, error: %+v", http.ListenAndServe(tracingAddress, mux))
+}
+
+// serveMetrics exposes Prometheus metrics, like the depth and latency of each queue, on /metrics
+func serveMetrics() {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/version", akv2k8s.VersionHandler())
+
+	log.Infof("Serving metrics on http://%s/metrics and version on http://%s/version", metricsAddress, metricsAddress)
+	log.Fatalf("error serving metrics endpoint, error: %+v", http.ListenAndServe(metricsAddress, mux))
+}
+
+// serveDebug exposes pprof profiles, goroutine dumps and the keys in each queue. Never expose it
+// outside the cluster, as profiles and keys reveal details of the controller and its AzureKeyVaultSecrets.
+func serveDebug(queuesHandler http.Handler) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/queues", queuesHandler)
+
+	log.Infof("Serving pprof on http://%s/debug/pprof/, goroutine dumps on http://%s/debug/pprof/goroutine?debug=2 and queues on http://%s/debug/queues", debugAddress, debugAddress, debugAddress)
+	log.Fatalf("error serving debug endpoint, error: %+v", http.ListenAndServe(debugAddress, mux))
+}
+
+// serveHealth exposes /healthz, and /readyz failing when the controller can no longer authenticate with Azure
+func serveHealth(healthy func() bool) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	mux.Handle("/version", akv2k8s.VersionHandler())
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !healthy() {
+			http.Error(w, "failed to recover from Azure rejecting credentials", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+
+	log.Infof("Serving health checks on http://%s/healthz and http://%s/readyz, and version on http://%s/version", healthAddress, healthAddress, healthAddress)
+	log.Fatalf("error serving health endpoint, error: %+v", http.ListenAndServe(healthAddress, mux))
+}
+
+// openAuditLog opens the audit log of Secret changes for appending, where "-" is stdout.
+// Returns nil if path is empty, disabling the audit log.
+func openAuditLog(path string) (io.Writer, error) {
+	switch path {
+	case "":
+		return nil, nil
+	case "-":
+		return os.Stdout, nil
+	}
+	return os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+}
+
+// newNotifiers returns the notifiers configured using NOTIFY_WEBHOOK_URL, NOTIFY_SLACK_WEBHOOK_URL
+// and NOTIFY_TEAMS_WEBHOOK_URL
+func newNotifiers() []controller.Notifier {
+	var notifiers []controller.Notifier
+	if notifyWebhookURL != "" {
+		notifiers = append(notifiers, controller.NewWebhookNotifier(notifyWebhookURL))
+	}
+	if notifySlackURL != "" {
+		notifiers = append(notifiers, controller.NewSlackNotifier(notifySlackURL))
+	}
+	if notifyTeamsURL != "" {
+		notifiers = append(notifiers, controller.NewTeamsNotifier(notifyTeamsURL))
+	}
+	return notifiers
+}
+
+// getVaultCredentials loads the Azure Key Vault credentials of the controller from the
+// environment, or from the cloud config file
+func getVaultCredentials() (*credentialprovider.AzureKeyVaultCredentials, error) {
+	if customAuth {
+		provider, err := credentialprovider.NewFromEnvironment()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create azure credentials provider, error: %+v", err)
+		}
+		return provider.GetAzureKeyVaultCredentials()
+	}
+
+	f, err := os.Open(cloudconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading azure config from %s, error: %+v", cloudconfig, err)
+	}
+	defer f.Close()
+
+	cloudCnfProvider, err := credentialprovider.NewFromCloudConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading azure config from %s, error: %+v", cloudconfig, err)
+	}
+	return cloudCnfProvider.GetAzureKeyVaultCredentials()
+}
+
+// recordCredentialsRecovery logs reloading of credentials rejected by Azure, and records it as an
+// Event on the controller pod when POD_NAME is set
+func recordCredentialsRecovery(recorder record.EventRecorder, authErr, recoveryErr error) {
+	eventType, reason, msg := corev1.EventTypeNormal, controller.AzureCredentialsRecovered, fmt.Sprintf(controller.MessageAzureCredentialsRecovered, authErr)
+	if recoveryErr != nil {
+		eventType, reason, msg = corev1.EventTypeWarning, controller.ErrAzureCredentials, fmt.Sprintf(controller.MessageAzureCredentialsFailed, authErr, recoveryErr)
+		log.Error(msg)
+	} else {
+		log.Warning(msg)
+	}
+
+	if podName == "" {
+		return
+	}
+	pod := &corev1.ObjectReference{Kind: "Pod", APIVersion: "v1", Namespace: leaderElectionNamespace, Name: podName}
+	recorder.Event(pod, eventType, reason, msg)
+}
+
+func newVaultService(vaultAuth *credentialprovider.AzureKeyVaultCredentials) vault.Service {
+	if azureHTTPSProxy == "" && azureCABundleFile == "" {
+		return vault.NewService(vaultAuth)
+	}
+
+	httpClient, err := vault.NewHTTPClient(azureHTTPSProxy, azureCABundleFile)
+	if err != nil {
+		log.Fatalf("failed to create http client for azure, error: %+v", err)
+	}
+
+	if vaultAuth.Token != nil {
+		vaultAuth.Token.SetSender(httpClient)
+	}
+	return vault.NewServiceWithSender(vaultAuth, httpClient)
+}
+
+func newCredentialSetServices(configFile string) (map[string]vault.Service, error) {
+	f, err := os.Open(configFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	providers, err := credentialprovider.NewCredentialSetsFromConfig(f)
+	if err != nil {
+		return nil, err
+	}
+
+	services := make(map[string]vault.Service, len(providers))
+	for name, provider := range providers {
+		vaultAuth, err := provider.GetAzureKeyVaultCredentials()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get azure key vault credentials for credential set '%s', error: %+v", name, err)
+		}
+
+		log.Infof("Using credential set '%s' for AzureKeyVaultSecrets referencing it", name)
+		services[name] = newVaultService(vaultAuth)
+	}
+	return services, nil
+}
+
+// splitNamespaces splits a comma separated list of namespaces, ignoring empty entries
+func splitNamespaces(value string) []string {
+	var namespaces []string
+	for _, ns := range strings.Split(value, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces
+}
+
+// getShardOrdinal returns the shard owned by this replica from SHARD_ORDINAL, or from the
+// ordinal suffix of the pod name when running as a StatefulSet
+func getShardOrdinal() (int, error) {
+	if _, ok := os.LookupEnv("SHARD_ORDINAL"); ok {
+		return getEnvInt("SHARD_ORDINAL", 0)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return 0, err
+	}
+	return parseShardOrdinal(hostname)
+}
+
+func parseShardOrdinal(podName string) (int, error) {
+	i := strings.LastIndex(podName, "-")
+	if i < 0 {
+		return 0, fmt.Errorf("pod name '%s' has no ordinal suffix, set SHARD_ORDINAL", podName)
+	}
+	ordinal, err := strconv.Atoi(podName[i+1:])
+	if err != nil {
+		return 0, fmt.Errorf("pod name '%s' has no ordinal suffix, set SHARD_ORDINAL", podName)
+	}
+	return ordinal, nil
+}
+
+func serveEventGrid(handler http.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle("/api/eventgrid", handler)
+
+	var err error
+	if eventGridTLSCertFile != "" && eventGridTLSKeyFile != "" {
+		log.Infof("Listening for Azure Event Grid events on https://%s/api/eventgrid", eventGridAddress)
+		err = http.ListenAndServeTLS(eventGridAddress, eventGridTLSCertFile, eventGridTLSKeyFile, mux)
+	} else {
+		log.Infof("Listening for Azure Event Grid events on http://%s/api/eventgrid", eventGridAddress)
+		err = http.ListenAndServe(eventGridAddress, mux)
+	}
+	log.Fatalf("error serving Azure Event Grid endpoint, error: %+v", err)
+}
+
+// serveAdmin exposes the sync state of AzureKeyVaultSecrets and forcing them to sync, for tooling
+// and dashboards authenticating with ADMIN_TOKEN
+func serveAdmin(handler http.Handler) {
+	var err error
+	if adminTLSCertFile != "" && adminTLSKeyFile != "" {
+		log.Infof("Serving admin API on https://%s/api/v1/azurekeyvaultsecrets", adminAddress)
+		err = http.ListenAndServeTLS(adminAddress, adminTLSCertFile, adminTLSKeyFile, handler)
+	} else {
+		log.Infof("Serving admin API on http://%s/api/v1/azurekeyvaultsecrets", adminAddress)
+		err = http.ListenAndServe(adminAddress, handler)
+	}
+	log.Fatalf("error serving admin endpoint, error: %+v", err)
 }
 
 func init() {
 	flag.StringVar(&version, "version", "", "Version of this component.")
+	flag.StringVar(&configPath, "config", "", "Path to a YAML file of settings, keyed by flag name or env var name. Flags and env vars set explicitly override it. Reloaded on SIGHUP or when changed.")
 	flag.StringVar(&kubeconfig, "kubeconfig", "", "Path to a kubeconfig. Only required if out-of-cluster.")
 	flag.StringVar(&masterURL, "master", "", "The address of the Kubernetes API server. Overrides any value in kubeconfig. Only required if out-of-cluster.")
 	flag.StringVar(&logLevel, "log-level", "", "log level")
 	flag.StringVar(&cloudconfig, "cloudconfig", "/etc/kubernetes/azure.json", "Path to cloud config. Only required if this is not at default location /etc/kubernetes/azure.json")
+	flag.StringVar(&profileName, "profile", "small", fmt.Sprintf("Preset of worker counts, rate limits, poll intervals and cache settings for the size of the cluster, one of %s. Explicitly set flags and env vars override it.", strings.Join(profileNames(), ", ")))
+	flag.IntVar(&syncWorkers, "sync-workers", 1, "Number of workers processing each Kubernetes queue (AzureKeyVaultSecrets, Secrets, Namespaces and CA bundles).")
+	flag.IntVar(&azureWorkers, "azure-workers", 1, "Number of workers polling Azure Key Vault for changes.")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "", "Comma separated list of namespaces to handle AzureKeyVaultSecrets in. Defaults to all namespaces.")
+	flag.StringVar(&ignoreNamespaces, "ignore-namespaces", "", "Comma separated list of namespaces to never handle AzureKeyVaultSecrets in.")
+	flag.BoolVar(&dryRun, "dry-run", false, "Only report changes the controller would make to Secrets as Events and logs, without making them.")
+	flag.DurationVar(&syncRateLimiter.BaseDelay, "sync-retry-base-delay", 5*time.Millisecond, "Delay before the first retry of a failed item in the Kubernetes queues, doubling for every retry.")
+	flag.DurationVar(&syncRateLimiter.MaxDelay, "sync-retry-max-delay", 1000*time.Second, "Maximum delay before retrying a failed item in the Kubernetes queues.")
+	flag.Float64Var(&syncRateLimiter.QPS, "sync-retry-qps", 10, "Overall retries per second of failed items in each Kubernetes queue.")
+	flag.IntVar(&syncRateLimiter.Burst, "sync-retry-burst", 100, "Retries allowed above --sync-retry-qps in bursts in each Kubernetes queue.")
+	flag.DurationVar(&azureRateLimiter.BaseDelay, "azure-retry-base-delay", 5*time.Millisecond, "Delay before the first retry of a failed item in the Azure Key Vault queue, doubling for every retry.")
+	flag.DurationVar(&azureRateLimiter.MaxDelay, "azure-retry-max-delay", 1000*time.Second, "Maximum delay before retrying a failed item in the Azure Key Vault queue.")
+	flag.Float64Var(&azureRateLimiter.QPS, "azure-retry-qps", 10, "Overall retries per second of failed items in the Azure Key Vault queue.")
+	flag.IntVar(&azureRateLimiter.Burst, "azure-retry-burst", 100, "Retries allowed above --azure-retry-qps in bursts in the Azure Key Vault queue.")
+	flag.DurationVar(&resyncPeriod, "resync-period", 30*time.Second, "Period between full resyncs of the informer caches. Zero disables resyncs.")
+	flag.BoolVar(&secretResync, "secret-resync", true, "Resync Secrets every --resync-period. Disabling it saves CPU with many Secrets in the cluster.")
+	flag.Float64Var(&chaos.ErrorRate, "chaos-error-rate", 0, "For resilience testing only: fraction of requests to Azure Key Vault failing with an injected internal server error.")
+	flag.Float64Var(&chaos.ThrottleRate, "chaos-throttle-rate", 0, "For resilience testing only: fraction of requests to Azure Key Vault failing with injected throttling.")
+	flag.DurationVar(&chaos.RetryAfter, "chaos-retry-after", 10*time.Second, "For resilience testing only: Retry-After of injected throttling.")
+	flag.Float64Var(&chaos.SlowRate, "chaos-slow-rate", 0, "For resilience testing only: fraction of requests to Azure Key Vault delayed by --chaos-slow-delay.")
+	flag.DurationVar(&chaos.SlowDelay, "chaos-slow-delay", 5*time.Second, "For resilience testing only: delay of slow requests to Azure Key Vault.")
+	flag.StringVar(&crdLabelSelector, "crd-label-selector", "", "Label selector limiting which AzureKeyVaultSecrets are handled, like 'akv2k8s.io/tier=prod'. Defaults to all.")
+	flag.StringVar(&transformHooks, "transform-hooks", "", "Comma separated list of custom transforms for spec.output.transforms, as <name>=<command>. The command gets the value on stdin and writes the transformed value to stdout.")
+	flag.DurationVar(&transformHookTimeout, "transform-hook-timeout", 10*time.Second, "Time a --transform-hooks command may run before it is killed and the transform fails.")
 }
 
 func setLogFormat(logFormat string) {
+	var formatter log.Formatter = &log.TextFormatter{}
 	switch logFormat {
 	case "fmt":
-		log.SetFormatter(&log.TextFormatter{
+		formatter = &log.TextFormatter{
 			DisableColors: true,
 			FullTimestamp: true,
-		})
+		}
 	case "json":
-		log.SetFormatter(&log.JSONFormatter{})
+		formatter = &log.JSONFormatter{}
 	default:
 		log.Warnf("Log format %s not supported - using default fmt", logFormat)
 	}
+	// Secret values registered with redact.Default are never written to the log
+	log.SetFormatter(redact.NewFormatter(formatter))
 }
 
 func setLogLevel() {
@@ -227,6 +1066,13 @@ func getEnvInt(key string, fallback int) (int, error) {
 	return fallback, nil
 }
 
+func getEnvFloat(key string, fallback float64) (float64, error) {
+	if value, ok := os.LookupEnv(key); ok {
+		return strconv.ParseFloat(value, 64)
+	}
+	return fallback, nil
+}
+
 func getEnvStr(key string, fallback string) (string, error) {
 	if value, ok := os.LookupEnv(key); ok {
 		return value, nil
@@ -0,0 +1,120 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// profile is a preset of settings tuned together for a cluster size, used as defaults
+// for the flags and env vars not explicitly set
+type profile struct {
+	syncWorkers           int
+	azureWorkers          int
+	retryQPS              float64
+	retryBurst            int
+	pollInterval          time.Duration
+	slowPollInterval      time.Duration
+	cacheTTL              time.Duration
+	maxConcurrentRequests int
+	statusUpdateQPS       float64
+	statusUpdateBurst     int
+}
+
+var profiles = map[string]profile{
+	// small fits clusters with up to a few hundred AzureKeyVaultSecrets, and is the default
+	"small": {
+		syncWorkers:       1,
+		azureWorkers:      1,
+		retryQPS:          10,
+		retryBurst:        100,
+		pollInterval:      time.Minute,
+		slowPollInterval:  5 * time.Minute,
+		statusUpdateQPS:   20,
+		statusUpdateBurst: 100,
+	},
+	// medium fits clusters with a few thousand AzureKeyVaultSecrets
+	"medium": {
+		syncWorkers:           4,
+		azureWorkers:          4,
+		retryQPS:              20,
+		retryBurst:            200,
+		pollInterval:          2 * time.Minute,
+		slowPollInterval:      10 * time.Minute,
+		cacheTTL:              30 * time.Second,
+		maxConcurrentRequests: 16,
+		statusUpdateQPS:       50,
+		statusUpdateBurst:     200,
+	},
+	// large fits clusters with ten thousand or more AzureKeyVaultSecrets
+	"large": {
+		syncWorkers:           16,
+		azureWorkers:          8,
+		retryQPS:              50,
+		retryBurst:            500,
+		pollInterval:          5 * time.Minute,
+		slowPollInterval:      30 * time.Minute,
+		cacheTTL:              2 * time.Minute,
+		maxConcurrentRequests: 32,
+		statusUpdateQPS:       100,
+		statusUpdateBurst:     500,
+	},
+}
+
+// defaults are the settings of the selected profile
+var defaults = profiles["small"]
+
+// applyProfile selects the named profile, and sets the flags it covers which are not set explicitly.
+// Must be called after flag.Parse, and before reading env vars using defaults.
+func applyProfile(name string) error {
+	selected, ok := profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile '%s', must be one of %s", name, strings.Join(profileNames(), ", "))
+	}
+	defaults = selected
+
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	setDefault := func(name string, apply func()) {
+		if !explicit[name] {
+			apply()
+		}
+	}
+	setDefault("sync-workers", func() { syncWorkers = selected.syncWorkers })
+	setDefault("azure-workers", func() { azureWorkers = selected.azureWorkers })
+	setDefault("sync-retry-qps", func() { syncRateLimiter.QPS = selected.retryQPS })
+	setDefault("sync-retry-burst", func() { syncRateLimiter.Burst = selected.retryBurst })
+	setDefault("azure-retry-qps", func() { azureRateLimiter.QPS = selected.retryQPS })
+	setDefault("azure-retry-burst", func() { azureRateLimiter.Burst = selected.retryBurst })
+	return nil
+}
+
+func profileNames() []string {
+	var names []string
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
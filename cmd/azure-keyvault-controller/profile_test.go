@@ -0,0 +1,42 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+)
+
+func TestApplyProfile(t *testing.T) {
+	defer func() {
+		defaults = profiles["small"]
+		syncWorkers, azureWorkers = 1, 1
+	}()
+
+	if err := applyProfile("large"); err != nil {
+		t.Fatal(err)
+	}
+	if syncWorkers != profiles["large"].syncWorkers || azureWorkers != profiles["large"].azureWorkers {
+		t.Errorf("expected workers from large profile, got %d sync and %d azure workers", syncWorkers, azureWorkers)
+	}
+	if defaults.pollInterval != profiles["large"].pollInterval {
+		t.Errorf("expected poll interval default from large profile, got %s", defaults.pollInterval)
+	}
+
+	if err := applyProfile("huge"); err == nil {
+		t.Error("expected error for unknown profile")
+	}
+}
@@ -0,0 +1,175 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/akv2k8s"
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/credentialprovider"
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+	clientset "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/client/clientset/versioned"
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/signals"
+)
+
+var (
+	endpoint    string
+	cloudconfig string
+	logLevel    string
+	version     string
+)
+
+func main() {
+	flag.Parse()
+	akv2k8s.Version = version
+
+	logFormat, ok := os.LookupEnv("LOG_FORMAT")
+	if !ok {
+		logFormat = "fmt"
+	}
+	setLogFormat(logFormat)
+	setLogLevel()
+	akv2k8s.LogVersion()
+
+	stopCh := signals.SetupSignalHandler()
+
+	customAuth, err := strconv.ParseBool(getEnvStr("CUSTOM_AUTH", "false"))
+	if err != nil {
+		log.Fatalf("Error parsing env var CUSTOM_AUTH: %s", err.Error())
+	}
+
+	vaultAuth, err := getVaultCredentials(customAuth)
+	if err != nil {
+		log.Fatalf("failed to get azure key vault credentials, error: %+v", err)
+	}
+
+	// Kubernetes clients are used to check the AzureKeyVaultPolicies of the namespace of each pod
+	cfg, err := rest.InClusterConfig()
+	if err != nil {
+		log.Fatalf("failed to get kubernetes config, error: %+v", err)
+	}
+	kubeClient, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		log.Fatalf("failed to create kubernetes client, error: %+v", err)
+	}
+	akvsClient, err := clientset.NewForConfig(cfg)
+	if err != nil {
+		log.Fatalf("failed to create azurekeyvaultsecret client, error: %+v", err)
+	}
+
+	// Removing the socket of an earlier run, as listening fails if it exists
+	if err = os.Remove(endpoint); err != nil && !os.IsNotExist(err) {
+		log.Fatalf("failed to remove existing socket %s, error: %+v", endpoint, err)
+	}
+	listener, err := net.Listen("unix", endpoint)
+	if err != nil {
+		log.Fatalf("failed to listen on %s, error: %+v", endpoint, err)
+	}
+
+	server := grpc.NewServer()
+	v1alpha1.RegisterCSIDriverProviderServer(server, &provider{
+		vaultService: vault.NewService(vaultAuth),
+		kubeClient:   kubeClient,
+		akvsClient:   akvsClient,
+		version:      version,
+	})
+
+	go func() {
+		<-stopCh
+		log.Info("Shutting down Secrets Store CSI Driver provider")
+		server.GracefulStop()
+	}()
+
+	log.Infof("Serving Secrets Store CSI Driver provider on %s", endpoint)
+	if err = server.Serve(listener); err != nil {
+		log.Fatalf("error serving Secrets Store CSI Driver provider, error: %+v", err)
+	}
+}
+
+// getVaultCredentials loads the Azure Key Vault credentials from the environment, or from the cloud
+// config file, the same way as the controller
+func getVaultCredentials(customAuth bool) (*credentialprovider.AzureKeyVaultCredentials, error) {
+	if customAuth {
+		provider, err := credentialprovider.NewFromEnvironment()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create azure credentials provider, error: %+v", err)
+		}
+		return provider.GetAzureKeyVaultCredentials()
+	}
+
+	f, err := os.Open(cloudconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading azure config from %s, error: %+v", cloudconfig, err)
+	}
+	defer f.Close()
+
+	cloudCnfProvider, err := credentialprovider.NewFromCloudConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading azure config from %s, error: %+v", cloudconfig, err)
+	}
+	return cloudCnfProvider.GetAzureKeyVaultCredentials()
+}
+
+func getEnvStr(key string, defaultValue string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
+func init() {
+	flag.StringVar(&version, "version", "", "Version of this component.")
+	flag.StringVar(&endpoint, "endpoint", "/etc/kubernetes/secrets-store-csi-providers/akv2k8s.sock", "Path of the unix socket the Secrets Store CSI Driver connects to.")
+	flag.StringVar(&logLevel, "log-level", "", "log level")
+	flag.StringVar(&cloudconfig, "cloudconfig", "/etc/kubernetes/azure.json", "Path to cloud config. Only required if this is not at default location /etc/kubernetes/azure.json")
+}
+
+func setLogFormat(logFormat string) {
+	switch logFormat {
+	case "fmt":
+		log.SetFormatter(&log.TextFormatter{
+			DisableColors: true,
+			FullTimestamp: true,
+		})
+	case "json":
+		log.SetFormatter(&log.JSONFormatter{})
+	default:
+		log.Warnf("Log format %s not supported - using default fmt", logFormat)
+	}
+}
+
+func setLogLevel() {
+	if logLevel == "" {
+		logLevel = log.InfoLevel.String()
+	}
+
+	logrusLevel, err := log.ParseLevel(logLevel)
+	if err != nil {
+		log.Fatalf("error setting log level: %s", err.Error())
+	}
+	log.SetLevel(logrusLevel)
+}
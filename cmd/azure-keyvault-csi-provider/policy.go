@@ -0,0 +1,63 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// podNamespaceAttribute is the mount attribute set by the Secrets Store CSI Driver to the namespace of the pod
+const podNamespaceAttribute = "csi.storage.k8s.io/pod.namespace"
+
+// checkVaultPolicies returns an error if the AzureKeyVaultPolicies do not allow the namespace of the pod to
+// use the Azure Key Vaults of all the objects, like for AzureKeyVaultSecrets in the controller and webhook
+func (p *provider) checkVaultPolicies(namespace string, objects []mountObject) error {
+	if namespace == "" {
+		return fmt.Errorf("attribute '%s' not set, which is required to check azurekeyvaultpolicies", podNamespaceAttribute)
+	}
+
+	policies, err := p.akvsClient.KeyvaultV2alpha1().AzureKeyVaultPolicies().List(metav1.ListOptions{})
+	if errors.IsNotFound(err) {
+		return nil // AzureKeyVaultPolicy CRD not installed
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list azurekeyvaultpolicies, error: %+v", err)
+	}
+	if len(policies.Items) == 0 {
+		return nil
+	}
+
+	ns, err := p.kubeClient.CoreV1().Namespaces().Get(namespace, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get namespace '%s', error: %+v", namespace, err)
+	}
+
+	checked := make([]*akv.AzureKeyVaultPolicy, len(policies.Items))
+	for i := range policies.Items {
+		checked[i] = &policies.Items[i]
+	}
+	for _, object := range objects {
+		if err = akv.CheckPolicies(checked, namespace, ns.Labels, &object.Vault); err != nil {
+			return fmt.Errorf("'%s' not allowed in namespace '%s' by azurekeyvaultpolicies: %s", object.id(), namespace, err.Error())
+		}
+	}
+	return nil
+}
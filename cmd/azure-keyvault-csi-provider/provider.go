@@ -0,0 +1,223 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	clientset "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/client/clientset/versioned"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+	"sigs.k8s.io/yaml"
+)
+
+// objectsParameter is the parameter of a SecretProviderClass listing the Azure Key Vault objects to mount
+const objectsParameter = "objects"
+
+// mountObject is an Azure Key Vault object to mount, using the same vault spec as AzureKeyVaultSecret
+type mountObject struct {
+	Vault akv.AzureKeyVault `json:"vault"`
+
+	// FileName is the name of the file in the volume. Defaults to the name of the object.
+	FileName string `json:"fileName,omitempty"`
+}
+
+// id uniquely identifies the object in the volume, like secret/my-vault/my-secret
+func (o mountObject) id() string {
+	return fmt.Sprintf("%s/%s/%s", o.Vault.Object.Type, o.Vault.Name, o.Vault.Object.Name)
+}
+
+func (o mountObject) fileName() string {
+	if o.FileName != "" {
+		return o.FileName
+	}
+	return o.Vault.Object.Name
+}
+
+// provider implements the Secrets Store CSI Driver provider interface, writing Azure Key Vault
+// objects as files in the volume of a pod. The AzureKeyVaultPolicies must allow the namespace of the pod
+// to use the Azure Key Vaults, as the objects are read with the credentials of the provider.
+type provider struct {
+	vaultService vault.Service
+	kubeClient   kubernetes.Interface
+	akvsClient   clientset.Interface
+	version      string
+}
+
+// Version returns the name and version of the provider
+func (p *provider) Version(ctx context.Context, req *v1alpha1.VersionRequest) (*v1alpha1.VersionResponse, error) {
+	return &v1alpha1.VersionResponse{
+		Version:        "v1alpha1",
+		RuntimeName:    "akv2k8s",
+		RuntimeVersion: p.version,
+	}, nil
+}
+
+// Mount writes the objects of the SecretProviderClass to the target path. Objects already mounted
+// in their current version are not downloaded again, so rotation checks are cheap.
+func (p *provider) Mount(ctx context.Context, req *v1alpha1.MountRequest) (*v1alpha1.MountResponse, error) {
+	var attributes map[string]string
+	if err := json.Unmarshal([]byte(req.GetAttributes()), &attributes); err != nil {
+		return nil, fmt.Errorf("failed to parse attributes, error: %+v", err)
+	}
+
+	var permission os.FileMode
+	if err := json.Unmarshal([]byte(req.GetPermission()), &permission); err != nil {
+		return nil, fmt.Errorf("failed to parse file permission, error: %+v", err)
+	}
+
+	objects, err := parseMountObjects(attributes[objectsParameter])
+	if err != nil {
+		return nil, err
+	}
+
+	mounted := map[string]string{}
+	for _, version := range req.GetCurrentObjectVersion() {
+		mounted[version.GetId()] = version.GetVersion()
+	}
+
+	namespace := attributes[podNamespaceAttribute]
+	logger := log.WithFields(log.Fields{
+		"namespace": namespace,
+		"pod":       attributes["csi.storage.k8s.io/pod.name"],
+	})
+
+	// Checked before reading anything from Azure Key Vault, so denied objects are never read
+	if err = p.checkVaultPolicies(namespace, objects); err != nil {
+		logger.Warning(err.Error())
+		return nil, err
+	}
+
+	resp := &v1alpha1.MountResponse{}
+	for _, object := range objects {
+		objectVersion, err := p.vaultService.GetObjectVersion(&object.Vault)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get version of '%s' from Azure Key Vault, error: %+v", object.id(), err)
+		}
+		resp.ObjectVersion = append(resp.ObjectVersion, &v1alpha1.ObjectVersion{Id: object.id(), Version: objectVersion.ID})
+
+		path := filepath.Join(req.GetTargetPath(), object.fileName())
+		if mounted[object.id()] == objectVersion.ID {
+			if _, err := os.Stat(path); err == nil {
+				continue
+			}
+		}
+
+		// Getting the exact version found above, in case it changes in the meantime
+		pinned := object.Vault
+		if pinned.Object.Version == "" {
+			pinned.Object.Version = objectVersion.ID
+		}
+		content, err := p.getContent(&pinned)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get '%s' from Azure Key Vault, error: %+v", object.id(), err)
+		}
+
+		if err = writeFileAtomically(path, content, permission); err != nil {
+			return nil, fmt.Errorf("failed to write '%s' to %s, error: %+v", object.id(), path, err)
+		}
+		logger.WithFields(log.Fields{"object": object.id(), "version": objectVersion.ID}).Info("Mounted object from Azure Key Vault")
+	}
+	return resp, nil
+}
+
+// getContent returns the file content of the object. Certificates are written as the private key
+// followed by the certificate chain, both pem encoded.
+func (p *provider) getContent(vaultSpec *akv.AzureKeyVault) ([]byte, error) {
+	switch vaultSpec.Object.Type {
+	case akv.AzureKeyVaultObjectTypeSecret, akv.AzureKeyVaultObjectTypeMultiKeyValueSecret:
+		value, err := p.vaultService.GetSecret(vaultSpec)
+		return []byte(value), err
+	case akv.AzureKeyVaultObjectTypeKey:
+		value, err := p.vaultService.GetKey(vaultSpec)
+		return []byte(value), err
+	case akv.AzureKeyVaultObjectTypeCertificate:
+		cert, err := p.vaultService.GetCertificate(vaultSpec, &vault.CertificateOptions{ExportPrivateKey: true, EnsureServerFirst: true})
+		if err != nil {
+			return nil, err
+		}
+		privateKey, err := cert.ExportPrivateKeyAsPem()
+		if err != nil {
+			return nil, err
+		}
+		publicKey, err := cert.ExportPublicKeyAsPem()
+		if err != nil {
+			return nil, err
+		}
+		return append(privateKey, publicKey...), nil
+	default:
+		return nil, fmt.Errorf("object type '%s' not supported", vaultSpec.Object.Type)
+	}
+}
+
+// parseMountObjects parses the objects parameter, being a YAML or JSON list of objects
+func parseMountObjects(value string) ([]mountObject, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, fmt.Errorf("parameter '%s' must list at least one object", objectsParameter)
+	}
+
+	var objects []mountObject
+	if err := yaml.Unmarshal([]byte(value), &objects); err != nil {
+		return nil, fmt.Errorf("failed to parse parameter '%s', error: %+v", objectsParameter, err)
+	}
+
+	fileNames := map[string]bool{}
+	for _, object := range objects {
+		if object.Vault.Name == "" || object.Vault.Object.Name == "" || object.Vault.Object.Type == "" {
+			return nil, fmt.Errorf("objects must have vault name, object name and object type, got '%s'", object.id())
+		}
+		fileName := object.fileName()
+		if fileName != filepath.Base(fileName) || fileName == "." || fileName == ".." {
+			return nil, fmt.Errorf("file name '%s' of '%s' must not contain a path", fileName, object.id())
+		}
+		if fileNames[fileName] {
+			return nil, fmt.Errorf("file name '%s' is used by more than one object", fileName)
+		}
+		fileNames[fileName] = true
+	}
+	return objects, nil
+}
+
+// writeFileAtomically writes the file using a rename, so readers never see a partially written file
+func writeFileAtomically(path string, content []byte, permission os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), permission); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
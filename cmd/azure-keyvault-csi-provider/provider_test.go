@@ -0,0 +1,191 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client/fake"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	akvsfake "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/client/clientset/versioned/fake"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/secrets-store-csi-driver/provider/v1alpha1"
+)
+
+const testObjects = `
+- vault:
+    name: my-vault
+    object:
+      name: db-password
+      type: secret
+- vault:
+    name: my-vault
+    object:
+      name: api-key
+      type: secret
+  fileName: api.key
+`
+
+func mountRequest(t *testing.T, targetPath string, objects string, current []*v1alpha1.ObjectVersion) *v1alpha1.MountRequest {
+	attributes, err := json.Marshal(map[string]string{
+		objectsParameter:              objects,
+		"csi.storage.k8s.io/pod.name": "my-pod",
+		podNamespaceAttribute:         "default",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	permission, err := json.Marshal(os.FileMode(0644))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &v1alpha1.MountRequest{
+		Attributes:           string(attributes),
+		Secrets:              "{}",
+		TargetPath:           targetPath,
+		Permission:           string(permission),
+		CurrentObjectVersion: current,
+	}
+}
+
+// newProvider returns a provider using the fake vault service, with the AzureKeyVaultPolicies in the cluster
+func newProvider(vaultService *fake.Service, policies ...akv.AzureKeyVaultPolicy) *provider {
+	// The fake clientset cannot list objects of the keyvault.azure.spv.no group from its tracker
+	akvsClient := akvsfake.NewSimpleClientset()
+	akvsClient.PrependReactor("list", "azurekeyvaultpolicies", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, &akv.AzureKeyVaultPolicyList{Items: policies}, nil
+	})
+
+	return &provider{
+		vaultService: vaultService,
+		kubeClient:   k8sfake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}}),
+		akvsClient:   akvsClient,
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestMountWritesObjects(t *testing.T) {
+	targetPath, err := ioutil.TempDir("", "csi-provider")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(targetPath)
+
+	vaultService := fake.NewService()
+	passwordVersion := vaultService.SetSecret("my-vault", "db-password", "first-password")
+	vaultService.SetSecret("my-vault", "api-key", "my-api-key")
+	p := newProvider(vaultService)
+
+	resp, err := p.Mount(context.Background(), mountRequest(t, targetPath, testObjects, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if content := readFile(t, filepath.Join(targetPath, "db-password")); content != "first-password" {
+		t.Errorf("expected 'first-password', got '%s'", content)
+	}
+	if content := readFile(t, filepath.Join(targetPath, "api.key")); content != "my-api-key" {
+		t.Errorf("expected 'my-api-key', got '%s'", content)
+	}
+	if len(resp.ObjectVersion) != 2 || resp.ObjectVersion[0].Id != "secret/my-vault/db-password" || resp.ObjectVersion[0].Version != passwordVersion {
+		t.Errorf("expected object versions to be returned, got %v", resp.ObjectVersion)
+	}
+
+	// Mounting again with current versions should only download changed objects
+	downloads := vaultService.Calls("GetSecret")
+	vaultService.SetSecret("my-vault", "db-password", "second-password")
+	if _, err = p.Mount(context.Background(), mountRequest(t, targetPath, testObjects, resp.ObjectVersion)); err != nil {
+		t.Fatal(err)
+	}
+
+	if content := readFile(t, filepath.Join(targetPath, "db-password")); content != "second-password" {
+		t.Errorf("expected rotated 'second-password', got '%s'", content)
+	}
+	if calls := vaultService.Calls("GetSecret") - downloads; calls != 1 {
+		t.Errorf("expected only the rotated object to be downloaded, got %d downloads", calls)
+	}
+}
+
+func TestMountVaultPolicies(t *testing.T) {
+	tests := []struct {
+		name     string
+		vaults   []string
+		expected bool
+	}{
+		{name: "allowed", vaults: []string{"my-vault"}, expected: true},
+		{name: "denied", vaults: []string{"other-vault"}, expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			targetPath, err := ioutil.TempDir("", "csi-provider")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(targetPath)
+
+			vaultService := fake.NewService()
+			vaultService.SetSecret("my-vault", "db-password", "first-password")
+			vaultService.SetSecret("my-vault", "api-key", "my-api-key")
+			p := newProvider(vaultService, akv.AzureKeyVaultPolicy{
+				ObjectMeta: metav1.ObjectMeta{Name: "team-a"},
+				Spec:       akv.AzureKeyVaultPolicySpec{Namespaces: []string{"default"}, Vaults: test.vaults},
+			})
+
+			_, err = p.Mount(context.Background(), mountRequest(t, targetPath, testObjects, nil))
+			if allowed := err == nil; allowed != test.expected {
+				t.Fatalf("expected mount allowed to be %t, got error %v", test.expected, err)
+			}
+			if !test.expected && vaultService.Calls("GetObjectVersion")+vaultService.Calls("GetSecret") != 0 {
+				t.Error("expected nothing to be read from a denied Azure Key Vault")
+			}
+		})
+	}
+}
+
+func TestParseMountObjectsRejectsInvalidObjects(t *testing.T) {
+	tests := map[string]string{
+		"empty":          "",
+		"missing type":   "- vault: {name: my-vault, object: {name: my-secret}}",
+		"path traversal": "- vault: {name: my-vault, object: {name: my-secret, type: secret}}\n  fileName: ../etc/passwd",
+		"duplicate file": "- vault: {name: a, object: {name: my-secret, type: secret}}\n- vault: {name: b, object: {name: my-secret, type: secret}}",
+	}
+
+	for name, objects := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseMountObjects(objects); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright © 2020 Sparebanken Vest
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	clientset "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/client/clientset/versioned"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// certificateQuerySplit writes a certificate as separate tls.crt, tls.key and ca.crt files
+const certificateQuerySplit = "split"
+
+// fileMode is the mode of written files, same as the default of Kubernetes Secret volumes
+const fileMode os.FileMode = 0644
+
+// fileObject is a AzureKeyVaultSecret to write to a file, declared as
+// [<file name>=]<azurekeyvaultsecret name or <vault>/<type>/<object> reference>[?<query>]
+type fileObject struct {
+	fileName   string
+	secretName string
+	query      string
+}
+
+// parseFileObjects parses a comma separated list of files to write
+func parseFileObjects(files string) ([]fileObject, error) {
+	var objects []fileObject
+	fileNames := map[string]bool{}
+
+	for _, declaration := range strings.Split(files, ",") {
+		declaration = strings.TrimSpace(declaration)
+		if declaration == "" {
+			continue
+		}
+
+		var object fileObject
+		secretName := declaration
+		if split := strings.SplitN(declaration, "=", 2); len(split) == 2 {
+			object.fileName = split[0]
+			secretName = split[1]
+		}
+
+		query := strings.Split(secretName, "?")
+		if len(query) > 2 {
+			return nil, fmt.Errorf("file '%s' has multiple query elements defined with '?' - only one supported", declaration)
+		}
+		object.secretName = query[0]
+		if len(query) == 2 {
+			object.query = query[1]
+		}
+
+		if object.secretName == "" {
+			return nil, fmt.Errorf("file '%s' has no azurekeyvaultsecret name", declaration)
+		}
+		if object.fileName == "" {
+			object.fileName = object.secretName
+			if isObjectReference(object.secretName) {
+				object.fileName = filepath.Base(object.secretName)
+			}
+		}
+		if object.fileName != filepath.Base(object.fileName) || object.fileName == "." || object.fileName == ".." {
+			return nil, fmt.Errorf("file name '%s' must not be a path", object.fileName)
+		}
+		if fileNames[object.fileName] {
+			return nil, fmt.Errorf("file name '%s' is declared more than once", object.fileName)
+		}
+		fileNames[object.fileName] = true
+
+		objects = append(objects, object)
+	}
+
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("no files declared")
+	}
+	return objects, nil
+}
+
+// writeFiles gets the value of each AzureKeyVaultSecret from Azure Key Vault and writes it to its
+// file in dir, unless the file already has that value. Returns true if any file was written.
+func writeFiles(dir string, objects []fileObject, azureKeyVaultSecretClient clientset.Interface, vaultService vault.Service) (bool, error) {
+	changed := false
+	for _, object := range objects {
+		azureKeyVaultSecret, err := getAzureKeyVaultSecret(azureKeyVaultSecretClient, object.secretName)
+		if err != nil {
+			return changed, err
+		}
+
+		files, err := getFileContents(azureKeyVaultSecret, object, vaultService)
+		if err != nil {
+			return changed, err
+		}
+
+		for fileName, content := range files {
+			path := filepath.Join(dir, fileName)
+			if current, err := ioutil.ReadFile(path); err == nil && string(current) == content {
+				logger.Debugf("file %s already has the value of secret %s", fileName, azureKeyVaultSecret.Spec.Vault.Object.Name)
+				continue
+			}
+
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return changed, fmt.Errorf("failed to create directory for file '%s', error: %+v", fileName, err)
+			}
+			if err := writeFileAtomically(path, []byte(content)); err != nil {
+				return changed, fmt.Errorf("failed to write file '%s', error: %+v", fileName, err)
+			}
+			changed = true
+			logger.Infof("secret %s written to file %s", azureKeyVaultSecret.Spec.Vault.Object.Name, fileName)
+		}
+	}
+	return changed, nil
+}
+
+// getFileContents gets the value of a AzureKeyVaultSecret from Azure Key Vault, by file name. A
+// certificate with the split query is split into tls.crt, tls.key and ca.crt files in a directory
+// named by the file name, like a Kubernetes TLS Secret mounted as a volume.
+func getFileContents(azureKeyVaultSecret *akv.AzureKeyVaultSecret, object fileObject, vaultService vault.Service) (map[string]string, error) {
+	objectName := azureKeyVaultSecret.Spec.Vault.Object.Name
+	logger.Debugf("getting secret value for '%s' from azure key vault, to write to file %s", objectName, object.fileName)
+
+	if object.query != certificateQuerySplit {
+		secret, err := getSecretFromKeyVault(azureKeyVaultSecret, object.query, vaultService)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secret '%s', error %+v", objectName, err)
+		}
+
+		if secret == "" {
+			return nil, fmt.Errorf("secret not found in azure key vault: %s", objectName)
+		}
+		return map[string]string{object.fileName: secret}, nil
+	}
+
+	if azureKeyVaultSecret.Spec.Vault.Object.Type != akv.AzureKeyVaultObjectTypeCertificate {
+		return nil, fmt.Errorf("query '%s' only supported for azure key vault object type '%s'", certificateQuerySplit, akv.AzureKeyVaultObjectTypeCertificate)
+	}
+
+	cert, err := vaultService.GetCertificate(&azureKeyVaultSecret.Spec.Vault, &vault.CertificateOptions{
+		ExportPrivateKey:  true,
+		EnsureServerFirst: azureKeyVaultSecret.Spec.Output.Secret.ChainOrder == "ensureserverfirst",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate '%s', error %+v", objectName, err)
+	}
+
+	pubKey, err := cert.ExportPublicKeyAsPem()
+	if err != nil {
+		return nil, err
+	}
+	privKey, err := cert.ExportPrivateKeyAsPem()
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]string{
+		filepath.Join(object.fileName, corev1.TLSCertKey):       string(pubKey),
+		filepath.Join(object.fileName, corev1.TLSPrivateKeyKey): string(privKey),
+	}
+	if caCerts := cert.ExportCACertificatesAsPem(); len(caCerts) > 0 {
+		files[filepath.Join(object.fileName, certificateQueryCA)] = string(caCerts)
+	}
+	return files, nil
+}
+
+// writeFileAtomically writes data to a temporary file renamed to path, so readers never see a partially written file
+func writeFileAtomically(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), fileMode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -26,7 +26,9 @@ import (
 	"time"
 
 	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/akv2k8s"
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/akv2k8s/redact"
 	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/akv2k8s/transformers"
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/credentialprovider"
 	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
 	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
 	clientset "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/client/clientset/versioned"
@@ -51,6 +53,13 @@ type injectorConfig struct {
 	caCert                 string
 	signatureB64           string
 	pubKeyBase64           string
+	azureHTTPSProxy        string
+	azureCABundleFile      string
+	files                  string
+	filesDir               string
+	filesRefreshInterval   time.Duration
+	filesSignal            string
+	filesSignalProcess     string
 }
 
 var config injectorConfig
@@ -61,17 +70,20 @@ type stop struct {
 }
 
 func formatLogger(logFormat string) {
+	var formatter log.Formatter = &log.TextFormatter{}
 	switch logFormat {
 	case "fmt":
-		log.SetFormatter(&log.TextFormatter{
+		formatter = &log.TextFormatter{
 			DisableColors: true,
 			FullTimestamp: true,
-		})
+		}
 	case "json":
-		log.SetFormatter(&log.JSONFormatter{})
+		formatter = &log.JSONFormatter{}
 	default:
 		log.Warnf("Log format %s not supported - using default fmt", logFormat)
 	}
+	// Secret values registered with redact.Default are never written to the log
+	log.SetFormatter(redact.NewFormatter(formatter))
 
 	logger = log.WithFields(log.Fields{
 		"component":   "akv2k8s",
@@ -119,6 +131,117 @@ func getSecretFromKeyVault(azureKeyVaultSecret *akv.AzureKeyVaultSecret, query s
 	return secretHandler.Handle()
 }
 
+// newVaultService creates a Azure Key Vault service using the configured https proxy and ca bundle
+func newVaultService(creds *credentialprovider.AzureKeyVaultCredentials) (vault.Service, error) {
+	if config.azureHTTPSProxy == "" && config.azureCABundleFile == "" {
+		return vault.NewService(creds), nil
+	}
+
+	httpClient, err := vault.NewHTTPClient(config.azureHTTPSProxy, config.azureCABundleFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create http client for azure, error: %+v", err)
+	}
+
+	if creds.Token != nil {
+		creds.Token.SetSender(httpClient)
+	}
+	return vault.NewServiceWithSender(creds, httpClient), nil
+}
+
+// isObjectReference returns true if secretName is a <vault>/<type>/<object> reference declared in pod
+// annotations, rather than the name of a AzureKeyVaultSecret resource
+func isObjectReference(secretName string) bool {
+	return strings.Contains(secretName, "/")
+}
+
+// newObjectReferenceSecret creates a AzureKeyVaultSecret for a <vault>/<type>/<object> reference
+func newObjectReferenceSecret(reference string) (*akv.AzureKeyVaultSecret, error) {
+	split := strings.Split(reference, "/")
+	if len(split) != 3 || split[0] == "" || split[2] == "" {
+		return nil, fmt.Errorf("azure key vault object reference '%s' must be formatted as <vault>/<type>/<object>", reference)
+	}
+
+	objectType := akv.AzureKeyVaultObjectType(split[1])
+	switch objectType {
+	case akv.AzureKeyVaultObjectTypeSecret, akv.AzureKeyVaultObjectTypeCertificate, akv.AzureKeyVaultObjectTypeKey:
+	default:
+		return nil, fmt.Errorf("azure key vault object type '%s' in reference '%s' not supported", objectType, reference)
+	}
+
+	return &akv.AzureKeyVaultSecret{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      reference,
+			Namespace: config.namespace,
+		},
+		Spec: akv.AzureKeyVaultSecretSpec{
+			Vault: akv.AzureKeyVault{
+				Name: split[0],
+				Object: akv.AzureKeyVaultObject{
+					Name: split[2],
+					Type: objectType,
+				},
+			},
+		},
+	}, nil
+}
+
+// getAzureKeyVaultSecret gets a AzureKeyVaultSecret resource from kubernetes, retrying on failure.
+// Object references declared in pod annotations are used as is.
+func getAzureKeyVaultSecret(azureKeyVaultSecretClient clientset.Interface, secretName string) (*akv.AzureKeyVaultSecret, error) {
+	if isObjectReference(secretName) {
+		return newObjectReferenceSecret(secretName)
+	}
+
+	logger.Debugf("getting azurekeyvaultsecret resource '%s' from kubernetes", secretName)
+	keyVaultSecretSpec, err := azureKeyVaultSecretClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(config.namespace).Get(secretName, v1.GetOptions{})
+	if err != nil {
+		logger.Warnf("failed to get azurekeyvaultsecret resource '%s', error: %s", secretName, err.Error())
+		logger.Infof("will retry getting azurekeyvaultsecret resource up to %d times, waiting %d seconds between retries", config.retryTimes, config.waitTimeBetweenRetries)
+
+		err = retry(config.retryTimes, time.Second*time.Duration(config.waitTimeBetweenRetries), func() error {
+			keyVaultSecretSpec, err = azureKeyVaultSecretClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(config.namespace).Get(secretName, v1.GetOptions{})
+			if err != nil {
+				logger.Errorf("error getting azurekeyvaultsecret resource '%s', error: %+v", secretName, err)
+				return err
+			}
+			logger.Infof("succeded getting azurekeyvaultsecret resource '%s'", secretName)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error getting azurekeyvaultsecret resource '%s', error: %s", secretName, err.Error())
+		}
+	}
+	return applyVaultDefaults(azureKeyVaultSecretClient, keyVaultSecretSpec)
+}
+
+// applyVaultDefaults sets the Azure Key Vault settings the AzureKeyVaultSecret does not set to the
+// AzureKeyVaultDefault of the namespace. AzureKeyVaultDefaults that can not be read, like when not
+// allowed to list them, are only an error if the AzureKeyVaultSecret has no Azure Key Vault name.
+func applyVaultDefaults(azureKeyVaultSecretClient clientset.Interface, azureKeyVaultSecret *akv.AzureKeyVaultSecret) (*akv.AzureKeyVaultSecret, error) {
+	defaults, err := azureKeyVaultSecretClient.KeyvaultV2alpha1().AzureKeyVaultDefaults(config.namespace).List(v1.ListOptions{})
+	if err != nil {
+		logger.Debugf("failed to list azurekeyvaultdefault resources, error: %+v", err)
+		if azureKeyVaultSecret.Spec.Vault.Name == "" {
+			return nil, fmt.Errorf("azurekeyvaultsecret resource '%s' has no azure key vault name and azurekeyvaultdefault resources could not be listed, error: %+v", azureKeyVaultSecret.Name, err)
+		}
+		return azureKeyVaultSecret, nil
+	}
+
+	switch len(defaults.Items) {
+	case 0:
+	case 1:
+		logger.Debugf("using azurekeyvaultdefault resource '%s' for azurekeyvaultsecret resource '%s'", defaults.Items[0].Name, azureKeyVaultSecret.Name)
+		defaults.Items[0].Spec.Vault.ApplyTo(&azureKeyVaultSecret.Spec.Vault)
+	default:
+		return nil, fmt.Errorf("namespace '%s' has %d azurekeyvaultdefault resources, but only one is allowed", config.namespace, len(defaults.Items))
+	}
+
+	if azureKeyVaultSecret.Spec.Vault.Name == "" {
+		return nil, fmt.Errorf("azurekeyvaultsecret resource '%s' has no azure key vault name, and no azurekeyvaultdefault resource in namespace '%s' has one", azureKeyVaultSecret.Name, config.namespace)
+	}
+	return azureKeyVaultSecret, nil
+}
+
 func initConfig() {
 	viper.SetDefault("env_injector_retries", 3)
 	viper.SetDefault("env_injector_wait_before_retry", 3)
@@ -127,6 +250,8 @@ func initConfig() {
 	viper.SetDefault("env_injector_skip_args_validation", false)
 	viper.SetDefault("env_injector_log_level", "Info")
 	viper.SetDefault("env_injector_log_format", "fmt")
+	viper.SetDefault("env_injector_fips_mode", false)
+	viper.SetDefault("env_injector_files_dir", "/azure-keyvault-files/")
 	viper.AutomaticEnv()
 }
 
@@ -155,6 +280,7 @@ func main() {
 	initConfig()
 
 	akv2k8s.Version = viper.GetString("version")
+	akv2k8s.EnableFIPS(viper.GetBool("env_injector_fips_mode"))
 
 	var origCommand string
 	var origArgs []string
@@ -179,13 +305,24 @@ func main() {
 		caCert:                 viper.GetString("env_injector_ca_cert"),
 		signatureB64:           viper.GetString("env_injector_args_signature"),
 		pubKeyBase64:           viper.GetString("env_injector_args_key"),
+		azureHTTPSProxy:        viper.GetString("env_injector_azure_https_proxy"),
+		azureCABundleFile:      viper.GetString("env_injector_azure_ca_bundle_file"),
+		files:                  viper.GetString("env_injector_files"),
+		filesDir:               viper.GetString("env_injector_files_dir"),
+		filesRefreshInterval:   viper.GetDuration("env_injector_files_refresh_interval"),
+		filesSignal:            viper.GetString("env_injector_files_signal"),
+		filesSignalProcess:     viper.GetString("env_injector_files_signal_process"),
 	}
 
 	requiredEnvVars := map[string]string{
-		"env_injector_auth_service":   config.authServiceAddress,
-		"env_injector_ca_cert":        config.caCert,
-		"env_injector_args_signature": config.signatureB64,
-		"env_injector_args_key":       config.pubKeyBase64,
+		"env_injector_auth_service": config.authServiceAddress,
+		"env_injector_ca_cert":      config.caCert,
+	}
+
+	// In files mode there is no original command with arguments to validate
+	if config.files == "" {
+		requiredEnvVars["env_injector_args_signature"] = config.signatureB64
+		requiredEnvVars["env_injector_args_key"] = config.pubKeyBase64
 	}
 
 	err = validateConfig(requiredEnvVars)
@@ -203,7 +340,20 @@ func main() {
 		logger.Debug("akv2k8s auth service not enabled - will look for azure key vault credentials locally")
 	}
 
-	if len(os.Args) == 1 {
+	var fileObjects []fileObject
+	if config.files != "" {
+		fileObjects, err = parseFileObjects(config.files)
+		if err != nil {
+			logger.Fatalf("failed to parse files to write, error: %+v", err)
+		}
+		if _, err := parseSignal(config.filesSignal); err != nil {
+			logger.Fatal(err)
+		}
+		if config.filesSignal != "" && config.filesSignalProcess == "" {
+			logger.Fatal("environment variable ENV_INJECTOR_FILES_SIGNAL_PROCESS not provided or empty")
+		}
+		logger.Infof("writing azure key vault secrets to files in %s", config.filesDir)
+	} else if len(os.Args) == 1 {
 		logger.Fatal("no command is given, currently vault-env can't determine the entrypoint (command), please specify it explicitly")
 	} else {
 		origCommand, err = exec.LookPath(os.Args[1])
@@ -237,7 +387,10 @@ func main() {
 		}
 	}
 
-	vaultService := vault.NewService(creds)
+	vaultService, err := newVaultService(creds)
+	if err != nil {
+		logger.Fatal(err)
+	}
 
 	logger.Debug("reading azurekeyvaultsecret's referenced in env variables")
 	cfg, err := rest.InClusterConfig()
@@ -250,6 +403,18 @@ func main() {
 		logger.Fatalf("error building azurekeyvaultsecret clientset: %+v", err)
 	}
 
+	if config.files != "" {
+		if config.filesRefreshInterval > 0 {
+			refreshFiles(config.filesDir, fileObjects, azureKeyVaultSecretClient)
+		}
+
+		if _, err := writeFiles(config.filesDir, fileObjects, azureKeyVaultSecretClient, vaultService); err != nil {
+			logger.Fatalf("failed to write files, error: %+v", err)
+		}
+		logger.Info("azure key vault env injector successfully wrote secrets to files")
+		return
+	}
+
 	environ := os.Environ()
 
 	for i, env := range environ {
@@ -277,24 +442,9 @@ func main() {
 				logger.Debugf("found query in env var '%s', '%s'", value, secretQuery)
 			}
 
-			logger.Debugf("getting azurekeyvaultsecret resource '%s' from kubernetes", secretName)
-			keyVaultSecretSpec, err := azureKeyVaultSecretClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(config.namespace).Get(secretName, v1.GetOptions{})
+			keyVaultSecretSpec, err := getAzureKeyVaultSecret(azureKeyVaultSecretClient, secretName)
 			if err != nil {
-				logger.Warnf("failed to get azurekeyvaultsecret resource '%s', error: %s", secretName, err.Error())
-				logger.Infof("will retry getting azurekeyvaultsecret resource up to %d times, waiting %d seconds between retries", config.retryTimes, config.waitTimeBetweenRetries)
-
-				err = retry(config.retryTimes, time.Second*time.Duration(config.waitTimeBetweenRetries), func() error {
-					keyVaultSecretSpec, err = azureKeyVaultSecretClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(config.namespace).Get(secretName, v1.GetOptions{})
-					if err != nil {
-						logger.Errorf("error getting azurekeyvaultsecret resource '%s', error: %+v", secretName, err)
-						return err
-					}
-					logger.Infof("succeded getting azurekeyvaultsecret resource '%s'", secretName)
-					return nil
-				})
-				if err != nil {
-					logger.Fatalf("error getting azurekeyvaultsecret resource '%s', error: %s", secretName, err.Error())
-				}
+				logger.Fatal(err)
 			}
 
 			logger.Debugf("getting secret value for '%s' from azure key vault, to inject into env var %s", keyVaultSecretSpec.Spec.Vault.Object.Name, name)
@@ -302,6 +452,7 @@ func main() {
 			if err != nil {
 				logger.Fatalf("failed to read secret '%s', error %+v", keyVaultSecretSpec.Spec.Vault.Object.Name, err)
 			}
+			redact.Default.Set(name, []byte(secret))
 
 			if secret == "" {
 				logger.Fatalf("secret not found in azure key vault: %s", keyVaultSecretSpec.Spec.Vault.Object.Name)
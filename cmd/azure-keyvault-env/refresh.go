@@ -0,0 +1,140 @@
+// Copyright © 2020 Sparebanken Vest
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	clientset "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/client/clientset/versioned"
+)
+
+// signals supported for notifying the main container process about changed files
+var signals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"TERM": syscall.SIGTERM,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+// parseSignal parses a signal name like SIGHUP or HUP. Returns 0 if name is empty.
+func parseSignal(name string) (syscall.Signal, error) {
+	if name == "" {
+		return 0, nil
+	}
+
+	sig, ok := signals[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !ok {
+		return 0, fmt.Errorf("signal '%s' not supported", name)
+	}
+	return sig, nil
+}
+
+// refreshFiles keeps the files up to date with Azure Key Vault, refreshing them on every
+// interval or when receiving SIGHUP, and signals the main container process when any file
+// changed. Runs as a sidecar and never returns.
+func refreshFiles(dir string, objects []fileObject, azureKeyVaultSecretClient clientset.Interface) {
+	sig, _ := parseSignal(config.filesSignal)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	ticker := time.NewTicker(config.filesRefreshInterval)
+	defer ticker.Stop()
+
+	logger.Infof("refreshing files in %s every %s", dir, config.filesRefreshInterval)
+	for {
+		changed, err := refreshFilesOnce(dir, objects, azureKeyVaultSecretClient)
+		if err != nil {
+			logger.Errorf("failed to refresh files, will retry in %s, error: %+v", config.filesRefreshInterval, err)
+		}
+
+		if changed && sig != 0 {
+			if err := signalProcess(config.filesSignalProcess, sig); err != nil {
+				logger.Errorf("failed to signal process '%s', error: %+v", config.filesSignalProcess, err)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-hup:
+			logger.Info("received SIGHUP, refreshing files")
+		}
+	}
+}
+
+// refreshFilesOnce writes the files using fresh credentials, as credentials from the auth
+// service expire
+func refreshFilesOnce(dir string, objects []fileObject, azureKeyVaultSecretClient clientset.Interface) (bool, error) {
+	creds, err := getCredentials(config.useAuthService, config.authServiceAddress, config.caCert)
+	if err != nil {
+		return false, err
+	}
+
+	vaultService, err := newVaultService(creds)
+	if err != nil {
+		return false, err
+	}
+
+	return writeFiles(dir, objects, azureKeyVaultSecretClient, vaultService)
+}
+
+// signalProcess sends sig to all processes with the executable name, which are visible to the
+// sidecar when the pod shares its process namespace
+func signalProcess(name string, sig syscall.Signal) error {
+	procs, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return err
+	}
+
+	signalled := 0
+	for _, proc := range procs {
+		pid, err := strconv.Atoi(proc.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+
+		cmdline, err := ioutil.ReadFile(filepath.Join("/proc", proc.Name(), "cmdline"))
+		if err != nil || len(cmdline) == 0 {
+			continue
+		}
+
+		executable := string(bytes.SplitN(cmdline, []byte{0}, 2)[0])
+		if filepath.Base(executable) != name {
+			continue
+		}
+
+		if err := syscall.Kill(pid, sig); err != nil {
+			return fmt.Errorf("failed to send %s to process %d, error: %+v", sig, pid, err)
+		}
+		logger.Infof("sent %s to process '%s' (%d)", sig, name, pid)
+		signalled++
+	}
+
+	if signalled == 0 {
+		return fmt.Errorf("no process named '%s' found - is shareProcessNamespace enabled for the pod?", name)
+	}
+	return nil
+}
@@ -29,6 +29,17 @@ import (
 	corev1 "k8s.io/api/core/v1"
 )
 
+const (
+	// certificateQueryServer gets the server certificate of a certificate chain, without the ca certificates
+	certificateQueryServer = "server.crt"
+
+	// certificateQueryCA gets the ca certificates of a certificate chain
+	certificateQueryCA = "ca.crt"
+
+	// certificateQueryBundle gets the private key followed by the certificate chain
+	certificateQueryBundle = "bundle"
+)
+
 // EnvSecretHandler handles getting and formatting secrets from Azure Key Vault to environment variables
 type EnvSecretHandler interface {
 	Handle() (string, error)
@@ -137,7 +148,7 @@ func (h *AzureKeyVaultSecretHandler) Handle() (string, error) {
 // Handle getting and formating Azure Key Vault Certificate from Azure Key Vault to Kubernetes
 func (h *AzureKeyVaultCertificateHandler) Handle() (string, error) {
 	options := vault.CertificateOptions{
-		ExportPrivateKey:  h.query == corev1.TLSPrivateKeyKey,
+		ExportPrivateKey:  h.query == corev1.TLSPrivateKeyKey || h.query == certificateQueryBundle,
 		EnsureServerFirst: h.secretSpec.Spec.Output.Secret.ChainOrder == "ensureserverfirst",
 	}
 
@@ -147,21 +158,37 @@ func (h *AzureKeyVaultCertificateHandler) Handle() (string, error) {
 		return "", err
 	}
 
-	if h.query == "raw" {
+	switch h.query {
+	case "raw":
 		return string(cert.ExportRaw()), nil
-	}
-
-	var privKey []byte
-	var pubKey []byte
-
-	if options.ExportPrivateKey {
-		if privKey, err = cert.ExportPrivateKeyAsPem(); err != nil {
+	case corev1.TLSPrivateKeyKey:
+		privKey, err := cert.ExportPrivateKeyAsPem()
+		if err != nil {
 			return "", err
 		}
 		return string(privKey), nil
+	case certificateQueryServer:
+		serverCert, err := cert.ExportServerCertificateAsPem()
+		if err != nil {
+			return "", err
+		}
+		return string(serverCert), nil
+	case certificateQueryCA:
+		return string(cert.ExportCACertificatesAsPem()), nil
+	case certificateQueryBundle:
+		privKey, err := cert.ExportPrivateKeyAsPem()
+		if err != nil {
+			return "", err
+		}
+		pubKey, err := cert.ExportPublicKeyAsPem()
+		if err != nil {
+			return "", err
+		}
+		return string(privKey) + string(pubKey), nil
 	}
 
-	if pubKey, err = cert.ExportPublicKeyAsPem(); err != nil {
+	pubKey, err := cert.ExportPublicKeyAsPem()
+	if err != nil {
 		return "", err
 	}
 	return string(pubKey), nil
@@ -193,11 +220,13 @@ func (h *AzureKeyVaultMultiValueSecretHandler) Handle() (string, error) {
 	switch h.secretSpec.Spec.Vault.Object.ContentType {
 	case akv.AzureKeyVaultObjectContentTypeJSON:
 		if err := json.Unmarshal([]byte(secret), &dat); err != nil {
-			return "", err
+			// The parser error can quote the secret, so it is left out
+			return "", fmt.Errorf("secret '%s' is not a valid JSON map of key values", h.secretSpec.Spec.Vault.Object.Name)
 		}
 	case akv.AzureKeyVaultObjectContentTypeYaml:
 		if err := yaml.Unmarshal([]byte(secret), &dat); err != nil {
-			return "", err
+			// The parser error can quote the secret, so it is left out
+			return "", fmt.Errorf("secret '%s' is not a valid YAML map of key values", h.secretSpec.Spec.Vault.Object.Name)
 		}
 	default:
 		return "", fmt.Errorf("content type '%s' not supported", h.secretSpec.Spec.Vault.Object.ContentType)
@@ -0,0 +1,134 @@
+// Copyright © 2020 Sparebanken Vest
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// vaultAnnotation is the name of the Azure Key Vault to inject objects from, as an alternative to
+	// referencing AzureKeyVaultSecret resources in env vars, for pods of charts that cannot be edited
+	vaultAnnotation = "keyvault.azure.spv.no/vault"
+
+	// objectsAnnotation lists the objects to inject from the vault, as comma separated
+	// [<type>/]<object name>[?<query>], where type is secret (default), certificate or key
+	objectsAnnotation = "keyvault.azure.spv.no/objects"
+
+	// envPrefixAnnotation is prepended to the env var names the objects are injected into. The env
+	// var name is the object name in upper case, with dashes replaced by underscores.
+	envPrefixAnnotation = "keyvault.azure.spv.no/env-prefix"
+
+	// targetPathAnnotation makes the objects be injected as files in this path instead of env vars
+	targetPathAnnotation = "keyvault.azure.spv.no/target-path"
+)
+
+// annotationObject is a object declared in the objects annotation
+type annotationObject struct {
+	name string
+	// reference is the <vault>/<type>/<object name>[?<query>] reference the env-injector gets the object by
+	reference string
+}
+
+// getAnnotationObjects returns the objects declared in the pod annotations, or nil if the pod has none
+func getAnnotationObjects(pod *corev1.Pod) ([]annotationObject, error) {
+	vault := pod.Annotations[vaultAnnotation]
+	objects := pod.Annotations[objectsAnnotation]
+	if vault == "" && objects == "" {
+		return nil, nil
+	}
+	if vault == "" || objects == "" {
+		return nil, fmt.Errorf("annotations %s and %s must both be set", vaultAnnotation, objectsAnnotation)
+	}
+
+	var result []annotationObject
+	for _, object := range strings.Split(objects, ",") {
+		object = strings.TrimSpace(object)
+		if object == "" {
+			continue
+		}
+
+		objectType := "secret"
+		if split := strings.SplitN(object, "/", 2); len(split) == 2 {
+			objectType = split[0]
+			object = split[1]
+		}
+
+		switch objectType {
+		case "secret", "certificate", "key":
+		default:
+			return nil, fmt.Errorf("object type '%s' in annotation %s not supported", objectType, objectsAnnotation)
+		}
+
+		name := strings.SplitN(object, "?", 2)[0]
+		if name == "" || strings.Contains(object, "/") {
+			return nil, fmt.Errorf("object '%s' in annotation %s is not valid", object, objectsAnnotation)
+		}
+
+		result = append(result, annotationObject{
+			name:      name,
+			reference: path.Join(vault, objectType, object),
+		})
+	}
+	return result, nil
+}
+
+// objectEnvVarName returns the name of the env var to inject a object into
+func objectEnvVarName(prefix, name string) string {
+	return prefix + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+}
+
+// mutatePodAnnotations injects the objects declared in the pod annotations into env vars of all
+// containers, to be picked up as any other env var referencing Azure Key Vault. When a target
+// path is set, the objects are instead declared as files to inject.
+func mutatePodAnnotations(pod *corev1.Pod) error {
+	objects, err := getAnnotationObjects(pod)
+	if err != nil || len(objects) == 0 {
+		return err
+	}
+
+	if targetPath := pod.Annotations[targetPathAnnotation]; targetPath != "" {
+		if pod.Annotations[injectFilesAnnotation] != "" {
+			return fmt.Errorf("annotations %s and %s cannot both be set", targetPathAnnotation, injectFilesAnnotation)
+		}
+
+		var references []string
+		for _, object := range objects {
+			references = append(references, object.reference)
+		}
+		log.Infof("found objects in annotations to inject as files in '%s'", targetPath)
+		pod.Annotations[injectFilesAnnotation] = strings.Join(references, ",")
+		pod.Annotations[injectFilesPathAnnotation] = targetPath
+		return nil
+	}
+
+	prefix := pod.Annotations[envPrefixAnnotation]
+	for i := range pod.Spec.Containers {
+		for _, object := range objects {
+			name := objectEnvVarName(prefix, object.name)
+			log.Infof("injecting object '%s' from annotations into env var %s in container %s", object.reference, name, pod.Spec.Containers[i].Name)
+			pod.Spec.Containers[i].Env = append(pod.Spec.Containers[i].Env, corev1.EnvVar{
+				Name:  name,
+				Value: object.reference + envVarReplacementKey,
+			})
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMutatePodAnnotationsInjectsEnvVars(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				vaultAnnotation:     "my-vault",
+				objectsAnnotation:   "db-password, certificate/my-cert?tls.key",
+				envPrefixAnnotation: "APP_",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app"}},
+		},
+	}
+
+	if err := mutatePodAnnotations(pod); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []corev1.EnvVar{
+		{Name: "APP_DB_PASSWORD", Value: "my-vault/secret/db-password@azurekeyvault"},
+		{Name: "APP_MY_CERT", Value: "my-vault/certificate/my-cert?tls.key@azurekeyvault"},
+	}
+	env := pod.Spec.Containers[0].Env
+	if len(env) != len(expected) {
+		t.Fatalf("expected env vars %+v, got %+v", expected, env)
+	}
+	for i := range expected {
+		if env[i] != expected[i] {
+			t.Errorf("expected env var %+v, got %+v", expected[i], env[i])
+		}
+	}
+}
+
+func TestMutatePodAnnotationsInjectsFiles(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				vaultAnnotation:      "my-vault",
+				objectsAnnotation:    "db-password,key/my-key",
+				targetPathAnnotation: "/secrets",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app"}},
+		},
+	}
+
+	if err := mutatePodAnnotations(pod); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pod.Spec.Containers[0].Env) != 0 {
+		t.Errorf("expected no env vars when injecting files, got %+v", pod.Spec.Containers[0].Env)
+	}
+	if files := pod.Annotations[injectFilesAnnotation]; files != "my-vault/secret/db-password,my-vault/key/my-key" {
+		t.Errorf("expected objects to be declared as files, got '%s'", files)
+	}
+	if path := pod.Annotations[injectFilesPathAnnotation]; path != "/secrets" {
+		t.Errorf("expected files path /secrets, got '%s'", path)
+	}
+}
+
+func TestMutatePodAnnotationsRejectsInvalidObjects(t *testing.T) {
+	for _, annotations := range []map[string]string{
+		{vaultAnnotation: "my-vault"},
+		{objectsAnnotation: "db-password"},
+		{vaultAnnotation: "my-vault", objectsAnnotation: "blob/db-password"},
+		{vaultAnnotation: "my-vault", objectsAnnotation: "secret/nested/db-password"},
+	} {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: annotations}}
+		if err := mutatePodAnnotations(pod); err == nil {
+			t.Errorf("expected error for annotations %+v", annotations)
+		}
+	}
+}
@@ -16,12 +16,12 @@ type podData struct {
 }
 
 func authorize(clientset kubernetes.Interface, podData podData) error {
-	ns, err := clientset.CoreV1().Namespaces().Get(podData.namespace, metav1.GetOptions{})
+	enabled, err := isInjectionEnabled(clientset, podData.namespace, config.excludedNamespaces)
 	if err != nil {
-		return fmt.Errorf("failed to get namespace '%s', error: %+v", podData.namespace, err)
+		return err
 	}
 
-	if ns.Labels["azure-key-vault-env-injection"] != "enabled" {
+	if !enabled {
 		return fmt.Errorf("env-injection not enabled for namespace,")
 	}
 
@@ -35,6 +35,12 @@ func authorize(clientset kubernetes.Interface, podData podData) error {
 		return fmt.Errorf("the provided pod data does not correspond with caller ip")
 	}
 
+	for _, initContainer := range pod.Spec.InitContainers {
+		if initContainer.Name == filesInitContainerName {
+			return nil
+		}
+	}
+
 	containerHasInjectorCmd := false
 	for _, container := range pod.Spec.Containers {
 		if len(container.Command) > 0 && container.Command[0] == "/azure-keyvault/azure-keyvault-env" {
@@ -133,6 +133,68 @@ func TestMultipleContainersInPod(t *testing.T) {
 	}
 }
 
+func TestFilesInitContainerInPod(t *testing.T) {
+	f := newFixture(t)
+
+	ns := createNewNamespace("test", true)
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: ns.Name,
+		},
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{
+				{
+					Name: filesInitContainerName,
+				},
+			},
+			Containers: []corev1.Container{{}},
+		},
+	}
+	pod.Status.PodIP = "127.0.0.1"
+	f.kubeobjects = append(f.kubeobjects, ns)
+	f.kubeobjects = append(f.kubeobjects, pod)
+
+	podData := podData{
+		remoteAddress: "127.0.0.1",
+		name:          "test",
+		namespace:     "test",
+	}
+
+	f.initAuthorization()
+	err := authorize(f.kubeclient, podData)
+
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestInjectionEnabled(t *testing.T) {
+	f := newFixture(t)
+	f.kubeobjects = append(f.kubeobjects,
+		createNewNamespace("enabled", true),
+		createNewNamespace("not-enabled", false),
+		createNewNamespace("kube-system", true),
+	)
+	f.initAuthorization()
+
+	tests := map[string]bool{
+		"enabled":     true,
+		"not-enabled": false,
+		"kube-system": false,
+	}
+
+	for ns, expected := range tests {
+		enabled, err := isInjectionEnabled(f.kubeclient, ns, []string{"kube-system"})
+		if err != nil {
+			t.Error(err)
+		}
+		if enabled != expected {
+			t.Errorf("expected injection enabled to be %t for namespace %s, got %t", expected, ns, enabled)
+		}
+	}
+}
+
 func TestTokenReview(t *testing.T) {
 	config := ensureIntegrationEnvironment(t)
 
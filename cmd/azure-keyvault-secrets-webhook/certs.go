@@ -0,0 +1,300 @@
+// Copyright © 2020 Sparebanken Vest
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// caValidity is how long the self-signed CA is valid. The CA is only replaced when about to
+	// expire, so clients can keep trusting the CA bundle while serving certificates are rotated.
+	caValidity = 10 * 365 * 24 * time.Hour
+
+	caCertKey = "ca.crt"
+	caKeyKey  = "ca.key"
+)
+
+// certManager generates and rotates the serving certificate of the webhook, signed by a
+// self-signed CA. The certificates are stored in a Secret shared by all webhook replicas, and
+// the CA is injected into the MutatingWebhookConfiguration, so cert-manager is not needed.
+type certManager struct {
+	client            kubernetes.Interface
+	namespace         string
+	secretName        string
+	webhookConfigName string
+	dnsNames          []string
+	validity          time.Duration
+	renewBefore       time.Duration
+	now               func() time.Time
+
+	cert atomic.Value
+}
+
+func newCertManager(client kubernetes.Interface, namespace, secretName, webhookConfigName string, dnsNames []string, validity, renewBefore time.Duration) *certManager {
+	return &certManager{
+		client:            client,
+		namespace:         namespace,
+		secretName:        secretName,
+		webhookConfigName: webhookConfigName,
+		dnsNames:          dnsNames,
+		validity:          validity,
+		renewBefore:       renewBefore,
+		now:               time.Now,
+	}
+}
+
+// GetCertificate returns the current serving certificate, for use in tls.Config
+func (m *certManager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert, ok := m.cert.Load().(*tls.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("no serving certificate loaded")
+	}
+	return cert, nil
+}
+
+// run keeps the serving certificate up to date, checking it on every interval
+func (m *certManager) run(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := m.ensure(); err != nil {
+			log.Errorf("failed to ensure webhook serving certificate, error: %+v", err)
+		}
+	}
+}
+
+// ensure loads the certificates from the Secret, generating them if missing or about to expire,
+// and injects the CA into the webhook configuration. Retries if another replica changed the
+// Secret at the same time.
+func (m *certManager) ensure() error {
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		if err = m.ensureOnce(); err == nil || !(errors.IsConflict(err) || errors.IsAlreadyExists(err)) {
+			return err
+		}
+		log.Debugf("webhook certificate secret changed by another replica, retrying")
+	}
+	return err
+}
+
+func (m *certManager) ensureOnce() error {
+	secret, err := m.client.CoreV1().Secrets(m.namespace).Get(m.secretName, metav1.GetOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to get secret '%s', error: %+v", m.secretName, err)
+	}
+
+	exists := err == nil
+	if !exists {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      m.secretName,
+				Namespace: m.namespace,
+			},
+			Type: corev1.SecretTypeTLS,
+		}
+	}
+
+	changed, err := m.renew(secret)
+	if err != nil {
+		return err
+	}
+
+	if changed && exists {
+		if secret, err = m.client.CoreV1().Secrets(m.namespace).Update(secret); err != nil {
+			return err
+		}
+		log.Infof("rotated webhook serving certificate in secret '%s'", m.secretName)
+	} else if changed {
+		if secret, err = m.client.CoreV1().Secrets(m.namespace).Create(secret); err != nil {
+			return err
+		}
+		log.Infof("generated webhook serving certificate in secret '%s'", m.secretName)
+	}
+
+	cert, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return fmt.Errorf("failed to load serving certificate from secret '%s', error: %+v", m.secretName, err)
+	}
+	m.cert.Store(&cert)
+
+	return m.injectCABundle(secret.Data[caCertKey])
+}
+
+// renew generates a new CA and serving certificate in the secret when missing or about to expire.
+// The CA is kept when only the serving certificate is about to expire. Returns true if the secret changed.
+func (m *certManager) renew(secret *corev1.Secret) (bool, error) {
+	ca, caKey, err := parseCertKey(secret.Data[caCertKey], secret.Data[caKeyKey])
+	if err != nil || m.expiresSoon(ca) {
+		log.Info("generating new self-signed ca for webhook")
+		ca, caKey, err = m.newCA()
+		if err != nil {
+			return false, err
+		}
+		secret.Data = map[string][]byte{
+			caCertKey: encodeCert(ca),
+			caKeyKey:  encodeKey(caKey),
+		}
+	} else {
+		cert, _, err := parseCertKey(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+		if err == nil && !m.expiresSoon(cert) && cert.CheckSignatureFrom(ca) == nil && coversDNSNames(cert, m.dnsNames) {
+			return false, nil
+		}
+	}
+
+	cert, key, err := m.newServingCert(ca, caKey)
+	if err != nil {
+		return false, err
+	}
+	secret.Data[corev1.TLSCertKey] = encodeCert(cert)
+	secret.Data[corev1.TLSPrivateKeyKey] = encodeKey(key)
+	return true, nil
+}
+
+// injectCABundle sets the CA bundle of all webhooks in the webhook configuration
+func (m *certManager) injectCABundle(caBundle []byte) error {
+	if m.webhookConfigName == "" {
+		return nil
+	}
+
+	webhookConfig, err := m.client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(m.webhookConfigName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get mutating webhook configuration '%s', error: %+v", m.webhookConfigName, err)
+	}
+
+	changed := false
+	for i := range webhookConfig.Webhooks {
+		if !bytes.Equal(webhookConfig.Webhooks[i].ClientConfig.CABundle, caBundle) {
+			webhookConfig.Webhooks[i].ClientConfig.CABundle = caBundle
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	if _, err := m.client.AdmissionregistrationV1().MutatingWebhookConfigurations().Update(webhookConfig); err != nil {
+		return err
+	}
+	log.Infof("injected ca bundle into mutating webhook configuration '%s'", m.webhookConfigName)
+	return nil
+}
+
+func (m *certManager) expiresSoon(cert *x509.Certificate) bool {
+	return m.now().Add(m.renewBefore).After(cert.NotAfter)
+}
+
+func (m *certManager) newCA() (*x509.Certificate, *rsa.PrivateKey, error) {
+	return m.newCert(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "akv2k8s-webhook-ca"},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, caValidity, nil, nil)
+}
+
+func (m *certManager) newServingCert(ca *x509.Certificate, caKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey, error) {
+	return m.newCert(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: m.dnsNames[0]},
+		DNSNames:    m.dnsNames,
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, m.validity, ca, caKey)
+}
+
+// newCert creates a certificate from template signed by parent, or self-signed if parent is nil
+func (m *certManager) newCert(template *x509.Certificate, validity time.Duration, parent *x509.Certificate, parentKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := m.now()
+	template.SerialNumber = serial
+	template.NotBefore = now.Add(-time.Hour)
+	template.NotAfter = now.Add(validity)
+
+	if parent == nil {
+		parent = template
+		parentKey = key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+func parseCertKey(certPEM, keyPEM []byte) (*x509.Certificate, *rsa.PrivateKey, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, fmt.Errorf("no pem encoded certificate and key found")
+	}
+
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+func coversDNSNames(cert *x509.Certificate, dnsNames []string) bool {
+	for _, name := range dnsNames {
+		if cert.VerifyHostname(name) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func encodeCert(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+func encodeKey(key *rsa.PrivateKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestCertManager(t *testing.T) (*certManager, *k8sfake.Clientset) {
+	client := k8sfake.NewSimpleClientset(&admissionregistrationv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "akv2k8s-envinjector"},
+		Webhooks:   []admissionregistrationv1.MutatingWebhook{{Name: "pods.akv2k8s.io"}},
+	})
+	m := newCertManager(client, "akv2k8s", "webhook-tls", "akv2k8s-envinjector", []string{"webhook.akv2k8s.svc"}, 24*time.Hour, 6*time.Hour)
+	return m, client
+}
+
+func getTestSecret(t *testing.T, client *k8sfake.Clientset) *corev1.Secret {
+	secret, err := client.CoreV1().Secrets("akv2k8s").Get("webhook-tls", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+func TestCertManagerGeneratesCertificates(t *testing.T) {
+	m, client := newTestCertManager(t)
+
+	if err := m.ensure(); err != nil {
+		t.Fatal(err)
+	}
+
+	secret := getTestSecret(t, client)
+	cert, _, err := parseCertKey(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _, err := parseCertKey(secret.Data[caCertKey], secret.Data[caKeyKey])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.CheckSignatureFrom(ca); err != nil {
+		t.Errorf("expected serving certificate to be signed by ca, error: %+v", err)
+	}
+	if err := cert.VerifyHostname("webhook.akv2k8s.svc"); err != nil {
+		t.Error(err)
+	}
+
+	webhookConfig, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get("akv2k8s-envinjector", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(webhookConfig.Webhooks[0].ClientConfig.CABundle, secret.Data[caCertKey]) {
+		t.Error("expected ca bundle to be injected into webhook configuration")
+	}
+
+	if _, err := m.GetCertificate(nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCertManagerRotatesCertificateBeforeExpiry(t *testing.T) {
+	m, client := newTestCertManager(t)
+	now := time.Now()
+	m.now = func() time.Time { return now }
+
+	if err := m.ensure(); err != nil {
+		t.Fatal(err)
+	}
+	before := getTestSecret(t, client)
+
+	now = now.Add(12 * time.Hour)
+	if err := m.ensure(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(getTestSecret(t, client).Data[corev1.TLSCertKey], before.Data[corev1.TLSCertKey]) {
+		t.Error("expected serving certificate not to be rotated before renewal time")
+	}
+
+	now = now.Add(7 * time.Hour)
+	if err := m.ensure(); err != nil {
+		t.Fatal(err)
+	}
+	after := getTestSecret(t, client)
+	if bytes.Equal(after.Data[corev1.TLSCertKey], before.Data[corev1.TLSCertKey]) {
+		t.Error("expected serving certificate to be rotated before expiry")
+	}
+	if !bytes.Equal(after.Data[caCertKey], before.Data[caCertKey]) {
+		t.Error("expected ca to be kept when rotating serving certificate")
+	}
+}
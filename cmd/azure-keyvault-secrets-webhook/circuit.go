@@ -0,0 +1,113 @@
+// Copyright © 2020 Sparebanken Vest
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// circuitBreaker opens after a number of failures in a row talking to the vault backend, and
+// closes again on the first success. While open the injector is reported unhealthy.
+type circuitBreaker struct {
+	threshold int
+	// onChange is called with the new state when the circuit opens or closes
+	onChange func(open bool)
+
+	mutex    sync.Mutex
+	failures int
+	open     bool
+}
+
+func newCircuitBreaker(threshold int, onChange func(open bool)) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		onChange:  onChange,
+	}
+}
+
+// isOpen returns true if the vault backend is considered down
+func (c *circuitBreaker) isOpen() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.open
+}
+
+// record records the result of talking to the vault backend
+func (c *circuitBreaker) record(err error) {
+	c.mutex.Lock()
+	wasOpen := c.open
+	if err == nil {
+		c.failures = 0
+		c.open = false
+	} else {
+		c.failures++
+		c.open = c.threshold > 0 && c.failures >= c.threshold
+	}
+	open := c.open
+	c.mutex.Unlock()
+
+	if open == wasOpen {
+		return
+	}
+
+	if open {
+		log.Errorf("vault backend failed %d times in a row, marking injector unhealthy, last error: %+v", c.threshold, err)
+	} else {
+		log.Info("vault backend recovered, marking injector healthy")
+	}
+	if c.onChange != nil {
+		c.onChange(open)
+	}
+}
+
+// applyWebhookPolicy sets the failure policy and timeout of all webhooks in the webhook
+// configuration. Empty policy or zero timeout leaves them unchanged.
+func applyWebhookPolicy(clientset kubernetes.Interface, webhookConfigName string, policy admissionregistrationv1.FailurePolicyType, timeoutSeconds int32) error {
+	webhookConfig, err := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(webhookConfigName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get mutating webhook configuration '%s', error: %+v", webhookConfigName, err)
+	}
+
+	changed := false
+	for i := range webhookConfig.Webhooks {
+		webhook := &webhookConfig.Webhooks[i]
+		if policy != "" && (webhook.FailurePolicy == nil || *webhook.FailurePolicy != policy) {
+			p := policy
+			webhook.FailurePolicy = &p
+			changed = true
+		}
+		if timeoutSeconds > 0 && (webhook.TimeoutSeconds == nil || *webhook.TimeoutSeconds != timeoutSeconds) {
+			t := timeoutSeconds
+			webhook.TimeoutSeconds = &t
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	if _, err := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().Update(webhookConfig); err != nil {
+		return fmt.Errorf("failed to update mutating webhook configuration '%s', error: %+v", webhookConfigName, err)
+	}
+	log.Infof("set failure policy '%s' and timeout %ds for mutating webhook configuration '%s'", policy, timeoutSeconds, webhookConfigName)
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	var changes []bool
+	circuit := newCircuitBreaker(3, func(open bool) {
+		changes = append(changes, open)
+	})
+
+	backendErr := fmt.Errorf("azure ad unavailable")
+	circuit.record(backendErr)
+	circuit.record(backendErr)
+	if circuit.isOpen() {
+		t.Error("expected circuit to be closed below threshold")
+	}
+
+	circuit.record(backendErr)
+	circuit.record(backendErr)
+	if !circuit.isOpen() {
+		t.Error("expected circuit to be open at threshold")
+	}
+
+	circuit.record(nil)
+	if circuit.isOpen() {
+		t.Error("expected circuit to close on success")
+	}
+
+	if len(changes) != 2 || !changes[0] || changes[1] {
+		t.Errorf("expected circuit to open once and close once, got %v", changes)
+	}
+}
+
+func TestApplyWebhookPolicy(t *testing.T) {
+	client := k8sfake.NewSimpleClientset(&admissionregistrationv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "akv2k8s-envinjector"},
+		Webhooks:   []admissionregistrationv1.MutatingWebhook{{Name: "pods.akv2k8s.io"}},
+	})
+
+	if err := applyWebhookPolicy(client, "akv2k8s-envinjector", admissionregistrationv1.Ignore, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	webhookConfig, err := client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get("akv2k8s-envinjector", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	webhook := webhookConfig.Webhooks[0]
+	if webhook.FailurePolicy == nil || *webhook.FailurePolicy != admissionregistrationv1.Ignore {
+		t.Errorf("expected failure policy Ignore, got %v", webhook.FailurePolicy)
+	}
+	if webhook.TimeoutSeconds == nil || *webhook.TimeoutSeconds != 5 {
+		t.Errorf("expected timeout 5, got %v", webhook.TimeoutSeconds)
+	}
+}
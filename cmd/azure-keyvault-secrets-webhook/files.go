@@ -0,0 +1,190 @@
+// Copyright © 2020 Sparebanken Vest
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// injectFilesAnnotation lists the AzureKeyVaultSecrets to download into files before the pod
+	// starts, as comma separated [<file name>=]<azurekeyvaultsecret name>[?<query>]
+	injectFilesAnnotation = "keyvault.azure.spv.no/inject-files"
+
+	// injectFilesPathAnnotation overrides the path the files are mounted at in the containers
+	injectFilesPathAnnotation = "keyvault.azure.spv.no/inject-files-path"
+
+	// injectFilesRefreshIntervalAnnotation adds a sidecar refreshing the files on the interval,
+	// like 5m, for rotated secrets to reach the running pod
+	injectFilesRefreshIntervalAnnotation = "keyvault.azure.spv.no/inject-files-refresh-interval"
+
+	// injectFilesSignalAnnotation makes the refresh sidecar signal a process when files changed,
+	// as <signal>:<process name>, like SIGHUP:nginx. Enables shareProcessNamespace for the pod.
+	injectFilesSignalAnnotation = "keyvault.azure.spv.no/inject-files-signal"
+
+	filesInitContainerName = "azurekeyvault-files"
+	filesSidecarName       = "azurekeyvault-files-refresh"
+	filesVolumeName        = "azure-keyvault-files"
+	defaultFilesDir        = "/azure-keyvault-files/"
+)
+
+// getFilesContainer returns a container running the env-injector in files mode, downloading the
+// Azure Key Vault objects into the files volume
+func getFilesContainer(name, files string) corev1.Container {
+	container := corev1.Container{
+		Name:            name,
+		Image:           viper.GetString("azurekeyvault_env_image"),
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Command:         []string{filepath.Join("/usr/local/bin", injectorExecutable)},
+		VolumeMounts: []corev1.VolumeMount{
+			{
+				Name:      filesVolumeName,
+				MountPath: defaultFilesDir,
+			},
+		},
+		Env: []corev1.EnvVar{
+			{
+				Name:  "ENV_INJECTOR_FILES",
+				Value: files,
+			},
+			{
+				Name:  "ENV_INJECTOR_FILES_DIR",
+				Value: defaultFilesDir,
+			},
+			{
+				Name: "ENV_INJECTOR_POD_NAMESPACE",
+				ValueFrom: &corev1.EnvVarSource{
+					FieldRef: &corev1.ObjectFieldSelector{
+						FieldPath: "metadata.namespace",
+					},
+				},
+			},
+			{
+				Name:  "ENV_INJECTOR_USE_AUTH_SERVICE",
+				Value: strconv.FormatBool(config.useAuthService),
+			},
+		},
+	}
+
+	if config.useAuthService {
+		container.Env = append(container.Env, getAuthServiceEnvVars()...)
+	}
+
+	return container
+}
+
+// getFilesSidecar returns a sidecar running the env-injector in files mode, refreshing the files
+// on the interval and optionally signalling a process in the main container when they changed
+func getFilesSidecar(files string, refreshInterval time.Duration, signal string) (corev1.Container, error) {
+	container := getFilesContainer(filesSidecarName, files)
+	container.Env = append(container.Env, corev1.EnvVar{
+		Name:  "ENV_INJECTOR_FILES_REFRESH_INTERVAL",
+		Value: refreshInterval.String(),
+	})
+
+	if signal != "" {
+		split := strings.SplitN(signal, ":", 2)
+		if len(split) != 2 || split[0] == "" || split[1] == "" {
+			return container, fmt.Errorf("annotation %s must be formatted as <signal>:<process name>, got '%s'", injectFilesSignalAnnotation, signal)
+		}
+
+		container.Env = append(container.Env, []corev1.EnvVar{
+			{
+				Name:  "ENV_INJECTOR_FILES_SIGNAL",
+				Value: split[0],
+			},
+			{
+				Name:  "ENV_INJECTOR_FILES_SIGNAL_PROCESS",
+				Value: split[1],
+			},
+		}...)
+	}
+
+	return container, nil
+}
+
+// mutatePodFiles adds the files init-container and volume to a pod having the inject-files
+// annotation, and mounts the volume read only in all its containers. Adds the refresh sidecar if
+// the pod has a refresh interval. Returns false if the pod has no files to inject.
+func mutatePodFiles(pod *corev1.Pod) (bool, error) {
+	files := pod.Annotations[injectFilesAnnotation]
+	if files == "" {
+		return false, nil
+	}
+
+	var sidecar *corev1.Container
+	if interval, ok := pod.Annotations[injectFilesRefreshIntervalAnnotation]; ok {
+		refreshInterval, err := time.ParseDuration(interval)
+		if err != nil || refreshInterval <= 0 {
+			return false, fmt.Errorf("annotation %s must be a positive duration, got '%s'", injectFilesRefreshIntervalAnnotation, interval)
+		}
+
+		container, err := getFilesSidecar(files, refreshInterval, pod.Annotations[injectFilesSignalAnnotation])
+		if err != nil {
+			return false, err
+		}
+		sidecar = &container
+	}
+
+	mountPath := defaultFilesDir
+	if path, ok := pod.Annotations[injectFilesPathAnnotation]; ok && path != "" {
+		mountPath = path
+	}
+
+	log.Infof("found files to inject '%s', mounting them at '%s'", files, mountPath)
+
+	podSpec := &pod.Spec
+	mount := corev1.VolumeMount{
+		Name:      filesVolumeName,
+		MountPath: mountPath,
+		ReadOnly:  true,
+	}
+	for i := range podSpec.InitContainers {
+		podSpec.InitContainers[i].VolumeMounts = append(podSpec.InitContainers[i].VolumeMounts, mount)
+	}
+	for i := range podSpec.Containers {
+		podSpec.Containers[i].VolumeMounts = append(podSpec.Containers[i].VolumeMounts, mount)
+	}
+
+	podSpec.InitContainers = append([]corev1.Container{getFilesContainer(filesInitContainerName, files)}, podSpec.InitContainers...)
+	if sidecar != nil {
+		log.Infof("adding sidecar refreshing files every %s", pod.Annotations[injectFilesRefreshIntervalAnnotation])
+		podSpec.Containers = append(podSpec.Containers, *sidecar)
+
+		if pod.Annotations[injectFilesSignalAnnotation] != "" {
+			shareProcessNamespace := true
+			podSpec.ShareProcessNamespace = &shareProcessNamespace
+		}
+	}
+
+	podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+		Name: filesVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{
+				Medium: corev1.StorageMediumMemory,
+			},
+		},
+	})
+
+	return true, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMutatePodFiles(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "test",
+			Annotations: map[string]string{
+				injectFilesAnnotation:     "db-password,tls.key=my-cert?tls.key",
+				injectFilesPathAnnotation: "/secrets",
+			},
+		},
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{{Name: "migrate"}},
+			Containers:     []corev1.Container{{Name: "app"}},
+		},
+	}
+
+	mutated, err := mutatePodFiles(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !mutated {
+		t.Fatal("expected pod to be mutated")
+	}
+
+	if len(pod.Spec.InitContainers) != 2 || pod.Spec.InitContainers[0].Name != filesInitContainerName {
+		t.Fatalf("expected files init-container to run first, got %+v", pod.Spec.InitContainers)
+	}
+
+	var files string
+	for _, env := range pod.Spec.InitContainers[0].Env {
+		if env.Name == "ENV_INJECTOR_FILES" {
+			files = env.Value
+		}
+	}
+	if files != "db-password,tls.key=my-cert?tls.key" {
+		t.Errorf("expected files to be passed to init-container, got '%s'", files)
+	}
+
+	for _, container := range []corev1.Container{pod.Spec.InitContainers[1], pod.Spec.Containers[0]} {
+		mounts := container.VolumeMounts
+		if len(mounts) != 1 || mounts[0].Name != filesVolumeName || mounts[0].MountPath != "/secrets" || !mounts[0].ReadOnly {
+			t.Errorf("expected files volume to be mounted read only at /secrets in container %s, got %+v", container.Name, mounts)
+		}
+	}
+
+	if len(pod.Spec.Volumes) != 1 || pod.Spec.Volumes[0].EmptyDir == nil {
+		t.Errorf("expected files emptyDir volume, got %+v", pod.Spec.Volumes)
+	}
+}
+
+func TestMutatePodFilesWithoutAnnotation(t *testing.T) {
+	pod := &corev1.Pod{
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app"}},
+		},
+	}
+
+	mutated, err := mutatePodFiles(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mutated {
+		t.Error("expected pod without files annotation not to be mutated")
+	}
+	if len(pod.Spec.InitContainers) != 0 || len(pod.Spec.Volumes) != 0 {
+		t.Errorf("expected pod to be unchanged, got %+v", pod.Spec)
+	}
+}
+
+func TestMutatePodFilesWithRefreshSidecar(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				injectFilesAnnotation:                "tls.crt=my-cert",
+				injectFilesRefreshIntervalAnnotation: "5m",
+				injectFilesSignalAnnotation:          "SIGHUP:nginx",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{{Name: "app"}},
+		},
+	}
+
+	if _, err := mutatePodFiles(pod); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pod.Spec.Containers) != 2 || pod.Spec.Containers[1].Name != filesSidecarName {
+		t.Fatalf("expected refresh sidecar to be added, got %+v", pod.Spec.Containers)
+	}
+
+	sidecar := pod.Spec.Containers[1]
+	if len(sidecar.VolumeMounts) != 1 || sidecar.VolumeMounts[0].ReadOnly {
+		t.Errorf("expected files volume to be writable in sidecar, got %+v", sidecar.VolumeMounts)
+	}
+
+	env := map[string]string{}
+	for _, e := range sidecar.Env {
+		env[e.Name] = e.Value
+	}
+	if env["ENV_INJECTOR_FILES_REFRESH_INTERVAL"] != "5m0s" {
+		t.Errorf("expected refresh interval 5m0s, got '%s'", env["ENV_INJECTOR_FILES_REFRESH_INTERVAL"])
+	}
+	if env["ENV_INJECTOR_FILES_SIGNAL"] != "SIGHUP" || env["ENV_INJECTOR_FILES_SIGNAL_PROCESS"] != "nginx" {
+		t.Errorf("expected sidecar to signal nginx with SIGHUP, got %+v", env)
+	}
+
+	if pod.Spec.ShareProcessNamespace == nil || !*pod.Spec.ShareProcessNamespace {
+		t.Error("expected pod to share process namespace for signalling")
+	}
+}
+
+func TestMutatePodFilesRejectsInvalidRefreshAnnotations(t *testing.T) {
+	for _, annotations := range []map[string]string{
+		{injectFilesAnnotation: "my-secret", injectFilesRefreshIntervalAnnotation: "often"},
+		{injectFilesAnnotation: "my-secret", injectFilesRefreshIntervalAnnotation: "-1m"},
+		{injectFilesAnnotation: "my-secret", injectFilesRefreshIntervalAnnotation: "1m", injectFilesSignalAnnotation: "SIGHUP"},
+	} {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: annotations}}
+		if _, err := mutatePodFiles(pod); err == nil {
+			t.Errorf("expected error for annotations %+v", annotations)
+		}
+	}
+}
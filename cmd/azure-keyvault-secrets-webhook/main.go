@@ -19,13 +19,19 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/akv2k8s"
 	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/credentialprovider"
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	clientset "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/client/clientset/versioned"
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
@@ -36,8 +42,10 @@ import (
 	"github.com/slok/kubewebhook/pkg/observability/metrics"
 	whcontext "github.com/slok/kubewebhook/pkg/webhook/context"
 	"github.com/slok/kubewebhook/pkg/webhook/mutating"
+	"github.com/slok/kubewebhook/pkg/webhook/validating"
 	"github.com/spf13/viper"
 
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -69,12 +77,32 @@ type azureKeyVaultConfig struct {
 	authServiceName              string
 	authServicePort              string
 	caBundleConfigMapName        string
+	tlsAuto                      bool
+	tlsSecretName                string
+	tlsCertValidity              time.Duration
+	tlsCertRenewBefore           time.Duration
+	webhookConfigName            string
+	webhookServiceName           string
+	excludedNamespaces           []string
+	failurePolicy                string
+	timeoutSeconds               int
+	failOpen                     bool
+	circuitFailureThreshold      int
+	backendProbeInterval         time.Duration
+	vaultPrecheck                bool
+	vaultPrecheckTimeout         time.Duration
+	vaultPrecheckFailOpen        bool
+	vaultService                 vault.Service
 	kubeClient                   *kubernetes.Clientset
+	akvsClient                   clientset.Interface
 	credentials                  credentialprovider.Credentials
 }
 
 var config azureKeyVaultConfig
 
+// backendCircuit tracks if the vault backend is down
+var backendCircuit *circuitBreaker
+
 var (
 	podsMutatedCounter = promauto.NewCounter(prometheus.CounterOpts{
 		Name: "akv2k8s_pod_mutations_total",
@@ -135,7 +163,19 @@ func vaultSecretsMutator(ctx context.Context, obj metav1.Object) (bool, error) {
 
 	podsInspectedCounter.Inc()
 
-	err := mutatePodSpec(pod)
+	enabled, err := isInjectionEnabled(config.kubeClient, config.namespace, config.excludedNamespaces)
+	if err != nil {
+		log.Errorf("failed to check if injection is enabled for namespace '%s', error: %+v", config.namespace, err)
+		podsMutatedFailedCounter.Inc()
+		return false, err
+	}
+
+	if !enabled {
+		log.Infof("injection not enabled for namespace '%s' - skipping pod", config.namespace)
+		return false, nil
+	}
+
+	err = mutatePodSpec(pod)
 	if err != nil {
 		log.Errorf("failed to mutate pod, error: %+v", err)
 		podsMutatedFailedCounter.Inc()
@@ -186,7 +226,9 @@ func authHandler(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 		w.WriteHeader(http.StatusOK)
 
-		if err := json.NewEncoder(w).Encode(config.credentials); err != nil {
+		err = json.NewEncoder(w).Encode(config.credentials)
+		backendCircuit.record(err)
+		if err != nil {
 			log.Errorf("failed to json encode token, error: %+v", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 		} else {
@@ -201,6 +243,10 @@ func authHandler(w http.ResponseWriter, r *http.Request) {
 
 func healthHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "GET" {
+		if backendCircuit != nil && backendCircuit.isOpen() {
+			http.Error(w, "vault backend unavailable", http.StatusServiceUnavailable)
+			return
+		}
 		w.WriteHeader(http.StatusOK)
 	} else {
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
@@ -220,6 +266,17 @@ func initConfig() {
 	viper.SetDefault("port", "443")
 	viper.SetDefault("log_level", "Info")
 	viper.SetDefault("log_format", "fmt")
+	viper.SetDefault("excluded_namespaces", "kube-system,kube-public,kube-node-lease")
+	viper.SetDefault("webhook_fail_open", false)
+	viper.SetDefault("circuit_failure_threshold", 5)
+	viper.SetDefault("backend_probe_interval", "30s")
+	viper.SetDefault("vault_precheck", false)
+	viper.SetDefault("vault_precheck_timeout", "5s")
+	viper.SetDefault("vault_precheck_fail_open", true)
+	viper.SetDefault("tls_auto", false)
+	viper.SetDefault("tls_secret_name", "azure-key-vault-secrets-webhook-tls")
+	viper.SetDefault("tls_cert_validity", "8760h")
+	viper.SetDefault("tls_cert_renew_before", "720h")
 	viper.AutomaticEnv()
 }
 
@@ -250,6 +307,31 @@ func main() {
 		cloudConfigHostPath:          viper.GetString("cloud_config_host_path"),
 		dockerImageInspectionTimeout: viper.GetInt("docker_image_inspection_timeout"),
 		useAksCredentialsWithAcs:     viper.GetBool("docker_image_inspection_use_acs_credentials"),
+		tlsAuto:                      viper.GetBool("tls_auto"),
+		tlsSecretName:                viper.GetString("tls_secret_name"),
+		tlsCertValidity:              viper.GetDuration("tls_cert_validity"),
+		tlsCertRenewBefore:           viper.GetDuration("tls_cert_renew_before"),
+		webhookConfigName:            viper.GetString("webhook_config_name"),
+		webhookServiceName:           viper.GetString("webhook_service_name"),
+		excludedNamespaces:           strings.Split(viper.GetString("excluded_namespaces"), ","),
+		failurePolicy:                viper.GetString("webhook_failure_policy"),
+		timeoutSeconds:               viper.GetInt("webhook_timeout_seconds"),
+		failOpen:                     viper.GetBool("webhook_fail_open"),
+		circuitFailureThreshold:      viper.GetInt("circuit_failure_threshold"),
+		backendProbeInterval:         viper.GetDuration("backend_probe_interval"),
+		vaultPrecheck:                viper.GetBool("vault_precheck"),
+		vaultPrecheckTimeout:         viper.GetDuration("vault_precheck_timeout"),
+		vaultPrecheckFailOpen:        viper.GetBool("vault_precheck_fail_open"),
+	}
+
+	switch admissionregistrationv1.FailurePolicyType(config.failurePolicy) {
+	case "", admissionregistrationv1.Fail, admissionregistrationv1.Ignore:
+	default:
+		log.Fatalf("env var WEBHOOK_FAILURE_POLICY must be %s or %s, got '%s'", admissionregistrationv1.Fail, admissionregistrationv1.Ignore, config.failurePolicy)
+	}
+
+	if config.webhookServiceName == "" {
+		config.webhookServiceName = config.authServiceName
 	}
 
 	if !config.runningInsideAzureAks {
@@ -272,12 +354,30 @@ func main() {
 	log.Infof("  Docker inspection timeout : %d", config.dockerImageInspectionTimeout)
 	log.Infof("  CA ConfigMap name         : %s", config.caBundleConfigMapName)
 	log.Infof("  Cloud config path         : %s", config.cloudConfigHostPath)
+	log.Infof("  Excluded namespaces       : %s", strings.Join(config.excludedNamespaces, ","))
+	log.Infof("  Webhook failure policy    : %s", config.failurePolicy)
+	log.Infof("  Webhook timeout seconds   : %d", config.timeoutSeconds)
+	log.Infof("  Webhook fail open         : %t", config.failOpen)
+	log.Infof("  Vault pre-check           : %t", config.vaultPrecheck)
+	if config.vaultPrecheck {
+		log.Infof("  Vault pre-check timeout   : %s", config.vaultPrecheckTimeout)
+		log.Infof("  Vault pre-check fail open : %t", config.vaultPrecheckFailOpen)
+	}
+	log.Infof("  Auto manage TLS           : %t", config.tlsAuto)
+	if config.tlsAuto {
+		log.Infof("  TLS secret name           : %s", config.tlsSecretName)
+		log.Infof("  TLS cert validity         : %s", config.tlsCertValidity)
+		log.Infof("  TLS cert renew before     : %s", config.tlsCertRenewBefore)
+		log.Infof("  Webhook config name       : %s", config.webhookConfigName)
+		log.Infof("  Webhook service name      : %s", config.webhookServiceName)
+	}
 
 	mutator := mutating.MutatorFunc(vaultSecretsMutator)
 	metricsRecorder := metrics.NewPrometheus(prometheus.DefaultRegisterer)
 
 	internalLogger := &internalLog.Std{Debug: logLevel == "debug" || logLevel == "trace"}
 	podHandler := handlerFor(mutating.WebhookConfig{Name: "azurekeyvault-secrets-pods", Obj: &corev1.Pod{}}, mutator, metricsRecorder, internalLogger)
+	azureKeyVaultSecretHandler := validatingHandlerFor(validating.WebhookConfig{Name: "azurekeyvault-secrets-policies", Obj: &akv.AzureKeyVaultSecret{}}, validating.ValidatorFunc(azureKeyVaultSecretValidator), internalLogger)
 
 	var err error
 	if !config.runningInsideAzureAks || config.customAuth {
@@ -311,6 +411,14 @@ func main() {
 		}
 	}
 
+	if config.vaultPrecheck {
+		vaultAuth, ok := config.credentials.(*credentialprovider.AzureKeyVaultCredentials)
+		if !ok {
+			log.Fatal("vault pre-check requires azure key vault credentials")
+		}
+		config.vaultService = vault.NewService(vaultAuth)
+	}
+
 	cfg, err := rest.InClusterConfig()
 	if err != nil {
 		log.Fatalf("failed to get kubernetes in cluster config, error: %+v", err)
@@ -321,6 +429,43 @@ func main() {
 		log.Fatalf("Error building kubernetes clientset: %s", err.Error())
 	}
 
+	config.akvsClient, err = clientset.NewForConfig(cfg)
+	if err != nil {
+		log.Fatalf("Error building azurekeyvaultsecret clientset: %s", err.Error())
+	}
+
+	if config.webhookConfigName != "" && (config.failurePolicy != "" || config.timeoutSeconds > 0) {
+		err := applyWebhookPolicy(config.kubeClient, config.webhookConfigName, admissionregistrationv1.FailurePolicyType(config.failurePolicy), int32(config.timeoutSeconds))
+		if err != nil {
+			log.Errorf("failed to apply webhook failure policy and timeout, error: %+v", err)
+		}
+	}
+
+	backendCircuit = newCircuitBreaker(config.circuitFailureThreshold, func(open bool) {
+		if !config.failOpen || config.webhookConfigName == "" {
+			return
+		}
+
+		// Fail open while the vault backend is down, so pods can still be scheduled
+		policy := admissionregistrationv1.FailurePolicyType(config.failurePolicy)
+		if open {
+			policy = admissionregistrationv1.Ignore
+		} else if policy == "" {
+			policy = admissionregistrationv1.Fail
+		}
+
+		if err := applyWebhookPolicy(config.kubeClient, config.webhookConfigName, policy, 0); err != nil {
+			log.Errorf("failed to set webhook failure policy to '%s', error: %+v", policy, err)
+		}
+	})
+
+	go func() {
+		for range time.Tick(config.backendProbeInterval) {
+			_, err := json.Marshal(config.credentials)
+			backendCircuit.record(err)
+		}
+	}()
+
 	httpMux := http.NewServeMux()
 	httpURL := fmt.Sprintf(":%s", config.httpPort)
 
@@ -345,6 +490,9 @@ func main() {
 	router.Handle("/pods", podHandler)
 	log.Infof("Serving encrypted webhook at %s/pods", tlsURL)
 
+	router.Handle("/azurekeyvaultsecrets", azureKeyVaultSecretHandler)
+	log.Infof("Serving encrypted azurekeyvaultsecret validation at %s/azurekeyvaultsecrets", tlsURL)
+
 	router.HandleFunc("/healthz", healthHandler)
 	log.Infof("Serving encrypted healthz at %s/healthz", tlsURL)
 
@@ -353,7 +501,32 @@ func main() {
 		log.Infof("Serving encrypted auth at %s/auth", tlsURL)
 	}
 
-	err = http.ListenAndServeTLS(tlsURL, config.certFile, config.keyFile, router)
+	if config.tlsAuto {
+		if config.webhookServiceName == "" {
+			log.Fatal("env var WEBHOOK_SERVICE_NAME or WEBHOOK_AUTH_SERVICE is required for auto managed tls")
+		}
+
+		ns := namespace()
+		certs := newCertManager(config.kubeClient, ns, config.tlsSecretName, config.webhookConfigName, []string{
+			fmt.Sprintf("%s.%s.svc", config.webhookServiceName, ns),
+			fmt.Sprintf("%s.%s", config.webhookServiceName, ns),
+			config.webhookServiceName,
+		}, config.tlsCertValidity, config.tlsCertRenewBefore)
+
+		if err := certs.ensure(); err != nil {
+			log.Fatalf("failed to ensure webhook serving certificate, error: %+v", err)
+		}
+		go certs.run(time.Hour)
+
+		server := &http.Server{
+			Addr:      tlsURL,
+			Handler:   router,
+			TLSConfig: &tls.Config{GetCertificate: certs.GetCertificate},
+		}
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = http.ListenAndServeTLS(tlsURL, config.certFile, config.keyFile, router)
+	}
 	if err != nil {
 		log.Fatalf("error serving webhook: %+v", err)
 	}
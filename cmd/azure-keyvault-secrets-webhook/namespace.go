@@ -0,0 +1,45 @@
+// Copyright © 2020 Sparebanken Vest
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// injectionLabelName is the namespace label opting in to injection, when set to injectionLabelEnabled
+	injectionLabelName    = "azure-key-vault-env-injection"
+	injectionLabelEnabled = "enabled"
+)
+
+// isInjectionEnabled returns true if pods in the namespace can be injected, which requires the
+// namespace to opt in with the injection label and not be excluded. This double checks the
+// namespaceSelector of the webhook configuration, in case it is missing or too wide.
+func isInjectionEnabled(clientset kubernetes.Interface, namespace string, excludedNamespaces []string) (bool, error) {
+	for _, excluded := range excludedNamespaces {
+		if namespace == excluded {
+			return false, nil
+		}
+	}
+
+	ns, err := clientset.CoreV1().Namespaces().Get(namespace, metav1.GetOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to get namespace '%s', error: %+v", namespace, err)
+	}
+	return ns.Labels[injectionLabelName] == injectionLabelEnabled, nil
+}
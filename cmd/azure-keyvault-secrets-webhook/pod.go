@@ -175,23 +175,7 @@ func mutateContainers(clientset kubernetes.Interface, ns string, containers []co
 		}...)
 
 		if useAuthService {
-			container.Env = append(container.Env, []corev1.EnvVar{
-				{
-					Name:  "ENV_INJECTOR_AUTH_SERVICE",
-					Value: fmt.Sprintf("%s.%s.svc:%s", config.authServiceName, namespace(), config.authServicePort),
-				},
-				{
-					Name: "ENV_INJECTOR_CA_CERT",
-					ValueFrom: &corev1.EnvVarSource{
-						ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
-							LocalObjectReference: corev1.LocalObjectReference{
-								Name: config.caBundleConfigMapName,
-							},
-							Key: "caCert",
-						},
-					},
-				},
-			}...)
+			container.Env = append(container.Env, getAuthServiceEnvVars()...)
 		}
 
 		containers[i] = container
@@ -200,6 +184,27 @@ func mutateContainers(clientset kubernetes.Interface, ns string, containers []co
 	return mutated, nil
 }
 
+// getAuthServiceEnvVars returns the env vars the env-injector needs to get credentials from the auth service
+func getAuthServiceEnvVars() []corev1.EnvVar {
+	return []corev1.EnvVar{
+		{
+			Name:  "ENV_INJECTOR_AUTH_SERVICE",
+			Value: fmt.Sprintf("%s.%s.svc:%s", config.authServiceName, namespace(), config.authServicePort),
+		},
+		{
+			Name: "ENV_INJECTOR_CA_CERT",
+			ValueFrom: &corev1.EnvVarSource{
+				ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: config.caBundleConfigMapName,
+					},
+					Key: "caCert",
+				},
+			},
+		},
+	}
+}
+
 func mutatePodSpec(pod *corev1.Pod) error {
 	podSpec := &pod.Spec
 
@@ -213,6 +218,10 @@ func mutatePodSpec(pod *corev1.Pod) error {
 		return err
 	}
 
+	if err := mutatePodAnnotations(pod); err != nil {
+		return err
+	}
+
 	initContainersMutated, err := mutateContainers(clientset, pod.Namespace, podSpec.InitContainers, podSpec)
 	if err != nil {
 		return err
@@ -223,15 +232,26 @@ func mutatePodSpec(pod *corev1.Pod) error {
 		return err
 	}
 
+	filesMutated, err := mutatePodFiles(pod)
+	if err != nil {
+		return err
+	}
+	if filesMutated {
+		log.Info("pod updated with files init-container and volume")
+	}
+
 	if initContainersMutated || containersMutated {
 		podSpec.InitContainers = append(getInitContainers(), podSpec.InitContainers...)
 		podSpec.Volumes = append(podSpec.Volumes, getVolumes()...)
 		log.Info("containers mutated and pod updated with init-container and volumes")
-		podsMutatedCounter.Inc()
 	} else {
 		log.Info("no containers mutated")
 	}
 
+	if initContainersMutated || containersMutated || filesMutated {
+		podsMutatedCounter.Inc()
+	}
+
 	return nil
 }
 
@@ -0,0 +1,145 @@
+// Copyright © 2020 Sparebanken Vest
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	clientset "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/client/clientset/versioned"
+	log "github.com/sirupsen/logrus"
+	whhttp "github.com/slok/kubewebhook/pkg/http"
+	internalLog "github.com/slok/kubewebhook/pkg/log"
+	whcontext "github.com/slok/kubewebhook/pkg/webhook/context"
+	"github.com/slok/kubewebhook/pkg/webhook/validating"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// azureKeyVaultSecretValidator denies AzureKeyVaultSecrets using Azure Key Vaults, credential sets or
+// identities their namespace is not allowed to use by the AzureKeyVaultPolicies. With the vault pre-check
+// enabled, AzureKeyVaultSecrets referring to objects that cannot be read from Azure Key Vault are denied too.
+func azureKeyVaultSecretValidator(ctx context.Context, obj metav1.Object) (bool, validating.ValidatorResult, error) {
+	azureKeyVaultSecret, ok := obj.(*akv.AzureKeyVaultSecret)
+	if !ok {
+		return false, validating.ValidatorResult{Valid: true}, nil
+	}
+
+	namespace := azureKeyVaultSecret.Namespace
+	if req := whcontext.GetAdmissionRequest(ctx); req != nil && req.Namespace != "" {
+		namespace = req.Namespace
+	}
+
+	err := checkVaultPolicies(config.kubeClient, config.akvsClient, namespace, azureKeyVaultSecret)
+	if _, denied := err.(*policyDeniedError); denied {
+		log.Infof("denied azurekeyvaultsecret '%s' in namespace '%s': %s", azureKeyVaultSecret.Name, namespace, err.Error())
+		return true, validating.ValidatorResult{Valid: false, Message: err.Error()}, nil
+	}
+	if err != nil {
+		log.Errorf("failed to check azurekeyvaultpolicies for azurekeyvaultsecret '%s' in namespace '%s', error: %+v", azureKeyVaultSecret.Name, namespace, err)
+		return true, validating.ValidatorResult{}, err
+	}
+
+	if config.vaultService != nil {
+		vaultSpec, err := vaultSpecWithDefaults(config.akvsClient, namespace, azureKeyVaultSecret)
+		if err != nil {
+			log.Errorf("failed to get azurekeyvaultdefault for azurekeyvaultsecret '%s' in namespace '%s', error: %+v", azureKeyVaultSecret.Name, namespace, err)
+			return true, validating.ValidatorResult{}, err
+		}
+		err = checkVaultObject(config.vaultService, &vaultSpec, config.vaultPrecheckTimeout, config.vaultPrecheckFailOpen)
+		if err != nil {
+			log.Infof("denied azurekeyvaultsecret '%s' in namespace '%s': %s", azureKeyVaultSecret.Name, namespace, err.Error())
+			return true, validating.ValidatorResult{Valid: false, Message: err.Error()}, nil
+		}
+	}
+	return false, validating.ValidatorResult{Valid: true}, nil
+}
+
+// policyDeniedError is returned when the AzureKeyVaultPolicies do not allow a AzureKeyVaultSecret
+type policyDeniedError struct {
+	err error
+}
+
+func (e *policyDeniedError) Error() string {
+	return fmt.Sprintf("azurekeyvaultsecret not allowed by azurekeyvaultpolicies: %s", e.err.Error())
+}
+
+// checkVaultPolicies returns a policyDeniedError if the AzureKeyVaultPolicies do not allow the Azure Key
+// Vault of the AzureKeyVaultSecret in the namespace, after applying the AzureKeyVaultDefault of the namespace
+func checkVaultPolicies(kubeClient kubernetes.Interface, akvsClient clientset.Interface, namespace string, azureKeyVaultSecret *akv.AzureKeyVaultSecret) error {
+	policies, err := akvsClient.KeyvaultV2alpha1().AzureKeyVaultPolicies().List(metav1.ListOptions{})
+	if errors.IsNotFound(err) {
+		return nil // AzureKeyVaultPolicy CRD not installed
+	}
+	if err != nil {
+		return err
+	}
+	if len(policies.Items) == 0 {
+		return nil
+	}
+
+	vault, err := vaultSpecWithDefaults(akvsClient, namespace, azureKeyVaultSecret)
+	if err != nil {
+		return err
+	}
+
+	ns, err := kubeClient.CoreV1().Namespaces().Get(namespace, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	checked := make([]*akv.AzureKeyVaultPolicy, len(policies.Items))
+	for i := range policies.Items {
+		checked[i] = &policies.Items[i]
+	}
+	if err = akv.CheckPolicies(checked, namespace, ns.Labels, &vault); err != nil {
+		return &policyDeniedError{err: err}
+	}
+	return nil
+}
+
+// vaultSpecWithDefaults returns the Azure Key Vault spec of the AzureKeyVaultSecret, after applying
+// the AzureKeyVaultDefault of the namespace
+func vaultSpecWithDefaults(akvsClient clientset.Interface, namespace string, azureKeyVaultSecret *akv.AzureKeyVaultSecret) (akv.AzureKeyVault, error) {
+	vault := azureKeyVaultSecret.Spec.Vault
+	defaults, err := akvsClient.KeyvaultV2alpha1().AzureKeyVaultDefaults(namespace).List(metav1.ListOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return vault, err
+	}
+	if err == nil && len(defaults.Items) == 1 {
+		defaults.Items[0].Spec.Vault.ApplyTo(&vault)
+	}
+	return vault, nil
+}
+
+func validatingHandlerFor(config validating.WebhookConfig, validator validating.Validator, logger internalLog.Logger) http.Handler {
+	webhook, err := validating.NewWebhook(config, validator, nil, nil, logger)
+	if err != nil {
+		log.Errorf("error creating webhook: %s", err)
+		os.Exit(1)
+	}
+
+	handler, err := whhttp.HandlerFor(webhook)
+	if err != nil {
+		log.Errorf("error creating webhook: %s", err)
+		os.Exit(1)
+	}
+
+	return handler
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"testing"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	akvsfake "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/client/clientset/versioned/fake"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newPolicyTestSecret(vaultName string) *akv.AzureKeyVaultSecret {
+	return &akv.AzureKeyVaultSecret{
+		ObjectMeta: metav1.ObjectMeta{Name: "my-secret", Namespace: "team-a"},
+		Spec: akv.AzureKeyVaultSecretSpec{
+			Vault: akv.AzureKeyVault{
+				Name:   vaultName,
+				Object: akv.AzureKeyVaultObject{Name: "my-object", Type: akv.AzureKeyVaultObjectTypeSecret},
+			},
+		},
+	}
+}
+
+func newPolicyTestClients(policies []akv.AzureKeyVaultPolicy, defaults ...akv.AzureKeyVaultDefault) (*k8sfake.Clientset, *akvsfake.Clientset) {
+	kubeClient := k8sfake.NewSimpleClientset(&corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"team": "a"}},
+	})
+
+	// The fake clientset cannot list objects of the keyvault.azure.spv.no group from its tracker
+	akvsClient := akvsfake.NewSimpleClientset()
+	akvsClient.PrependReactor("list", "azurekeyvaultpolicies", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, &akv.AzureKeyVaultPolicyList{Items: policies}, nil
+	})
+	akvsClient.PrependReactor("list", "azurekeyvaultdefaults", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, &akv.AzureKeyVaultDefaultList{Items: defaults}, nil
+	})
+	return kubeClient, akvsClient
+}
+
+func TestCheckVaultPoliciesAllowsWithoutPolicies(t *testing.T) {
+	kubeClient, akvsClient := newPolicyTestClients(nil)
+
+	if err := checkVaultPolicies(kubeClient, akvsClient, "team-a", newPolicyTestSecret("any-vault")); err != nil {
+		t.Errorf("expected azurekeyvaultsecret to be allowed without policies, got %+v", err)
+	}
+}
+
+func TestCheckVaultPoliciesAllowsVault(t *testing.T) {
+	kubeClient, akvsClient := newPolicyTestClients([]akv.AzureKeyVaultPolicy{{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a"},
+		Spec: akv.AzureKeyVaultPolicySpec{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+			Vaults:            []string{"team-a-vault"},
+		},
+	}})
+
+	if err := checkVaultPolicies(kubeClient, akvsClient, "team-a", newPolicyTestSecret("team-a-vault")); err != nil {
+		t.Errorf("expected azurekeyvaultsecret to be allowed, got %+v", err)
+	}
+}
+
+func TestCheckVaultPoliciesDeniesOtherVault(t *testing.T) {
+	kubeClient, akvsClient := newPolicyTestClients([]akv.AzureKeyVaultPolicy{{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-a"},
+		Spec: akv.AzureKeyVaultPolicySpec{
+			Namespaces: []string{"team-a"},
+			Vaults:     []string{"team-a-vault"},
+		},
+	}})
+
+	err := checkVaultPolicies(kubeClient, akvsClient, "team-a", newPolicyTestSecret("team-b-vault"))
+	if _, denied := err.(*policyDeniedError); !denied {
+		t.Errorf("expected azurekeyvaultsecret using another vault to be denied, got %+v", err)
+	}
+}
+
+func TestCheckVaultPoliciesDeniesUnselectedNamespace(t *testing.T) {
+	kubeClient, akvsClient := newPolicyTestClients([]akv.AzureKeyVaultPolicy{{
+		ObjectMeta: metav1.ObjectMeta{Name: "team-b"},
+		Spec: akv.AzureKeyVaultPolicySpec{
+			Namespaces: []string{"team-b"},
+			Vaults:     []string{"team-a-vault"},
+		},
+	}})
+
+	err := checkVaultPolicies(kubeClient, akvsClient, "team-a", newPolicyTestSecret("team-a-vault"))
+	if _, denied := err.(*policyDeniedError); !denied {
+		t.Errorf("expected azurekeyvaultsecret in namespace without policy to be denied, got %+v", err)
+	}
+}
+
+func TestCheckVaultPoliciesAppliesVaultDefault(t *testing.T) {
+	kubeClient, akvsClient := newPolicyTestClients(
+		[]akv.AzureKeyVaultPolicy{{
+			ObjectMeta: metav1.ObjectMeta{Name: "team-a"},
+			Spec: akv.AzureKeyVaultPolicySpec{
+				Namespaces: []string{"team-a"},
+				Vaults:     []string{"team-a-vault"},
+			},
+		}},
+		akv.AzureKeyVaultDefault{
+			ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "team-a"},
+			Spec:       akv.AzureKeyVaultDefaultSpec{Vault: akv.AzureKeyVaultDefaultVault{Name: "team-a-vault"}},
+		},
+	)
+
+	if err := checkVaultPolicies(kubeClient, akvsClient, "team-a", newPolicyTestSecret("")); err != nil {
+		t.Errorf("expected azurekeyvaultsecret using the default vault to be allowed, got %+v", err)
+	}
+}
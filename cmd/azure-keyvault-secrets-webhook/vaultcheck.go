@@ -0,0 +1,74 @@
+// Copyright © 2020 Sparebanken Vest
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	log "github.com/sirupsen/logrus"
+)
+
+// vaultObjectDeniedError is returned when the object of a AzureKeyVaultSecret cannot be read from Azure Key Vault
+type vaultObjectDeniedError struct {
+	err error
+}
+
+func (e *vaultObjectDeniedError) Error() string {
+	return fmt.Sprintf("azurekeyvaultsecret would never sync: %s", e.err.Error())
+}
+
+// checkVaultObject returns a vaultObjectDeniedError if the object of the Azure Key Vault spec does not exist, or
+// cannot be read with the credentials of the webhook. Only the version of the object is asked for, not its value.
+// If Azure Key Vault does not answer within timeout or fails otherwise, the object is allowed when failOpen is set.
+func checkVaultObject(service vault.Service, vaultSpec *akv.AzureKeyVault, timeout time.Duration, failOpen bool) error {
+	// Objects using credential sets are read by the controller with credentials the webhook does not have
+	if vaultSpec.Name == "" || vaultSpec.Object.Name == "" || vaultSpec.CredentialSet != "" {
+		return nil
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := service.GetObjectVersion(vaultSpec)
+		result <- err
+	}()
+
+	var err error
+	select {
+	case err = <-result:
+	case <-time.After(timeout):
+		err = fmt.Errorf("timed out after %s waiting for azure key vault '%s'", timeout, vaultSpec.Name)
+	}
+	if err == nil {
+		return nil
+	}
+
+	if forbidden, ok := vault.AsForbidden(err); ok {
+		objectType := vaultSpec.Object.Type.AzureObjectType()
+		return &vaultObjectDeniedError{err: fmt.Errorf("access to %s '%s' denied: %s",
+			objectType, vaultSpec.Object.Name, forbidden.Remediation(vaultSpec.Name, string(objectType)))}
+	}
+	if vault.IsNotFound(err) || vault.IsSoftDeleted(err) {
+		return &vaultObjectDeniedError{err: err}
+	}
+
+	if failOpen {
+		log.Warnf("allowing azurekeyvaultsecret without checking %s '%s' in azure key vault '%s', error: %+v", vaultSpec.Object.Type, vaultSpec.Object.Name, vaultSpec.Name, err)
+		return nil
+	}
+	return &vaultObjectDeniedError{err: fmt.Errorf("failed to check %s '%s' in azure key vault '%s': %s", vaultSpec.Object.Type, vaultSpec.Object.Name, vaultSpec.Name, err.Error())}
+}
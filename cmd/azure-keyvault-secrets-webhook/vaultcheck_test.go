@@ -0,0 +1,105 @@
+// Copyright © 2020 Sparebanken Vest
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client/fake"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+)
+
+// slowVaultService blocks GetObjectVersion until released
+type slowVaultService struct {
+	vault.Service
+	release chan struct{}
+}
+
+func (s *slowVaultService) GetObjectVersion(vaultSpec *akv.AzureKeyVault) (*vault.ObjectVersion, error) {
+	<-s.release
+	return &vault.ObjectVersion{}, nil
+}
+
+func TestCheckVaultObjectAllowsExistingObject(t *testing.T) {
+	service := fake.NewService()
+	service.SetSecret("my-vault", "my-object", "value")
+
+	if err := checkVaultObject(service, &newPolicyTestSecret("my-vault").Spec.Vault, time.Second, false); err != nil {
+		t.Errorf("expected existing object to be allowed, got %+v", err)
+	}
+}
+
+func TestCheckVaultObjectDeniesMissingObject(t *testing.T) {
+	service := fake.NewService()
+
+	err := checkVaultObject(service, &newPolicyTestSecret("my-vault").Spec.Vault, time.Second, true)
+	if _, denied := err.(*vaultObjectDeniedError); !denied {
+		t.Errorf("expected missing object to be denied, got %+v", err)
+	}
+}
+
+func TestCheckVaultObjectDeniesForbiddenObject(t *testing.T) {
+	service := fake.NewService()
+	service.SetError("my-vault", "secret", "my-object", autorest.DetailedError{StatusCode: http.StatusForbidden})
+
+	err := checkVaultObject(service, &newPolicyTestSecret("my-vault").Spec.Vault, time.Second, true)
+	if _, denied := err.(*vaultObjectDeniedError); !denied {
+		t.Errorf("expected object the webhook cannot read to be denied, got %+v", err)
+	}
+}
+
+func TestCheckVaultObjectFailOpen(t *testing.T) {
+	service := fake.NewService()
+	service.SetError("my-vault", "secret", "my-object", fmt.Errorf("vault unavailable"))
+	vaultSpec := &newPolicyTestSecret("my-vault").Spec.Vault
+
+	if err := checkVaultObject(service, vaultSpec, time.Second, true); err != nil {
+		t.Errorf("expected object to be allowed when failing open, got %+v", err)
+	}
+	if _, denied := checkVaultObject(service, vaultSpec, time.Second, false).(*vaultObjectDeniedError); !denied {
+		t.Error("expected object to be denied when not failing open")
+	}
+}
+
+func TestCheckVaultObjectTimeout(t *testing.T) {
+	service := &slowVaultService{release: make(chan struct{})}
+	defer close(service.release)
+	vaultSpec := &newPolicyTestSecret("my-vault").Spec.Vault
+
+	if err := checkVaultObject(service, vaultSpec, 10*time.Millisecond, true); err != nil {
+		t.Errorf("expected object to be allowed on timeout when failing open, got %+v", err)
+	}
+	if _, denied := checkVaultObject(service, vaultSpec, 10*time.Millisecond, false).(*vaultObjectDeniedError); !denied {
+		t.Error("expected object to be denied on timeout when not failing open")
+	}
+}
+
+func TestCheckVaultObjectSkipsCredentialSet(t *testing.T) {
+	service := fake.NewService()
+	vaultSpec := &newPolicyTestSecret("my-vault").Spec.Vault
+	vaultSpec.CredentialSet = "team-a"
+
+	if err := checkVaultObject(service, vaultSpec, time.Second, false); err != nil {
+		t.Errorf("expected object using a credential set not to be checked, got %+v", err)
+	}
+	if calls := service.Calls("GetObjectVersion"); calls != 0 {
+		t.Errorf("expected no request to azure key vault, got %d", calls)
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/cmd/azure-keyvault-controller/controller"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newDiffCommand(p *plugin) *cobra.Command {
+	return &cobra.Command{
+		Use:   "diff NAME",
+		Short: "Compare a AzureKeyVaultSecret with what was last synced and with its output Secret",
+		Long: "Compare the Azure Key Vault object of a AzureKeyVaultSecret with the one last synced, " +
+			"and check if its output Secret has been changed since it was synced. Exits with an error if they differ.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return p.diff(args[0])
+		},
+	}
+}
+
+func (p *plugin) diff(name string) error {
+	s, err := p.azureKeyVaultSecretClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(p.namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	var differences []string
+	w := tabwriter.NewWriter(p.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "\tSPEC\tSYNCED")
+
+	syncedVault := s.Status.VaultName
+	fmt.Fprintf(w, "Vault\t%s\t%s\n", s.Spec.Vault.Name, valueOrNone(syncedVault))
+	if syncedVault != "" && syncedVault != s.Spec.Vault.Name && syncedVault != s.Spec.Vault.Fallback {
+		differences = append(differences, "vault")
+	}
+
+	specVersion := s.Spec.Vault.Object.Version
+	if specVersion == "" {
+		specVersion = "latest"
+	}
+	fmt.Fprintf(w, "Version\t%s\t%s\n", specVersion, valueOrNone(s.Status.ObjectVersion))
+	if s.Spec.Vault.Object.Version != "" && s.Status.ObjectVersion != "" && s.Spec.Vault.Object.Version != s.Status.ObjectVersion {
+		differences = append(differences, "version")
+	}
+
+	secretName := s.Status.SecretName
+	if secretName == "" {
+		secretName = s.Spec.Output.Secret.Name
+	}
+
+	if secretName == "" {
+		fmt.Fprintln(w, "Secret\t<none>\t")
+	} else {
+		secret, err := p.kubeClient.CoreV1().Secrets(s.Namespace).Get(secretName, metav1.GetOptions{})
+		if err == nil && secret.Data[controller.ChunkIndexKey] != nil {
+			secret, err = p.assembleChunks(secret)
+		}
+		switch {
+		case errors.IsNotFound(err):
+			fmt.Fprintf(w, "Secret\t%s\tmissing\n", secretName)
+			differences = append(differences, "secret missing")
+		case err != nil:
+			return err
+		case controller.HasSecretDrifted(s, secret):
+			fmt.Fprintf(w, "Secret\t%s\tchanged since synced\n", secretName)
+			differences = append(differences, "secret changed")
+		default:
+			fmt.Fprintf(w, "Secret\t%s\tin sync\n", secretName)
+		}
+
+		if secret != nil && err == nil {
+			var keys []string
+			for key := range secret.Data {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			fmt.Fprintf(w, "Keys\t%s\t\n", strings.Join(keys, ","))
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(differences) > 0 {
+		return fmt.Errorf("azurekeyvaultsecret/%s differs: %s", name, strings.Join(differences, ", "))
+	}
+	return nil
+}
+
+// assembleChunks returns a copy of a chunked Secret with the data of its chunks, so it is compared
+// with what was synced
+func (p *plugin) assembleChunks(secret *corev1.Secret) (*corev1.Secret, error) {
+	data, err := controller.AssembleSecretChunks(secret, func(name string) (*corev1.Secret, error) {
+		return p.kubeClient.CoreV1().Secrets(secret.Namespace).Get(name, metav1.GetOptions{})
+	})
+	if err != nil {
+		return nil, err
+	}
+	assembled := secret.DeepCopy()
+	assembled.Data = data
+	return assembled, nil
+}
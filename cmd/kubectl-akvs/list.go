@@ -0,0 +1,78 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/cmd/azure-keyvault-controller/controller"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newListCommand(p *plugin) *cobra.Command {
+	var allNamespaces bool
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List AzureKeyVaultSecrets with their sync state",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			namespace := p.namespace
+			if allNamespaces {
+				namespace = metav1.NamespaceAll
+			}
+			return p.list(namespace)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&allNamespaces, "all-namespaces", "A", false, "List AzureKeyVaultSecrets in all namespaces")
+	return cmd
+}
+
+func (p *plugin) list(namespace string) error {
+	list, err := p.azureKeyVaultSecretClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(p.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tNAME\tVAULT\tOBJECT\tSECRET\tVERSION\tSTATE")
+	for i := range list.Items {
+		s := &list.Items[i]
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s/%s\t%s\t%s\t%s\n",
+			s.Namespace,
+			s.Name,
+			s.Spec.Vault.Name,
+			s.Spec.Vault.Object.Type,
+			s.Spec.Vault.Object.Name,
+			valueOrNone(s.Status.SecretName),
+			valueOrNone(s.Status.ObjectVersion),
+			controller.SyncState(s),
+		)
+	}
+	return w.Flush()
+}
+
+// syncState summarizes the conditions of a AzureKeyVaultSecret
+func valueOrNone(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+	return value
+}
@@ -0,0 +1,102 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-akvs is a kubectl plugin for inspecting and managing AzureKeyVaultSecrets, installed by
+// putting the binary in PATH and running it as 'kubectl akvs'
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	clientset "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/client/clientset/versioned"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// plugin has the clients and settings shared by all subcommands
+type plugin struct {
+	kubeClient                kubernetes.Interface
+	azureKeyVaultSecretClient clientset.Interface
+	namespace                 string
+	out                       io.Writer
+	now                       func() time.Time
+}
+
+func newRootCommand(p *plugin) *cobra.Command {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	overrides := &clientcmd.ConfigOverrides{}
+
+	cmd := &cobra.Command{
+		Use:           "kubectl-akvs",
+		Short:         "Inspect and manage AzureKeyVaultSecrets",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Clients are set up front in tests
+			if p.kubeClient != nil {
+				return nil
+			}
+
+			clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
+			namespace, _, err := clientConfig.Namespace()
+			if err != nil {
+				return err
+			}
+			p.namespace = namespace
+
+			cfg, err := clientConfig.ClientConfig()
+			if err != nil {
+				return fmt.Errorf("failed to build kubeconfig, error: %+v", err)
+			}
+
+			if p.kubeClient, err = kubernetes.NewForConfig(cfg); err != nil {
+				return fmt.Errorf("failed to build kubernetes clientset, error: %+v", err)
+			}
+			if p.azureKeyVaultSecretClient, err = clientset.NewForConfig(cfg); err != nil {
+				return fmt.Errorf("failed to build azurekeyvaultsecret clientset, error: %+v", err)
+			}
+			return nil
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&loadingRules.ExplicitPath, "kubeconfig", "", "Path to the kubeconfig file")
+	cmd.PersistentFlags().StringVar(&overrides.CurrentContext, "context", "", "The kubeconfig context to use")
+	cmd.PersistentFlags().StringVarP(&overrides.Context.Namespace, "namespace", "n", "", "The namespace of the AzureKeyVaultSecrets")
+
+	cmd.AddCommand(
+		newListCommand(p),
+		newStatusCommand(p),
+		newSyncNowCommand(p),
+		newDiffCommand(p),
+	)
+	return cmd
+}
+
+func main() {
+	p := &plugin{
+		out: os.Stdout,
+		now: time.Now,
+	}
+
+	if err := newRootCommand(p).Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
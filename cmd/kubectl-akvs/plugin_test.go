@@ -0,0 +1,147 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/cmd/azure-keyvault-controller/controller"
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	akvfake "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/client/clientset/versioned/fake"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestPlugin(t *testing.T, objects []runtime.Object, azureKeyVaultSecrets ...*akv.AzureKeyVaultSecret) (*plugin, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	p := &plugin{
+		kubeClient:                k8sfake.NewSimpleClientset(objects...),
+		azureKeyVaultSecretClient: akvfake.NewSimpleClientset(),
+		namespace:                 "default",
+		out:                       out,
+		now:                       func() time.Time { return time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC) },
+	}
+
+	// The fake clientset tracks AzureKeyVaultSecrets by the resource its client uses only when created through it
+	for _, azureKeyVaultSecret := range azureKeyVaultSecrets {
+		if _, err := p.azureKeyVaultSecretClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(azureKeyVaultSecret.Namespace).Create(azureKeyVaultSecret); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return p, out
+}
+
+func newAzureKeyVaultSecret(name string) *akv.AzureKeyVaultSecret {
+	return &akv.AzureKeyVaultSecret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+		Spec: akv.AzureKeyVaultSecretSpec{
+			Vault: akv.AzureKeyVault{
+				Name: "my-vault",
+				Object: akv.AzureKeyVaultObject{
+					Name: "my-secret",
+					Type: akv.AzureKeyVaultObjectTypeSecret,
+				},
+			},
+			Output: akv.AzureKeyVaultOutput{
+				Secret: akv.AzureKeyVaultOutputSecret{
+					Name:    "my-k8s-secret",
+					DataKey: "value",
+				},
+			},
+		},
+		Status: akv.AzureKeyVaultSecretStatus{
+			SecretName:    "my-k8s-secret",
+			VaultName:     "my-vault",
+			ObjectVersion: "abc123",
+		},
+	}
+}
+
+func run(p *plugin, args ...string) error {
+	cmd := newRootCommand(p)
+	cmd.SetArgs(args)
+	return cmd.Execute()
+}
+
+func TestStatus(t *testing.T) {
+	p, out := newTestPlugin(t, nil, newAzureKeyVaultSecret("synced"))
+	if err := run(p, "status", "synced"); err != nil {
+		t.Fatalf("status failed: %+v", err)
+	}
+
+	for _, expected := range []string{"my-vault", "secret/my-secret", "my-k8s-secret", "abc123", "Synced"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected status to contain '%s', got:\n%s", expected, out.String())
+		}
+	}
+
+	if err := run(p, "status", "missing"); err == nil {
+		t.Error("expected error for missing azurekeyvaultsecret")
+	}
+}
+
+func TestSyncNow(t *testing.T) {
+	p, _ := newTestPlugin(t, nil, newAzureKeyVaultSecret("synced"))
+	if err := run(p, "sync-now", "synced"); err != nil {
+		t.Fatalf("sync-now failed: %+v", err)
+	}
+
+	s, err := p.azureKeyVaultSecretClient.KeyvaultV2alpha1().AzureKeyVaultSecrets("default").Get("synced", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Annotations[controller.ForceSyncAnnotation] != "2020-01-01T00:00:00Z" {
+		t.Errorf("expected force sync annotation to be set, got: %v", s.Annotations)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "my-k8s-secret",
+			Namespace: "default",
+		},
+		Data: map[string][]byte{
+			"value": []byte("secret"),
+		},
+	}
+
+	inSync := newAzureKeyVaultSecret("in-sync")
+	inSync.Status.SecretHash = "sha256:79182a0a052e863b59e36e12976f8ebf2246a95e2ba9101991ef1bd41b102d6e"
+
+	p, out := newTestPlugin(t, []runtime.Object{secret}, inSync)
+	if err := run(p, "diff", "in-sync"); err != nil {
+		t.Fatalf("expected no difference, got: %+v\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "in sync") {
+		t.Errorf("expected secret to be in sync, got:\n%s", out.String())
+	}
+
+	secret.Data["value"] = []byte("changed")
+	p, out = newTestPlugin(t, []runtime.Object{secret}, inSync)
+	if err := run(p, "diff", "in-sync"); err == nil || !strings.Contains(err.Error(), "secret changed") {
+		t.Errorf("expected secret to have changed, got: %v\n%s", err, out.String())
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/cmd/azure-keyvault-controller/controller"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newStatusCommand(p *plugin) *cobra.Command {
+	return &cobra.Command{
+		Use:   "status NAME",
+		Short: "Show the sync status of a AzureKeyVaultSecret",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return p.status(args[0])
+		},
+	}
+}
+
+func (p *plugin) status(name string) error {
+	s, err := p.azureKeyVaultSecretClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(p.namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(p.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "Name:\t%s\n", s.Name)
+	fmt.Fprintf(w, "Namespace:\t%s\n", s.Namespace)
+	fmt.Fprintf(w, "Vault:\t%s\n", s.Spec.Vault.Name)
+	fmt.Fprintf(w, "Object:\t%s/%s\n", s.Spec.Vault.Object.Type, s.Spec.Vault.Object.Name)
+	fmt.Fprintf(w, "State:\t%s\n", controller.SyncState(s))
+	fmt.Fprintf(w, "Secret:\t%s\n", valueOrNone(s.Status.SecretName))
+	fmt.Fprintf(w, "Synced from vault:\t%s\n", valueOrNone(s.Status.VaultName))
+	fmt.Fprintf(w, "Object version:\t%s\n", valueOrNone(s.Status.ObjectVersion))
+	fmt.Fprintf(w, "Last Azure update:\t%s\n", formatTime(s.Status.LastAzureUpdate))
+	if s.Status.CertificateThumbprint != "" {
+		fmt.Fprintf(w, "Certificate thumbprint:\t%s\n", s.Status.CertificateThumbprint)
+	}
+	if s.Status.RetryCount > 0 {
+		fmt.Fprintf(w, "Failures in a row:\t%d\n", s.Status.RetryCount)
+		fmt.Fprintf(w, "Next retry:\t%s\n", formatTime(s.Status.NextRetryTime))
+	}
+
+	if len(s.Status.Conditions) > 0 {
+		fmt.Fprintln(w, "Conditions:")
+		for _, condition := range s.Status.Conditions {
+			fmt.Fprintf(w, "  %s=%s\t%s\t%s\n", condition.Type, condition.Status, condition.Reason, condition.Message)
+		}
+	}
+
+	if len(s.Status.Consumers) > 0 {
+		fmt.Fprintln(w, "Consumers:")
+		for _, consumer := range s.Status.Consumers {
+			fmt.Fprintf(w, "  %s/%s\n", consumer.Kind, consumer.Name)
+		}
+	}
+	return w.Flush()
+}
+
+func formatTime(t metav1.Time) string {
+	if t.IsZero() {
+		return "<none>"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,61 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/cmd/azure-keyvault-controller/controller"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func newSyncNowCommand(p *plugin) *cobra.Command {
+	return &cobra.Command{
+		Use:   "sync-now NAME",
+		Short: "Make the controller poll a AzureKeyVaultSecret from Azure Key Vault right away",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return p.syncNow(args[0])
+		},
+	}
+}
+
+// syncNow sets the force sync annotation to the current time, which the controller reacts to by
+// polling Azure Key Vault, also for AzureKeyVaultSecrets backing off after failures
+func (p *plugin) syncNow(name string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				controller.ForceSyncAnnotation: p.now().Format(time.RFC3339),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = p.azureKeyVaultSecretClient.KeyvaultV2alpha1().AzureKeyVaultSecrets(p.namespace).Patch(name, types.MergePatchType, patch)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(p.out, "azurekeyvaultsecret/%s marked for sync\n", name)
+	return nil
+}
@@ -9,6 +9,7 @@ require (
 	github.com/Azure/go-autorest/autorest v0.11.4
 	github.com/Azure/go-autorest/autorest/adal v0.9.0
 	github.com/Azure/go-autorest/autorest/azure/auth v0.4.2
+	github.com/Azure/go-autorest/autorest/date v0.3.0
 	github.com/appscode/go v0.0.0-20191119085241-0887d8ec2ecc
 	github.com/docker/docker v0.7.3-0.20190327010347-be7ac8be2ae0
 	github.com/docker/go-connections v0.4.0 // indirect
@@ -16,18 +17,25 @@ require (
 	github.com/heroku/docker-registry-client v0.0.0-20190909225348-afc9e1acc3d5
 	github.com/opencontainers/image-spec v1.0.1
 	github.com/pkg/errors v0.9.1
-	github.com/prometheus/client_golang v1.1.0
+	github.com/prometheus/client_golang v1.5.0
 	github.com/sirupsen/logrus v1.6.0
 	github.com/slok/kubewebhook v0.4.0
+	github.com/spf13/cobra v0.0.5
 	github.com/spf13/pflag v1.0.5
 	github.com/spf13/viper v1.7.1
 	github.com/stretchr/testify v1.6.1
+	go.opencensus.io v0.22.0
 	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+	golang.org/x/time v0.0.0-20190308202827-9d24e82272b4
+	google.golang.org/grpc v1.27.1
 	gopkg.in/yaml.v2 v2.3.0
 	istio.io/pkg v0.0.0-20201002213810-7a3a61d8b48a
 	k8s.io/api v0.17.2
+	k8s.io/apiextensions-apiserver v0.17.2
 	k8s.io/apimachinery v0.17.2
 	k8s.io/client-go v0.17.2
 	kmodules.xyz/client-go v0.0.0-20200521013203-6fe0a448d053
+	sigs.k8s.io/secrets-store-csi-driver v0.0.16
+	sigs.k8s.io/testing_frameworks v0.1.2
 	sigs.k8s.io/yaml v1.2.0
 )
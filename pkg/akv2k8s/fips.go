@@ -0,0 +1,32 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package akv2k8s
+
+import "errors"
+
+// FIPS is true when cryptographic primitives not approved by FIPS 140-2,
+// like MD5 hashing and PFX (PKCS#12) parsing, must not be used. It is always
+// true when built with the boringcrypto build tag.
+var FIPS = fipsBuild
+
+// ErrNotAllowedInFIPSMode is returned when an operation requires cryptography not approved by FIPS 140-2
+var ErrNotAllowedInFIPSMode = errors.New("not allowed in FIPS mode")
+
+// EnableFIPS enables FIPS mode. FIPS mode can not be disabled in builds using BoringCrypto.
+func EnableFIPS(enable bool) {
+	FIPS = fipsBuild || enable
+}
@@ -0,0 +1,156 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const secret = "p@ss\"word\n42"
+
+// newTestLogger returns a logger at debug level writing to the buffer through a Formatter
+func newTestLogger(formatter log.Formatter, registry *Registry) (*log.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	logger := log.New()
+	logger.SetOutput(&buf)
+	logger.SetLevel(log.DebugLevel)
+	logger.SetFormatter(&Formatter{Formatter: formatter, Registry: registry})
+	return logger, &buf
+}
+
+func TestValueNeverFormatsValue(t *testing.T) {
+	value := String(secret)
+	for _, verb := range []string{"%v", "%+v", "%#v", "%s", "%q", "%x", "%X", "%d", "%10.3s"} {
+		if formatted := fmt.Sprintf(verb, value); formatted != Placeholder {
+			t.Errorf("expected %s to format as %s, got %s", verb, Placeholder, formatted)
+		}
+	}
+	if formatted := fmt.Sprint(struct{ Password Value }{value}); strings.Contains(formatted, "word") {
+		t.Errorf("expected value in struct to be redacted, got %s", formatted)
+	}
+
+	marshaled, err := json.Marshal(map[string]interface{}{"password": value})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(marshaled) != `{"password":"[REDACTED]"}` {
+		t.Errorf("expected value to marshal redacted, got %s", marshaled)
+	}
+	if string(value.Reveal()) != secret {
+		t.Error("expected Reveal to return the value")
+	}
+}
+
+func TestValuesFormatKeysOnly(t *testing.T) {
+	values := Values{"password": []byte(secret), "username": []byte("admin-user")}
+	expected := "map[password:[REDACTED] username:[REDACTED]]"
+	for _, verb := range []string{"%v", "%+v", "%#v", "%s", "%q"} {
+		if formatted := fmt.Sprintf(verb, values); formatted != expected {
+			t.Errorf("expected %s to format as %s, got %s", verb, expected, formatted)
+		}
+	}
+
+	marshaled, err := json.Marshal(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(marshaled), "p@ss") || strings.Contains(string(marshaled), "admin-user") {
+		t.Errorf("expected values to marshal redacted, got %s", marshaled)
+	}
+}
+
+func TestNoValueReachesLogOutput(t *testing.T) {
+	for name, formatter := range map[string]log.Formatter{
+		"text": &log.TextFormatter{DisableColors: true},
+		"json": &log.JSONFormatter{},
+	} {
+		registry := NewRegistry()
+		registry.Set("default/my-secret", []byte(secret))
+		logger, buf := newTestLogger(formatter, registry)
+
+		logger.WithField("value", String(secret)).Debug("tainted field")
+		logger.WithField("data", Values{"key": []byte(secret)}).Debug("tainted data")
+		logger.Debugf("value in message: %s", secret)
+		logger.WithField("raw", secret).Debug("raw field")
+		logger.WithError(errors.New("failed to parse '" + secret + "'")).Error("error with value")
+
+		if output := buf.String(); strings.Contains(output, "word") {
+			t.Errorf("%s: expected no secret value in log output, got %s", name, output)
+		}
+		if count := strings.Count(buf.String(), Placeholder); count < 5 {
+			t.Errorf("%s: expected every entry to be redacted, got %d redactions in %s", name, count, buf.String())
+		}
+	}
+}
+
+func TestRegistryForgetsValues(t *testing.T) {
+	registry := NewRegistry()
+	registry.Set("default/my-secret", []byte("first-value"))
+	registry.Set("default/my-secret", []byte("second-value"))
+
+	if redacted := string(registry.Redact([]byte("first-value second-value"))); redacted != "first-value "+Placeholder {
+		t.Errorf("expected only current value to be redacted, got %s", redacted)
+	}
+
+	registry.Delete("default/my-secret")
+	if redacted := string(registry.Redact([]byte("second-value"))); redacted != "second-value" {
+		t.Errorf("expected deleted value not to be redacted, got %s", redacted)
+	}
+}
+
+func TestRegistryIgnoresShortValues(t *testing.T) {
+	registry := NewRegistry()
+	registry.Set("default/my-secret", []byte("info"))
+
+	if redacted := string(registry.Redact([]byte("level=info"))); redacted != "level=info" {
+		t.Errorf("expected short value not to be redacted, got %s", redacted)
+	}
+}
+
+func TestRegistryRedactsLongestValueFirst(t *testing.T) {
+	registry := NewRegistry()
+	registry.Set("a", []byte("secret"))
+	registry.Set("b", []byte("secret-longer"))
+
+	if redacted := string(registry.Redact([]byte("secret-longer"))); redacted != Placeholder {
+		t.Errorf("expected longest value to be redacted, got %s", redacted)
+	}
+}
+
+func TestRegistryKeepsReplacerForUnchangedValues(t *testing.T) {
+	registry := NewRegistry()
+	registry.Set("default/my-secret", []byte("first-value"))
+	replacer := registry.getReplacer()
+
+	registry.Set("default/my-secret", []byte("first-value"))
+	registry.Delete("default/other-secret")
+	if registry.getReplacer() != replacer {
+		t.Error("expected replacer to be kept when values are unchanged")
+	}
+
+	registry.Set("default/my-secret", []byte("second-value"))
+	if registry.getReplacer() == replacer {
+		t.Error("expected replacer to be rebuilt when values change")
+	}
+}
@@ -0,0 +1,165 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// minLength is the length of the shortest value redacted by a Registry. Shorter values would
+// redact common words of log entries, and are only kept out of logs by Value.
+const minLength = 6
+
+// Registry holds the secret values to remove from log entries, grouped by owner so values
+// are forgotten when their owner is deleted or gets new values. It is safe for concurrent use.
+type Registry struct {
+	mu       sync.RWMutex
+	values   map[string][][]byte
+	replacer *strings.Replacer
+}
+
+// Default is the registry used by Formatter when none is given
+var Default = NewRegistry()
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{values: map[string][][]byte{}}
+}
+
+// Set replaces the values registered for the owner. The replacer is only rebuilt when the
+// values change, as Set is called on every sync of the owner.
+func (r *Registry) Set(owner string, values ...[]byte) {
+	var kept [][]byte
+	for _, value := range values {
+		if len(value) >= minLength {
+			kept = append(kept, value)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if equalValues(r.values[owner], kept) {
+		return
+	}
+	if len(kept) == 0 {
+		delete(r.values, owner)
+	} else {
+		r.values[owner] = kept
+	}
+	r.replacer = nil
+}
+
+func equalValues(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Delete forgets the values registered for the owner
+func (r *Registry) Delete(owner string) {
+	r.Set(owner)
+}
+
+// Redact returns the text with all registered values replaced by Placeholder, also where
+// they are quoted and escaped like by the text and JSON log formats
+func (r *Registry) Redact(text []byte) []byte {
+	replacer := r.getReplacer()
+	if replacer == nil {
+		return text
+	}
+	return []byte(replacer.Replace(string(text)))
+}
+
+func (r *Registry) getReplacer() *strings.Replacer {
+	r.mu.RLock()
+	replacer, count := r.replacer, len(r.values)
+	r.mu.RUnlock()
+	if replacer != nil || count == 0 {
+		return replacer
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.replacer != nil {
+		return r.replacer
+	}
+
+	forms := map[string]bool{}
+	for _, values := range r.values {
+		for _, value := range values {
+			forms[string(value)] = true
+			quoted := strconv.Quote(string(value))
+			forms[quoted[1:len(quoted)-1]] = true
+			if escaped, err := json.Marshal(string(value)); err == nil {
+				forms[string(escaped[1:len(escaped)-1])] = true
+			}
+		}
+	}
+
+	// strings.Replacer prefers the first of overlapping values, so longer values go first
+	sorted := make([]string, 0, len(forms))
+	for form := range forms {
+		sorted = append(sorted, form)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if len(sorted[i]) != len(sorted[j]) {
+			return len(sorted[i]) > len(sorted[j])
+		}
+		return sorted[i] < sorted[j]
+	})
+	oldnew := make([]string, 0, len(sorted)*2)
+	for _, form := range sorted {
+		oldnew = append(oldnew, form, Placeholder)
+	}
+	r.replacer = strings.NewReplacer(oldnew...)
+	return r.replacer
+}
+
+// Formatter is a logrus formatter removing the values of a Registry from the entries
+// formatted by another formatter
+type Formatter struct {
+	Formatter log.Formatter
+	Registry  *Registry
+}
+
+// NewFormatter returns a formatter removing the values of the Default registry from the
+// entries formatted by formatter
+func NewFormatter(formatter log.Formatter) *Formatter {
+	return &Formatter{Formatter: formatter, Registry: Default}
+}
+
+// Format implements logrus.Formatter
+func (f *Formatter) Format(entry *log.Entry) ([]byte, error) {
+	formatted, err := f.Formatter.Format(entry)
+	if err != nil {
+		return nil, err
+	}
+	return f.Registry.Redact(formatted), nil
+}
@@ -0,0 +1,119 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package redact keeps secret values out of logs. Values wrapped in Value or Values
+// never format as their content, and Formatter removes values registered in a Registry
+// from log entries, catching values ending up in error messages.
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Placeholder is written instead of secret values
+const Placeholder = "[REDACTED]"
+
+// Value is a secret value that formats as Placeholder with every fmt verb, as JSON and as
+// text, so logging it can not reveal it. The value itself is only available from Reveal.
+type Value struct {
+	value []byte
+}
+
+// NewValue wraps a secret value
+func NewValue(value []byte) Value {
+	return Value{value: value}
+}
+
+// String wraps a secret value given as a string
+func String(value string) Value {
+	return Value{value: []byte(value)}
+}
+
+// Reveal returns the secret value
+func (v Value) Reveal() []byte {
+	return v.value
+}
+
+// String implements fmt.Stringer
+func (v Value) String() string {
+	return Placeholder
+}
+
+// GoString implements fmt.GoStringer, used by %#v
+func (v Value) GoString() string {
+	return Placeholder
+}
+
+// Format implements fmt.Formatter, so no verb or flag formats the value
+func (v Value) Format(f fmt.State, verb rune) {
+	io.WriteString(f, Placeholder)
+}
+
+// MarshalJSON implements json.Marshaler, used by the JSON log format
+func (v Value) MarshalJSON() ([]byte, error) {
+	return json.Marshal(Placeholder)
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (v Value) MarshalText() ([]byte, error) {
+	return []byte(Placeholder), nil
+}
+
+// Values is the data of a Secret, formatting with its keys but without its values
+type Values map[string][]byte
+
+// String implements fmt.Stringer
+func (v Values) String() string {
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("map[")
+	for i, key := range keys {
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		b.WriteString(key + ":" + Placeholder)
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+// GoString implements fmt.GoStringer, used by %#v
+func (v Values) GoString() string {
+	return v.String()
+}
+
+// Format implements fmt.Formatter, so no verb or flag formats the values
+func (v Values) Format(f fmt.State, verb rune) {
+	io.WriteString(f, v.String())
+}
+
+// MarshalJSON implements json.Marshaler, used by the JSON log format
+func (v Values) MarshalJSON() ([]byte, error) {
+	redacted := make(map[string]string, len(v))
+	for key := range v {
+		redacted[key] = Placeholder
+	}
+	return json.Marshal(redacted)
+}
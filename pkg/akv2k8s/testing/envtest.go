@@ -0,0 +1,192 @@
+package testing
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	akv "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	clientset "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/client/clientset/versioned"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	apiextensions "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/testing_frameworks/integration"
+)
+
+// defaultKubebuilderAssets is where etcd and kube-apiserver are looked for if KUBEBUILDER_ASSETS is not set,
+// the same as for envtest in controller-runtime
+const defaultKubebuilderAssets = "/usr/local/kubebuilder/bin"
+
+// Environment is a local etcd and kube-apiserver with the AzureKeyVaultSecret and AzureKeyVaultDefault CRDs installed
+type Environment struct {
+	Config                    *rest.Config
+	KubeClient                kubernetes.Interface
+	AzureKeyVaultSecretClient clientset.Interface
+
+	controlPlane *integration.ControlPlane
+}
+
+// StartEnvironment starts a local Kubernetes API server for end-to-end tests, skipping the test
+// if the envtest binaries are not installed. Stop must be called when the test is done.
+func StartEnvironment(t *testing.T) *Environment {
+	assets := os.Getenv("KUBEBUILDER_ASSETS")
+	if assets == "" {
+		assets = defaultKubebuilderAssets
+	}
+	if _, err := os.Stat(assets); err != nil {
+		t.Skipf("Skipping end-to-end test - no envtest binaries in %s", assets)
+	}
+
+	controlPlane := &integration.ControlPlane{
+		APIServer: &integration.APIServer{Path: filepath.Join(assets, "kube-apiserver")},
+		Etcd:      &integration.Etcd{Path: filepath.Join(assets, "etcd")},
+	}
+	if err := controlPlane.Start(); err != nil {
+		t.Fatalf("failed to start kubernetes control plane, error: %+v", err)
+	}
+
+	config := &rest.Config{Host: controlPlane.APIURL().String()}
+	e := &Environment{Config: config, controlPlane: controlPlane}
+	if err := installCRD(config, azureKeyVaultSecretCRD()); err != nil {
+		e.Stop(t)
+		t.Fatalf("failed to install azurekeyvaultsecret crd, error: %+v", err)
+	}
+	if err := installCRD(config, azureKeyVaultDefaultCRD()); err != nil {
+		e.Stop(t)
+		t.Fatalf("failed to install azurekeyvaultdefault crd, error: %+v", err)
+	}
+	if err := installCRD(config, azureKeyVaultPolicyCRD()); err != nil {
+		e.Stop(t)
+		t.Fatalf("failed to install azurekeyvaultpolicy crd, error: %+v", err)
+	}
+
+	var err error
+	if e.KubeClient, err = kubernetes.NewForConfig(config); err != nil {
+		e.Stop(t)
+		t.Fatalf("failed to create kubernetes client, error: %+v", err)
+	}
+	if e.AzureKeyVaultSecretClient, err = clientset.NewForConfig(config); err != nil {
+		e.Stop(t)
+		t.Fatalf("failed to create azurekeyvaultsecret client, error: %+v", err)
+	}
+	return e
+}
+
+// Stop stops the local Kubernetes API server
+func (e *Environment) Stop(t *testing.T) {
+	if err := e.controlPlane.Stop(); err != nil {
+		t.Errorf("failed to stop kubernetes control plane, error: %+v", err)
+	}
+}
+
+// installCRD creates a CRD and waits until it is established
+func installCRD(config *rest.Config, crd *apiextensionsv1beta1.CustomResourceDefinition) error {
+	client, err := apiextensions.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	if _, err := client.ApiextensionsV1beta1().CustomResourceDefinitions().Create(crd); err != nil {
+		return err
+	}
+
+	return wait.PollImmediate(100*time.Millisecond, 30*time.Second, func() (bool, error) {
+		current, err := client.ApiextensionsV1beta1().CustomResourceDefinitions().Get(crd.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, condition := range current.Status.Conditions {
+			if condition.Type == apiextensionsv1beta1.Established && condition.Status == apiextensionsv1beta1.ConditionTrue {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+}
+
+// azureKeyVaultSecretCRD is the AzureKeyVaultSecret CRD in the group the generated clients use
+func azureKeyVaultSecretCRD() *apiextensionsv1beta1.CustomResourceDefinition {
+	return &apiextensionsv1beta1.CustomResourceDefinition{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: apiextensionsv1beta1.SchemeGroupVersion.String(),
+			Kind:       "CustomResourceDefinition",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "azurekeyvaultsecrets." + akv.SchemeGroupVersion.Group,
+		},
+		Spec: apiextensionsv1beta1.CustomResourceDefinitionSpec{
+			Group: akv.SchemeGroupVersion.Group,
+			Names: apiextensionsv1beta1.CustomResourceDefinitionNames{
+				Kind:       "AzureKeyVaultSecret",
+				ListKind:   "AzureKeyVaultSecretList",
+				Plural:     "azurekeyvaultsecrets",
+				Singular:   "azurekeyvaultsecret",
+				ShortNames: []string{"akvs"},
+			},
+			Scope: apiextensionsv1beta1.NamespaceScoped,
+			Versions: []apiextensionsv1beta1.CustomResourceDefinitionVersion{
+				{Name: akv.SchemeGroupVersion.Version, Served: true, Storage: true},
+			},
+			Subresources: &apiextensionsv1beta1.CustomResourceSubresources{
+				Status: &apiextensionsv1beta1.CustomResourceSubresourceStatus{},
+			},
+		},
+	}
+}
+
+// azureKeyVaultDefaultCRD is the AzureKeyVaultDefault CRD in the group the generated clients use
+func azureKeyVaultDefaultCRD() *apiextensionsv1beta1.CustomResourceDefinition {
+	return &apiextensionsv1beta1.CustomResourceDefinition{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: apiextensionsv1beta1.SchemeGroupVersion.String(),
+			Kind:       "CustomResourceDefinition",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "azurekeyvaultdefaults." + akv.SchemeGroupVersion.Group,
+		},
+		Spec: apiextensionsv1beta1.CustomResourceDefinitionSpec{
+			Group: akv.SchemeGroupVersion.Group,
+			Names: apiextensionsv1beta1.CustomResourceDefinitionNames{
+				Kind:       "AzureKeyVaultDefault",
+				ListKind:   "AzureKeyVaultDefaultList",
+				Plural:     "azurekeyvaultdefaults",
+				Singular:   "azurekeyvaultdefault",
+				ShortNames: []string{"akvd"},
+			},
+			Scope: apiextensionsv1beta1.NamespaceScoped,
+			Versions: []apiextensionsv1beta1.CustomResourceDefinitionVersion{
+				{Name: akv.SchemeGroupVersion.Version, Served: true, Storage: true},
+			},
+		},
+	}
+}
+
+// azureKeyVaultPolicyCRD is the cluster scoped AzureKeyVaultPolicy CRD in the group the generated clients use
+func azureKeyVaultPolicyCRD() *apiextensionsv1beta1.CustomResourceDefinition {
+	return &apiextensionsv1beta1.CustomResourceDefinition{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: apiextensionsv1beta1.SchemeGroupVersion.String(),
+			Kind:       "CustomResourceDefinition",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "azurekeyvaultpolicies." + akv.SchemeGroupVersion.Group,
+		},
+		Spec: apiextensionsv1beta1.CustomResourceDefinitionSpec{
+			Group: akv.SchemeGroupVersion.Group,
+			Names: apiextensionsv1beta1.CustomResourceDefinitionNames{
+				Kind:       "AzureKeyVaultPolicy",
+				ListKind:   "AzureKeyVaultPolicyList",
+				Plural:     "azurekeyvaultpolicies",
+				Singular:   "azurekeyvaultpolicy",
+				ShortNames: []string{"akvp"},
+			},
+			Scope: apiextensionsv1beta1.ClusterScoped,
+			Versions: []apiextensionsv1beta1.CustomResourceDefinitionVersion{
+				{Name: akv.SchemeGroupVersion.Version, Served: true, Storage: true},
+			},
+		},
+	}
+}
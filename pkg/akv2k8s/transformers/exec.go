@@ -0,0 +1,83 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transformers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ExecHandler handles transformation of data by an external command, reading the
+// data on stdin and writing the transformed data to stdout. A WebAssembly module is
+// run as an exec hook through a WebAssembly runtime, like 'wasmtime run module.wasm'.
+type ExecHandler struct {
+	Command []string
+	Timeout time.Duration
+}
+
+// Handle runs the command with the secret on stdin, returning its stdout
+func (h *ExecHandler) Handle(secret string) (string, error) {
+	ctx := context.Background()
+	if h.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+	cmd.Stdin = strings.NewReader(secret)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	// The secret is deliberately left out of errors, as only stderr of the command is safe to log
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("transform command '%s' timed out after %s", h.Command[0], h.Timeout)
+		}
+		return "", fmt.Errorf("transform command '%s' failed: %v: %s", h.Command[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// RegisterExecHooks registers exec hooks as custom transforms from a comma separated list of
+// <name>=<command and arguments separated by spaces>, each killed after the timeout
+func RegisterExecHooks(hooks string, timeout time.Duration) error {
+	for _, hook := range strings.Split(hooks, ",") {
+		hook = strings.TrimSpace(hook)
+		if hook == "" {
+			continue
+		}
+
+		split := strings.SplitN(hook, "=", 2)
+		if len(split) != 2 {
+			return fmt.Errorf("transform hook '%s' must be declared as <name>=<command>", hook)
+		}
+		command := strings.Fields(split[1])
+		if len(command) == 0 {
+			return fmt.Errorf("transform hook '%s' has no command", split[0])
+		}
+		if err := Register(strings.TrimSpace(split[0]), &ExecHandler{Command: command, Timeout: timeout}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
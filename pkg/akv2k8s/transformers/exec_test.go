@@ -0,0 +1,108 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transformers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	akvsv1 "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+)
+
+type upperHandler struct{}
+
+func (h *upperHandler) Handle(secret string) (string, error) {
+	return strings.ToUpper(secret), nil
+}
+
+func TestTransformWithRegisteredTransform(t *testing.T) {
+	if err := Register("test-upper", &upperHandler{}); err != nil {
+		t.Fatal(err)
+	}
+
+	transformator, err := CreateTransformator(&akvsv1.AzureKeyVaultOutput{
+		Transforms: []string{"trim", "test-upper"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newSecret, err := transformator.Transform(testString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newSecret != strings.ToUpper(testStringTrimmed) {
+		t.Errorf("Actual   :%s", newSecret)
+		t.Errorf("Expected :%s", strings.ToUpper(testStringTrimmed))
+	}
+}
+
+func TestRegisterRejectsBuiltinAndDuplicateTransforms(t *testing.T) {
+	if err := Register("trim", &upperHandler{}); err == nil {
+		t.Error("expected error registering built-in transform")
+	}
+	if err := Register("test-duplicate", &upperHandler{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Register("test-duplicate", &upperHandler{}); err == nil {
+		t.Error("expected error registering transform twice")
+	}
+}
+
+func TestTransformWithExecHook(t *testing.T) {
+	if err := RegisterExecHooks("test-exec-upper=tr a-z A-Z", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	transformator, err := CreateTransformator(&akvsv1.AzureKeyVaultOutput{
+		Transforms: []string{"test-exec-upper"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newSecret, err := transformator.Transform(testString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newSecret != strings.ToUpper(testString) {
+		t.Errorf("Actual   :%s", newSecret)
+		t.Errorf("Expected :%s", strings.ToUpper(testString))
+	}
+}
+
+func TestExecHookFailureDoesNotIncludeSecret(t *testing.T) {
+	handler := &ExecHandler{Command: []string{"false"}, Timeout: time.Minute}
+
+	_, err := handler.Handle("my-secret-value")
+	if err == nil {
+		t.Fatal("expected error from failing transform command")
+	}
+	if strings.Contains(err.Error(), "my-secret-value") {
+		t.Errorf("expected error without secret, got '%s'", err)
+	}
+}
+
+func TestRegisterExecHooksRequiresCommand(t *testing.T) {
+	if err := RegisterExecHooks("test-no-command=", time.Minute); err == nil {
+		t.Error("expected error for transform hook without command")
+	}
+	if err := RegisterExecHooks("test-no-name", time.Minute); err == nil {
+		t.Error("expected error for transform hook without name")
+	}
+}
@@ -0,0 +1,64 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transformers
+
+import (
+	"fmt"
+	"sync"
+)
+
+var (
+	customMu         sync.RWMutex
+	customTransforms = map[string]TransformationHandler{}
+)
+
+// builtinTransforms are the names of the transforms always available
+var builtinTransforms = map[string]bool{
+	"trim":         true,
+	"base64encode": true,
+	"base64decode": true,
+}
+
+// Register makes a custom transform available to AzureKeyVaultSecrets by name in spec.output.transforms.
+// Go transforms are compiled in by registering them from an init function, and exec hooks are
+// registered with RegisterExecHooks. The handler must be safe for concurrent use.
+func Register(name string, handler TransformationHandler) error {
+	if name == "" {
+		return fmt.Errorf("transform name is required")
+	}
+	if builtinTransforms[name] {
+		return fmt.Errorf("transform '%s' is a built-in transform", name)
+	}
+
+	customMu.Lock()
+	defer customMu.Unlock()
+
+	if _, ok := customTransforms[name]; ok {
+		return fmt.Errorf("transform '%s' is already registered", name)
+	}
+	customTransforms[name] = handler
+	return nil
+}
+
+// getCustomTransform returns the custom transform registered by name, if any
+func getCustomTransform(name string) (TransformationHandler, bool) {
+	customMu.RLock()
+	defer customMu.RUnlock()
+
+	handler, ok := customTransforms[name]
+	return handler, ok
+}
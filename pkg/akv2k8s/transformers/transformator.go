@@ -41,7 +41,11 @@ func CreateTransformator(spec *akvs.AzureKeyVaultOutput) (*Transformator, error)
 		case "base64decode":
 			transforms = append(transforms, &Base64DecodeHandler{})
 		default:
-			return nil, fmt.Errorf("transform type '%s' not currently supported", transform)
+			handler, ok := getCustomTransform(transform)
+			if !ok {
+				return nil, fmt.Errorf("transform type '%s' not currently supported", transform)
+			}
+			transforms = append(transforms, handler)
 		}
 	}
 
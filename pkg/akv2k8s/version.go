@@ -1,7 +1,10 @@
 package akv2k8s
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"runtime"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -32,6 +35,37 @@ func LogVersion() {
 		"commit":    GitCommit,
 		"buildDate": BuildDate,
 		"component": Component,
+		"goVersion": runtime.Version(),
 	})
 	contextLogger.Infof("version %s", Version)
 }
+
+// Info is the version and build details of the component
+type Info struct {
+	Component string `json:"component"`
+	Version   string `json:"version"`
+	GitCommit string `json:"gitCommit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
+// GetInfo returns the version and build details of the component
+func GetInfo() Info {
+	return Info{
+		Component: Component,
+		Version:   Version,
+		GitCommit: GitCommit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+}
+
+// VersionHandler serves the version and build details of the component as JSON
+func VersionHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(GetInfo()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
@@ -1,7 +1,9 @@
 package akv2k8s
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
@@ -19,3 +21,20 @@ func TestVersion(t *testing.T) {
 		t.Fatalf("got unexpected user agent string: %s. Expected: %s.", gotUserAgentStr, expectedUserAgentStr)
 	}
 }
+
+func TestVersionHandler(t *testing.T) {
+	GitCommit = "20462a2"
+	Version = "1.1.7"
+	Component = "controller"
+
+	recorder := httptest.NewRecorder()
+	VersionHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/version", nil))
+
+	var info Info
+	if err := json.Unmarshal(recorder.Body.Bytes(), &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != Version || info.GitCommit != GitCommit || info.Component != Component || info.GoVersion == "" {
+		t.Errorf("got unexpected version info: %+v", info)
+	}
+}
@@ -48,10 +48,10 @@ func (c AzureKeyVaultCredentials) Endpoint(keyVaultName string) string {
 	return fmt.Sprintf(c.EndpointPartial, keyVaultName)
 }
 
-// MarshalJSON will get a fresh oauth token from the service principal token and serialize.
+// MarshalJSON will ensure the oauth token from the service principal token is fresh and serialize.
 // This token will expire after the default oauth token lifetime for the service principal.
 func (c AzureKeyVaultCredentials) MarshalJSON() ([]byte, error) {
-	err := c.Token.Refresh()
+	err := c.Token.EnsureFresh()
 	if err != nil {
 		return nil, fmt.Errorf("failed to refresh token before marshalling, error: %+v", err)
 	}
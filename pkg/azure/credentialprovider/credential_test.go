@@ -17,11 +17,17 @@ limitations under the License.
 package credentialprovider
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/adal"
 	"github.com/Azure/go-autorest/autorest/azure"
 	akv2k8sTesting "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/akv2k8s/testing"
 )
@@ -156,3 +162,68 @@ func TestIntegrationAuthFromConfigAudience(t *testing.T) {
 		t.Errorf("expected resource uri '%s', got '%s'", azure.PublicCloud.ResourceIdentifiers.KeyVault, token.Token().Resource)
 	}
 }
+
+func TestAuthorizerReusesFreshToken(t *testing.T) {
+	oauthConfig, err := adal.NewOAuthConfig(azure.PublicCloud.ActiveDirectoryEndpoint, "tenant")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Refreshing a manual token without refresh token would fail, so the authorizer
+	// can only succeed if it reuses the token while it is still fresh
+	expiresOn := time.Now().Add(time.Hour).Unix()
+	token, err := adal.NewServicePrincipalTokenFromManualToken(*oauthConfig, "client-id", azure.PublicCloud.ResourceIdentifiers.KeyVault, adal.Token{
+		AccessToken: "some-access-token",
+		ExpiresOn:   json.Number(strconv.FormatInt(expiresOn, 10)),
+		Resource:    azure.PublicCloud.ResourceIdentifiers.KeyVault,
+		Type:        "Bearer",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creds := AzureKeyVaultCredentials{Token: token}
+	authorizer, err := creds.Authorizer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "https://my-vault.vault.azure.net/secrets/my-secret", nil)
+		req, err = autorest.Prepare(req, authorizer.WithAuthorization())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if header := req.Header.Get("Authorization"); header != "Bearer some-access-token" {
+			t.Errorf("expected authorization header 'Bearer some-access-token', got '%s'", header)
+		}
+	}
+}
+
+func TestNewCredentialSetsFromConfig(t *testing.T) {
+	config := `
+platform:
+  tenantId: platform-tenant
+  aadClientId: platform-client
+  aadClientSecret: platform-secret
+team-a:
+  cloud: AzureChinaCloud
+  useManagedIdentityExtension: true
+  userAssignedIdentityID: team-a-identity
+`
+	providers, err := NewCredentialSetsFromConfig(strings.NewReader(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(providers) != 2 {
+		t.Fatalf("expected 2 credential sets, got %d", len(providers))
+	}
+	if providers["platform"].config.TenantID != "platform-tenant" {
+		t.Errorf("expected tenant 'platform-tenant', got '%s'", providers["platform"].config.TenantID)
+	}
+	if providers["team-a"].environment.Name != azure.ChinaCloud.Name {
+		t.Errorf("expected environment '%s', got '%s'", azure.ChinaCloud.Name, providers["team-a"].environment.Name)
+	}
+}
@@ -0,0 +1,71 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package credentialprovider
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"sigs.k8s.io/yaml"
+)
+
+// NewCredentialSetsFromConfig parses a config of named Azure cloud configs, like:
+//
+//	platform:
+//	  tenantId: ...
+//	  aadClientId: ...
+//	  aadClientSecret: ...
+//	team-a:
+//	  useManagedIdentityExtension: true
+//	  userAssignedIdentityID: ...
+//
+// and returns a CloudConfigCredentialProvider for each name
+func NewCredentialSetsFromConfig(configReader io.Reader) (map[string]*CloudConfigCredentialProvider, error) {
+	limitedReader := &io.LimitedReader{R: configReader, N: maxReadLength}
+	configContents, err := ioutil.ReadAll(limitedReader)
+	if err != nil {
+		return nil, err
+	}
+	if limitedReader.N <= 0 {
+		return nil, errors.New("the read limit is reached")
+	}
+
+	var configs map[string]*AzureCloudConfig
+	if err = yaml.Unmarshal(configContents, &configs); err != nil {
+		return nil, fmt.Errorf("failed reading credential sets config, error: %+v", err)
+	}
+
+	providers := make(map[string]*CloudConfigCredentialProvider, len(configs))
+	for name, config := range configs {
+		if config == nil {
+			return nil, fmt.Errorf("credential set '%s' has no config", name)
+		}
+
+		env, err := parseAzureEnvironment(config.Cloud)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse environment for credential set '%s', error: %+v", name, err)
+		}
+
+		providers[name] = &CloudConfigCredentialProvider{
+			config:      config,
+			environment: env,
+		}
+	}
+	return providers, nil
+}
@@ -38,6 +38,7 @@ import (
 
 	aadProvider "github.com/Azure/aad-pod-identity/pkg/cloudprovider"
 	azureAuth "github.com/Azure/go-autorest/autorest/azure/auth"
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/akv2k8s"
 	log "github.com/sirupsen/logrus"
 	"sigs.k8s.io/yaml"
 )
@@ -223,11 +224,13 @@ func getServicePrincipalTokenFromCloudConfig(config *AzureCloudConfig, env *azur
 }
 
 func createAuthorizerFromServicePrincipalToken(token *adal.ServicePrincipalToken) (autorest.Authorizer, error) {
-	err := token.Refresh()
-	if err != nil {
-		return nil, err
+	if token == nil {
+		return nil, fmt.Errorf("service principal token not set")
 	}
-	return createAuthorizerFromOAuthToken(token.OAuthToken())
+
+	// The bearer authorizer ensures the token is fresh before each request, which only
+	// acquires a new token from AAD when the current token is about to expire
+	return autorest.NewBearerAuthorizer(token), nil
 }
 
 func createAuthorizerFromOAuthToken(token string) (autorest.Authorizer, error) {
@@ -285,6 +288,10 @@ func ParseConfig(configReader io.Reader) (*AzureCloudConfig, error) {
 }
 
 func decodePkcs12(pkcs []byte, password string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	if akv2k8s.FIPS {
+		return nil, nil, fmt.Errorf("decoding the PKCS#12 client certificate: %w", akv2k8s.ErrNotAllowedInFIPSMode)
+	}
+
 	privateKey, certificate, err := pkcs12.Decode(pkcs, password)
 	if err != nil {
 		return nil, nil, fmt.Errorf("decoding the PKCS#12 client certificate: %v", err)
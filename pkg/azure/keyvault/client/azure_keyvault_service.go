@@ -18,11 +18,17 @@ package client
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/base64"
 	"fmt"
+	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/services/keyvault/2016-10-01/keyvault"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/date"
 	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/credentialprovider"
 	akvs "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
 )
@@ -32,15 +38,26 @@ const (
 	certificateTypePfx        = "application/x-pkcs12"
 )
 
+// ProbeObjectName is the object requested by Probe, expected not to exist in the vault
+const ProbeObjectName = "akv2k8s-probe"
+
 // Service is an interface for implementing vaults
 type Service interface {
 	GetSecret(secret *akvs.AzureKeyVault) (string, error)
 	GetKey(secret *akvs.AzureKeyVault) (string, error)
 	GetCertificate(secret *akvs.AzureKeyVault, options *CertificateOptions) (*Certificate, error)
+	GetObjectVersion(secret *akvs.AzureKeyVault) (*ObjectVersion, error)
+	CreateSecret(secret *akvs.AzureKeyVault, value string) error
+	Probe(secret *akvs.AzureKeyVault) error
+	SetTags(secret *akvs.AzureKeyVault, tags map[string]string) (*ObjectVersion, error)
 }
 
 type azureKeyVaultService struct {
 	credentials *credentialprovider.AzureKeyVaultCredentials
+	sender      autorest.Sender
+
+	clientMutex sync.Mutex
+	client      *keyvault.BaseClient
 }
 
 // NewService creates a new AzureKeyVaultService
@@ -50,12 +67,32 @@ func NewService(credentials *credentialprovider.AzureKeyVaultCredentials) Servic
 	}
 }
 
+// NewServiceWithSender creates a new AzureKeyVaultService sending all requests to
+// Azure Key Vault using sender, like a http client created by NewHTTPClient
+func NewServiceWithSender(credentials *credentialprovider.AzureKeyVaultCredentials, sender autorest.Sender) Service {
+	return &azureKeyVaultService{
+		credentials: credentials,
+		sender:      sender,
+	}
+}
+
 // CertificateOptions has options for exporting certificate
 type CertificateOptions struct {
 	ExportPrivateKey  bool
 	EnsureServerFirst bool
 }
 
+// ObjectVersion has information about the current version of an object
+// in Azure Key Vault, which can be retrieved without downloading its value
+type ObjectVersion struct {
+	ID      string
+	Created time.Time
+	Updated time.Time
+
+	// Thumbprint is the base64url encoded x509 thumbprint (x5t), only set for certificates
+	Thumbprint string
+}
+
 // GetSecret download secrets from Azure Key Vault
 func (a *azureKeyVaultService) GetSecret(vaultSpec *akvs.AzureKeyVault) (string, error) {
 	if vaultSpec.Object.Name == "" {
@@ -75,7 +112,7 @@ func (a *azureKeyVaultService) GetSecret(vaultSpec *akvs.AzureKeyVault) (string,
 	secretBundle, err := vaultClient.GetSecret(ctx, baseURL, vaultSpec.Object.Name, vaultSpec.Object.Version)
 
 	if err != nil {
-		return "", err
+		return "", checkSoftDeleted(ctx, vaultClient, baseURL, vaultSpec.Name, "secret", vaultSpec.Object.Name, err)
 	}
 	return *secretBundle.Value, nil
 }
@@ -98,7 +135,7 @@ func (a *azureKeyVaultService) GetKey(vaultSpec *akvs.AzureKeyVault) (string, er
 	keyBundle, err := vaultClient.GetKey(ctx, baseURL, vaultSpec.Object.Name, vaultSpec.Object.Version)
 
 	if err != nil {
-		return "", err
+		return "", checkSoftDeleted(ctx, vaultClient, baseURL, vaultSpec.Name, "key", vaultSpec.Object.Name, err)
 	}
 
 	return *keyBundle.Key.N, nil
@@ -118,12 +155,12 @@ func (a *azureKeyVaultService) GetCertificate(vaultSpec *akvs.AzureKeyVault, opt
 
 	certBundle, err := vaultClient.GetCertificate(ctx, baseURL, vaultSpec.Object.Name, vaultSpec.Object.Version)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get certificate from azure key vault, error: %+v", err)
+		return nil, fmt.Errorf("failed to get certificate from azure key vault, error: %w", checkSoftDeleted(ctx, vaultClient, baseURL, vaultSpec.Name, "certificate", vaultSpec.Object.Name, err))
 	}
 
 	if options.ExportPrivateKey {
 		if !*certBundle.Policy.KeyProperties.Exportable {
-			return nil, fmt.Errorf("cannot export private key because key is not exportable in azure key vault")
+			return nil, &NotExportableError{VaultName: vaultSpec.Name, CertificateName: vaultSpec.Object.Name}
 		}
 		secretBundle, err := vaultClient.GetSecret(ctx, baseURL, vaultSpec.Object.Name, vaultSpec.Object.Version)
 		if err != nil {
@@ -150,7 +187,313 @@ func (a *azureKeyVaultService) GetCertificate(vaultSpec *akvs.AzureKeyVault, opt
 	return NewCertificateFromDer(*certBundle.Cer)
 }
 
+// GetObjectVersion get the current version of an object in Azure Key Vault using
+// its attributes only, making it cheap to check if the object has changed
+func (a *azureKeyVaultService) GetObjectVersion(vaultSpec *akvs.AzureKeyVault) (*ObjectVersion, error) {
+	if vaultSpec.Object.Name == "" {
+		return nil, fmt.Errorf("azurekeyvaultsecret.spec.vault.object.name not set")
+	}
+
+	vaultClient, err := a.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	baseURL := a.credentials.Endpoint(vaultSpec.Name)
+
+	switch vaultSpec.Object.Type {
+	case akvs.AzureKeyVaultObjectTypeSecret, akvs.AzureKeyVaultObjectTypeMultiKeyValueSecret:
+		// A specific secret version never change value, so there is no need to ask Azure
+		if vaultSpec.Object.Version != "" {
+			return &ObjectVersion{ID: vaultSpec.Object.Version}, nil
+		}
+		version, err := getCurrentSecretVersion(ctx, vaultClient, baseURL, vaultSpec.Object.Name)
+		if err != nil {
+			return nil, checkSoftDeleted(ctx, vaultClient, baseURL, vaultSpec.Name, "secret", vaultSpec.Object.Name, err)
+		}
+		return version, nil
+	case akvs.AzureKeyVaultObjectTypeCertificate:
+		// Certificate bundle only contains the public part of the certificate
+		certBundle, err := vaultClient.GetCertificate(ctx, baseURL, vaultSpec.Object.Name, vaultSpec.Object.Version)
+		if err != nil {
+			return nil, checkSoftDeleted(ctx, vaultClient, baseURL, vaultSpec.Name, "certificate", vaultSpec.Object.Name, err)
+		}
+		var created, updated *date.UnixTime
+		if certBundle.Attributes != nil {
+			created, updated = certBundle.Attributes.Created, certBundle.Attributes.Updated
+		}
+		version := newObjectVersion(certBundle.ID, created, updated)
+		if certBundle.X509Thumbprint != nil {
+			version.Thumbprint = *certBundle.X509Thumbprint
+		}
+		return version, nil
+	case akvs.AzureKeyVaultObjectTypeKey:
+		keyBundle, err := vaultClient.GetKey(ctx, baseURL, vaultSpec.Object.Name, vaultSpec.Object.Version)
+		if err != nil {
+			return nil, checkSoftDeleted(ctx, vaultClient, baseURL, vaultSpec.Name, "key", vaultSpec.Object.Name, err)
+		}
+		var id *string
+		if keyBundle.Key != nil {
+			id = keyBundle.Key.Kid
+		}
+		var created, updated *date.UnixTime
+		if keyBundle.Attributes != nil {
+			created, updated = keyBundle.Attributes.Created, keyBundle.Attributes.Updated
+		}
+		return newObjectVersion(id, created, updated), nil
+	default:
+		return nil, fmt.Errorf("azure key vault object type '%s' not currently supported", vaultSpec.Object.Type)
+	}
+}
+
+// CreateSecret writes the value as a new version of the secret in Azure Key Vault,
+// creating the secret if it does not exist
+func (a *azureKeyVaultService) CreateSecret(vaultSpec *akvs.AzureKeyVault, value string) error {
+	if vaultSpec.Object.Name == "" {
+		return fmt.Errorf("azurekeyvaultsecret.spec.vault.object.name not set")
+	}
+
+	vaultClient, err := a.getClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	baseURL := a.credentials.Endpoint(vaultSpec.Name)
+	_, err = vaultClient.SetSecret(ctx, baseURL, vaultSpec.Object.Name, keyvault.SecretSetParameters{Value: &value})
+	return err
+}
+
+// Probe checks that the vault can be reached and the credentials are allowed to get objects of the
+// type of vaultSpec from it, by getting ProbeObjectName. Azure Key Vault answers not found only after
+// authenticating and authorizing the request, so not found means success.
+func (a *azureKeyVaultService) Probe(vaultSpec *akvs.AzureKeyVault) error {
+	vaultClient, err := a.getClient()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	baseURL := a.credentials.Endpoint(vaultSpec.Name)
+	switch vaultSpec.Object.Type {
+	case akvs.AzureKeyVaultObjectTypeCertificate:
+		_, err = vaultClient.GetCertificate(ctx, baseURL, ProbeObjectName, "")
+	case akvs.AzureKeyVaultObjectTypeKey:
+		_, err = vaultClient.GetKey(ctx, baseURL, ProbeObjectName, "")
+	default:
+		_, err = vaultClient.GetSecret(ctx, baseURL, ProbeObjectName, "")
+	}
+	if IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// SetTags merges the tags into the tags of the version of the object in vaultSpec, or its current version
+// if not set, keeping other tags. Nothing is written if the object already has the tags. Returns the version
+// of the object after the update, as updating tags changes its updated timestamp.
+func (a *azureKeyVaultService) SetTags(vaultSpec *akvs.AzureKeyVault, tags map[string]string) (*ObjectVersion, error) {
+	if vaultSpec.Object.Name == "" {
+		return nil, fmt.Errorf("azurekeyvaultsecret.spec.vault.object.name not set")
+	}
+
+	vaultClient, err := a.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	baseURL := a.credentials.Endpoint(vaultSpec.Name)
+	name, version := vaultSpec.Object.Name, vaultSpec.Object.Version
+
+	switch vaultSpec.Object.Type {
+	case akvs.AzureKeyVaultObjectTypeSecret, akvs.AzureKeyVaultObjectTypeMultiKeyValueSecret:
+		return setSecretTags(ctx, vaultClient, baseURL, name, version, tags)
+	case akvs.AzureKeyVaultObjectTypeCertificate:
+		certBundle, err := vaultClient.GetCertificate(ctx, baseURL, name, version)
+		if err != nil {
+			return nil, err
+		}
+		merged, changed := mergeTags(certBundle.Tags, tags)
+		if changed && certBundle.ID != nil {
+			if certBundle, err = vaultClient.UpdateCertificate(ctx, baseURL, name, versionFromObjectID(*certBundle.ID), keyvault.CertificateUpdateParameters{Tags: merged}); err != nil {
+				return nil, err
+			}
+		}
+		var created, updated *date.UnixTime
+		if certBundle.Attributes != nil {
+			created, updated = certBundle.Attributes.Created, certBundle.Attributes.Updated
+		}
+		objectVersion := newObjectVersion(certBundle.ID, created, updated)
+		if certBundle.X509Thumbprint != nil {
+			objectVersion.Thumbprint = *certBundle.X509Thumbprint
+		}
+		return objectVersion, nil
+	case akvs.AzureKeyVaultObjectTypeKey:
+		keyBundle, err := vaultClient.GetKey(ctx, baseURL, name, version)
+		if err != nil {
+			return nil, err
+		}
+		var id *string
+		if keyBundle.Key != nil {
+			id = keyBundle.Key.Kid
+		}
+		merged, changed := mergeTags(keyBundle.Tags, tags)
+		if changed && id != nil {
+			if keyBundle, err = vaultClient.UpdateKey(ctx, baseURL, name, versionFromObjectID(*id), keyvault.KeyUpdateParameters{Tags: merged}); err != nil {
+				return nil, err
+			}
+		}
+		var created, updated *date.UnixTime
+		if keyBundle.Attributes != nil {
+			created, updated = keyBundle.Attributes.Created, keyBundle.Attributes.Updated
+		}
+		return newObjectVersion(id, created, updated), nil
+	default:
+		return nil, fmt.Errorf("azure key vault object type '%s' not currently supported", vaultSpec.Object.Type)
+	}
+}
+
+// setSecretTags merges the tags into the tags of the version of the secret, or its current version if
+// empty. The tags are read from the listing of versions, so the secret value is never downloaded.
+func setSecretTags(ctx context.Context, vaultClient *keyvault.BaseClient, baseURL string, name string, version string, tags map[string]string) (*ObjectVersion, error) {
+	item, err := getSecretItem(ctx, vaultClient, baseURL, name, version)
+	if err != nil {
+		return nil, err
+	}
+	merged, changed := mergeTags(item.Tags, tags)
+	if !changed {
+		return newObjectVersion(item.ID, item.Attributes.Created, item.Attributes.Updated), nil
+	}
+
+	secretBundle, err := vaultClient.UpdateSecret(ctx, baseURL, name, versionFromObjectID(*item.ID), keyvault.SecretUpdateParameters{Tags: merged})
+	if err != nil {
+		return nil, err
+	}
+	var created, updated *date.UnixTime
+	if secretBundle.Attributes != nil {
+		created, updated = secretBundle.Attributes.Created, secretBundle.Attributes.Updated
+	}
+	return newObjectVersion(secretBundle.ID, created, updated), nil
+}
+
+// mergeTags returns the current tags with the tags added, and if any tag was added or changed
+func mergeTags(current map[string]*string, tags map[string]string) (map[string]*string, bool) {
+	merged := make(map[string]*string, len(current)+len(tags))
+	for name, value := range current {
+		merged[name] = value
+	}
+
+	changed := false
+	for name, value := range tags {
+		if existing, ok := current[name]; !ok || existing == nil || *existing != value {
+			value := value
+			merged[name] = &value
+			changed = true
+		}
+	}
+	return merged, changed
+}
+
+// secretVersionsPageSize is the largest page of versions Azure Key Vault returns when listing secret versions
+var secretVersionsPageSize int32 = 25
+
+// getCurrentSecretVersion finds the latest created enabled version of a secret by listing its versions,
+// which only returns secret attributes and not the secret value. The value is never downloaded to
+// check the version, so it is only fetched when the version has changed.
+func getCurrentSecretVersion(ctx context.Context, vaultClient *keyvault.BaseClient, baseURL string, name string) (*ObjectVersion, error) {
+	item, err := getSecretItem(ctx, vaultClient, baseURL, name, "")
+	if err != nil {
+		return nil, err
+	}
+	return newObjectVersion(item.ID, item.Attributes.Created, item.Attributes.Updated), nil
+}
+
+// getSecretItem returns the attributes and tags of a version of a secret from the listing of its versions,
+// or of the latest created enabled version if version is empty
+func getSecretItem(ctx context.Context, vaultClient *keyvault.BaseClient, baseURL string, name string, version string) (*keyvault.SecretItem, error) {
+	page, err := vaultClient.GetSecretVersions(ctx, baseURL, name, &secretVersionsPageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var current *keyvault.SecretItem
+	var currentCreated time.Time
+	for page.NotDone() {
+		for _, item := range page.Values() {
+			if item.ID == nil || item.Attributes == nil || item.Attributes.Created == nil {
+				continue
+			}
+			if version != "" {
+				if versionFromObjectID(*item.ID) == version {
+					return &item, nil
+				}
+				continue
+			}
+			if item.Attributes.Enabled != nil && !*item.Attributes.Enabled {
+				continue
+			}
+			created := time.Time(*item.Attributes.Created)
+			if current == nil || created.After(currentCreated) {
+				itemCopy := item
+				current = &itemCopy
+				currentCreated = created
+			}
+		}
+
+		if err = page.NextWithContext(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if version != "" {
+		return nil, fmt.Errorf("version '%s' not found for secret '%s'", version, name)
+	}
+	if current == nil {
+		return nil, fmt.Errorf("no enabled versions found for secret '%s'", name)
+	}
+	return current, nil
+}
+
+func newObjectVersion(id *string, created *date.UnixTime, updated *date.UnixTime) *ObjectVersion {
+	version := &ObjectVersion{}
+	if id != nil {
+		version.ID = versionFromObjectID(*id)
+	}
+	if created != nil {
+		version.Created = time.Time(*created)
+	}
+	if updated != nil {
+		version.Updated = time.Time(*updated)
+	}
+	return version
+}
+
+// versionFromObjectID returns the version part of an Azure Key Vault object id
+// like https://{vault}.vault.azure.net/secrets/{name}/{version}
+func versionFromObjectID(id string) string {
+	return id[strings.LastIndex(id, "/")+1:]
+}
+
+// getClient returns a client shared by all requests, making the AAD token
+// to be reused until it is about to expire
 func (a *azureKeyVaultService) getClient() (*keyvault.BaseClient, error) {
+	a.clientMutex.Lock()
+	defer a.clientMutex.Unlock()
+
+	if a.client != nil {
+		return a.client, nil
+	}
+
 	authorizer, err := a.credentials.Authorizer()
 	if err != nil {
 		return nil, err
@@ -162,6 +505,42 @@ func (a *azureKeyVaultService) getClient() (*keyvault.BaseClient, error) {
 	keyClient.Client.RetryAttempts = 2
 	keyClient.Client.RetryDuration = 5 * time.Second
 	keyClient.Authorizer = authorizer
+	keyClient.RequestInspector = withClientRequestID()
+	if a.sender != nil {
+		keyClient.Sender = a.sender
+	}
 
-	return &keyClient, nil
+	a.client = &keyClient
+	return a.client, nil
+}
+
+// withClientRequestID sets a unique x-ms-client-request-id on every request, which Azure
+// returns in the response and logs so failed requests can be traced by Azure support
+func withClientRequestID() autorest.PrepareDecorator {
+	return func(p autorest.Preparer) autorest.Preparer {
+		return autorest.PreparerFunc(func(r *http.Request) (*http.Request, error) {
+			r, err := p.Prepare(r)
+			if err != nil {
+				return r, err
+			}
+			if r.Header.Get(clientRequestIDHeader) == "" {
+				id, err := newClientRequestID()
+				if err != nil {
+					return r, err
+				}
+				r.Header.Set(clientRequestIDHeader, id)
+			}
+			return r, nil
+		})
+	}
+}
+
+func newClientRequestID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
 }
@@ -1,11 +1,20 @@
 package client
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/services/keyvault/2016-10-01/keyvault"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/date"
 	akv2k8sTesting "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/akv2k8s/testing"
 	auth "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/credentialprovider"
 	akvs "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
@@ -128,3 +137,185 @@ func TestIntegrationEnvironmentGetSecret(t *testing.T) {
 	}
 
 }
+
+func TestWithClientRequestID(t *testing.T) {
+	first, err := autorest.Prepare(&http.Request{Header: http.Header{}}, withClientRequestID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := autorest.Prepare(&http.Request{Header: http.Header{}}, withClientRequestID())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := first.Header.Get("x-ms-client-request-id")
+	if len(id) != 36 {
+		t.Errorf("expected client request id to be a uuid, got '%s'", id)
+	}
+	if id == second.Header.Get("x-ms-client-request-id") {
+		t.Error("expected unique client request id per request")
+	}
+}
+
+func TestMergeTags(t *testing.T) {
+	owner, namespace := "team", "old"
+	current := map[string]*string{"owner": &owner, "akv2k8s-namespace": &namespace}
+
+	merged, changed := mergeTags(current, map[string]string{"akv2k8s-namespace": "default"})
+	if !changed {
+		t.Error("expected changed tag to be written")
+	}
+	if *merged["owner"] != "team" || *merged["akv2k8s-namespace"] != "default" {
+		t.Errorf("expected other tags to be kept and tag to be changed, got %v", merged)
+	}
+
+	if _, changed = mergeTags(merged, map[string]string{"akv2k8s-namespace": "default"}); changed {
+		t.Error("expected unchanged tags not to be written")
+	}
+}
+
+// secretVersionsServer serves the versions of a secret, one page per slice of versions, and updates of the
+// tags of a version. Any other request, like getting the secret and its value, fails the test.
+func secretVersionsServer(t *testing.T, pages [][]keyvault.SecretItem) (*httptest.Server, *int) {
+	requests := 0
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Method == http.MethodPatch && strings.HasPrefix(r.URL.Path, "/secrets/my-secret/") {
+			var update keyvault.SecretUpdateParameters
+			_ = json.NewDecoder(r.Body).Decode(&update)
+			id := "https://my-vault.vault.azure.net" + r.URL.Path
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(keyvault.SecretBundle{ID: &id, Tags: update.Tags, Attributes: &keyvault.SecretAttributes{}})
+			return
+		}
+		if r.URL.Path != "/secrets/my-secret/versions" {
+			t.Errorf("expected only secret versions to be listed, got request for %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		result := keyvault.SecretListResult{Value: &pages[page]}
+		if page+1 < len(pages) {
+			next := fmt.Sprintf("%s/secrets/my-secret/versions?page=%d", server.URL, page+1)
+			result.NextLink = &next
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(result)
+	}))
+	return server, &requests
+}
+
+func secretItem(version string, created int64, enabled bool) keyvault.SecretItem {
+	id := "https://my-vault.vault.azure.net/secrets/my-secret/" + version
+	createdTime := date.UnixTime(time.Unix(created, 0))
+	return keyvault.SecretItem{ID: &id, Attributes: &keyvault.SecretAttributes{Created: &createdTime, Enabled: &enabled}}
+}
+
+func TestGetCurrentSecretVersion(t *testing.T) {
+	enabled := func(version string, created int64) keyvault.SecretItem { return secretItem(version, created, true) }
+	disabled := func(version string, created int64) keyvault.SecretItem { return secretItem(version, created, false) }
+
+	tests := []struct {
+		name             string
+		pages            [][]keyvault.SecretItem
+		expected         string
+		expectedRequests int
+	}{
+		{
+			name:             "single page",
+			pages:            [][]keyvault.SecretItem{{enabled("v1", 1), enabled("v3", 3), enabled("v2", 2)}},
+			expected:         "v3",
+			expectedRequests: 1,
+		},
+		{
+			name:             "disabled latest version",
+			pages:            [][]keyvault.SecretItem{{enabled("v1", 1), disabled("v3", 3), enabled("v2", 2)}},
+			expected:         "v2",
+			expectedRequests: 1,
+		},
+		{
+			name:             "multiple pages",
+			pages:            [][]keyvault.SecretItem{{enabled("v1", 1)}, {enabled("v3", 3)}, {enabled("v2", 2)}},
+			expected:         "v3",
+			expectedRequests: 3,
+		},
+		{
+			name:             "multiple pages with disabled latest version",
+			pages:            [][]keyvault.SecretItem{{enabled("v1", 1)}, {disabled("v4", 4), enabled("v3", 3)}, {enabled("v2", 2)}},
+			expected:         "v3",
+			expectedRequests: 3,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, requests := secretVersionsServer(t, test.pages)
+			defer server.Close()
+			vaultClient := keyvault.New()
+			vaultClient.RetryAttempts = 0
+
+			version, err := getCurrentSecretVersion(context.Background(), &vaultClient, server.URL, "my-secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version.ID != test.expected {
+				t.Errorf("expected version %s, got %s", test.expected, version.ID)
+			}
+			if *requests != test.expectedRequests {
+				t.Errorf("expected %d requests, got %d", test.expectedRequests, *requests)
+			}
+		})
+	}
+}
+
+func TestGetCurrentSecretVersionAllDisabled(t *testing.T) {
+	server, _ := secretVersionsServer(t, [][]keyvault.SecretItem{{secretItem("v1", 1, false)}})
+	defer server.Close()
+	vaultClient := keyvault.New()
+
+	if _, err := getCurrentSecretVersion(context.Background(), &vaultClient, server.URL, "my-secret"); err == nil {
+		t.Error("expected error without enabled versions")
+	}
+}
+
+func TestSetSecretTags(t *testing.T) {
+	namespace := "default"
+	tagged := secretItem("v1", 1, true)
+	tagged.Tags = map[string]*string{"akv2k8s-namespace": &namespace}
+
+	tests := []struct {
+		name             string
+		version          string
+		tags             map[string]string
+		expected         string
+		expectedRequests int
+	}{
+		{name: "unchanged tags", tags: map[string]string{"akv2k8s-namespace": "default"}, expected: "v2", expectedRequests: 1},
+		{name: "changed tags", tags: map[string]string{"akv2k8s-namespace": "other"}, expected: "v2", expectedRequests: 2},
+		{name: "pinned version", version: "v1", tags: map[string]string{"akv2k8s-namespace": "default"}, expected: "v1", expectedRequests: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			current := secretItem("v2", 2, true)
+			current.Tags = tagged.Tags
+			server, requests := secretVersionsServer(t, [][]keyvault.SecretItem{{tagged, current}})
+			defer server.Close()
+			vaultClient := keyvault.New()
+			vaultClient.RetryAttempts = 0
+
+			version, err := setSecretTags(context.Background(), &vaultClient, server.URL, "my-secret", test.version, test.tags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version.ID != test.expected {
+				t.Errorf("expected version %s, got %s", test.expected, version.ID)
+			}
+			if *requests != test.expectedRequests {
+				t.Errorf("expected %d requests, got %d", test.expectedRequests, *requests)
+			}
+		})
+	}
+}
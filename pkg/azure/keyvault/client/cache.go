@@ -0,0 +1,177 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	akvs "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+)
+
+// maxCacheEntries bounds the memory used by the cache, evicting an arbitrary entry when full
+const maxCacheEntries = 10000
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+type cachedService struct {
+	service Service
+	ttl     time.Duration
+	now     func() time.Time
+
+	mutex      sync.Mutex
+	entries    map[string]cacheEntry
+	maxEntries int
+	nextSweep  time.Time
+}
+
+// NewCachedService wraps a Service with an in-memory cache, making lookups of the
+// same vault object and version within ttl share one request to Azure Key Vault.
+// Failed lookups and object versions are never cached. A ttl of zero or less disables the cache.
+func NewCachedService(service Service, ttl time.Duration) Service {
+	if ttl <= 0 {
+		return service
+	}
+	return &cachedService{
+		service:    service,
+		ttl:        ttl,
+		now:        time.Now,
+		entries:    make(map[string]cacheEntry),
+		maxEntries: maxCacheEntries,
+	}
+}
+
+// GetSecret get secret from cache or Azure Key Vault
+func (c *cachedService) GetSecret(vaultSpec *akvs.AzureKeyVault) (string, error) {
+	value, err := c.getOrFetch(cacheKey("secret", vaultSpec), func() (interface{}, error) {
+		return c.service.GetSecret(vaultSpec)
+	})
+	if err != nil {
+		return "", err
+	}
+	return value.(string), nil
+}
+
+// GetKey get key from cache or Azure Key Vault
+func (c *cachedService) GetKey(vaultSpec *akvs.AzureKeyVault) (string, error) {
+	value, err := c.getOrFetch(cacheKey("key", vaultSpec), func() (interface{}, error) {
+		return c.service.GetKey(vaultSpec)
+	})
+	if err != nil {
+		return "", err
+	}
+	return value.(string), nil
+}
+
+// GetCertificate get certificate from cache or Azure Key Vault
+func (c *cachedService) GetCertificate(vaultSpec *akvs.AzureKeyVault, options *CertificateOptions) (*Certificate, error) {
+	key := cacheKey("certificate", vaultSpec)
+	if options != nil {
+		key = fmt.Sprintf("%s/%t/%t", key, options.ExportPrivateKey, options.EnsureServerFirst)
+	}
+
+	value, err := c.getOrFetch(key, func() (interface{}, error) {
+		return c.service.GetCertificate(vaultSpec, options)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*Certificate), nil
+}
+
+// GetObjectVersion gets the current object version from Azure Key Vault, never cached. It is the cheap
+// check deciding if the value must be fetched again, and a cached version would hide new versions, like
+// those announced by Azure Event Grid, until the ttl expires. Values are fetched pinned to the version
+// found, so cached values of earlier versions are never used for a new version.
+func (c *cachedService) GetObjectVersion(vaultSpec *akvs.AzureKeyVault) (*ObjectVersion, error) {
+	return c.service.GetObjectVersion(vaultSpec)
+}
+
+// CreateSecret creates the secret in Azure Key Vault, never cached. Lookups of objects not
+// found are not cached either, so the created secret is found by the next lookup.
+func (c *cachedService) CreateSecret(vaultSpec *akvs.AzureKeyVault, value string) error {
+	return c.service.CreateSecret(vaultSpec, value)
+}
+
+// Probe probes Azure Key Vault, never cached, as it must observe the vault as it is now
+func (c *cachedService) Probe(vaultSpec *akvs.AzureKeyVault) error {
+	return c.service.Probe(vaultSpec)
+}
+
+// SetTags sets tags of object in Azure Key Vault, never cached
+func (c *cachedService) SetTags(vaultSpec *akvs.AzureKeyVault, tags map[string]string) (*ObjectVersion, error) {
+	return c.service.SetTags(vaultSpec, tags)
+}
+
+func (c *cachedService) getOrFetch(key string, fetch func() (interface{}, error)) (interface{}, error) {
+	c.mutex.Lock()
+	entry, found := c.entries[key]
+	if found && !c.now().Before(entry.expires) {
+		delete(c.entries, key)
+		found = false
+	}
+	c.mutex.Unlock()
+
+	if found {
+		return entry.value, nil
+	}
+
+	value, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.add(key, value)
+	return value, nil
+}
+
+// add must be called while holding the mutex. Expired entries are removed when read, and
+// entries never read again are swept at most once per ttl.
+func (c *cachedService) add(key string, value interface{}) {
+	now := c.now()
+	if !now.Before(c.nextSweep) {
+		for existing, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, existing)
+			}
+		}
+		c.nextSweep = now.Add(c.ttl)
+	}
+
+	if _, found := c.entries[key]; !found && len(c.entries) >= c.maxEntries {
+		for evicted := range c.entries {
+			delete(c.entries, evicted)
+			break
+		}
+	}
+
+	c.entries[key] = cacheEntry{
+		value:   value,
+		expires: now.Add(c.ttl),
+	}
+}
+
+func cacheKey(kind string, vaultSpec *akvs.AzureKeyVault) string {
+	// Credential sets can have different access to the same vault, so entries must never be shared between them
+	return fmt.Sprintf("%s/%s/%s/%s/%s", kind, vaultSpec.CredentialSet, vaultSpec.Name, vaultSpec.Object.Name, vaultSpec.Object.Version)
+}
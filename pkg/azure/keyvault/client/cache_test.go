@@ -0,0 +1,190 @@
+package client
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	akvs "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+)
+
+type countingService struct {
+	secretCalls  int
+	versionCalls int
+	err          error
+}
+
+func (s *countingService) GetSecret(vaultSpec *akvs.AzureKeyVault) (string, error) {
+	s.secretCalls++
+	if s.err != nil {
+		return "", s.err
+	}
+	return fmt.Sprintf("value-%d", s.secretCalls), nil
+}
+
+func (s *countingService) GetKey(vaultSpec *akvs.AzureKeyVault) (string, error) {
+	return "", nil
+}
+
+func (s *countingService) GetCertificate(vaultSpec *akvs.AzureKeyVault, options *CertificateOptions) (*Certificate, error) {
+	return nil, nil
+}
+
+func (s *countingService) GetObjectVersion(vaultSpec *akvs.AzureKeyVault) (*ObjectVersion, error) {
+	s.versionCalls++
+	return &ObjectVersion{}, nil
+}
+
+func (s *countingService) CreateSecret(vaultSpec *akvs.AzureKeyVault, value string) error {
+	return nil
+}
+
+func (s *countingService) Probe(vaultSpec *akvs.AzureKeyVault) error {
+	return nil
+}
+
+func (s *countingService) SetTags(vaultSpec *akvs.AzureKeyVault, tags map[string]string) (*ObjectVersion, error) {
+	return &ObjectVersion{}, nil
+}
+
+func TestCachedServiceSharesLookups(t *testing.T) {
+	now := time.Now()
+	inner := &countingService{}
+	cached := NewCachedService(inner, time.Minute).(*cachedService)
+	cached.now = func() time.Time { return now }
+
+	first := &secret("first", "my-vault", "my-secret").Spec.Vault
+	second := &secret("second", "my-vault", "my-secret").Spec.Vault
+
+	value1, _ := cached.GetSecret(first)
+	value2, _ := cached.GetSecret(second)
+
+	if inner.secretCalls != 1 {
+		t.Errorf("expected 1 call to Azure Key Vault, got %d", inner.secretCalls)
+	}
+	if value1 != value2 {
+		t.Errorf("expected cached value '%s', got '%s'", value1, value2)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if value3, _ := cached.GetSecret(first); value3 == value1 {
+		t.Error("expected value to be fetched again after ttl expired")
+	}
+	if inner.secretCalls != 2 {
+		t.Errorf("expected 2 calls to Azure Key Vault, got %d", inner.secretCalls)
+	}
+}
+
+func TestCachedServiceSeparatesVersions(t *testing.T) {
+	inner := &countingService{}
+	cached := NewCachedService(inner, time.Minute)
+
+	latest := &secret("first", "my-vault", "my-secret").Spec.Vault
+	pinned := latest.DeepCopy()
+	pinned.Object.Version = "version-1"
+
+	cached.GetSecret(latest)
+	cached.GetSecret(pinned)
+
+	if inner.secretCalls != 2 {
+		t.Errorf("expected 2 calls to Azure Key Vault, got %d", inner.secretCalls)
+	}
+}
+
+func TestCachedServiceDoesNotCacheVersions(t *testing.T) {
+	inner := &countingService{}
+	cached := NewCachedService(inner, time.Minute)
+
+	latest := &secret("first", "my-vault", "my-secret").Spec.Vault
+	cached.GetObjectVersion(latest)
+	cached.GetSecret(latest)
+
+	// A new version created while the value is cached, like announced by Azure Event Grid
+	cached.GetObjectVersion(latest)
+	if inner.versionCalls != 2 {
+		t.Errorf("expected every version check to reach Azure Key Vault, got %d calls", inner.versionCalls)
+	}
+}
+
+func TestCachedServiceSeparatesCredentialSets(t *testing.T) {
+	inner := &countingService{}
+	cached := NewCachedService(inner, time.Minute)
+
+	spec := &secret("first", "my-vault", "my-secret").Spec.Vault
+	other := spec.DeepCopy()
+	other.CredentialSet = "team-a"
+
+	cached.GetSecret(spec)
+	cached.GetSecret(other)
+
+	if inner.secretCalls != 2 {
+		t.Errorf("expected 2 calls to Azure Key Vault, got %d", inner.secretCalls)
+	}
+}
+
+func TestCachedServiceDoesNotCacheErrors(t *testing.T) {
+	inner := &countingService{err: fmt.Errorf("failed")}
+	cached := NewCachedService(inner, time.Minute)
+
+	spec := &secret("first", "my-vault", "my-secret").Spec.Vault
+	if _, err := cached.GetSecret(spec); err == nil {
+		t.Error("expected error")
+	}
+
+	inner.err = nil
+	if _, err := cached.GetSecret(spec); err != nil {
+		t.Errorf("expected no error, got %+v", err)
+	}
+	if inner.secretCalls != 2 {
+		t.Errorf("expected 2 calls to Azure Key Vault, got %d", inner.secretCalls)
+	}
+}
+
+func TestCachedServiceSweepsExpiredEntries(t *testing.T) {
+	now := time.Now()
+	inner := &countingService{}
+	cached := NewCachedService(inner, time.Minute).(*cachedService)
+	cached.now = func() time.Time { return now }
+
+	cached.GetSecret(&secret("first", "my-vault", "first-secret").Spec.Vault)
+	now = now.Add(30 * time.Second)
+	cached.GetSecret(&secret("second", "my-vault", "second-secret").Spec.Vault)
+
+	now = now.Add(45 * time.Second)
+	cached.GetSecret(&secret("third", "my-vault", "third-secret").Spec.Vault)
+	if length := len(cached.entries); length != 2 {
+		t.Errorf("expected expired entry to be swept, got %d entries", length)
+	}
+
+	now = now.Add(time.Minute)
+	cached.GetSecret(&secret("third", "my-vault", "third-secret").Spec.Vault)
+	if length := len(cached.entries); length != 1 {
+		t.Errorf("expected expired entries to be swept after ttl, got %d entries", length)
+	}
+}
+
+func TestCachedServiceBoundsEntries(t *testing.T) {
+	inner := &countingService{}
+	cached := NewCachedService(inner, time.Minute).(*cachedService)
+	cached.maxEntries = 3
+
+	for i := 0; i < 10; i++ {
+		cached.GetSecret(&secret("first", "my-vault", fmt.Sprintf("secret-%d", i)).Spec.Vault)
+	}
+	if length := len(cached.entries); length != 3 {
+		t.Errorf("expected cache to be bounded to 3 entries, got %d", length)
+	}
+
+	last := &secret("first", "my-vault", "secret-9").Spec.Vault
+	cached.GetSecret(last)
+	if inner.secretCalls != 10 {
+		t.Errorf("expected last entry to still be cached, got %d calls to Azure Key Vault", inner.secretCalls)
+	}
+}
+
+func TestCachedServiceDisabled(t *testing.T) {
+	inner := &countingService{}
+	if NewCachedService(inner, 0) != Service(inner) {
+		t.Error("expected cache to be disabled when ttl is zero")
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/akv2k8s"
 	"golang.org/x/crypto/pkcs12"
 )
 
@@ -74,6 +75,10 @@ func NewCertificateFromPem(pem string) (*Certificate, error) {
 
 // NewCertificateFromPfx creates a new Certificate from a PFX certificate
 func NewCertificateFromPfx(pfx []byte, ensureServerFirst bool) (*Certificate, error) {
+	if akv2k8s.FIPS {
+		return nil, fmt.Errorf("cannot convert pfx certificate to pem, store certificate in azure key vault with content type '%s' instead: %w", certificateTypePem, akv2k8s.ErrNotAllowedInFIPSMode)
+	}
+
 	pemList, err := pkcs12.ToPEM(pfx, "")
 
 	if err != nil {
@@ -143,17 +148,41 @@ func (cert *Certificate) ExportPublicKeyAsPem() ([]byte, error) {
 		return nil, fmt.Errorf("certificate has no public key")
 	}
 
+	return encodeCertificatesAsPem(cert.Certificates), nil
+}
+
+// ExportServerCertificateAsPem returns the first certificate in the chain pem formatted, without
+// the ca certificates
+func (cert *Certificate) ExportServerCertificateAsPem() ([]byte, error) {
+	if len(cert.Certificates) == 0 {
+		return nil, fmt.Errorf("certificate has no public key")
+	}
+
+	return encodeCertificatesAsPem(cert.Certificates[:1]), nil
+}
+
+// ExportCACertificatesAsPem returns the ca certificates following the first certificate in the
+// chain pem formatted, or empty if the chain has no ca certificates
+func (cert *Certificate) ExportCACertificatesAsPem() []byte {
+	if len(cert.Certificates) < 2 {
+		return []byte{}
+	}
+
+	return encodeCertificatesAsPem(cert.Certificates[1:])
+}
+
+func encodeCertificatesAsPem(certificates []*x509.Certificate) []byte {
 	var certs strings.Builder
-	for _, pubCert := range cert.Certificates {
-		privKeyBlock := &pem.Block{
+	for _, pubCert := range certificates {
+		block := &pem.Block{
 			Type:  "CERTIFICATE",
 			Bytes: pubCert.Raw,
 		}
 
-		certs.Write(pem.EncodeToMemory(privKeyBlock))
+		certs.Write(pem.EncodeToMemory(block))
 	}
 
-	return []byte(certs.String()), nil
+	return []byte(certs.String())
 }
 
 // ExportRaw returns the raw format of the original certificate
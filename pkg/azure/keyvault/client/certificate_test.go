@@ -19,7 +19,10 @@ package client
 import (
 	"bytes"
 	"encoding/base64"
+	"errors"
 	"testing"
+
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/akv2k8s"
 )
 
 var (
@@ -135,6 +138,28 @@ func TestGetPublicKeyPemChainOrder(t *testing.T) {
 	}
 }
 
+func TestGetServerAndCACertificatePem(t *testing.T) {
+	pfxRaw, _ := base64.StdEncoding.DecodeString(pfxTestCertOrderWrong)
+	cert, err := NewCertificateFromPfx(pfxRaw, true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	serverCert, err := cert.ExportServerCertificateAsPem()
+	if err != nil {
+		t.Error(err)
+	}
+	caCerts := cert.ExportCACertificatesAsPem()
+
+	if len(caCerts) == 0 {
+		t.Error("CA pem is empty")
+	}
+
+	if string(serverCert)+string(caCerts) != pemTestCertOrderExpected {
+		t.Error("Server and ca certificates does not match certificate chain")
+	}
+}
+
 func TestGetRawCert(t *testing.T) {
 	pfxRaw, _ := base64.StdEncoding.DecodeString(pfxTestCert)
 	cert, err := NewCertificateFromPfx(pfxRaw, false)
@@ -150,3 +175,13 @@ func TestGetRawCert(t *testing.T) {
 		t.Error("Original cert does not match exported raw cert")
 	}
 }
+
+func TestImportPfxFIPS(t *testing.T) {
+	akv2k8s.EnableFIPS(true)
+	defer akv2k8s.EnableFIPS(false)
+
+	pfxRaw, _ := base64.StdEncoding.DecodeString(pfxTestCert)
+	if _, err := NewCertificateFromPfx(pfxRaw, false); !errors.Is(err, akv2k8s.ErrNotAllowedInFIPSMode) {
+		t.Errorf("expected pfx to be refused in FIPS mode, got %+v", err)
+	}
+}
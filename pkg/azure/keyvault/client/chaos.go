@@ -0,0 +1,155 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	akvs "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+)
+
+// ChaosOptions controls the faults injected by a chaos Service. Rates are the fraction of
+// requests, between 0 and 1, the fault is injected for.
+type ChaosOptions struct {
+	// ErrorRate is the fraction of requests failing like Azure Key Vault returned an internal server error
+	ErrorRate float64
+
+	// ThrottleRate is the fraction of requests failing like Azure Key Vault throttled them
+	ThrottleRate float64
+
+	// RetryAfter is the Retry-After of throttled requests
+	RetryAfter time.Duration
+
+	// SlowRate is the fraction of requests delayed by SlowDelay before being sent to Azure Key Vault
+	SlowRate float64
+
+	// SlowDelay is the delay of slow requests
+	SlowDelay time.Duration
+}
+
+// Enabled returns true if any fault is injected
+func (o ChaosOptions) Enabled() bool {
+	return o.ErrorRate > 0 || o.ThrottleRate > 0 || (o.SlowRate > 0 && o.SlowDelay > 0)
+}
+
+type chaosService struct {
+	service Service
+	options ChaosOptions
+	random  func() float64
+	sleep   func(time.Duration)
+}
+
+// NewChaosService wraps a Service randomly injecting errors, throttling and slow responses, for
+// testing how failing Azure Key Vault requests are handled. Never use it in production.
+func NewChaosService(service Service, options ChaosOptions) Service {
+	if !options.Enabled() {
+		return service
+	}
+	return &chaosService{
+		service: service,
+		options: options,
+		random:  rand.Float64,
+		sleep:   time.Sleep,
+	}
+}
+
+// GetSecret get secret from Azure Key Vault, unless a fault is injected
+func (c *chaosService) GetSecret(vaultSpec *akvs.AzureKeyVault) (string, error) {
+	if err := c.inject("GetSecret"); err != nil {
+		return "", err
+	}
+	return c.service.GetSecret(vaultSpec)
+}
+
+// GetKey get key from Azure Key Vault, unless a fault is injected
+func (c *chaosService) GetKey(vaultSpec *akvs.AzureKeyVault) (string, error) {
+	if err := c.inject("GetKey"); err != nil {
+		return "", err
+	}
+	return c.service.GetKey(vaultSpec)
+}
+
+// GetCertificate get certificate from Azure Key Vault, unless a fault is injected
+func (c *chaosService) GetCertificate(vaultSpec *akvs.AzureKeyVault, options *CertificateOptions) (*Certificate, error) {
+	if err := c.inject("GetCertificate"); err != nil {
+		return nil, err
+	}
+	return c.service.GetCertificate(vaultSpec, options)
+}
+
+// GetObjectVersion get object version from Azure Key Vault, unless a fault is injected
+func (c *chaosService) GetObjectVersion(vaultSpec *akvs.AzureKeyVault) (*ObjectVersion, error) {
+	if err := c.inject("GetObjectVersion"); err != nil {
+		return nil, err
+	}
+	return c.service.GetObjectVersion(vaultSpec)
+}
+
+// CreateSecret create secret in Azure Key Vault, unless a fault is injected
+func (c *chaosService) CreateSecret(vaultSpec *akvs.AzureKeyVault, value string) error {
+	if err := c.inject("CreateSecret"); err != nil {
+		return err
+	}
+	return c.service.CreateSecret(vaultSpec, value)
+}
+
+// Probe probes Azure Key Vault, unless a fault is injected
+func (c *chaosService) Probe(vaultSpec *akvs.AzureKeyVault) error {
+	if err := c.inject("Probe"); err != nil {
+		return err
+	}
+	return c.service.Probe(vaultSpec)
+}
+
+// SetTags sets tags of object in Azure Key Vault, unless a fault is injected
+func (c *chaosService) SetTags(vaultSpec *akvs.AzureKeyVault, tags map[string]string) (*ObjectVersion, error) {
+	if err := c.inject("SetTags"); err != nil {
+		return nil, err
+	}
+	return c.service.SetTags(vaultSpec, tags)
+}
+
+// inject delays the request and returns an error if a fault is drawn for it
+func (c *chaosService) inject(method string) error {
+	if c.options.SlowDelay > 0 && c.random() < c.options.SlowRate {
+		c.sleep(c.options.SlowDelay)
+	}
+
+	if c.random() < c.options.ThrottleRate {
+		header := http.Header{}
+		header.Set(retryAfterHeader, strconv.Itoa(int(c.options.RetryAfter/time.Second)))
+		return chaosError(method, http.StatusTooManyRequests, header)
+	}
+
+	if c.random() < c.options.ErrorRate {
+		return chaosError(method, http.StatusInternalServerError, http.Header{})
+	}
+	return nil
+}
+
+// chaosError is an injected error, looking like a failed response from Azure Key Vault
+func chaosError(method string, statusCode int, header http.Header) error {
+	resp := &http.Response{StatusCode: statusCode, Header: header}
+	return autorest.NewErrorWithError(
+		fmt.Errorf("injected %d %s", statusCode, http.StatusText(statusCode)),
+		"client.chaosService", method, resp, "chaos mode failure")
+}
@@ -0,0 +1,90 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+// sequence returns the given random numbers in order
+func sequence(numbers ...float64) func() float64 {
+	return func() float64 {
+		next := numbers[0]
+		numbers = numbers[1:]
+		return next
+	}
+}
+
+func TestChaosServiceThrottles(t *testing.T) {
+	inner := &countingService{}
+	chaos := NewChaosService(inner, ChaosOptions{ThrottleRate: 0.5, RetryAfter: 3 * time.Second}).(*chaosService)
+	chaos.random = sequence(0.1)
+
+	_, err := chaos.GetSecret(&secret("my-akvs", "my-vault", "my-secret").Spec.Vault)
+	if err == nil {
+		t.Fatal("expected throttling error")
+	}
+	if !IsVaultUnavailable(err) {
+		t.Error("expected throttling to count as vault unavailable")
+	}
+	if delay, ok := RetryAfter(err, time.Now()); !ok || delay != 3*time.Second {
+		t.Errorf("expected retry after 3s, got %s", delay)
+	}
+	if inner.secretCalls != 0 {
+		t.Error("expected throttled request not to reach Azure Key Vault")
+	}
+}
+
+func TestChaosServiceErrors(t *testing.T) {
+	inner := &countingService{}
+	chaos := NewChaosService(inner, ChaosOptions{ErrorRate: 0.5}).(*chaosService)
+	chaos.random = sequence(0.9, 0.1)
+
+	_, err := chaos.GetSecret(&secret("my-akvs", "my-vault", "my-secret").Spec.Vault)
+	if !IsVaultUnavailable(err) {
+		t.Errorf("expected vault unavailable error, got %v", err)
+	}
+	if _, ok := RetryAfter(err, time.Now()); ok {
+		t.Error("expected no retry after for internal server error")
+	}
+}
+
+func TestChaosServiceSlowsDown(t *testing.T) {
+	inner := &countingService{}
+	chaos := NewChaosService(inner, ChaosOptions{SlowRate: 0.5, SlowDelay: time.Second}).(*chaosService)
+	chaos.random = sequence(0.1, 0.9, 0.9)
+	var slept time.Duration
+	chaos.sleep = func(d time.Duration) { slept += d }
+
+	if _, err := chaos.GetSecret(&secret("my-akvs", "my-vault", "my-secret").Spec.Vault); err != nil {
+		t.Fatal(err)
+	}
+	if slept != time.Second {
+		t.Errorf("expected request to be delayed 1s, got %s", slept)
+	}
+	if inner.secretCalls != 1 {
+		t.Errorf("expected slow request to reach Azure Key Vault, got %d calls", inner.secretCalls)
+	}
+}
+
+func TestChaosServiceDisabled(t *testing.T) {
+	inner := &countingService{}
+	if chaos := NewChaosService(inner, ChaosOptions{}); chaos != inner {
+		t.Error("expected service to be returned unwrapped when no faults are injected")
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+
+	akvs "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+)
+
+type credentialSetService struct {
+	defaultService Service
+	services       map[string]Service
+}
+
+// NewCredentialSetService returns a Service using the service of the credential set named in
+// spec.vault.credentialSet, or defaultService if no credential set is named
+func NewCredentialSetService(defaultService Service, services map[string]Service) Service {
+	return &credentialSetService{
+		defaultService: defaultService,
+		services:       services,
+	}
+}
+
+// GetSecret get secret using the credential set of vaultSpec
+func (c *credentialSetService) GetSecret(vaultSpec *akvs.AzureKeyVault) (string, error) {
+	service, err := c.getService(vaultSpec)
+	if err != nil {
+		return "", err
+	}
+	return service.GetSecret(vaultSpec)
+}
+
+// GetKey get key using the credential set of vaultSpec
+func (c *credentialSetService) GetKey(vaultSpec *akvs.AzureKeyVault) (string, error) {
+	service, err := c.getService(vaultSpec)
+	if err != nil {
+		return "", err
+	}
+	return service.GetKey(vaultSpec)
+}
+
+// GetCertificate get certificate using the credential set of vaultSpec
+func (c *credentialSetService) GetCertificate(vaultSpec *akvs.AzureKeyVault, options *CertificateOptions) (*Certificate, error) {
+	service, err := c.getService(vaultSpec)
+	if err != nil {
+		return nil, err
+	}
+	return service.GetCertificate(vaultSpec, options)
+}
+
+// GetObjectVersion get object version using the credential set of vaultSpec
+func (c *credentialSetService) GetObjectVersion(vaultSpec *akvs.AzureKeyVault) (*ObjectVersion, error) {
+	service, err := c.getService(vaultSpec)
+	if err != nil {
+		return nil, err
+	}
+	return service.GetObjectVersion(vaultSpec)
+}
+
+// CreateSecret create secret using the credential set of vaultSpec
+func (c *credentialSetService) CreateSecret(vaultSpec *akvs.AzureKeyVault, value string) error {
+	service, err := c.getService(vaultSpec)
+	if err != nil {
+		return err
+	}
+	return service.CreateSecret(vaultSpec, value)
+}
+
+// Probe probes Azure Key Vault using the credential set of vaultSpec
+func (c *credentialSetService) Probe(vaultSpec *akvs.AzureKeyVault) error {
+	service, err := c.getService(vaultSpec)
+	if err != nil {
+		return err
+	}
+	return service.Probe(vaultSpec)
+}
+
+// SetTags sets tags of object using the credential set of vaultSpec
+func (c *credentialSetService) SetTags(vaultSpec *akvs.AzureKeyVault, tags map[string]string) (*ObjectVersion, error) {
+	service, err := c.getService(vaultSpec)
+	if err != nil {
+		return nil, err
+	}
+	return service.SetTags(vaultSpec, tags)
+}
+
+func (c *credentialSetService) getService(vaultSpec *akvs.AzureKeyVault) (Service, error) {
+	if vaultSpec.CredentialSet == "" {
+		return c.defaultService, nil
+	}
+
+	service, found := c.services[vaultSpec.CredentialSet]
+	if !found {
+		return nil, fmt.Errorf("credential set '%s' used by azure key vault '%s' is not configured in controller", vaultSpec.CredentialSet, vaultSpec.Name)
+	}
+	return service, nil
+}
@@ -0,0 +1,30 @@
+package client
+
+import (
+	"testing"
+)
+
+func TestCredentialSetService(t *testing.T) {
+	defaultService := &countingService{}
+	teamService := &countingService{}
+	service := NewCredentialSetService(defaultService, map[string]Service{"team-a": teamService})
+
+	spec := &secret("first", "my-vault", "my-secret").Spec.Vault
+	service.GetSecret(spec)
+
+	spec.CredentialSet = "team-a"
+	service.GetSecret(spec)
+	service.GetSecret(spec)
+
+	if defaultService.secretCalls != 1 {
+		t.Errorf("expected 1 call using default credentials, got %d", defaultService.secretCalls)
+	}
+	if teamService.secretCalls != 2 {
+		t.Errorf("expected 2 calls using credential set 'team-a', got %d", teamService.secretCalls)
+	}
+
+	spec.CredentialSet = "unknown"
+	if _, err := service.GetSecret(spec); err == nil {
+		t.Error("expected error for credential set not configured")
+	}
+}
@@ -0,0 +1,323 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/keyvault/2016-10-01/keyvault"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/date"
+)
+
+const (
+	requestIDHeader       = "x-ms-request-id"
+	clientRequestIDHeader = "x-ms-client-request-id"
+	retryAfterHeader      = "Retry-After"
+)
+
+// SoftDeletedError is returned when an object does not exist in Azure Key Vault
+// because it has been deleted, but can still be recovered since soft-delete is enabled
+type SoftDeletedError struct {
+	VaultName          string
+	ObjectType         string
+	ObjectName         string
+	ScheduledPurgeDate time.Time
+}
+
+func (e *SoftDeletedError) Error() string {
+	if e.ScheduledPurgeDate.IsZero() {
+		return fmt.Sprintf("%s '%s' is deleted in azure key vault '%s', but can be recovered", e.ObjectType, e.ObjectName, e.VaultName)
+	}
+	return fmt.Sprintf("%s '%s' is deleted in azure key vault '%s', but can be recovered until it is purged at %s", e.ObjectType, e.ObjectName, e.VaultName, e.ScheduledPurgeDate.Format(time.RFC3339))
+}
+
+// IsSoftDeleted returns true if err is, or wraps, a SoftDeletedError
+func IsSoftDeleted(err error) bool {
+	var softDeletedErr *SoftDeletedError
+	return errors.As(err, &softDeletedErr)
+}
+
+// NotExportableError is returned when the private key of a certificate is requested, but the
+// certificate policy in Azure Key Vault has exportable set to false
+type NotExportableError struct {
+	VaultName       string
+	CertificateName string
+}
+
+func (e *NotExportableError) Error() string {
+	return fmt.Sprintf("cannot export private key of certificate '%s' in azure key vault '%s', because the certificate policy does not allow exporting it", e.CertificateName, e.VaultName)
+}
+
+// IsNotExportable returns true if err is, or wraps, a NotExportableError
+func IsNotExportable(err error) bool {
+	var notExportableErr *NotExportableError
+	return errors.As(err, &notExportableErr)
+}
+
+// IsVaultUnavailable returns true if err indicates that Azure Key Vault itself is failing or
+// cannot be reached, as opposed to errors concerning a single object, like not found or forbidden
+func IsVaultUnavailable(err error) bool {
+	if err == nil || IsSoftDeleted(err) || IsNotExportable(err) {
+		return false
+	}
+
+	var detailedErr autorest.DetailedError
+	if errors.As(err, &detailedErr) {
+		if statusCode, ok := detailedErr.StatusCode.(int); ok && statusCode >= 400 && statusCode < 500 {
+			return statusCode == http.StatusRequestTimeout || statusCode == http.StatusTooManyRequests
+		}
+	}
+	return true
+}
+
+// RequestIDs returns the request id assigned by Azure (x-ms-request-id) and the client request id
+// (x-ms-client-request-id) of the failed Azure Key Vault response err originates from, which Azure
+// support needs to trace the request. Both are empty if err did not come from a response.
+func RequestIDs(err error) (requestID string, clientRequestID string) {
+	var detailedErr autorest.DetailedError
+	if !errors.As(err, &detailedErr) || detailedErr.Response == nil {
+		return "", ""
+	}
+	return detailedErr.Response.Header.Get(requestIDHeader), detailedErr.Response.Header.Get(clientRequestIDHeader)
+}
+
+// RetryAfter returns how long Azure Key Vault asked to wait before retrying, using the Retry-After header
+// of the throttled or failed response err originates from. Returns false if err has no such header.
+func RetryAfter(err error, now time.Time) (time.Duration, bool) {
+	var detailedErr autorest.DetailedError
+	if !errors.As(err, &detailedErr) || detailedErr.Response == nil {
+		return 0, false
+	}
+
+	value := detailedErr.Response.Header.Get(retryAfterHeader)
+	if value == "" {
+		return 0, false
+	}
+
+	// Retry-After is either a number of seconds or a HTTP date
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if retryTime, err := http.ParseTime(value); err == nil {
+		if delay := retryTime.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// IsNotFound returns true if err originates from a not found response from Azure Key Vault
+func IsNotFound(err error) bool {
+	var detailedErr autorest.DetailedError
+	if errors.As(err, &detailedErr) {
+		return detailedErr.StatusCode == http.StatusNotFound
+	}
+	return false
+}
+
+// checkSoftDeleted returns a SoftDeletedError if err is a not found error and the object
+// exists as a deleted object in Azure Key Vault, otherwise err is returned unchanged
+func checkSoftDeleted(ctx context.Context, vaultClient *keyvault.BaseClient, baseURL string, vaultName string, objectType string, objectName string, err error) error {
+	if !IsNotFound(err) {
+		return err
+	}
+
+	var purgeDate *date.UnixTime
+	switch objectType {
+	case "secret":
+		deleted, deletedErr := vaultClient.GetDeletedSecret(ctx, baseURL, objectName)
+		if deletedErr != nil {
+			return err
+		}
+		purgeDate = deleted.ScheduledPurgeDate
+	case "certificate":
+		deleted, deletedErr := vaultClient.GetDeletedCertificate(ctx, baseURL, objectName)
+		if deletedErr != nil {
+			return err
+		}
+		purgeDate = deleted.ScheduledPurgeDate
+	case "key":
+		deleted, deletedErr := vaultClient.GetDeletedKey(ctx, baseURL, objectName)
+		if deletedErr != nil {
+			return err
+		}
+		purgeDate = deleted.ScheduledPurgeDate
+	default:
+		return err
+	}
+
+	softDeletedErr := &SoftDeletedError{
+		VaultName:  vaultName,
+		ObjectType: objectType,
+		ObjectName: objectName,
+	}
+	if purgeDate != nil {
+		softDeletedErr.ScheduledPurgeDate = time.Time(*purgeDate)
+	}
+	return softDeletedErr
+}
+
+// PermissionModel is how Azure Key Vault decided to deny a request
+type PermissionModel string
+
+const (
+	// PermissionModelRBAC means the vault uses Azure role-based access control and the identity has no role allowing the request
+	PermissionModelRBAC PermissionModel = "RBAC"
+
+	// PermissionModelAccessPolicy means the vault uses access policies and none give the identity the permission needed
+	PermissionModelAccessPolicy PermissionModel = "AccessPolicy"
+
+	// PermissionModelNetwork means the firewall or network rules of the vault deny requests from the controller
+	PermissionModelNetwork PermissionModel = "Network"
+
+	// PermissionModelUnknown means the response did not tell why the request was denied
+	PermissionModelUnknown PermissionModel = "Unknown"
+)
+
+var (
+	callerObjectIDPattern      = regexp.MustCompile(`oid=([0-9a-fA-F-]+)`)
+	callerApplicationIDPattern = regexp.MustCompile(`appid=([0-9a-fA-F-]+)`)
+	rbacActionPattern          = regexp.MustCompile(`Action: '([^']+)'`)
+	accessPolicyPattern        = regexp.MustCompile(`does not have (\w+) (\w+) permission`)
+)
+
+// Forbidden describes why Azure Key Vault denied a request with 403 Forbidden, as far as told by the response
+type Forbidden struct {
+	Model PermissionModel
+	// ObjectID is the Azure AD object id of the identity denied
+	ObjectID string
+	// ApplicationID is the Azure AD application id of the identity denied
+	ApplicationID string
+	// Action is the data action denied with RBAC, like Microsoft.KeyVault/vaults/secrets/getSecret/action
+	Action string
+	// Permission is the permission missing in the access policies, like get
+	Permission string
+	// PermissionObjectType is the kind of objects the permission is missing for, like secrets
+	PermissionObjectType string
+}
+
+// AsForbidden returns why Azure Key Vault denied the request err originates from,
+// or false if err is not from a 403 Forbidden response
+func AsForbidden(err error) (*Forbidden, bool) {
+	var detailedErr autorest.DetailedError
+	if !errors.As(err, &detailedErr) || detailedErr.StatusCode != http.StatusForbidden {
+		return nil, false
+	}
+
+	forbidden := &Forbidden{Model: PermissionModelUnknown}
+	var serviceErr *azure.ServiceError
+	if requestErr, ok := detailedErr.Original.(*azure.RequestError); ok {
+		serviceErr = requestErr.ServiceError
+	}
+	if serviceErr == nil {
+		return forbidden, true
+	}
+
+	var innerCode string
+	if code, ok := serviceErr.InnerError["code"].(string); ok {
+		innerCode = code
+	}
+	message := serviceErr.Message
+
+	if match := callerObjectIDPattern.FindStringSubmatch(message); match != nil {
+		forbidden.ObjectID = match[1]
+	}
+	if match := callerApplicationIDPattern.FindStringSubmatch(message); match != nil {
+		forbidden.ApplicationID = match[1]
+	}
+
+	switch {
+	case innerCode == "ForbiddenByRbac":
+		forbidden.Model = PermissionModelRBAC
+		if match := rbacActionPattern.FindStringSubmatch(message); match != nil {
+			forbidden.Action = match[1]
+		}
+	case innerCode == "AccessDenied" || accessPolicyPattern.MatchString(message):
+		forbidden.Model = PermissionModelAccessPolicy
+		if match := accessPolicyPattern.FindStringSubmatch(message); match != nil {
+			forbidden.PermissionObjectType, forbidden.Permission = match[1], match[2]
+		}
+	case strings.HasPrefix(innerCode, "ForbiddenBy"):
+		// Like ForbiddenByFirewall and ForbiddenByConnection
+		forbidden.Model = PermissionModelNetwork
+	}
+	return forbidden, true
+}
+
+// Remediation returns what to change in Azure for the request to Azure Key Vault vaultName to be allowed,
+// for objects of objectType (secret, certificate or key) when the response does not tell
+func (f *Forbidden) Remediation(vaultName string, objectType string) string {
+	identity := "the identity of the controller"
+	assignee := "<object id of the identity>"
+	if f.ObjectID != "" {
+		identity = fmt.Sprintf("identity with object id '%s'", f.ObjectID)
+		assignee = f.ObjectID
+	}
+
+	switch f.Model {
+	case PermissionModelRBAC:
+		role := rbacRole(f.Action, objectType)
+		action := ""
+		if f.Action != "" {
+			action = fmt.Sprintf(" for action '%s'", f.Action)
+		}
+		return fmt.Sprintf("azure key vault '%s' uses azure RBAC, and %s has no role assignment%s. Assign it the '%s' role, like: az role assignment create --assignee-object-id %s --role '%s' --scope $(az keyvault show --name %s --query id -o tsv)",
+			vaultName, identity, action, role, assignee, role, vaultName)
+	case PermissionModelAccessPolicy:
+		permissionObjectType, permission := f.PermissionObjectType, f.Permission
+		if permissionObjectType == "" {
+			permissionObjectType, permission = objectType+"s", "get"
+		}
+		return fmt.Sprintf("azure key vault '%s' uses access policies, and %s is missing the '%s' permission on %s. Add it, like: az keyvault set-policy --name %s --object-id %s --%s-permissions %s",
+			vaultName, identity, permission, permissionObjectType, vaultName, assignee, strings.TrimSuffix(permissionObjectType, "s"), permission)
+	case PermissionModelNetwork:
+		return fmt.Sprintf("the firewall of azure key vault '%s' denies requests from the network of the controller. Allow the network of the cluster in the vault networking settings, or use a private endpoint", vaultName)
+	default:
+		return fmt.Sprintf("%s is not allowed to get the %s from azure key vault '%s'. Check the role assignments or access policies of the vault", identity, objectType, vaultName)
+	}
+}
+
+// rbacRole returns the built-in role allowing the RBAC action, or reading objects of objectType if the action is unknown
+func rbacRole(action string, objectType string) string {
+	switch {
+	case strings.Contains(action, "/certificates/"):
+		return "Key Vault Certificate User"
+	case strings.Contains(action, "/keys/"):
+		return "Key Vault Crypto User"
+	case strings.Contains(action, "/secrets/"):
+		return "Key Vault Secrets User"
+	case objectType == "certificate":
+		return "Key Vault Certificate User"
+	case objectType == "key":
+		return "Key Vault Crypto User"
+	default:
+		return "Key Vault Secrets User"
+	}
+}
@@ -0,0 +1,173 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+)
+
+func TestIsSoftDeleted(t *testing.T) {
+	err := fmt.Errorf("failed to get certificate, error: %w", &SoftDeletedError{VaultName: "my-vault", ObjectType: "certificate", ObjectName: "my-cert"})
+	if !IsSoftDeleted(err) {
+		t.Error("expected wrapped SoftDeletedError to be detected")
+	}
+
+	if IsSoftDeleted(fmt.Errorf("some other error")) {
+		t.Error("expected other errors not to be detected as soft-deleted")
+	}
+}
+
+func TestIsNotExportable(t *testing.T) {
+	err := fmt.Errorf("failed to get certificate, error: %w", &NotExportableError{VaultName: "my-vault", CertificateName: "my-cert"})
+	if !IsNotExportable(err) {
+		t.Error("expected wrapped NotExportableError to be detected")
+	}
+	if IsVaultUnavailable(err) {
+		t.Error("expected certificate not exportable not to make the vault unavailable")
+	}
+}
+
+func TestIsNotFound(t *testing.T) {
+	if !IsNotFound(autorest.DetailedError{StatusCode: http.StatusNotFound}) {
+		t.Error("expected 404 to be not found")
+	}
+	if IsNotFound(autorest.DetailedError{StatusCode: http.StatusForbidden}) {
+		t.Error("expected 403 not to be not found")
+	}
+}
+
+func TestRequestIDs(t *testing.T) {
+	resp := &http.Response{StatusCode: http.StatusInternalServerError, Header: http.Header{}}
+	resp.Header.Set("x-ms-request-id", "request-id")
+	resp.Header.Set("x-ms-client-request-id", "client-request-id")
+
+	err := fmt.Errorf("failed, error: %w", autorest.DetailedError{StatusCode: http.StatusInternalServerError, Response: resp})
+	requestID, clientRequestID := RequestIDs(err)
+	if requestID != "request-id" || clientRequestID != "client-request-id" {
+		t.Errorf("expected request ids from response, got '%s' and '%s'", requestID, clientRequestID)
+	}
+
+	if requestID, clientRequestID := RequestIDs(fmt.Errorf("some other error")); requestID != "" || clientRequestID != "" {
+		t.Error("expected no request ids for errors without a response")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		header   string
+		expected time.Duration
+		ok       bool
+	}{
+		{"seconds", "30", 30 * time.Second, true},
+		{"http date", now.Add(time.Minute).Format(http.TimeFormat), time.Minute, true},
+		{"http date passed", now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"missing", "", 0, false},
+		{"invalid", "soon", 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+			if test.header != "" {
+				resp.Header.Set("Retry-After", test.header)
+			}
+			err := fmt.Errorf("failed, error: %w", autorest.DetailedError{StatusCode: http.StatusTooManyRequests, Response: resp})
+
+			delay, ok := RetryAfter(err, now)
+			if delay != test.expected || ok != test.ok {
+				t.Errorf("expected %s, %t, got %s, %t", test.expected, test.ok, delay, ok)
+			}
+		})
+	}
+
+	if _, ok := RetryAfter(fmt.Errorf("some other error"), now); ok {
+		t.Error("expected no retry after for errors without a response")
+	}
+}
+
+func forbiddenError(innerCode string, message string) error {
+	return autorest.DetailedError{
+		StatusCode: http.StatusForbidden,
+		Original: &azure.RequestError{
+			ServiceError: &azure.ServiceError{
+				Code:       "Forbidden",
+				Message:    message,
+				InnerError: map[string]interface{}{"code": innerCode},
+			},
+		},
+	}
+}
+
+func TestAsForbidden(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		expected    Forbidden
+		remediation string
+	}{
+		{
+			name: "rbac",
+			err: forbiddenError("ForbiddenByRbac", "Caller is not authorized to perform action on resource.\r\n"+
+				"Caller: appid=11111111-1111-1111-1111-111111111111;oid=22222222-2222-2222-2222-222222222222;iss=https://sts.windows.net/tenant/\r\n"+
+				"Action: 'Microsoft.KeyVault/vaults/secrets/getSecret/action'\r\nAssignment: (not found)\r\n"),
+			expected: Forbidden{
+				Model:         PermissionModelRBAC,
+				ObjectID:      "22222222-2222-2222-2222-222222222222",
+				ApplicationID: "11111111-1111-1111-1111-111111111111",
+				Action:        "Microsoft.KeyVault/vaults/secrets/getSecret/action",
+			},
+			remediation: "--assignee-object-id 22222222-2222-2222-2222-222222222222 --role 'Key Vault Secrets User'",
+		},
+		{
+			name: "access policy",
+			err: forbiddenError("AccessDenied", "The user, group or application 'appid=11111111-1111-1111-1111-111111111111;oid=22222222-2222-2222-2222-222222222222;iss=https://sts.windows.net/tenant/' "+
+				"does not have certificates get permission on key vault 'my-vault;location=westeurope'."),
+			expected: Forbidden{
+				Model:                PermissionModelAccessPolicy,
+				ObjectID:             "22222222-2222-2222-2222-222222222222",
+				ApplicationID:        "11111111-1111-1111-1111-111111111111",
+				Permission:           "get",
+				PermissionObjectType: "certificates",
+			},
+			remediation: "az keyvault set-policy --name my-vault --object-id 22222222-2222-2222-2222-222222222222 --certificate-permissions get",
+		},
+		{
+			name:        "firewall",
+			err:         forbiddenError("ForbiddenByFirewall", "Client address is not authorized and caller is not a trusted service."),
+			expected:    Forbidden{Model: PermissionModelNetwork},
+			remediation: "firewall of azure key vault 'my-vault'",
+		},
+		{
+			name:        "unknown",
+			err:         fmt.Errorf("failed, error: %w", autorest.DetailedError{StatusCode: http.StatusForbidden}),
+			expected:    Forbidden{Model: PermissionModelUnknown},
+			remediation: "the identity of the controller is not allowed to get the secret",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			forbidden, ok := AsForbidden(test.err)
+			if !ok {
+				t.Fatal("expected error to be forbidden")
+			}
+			if *forbidden != test.expected {
+				t.Errorf("expected %+v, got %+v", test.expected, *forbidden)
+			}
+			if remediation := forbidden.Remediation("my-vault", "secret"); !strings.Contains(remediation, test.remediation) {
+				t.Errorf("expected remediation to contain '%s', got '%s'", test.remediation, remediation)
+			}
+		})
+	}
+
+	if _, ok := AsForbidden(autorest.DetailedError{StatusCode: http.StatusNotFound}); ok {
+		t.Error("expected 404 not to be forbidden")
+	}
+}
@@ -0,0 +1,378 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fake has an in-memory implementation of the Azure Key Vault client.Service,
+// for testing code depending on Azure Key Vault without access to Azure.
+package fake
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+	akvs "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+)
+
+const (
+	objectTypeSecret      = "secret"
+	objectTypeKey         = "key"
+	objectTypeCertificate = "certificate"
+)
+
+type objectVersion struct {
+	id      string
+	value   string
+	created time.Time
+	updated time.Time
+	tags    map[string]string
+}
+
+type object struct {
+	versions      []objectVersion
+	deleted       bool
+	notExportable bool
+	err           error
+}
+
+// Service is an in-memory Azure Key Vault implementing client.Service.
+// Objects are stored per vault, and every Set creates a new version of the object.
+type Service struct {
+	mutex       sync.Mutex
+	objects     map[string]*object
+	probeErrors map[string]error
+	tagsErrors  map[string]error
+	calls       map[string]int
+	version     int
+
+	// Now returns the time used as created and updated timestamp for new versions
+	Now func() time.Time
+}
+
+// NewService creates an empty in-memory Azure Key Vault
+func NewService() *Service {
+	return &Service{
+		objects:     make(map[string]*object),
+		probeErrors: make(map[string]error),
+		tagsErrors:  make(map[string]error),
+		calls:       make(map[string]int),
+		Now:         time.Now,
+	}
+}
+
+// SetSecret creates a new version of a secret and returns the version id
+func (s *Service) SetSecret(vaultName, name, value string) string {
+	return s.set(objectTypeSecret, vaultName, name, value)
+}
+
+// SetKey creates a new version of a key and returns the version id
+func (s *Service) SetKey(vaultName, name, value string) string {
+	return s.set(objectTypeKey, vaultName, name, value)
+}
+
+// SetCertificate creates a new version of a certificate from a pem encoded
+// certificate and private key, and returns the version id
+func (s *Service) SetCertificate(vaultName, name, pem string) string {
+	return s.set(objectTypeCertificate, vaultName, name, pem)
+}
+
+// SetNotExportable makes requests for the private key of the certificate fail with a
+// client.NotExportableError, like when its policy has exportable set to false
+func (s *Service) SetNotExportable(vaultName, name string, notExportable bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.getOrCreate(objectTypeCertificate, vaultName, name).notExportable = notExportable
+}
+
+// SetError makes all requests for the object fail with err, until cleared with a nil err
+func (s *Service) SetError(vaultName, objectType, name string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.getOrCreate(objectType, vaultName, name).err = err
+}
+
+// Delete soft-deletes the object, making requests for it fail with a client.SoftDeletedError
+func (s *Service) Delete(vaultName, objectType, name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.getOrCreate(objectType, vaultName, name).deleted = true
+}
+
+// Purge removes the object with all its versions, making requests for it fail with not found
+func (s *Service) Purge(vaultName, objectType, name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.objects, objectKey(objectType, vaultName, name))
+}
+
+// Calls returns number of calls made to a Service method, like "GetSecret"
+func (s *Service) Calls(method string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.calls[method]
+}
+
+// GetSecret returns the secret value
+func (s *Service) GetSecret(vaultSpec *akvs.AzureKeyVault) (string, error) {
+	version, err := s.get("GetSecret", objectTypeSecret, vaultSpec)
+	if err != nil {
+		return "", err
+	}
+	return version.value, nil
+}
+
+// GetKey returns the key value
+func (s *Service) GetKey(vaultSpec *akvs.AzureKeyVault) (string, error) {
+	version, err := s.get("GetKey", objectTypeKey, vaultSpec)
+	if err != nil {
+		return "", err
+	}
+	return version.value, nil
+}
+
+// GetCertificate returns the certificate
+func (s *Service) GetCertificate(vaultSpec *akvs.AzureKeyVault, options *vault.CertificateOptions) (*vault.Certificate, error) {
+	version, err := s.get("GetCertificate", objectTypeCertificate, vaultSpec)
+	if err != nil {
+		return nil, err
+	}
+	if options.ExportPrivateKey && s.isNotExportable(vaultSpec) {
+		return nil, &vault.NotExportableError{VaultName: vaultSpec.Name, CertificateName: vaultSpec.Object.Name}
+	}
+	return vault.NewCertificateFromPem(version.value)
+}
+
+// GetObjectVersion returns the current version of the object
+func (s *Service) GetObjectVersion(vaultSpec *akvs.AzureKeyVault) (*vault.ObjectVersion, error) {
+	version, err := s.get("GetObjectVersion", objectTypeFor(vaultSpec.Object.Type), vaultSpec)
+	if err != nil {
+		return nil, err
+	}
+	return newObjectVersion(vaultSpec, version), nil
+}
+
+// CreateSecret creates a new version of the secret, unless an error is set for it
+func (s *Service) CreateSecret(vaultSpec *akvs.AzureKeyVault, value string) error {
+	s.mutex.Lock()
+	s.calls["CreateSecret"]++
+	var err error
+	if obj, found := s.objects[objectKey(objectTypeSecret, vaultSpec.Name, vaultSpec.Object.Name)]; found {
+		err = obj.err
+	}
+	s.mutex.Unlock()
+
+	if err != nil {
+		return err
+	}
+	s.set(objectTypeSecret, vaultSpec.Name, vaultSpec.Object.Name, value)
+	return nil
+}
+
+// SetProbeError makes Probe of the vault fail with err, until cleared with a nil err
+func (s *Service) SetProbeError(vaultName string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err == nil {
+		delete(s.probeErrors, vaultName)
+		return
+	}
+	s.probeErrors[vaultName] = err
+}
+
+// Probe succeeds, unless an error is set with SetProbeError for the vault
+func (s *Service) Probe(vaultSpec *akvs.AzureKeyVault) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.calls["Probe"]++
+	return s.probeErrors[vaultSpec.Name]
+}
+
+// SetTagsError makes SetTags of objects in the vault fail with err, until cleared with a nil err
+func (s *Service) SetTagsError(vaultName string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err == nil {
+		delete(s.tagsErrors, vaultName)
+		return
+	}
+	s.tagsErrors[vaultName] = err
+}
+
+// SetTags merges the tags into the tags of the object version, updating its updated timestamp if any tag changed
+func (s *Service) SetTags(vaultSpec *akvs.AzureKeyVault, tags map[string]string) (*vault.ObjectVersion, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.calls["SetTags"]++
+	if err := s.tagsErrors[vaultSpec.Name]; err != nil {
+		return nil, err
+	}
+
+	version, err := s.lookup(objectTypeFor(vaultSpec.Object.Type), vaultSpec.Name, vaultSpec.Object.Name, vaultSpec.Object.Version)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range tags {
+		if existing, ok := version.tags[name]; !ok || existing != value {
+			if version.tags == nil {
+				version.tags = make(map[string]string)
+			}
+			version.tags[name] = value
+			version.updated = s.Now()
+		}
+	}
+	return newObjectVersion(vaultSpec, version), nil
+}
+
+// Tags returns the tags of the latest version of the object
+func (s *Service) Tags(vaultName, objectType, name string) map[string]string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	version, err := s.lookup(objectType, vaultName, name, "")
+	if err != nil {
+		return nil
+	}
+	tags := make(map[string]string, len(version.tags))
+	for name, value := range version.tags {
+		tags[name] = value
+	}
+	return tags
+}
+
+func (s *Service) set(objectType, vaultName, name, value string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.version++
+	id := fmt.Sprintf("%032x", s.version)
+
+	obj := s.getOrCreate(objectType, vaultName, name)
+	obj.deleted = false
+	now := s.Now()
+	obj.versions = append(obj.versions, objectVersion{
+		id:      id,
+		value:   value,
+		created: now,
+		updated: now,
+	})
+	return id
+}
+
+func (s *Service) get(method, objectType string, vaultSpec *akvs.AzureKeyVault) (*objectVersion, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.calls[method]++
+
+	return s.lookup(objectType, vaultSpec.Name, vaultSpec.Object.Name, vaultSpec.Object.Version)
+}
+
+// lookup returns the version of the object, or the latest version if version is empty.
+// Must be called while holding the mutex.
+func (s *Service) lookup(objectType, vaultName, name, version string) (*objectVersion, error) {
+	obj, found := s.objects[objectKey(objectType, vaultName, name)]
+	if !found {
+		return nil, notFound(objectType, vaultName, name)
+	}
+	if obj.err != nil {
+		return nil, obj.err
+	}
+	if obj.deleted {
+		return nil, &vault.SoftDeletedError{
+			VaultName:  vaultName,
+			ObjectType: objectType,
+			ObjectName: name,
+		}
+	}
+
+	if len(obj.versions) == 0 {
+		return nil, notFound(objectType, vaultName, name)
+	}
+
+	if version == "" {
+		return &obj.versions[len(obj.versions)-1], nil
+	}
+
+	for i := range obj.versions {
+		if obj.versions[i].id == version {
+			return &obj.versions[i], nil
+		}
+	}
+	return nil, notFound(objectType, vaultName, name)
+}
+
+func (s *Service) isNotExportable(vaultSpec *akvs.AzureKeyVault) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	obj, found := s.objects[objectKey(objectTypeCertificate, vaultSpec.Name, vaultSpec.Object.Name)]
+	return found && obj.notExportable
+}
+
+// getOrCreate must be called while holding the mutex
+func (s *Service) getOrCreate(objectType, vaultName, name string) *object {
+	key := objectKey(objectType, vaultName, name)
+	obj, found := s.objects[key]
+	if !found {
+		obj = &object{}
+		s.objects[key] = obj
+	}
+	return obj
+}
+
+func newObjectVersion(vaultSpec *akvs.AzureKeyVault, version *objectVersion) *vault.ObjectVersion {
+	objectVersion := &vault.ObjectVersion{ID: version.id, Created: version.created, Updated: version.updated}
+	if vaultSpec.Object.Type == akvs.AzureKeyVaultObjectTypeCertificate {
+		thumbprint := sha1.Sum([]byte(version.value))
+		objectVersion.Thumbprint = base64.RawURLEncoding.EncodeToString(thumbprint[:])
+	}
+	return objectVersion
+}
+
+func objectKey(objectType, vaultName, name string) string {
+	return fmt.Sprintf("%s/%s/%s", vaultName, objectType, name)
+}
+
+func objectTypeFor(objectType akvs.AzureKeyVaultObjectType) string {
+	switch objectType {
+	case akvs.AzureKeyVaultObjectTypeCertificate:
+		return objectTypeCertificate
+	case akvs.AzureKeyVaultObjectTypeKey:
+		return objectTypeKey
+	default:
+		return objectTypeSecret
+	}
+}
+
+func notFound(objectType, vaultName, name string) error {
+	return autorest.DetailedError{
+		StatusCode: http.StatusNotFound,
+		Message:    fmt.Sprintf("%s '%s' not found in azure key vault '%s'", objectType, name, vaultName),
+	}
+}
@@ -0,0 +1,337 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/credentialprovider"
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+)
+
+// serverToken is the bearer token the Server accepts, provided by the credentials of Server.Credentials
+const serverToken = "fake-azure-key-vault-token"
+
+// softDeleteRetention is how long soft-deleted objects are kept before scheduled to be purged
+const softDeleteRetention = 90 * 24 * time.Hour
+
+// Server serves the secrets, certificates and keys REST API of Azure Key Vault over HTTPS, backed by
+// the objects of a Service, for testing the Azure SDK based client.Service end-to-end. Vaults are
+// served below the first path segment, like https://127.0.0.1:<port>/<vault>/secrets/<name>.
+type Server struct {
+	*httptest.Server
+	service *Service
+}
+
+// NewServer starts a Server serving the objects of service. Close it when done.
+func NewServer(service *Service) *Server {
+	s := &Server{service: service}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Credentials returns credentials authenticating with the Server, with endpoints of vaults on the Server
+func (s *Server) Credentials() (*credentialprovider.AzureKeyVaultCredentials, error) {
+	oauthConfig, err := adal.NewOAuthConfig("https://login.microsoftonline.com/", "fake-tenant")
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := adal.NewServicePrincipalTokenFromManualToken(*oauthConfig, "fake-client-id", "https://vault.azure.net", adal.Token{
+		AccessToken: serverToken,
+		ExpiresOn:   json.Number(strconv.FormatInt(time.Now().Add(24*time.Hour).Unix(), 10)),
+		Resource:    "https://vault.azure.net",
+		Type:        "Bearer",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &credentialprovider.AzureKeyVaultCredentials{
+		ClientID:        "fake-client-id",
+		Token:           token,
+		EndpointPartial: s.URL + "/%s",
+	}, nil
+}
+
+// NewVaultService returns a client.Service sending requests to the Server, trusting its certificate
+func (s *Server) NewVaultService() (vault.Service, error) {
+	credentials, err := s.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	return vault.NewServiceWithSender(credentials, s.Client()), nil
+}
+
+type serverError struct {
+	Error serverErrorDetails `json:"error"`
+}
+
+type serverErrorDetails struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type serverAttributes struct {
+	Enabled bool  `json:"enabled"`
+	Created int64 `json:"created"`
+	Updated int64 `json:"updated"`
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+serverToken {
+		writeServerError(w, http.StatusUnauthorized, "Unauthorized", "invalid bearer token")
+		return
+	}
+	if r.Method != http.MethodGet {
+		writeServerError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", fmt.Sprintf("method %s not supported by fake", r.Method))
+		return
+	}
+
+	// /<vault>/<collection>/<name>[/<version>|/versions]
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 3 || len(parts) > 4 {
+		writeServerError(w, http.StatusNotFound, "NotFound", fmt.Sprintf("path %s not supported by fake", r.URL.Path))
+		return
+	}
+	vaultName, collection, name := parts[0], parts[1], parts[2]
+	version := ""
+	if len(parts) == 4 {
+		version = parts[3]
+	}
+
+	s.service.mutex.Lock()
+	defer s.service.mutex.Unlock()
+
+	baseURL := fmt.Sprintf("%s/%s", s.URL, vaultName)
+	switch collection {
+	case "secrets":
+		if version == "versions" {
+			s.serveSecretVersions(w, baseURL, vaultName, name)
+			return
+		}
+		s.serveSecret(w, baseURL, vaultName, name, version)
+	case "certificates":
+		s.serveCertificate(w, baseURL, vaultName, name, version)
+	case "keys":
+		s.serveKey(w, baseURL, vaultName, name, version)
+	case "deletedsecrets":
+		s.serveDeleted(w, baseURL, objectTypeSecret, vaultName, name)
+	case "deletedcertificates":
+		s.serveDeleted(w, baseURL, objectTypeCertificate, vaultName, name)
+	case "deletedkeys":
+		s.serveDeleted(w, baseURL, objectTypeKey, vaultName, name)
+	default:
+		writeServerError(w, http.StatusNotFound, "NotFound", fmt.Sprintf("path %s not supported by fake", r.URL.Path))
+	}
+}
+
+// secretObjectType returns the type of object backing the secret, as certificates can be read as secrets
+func (s *Server) secretObjectType(vaultName, name string) string {
+	if _, found := s.service.objects[objectKey(objectTypeSecret, vaultName, name)]; !found {
+		if _, found := s.service.objects[objectKey(objectTypeCertificate, vaultName, name)]; found {
+			return objectTypeCertificate
+		}
+	}
+	return objectTypeSecret
+}
+
+func (s *Server) serveSecret(w http.ResponseWriter, baseURL, vaultName, name, version string) {
+	objectType := s.secretObjectType(vaultName, name)
+	found, err := s.service.lookup(objectType, vaultName, name, version)
+	if err != nil {
+		writeLookupError(w, objectTypeSecret, err)
+		return
+	}
+
+	bundle := map[string]interface{}{
+		"value":      found.value,
+		"id":         fmt.Sprintf("%s/secrets/%s/%s", baseURL, name, found.id),
+		"attributes": newServerAttributes(found),
+	}
+	if objectType == objectTypeCertificate {
+		bundle["contentType"] = "application/x-pem-file"
+		bundle["kid"] = fmt.Sprintf("%s/keys/%s/%s", baseURL, name, found.id)
+		bundle["managed"] = true
+	}
+	writeServerJSON(w, bundle)
+}
+
+func (s *Server) serveSecretVersions(w http.ResponseWriter, baseURL, vaultName, name string) {
+	objectType := s.secretObjectType(vaultName, name)
+	if _, err := s.service.lookup(objectType, vaultName, name, ""); err != nil {
+		writeLookupError(w, objectTypeSecret, err)
+		return
+	}
+
+	obj := s.service.objects[objectKey(objectType, vaultName, name)]
+	items := []map[string]interface{}{}
+	for i := range obj.versions {
+		items = append(items, map[string]interface{}{
+			"id":         fmt.Sprintf("%s/secrets/%s/%s", baseURL, name, obj.versions[i].id),
+			"attributes": newServerAttributes(&obj.versions[i]),
+		})
+	}
+
+	// Newest first, so the newest of versions created within the same second is seen as current
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+
+	writeServerJSON(w, map[string]interface{}{
+		"value":    items,
+		"nextLink": nil,
+	})
+}
+
+func (s *Server) serveCertificate(w http.ResponseWriter, baseURL, vaultName, name, version string) {
+	found, err := s.service.lookup(objectTypeCertificate, vaultName, name, version)
+	if err != nil {
+		writeLookupError(w, objectTypeCertificate, err)
+		return
+	}
+
+	cer := certificateDER(found.value)
+	if cer == nil {
+		writeServerError(w, http.StatusBadRequest, "BadParameter", fmt.Sprintf("certificate '%s' has no pem encoded certificate", name))
+		return
+	}
+	thumbprint := sha1.Sum(cer)
+
+	writeServerJSON(w, map[string]interface{}{
+		"id":         fmt.Sprintf("%s/certificates/%s/%s", baseURL, name, found.id),
+		"kid":        fmt.Sprintf("%s/keys/%s/%s", baseURL, name, found.id),
+		"sid":        fmt.Sprintf("%s/secrets/%s/%s", baseURL, name, found.id),
+		"x5t":        base64.RawURLEncoding.EncodeToString(thumbprint[:]),
+		"cer":        cer,
+		"attributes": newServerAttributes(found),
+		"policy": map[string]interface{}{
+			"key_props": map[string]interface{}{
+				"exportable": true,
+			},
+			"secret_props": map[string]interface{}{
+				"contentType": "application/x-pem-file",
+			},
+		},
+	})
+}
+
+func (s *Server) serveKey(w http.ResponseWriter, baseURL, vaultName, name, version string) {
+	found, err := s.service.lookup(objectTypeKey, vaultName, name, version)
+	if err != nil {
+		writeLookupError(w, objectTypeKey, err)
+		return
+	}
+
+	writeServerJSON(w, map[string]interface{}{
+		"key": map[string]interface{}{
+			"kid": fmt.Sprintf("%s/keys/%s/%s", baseURL, name, found.id),
+			"kty": "RSA",
+			"n":   found.value,
+		},
+		"attributes": newServerAttributes(found),
+	})
+}
+
+func (s *Server) serveDeleted(w http.ResponseWriter, baseURL, objectType, vaultName, name string) {
+	obj, found := s.service.objects[objectKey(objectType, vaultName, name)]
+	if !found || !obj.deleted {
+		writeServerError(w, http.StatusNotFound, notFoundCode(objectType), fmt.Sprintf("deleted %s '%s' not found", objectType, name))
+		return
+	}
+
+	deleted := s.service.Now()
+	writeServerJSON(w, map[string]interface{}{
+		"id":                 fmt.Sprintf("%s/%ss/%s", baseURL, objectType, name),
+		"recoveryId":         fmt.Sprintf("%s/deleted%ss/%s", baseURL, objectType, name),
+		"deletedDate":        deleted.Unix(),
+		"scheduledPurgeDate": deleted.Add(softDeleteRetention).Unix(),
+	})
+}
+
+// certificateDER returns the first certificate of a pem encoded certificate and private key
+func certificateDER(value string) []byte {
+	rest := []byte(value)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return nil
+		}
+		if block.Type == "CERTIFICATE" {
+			return block.Bytes
+		}
+	}
+}
+
+func newServerAttributes(version *objectVersion) serverAttributes {
+	return serverAttributes{
+		Enabled: true,
+		Created: version.created.Unix(),
+		Updated: version.updated.Unix(),
+	}
+}
+
+func notFoundCode(objectType string) string {
+	return strings.ToUpper(objectType[:1]) + objectType[1:] + "NotFound"
+}
+
+// writeLookupError responds like Azure Key Vault to objects not found or soft-deleted, and with
+// the status code of errors set using SetError, or 400 Bad Request as it is not retried by clients
+func writeLookupError(w http.ResponseWriter, objectType string, err error) {
+	var softDeleted *vault.SoftDeletedError
+	var detailed autorest.DetailedError
+	switch {
+	case errors.As(err, &softDeleted):
+		writeServerError(w, http.StatusNotFound, notFoundCode(objectType), err.Error())
+	case errors.As(err, &detailed):
+		statusCode, ok := detailed.StatusCode.(int)
+		if !ok {
+			statusCode = http.StatusBadRequest
+		}
+		code := "BadParameter"
+		if statusCode == http.StatusNotFound {
+			code = notFoundCode(objectType)
+		}
+		writeServerError(w, statusCode, code, detailed.Message)
+	default:
+		writeServerError(w, http.StatusBadRequest, "BadParameter", err.Error())
+	}
+}
+
+func writeServerError(w http.ResponseWriter, statusCode int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(&serverError{Error: serverErrorDetails{Code: code, Message: message}})
+}
+
+func writeServerJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
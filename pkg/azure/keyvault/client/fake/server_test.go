@@ -0,0 +1,161 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	vault "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/azure/keyvault/client"
+	akvs "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+)
+
+func newTestServer(t *testing.T) (*Service, *Server, vault.Service) {
+	service := NewService()
+	server := NewServer(service)
+	client, err := server.NewVaultService()
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	return service, server, client
+}
+
+func newVaultSpec(objectType akvs.AzureKeyVaultObjectType, name string) *akvs.AzureKeyVault {
+	return &akvs.AzureKeyVault{
+		Name: "my-vault",
+		Object: akvs.AzureKeyVaultObject{
+			Type: objectType,
+			Name: name,
+		},
+	}
+}
+
+func newCertificatePem(t *testing.T) string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "fake"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})) +
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestServerSecret(t *testing.T) {
+	service, server, client := newTestServer(t)
+	defer server.Close()
+
+	spec := newVaultSpec(akvs.AzureKeyVaultObjectTypeSecret, "my-secret")
+	first := service.SetSecret("my-vault", "my-secret", "first")
+	second := service.SetSecret("my-vault", "my-secret", "second")
+
+	value, err := client.GetSecret(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "second" {
+		t.Errorf("expected latest secret value 'second', got '%s'", value)
+	}
+
+	version, err := client.GetObjectVersion(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version.ID != second {
+		t.Errorf("expected current version %s, got %s", second, version.ID)
+	}
+
+	spec.Object.Version = first
+	if value, err = client.GetSecret(spec); err != nil || value != "first" {
+		t.Errorf("expected secret value 'first' of first version, got '%s', error: %v", value, err)
+	}
+}
+
+func TestServerCertificate(t *testing.T) {
+	service, server, client := newTestServer(t)
+	defer server.Close()
+
+	service.SetCertificate("my-vault", "my-cert", newCertificatePem(t))
+	spec := newVaultSpec(akvs.AzureKeyVaultObjectTypeCertificate, "my-cert")
+
+	cert, err := client.GetCertificate(spec, &vault.CertificateOptions{ExportPrivateKey: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Certificates[0].Subject.CommonName != "fake" {
+		t.Errorf("expected certificate for 'fake', got '%s'", cert.Certificates[0].Subject.CommonName)
+	}
+
+	version, err := client.GetObjectVersion(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version.Thumbprint == "" {
+		t.Error("expected certificate version to have a thumbprint")
+	}
+}
+
+func TestServerSoftDeleted(t *testing.T) {
+	service, server, client := newTestServer(t)
+	defer server.Close()
+
+	service.SetSecret("my-vault", "my-secret", "value")
+	service.Delete("my-vault", objectTypeSecret, "my-secret")
+
+	_, err := client.GetSecret(newVaultSpec(akvs.AzureKeyVaultObjectTypeSecret, "my-secret"))
+	var softDeleted *vault.SoftDeletedError
+	if !errors.As(err, &softDeleted) {
+		t.Fatalf("expected soft deleted error, got %v", err)
+	}
+	if softDeleted.ScheduledPurgeDate.IsZero() {
+		t.Error("expected scheduled purge date to be set")
+	}
+
+	if _, err := client.GetSecret(newVaultSpec(akvs.AzureKeyVaultObjectTypeSecret, "missing")); err == nil || errors.As(err, &softDeleted) {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
+
+func TestServerInvalidToken(t *testing.T) {
+	_, server, _ := newTestServer(t)
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "/my-vault/secrets/my-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 401 {
+		t.Errorf("expected status 401, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	akvs "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+)
+
+type limitedService struct {
+	service   Service
+	semaphore chan struct{}
+}
+
+// NewLimitedService wraps a Service allowing at most maxConcurrent requests to Azure Key Vault
+// at the same time, making further requests wait for one to finish. A maxConcurrent of zero or
+// less disables the limit.
+func NewLimitedService(service Service, maxConcurrent int) Service {
+	if maxConcurrent <= 0 {
+		return service
+	}
+	return &limitedService{
+		service:   service,
+		semaphore: make(chan struct{}, maxConcurrent),
+	}
+}
+
+// GetSecret get secret from Azure Key Vault when below the limit
+func (l *limitedService) GetSecret(vaultSpec *akvs.AzureKeyVault) (string, error) {
+	defer l.acquire()()
+	return l.service.GetSecret(vaultSpec)
+}
+
+// GetKey get key from Azure Key Vault when below the limit
+func (l *limitedService) GetKey(vaultSpec *akvs.AzureKeyVault) (string, error) {
+	defer l.acquire()()
+	return l.service.GetKey(vaultSpec)
+}
+
+// GetCertificate get certificate from Azure Key Vault when below the limit
+func (l *limitedService) GetCertificate(vaultSpec *akvs.AzureKeyVault, options *CertificateOptions) (*Certificate, error) {
+	defer l.acquire()()
+	return l.service.GetCertificate(vaultSpec, options)
+}
+
+// GetObjectVersion get object version from Azure Key Vault when below the limit
+func (l *limitedService) GetObjectVersion(vaultSpec *akvs.AzureKeyVault) (*ObjectVersion, error) {
+	defer l.acquire()()
+	return l.service.GetObjectVersion(vaultSpec)
+}
+
+// CreateSecret create secret in Azure Key Vault when below the limit
+func (l *limitedService) CreateSecret(vaultSpec *akvs.AzureKeyVault, value string) error {
+	defer l.acquire()()
+	return l.service.CreateSecret(vaultSpec, value)
+}
+
+// Probe probes Azure Key Vault when below the limit
+func (l *limitedService) Probe(vaultSpec *akvs.AzureKeyVault) error {
+	defer l.acquire()()
+	return l.service.Probe(vaultSpec)
+}
+
+// SetTags sets tags of object in Azure Key Vault when below the limit
+func (l *limitedService) SetTags(vaultSpec *akvs.AzureKeyVault, tags map[string]string) (*ObjectVersion, error) {
+	defer l.acquire()()
+	return l.service.SetTags(vaultSpec, tags)
+}
+
+// acquire waits for a free slot and returns a func releasing it
+func (l *limitedService) acquire() func() {
+	l.semaphore <- struct{}{}
+	return func() {
+		<-l.semaphore
+	}
+}
@@ -0,0 +1,75 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	akvs "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+)
+
+type slowService struct {
+	countingService
+	inFlight    int32
+	maxInFlight int32
+}
+
+func (s *slowService) GetSecret(vaultSpec *akvs.AzureKeyVault) (string, error) {
+	current := atomic.AddInt32(&s.inFlight, 1)
+	defer atomic.AddInt32(&s.inFlight, -1)
+
+	for {
+		max := atomic.LoadInt32(&s.maxInFlight)
+		if current <= max || atomic.CompareAndSwapInt32(&s.maxInFlight, max, current) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	return "value", nil
+}
+
+func TestLimitedServiceCapsConcurrentRequests(t *testing.T) {
+	inner := &slowService{}
+	limited := NewLimitedService(inner, 2)
+	vaultSpec := &secret("my-akvs", "my-vault", "my-secret").Spec.Vault
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := limited.GetSecret(vaultSpec); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if max := atomic.LoadInt32(&inner.maxInFlight); max > 2 {
+		t.Errorf("expected at most 2 concurrent requests to Azure Key Vault, got %d", max)
+	}
+}
+
+func TestLimitedServiceDisabled(t *testing.T) {
+	inner := &countingService{}
+	if limited := NewLimitedService(inner, 0); limited != inner {
+		t.Error("expected service to be returned unwrapped when limit is zero")
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	akvs "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "akv2k8s_azure_keyvault"
+
+type metricsService struct {
+	service  Service
+	duration *prometheus.HistogramVec
+	requests *prometheus.CounterVec
+	now      func() time.Time
+}
+
+// NewMetricsService wraps a Service, exporting the latency and result of requests to Azure Key Vault
+// labeled by vault name, so a vault throttling or slowing down syncs can be found
+func NewMetricsService(service Service, registerer prometheus.Registerer) (Service, error) {
+	m := &metricsService{
+		service: service,
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "request_duration_seconds",
+			Help:      "How long in seconds requests to Azure Key Vault take",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+		}, []string{"vault", "operation"}),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "requests_total",
+			Help:      "Total number of requests to Azure Key Vault by result code, being the HTTP status code of failed requests, 'ok' or 'error' if failing without a response",
+		}, []string{"vault", "operation", "code"}),
+		now: time.Now,
+	}
+
+	for _, collector := range []prometheus.Collector{m.duration, m.requests} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// GetSecret get secret from Azure Key Vault, recording its latency and result
+func (m *metricsService) GetSecret(vaultSpec *akvs.AzureKeyVault) (string, error) {
+	start := m.now()
+	value, err := m.service.GetSecret(vaultSpec)
+	m.record(vaultSpec, "GetSecret", start, err)
+	return value, err
+}
+
+// GetKey get key from Azure Key Vault, recording its latency and result
+func (m *metricsService) GetKey(vaultSpec *akvs.AzureKeyVault) (string, error) {
+	start := m.now()
+	value, err := m.service.GetKey(vaultSpec)
+	m.record(vaultSpec, "GetKey", start, err)
+	return value, err
+}
+
+// GetCertificate get certificate from Azure Key Vault, recording its latency and result
+func (m *metricsService) GetCertificate(vaultSpec *akvs.AzureKeyVault, options *CertificateOptions) (*Certificate, error) {
+	start := m.now()
+	value, err := m.service.GetCertificate(vaultSpec, options)
+	m.record(vaultSpec, "GetCertificate", start, err)
+	return value, err
+}
+
+// GetObjectVersion get object version from Azure Key Vault, recording its latency and result
+func (m *metricsService) GetObjectVersion(vaultSpec *akvs.AzureKeyVault) (*ObjectVersion, error) {
+	start := m.now()
+	value, err := m.service.GetObjectVersion(vaultSpec)
+	m.record(vaultSpec, "GetObjectVersion", start, err)
+	return value, err
+}
+
+// CreateSecret create secret in Azure Key Vault, recording its latency and result
+func (m *metricsService) CreateSecret(vaultSpec *akvs.AzureKeyVault, value string) error {
+	start := m.now()
+	err := m.service.CreateSecret(vaultSpec, value)
+	m.record(vaultSpec, "CreateSecret", start, err)
+	return err
+}
+
+// Probe probes Azure Key Vault, recording its latency and result
+func (m *metricsService) Probe(vaultSpec *akvs.AzureKeyVault) error {
+	start := m.now()
+	err := m.service.Probe(vaultSpec)
+	m.record(vaultSpec, "Probe", start, err)
+	return err
+}
+
+// SetTags sets tags of object in Azure Key Vault, recording its latency and result
+func (m *metricsService) SetTags(vaultSpec *akvs.AzureKeyVault, tags map[string]string) (*ObjectVersion, error) {
+	start := m.now()
+	value, err := m.service.SetTags(vaultSpec, tags)
+	m.record(vaultSpec, "SetTags", start, err)
+	return value, err
+}
+
+// record observes the duration and counts the result of a request to Azure Key Vault
+func (m *metricsService) record(vaultSpec *akvs.AzureKeyVault, operation string, start time.Time, err error) {
+	m.duration.WithLabelValues(vaultSpec.Name, operation).Observe(m.now().Sub(start).Seconds())
+	m.requests.WithLabelValues(vaultSpec.Name, operation, resultCode(err)).Inc()
+}
+
+// resultCode returns the HTTP status code of the failed response err originates from, "ok" if
+// err is nil, or "error" if it did not come from a response
+func resultCode(err error) string {
+	if err == nil {
+		return "ok"
+	}
+
+	var detailedErr autorest.DetailedError
+	if errors.As(err, &detailedErr) {
+		if statusCode, ok := detailedErr.StatusCode.(int); ok && statusCode > 0 {
+			return strconv.Itoa(statusCode)
+		}
+	}
+	return "error"
+}
@@ -0,0 +1,74 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMetricsServiceLabelsByVault(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	inner := &countingService{}
+	service, err := NewMetricsService(inner, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service.GetSecret(&secret("my-akvs", "vault-a", "my-secret").Spec.Vault)
+	inner.err = autorest.NewErrorWithResponse("keyvault.BaseClient", "GetSecret", &http.Response{StatusCode: http.StatusTooManyRequests}, "Failure responding to request")
+	service.GetSecret(&secret("my-akvs", "vault-b", "my-secret").Spec.Vault)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := map[string]float64{}
+	var observed uint64
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			var labels []string
+			for _, label := range metric.Label {
+				labels = append(labels, label.GetValue())
+			}
+			switch family.GetName() {
+			case "akv2k8s_azure_keyvault_requests_total":
+				requests[strings.Join(labels, "/")] = metric.Counter.GetValue()
+			case "akv2k8s_azure_keyvault_request_duration_seconds":
+				observed += metric.Histogram.GetSampleCount()
+			}
+		}
+	}
+
+	expected := map[string]float64{
+		"429/GetSecret/vault-b": 1,
+		"ok/GetSecret/vault-a":  1,
+	}
+	for name, value := range expected {
+		if requests[name] != value {
+			t.Errorf("expected %v requests for %s, got %v (all: %v)", value, name, requests[name], requests)
+		}
+	}
+	if observed != 2 {
+		t.Errorf("expected 2 observed request durations, got %d", observed)
+	}
+}
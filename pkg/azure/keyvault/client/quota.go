@@ -0,0 +1,218 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"sync"
+	"time"
+
+	akvs "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// DefaultQuotaWindow is the period of the documented service limits of Azure Key Vault
+	DefaultQuotaWindow = 10 * time.Second
+
+	// DefaultQuotaLimit is the documented number of transactions on secrets, keys and certificates
+	// allowed per vault within DefaultQuotaWindow, before Azure Key Vault throttles requests
+	DefaultQuotaLimit = 4000
+
+	// quotaBuckets is the number of buckets the window is split into, deciding how precise the estimate is
+	quotaBuckets = 10
+)
+
+// quotaBucket is the number of requests to a vault starting within a part of the window
+type quotaBucket struct {
+	start time.Time
+	count int
+}
+
+// QuotaTracker estimates the requests made to each Azure Key Vault within a rolling window, to tell how
+// close each vault is to being throttled. Requests are only counted by this replica, so the vault may
+// be closer to its limit when shared with other clients.
+type QuotaTracker struct {
+	window time.Duration
+	limit  int
+	now    func() time.Time
+
+	mutex    sync.Mutex
+	requests map[string][]quotaBucket
+
+	requestsDesc *prometheus.Desc
+	usageDesc    *prometheus.Desc
+}
+
+// NewQuotaTracker returns a QuotaTracker for a limit of requests per window, like DefaultQuotaLimit and DefaultQuotaWindow
+func NewQuotaTracker(window time.Duration, limit int) *QuotaTracker {
+	return &QuotaTracker{
+		window:   window,
+		limit:    limit,
+		now:      time.Now,
+		requests: make(map[string][]quotaBucket),
+		requestsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "quota_requests"),
+			"Estimated number of requests to the Azure Key Vault within the quota window",
+			[]string{"vault"}, nil),
+		usageDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(metricsNamespace, "", "quota_usage_ratio"),
+			"Estimated fraction of the request limit of the Azure Key Vault used within the quota window",
+			[]string{"vault"}, nil),
+	}
+}
+
+// Window returns the period requests are counted over
+func (q *QuotaTracker) Window() time.Duration {
+	return q.window
+}
+
+// Limit returns the number of requests allowed within the window
+func (q *QuotaTracker) Limit() int {
+	return q.limit
+}
+
+// Record counts a request to the vault
+func (q *QuotaTracker) Record(vaultName string) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	start := q.now().Truncate(q.bucketWidth())
+	buckets := q.prune(vaultName, start)
+	if n := len(buckets); n > 0 && buckets[n-1].start.Equal(start) {
+		buckets[n-1].count++
+		return
+	}
+	q.requests[vaultName] = append(buckets, quotaBucket{start: start, count: 1})
+}
+
+// Usage returns the requests to the vault within the window, and the fraction of the limit they make up
+func (q *QuotaTracker) Usage(vaultName string) (int, float64) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	requests := 0
+	for _, bucket := range q.prune(vaultName, q.now()) {
+		requests += bucket.count
+	}
+	if q.limit <= 0 {
+		return requests, 0
+	}
+	return requests, float64(requests) / float64(q.limit)
+}
+
+// Describe implements prometheus.Collector
+func (q *QuotaTracker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- q.requestsDesc
+	ch <- q.usageDesc
+}
+
+// Collect implements prometheus.Collector, exporting the usage of every vault requested within the window
+func (q *QuotaTracker) Collect(ch chan<- prometheus.Metric) {
+	q.mutex.Lock()
+	vaultNames := make([]string, 0, len(q.requests))
+	for vaultName := range q.requests {
+		vaultNames = append(vaultNames, vaultName)
+	}
+	q.mutex.Unlock()
+
+	for _, vaultName := range vaultNames {
+		requests, usage := q.Usage(vaultName)
+		ch <- prometheus.MustNewConstMetric(q.requestsDesc, prometheus.GaugeValue, float64(requests), vaultName)
+		ch <- prometheus.MustNewConstMetric(q.usageDesc, prometheus.GaugeValue, usage, vaultName)
+	}
+}
+
+// prune removes the buckets of the vault no longer within the window at now, forgetting
+// the vault when none are left, and returns the remaining buckets. Must hold the mutex.
+func (q *QuotaTracker) prune(vaultName string, now time.Time) []quotaBucket {
+	windowStart := now.Add(-q.window)
+	buckets := q.requests[vaultName]
+	i := 0
+	for i < len(buckets) && !buckets[i].start.After(windowStart) {
+		i++
+	}
+	buckets = buckets[i:]
+	if len(buckets) == 0 {
+		delete(q.requests, vaultName)
+		return nil
+	}
+	q.requests[vaultName] = buckets
+	return buckets
+}
+
+func (q *QuotaTracker) bucketWidth() time.Duration {
+	width := q.window / quotaBuckets
+	if width <= 0 {
+		return time.Nanosecond
+	}
+	return width
+}
+
+type quotaService struct {
+	service Service
+	tracker *QuotaTracker
+}
+
+// NewQuotaService wraps a Service, counting every request to Azure Key Vault in the tracker
+func NewQuotaService(service Service, tracker *QuotaTracker) Service {
+	return &quotaService{
+		service: service,
+		tracker: tracker,
+	}
+}
+
+// GetSecret get secret from Azure Key Vault, counting the request
+func (q *quotaService) GetSecret(vaultSpec *akvs.AzureKeyVault) (string, error) {
+	q.tracker.Record(vaultSpec.Name)
+	return q.service.GetSecret(vaultSpec)
+}
+
+// GetKey get key from Azure Key Vault, counting the request
+func (q *quotaService) GetKey(vaultSpec *akvs.AzureKeyVault) (string, error) {
+	q.tracker.Record(vaultSpec.Name)
+	return q.service.GetKey(vaultSpec)
+}
+
+// GetCertificate get certificate from Azure Key Vault, counting the request
+func (q *quotaService) GetCertificate(vaultSpec *akvs.AzureKeyVault, options *CertificateOptions) (*Certificate, error) {
+	q.tracker.Record(vaultSpec.Name)
+	return q.service.GetCertificate(vaultSpec, options)
+}
+
+// GetObjectVersion get object version from Azure Key Vault, counting the request
+func (q *quotaService) GetObjectVersion(vaultSpec *akvs.AzureKeyVault) (*ObjectVersion, error) {
+	q.tracker.Record(vaultSpec.Name)
+	return q.service.GetObjectVersion(vaultSpec)
+}
+
+// CreateSecret create secret in Azure Key Vault, counting the request
+func (q *quotaService) CreateSecret(vaultSpec *akvs.AzureKeyVault, value string) error {
+	q.tracker.Record(vaultSpec.Name)
+	return q.service.CreateSecret(vaultSpec, value)
+}
+
+// Probe probes Azure Key Vault, counting the request
+func (q *quotaService) Probe(vaultSpec *akvs.AzureKeyVault) error {
+	q.tracker.Record(vaultSpec.Name)
+	return q.service.Probe(vaultSpec)
+}
+
+// SetTags sets tags of object in Azure Key Vault, counting the request
+func (q *quotaService) SetTags(vaultSpec *akvs.AzureKeyVault, tags map[string]string) (*ObjectVersion, error) {
+	q.tracker.Record(vaultSpec.Name)
+	return q.service.SetTags(vaultSpec, tags)
+}
@@ -0,0 +1,87 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestQuotaTrackerRollingWindow(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker := NewQuotaTracker(10*time.Second, 100)
+	tracker.now = func() time.Time { return now }
+
+	for i := 0; i < 30; i++ {
+		tracker.Record("vault-a")
+	}
+	now = now.Add(5 * time.Second)
+	for i := 0; i < 20; i++ {
+		tracker.Record("vault-a")
+	}
+	tracker.Record("vault-b")
+
+	if requests, usage := tracker.Usage("vault-a"); requests != 50 || usage != 0.5 {
+		t.Errorf("expected 50 requests using 0.5 of the limit, got %d and %v", requests, usage)
+	}
+
+	// The first requests leave the window
+	now = now.Add(5 * time.Second)
+	if requests, _ := tracker.Usage("vault-a"); requests != 20 {
+		t.Errorf("expected 20 requests after the first left the window, got %d", requests)
+	}
+
+	now = now.Add(5 * time.Second)
+	if requests, usage := tracker.Usage("vault-b"); requests != 0 || usage != 0 {
+		t.Errorf("expected no requests after the window, got %d and %v", requests, usage)
+	}
+	if _, found := tracker.requests["vault-b"]; found {
+		t.Error("expected vault without requests within the window to be forgotten")
+	}
+}
+
+func TestQuotaServiceCountsRequests(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	tracker := NewQuotaTracker(DefaultQuotaWindow, DefaultQuotaLimit)
+	if err := registry.Register(tracker); err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewQuotaService(&countingService{}, tracker)
+	vaultSpec := &secret("my-akvs", "my-vault", "my-secret").Spec.Vault
+	service.GetSecret(vaultSpec)
+	service.GetObjectVersion(vaultSpec)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			values[family.GetName()] = metric.Gauge.GetValue()
+		}
+	}
+	if values["akv2k8s_azure_keyvault_quota_requests"] != 2 {
+		t.Errorf("expected 2 requests exported, got %v", values)
+	}
+	if values["akv2k8s_azure_keyvault_quota_usage_ratio"] != 2.0/DefaultQuotaLimit {
+		t.Errorf("expected usage of 2 requests exported, got %v", values)
+	}
+}
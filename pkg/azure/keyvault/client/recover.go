@@ -0,0 +1,227 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/adal"
+	akvs "github.com/SparebankenVest/azure-key-vault-to-kubernetes/pkg/k8s/apis/azure/keyvault/v2alpha1"
+)
+
+// minRecoveryInterval is the minimum time between attempts to recover from authentication failures,
+// so requests failing with invalid credentials do not make the credentials be reloaded on every request
+const minRecoveryInterval = time.Minute
+
+// IsAuthenticationFailure returns true if err is caused by Azure rejecting the credentials used,
+// like when a client secret has expired or been rotated
+func IsAuthenticationFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var detailedErr autorest.DetailedError
+	if errors.As(err, &detailedErr) {
+		if statusCode, ok := detailedErr.StatusCode.(int); ok && statusCode == http.StatusUnauthorized {
+			return true
+		}
+		// Token refresh errors are wrapped by autorest, which does not support unwrapping
+		if detailedErr.Original != nil && IsAuthenticationFailure(detailedErr.Original) {
+			return true
+		}
+	}
+
+	var refreshErr adal.TokenRefreshError
+	if errors.As(err, &refreshErr) {
+		return true
+	}
+	return strings.Contains(err.Error(), "invalid_client")
+}
+
+// RecoveryFunc is called when recovering from an authentication failure, with the error
+// causing it, and the error recovering if recovery failed
+type RecoveryFunc func(authErr error, recoveryErr error)
+
+// RecoveringService is a Service recreating its underlying Service, including credentials and
+// tokens, when requests to Azure Key Vault fail authentication
+type RecoveringService struct {
+	newService func() (Service, error)
+	onRecovery RecoveryFunc
+	now        func() time.Time
+
+	mutex        sync.Mutex
+	service      Service
+	lastRecovery time.Time
+
+	// healthy is 1 unless recovering from an authentication failure has failed. Accessed atomically.
+	healthy int32
+}
+
+// NewRecoveringService creates a RecoveringService using newService to create the Service
+// initially, and again when requests fail authentication
+func NewRecoveringService(newService func() (Service, error), onRecovery RecoveryFunc) (*RecoveringService, error) {
+	service, err := newService()
+	if err != nil {
+		return nil, err
+	}
+	return &RecoveringService{
+		newService: newService,
+		onRecovery: onRecovery,
+		now:        time.Now,
+		service:    service,
+		healthy:    1,
+	}, nil
+}
+
+// Healthy returns false if the last attempt to recover from an authentication failure failed,
+// and no request has succeeded since
+func (r *RecoveringService) Healthy() bool {
+	return atomic.LoadInt32(&r.healthy) == 1
+}
+
+// GetSecret get secret from Azure Key Vault, recovering from authentication failures
+func (r *RecoveringService) GetSecret(vaultSpec *akvs.AzureKeyVault) (string, error) {
+	value, err := r.do(func(service Service) (interface{}, error) {
+		return service.GetSecret(vaultSpec)
+	})
+	if err != nil {
+		return "", err
+	}
+	return value.(string), nil
+}
+
+// GetKey get key from Azure Key Vault, recovering from authentication failures
+func (r *RecoveringService) GetKey(vaultSpec *akvs.AzureKeyVault) (string, error) {
+	value, err := r.do(func(service Service) (interface{}, error) {
+		return service.GetKey(vaultSpec)
+	})
+	if err != nil {
+		return "", err
+	}
+	return value.(string), nil
+}
+
+// GetCertificate get certificate from Azure Key Vault, recovering from authentication failures
+func (r *RecoveringService) GetCertificate(vaultSpec *akvs.AzureKeyVault, options *CertificateOptions) (*Certificate, error) {
+	value, err := r.do(func(service Service) (interface{}, error) {
+		return service.GetCertificate(vaultSpec, options)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*Certificate), nil
+}
+
+// GetObjectVersion get object version from Azure Key Vault, recovering from authentication failures
+func (r *RecoveringService) GetObjectVersion(vaultSpec *akvs.AzureKeyVault) (*ObjectVersion, error) {
+	value, err := r.do(func(service Service) (interface{}, error) {
+		return service.GetObjectVersion(vaultSpec)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*ObjectVersion), nil
+}
+
+// CreateSecret create secret in Azure Key Vault, recovering from authentication failures
+func (r *RecoveringService) CreateSecret(vaultSpec *akvs.AzureKeyVault, value string) error {
+	_, err := r.do(func(service Service) (interface{}, error) {
+		return nil, service.CreateSecret(vaultSpec, value)
+	})
+	return err
+}
+
+// Probe probes Azure Key Vault, recovering from authentication failures
+func (r *RecoveringService) Probe(vaultSpec *akvs.AzureKeyVault) error {
+	_, err := r.do(func(service Service) (interface{}, error) {
+		return nil, service.Probe(vaultSpec)
+	})
+	return err
+}
+
+// SetTags sets tags of object in Azure Key Vault, recovering from authentication failures
+func (r *RecoveringService) SetTags(vaultSpec *akvs.AzureKeyVault, tags map[string]string) (*ObjectVersion, error) {
+	value, err := r.do(func(service Service) (interface{}, error) {
+		return service.SetTags(vaultSpec, tags)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*ObjectVersion), nil
+}
+
+// do calls the request using the current Service, recreating the Service and retrying
+// the request once if it fails authentication
+func (r *RecoveringService) do(request func(service Service) (interface{}, error)) (interface{}, error) {
+	service := r.current()
+	value, err := request(service)
+	if IsAuthenticationFailure(err) {
+		if recovered, ok := r.recover(service, err); ok {
+			value, err = request(recovered)
+		}
+	}
+
+	if err == nil {
+		atomic.StoreInt32(&r.healthy, 1)
+	}
+	return value, err
+}
+
+func (r *RecoveringService) current() Service {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.service
+}
+
+// recover recreates the Service if failed is still the current Service, returning
+// the Service to retry with and true if there is a new Service
+func (r *RecoveringService) recover(failed Service, authErr error) (Service, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// Already recovered by a concurrent request
+	if r.service != failed {
+		return r.service, true
+	}
+
+	now := r.now()
+	if now.Sub(r.lastRecovery) < minRecoveryInterval {
+		return nil, false
+	}
+	r.lastRecovery = now
+
+	service, err := r.newService()
+	if err != nil {
+		atomic.StoreInt32(&r.healthy, 0)
+		if r.onRecovery != nil {
+			r.onRecovery(authErr, err)
+		}
+		return nil, false
+	}
+
+	r.service = service
+	if r.onRecovery != nil {
+		r.onRecovery(authErr, nil)
+	}
+	return service, true
+}
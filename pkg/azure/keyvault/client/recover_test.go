@@ -0,0 +1,129 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+func unauthorizedError() error {
+	return autorest.NewErrorWithResponse("keyvault.BaseClient", "GetSecret", &http.Response{StatusCode: http.StatusUnauthorized}, "Failure responding to request")
+}
+
+func TestIsAuthenticationFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"nil", nil, false},
+		{"unauthorized", unauthorizedError(), true},
+		{"wrapped unauthorized", fmt.Errorf("failed: %w", unauthorizedError()), true},
+		{"forbidden", autorest.NewErrorWithResponse("keyvault.BaseClient", "GetSecret", &http.Response{StatusCode: http.StatusForbidden}, "Failure"), false},
+		{"invalid client", errors.New(`adal: Refresh request failed. Response body: {"error":"invalid_client"}`), true},
+		{"other", errors.New("connection refused"), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := IsAuthenticationFailure(test.err); actual != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRecoveringServiceRecreatesServiceOnAuthenticationFailure(t *testing.T) {
+	expired := &countingService{err: unauthorizedError()}
+	renewed := &countingService{}
+	services := []Service{expired, renewed}
+
+	var recovered int
+	recovering, err := NewRecoveringService(func() (Service, error) {
+		service := services[0]
+		services = services[1:]
+		return service, nil
+	}, func(authErr, recoveryErr error) {
+		if recoveryErr != nil {
+			t.Errorf("expected recovery to succeed, got %v", recoveryErr)
+		}
+		recovered++
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vaultSpec := &secret("my-akvs", "my-vault", "my-secret").Spec.Vault
+	value, err := recovering.GetSecret(vaultSpec)
+	if err != nil {
+		t.Fatalf("expected request to be retried with new credentials, got %v", err)
+	}
+	if value != "value-1" || renewed.secretCalls != 1 {
+		t.Errorf("expected value from renewed service, got %q", value)
+	}
+	if recovered != 1 {
+		t.Errorf("expected recovery to be reported once, got %d", recovered)
+	}
+	if !recovering.Healthy() {
+		t.Error("expected service to be healthy after recovering")
+	}
+}
+
+func TestRecoveringServiceUnhealthyWhenRecoveryFails(t *testing.T) {
+	now := time.Now()
+	expired := &countingService{err: unauthorizedError()}
+	calls := 0
+	recovering, err := NewRecoveringService(func() (Service, error) {
+		calls++
+		if calls == 1 {
+			return expired, nil
+		}
+		return nil, errors.New("credentials not found")
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recovering.now = func() time.Time { return now }
+
+	vaultSpec := &secret("my-akvs", "my-vault", "my-secret").Spec.Vault
+	if _, err := recovering.GetSecret(vaultSpec); err == nil {
+		t.Fatal("expected error when recovery fails")
+	}
+	if recovering.Healthy() {
+		t.Error("expected service to be unhealthy after failed recovery")
+	}
+
+	// Not recovering again until minRecoveryInterval has passed
+	recovering.GetSecret(vaultSpec)
+	if calls != 2 {
+		t.Errorf("expected no recovery within %s, got %d attempts", minRecoveryInterval, calls-1)
+	}
+
+	expired.err = nil
+	if _, err := recovering.GetSecret(vaultSpec); err != nil {
+		t.Fatal(err)
+	}
+	if !recovering.Healthy() {
+		t.Error("expected service to be healthy after a successful request")
+	}
+}
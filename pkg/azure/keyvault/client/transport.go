@@ -0,0 +1,86 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Azure Instance Metadata Service, used for managed identities, must never be reached through a proxy
+const azureInstanceMetadataServiceHost = "169.254.169.254"
+
+// NewHTTPClient creates a http client for connecting to Azure. Requests go through proxyURL if set,
+// or else the proxy in the HTTPS_PROXY and NO_PROXY environment variables. CA certificates in caBundleFile
+// are trusted in addition to the system CA certificates, which is needed behind TLS-inspecting proxies.
+func NewHTTPClient(proxyURL string, caBundleFile string) (*http.Client, error) {
+	proxy := http.ProxyFromEnvironment
+	if proxyURL != "" {
+		parsedURL, err := url.Parse(proxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse proxy url '%s', error: %+v", proxyURL, err)
+		}
+		proxy = http.ProxyURL(parsedURL)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if caBundleFile != "" {
+		caBundle, err := ioutil.ReadFile(caBundleFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca bundle from '%s', error: %+v", caBundleFile, err)
+		}
+
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil || rootCAs == nil {
+			rootCAs = x509.NewCertPool()
+		}
+		if ok := rootCAs.AppendCertsFromPEM(caBundle); !ok {
+			return nil, fmt.Errorf("no pem encoded certificates found in ca bundle '%s'", caBundleFile)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	transport := &http.Transport{
+		Proxy: func(req *http.Request) (*url.URL, error) {
+			if req.URL.Hostname() == azureInstanceMetadataServiceHost {
+				return nil, nil
+			}
+			return proxy(req)
+		},
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       tlsConfig,
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestNewHTTPClientProxy(t *testing.T) {
+	client, err := NewHTTPClient("http://proxy.example.com:3128", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport := client.Transport.(*http.Transport)
+
+	req, _ := http.NewRequest(http.MethodGet, "https://my-vault.vault.azure.net/secrets/my-secret", nil)
+	proxyURL, err := transport.Proxy(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proxyURL == nil || proxyURL.Host != "proxy.example.com:3128" {
+		t.Errorf("expected request to use proxy 'proxy.example.com:3128', got '%v'", proxyURL)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "http://169.254.169.254/metadata/identity/oauth2/token", nil)
+	if proxyURL, _ = transport.Proxy(req); proxyURL != nil {
+		t.Errorf("expected no proxy for instance metadata service, got '%v'", proxyURL)
+	}
+}
+
+func TestNewHTTPClientCABundle(t *testing.T) {
+	file, err := ioutil.TempFile("", "ca-bundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err = file.WriteString("not a certificate"); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	if _, err = NewHTTPClient("", file.Name()); err == nil {
+		t.Error("expected error for ca bundle without certificates")
+	}
+
+	if _, err = NewHTTPClient("", "/does/not/exist"); err == nil {
+		t.Error("expected error for missing ca bundle")
+	}
+}
@@ -0,0 +1,34 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2alpha1
+
+// ApplyTo sets the settings of the Azure Key Vault that are not set to the defaults. The fallback
+// is only used together with the default vault name, as it is the fallback of that Azure Key Vault.
+func (d *AzureKeyVaultDefaultVault) ApplyTo(vault *AzureKeyVault) {
+	if vault.Name == "" {
+		vault.Name = d.Name
+		if vault.Fallback == "" {
+			vault.Fallback = d.Fallback
+		}
+	}
+	if vault.AzureIdentity == "" {
+		vault.AzureIdentity = d.AzureIdentity
+	}
+	if vault.CredentialSet == "" {
+		vault.CredentialSet = d.CredentialSet
+	}
+}
@@ -0,0 +1,125 @@
+/*
+Copyright Sparebanken Vest
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2alpha1
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// CheckPolicies returns an error if the AzureKeyVaultPolicies do not allow AzureKeyVaultSecrets in the namespace
+// to use the Azure Key Vault. Without any AzureKeyVaultPolicies all Azure Key Vaults are allowed, otherwise one
+// of the AzureKeyVaultPolicies applying to the namespace must allow it.
+func CheckPolicies(policies []*AzureKeyVaultPolicy, namespace string, namespaceLabels map[string]string, vault *AzureKeyVault) error {
+	if len(policies) == 0 {
+		return nil
+	}
+
+	var denied []string
+	for _, policy := range policies {
+		selects, err := policy.Selects(namespace, namespaceLabels)
+		if err != nil {
+			return err
+		}
+		if !selects {
+			continue
+		}
+		if err = policy.Allows(vault); err == nil {
+			return nil
+		}
+		denied = append(denied, err.Error())
+	}
+
+	if len(denied) == 0 {
+		return fmt.Errorf("no AzureKeyVaultPolicy applies to namespace '%s'", namespace)
+	}
+	return errors.New(strings.Join(denied, ", "))
+}
+
+// CheckTrustBundlePolicies returns an error unless a policy applying to the namespace with the name and labels
+// allows trust bundles
+func CheckTrustBundlePolicies(policies []*AzureKeyVaultPolicy, namespace string, namespaceLabels map[string]string) error {
+	for _, policy := range policies {
+		selects, err := policy.Selects(namespace, namespaceLabels)
+		if err != nil {
+			return err
+		}
+		if selects && policy.Spec.TrustBundles {
+			return nil
+		}
+	}
+	return fmt.Errorf("no AzureKeyVaultPolicy allows trust bundles for namespace '%s'", namespace)
+}
+
+// Selects returns true if the policy applies to the namespace with the name and labels
+func (p *AzureKeyVaultPolicy) Selects(namespace string, namespaceLabels map[string]string) (bool, error) {
+	if len(p.Spec.Namespaces) == 0 && p.Spec.NamespaceSelector == nil {
+		return true, nil
+	}
+	for _, name := range p.Spec.Namespaces {
+		if name == namespace {
+			return true, nil
+		}
+	}
+	if p.Spec.NamespaceSelector == nil {
+		return false, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(p.Spec.NamespaceSelector)
+	if err != nil {
+		return false, fmt.Errorf("invalid namespaceSelector in AzureKeyVaultPolicy '%s', error: %w", p.Name, err)
+	}
+	return selector.Matches(labels.Set(namespaceLabels)), nil
+}
+
+// Allows returns an error if the policy does not allow the Azure Key Vault, its fallback, credential set or identity
+func (p *AzureKeyVaultPolicy) Allows(vault *AzureKeyVault) error {
+	if !isAllowed(p.Spec.Vaults, vault.Name, strings.EqualFold) {
+		return fmt.Errorf("Azure Key Vault '%s' is not allowed by AzureKeyVaultPolicy '%s'", vault.Name, p.Name)
+	}
+	if vault.Fallback != "" && !isAllowed(p.Spec.Vaults, vault.Fallback, strings.EqualFold) {
+		return fmt.Errorf("fallback Azure Key Vault '%s' is not allowed by AzureKeyVaultPolicy '%s'", vault.Fallback, p.Name)
+	}
+	if !isAllowed(p.Spec.CredentialSets, vault.CredentialSet, equals) {
+		return fmt.Errorf("credential set '%s' is not allowed by AzureKeyVaultPolicy '%s'", vault.CredentialSet, p.Name)
+	}
+	if !isAllowed(p.Spec.AzureIdentities, vault.AzureIdentity, equals) {
+		return fmt.Errorf("Azure identity '%s' is not allowed by AzureKeyVaultPolicy '%s'", vault.AzureIdentity, p.Name)
+	}
+	return nil
+}
+
+// isAllowed returns true if the value is in the allowed values, or there are no allowed values
+func isAllowed(allowed []string, value string, equal func(string, string) bool) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		if equal(a, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func equals(a, b string) bool {
+	return a == b
+}
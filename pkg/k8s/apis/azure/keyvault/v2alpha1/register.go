@@ -46,6 +46,12 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&AzureKeyVaultSecret{},
 		&AzureKeyVaultSecretList{},
+		&AzureKeyVaultDefault{},
+		&AzureKeyVaultDefaultList{},
+		&AzureKeyVaultPolicy{},
+		&AzureKeyVaultPolicyList{},
+		&AzureKeyVaultSecretReport{},
+		&AzureKeyVaultSecretReportList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
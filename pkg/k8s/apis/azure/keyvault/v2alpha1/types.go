@@ -47,6 +47,92 @@ type AzureKeyVaultSecretList struct {
 type AzureKeyVaultSecretSpec struct {
 	Vault  AzureKeyVault       `json:"vault"`
 	Output AzureKeyVaultOutput `json:"output,omitempty"`
+	// Bootstrap creates the object in Azure Key Vault if it does not exist
+	// +optional
+	Bootstrap *AzureKeyVaultBootstrap `json:"bootstrap,omitempty"`
+	// OnObjectDeleted decides what happens to the output Secret when the object is deleted
+	// in Azure Key Vault after being synced. Defaults to KeepLastKnown
+	// +optional
+	OnObjectDeleted AzureKeyVaultObjectDeletedPolicy `json:"onObjectDeleted,omitempty"`
+	// ChangeDetection decides how changes to the object in Azure Key Vault are detected. Defaults to
+	// comparing the version, then the hash of the value
+	// +optional
+	ChangeDetection AzureKeyVaultChangeDetection `json:"changeDetection,omitempty"`
+	// RotationPolicy limits when changes to the object in Azure Key Vault are applied to the output Secret
+	// +optional
+	RotationPolicy *AzureKeyVaultRotationPolicy `json:"rotationPolicy,omitempty"`
+}
+
+// AzureKeyVaultObjectDeletedPolicy is a valid value for AzureKeyVaultSecretSpec.OnObjectDeleted
+type AzureKeyVaultObjectDeletedPolicy string
+
+const (
+	// AzureKeyVaultObjectDeletedPolicyKeepLastKnown keeps the last known value in the output Secret
+	AzureKeyVaultObjectDeletedPolicyKeepLastKnown AzureKeyVaultObjectDeletedPolicy = "KeepLastKnown"
+
+	// AzureKeyVaultObjectDeletedPolicyDeleteSecret deletes the output Secret, or only the keys of
+	// the AzureKeyVaultSecret if the Secret is shared, until the object exists again
+	AzureKeyVaultObjectDeletedPolicyDeleteSecret AzureKeyVaultObjectDeletedPolicy = "DeleteSecret"
+
+	// AzureKeyVaultObjectDeletedPolicyMarkDegraded keeps the last known value in the output Secret,
+	// and sets the Degraded condition of the AzureKeyVaultSecret
+	AzureKeyVaultObjectDeletedPolicyMarkDegraded AzureKeyVaultObjectDeletedPolicy = "MarkDegraded"
+)
+
+// AzureKeyVaultChangeDetection is a valid value for AzureKeyVaultSecretSpec.ChangeDetection
+type AzureKeyVaultChangeDetection string
+
+const (
+	// AzureKeyVaultChangeDetectionValueHash downloads the value on every poll, and writes the output
+	// Secret when the hash of the value changes
+	AzureKeyVaultChangeDetectionValueHash AzureKeyVaultChangeDetection = "ValueHash"
+
+	// AzureKeyVaultChangeDetectionVersionID only downloads the value when the version of the object
+	// changes, and writes the output Secret for every new version, even with the same value
+	AzureKeyVaultChangeDetectionVersionID AzureKeyVaultChangeDetection = "VersionID"
+
+	// AzureKeyVaultChangeDetectionUpdatedTimestamp only downloads the value when the updated timestamp
+	// of the object changes, like when its attributes change, and writes the output Secret every time
+	AzureKeyVaultChangeDetectionUpdatedTimestamp AzureKeyVaultChangeDetection = "UpdatedTimestamp"
+
+	// AzureKeyVaultChangeDetectionAlwaysWrite downloads the value and writes the output Secret on every poll
+	AzureKeyVaultChangeDetectionAlwaysWrite AzureKeyVaultChangeDetection = "AlwaysWrite"
+)
+
+// AzureKeyVaultRotationPolicy limits when changes to the object in Azure Key Vault are applied
+type AzureKeyVaultRotationPolicy struct {
+	// Window is when changes are applied. Changes found outside of it are pending until it opens
+	// +optional
+	Window *AzureKeyVaultRotationWindow `json:"window,omitempty"`
+	// Approval decides whether changes are applied when found, or after being approved. Defaults to Automatic
+	// +optional
+	Approval AzureKeyVaultRotationApproval `json:"approval,omitempty"`
+}
+
+// AzureKeyVaultRotationApproval is a valid value for AzureKeyVaultRotationPolicy.Approval
+type AzureKeyVaultRotationApproval string
+
+const (
+	// AzureKeyVaultRotationApprovalAutomatic applies changes to the object in Azure Key Vault when found
+	AzureKeyVaultRotationApprovalAutomatic AzureKeyVaultRotationApproval = "Automatic"
+
+	// AzureKeyVaultRotationApprovalManual only applies a new version of the object in Azure Key Vault
+	// after it is approved, and sets the PendingApproval condition until then
+	AzureKeyVaultRotationApprovalManual AzureKeyVaultRotationApproval = "Manual"
+)
+
+// AzureKeyVaultRotationWindow is a maintenance window repeating on the same days every week
+type AzureKeyVaultRotationWindow struct {
+	// Days the window opens, like Sat and Sun. Every day if empty
+	// +optional
+	Days []string `json:"days,omitempty"`
+	// Start is the time of day the window opens, like 02:00
+	Start string `json:"start"`
+	// End is the time of day the window closes, like 04:00. Windows ending before they start close the next day
+	End string `json:"end"`
+	// TimeZone is the IANA time zone of Start and End, like Europe/Oslo. Defaults to UTC
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
 }
 
 // AzureKeyVault contains information needed to get the
@@ -55,6 +141,14 @@ type AzureKeyVault struct {
 	Name          string              `json:"name"`
 	Object        AzureKeyVaultObject `json:"object"`
 	AzureIdentity string              `json:"azureIdentity"`
+	// Fallback is the name of a secondary Azure Key Vault to use when
+	// the primary Azure Key Vault keeps failing
+	// +optional
+	Fallback string `json:"fallback,omitempty"`
+	// CredentialSet is the name of the credentials configured in the controller to
+	// use for this Azure Key Vault. If empty the default credentials are used
+	// +optional
+	CredentialSet string `json:"credentialSet,omitempty"`
 }
 
 // AzureKeyVaultObject has information about the Azure Key Vault
@@ -93,11 +187,56 @@ const (
 	AzureKeyVaultObjectContentTypeYaml = "application/x-yaml"
 )
 
+// AzureObjectType returns the type the object has in Azure Key Vault, where multi key value secrets
+// are stored as ordinary secrets
+func (t AzureKeyVaultObjectType) AzureObjectType() AzureKeyVaultObjectType {
+	if t == AzureKeyVaultObjectTypeMultiKeyValueSecret {
+		return AzureKeyVaultObjectTypeSecret
+	}
+	return t
+}
+
+// AzureKeyVaultBootstrap has information needed to create the object
+// of a AzureKeyVaultSecret in Azure Key Vault when it does not exist
+type AzureKeyVaultBootstrap struct {
+	// Generate creates a secret with a random value
+	// +optional
+	Generate *AzureKeyVaultBootstrapGenerate `json:"generate,omitempty"`
+}
+
+// AzureKeyVaultBootstrapGenerate is the policy for random secret values
+type AzureKeyVaultBootstrapGenerate struct {
+	// Length is the number of characters in the value, defaults to 32
+	// +optional
+	Length int `json:"length,omitempty"`
+	// Charset is the characters to use in the value, defaults to alphanumeric
+	// +optional
+	Charset AzureKeyVaultBootstrapCharset `json:"charset,omitempty"`
+}
+
+// AzureKeyVaultBootstrapCharset defines which characters generated secret values contain
+type AzureKeyVaultBootstrapCharset string
+
+const (
+	// AzureKeyVaultBootstrapCharsetAlphanumeric - generate values of letters and digits
+	AzureKeyVaultBootstrapCharsetAlphanumeric AzureKeyVaultBootstrapCharset = "alphanumeric"
+
+	// AzureKeyVaultBootstrapCharsetSymbols - generate values of letters, digits and symbols
+	AzureKeyVaultBootstrapCharsetSymbols AzureKeyVaultBootstrapCharset = "symbols"
+
+	// AzureKeyVaultBootstrapCharsetHex - generate values of lowercase hex digits
+	AzureKeyVaultBootstrapCharsetHex AzureKeyVaultBootstrapCharset = "hex"
+)
+
 // AzureKeyVaultOutput defines output sources, currently only support Secret
 type AzureKeyVaultOutput struct {
 	Secret AzureKeyVaultOutputSecret `json:"secret"`
 	// +optional
 	Transforms []string `json:"transforms,omitempty"`
+	// +optional
+	TrustBundle *AzureKeyVaultOutputTrustBundle `json:"trustBundle,omitempty"`
+	// +optional
+	Clusters []AzureKeyVaultOutputCluster `json:"clusters,omitempty"`
 }
 
 // AzureKeyVaultOutputSecret has information needed to output
@@ -108,6 +247,103 @@ type AzureKeyVaultOutputSecret struct {
 	Type       corev1.SecretType `json:"type,omitempty"`
 	DataKey    string            `json:"dataKey"`
 	ChainOrder string            `json:"chainOrder"`
+	// Bundle shares the Secret with other AzureKeyVaultSecrets having it as bundle output,
+	// each owning only its own keys of the Secret
+	// +optional
+	Bundle bool `json:"bundle,omitempty"`
+	// MergeStrategy decides whether the AzureKeyVaultSecret replaces all data of the Secret,
+	// or adds its keys to a Secret with keys managed by others. Defaults to Replace
+	// +optional
+	MergeStrategy AzureKeyVaultOutputMergeStrategy `json:"mergeStrategy,omitempty"`
+	// RenameGracePeriodSeconds is how long the Secret is kept up to date under its previous name after
+	// Name is changed, giving consumers time to move to the new name before it is deleted. Zero leaves
+	// the previous Secret as it was.
+	// +optional
+	RenameGracePeriodSeconds int64 `json:"renameGracePeriodSeconds,omitempty"`
+	// Chunked spreads the data over several Secrets when it exceeds the size limit of a Secret,
+	// with the main Secret only having an index of the chunks. Only for Opaque Secrets.
+	// +optional
+	Chunked bool `json:"chunked,omitempty"`
+	// IncludeKeys are the only keys of a multi-key-value-secret written to the Secret, as key names
+	// or glob patterns like 'db_*'. All keys are written when empty.
+	// +optional
+	IncludeKeys []string `json:"includeKeys,omitempty"`
+	// ExcludeKeys are keys of a multi-key-value-secret never written to the Secret, as key names
+	// or glob patterns, even if matched by IncludeKeys
+	// +optional
+	ExcludeKeys []string `json:"excludeKeys,omitempty"`
+	// PublicCertificateFallback writes only the public certificate of a certificate whose private key
+	// is not exportable, as the certificate policy in Azure Key Vault has exportable set to false,
+	// instead of failing. The tls.key of kubernetes.io/tls Secrets is left empty.
+	// +optional
+	PublicCertificateFallback bool `json:"publicCertificateFallback,omitempty"`
+	// Layout writes the value using the conventional keys of a well-known layout, like tls.crt, tls.key
+	// and ca.crt, instead of the keys of the Secret type and DataKey
+	// +optional
+	Layout AzureKeyVaultOutputLayout `json:"layout,omitempty"`
+}
+
+// AzureKeyVaultOutputMergeStrategy is a valid value for AzureKeyVaultOutputSecret.MergeStrategy
+type AzureKeyVaultOutputMergeStrategy string
+
+const (
+	// AzureKeyVaultOutputMergeStrategyReplace makes the AzureKeyVaultSecret control the Secret, replacing all its data
+	AzureKeyVaultOutputMergeStrategyReplace AzureKeyVaultOutputMergeStrategy = "Replace"
+
+	// AzureKeyVaultOutputMergeStrategyMergeKeys adds the keys of the AzureKeyVaultSecret to the Secret,
+	// which may exist already, never touching keys it does not own
+	AzureKeyVaultOutputMergeStrategyMergeKeys AzureKeyVaultOutputMergeStrategy = "MergeKeys"
+)
+
+// AzureKeyVaultOutputLayout is a valid value for AzureKeyVaultOutputSecret.Layout
+type AzureKeyVaultOutputLayout string
+
+const (
+	// AzureKeyVaultOutputLayoutTLS writes a certificate as tls.crt with the chain, tls.key and ca.crt
+	// with the CA certificates of the chain, like the Secrets of cert-manager
+	AzureKeyVaultOutputLayoutTLS AzureKeyVaultOutputLayout = "TLS"
+
+	// AzureKeyVaultOutputLayoutCA writes the public certificates of a certificate as ca.crt
+	AzureKeyVaultOutputLayoutCA AzureKeyVaultOutputLayout = "CA"
+
+	// AzureKeyVaultOutputLayoutServiceAccountToken writes a secret as token, along with the namespace
+	// of the AzureKeyVaultSecret as namespace, like projected ServiceAccount tokens
+	AzureKeyVaultOutputLayoutServiceAccountToken AzureKeyVaultOutputLayout = "ServiceAccountToken"
+)
+
+// AzureKeyVaultOutputTrustBundle has information needed to output the certificates
+// of a Secret, like a CA certificate, for all namespaces in Kubernetes to trust
+type AzureKeyVaultOutputTrustBundle struct {
+	// ConfigMap is the name of the ConfigMap to write the certificates to in every namespace
+	// +optional
+	ConfigMap string `json:"configMap,omitempty"`
+	// Key is the ConfigMap key to write the certificates to, defaults to ca.crt
+	// +optional
+	Key string `json:"key,omitempty"`
+	// ClusterTrustBundle is the name of the ClusterTrustBundle to write the certificates to
+	// +optional
+	ClusterTrustBundle string `json:"clusterTrustBundle,omitempty"`
+	// SignerName is the signer name of the ClusterTrustBundle
+	// +optional
+	SignerName string `json:"signerName,omitempty"`
+}
+
+// AzureKeyVaultOutputCluster has information needed to output the Secret
+// of a AzureKeyVaultSecret to another Kubernetes cluster
+type AzureKeyVaultOutputCluster struct {
+	// KubeConfigSecret is the name of the Secret, in the namespace of the AzureKeyVaultSecret,
+	// holding the kubeconfig used to write to the cluster
+	KubeConfigSecret string `json:"kubeConfigSecret"`
+	// Key is the key of the kubeconfig in the Secret, defaults to kubeconfig
+	// +optional
+	Key string `json:"key,omitempty"`
+	// Namespace is the namespace to write the Secret to in the cluster, defaults to the
+	// namespace of the AzureKeyVaultSecret
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// Name is the name of the Secret in the cluster, defaults to the name of the output Secret
+	// +optional
+	Name string `json:"name,omitempty"`
 }
 
 // AzureKeyVaultSecretStatus is the status for a AzureKeyVaultSecret resource
@@ -115,4 +351,249 @@ type AzureKeyVaultSecretStatus struct {
 	SecretHash      string      `json:"secretHash"`
 	LastAzureUpdate metav1.Time `json:"lastAzureUpdate,omitempty"`
 	SecretName      string      `json:"secretName"`
+	// PreviousSecretName is the name of the output Secret before spec.output.secret.name changed,
+	// kept up to date until PreviousSecretDeleteTime when it is deleted
+	// +optional
+	PreviousSecretName string `json:"previousSecretName,omitempty"`
+	// +optional
+	PreviousSecretDeleteTime metav1.Time `json:"previousSecretDeleteTime,omitempty"`
+	// VaultName is the name of the Azure Key Vault that served the current value
+	// +optional
+	VaultName string `json:"vaultName,omitempty"`
+	// +optional
+	ObjectVersion string `json:"objectVersion,omitempty"`
+	// +optional
+	ObjectUpdated metav1.Time `json:"objectUpdated,omitempty"`
+	// CertificateThumbprint is the x509 thumbprint of the current certificate, only set for certificates
+	// +optional
+	CertificateThumbprint string `json:"certificateThumbprint,omitempty"`
+	// PendingVersion is the version of the object in Azure Key Vault waiting for approval, or the hash
+	// of its value when the version is not known
+	// +optional
+	PendingVersion string `json:"pendingVersion,omitempty"`
+	// RetryCount is the number of times in a row getting the object from Azure Key Vault has failed
+	// +optional
+	RetryCount int `json:"retryCount,omitempty"`
+	// NextRetryTime is the earliest time Azure Key Vault is polled again after a failure
+	// +optional
+	NextRetryTime metav1.Time `json:"nextRetryTime,omitempty"`
+	// +optional
+	Conditions []AzureKeyVaultSecretCondition `json:"conditions,omitempty"`
+	// Consumers are the workloads with pods using the output Secret, only set when the controller tracks consumers
+	// +optional
+	Consumers []AzureKeyVaultSecretConsumer `json:"consumers,omitempty"`
+	// RemoteSecrets are the Secrets written to other clusters, with defaults resolved, so they can be
+	// deleted when no longer in spec.output.clusters or when the AzureKeyVaultSecret is deleted
+	// +optional
+	RemoteSecrets []AzureKeyVaultOutputCluster `json:"remoteSecrets,omitempty"`
+	// TrustBundle is the trust bundle last written, so its ConfigMaps and ClusterTrustBundle can be
+	// deleted when no longer in spec.output.trustBundle or when the AzureKeyVaultSecret is deleted
+	// +optional
+	TrustBundle *AzureKeyVaultOutputTrustBundle `json:"trustBundle,omitempty"`
+}
+
+// AzureKeyVaultSecretConsumer is a workload with pods using the output Secret of a AzureKeyVaultSecret
+type AzureKeyVaultSecretConsumer struct {
+	// Kind is the kind of workload, like Deployment or StatefulSet, or Pod for pods without an owner
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// AzureKeyVaultSecretConditionType is a valid value for AzureKeyVaultSecretCondition.Type
+type AzureKeyVaultSecretConditionType string
+
+const (
+	// AzureKeyVaultSecretConditionSoftDeleted means the object in Azure Key Vault has been deleted,
+	// but can still be recovered
+	AzureKeyVaultSecretConditionSoftDeleted AzureKeyVaultSecretConditionType = "SoftDeleted"
+
+	// AzureKeyVaultSecretConditionDegraded means the Azure Key Vault is failing and
+	// requests to it are paused until it recovers
+	AzureKeyVaultSecretConditionDegraded AzureKeyVaultSecretConditionType = "Degraded"
+
+	// AzureKeyVaultSecretConditionForbidden means Azure Key Vault denies the controller getting the object,
+	// with what to change in Azure for it to be allowed as message
+	AzureKeyVaultSecretConditionForbidden AzureKeyVaultSecretConditionType = "Forbidden"
+
+	// AzureKeyVaultSecretConditionObjectDeleted means the object in Azure Key Vault has been deleted
+	// after being synced, and the OnObjectDeleted policy has been applied
+	AzureKeyVaultSecretConditionObjectDeleted AzureKeyVaultSecretConditionType = "ObjectDeleted"
+
+	// AzureKeyVaultSecretConditionDrifted means the data of the output Secret has been changed
+	// outside of the controller and differs from Azure Key Vault
+	AzureKeyVaultSecretConditionDrifted AzureKeyVaultSecretConditionType = "Drifted"
+
+	// AzureKeyVaultSecretConditionVaultReachable tells whether the last probe of the Azure Key Vault
+	// succeeded, independent of syncing the object. False with the reason of the failure as reason.
+	AzureKeyVaultSecretConditionVaultReachable AzureKeyVaultSecretConditionType = "VaultReachable"
+
+	// AzureKeyVaultSecretConditionTooLarge means the value from Azure Key Vault exceeds the size limit
+	// of a Secret, and the output Secret is not updated
+	AzureKeyVaultSecretConditionTooLarge AzureKeyVaultSecretConditionType = "TooLarge"
+
+	// AzureKeyVaultSecretConditionNotExportable means the private key of the certificate cannot be exported,
+	// as the certificate policy in Azure Key Vault does not allow it. Reason PublicCertificateOnly when
+	// only the public certificate is written to the Secret using PublicCertificateFallback.
+	AzureKeyVaultSecretConditionNotExportable AzureKeyVaultSecretConditionType = "NotExportable"
+
+	// AzureKeyVaultSecretConditionQuotaNearLimit means the controller is close to the request limit of the
+	// Azure Key Vault, and requests to it may soon be throttled
+	AzureKeyVaultSecretConditionQuotaNearLimit AzureKeyVaultSecretConditionType = "QuotaNearLimit"
+
+	// AzureKeyVaultSecretConditionPendingRotation means a change to the object in Azure Key Vault is waiting
+	// for the rotation window to open before being applied to the output Secret
+	AzureKeyVaultSecretConditionPendingRotation AzureKeyVaultSecretConditionType = "PendingRotation"
+
+	// AzureKeyVaultSecretConditionPendingApproval means a new version of the object in Azure Key Vault is
+	// waiting for approval before being applied to the output Secret, with the rotation approval Manual
+	AzureKeyVaultSecretConditionPendingApproval AzureKeyVaultSecretConditionType = "PendingApproval"
+
+	// AzureKeyVaultSecretConditionCredentialsHealthy tells whether Azure accepted the credentials used for the
+	// Azure Key Vault in the latest credential check. Unknown when the check failed for other reasons.
+	AzureKeyVaultSecretConditionCredentialsHealthy AzureKeyVaultSecretConditionType = "CredentialsHealthy"
+)
+
+// AzureKeyVaultSecretCondition describes the state of a AzureKeyVaultSecret at a certain point
+type AzureKeyVaultSecretCondition struct {
+	Type   AzureKeyVaultSecretConditionType `json:"type"`
+	Status corev1.ConditionStatus           `json:"status"`
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// +optional
+	Reason string `json:"reason,omitempty"`
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// AzureKeyVaultDefault holds the Azure Key Vault settings used by AzureKeyVaultSecrets
+// in its namespace that do not set them
+type AzureKeyVaultDefault struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec AzureKeyVaultDefaultSpec `json:"spec"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// AzureKeyVaultDefaultList is a list of AzureKeyVaultDefault resources
+type AzureKeyVaultDefaultList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []AzureKeyVaultDefault `json:"items"`
+}
+
+// AzureKeyVaultDefaultSpec is the spec for a AzureKeyVaultDefault resource
+type AzureKeyVaultDefaultSpec struct {
+	Vault AzureKeyVaultDefaultVault `json:"vault"`
+}
+
+// AzureKeyVaultDefaultVault has the defaults for the Azure Key Vault of AzureKeyVaultSecrets.
+// The tenant and credentials are chosen with the credential set.
+type AzureKeyVaultDefaultVault struct {
+	// +optional
+	Name string `json:"name,omitempty"`
+	// +optional
+	AzureIdentity string `json:"azureIdentity,omitempty"`
+	// +optional
+	Fallback string `json:"fallback,omitempty"`
+	// +optional
+	CredentialSet string `json:"credentialSet,omitempty"`
+}
+
+// +genclient
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// AzureKeyVaultPolicy restricts which Azure Key Vaults, credential sets and identities
+// AzureKeyVaultSecrets in the namespaces it selects may use
+type AzureKeyVaultPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec AzureKeyVaultPolicySpec `json:"spec"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// AzureKeyVaultPolicyList is a list of AzureKeyVaultPolicy resources
+type AzureKeyVaultPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []AzureKeyVaultPolicy `json:"items"`
+}
+
+// AzureKeyVaultPolicySpec is the spec for a AzureKeyVaultPolicy resource
+type AzureKeyVaultPolicySpec struct {
+	// Namespaces are the names of the namespaces the policy applies to
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+	// NamespaceSelector selects the namespaces the policy applies to by label. If neither
+	// namespaces nor namespaceSelector is set, the policy applies to all namespaces
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// Vaults are the names of the Azure Key Vaults that may be used. Any if empty
+	// +optional
+	Vaults []string `json:"vaults,omitempty"`
+	// CredentialSets are the names of the credential sets that may be used, with an
+	// empty name for the default credentials. Any if empty
+	// +optional
+	CredentialSets []string `json:"credentialSets,omitempty"`
+	// AzureIdentities are the names of the Azure identities that may be used. Any if empty
+	// +optional
+	AzureIdentities []string `json:"azureIdentities,omitempty"`
+	// TrustBundles allows AzureKeyVaultSecrets in the namespaces to write trust bundles to every
+	// namespace and to ClusterTrustBundles, which is not allowed for any namespace by default
+	// +optional
+	TrustBundles bool `json:"trustBundles,omitempty"`
+}
+
+// +genclient
+// +genclient:noStatus
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// AzureKeyVaultSecretReport summarizes the state of the AzureKeyVaultSecrets in its namespace.
+// It is maintained by the controller, for dashboards not able to watch every AzureKeyVaultSecret.
+type AzureKeyVaultSecretReport struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// +optional
+	Status AzureKeyVaultSecretReportStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// AzureKeyVaultSecretReportList is a list of AzureKeyVaultSecretReport resources
+type AzureKeyVaultSecretReportList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []AzureKeyVaultSecretReport `json:"items"`
+}
+
+// AzureKeyVaultSecretReportStatus counts the AzureKeyVaultSecrets in a namespace by state
+type AzureKeyVaultSecretReportStatus struct {
+	// LastUpdate is when the counts last changed
+	// +optional
+	LastUpdate metav1.Time `json:"lastUpdate,omitempty"`
+	// Total is the number of AzureKeyVaultSecrets in the namespace
+	Total int `json:"total"`
+	// Synced is the number of AzureKeyVaultSecrets synced from Azure Key Vault without errors
+	Synced int `json:"synced"`
+	// Failed is the number of AzureKeyVaultSecrets failing to sync from Azure Key Vault
+	Failed int `json:"failed"`
+	// Expiring is the number of AzureKeyVaultSecrets with a certificate about to expire
+	Expiring int `json:"expiring"`
+	// FailedSecrets are the names of the failing AzureKeyVaultSecrets
+	// +optional
+	FailedSecrets []string `json:"failedSecrets,omitempty"`
+	// ExpiringSecrets are the names of the AzureKeyVaultSecrets with a certificate about to expire
+	// +optional
+	ExpiringSecrets []string `json:"expiringSecrets,omitempty"`
 }
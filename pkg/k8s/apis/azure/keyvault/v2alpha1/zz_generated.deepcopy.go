@@ -24,6 +24,7 @@ limitations under the License.
 package v2alpha1
 
 import (
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -44,6 +45,136 @@ func (in *AzureKeyVault) DeepCopy() *AzureKeyVault {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureKeyVaultBootstrap) DeepCopyInto(out *AzureKeyVaultBootstrap) {
+	*out = *in
+	if in.Generate != nil {
+		in, out := &in.Generate, &out.Generate
+		*out = new(AzureKeyVaultBootstrapGenerate)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureKeyVaultBootstrap.
+func (in *AzureKeyVaultBootstrap) DeepCopy() *AzureKeyVaultBootstrap {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureKeyVaultBootstrap)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureKeyVaultBootstrapGenerate) DeepCopyInto(out *AzureKeyVaultBootstrapGenerate) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureKeyVaultBootstrapGenerate.
+func (in *AzureKeyVaultBootstrapGenerate) DeepCopy() *AzureKeyVaultBootstrapGenerate {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureKeyVaultBootstrapGenerate)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureKeyVaultDefault) DeepCopyInto(out *AzureKeyVaultDefault) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureKeyVaultDefault.
+func (in *AzureKeyVaultDefault) DeepCopy() *AzureKeyVaultDefault {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureKeyVaultDefault)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *AzureKeyVaultDefault) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureKeyVaultDefaultList) DeepCopyInto(out *AzureKeyVaultDefaultList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]AzureKeyVaultDefault, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureKeyVaultDefaultList.
+func (in *AzureKeyVaultDefaultList) DeepCopy() *AzureKeyVaultDefaultList {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureKeyVaultDefaultList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *AzureKeyVaultDefaultList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureKeyVaultDefaultSpec) DeepCopyInto(out *AzureKeyVaultDefaultSpec) {
+	*out = *in
+	out.Vault = in.Vault
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureKeyVaultDefaultSpec.
+func (in *AzureKeyVaultDefaultSpec) DeepCopy() *AzureKeyVaultDefaultSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureKeyVaultDefaultSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureKeyVaultDefaultVault) DeepCopyInto(out *AzureKeyVaultDefaultVault) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureKeyVaultDefaultVault.
+func (in *AzureKeyVaultDefaultVault) DeepCopy() *AzureKeyVaultDefaultVault {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureKeyVaultDefaultVault)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AzureKeyVaultObject) DeepCopyInto(out *AzureKeyVaultObject) {
 	*out = *in
@@ -63,12 +194,22 @@ func (in *AzureKeyVaultObject) DeepCopy() *AzureKeyVaultObject {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AzureKeyVaultOutput) DeepCopyInto(out *AzureKeyVaultOutput) {
 	*out = *in
-	out.Secret = in.Secret
+	in.Secret.DeepCopyInto(&out.Secret)
 	if in.Transforms != nil {
 		in, out := &in.Transforms, &out.Transforms
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.TrustBundle != nil {
+		in, out := &in.TrustBundle, &out.TrustBundle
+		*out = new(AzureKeyVaultOutputTrustBundle)
+		**out = **in
+	}
+	if in.Clusters != nil {
+		in, out := &in.Clusters, &out.Clusters
+		*out = make([]AzureKeyVaultOutputCluster, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -82,9 +223,35 @@ func (in *AzureKeyVaultOutput) DeepCopy() *AzureKeyVaultOutput {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureKeyVaultOutputCluster) DeepCopyInto(out *AzureKeyVaultOutputCluster) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureKeyVaultOutputCluster.
+func (in *AzureKeyVaultOutputCluster) DeepCopy() *AzureKeyVaultOutputCluster {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureKeyVaultOutputCluster)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AzureKeyVaultOutputSecret) DeepCopyInto(out *AzureKeyVaultOutputSecret) {
 	*out = *in
+	if in.IncludeKeys != nil {
+		in, out := &in.IncludeKeys, &out.IncludeKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ExcludeKeys != nil {
+		in, out := &in.ExcludeKeys, &out.ExcludeKeys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -98,6 +265,165 @@ func (in *AzureKeyVaultOutputSecret) DeepCopy() *AzureKeyVaultOutputSecret {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureKeyVaultOutputTrustBundle) DeepCopyInto(out *AzureKeyVaultOutputTrustBundle) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureKeyVaultOutputTrustBundle.
+func (in *AzureKeyVaultOutputTrustBundle) DeepCopy() *AzureKeyVaultOutputTrustBundle {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureKeyVaultOutputTrustBundle)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureKeyVaultPolicy) DeepCopyInto(out *AzureKeyVaultPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureKeyVaultPolicy.
+func (in *AzureKeyVaultPolicy) DeepCopy() *AzureKeyVaultPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureKeyVaultPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *AzureKeyVaultPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureKeyVaultPolicyList) DeepCopyInto(out *AzureKeyVaultPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]AzureKeyVaultPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureKeyVaultPolicyList.
+func (in *AzureKeyVaultPolicyList) DeepCopy() *AzureKeyVaultPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureKeyVaultPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *AzureKeyVaultPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureKeyVaultPolicySpec) DeepCopyInto(out *AzureKeyVaultPolicySpec) {
+	*out = *in
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Vaults != nil {
+		in, out := &in.Vaults, &out.Vaults
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.CredentialSets != nil {
+		in, out := &in.CredentialSets, &out.CredentialSets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AzureIdentities != nil {
+		in, out := &in.AzureIdentities, &out.AzureIdentities
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureKeyVaultPolicySpec.
+func (in *AzureKeyVaultPolicySpec) DeepCopy() *AzureKeyVaultPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureKeyVaultPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureKeyVaultRotationPolicy) DeepCopyInto(out *AzureKeyVaultRotationPolicy) {
+	*out = *in
+	if in.Window != nil {
+		in, out := &in.Window, &out.Window
+		*out = new(AzureKeyVaultRotationWindow)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureKeyVaultRotationPolicy.
+func (in *AzureKeyVaultRotationPolicy) DeepCopy() *AzureKeyVaultRotationPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureKeyVaultRotationPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureKeyVaultRotationWindow) DeepCopyInto(out *AzureKeyVaultRotationWindow) {
+	*out = *in
+	if in.Days != nil {
+		in, out := &in.Days, &out.Days
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureKeyVaultRotationWindow.
+func (in *AzureKeyVaultRotationWindow) DeepCopy() *AzureKeyVaultRotationWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureKeyVaultRotationWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AzureKeyVaultSecret) DeepCopyInto(out *AzureKeyVaultSecret) {
 	*out = *in
@@ -126,6 +452,39 @@ func (in *AzureKeyVaultSecret) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureKeyVaultSecretCondition) DeepCopyInto(out *AzureKeyVaultSecretCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureKeyVaultSecretCondition.
+func (in *AzureKeyVaultSecretCondition) DeepCopy() *AzureKeyVaultSecretCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureKeyVaultSecretCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureKeyVaultSecretConsumer) DeepCopyInto(out *AzureKeyVaultSecretConsumer) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureKeyVaultSecretConsumer.
+func (in *AzureKeyVaultSecretConsumer) DeepCopy() *AzureKeyVaultSecretConsumer {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureKeyVaultSecretConsumer)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AzureKeyVaultSecretList) DeepCopyInto(out *AzureKeyVaultSecretList) {
 	*out = *in
@@ -159,11 +518,108 @@ func (in *AzureKeyVaultSecretList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureKeyVaultSecretReport) DeepCopyInto(out *AzureKeyVaultSecretReport) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureKeyVaultSecretReport.
+func (in *AzureKeyVaultSecretReport) DeepCopy() *AzureKeyVaultSecretReport {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureKeyVaultSecretReport)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *AzureKeyVaultSecretReport) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureKeyVaultSecretReportList) DeepCopyInto(out *AzureKeyVaultSecretReportList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]AzureKeyVaultSecretReport, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureKeyVaultSecretReportList.
+func (in *AzureKeyVaultSecretReportList) DeepCopy() *AzureKeyVaultSecretReportList {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureKeyVaultSecretReportList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *AzureKeyVaultSecretReportList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AzureKeyVaultSecretReportStatus) DeepCopyInto(out *AzureKeyVaultSecretReportStatus) {
+	*out = *in
+	in.LastUpdate.DeepCopyInto(&out.LastUpdate)
+	if in.FailedSecrets != nil {
+		in, out := &in.FailedSecrets, &out.FailedSecrets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ExpiringSecrets != nil {
+		in, out := &in.ExpiringSecrets, &out.ExpiringSecrets
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AzureKeyVaultSecretReportStatus.
+func (in *AzureKeyVaultSecretReportStatus) DeepCopy() *AzureKeyVaultSecretReportStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(AzureKeyVaultSecretReportStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AzureKeyVaultSecretSpec) DeepCopyInto(out *AzureKeyVaultSecretSpec) {
 	*out = *in
 	out.Vault = in.Vault
 	in.Output.DeepCopyInto(&out.Output)
+	if in.Bootstrap != nil {
+		in, out := &in.Bootstrap, &out.Bootstrap
+		*out = new(AzureKeyVaultBootstrap)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RotationPolicy != nil {
+		in, out := &in.RotationPolicy, &out.RotationPolicy
+		*out = new(AzureKeyVaultRotationPolicy)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -181,6 +637,31 @@ func (in *AzureKeyVaultSecretSpec) DeepCopy() *AzureKeyVaultSecretSpec {
 func (in *AzureKeyVaultSecretStatus) DeepCopyInto(out *AzureKeyVaultSecretStatus) {
 	*out = *in
 	in.LastAzureUpdate.DeepCopyInto(&out.LastAzureUpdate)
+	in.PreviousSecretDeleteTime.DeepCopyInto(&out.PreviousSecretDeleteTime)
+	in.ObjectUpdated.DeepCopyInto(&out.ObjectUpdated)
+	in.NextRetryTime.DeepCopyInto(&out.NextRetryTime)
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]AzureKeyVaultSecretCondition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Consumers != nil {
+		in, out := &in.Consumers, &out.Consumers
+		*out = make([]AzureKeyVaultSecretConsumer, len(*in))
+		copy(*out, *in)
+	}
+	if in.RemoteSecrets != nil {
+		in, out := &in.RemoteSecrets, &out.RemoteSecrets
+		*out = make([]AzureKeyVaultOutputCluster, len(*in))
+		copy(*out, *in)
+	}
+	if in.TrustBundle != nil {
+		in, out := &in.TrustBundle, &out.TrustBundle
+		*out = new(AzureKeyVaultOutputTrustBundle)
+		**out = **in
+	}
 	return
 }
 
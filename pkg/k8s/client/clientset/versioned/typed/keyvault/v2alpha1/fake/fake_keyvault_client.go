@@ -31,10 +31,22 @@ type FakeKeyvaultV2alpha1 struct {
 	*testing.Fake
 }
 
+func (c *FakeKeyvaultV2alpha1) AzureKeyVaultDefaults(namespace string) v2alpha1.AzureKeyVaultDefaultInterface {
+	return &FakeAzureKeyVaultDefaults{c, namespace}
+}
+
+func (c *FakeKeyvaultV2alpha1) AzureKeyVaultPolicies() v2alpha1.AzureKeyVaultPolicyInterface {
+	return &FakeAzureKeyVaultPolicies{c}
+}
+
 func (c *FakeKeyvaultV2alpha1) AzureKeyVaultSecrets(namespace string) v2alpha1.AzureKeyVaultSecretInterface {
 	return &FakeAzureKeyVaultSecrets{c, namespace}
 }
 
+func (c *FakeKeyvaultV2alpha1) AzureKeyVaultSecretReports(namespace string) v2alpha1.AzureKeyVaultSecretReportInterface {
+	return &FakeAzureKeyVaultSecretReports{c, namespace}
+}
+
 // RESTClient returns a RESTClient that is used to communicate
 // with API server by this client implementation.
 func (c *FakeKeyvaultV2alpha1) RESTClient() rest.Interface {
@@ -21,4 +21,10 @@ limitations under the License.
 
 package v2alpha1
 
+type AzureKeyVaultDefaultExpansion interface{}
+
+type AzureKeyVaultPolicyExpansion interface{}
+
 type AzureKeyVaultSecretExpansion interface{}
+
+type AzureKeyVaultSecretReportExpansion interface{}
@@ -29,7 +29,10 @@ import (
 
 type KeyvaultV2alpha1Interface interface {
 	RESTClient() rest.Interface
+	AzureKeyVaultDefaultsGetter
+	AzureKeyVaultPoliciesGetter
 	AzureKeyVaultSecretsGetter
+	AzureKeyVaultSecretReportsGetter
 }
 
 // KeyvaultV2alpha1Client is used to interact with features provided by the keyvault.azure.spv.no group.
@@ -37,10 +40,22 @@ type KeyvaultV2alpha1Client struct {
 	restClient rest.Interface
 }
 
+func (c *KeyvaultV2alpha1Client) AzureKeyVaultDefaults(namespace string) AzureKeyVaultDefaultInterface {
+	return newAzureKeyVaultDefaults(c, namespace)
+}
+
+func (c *KeyvaultV2alpha1Client) AzureKeyVaultPolicies() AzureKeyVaultPolicyInterface {
+	return newAzureKeyVaultPolicies(c)
+}
+
 func (c *KeyvaultV2alpha1Client) AzureKeyVaultSecrets(namespace string) AzureKeyVaultSecretInterface {
 	return newAzureKeyVaultSecrets(c, namespace)
 }
 
+func (c *KeyvaultV2alpha1Client) AzureKeyVaultSecretReports(namespace string) AzureKeyVaultSecretReportInterface {
+	return newAzureKeyVaultSecretReports(c, namespace)
+}
+
 // NewForConfig creates a new KeyvaultV2alpha1Client for the given config.
 func NewForConfig(c *rest.Config) (*KeyvaultV2alpha1Client, error) {
 	config := *c
@@ -66,8 +66,14 @@ func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Keyvault().V1alpha1().AzureKeyVaultSecrets().Informer()}, nil
 
 		// Group=keyvault.azure.spv.no, Version=v2alpha1
+	case v2alpha1.SchemeGroupVersion.WithResource("azurekeyvaultdefaults"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Keyvault().V2alpha1().AzureKeyVaultDefaults().Informer()}, nil
+	case v2alpha1.SchemeGroupVersion.WithResource("azurekeyvaultpolicies"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Keyvault().V2alpha1().AzureKeyVaultPolicies().Informer()}, nil
 	case v2alpha1.SchemeGroupVersion.WithResource("azurekeyvaultsecrets"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Keyvault().V2alpha1().AzureKeyVaultSecrets().Informer()}, nil
+	case v2alpha1.SchemeGroupVersion.WithResource("azurekeyvaultsecretreports"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Keyvault().V2alpha1().AzureKeyVaultSecretReports().Informer()}, nil
 
 	}
 
@@ -27,8 +27,14 @@ import (
 
 // Interface provides access to all the informers in this group version.
 type Interface interface {
+	// AzureKeyVaultDefaults returns a AzureKeyVaultDefaultInformer.
+	AzureKeyVaultDefaults() AzureKeyVaultDefaultInformer
+	// AzureKeyVaultPolicies returns a AzureKeyVaultPolicyInformer.
+	AzureKeyVaultPolicies() AzureKeyVaultPolicyInformer
 	// AzureKeyVaultSecrets returns a AzureKeyVaultSecretInformer.
 	AzureKeyVaultSecrets() AzureKeyVaultSecretInformer
+	// AzureKeyVaultSecretReports returns a AzureKeyVaultSecretReportInformer.
+	AzureKeyVaultSecretReports() AzureKeyVaultSecretReportInformer
 }
 
 type version struct {
@@ -42,7 +48,22 @@ func New(f internalinterfaces.SharedInformerFactory, namespace string, tweakList
 	return &version{factory: f, namespace: namespace, tweakListOptions: tweakListOptions}
 }
 
+// AzureKeyVaultDefaults returns a AzureKeyVaultDefaultInformer.
+func (v *version) AzureKeyVaultDefaults() AzureKeyVaultDefaultInformer {
+	return &azureKeyVaultDefaultInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
+
+// AzureKeyVaultPolicies returns a AzureKeyVaultPolicyInformer.
+func (v *version) AzureKeyVaultPolicies() AzureKeyVaultPolicyInformer {
+	return &azureKeyVaultPolicyInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
+
 // AzureKeyVaultSecrets returns a AzureKeyVaultSecretInformer.
 func (v *version) AzureKeyVaultSecrets() AzureKeyVaultSecretInformer {
 	return &azureKeyVaultSecretInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
 }
+
+// AzureKeyVaultSecretReports returns a AzureKeyVaultSecretReportInformer.
+func (v *version) AzureKeyVaultSecretReports() AzureKeyVaultSecretReportInformer {
+	return &azureKeyVaultSecretReportInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
@@ -21,6 +21,18 @@ limitations under the License.
 
 package v2alpha1
 
+// AzureKeyVaultDefaultListerExpansion allows custom methods to be added to
+// AzureKeyVaultDefaultLister.
+type AzureKeyVaultDefaultListerExpansion interface{}
+
+// AzureKeyVaultDefaultNamespaceListerExpansion allows custom methods to be added to
+// AzureKeyVaultDefaultNamespaceLister.
+type AzureKeyVaultDefaultNamespaceListerExpansion interface{}
+
+// AzureKeyVaultPolicyListerExpansion allows custom methods to be added to
+// AzureKeyVaultPolicyLister.
+type AzureKeyVaultPolicyListerExpansion interface{}
+
 // AzureKeyVaultSecretListerExpansion allows custom methods to be added to
 // AzureKeyVaultSecretLister.
 type AzureKeyVaultSecretListerExpansion interface{}
@@ -28,3 +40,11 @@ type AzureKeyVaultSecretListerExpansion interface{}
 // AzureKeyVaultSecretNamespaceListerExpansion allows custom methods to be added to
 // AzureKeyVaultSecretNamespaceLister.
 type AzureKeyVaultSecretNamespaceListerExpansion interface{}
+
+// AzureKeyVaultSecretReportListerExpansion allows custom methods to be added to
+// AzureKeyVaultSecretReportLister.
+type AzureKeyVaultSecretReportListerExpansion interface{}
+
+// AzureKeyVaultSecretReportNamespaceListerExpansion allows custom methods to be added to
+// AzureKeyVaultSecretReportNamespaceLister.
+type AzureKeyVaultSecretReportNamespaceListerExpansion interface{}